@@ -0,0 +1,62 @@
+// Command herbarium-agent runs leaf processes on behalf of a herbarium instance on another host.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/agent"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take once shutdown starts.
+const shutdownTimeout = 10 * time.Second
+
+var (
+	listenAddress = flag.String("listen", agent.DefaultListenAddress, "address the agent API listens on")
+	insecure      = flag.Bool("insecure", false, "run without HERBARIUM_AGENT_API_KEY, listening on the loopback interface only")
+)
+
+func main() {
+	flag.Parse()
+
+	// Services are deployed under services/<name>/<version> of the agent's own root folder
+	if os.Getenv("PLANTARIUM_ROOT_FOLDER") == "" {
+		log.Fatalf("PLANTARIUM_ROOT_FOLDER not set")
+	}
+
+	// Anyone reaching an agent without a key can run commands on its host, so that is only allowed on loopback
+	address := *listenAddress
+	apiKey := os.Getenv("HERBARIUM_AGENT_API_KEY")
+	if apiKey == "" {
+		if !*insecure {
+			log.Fatalf("HERBARIUM_AGENT_API_KEY not set; set it, or pass -insecure to accept unauthenticated requests on the loopback interface")
+		}
+		loopback, err := agent.LoopbackAddress(address)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		address = loopback
+		log.Printf("HERBARIUM_AGENT_API_KEY is not set; the agent API accepts unauthenticated requests on %s only", address)
+	}
+
+	server := agent.NewServer(address, apiKey)
+	if err := server.Start(); err != nil {
+		log.Fatalf("Failed to start agent API: %v", err)
+	}
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
+	<-signalChannel
+
+	log.Println("Termination signal received. Shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Failed to shut down agent API: %v", err)
+	}
+}
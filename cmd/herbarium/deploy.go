@@ -0,0 +1,203 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/admin"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// deployUsage describes the deploy command.
+const deployUsage = "usage: herbarium deploy [--api-url URL] [--api-key KEY] [--timeout DURATION] [--sha256 HEX] [--signature URL] <directory|archive.tar.gz|artifact URL>"
+
+// deployPollInterval is how often the leafs of a deployed stem are checked while waiting for them.
+const deployPollInterval = time.Second
+
+// runDeployCommand handles `herbarium deploy`, which uploads a service version directory, packed on the
+// fly, or an existing .tar.gz of one to the running daemon, waits until the leafs of the new stem are
+// running, and prints a rollout summary. It fails when the deploy is rejected or the leafs don't become
+// healthy in time.
+func runDeployCommand(args []string) error {
+	flags := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	apiURL := flags.String("api-url", envOrDefault("HERBARIUM_API_URL", "http://"+admin.DefaultListenAddress), "admin API base URL")
+	apiKey := flags.String("api-key", os.Getenv("HERBARIUM_API_KEY"), "admin API key")
+	timeout := flags.Duration("timeout", 2*time.Minute, "how long to wait for the leafs to become healthy")
+	checksum := flags.String("sha256", "", "SHA-256 checksum the artifact must match")
+	signature := flags.String("signature", "", "URL of the artifact's detached signature")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(deployUsage)
+	}
+
+	started := time.Now()
+	api := client.NewClient(*apiURL, *apiKey).SetActor(cliActor())
+	var stem *client.StemSummary
+	var err error
+	if isArtifactURL(flags.Arg(0)) {
+		// The daemon downloads remote artifacts itself
+		stem, err = api.DeployArtifact(models.ArtifactConfig{URL: flags.Arg(0), SHA256: *checksum, Signature: *signature})
+	} else if *checksum != "" || *signature != "" {
+		return errors.New("--sha256 and --signature only apply to artifact URLs")
+	} else {
+		var archive io.Reader
+		if archive, err = deploymentArchive(flags.Arg(0)); err != nil {
+			return err
+		}
+		stem, err = api.DeployStem(archive)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Registered stem %s version %s at %s\n", stem.Name, stem.Version, stem.URL)
+	if stem.Artifact != "" {
+		fmt.Printf("Verified artifact %s\n", stem.Artifact)
+	}
+	if stem.GitCommit != "" {
+		fmt.Printf("Built from commit %s\n", stem.GitCommit)
+	}
+
+	leafs, waitErr := waitForLeafs(api, stem, started.Add(*timeout))
+	writeRolloutSummary(os.Stdout, leafs, time.Since(started))
+	return waitErr
+}
+
+// isArtifactURL reports whether the deploy argument is the URL of a remote artifact rather than a local path.
+func isArtifactURL(arg string) bool {
+	for _, scheme := range []string{"https://", "http://", "s3://", "oci://"} {
+		if strings.HasPrefix(arg, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// deploymentArchive returns the archive to upload for path: a .tar.gz or .tgz as is, or a directory packed
+// into one.
+func deploymentArchive(path string) (io.Reader, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if !strings.HasSuffix(path, ".tar.gz") && !strings.HasSuffix(path, ".tgz") {
+			return nil, fmt.Errorf("%s is neither a directory nor a .tar.gz archive", path)
+		}
+		return os.Open(path)
+	}
+	if _, err := os.Stat(filepath.Join(path, "config.yaml")); err != nil {
+		return nil, fmt.Errorf("%s has no config.yaml", path)
+	}
+
+	var archive bytes.Buffer
+	if err := packDirectory(path, &archive); err != nil {
+		return nil, fmt.Errorf("failed to pack %s: %v", path, err)
+	}
+	return &archive, nil
+}
+
+// packDirectory writes the contents of dir to out as a gzip-compressed tar, with paths relative to dir.
+func packDirectory(dir string, out io.Writer) error {
+	compressed := gzip.NewWriter(out)
+	writer := tar.NewWriter(compressed)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return fmt.Errorf("%s is neither a directory nor a regular file", path)
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relative)
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(writer, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// waitForLeafs polls the leafs of a deployed stem until none is starting any more, failing when deadline
+// passes first or a leaf ends up in any state other than running or standby.
+func waitForLeafs(api *client.Client, stem *client.StemSummary, deadline time.Time) ([]client.LeafSummary, error) {
+	for {
+		leafs, err := api.ListLeafs(stem.Name, stem.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		var starting, failed []string
+		for _, leaf := range leafs {
+			switch leaf.Status {
+			case models.StatusRunning, models.StatusStandby:
+			case models.StatusStarting:
+				starting = append(starting, leaf.ID)
+			default:
+				failed = append(failed, fmt.Sprintf("%s is %s", leaf.ID, leaf.Status))
+			}
+		}
+
+		switch {
+		case len(failed) > 0:
+			return leafs, fmt.Errorf("stem %s version %s is unhealthy: %s", stem.Name, stem.Version, strings.Join(failed, ", "))
+		case len(starting) == 0:
+			return leafs, nil
+		case time.Now().After(deadline):
+			return leafs, fmt.Errorf("leafs of stem %s version %s still starting: %s", stem.Name, stem.Version, strings.Join(starting, ", "))
+		}
+		time.Sleep(deployPollInterval)
+	}
+}
+
+// writeRolloutSummary prints the leafs of a deployed stem and how long the rollout took.
+func writeRolloutSummary(out io.Writer, leafs []client.LeafSummary, took time.Duration) {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "LEAF\tSTATUS\tPID\tPORT")
+	for _, leaf := range leafs {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d\n", leaf.ID, leaf.Status, leaf.PID, leaf.Port)
+	}
+	writer.Flush()
+	fmt.Fprintf(out, "%d leafs after %s\n", len(leafs), took.Round(100*time.Millisecond))
+}
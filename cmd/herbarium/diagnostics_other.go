@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// diagnosticsSignal asks the running daemon for a diagnostic dump.
+var diagnosticsSignal os.Signal = syscall.SIGUSR1
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// diagnosticsSignal is nil on Windows, which has no SIGUSR1, so no diagnostic dumps are signalled.
+var diagnosticsSignal os.Signal
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/admin"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// drainUsage describes the drain command.
+const drainUsage = "usage: herbarium drain [--api-url URL] [--api-key KEY] [--handoff] [--wait] [--interval 2s] [status | cancel]"
+
+// runDrainCommand handles `herbarium drain`, which empties the host of the running daemon for maintenance such
+// as a reboot, `herbarium drain status`, and `herbarium drain cancel`.
+func runDrainCommand(args []string) error {
+	flags := flag.NewFlagSet("drain", flag.ContinueOnError)
+	apiURL := flags.String("api-url", envOrDefault("HERBARIUM_API_URL", "http://"+admin.DefaultListenAddress), "admin API base URL")
+	apiKey := flags.String("api-key", os.Getenv("HERBARIUM_API_KEY"), "admin API key")
+	handoff := flags.Bool("handoff", false, "start each leaf's replacement on another node before stopping it")
+	wait := flags.Bool("wait", false, "wait until the host is safe to reboot")
+	interval := flags.Duration("interval", 2*time.Second, "time between status checks while waiting")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 || *interval <= 0 {
+		return errors.New(drainUsage)
+	}
+
+	api := client.NewClient(*apiURL, *apiKey)
+	var status *models.DrainStatus
+	var err error
+	switch flags.Arg(0) {
+	case "":
+		status, err = api.StartDrain(*handoff)
+	case "status":
+		status, err = api.Drain()
+	case "cancel":
+		if status, err = api.CancelDrain(); err == nil {
+			fmt.Println("The host accepts deployments and leafs again")
+		}
+		return err
+	default:
+		return errors.New(drainUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		writeDrainStatus(os.Stdout, status)
+		if !*wait || status.Finished || !status.Draining {
+			break
+		}
+		time.Sleep(*interval)
+		if status, err = api.Drain(); err != nil {
+			return err
+		}
+	}
+	if status.Finished && !status.SafeToReboot {
+		return fmt.Errorf("the host is not safe to reboot: %d leafs failed to stop, %d are left", len(status.Failed), len(status.Remaining))
+	}
+	return nil
+}
+
+// writeDrainStatus prints the progress of draining in a line, followed by the leafs that failed to stop.
+func writeDrainStatus(out io.Writer, status *models.DrainStatus) {
+	if !status.Draining {
+		fmt.Fprintln(out, "The host is not draining")
+		return
+	}
+	fmt.Fprintf(out, "Draining since %s: %d handed off, %d stopped, %d failed, %d left",
+		status.Since.Format(time.RFC3339), len(status.HandedOff), len(status.Stopped), len(status.Failed), len(status.Remaining))
+	if status.SafeToReboot {
+		fmt.Fprint(out, ", safe to reboot")
+	}
+	fmt.Fprintln(out)
+	if status.Finished && len(status.Failed) > 0 {
+		fmt.Fprintf(out, "Failed: %s\n", strings.Join(status.Failed, "; "))
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/admin"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+)
+
+// logsUsage describes the logs command.
+const logsUsage = "usage: herbarium logs [--api-url URL] [--api-key KEY] [--version VERSION] [--follow] [--since TIME|DURATION] [--tail N] <stem> [leafID]"
+
+// leafLog names a leaf whose log is printed.
+type leafLog struct {
+	version string
+	leafID  string
+}
+
+// runLogsCommand handles `herbarium logs`, which prints the logs of one leaf, or of every leaf of a stem with
+// each line prefixed by its leaf ID, through the admin API of the running daemon.
+func runLogsCommand(args []string) error {
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	apiURL := flags.String("api-url", envOrDefault("HERBARIUM_API_URL", "http://"+admin.DefaultListenAddress), "admin API base URL")
+	apiKey := flags.String("api-key", os.Getenv("HERBARIUM_API_KEY"), "admin API key")
+	version := flags.String("version", "", "stem version, all versions by default")
+	var opts client.LogOptions
+	flags.BoolVar(&opts.Follow, "follow", false, "keep streaming new output")
+	flags.StringVar(&opts.Since, "since", "", "only lines written since an RFC 3339 time or a duration ago, e.g. 10m")
+	flags.IntVar(&opts.Tail, "tail", 0, "only the last N lines of each leaf")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 || opts.Tail < 0 {
+		return errors.New(logsUsage)
+	}
+	name, leafID := flags.Arg(0), flags.Arg(1)
+
+	api := client.NewClient(*apiURL, *apiKey)
+	logs, err := leafLogsOf(api, name, *version, leafID)
+	if err != nil {
+		return err
+	}
+
+	out := &lineWriter{out: os.Stdout}
+	if !opts.Follow {
+		for _, leaf := range logs {
+			if err := printLeafLog(api, out, name, leaf, len(logs) > 1, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Followed logs are streamed side by side until every leaf is gone
+	var wg sync.WaitGroup
+	errs := make(chan error, len(logs))
+	for _, leaf := range logs {
+		wg.Add(1)
+		go func(leaf leafLog) {
+			defer wg.Done()
+			errs <- printLeafLog(api, out, name, leaf, len(logs) > 1, opts)
+		}(leaf)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// leafLogsOf resolves which leaf logs to print: leafID of the stem, or every running leaf of the stem when
+// leafID is empty. Leafs that no longer run can still be named if the stem has a single version.
+func leafLogsOf(api *client.Client, name, version, leafID string) ([]leafLog, error) {
+	stems, err := api.ListStems()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	var logs []leafLog
+	for _, stem := range stems {
+		if stem.Name != name || (version != "" && stem.Version != version) {
+			continue
+		}
+		versions = append(versions, stem.Version)
+		for _, leaf := range stem.Leafs {
+			if leafID == "" || leaf.ID == leafID {
+				logs = append(logs, leafLog{version: stem.Version, leafID: leaf.ID})
+			}
+		}
+	}
+
+	switch {
+	case len(versions) == 0:
+		return nil, fmt.Errorf("stem %s not found", name)
+	case len(logs) > 0:
+		return logs, nil
+	case leafID == "":
+		return nil, fmt.Errorf("stem %s has no leafs", name)
+	case len(versions) == 1:
+		return []leafLog{{version: versions[0], leafID: leafID}}, nil
+	default:
+		return nil, fmt.Errorf("leaf %s is not running, pass --version to read its logs", leafID)
+	}
+}
+
+// printLeafLog copies the log of a leaf to out line by line, prefixing each line with the leaf ID when
+// prefix is set.
+func printLeafLog(api *client.Client, out *lineWriter, name string, leaf leafLog, prefix bool, opts client.LogOptions) error {
+	body, err := api.ReadLeafLogs(name, leaf.version, leaf.leafID, opts)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			if prefix {
+				line = leaf.leafID + " | " + line
+			}
+			out.writeLine(line)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read logs of leaf %s: %v", leaf.leafID, err)
+		}
+	}
+}
+
+// lineWriter writes whole lines to out, so lines of leafs streamed side by side don't interleave.
+type lineWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// writeLine writes line to out.
+func (w *lineWriter) writeLine(line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	io.WriteString(w.out, line)
+}
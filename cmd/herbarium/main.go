@@ -1,37 +1,440 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/plantarium-platform/herbarium-go/internal/api/admin"
+	"github.com/plantarium-platform/herbarium-go/internal/ha"
+	"github.com/plantarium-platform/herbarium-go/internal/instance"
 	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/systemd"
 )
 
+// shutdownTimeout bounds how long in-flight admin API requests may take during shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// pidFile is the optional path the running instance writes its PID to.
+var pidFile = flag.String("pidfile", "", "write the process ID to this file while running")
+
+// restoreSnapshot is the optional snapshot (name, path, "latest", or "backend") to rebuild state from at startup.
+var restoreSnapshot = flag.String("restore", "", "restore state from a snapshot (name, path, \"latest\", or \"backend\") instead of starting from scratch")
+
+// daemon holds the running platform components started by startDaemon.
+type daemon struct {
+	platformManager *manager.PlatformManager
+	adminServer     *admin.Server
+	lock            *instance.Lock
+	elector         *ha.Elector   // Nil unless running in high-availability mode
+	done            chan struct{} // Closed on shutdown to stop background tasks
+}
+
 func main() {
-	// Create a new PlatformManager instance with dependencies initialized internally
-	platformManager, err := manager.NewPlatformManagerWithDI()
+	flag.Parse()
+
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "service":
+			if err := runServiceCommand(args[1:]); err != nil {
+				log.Fatalf("Service command failed: %v", err)
+			}
+			return
+		case "stem":
+			if err := runStemCommand(args[1:]); err != nil {
+				log.Fatalf("Stem command failed: %v", err)
+			}
+			return
+		case "deploy":
+			if err := runDeployCommand(args[1:]); err != nil {
+				log.Fatalf("Deploy command failed: %v", err)
+			}
+			return
+		case "logs":
+			if err := runLogsCommand(args[1:]); err != nil {
+				log.Fatalf("Logs command failed: %v", err)
+			}
+			return
+		case "ps":
+			if err := runPsCommand(args[1:]); err != nil {
+				log.Fatalf("Ps command failed: %v", err)
+			}
+			return
+		case "top":
+			if err := runTopCommand(args[1:]); err != nil {
+				log.Fatalf("Top command failed: %v", err)
+			}
+			return
+		case "drain":
+			if err := runDrainCommand(args[1:]); err != nil {
+				log.Fatalf("Drain command failed: %v", err)
+			}
+			return
+		case "validate":
+			if err := runValidateCommand(args[1:]); err != nil {
+				log.Fatalf("%v", err)
+			}
+			return
+		default:
+			log.Fatalf("Unknown command %q", args[0])
+		}
+	}
+
+	// When launched by the Windows service control manager, hand control to the service handler
+	isService, err := isWindowsService()
 	if err != nil {
-		log.Fatalf("Failed to create platform manager: %v", err)
+		log.Fatalf("Failed to determine whether running as a service: %v", err)
+	}
+	if isService {
+		if err := runAsService(); err != nil {
+			log.Fatalf("Service failed: %v", err)
+		}
+		return
+	}
+
+	runForeground()
+}
+
+// runForeground runs the platform as a console process until SIGINT or SIGTERM, reloading its configuration
+// on SIGHUP and writing a diagnostic dump on SIGUSR1.
+func runForeground() {
+	// Listen for signals before starting, so a standby waiting for leadership can still be stopped
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	if diagnosticsSignal != nil {
+		signal.Notify(signalChannel, diagnosticsSignal)
 	}
 
-	// Start the platform
-	err = platformManager.InitializePlatform()
+	stop := make(chan struct{})
+	started := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		for {
+			select {
+			case sig := <-signalChannel:
+				if sig == os.Interrupt || sig == syscall.SIGTERM {
+					close(stop)
+					return
+				}
+				log.Printf("Ignoring signal %s received during startup", sig)
+			case <-started:
+				return
+			}
+		}
+	}()
+	d, err := startDaemon(stop)
+	close(started)
+	<-watched
+
+	select {
+	case <-stop:
+		log.Println("Termination signal received during startup. Shutting down...")
+		if d != nil {
+			d.stop()
+		}
+		return
+	default:
+	}
 	if err != nil {
-		log.Fatalf("Failed to initialize the platform: %v", err)
+		log.Fatalf("%v", err)
 	}
 
 	log.Println("Platform started successfully")
 	log.Println("Waiting for termination signal...")
 
-	// Create a channel to listen for OS signals
-	signalChannel := make(chan os.Signal, 1)
-	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
-
 	// Block until a termination signal is received
-	<-signalChannel
+	for sig := range signalChannel {
+		if sig == syscall.SIGHUP {
+			manager.RunRecovered("reconciler", d.reload)
+		} else if diagnosticsSignal != nil && sig == diagnosticsSignal {
+			manager.RunRecovered("diagnostics", func() {
+				if _, err := d.platformManager.DumpDiagnostics(); err != nil {
+					log.Printf("Failed to write diagnostic dump: %v", err)
+				}
+			})
+		} else {
+			break
+		}
+	}
 
 	log.Println("Termination signal received. Shutting down...")
+	d.stop()
+}
+
+// startDaemon creates the platform manager, starts the admin API, and initializes the platform.
+// Closing stop abandons the wait of a standby for leadership, returning errStopped.
+func startDaemon(stop <-chan struct{}) (d *daemon, err error) {
+	rootFolder := os.Getenv("PLANTARIUM_ROOT_FOLDER")
+	if rootFolder == "" {
+		return nil, errors.New("PLANTARIUM_ROOT_FOLDER not set")
+	}
+
+	// Make sure no other instance manages the same root folder and HAProxy backends
+	lock, err := instance.Acquire(rootFolder, *pidFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.Release()
+		}
+	}()
+
+	// Create a new PlatformManager instance with dependencies initialized internally
+	platformManager, err := manager.NewPlatformManagerWithDI()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create platform manager: %v", err)
+	}
+
+	// In high-availability mode, wait as a standby until this replica is elected leader
+	elector, err := electLeader(platformManager, stop)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil && elector != nil {
+			elector.Release()
+		}
+	}()
+
+	// Start the admin API before initialization, which publishes it through HAProxy
+	var journal admin.JournalReader
+	if platformManager.Journal != nil {
+		journal = platformManager.Journal
+	}
+	adminServer := admin.NewServer(platformManager.Config.API.ListenAddress, platformManager.Config.Security.APIKey, platformManager.StemManager, platformManager.LeafManager, platformManager.SnapshotManager, journal)
+	adminServer.Events = platformManager.Events
+	adminServer.Alerts = platformManager.Alerts
+	adminServer.Maintenance = platformManager.Maintenance
+	adminServer.Drain = platformManager.Drain
+	adminServer.Sweeper = platformManager.Sweeper
+	adminServer.Drift = platformManager.Drift
+	adminServer.Proxy = platformManager.ProxyClient
+	adminServer.Janitor = platformManager.Janitor
+	adminServer.Deployments = platformManager.Deployments
+	adminServer.Stats = platformManager.Stats
+	adminServer.Storage = storage.GetHerbariumDB()
+	adminServer.SwaggerUI = platformManager.Config.API.SwaggerUI
+	if err := startAdminServer(adminServer); err != nil {
+		return nil, err
+	}
+	platformManager.AdminAddress = adminServer.Addr()
+
+	// Start the platform, either from scratch or from a snapshot. An elected leader takes over the state
+	// the previous leader left in the shared backend, unless told to restore another snapshot.
+	snapshot := *restoreSnapshot
+	if snapshot == "" && elector != nil {
+		snapshot = manager.BackendSnapshot
+	}
+	if snapshot != "" {
+		if _, err = platformManager.RestorePlatform(snapshot); err != nil {
+			return nil, fmt.Errorf("failed to restore the platform: %v", err)
+		}
+	} else {
+		err = platformManager.InitializePlatform()
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize the platform: %v", err)
+		}
+	}
+
+	// Drop stems left in the shared backend by a previous run, or that the restore didn't keep
+	if platformManager.Backend != nil {
+		if err := storage.GetHerbariumDB().PublishState(); err != nil {
+			log.Printf("Failed to publish state to the storage backend: %v", err)
+		}
+	}
+
+	d = &daemon{
+		platformManager: platformManager,
+		adminServer:     adminServer,
+		lock:            lock,
+		elector:         elector,
+		done:            make(chan struct{}),
+	}
+
+	// Step down rather than keep managing services without the lease; the supervisor restarts us as a standby
+	if elector != nil {
+		elector.KeepLeadership(d.done, func() {
+			log.Printf("Lost leadership, stepping down so that the new leader manages the platform alone")
+			d.stepDown()
+			os.Exit(1)
+		})
+	}
+
+	// Background workers run on the intervals of the global config
+	config := platformManager.Config
+	if interval := parseInterval("snapshot.interval", config.Snapshot.Interval, 0); interval > 0 {
+		platformManager.SnapshotManager.StartSchedule(interval, d.done)
+	}
+	platformManager.Recycler.StartSchedule(parseInterval("recycler.interval", config.Recycler.Interval, manager.DefaultRecycleInterval), d.done)
+	platformManager.Sweeper.StartSchedule(parseInterval("sweeper.interval", config.Sweeper.Interval, manager.DefaultSweepInterval), d.done)
+	platformManager.Drift.StartSchedule(parseInterval("drift.interval", config.Drift.Interval, manager.DefaultDriftInterval), d.done)
+	if platformManager.Nodes != nil {
+		platformManager.Nodes.StartSchedule(parseInterval("node_monitor.interval", config.NodeMonitor.Interval, manager.DefaultNodeMonitorInterval), d.done)
+	}
+	platformManager.Janitor.StartSchedule(parseInterval("janitor.interval", config.Janitor.Interval, manager.DefaultJanitorInterval), d.done)
+	platformManager.Scheduler.StartSchedule(parseInterval("scheduler.interval", config.Scheduler.Interval, manager.DefaultScheduleInterval), d.done)
+	platformManager.Autoscaler.StartSchedule(parseInterval("autoscaler.interval", config.Autoscaler.Interval, manager.DefaultAutoscaleInterval), d.done)
+	platformManager.Alerts.StartSchedule(parseInterval("alerting.interval", config.Alerting.Interval, manager.DefaultAlertInterval), d.done)
+	if platformManager.Secrets != nil {
+		platformManager.Secrets.StartSchedule(parseInterval("secrets.interval", config.Secrets.Interval, manager.DefaultSecretInterval), d.done)
+	}
+
+	// Tell systemd (Type=notify) that startup is complete, then keep its watchdog fed
+	if _, err := systemd.Notify(systemd.StateReady); err != nil {
+		log.Printf("Failed to notify systemd of readiness: %v", err)
+	}
+	if err := systemd.StartWatchdog(d.done); err != nil {
+		log.Printf("Failed to start systemd watchdog: %v", err)
+	}
+
+	return d, nil
+}
+
+// parseInterval returns the Go duration set as name in the global config, or def when it is empty. An invalid
+// or non-positive duration is logged and gives def as well; a def of 0 leaves the worker disabled.
+func parseInterval(name, value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		if def == 0 {
+			log.Printf("Invalid %s %q, leaving it disabled", name, value)
+		} else {
+			log.Printf("Invalid %s %q, running every %s", name, value, def)
+		}
+		return def
+	}
+	return duration
+}
+
+// errStopped is returned by startDaemon when it was stopped while waiting for leadership.
+var errStopped = errors.New("stopped while waiting for leadership")
+
+// electLeader blocks until this replica holds the leader lease when high availability is enabled, or stop
+// is closed. It returns a nil elector when running as a single instance.
+func electLeader(platformManager *manager.PlatformManager, stop <-chan struct{}) (*ha.Elector, error) {
+	config := platformManager.Config.HA
+	if !config.Enabled {
+		return nil, nil
+	}
+	lease, ok := platformManager.Backend.(storage.Lease)
+	if !ok {
+		return nil, errors.New("high-availability mode requires a redis or etcd storage backend")
+	}
+
+	var ttl time.Duration
+	if config.LeaseTTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(config.LeaseTTL); err != nil {
+			return nil, fmt.Errorf("invalid ha.lease_ttl %q: %v", config.LeaseTTL, err)
+		}
+	}
+
+	elector := ha.NewElector(lease, config.NodeID, ttl)
+	if !elector.WaitForLeadership(stop) {
+		return nil, errStopped
+	}
+	return elector, nil
+}
+
+// startAdminServer serves the admin API on a socket passed by systemd socket activation,
+// falling back to the configured listen address. The server's Addr is what HAProxy is given.
+func startAdminServer(adminServer *admin.Server) error {
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return fmt.Errorf("failed to use socket-activated listeners: %v", err)
+	}
+	if len(listeners) > 0 {
+		for _, extra := range listeners[1:] {
+			log.Printf("Ignoring extra socket-activated listener %s", extra.Addr())
+			extra.Close()
+		}
+		adminServer.Serve(listeners[0])
+		return nil
+	}
+
+	if err := adminServer.Start(); err != nil {
+		return fmt.Errorf("failed to start admin API: %v", err)
+	}
+	return nil
+}
+
+// reload applies the global config and the service directories on disk without restarting the daemon.
+func (d *daemon) reload() {
+	log.Println("Reload signal received. Reloading configuration...")
+	if _, err := systemd.Notify(systemd.StateReloading); err != nil {
+		log.Printf("Failed to notify systemd of reloading: %v", err)
+	}
+	report, err := d.platformManager.ReloadPlatform()
+	if err != nil {
+		log.Printf("Failed to reload configuration: %v", err)
+	} else if len(report.Errors) > 0 {
+		log.Printf("Reloaded configuration with errors: %s", strings.Join(report.Errors, "; "))
+	}
+	if _, err := systemd.Notify(systemd.StateReady); err != nil {
+		log.Printf("Failed to notify systemd of readiness: %v", err)
+	}
+}
+
+// stop shuts down the components started by startDaemon.
+func (d *daemon) stop() {
+	d.shutdown(false)
+}
+
+// stepDown shuts down a leader that lost its lease, stopping its leafs once nothing else can start new ones.
+func (d *daemon) stepDown() {
+	d.shutdown(true)
+}
+
+func (d *daemon) shutdown(stepDown bool) {
+	if _, err := systemd.Notify(systemd.StateStopping); err != nil {
+		log.Printf("Failed to notify systemd of shutdown: %v", err)
+	}
+	close(d.done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := d.adminServer.Shutdown(ctx); err != nil {
+		log.Printf("Failed to shut down admin API: %v", err)
+	}
+	if stepDown {
+		d.platformManager.StepDown()
+	}
+	if d.platformManager.Journal != nil {
+		if err := d.platformManager.Journal.Close(); err != nil {
+			log.Printf("Failed to close state journal: %v", err)
+		}
+	}
+	if err := d.platformManager.Deployments.Close(); err != nil {
+		log.Printf("Failed to close deployment history: %v", err)
+	}
+	if d.elector != nil {
+		if err := d.elector.Release(); err != nil {
+			log.Printf("Failed to release leader lease: %v", err)
+		}
+	}
+	if d.platformManager.Backend != nil {
+		if err := storage.GetHerbariumDB().FlushBackend(); err != nil {
+			log.Printf("Failed to publish state to the storage backend: %v", err)
+		}
+		storage.GetHerbariumDB().SetBackend(nil)
+		if err := d.platformManager.Backend.Close(); err != nil {
+			log.Printf("Failed to close storage backend: %v", err)
+		}
+	}
+	if err := d.lock.Release(); err != nil {
+		log.Printf("Failed to release instance lock: %v", err)
+	}
 	// Perform any necessary cleanup here before exiting
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/admin"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+)
+
+// psUsage describes the ps command.
+const psUsage = "usage: herbarium ps [--api-url URL] [--api-key KEY] [-o table|json]"
+
+// runPsCommand handles `herbarium ps`, which lists the stems of the running daemon and their leafs.
+func runPsCommand(args []string) error {
+	flags := flag.NewFlagSet("ps", flag.ContinueOnError)
+	apiURL := flags.String("api-url", envOrDefault("HERBARIUM_API_URL", "http://"+admin.DefaultListenAddress), "admin API base URL")
+	apiKey := flags.String("api-key", os.Getenv("HERBARIUM_API_KEY"), "admin API key")
+	output := flags.String("o", "table", "output format, table or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || (*output != "table" && *output != "json") {
+		return errors.New(psUsage)
+	}
+
+	stems, err := client.NewClient(*apiURL, *apiKey).ListStems()
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stems)
+	}
+	return writePsTable(os.Stdout, stems, time.Now())
+}
+
+// writePsTable prints one row per leaf, or a single row for stems without leafs, with uptimes measured
+// against now.
+func writePsTable(out io.Writer, stems []client.StemSummary, now time.Time) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "STEM\tVERSION\tLEAF\tSTATUS\tPID\tPORT\tUPTIME\tRESTARTS")
+	for _, stem := range stems {
+		if len(stem.Leafs) == 0 {
+			fmt.Fprintf(writer, "%s\t%s\t-\t-\t-\t-\t-\t%d\n", stem.Name, stem.Version, stem.Restarts)
+			continue
+		}
+		for _, leaf := range stem.Leafs {
+			pid := "-"
+			if leaf.PID != 0 {
+				pid = strconv.Itoa(leaf.PID)
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%d\n", stem.Name, stem.Version, leaf.ID, leaf.Status,
+				pid, leaf.Port, now.Sub(leaf.Initialized).Truncate(time.Second), stem.Restarts)
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// errServiceUnsupported is returned by service commands on platforms without a service control manager.
+var errServiceUnsupported = errors.New("service commands are only supported on Windows; use systemd or another supervisor instead")
+
+// isWindowsService always reports false outside Windows.
+func isWindowsService() (bool, error) {
+	return false, nil
+}
+
+// runAsService is unreachable outside Windows because isWindowsService reports false.
+func runAsService() error {
+	return errServiceUnsupported
+}
+
+// runServiceCommand rejects service management outside Windows.
+func runServiceCommand(args []string) error {
+	return errServiceUnsupported
+}
@@ -0,0 +1,227 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/debug"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Windows service identity.
+const (
+	serviceName        = "herbarium"
+	serviceDisplayName = "Plantarium Herbarium"
+	serviceDescription = "Plantarium platform root: manages stems, leafs, and their HAProxy routing."
+)
+
+// serviceEnvVars are copied from the installing shell into the service's environment.
+var serviceEnvVars = []string{"PLANTARIUM_ROOT_FOLDER", "PLANTARIUM_LOG_FOLDER"}
+
+// herbariumService adapts the daemon lifecycle to the Windows service control manager.
+type herbariumService struct{}
+
+// Execute runs the platform until the service control manager asks it to stop.
+func (s *herbariumService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	changes <- svc.Status{State: svc.StartPending, Accepts: accepted}
+
+	// Answer the service control manager during startup, so a standby waiting for leadership can be stopped
+	stop := make(chan struct{})
+	started := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		for {
+			select {
+			case request := <-requests:
+				switch request.Cmd {
+				case svc.Interrogate:
+					changes <- request.CurrentStatus
+				case svc.Stop, svc.Shutdown:
+					changes <- svc.Status{State: svc.StopPending, WaitHint: uint32((shutdownTimeout + 5*time.Second) / time.Millisecond)}
+					close(stop)
+					return
+				default:
+					log.Printf("Unexpected service control request: %d", request.Cmd)
+				}
+			case <-started:
+				return
+			}
+		}
+	}()
+	d, err := startDaemon(stop)
+	close(started)
+	<-watched
+
+	select {
+	case <-stop:
+		log.Println("Service stop requested during startup. Shutting down...")
+		if d != nil {
+			d.stop()
+		}
+		return false, 0
+	default:
+	}
+	if err != nil {
+		log.Printf("Failed to start platform as service: %v", err)
+		return true, 1
+	}
+
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+	log.Println("Platform started successfully as a Windows service")
+
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			changes <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			log.Println("Service stop requested. Shutting down...")
+			changes <- svc.Status{State: svc.StopPending, WaitHint: uint32((shutdownTimeout + 5*time.Second) / time.Millisecond)}
+			d.stop()
+			return false, 0
+		default:
+			log.Printf("Unexpected service control request: %d", request.Cmd)
+		}
+	}
+	return false, 0
+}
+
+// isWindowsService reports whether the process was started by the service control manager.
+func isWindowsService() (bool, error) {
+	return svc.IsWindowsService()
+}
+
+// runAsService runs herbarium under the service control manager, logging to a file since there is no console.
+func runAsService() error {
+	logFolder := os.Getenv("PLANTARIUM_LOG_FOLDER")
+	if logFolder == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate executable: %v", err)
+		}
+		logFolder = filepath.Dir(exe)
+	}
+	if err := os.MkdirAll(logFolder, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create log folder: %v", err)
+	}
+	logFile, err := os.OpenFile(filepath.Join(logFolder, "herbarium.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open service log file: %v", err)
+	}
+	defer logFile.Close()
+	log.SetOutput(logFile)
+
+	return svc.Run(serviceName, &herbariumService{})
+}
+
+// runServiceCommand handles `herbarium service install|uninstall|run`.
+func runServiceCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: herbarium service install|uninstall|run")
+	}
+
+	switch args[0] {
+	case "install":
+		return installService()
+	case "uninstall":
+		return uninstallService()
+	case "run":
+		// Run the service handler attached to the console, useful for debugging
+		return debug.Run(serviceName, &herbariumService{})
+	default:
+		return fmt.Errorf("unknown service command %q", args[0])
+	}
+}
+
+// installService registers herbarium with the service control manager as an automatic-start service.
+func installService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %v", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create service: %v", err)
+	}
+	defer s.Close()
+
+	if err := setServiceEnvironment(); err != nil {
+		_ = s.Delete()
+		return err
+	}
+
+	log.Printf("Service %s installed for %s", serviceName, exe)
+	return nil
+}
+
+// setServiceEnvironment persists the Plantarium environment variables of the installing shell
+// in the service's registry key, since services do not inherit the user environment.
+func setServiceEnvironment() error {
+	var env []string
+	for _, name := range serviceEnvVars {
+		if value := os.Getenv(name); value != "" {
+			env = append(env, fmt.Sprintf("%s=%s", name, value))
+		}
+	}
+	if len(env) == 0 {
+		log.Printf("Warning: none of %v are set; the service will fail to start until PLANTARIUM_ROOT_FOLDER is configured", serviceEnvVars)
+		return nil
+	}
+
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+serviceName, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("failed to open service registry key: %v", err)
+	}
+	defer key.Close()
+
+	if err := key.SetStringsValue("Environment", env); err != nil {
+		return fmt.Errorf("failed to set service environment: %v", err)
+	}
+	return nil
+}
+
+// uninstallService removes the herbarium service from the service control manager.
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %v", serviceName, err)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %v", err)
+	}
+
+	log.Printf("Service %s uninstalled", serviceName)
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/admin"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// stemUsage describes the stem subcommands.
+const stemUsage = "usage: herbarium stem [--api-url URL] [--api-key KEY] export <name> <version> [file] | import <file> | scale <name> <version> <replicas> | split <name> <version> <version>=<percent>... | history <name> | rollback <name> | unregister <name> <version> | deployments [name]"
+
+// runStemCommand handles `herbarium stem export|import`, which move stem definitions between
+// herbarium instances through their admin APIs, `herbarium stem scale`, `herbarium stem split`, and
+// `herbarium stem history|rollback`, which list and roll back the versions of a stem, `herbarium stem
+// unregister`, and `herbarium stem deployments`, which lists who changed which stems.
+func runStemCommand(args []string) error {
+	flags := flag.NewFlagSet("stem", flag.ContinueOnError)
+	apiURL := flags.String("api-url", envOrDefault("HERBARIUM_API_URL", "http://"+admin.DefaultListenAddress), "admin API base URL")
+	apiKey := flags.String("api-key", os.Getenv("HERBARIUM_API_KEY"), "admin API key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		return errors.New(stemUsage)
+	}
+
+	api := client.NewClient(*apiURL, *apiKey).SetActor(cliActor())
+	switch {
+	case args[0] == "export" && (len(args) == 3 || len(args) == 4):
+		definition, err := api.ExportStem(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		if len(args) == 4 {
+			return os.WriteFile(args[3], definition, 0644)
+		}
+		_, err = os.Stdout.Write(definition)
+		return err
+	case args[0] == "import" && len(args) == 2:
+		definition, err := os.ReadFile(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to read stem definition: %v", err)
+		}
+		return api.ImportStem(definition)
+	case args[0] == "scale" && len(args) == 4:
+		replicas, err := strconv.Atoi(args[3])
+		if err != nil {
+			return fmt.Errorf("invalid replica count %q", args[3])
+		}
+		return api.ScaleStem(args[1], args[2], replicas)
+	case args[0] == "split" && len(args) >= 4:
+		split := make(map[string]int, len(args)-3)
+		for _, share := range args[3:] {
+			version, percent, ok := strings.Cut(share, "=")
+			value, err := strconv.Atoi(percent)
+			if !ok || err != nil {
+				return fmt.Errorf("invalid traffic share %q, expected <version>=<percent>", share)
+			}
+			split[version] = value
+		}
+		_, err := api.SetTrafficSplit(args[1], args[2], split)
+		return err
+	case args[0] == "history" && len(args) == 2:
+		history, err := api.ListStemVersions(args[1])
+		if err != nil {
+			return err
+		}
+		return writeHistoryTable(os.Stdout, history)
+	case args[0] == "rollback" && len(args) == 2:
+		stem, err := api.RollbackStem(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back stem %s to version %s\n", stem.Name, stem.Version)
+		return nil
+	case args[0] == "unregister" && len(args) == 3:
+		if _, err := api.UnregisterStem(args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("Unregistered stem %s version %s\n", args[1], args[2])
+		return nil
+	case args[0] == "deployments" && len(args) <= 2:
+		var query client.DeploymentQuery
+		if len(args) == 2 {
+			query.Stem = args[1]
+		}
+		entries, err := api.Deployments(query)
+		if err != nil {
+			return err
+		}
+		return writeDeploymentsTable(os.Stdout, entries)
+	default:
+		return errors.New(stemUsage)
+	}
+}
+
+// writeHistoryTable prints one row per version of a stem, first registered first.
+func writeHistoryTable(out io.Writer, history []client.StemVersion) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tSTATUS\tREGISTERED\tUNREGISTERED\tPREVIOUS\tDEPLOYED BY\tCOMMIT")
+	for _, entry := range history {
+		unregistered := "-"
+		if !entry.UnregisteredAt.IsZero() {
+			unregistered = entry.UnregisteredAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Version, entry.Status, entry.RegisteredAt.Local().Format(time.DateTime),
+			unregistered, orDash(entry.Previous), orDash(entry.DeployedBy), orDash(entry.GitCommit))
+	}
+	return writer.Flush()
+}
+
+// writeDeploymentsTable prints one row per deployment history entry, oldest first.
+func writeDeploymentsTable(out io.Writer, entries []models.Deployment) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TIME\tACTOR\tACTION\tSTEM\tVERSION\tPARAMETERS\tOUTCOME")
+	for _, entry := range entries {
+		parameters := make([]string, 0, len(entry.Parameters))
+		for name, value := range entry.Parameters {
+			parameters = append(parameters, name+"="+value)
+		}
+		sort.Strings(parameters)
+		outcome := string(entry.Outcome)
+		if entry.Error != "" {
+			outcome += ": " + entry.Error
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time.Local().Format(time.DateTime), entry.Actor, entry.Action,
+			orDash(entry.Stem), orDash(entry.Version), orDash(strings.Join(parameters, " ")), outcome)
+	}
+	return writer.Flush()
+}
+
+// orDash returns value, or a dash for empty table cells.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// envOrDefault returns the value of the environment variable name, or fallback if it is unset.
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// cliActor names the user running the CLI to the admin API, as HERBARIUM_ACTOR or else <user>@<host>.
+func cliActor() string {
+	if actor := os.Getenv("HERBARIUM_ACTOR"); actor != "" {
+		return actor
+	}
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
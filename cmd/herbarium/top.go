@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/admin"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+)
+
+// topUsage describes the top command.
+const topUsage = "usage: herbarium top [--api-url URL] [--api-key KEY] [--interval DURATION] [--no-stream]"
+
+// clearScreen moves the cursor home and clears the terminal before each refresh.
+const clearScreen = "\033[H\033[2J"
+
+// runTopCommand handles `herbarium top`, a live view of the CPU, memory, and request rate of every leaf
+// of the running daemon, refreshed every interval until interrupted.
+func runTopCommand(args []string) error {
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	apiURL := flags.String("api-url", envOrDefault("HERBARIUM_API_URL", "http://"+admin.DefaultListenAddress), "admin API base URL")
+	apiKey := flags.String("api-key", os.Getenv("HERBARIUM_API_KEY"), "admin API key")
+	interval := flags.Duration("interval", 2*time.Second, "time between refreshes")
+	noStream := flags.Bool("no-stream", false, "print a single refresh and exit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || *interval <= 0 {
+		return errors.New(topUsage)
+	}
+
+	// Rates need two samples, so the first refresh follows one interval after the first sample
+	api := client.NewClient(*apiURL, *apiKey)
+	previous, err := api.Stats()
+	if err != nil {
+		return err
+	}
+	for {
+		time.Sleep(*interval)
+		current, err := api.Stats()
+		if err != nil {
+			return err
+		}
+		if !*noStream {
+			fmt.Print(clearScreen)
+		}
+		if err := writeTopTable(os.Stdout, previous, current); err != nil {
+			return err
+		}
+		if *noStream {
+			return nil
+		}
+		previous = current
+	}
+}
+
+// writeTopTable prints one row per leaf of current, with CPU usage and request rates measured since
+// previous. Rates of leafs missing from previous, or whose counters went back, are shown as dashes.
+func writeTopTable(out io.Writer, previous, current []client.LeafStats) error {
+	before := make(map[string]client.LeafStats, len(previous))
+	for _, sample := range previous {
+		before[sample.Stem+"/"+sample.Version+"/"+sample.LeafID] = sample
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "STEM\tVERSION\tLEAF\tSTATUS\tPID\tCPU %\tMEM\tREQ/S")
+	for _, sample := range current {
+		cpu, rate := "-", "-"
+		if last, ok := before[sample.Stem+"/"+sample.Version+"/"+sample.LeafID]; ok {
+			if elapsed := sample.Sampled.Sub(last.Sampled).Seconds(); elapsed > 0 {
+				if used := sample.CPUSeconds - last.CPUSeconds; used >= 0 && sample.CPUSeconds > 0 {
+					cpu = strconv.FormatFloat(used/elapsed*100, 'f', 1, 64)
+				}
+				if served := sample.Requests - last.Requests; served >= 0 && sample.Requests >= 0 && last.Requests >= 0 {
+					rate = strconv.FormatFloat(float64(served)/elapsed, 'f', 1, 64)
+				}
+			}
+		}
+		memory := "-"
+		if sample.MemoryBytes > 0 {
+			memory = formatBytes(sample.MemoryBytes)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", sample.Stem, sample.Version, sample.LeafID, sample.Status,
+			sample.PID, cpu, memory, rate)
+	}
+	return writer.Flush()
+}
+
+// formatBytes prints a byte count with a binary unit, e.g. 64.0MiB.
+func formatBytes(count int64) string {
+	value := float64(count)
+	for _, unit := range []string{"B", "KiB", "MiB", "GiB"} {
+		if value < 1024 {
+			return strconv.FormatFloat(value, 'f', 1, 64) + unit
+		}
+		value /= 1024
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + "TiB"
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+)
+
+// errValidationFailed is returned when the validated configs contain errors.
+var errValidationFailed = errors.New("configuration validation failed")
+
+// runValidateCommand handles `herbarium validate [root folder]`, printing a report of all
+// configuration problems under the root folder without starting anything.
+func runValidateCommand(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: herbarium validate [root folder]")
+	}
+
+	rootFolder := os.Getenv("PLANTARIUM_ROOT_FOLDER")
+	if len(args) == 1 {
+		rootFolder = args[0]
+	}
+	if rootFolder == "" {
+		return errors.New("PLANTARIUM_ROOT_FOLDER not set and no root folder given")
+	}
+
+	report := manager.ValidateConfigurations(rootFolder)
+	fmt.Print(report.String())
+	if !report.Valid() {
+		return errValidationFailed
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+// Package agent implements the herbarium agent, which runs leaf processes on behalf of a remote herbarium.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultListenAddress is used when no listen address is given. It only accepts connections from the agent's
+// own host, so the agent is exposed to herbarium on purpose.
+const DefaultListenAddress = "127.0.0.1:50052"
+
+// LoopbackAddress returns address with its host replaced by the loopback interface, keeping the port.
+func LoopbackAddress(address string) (string, error) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %q: %v", address, err)
+	}
+	return net.JoinHostPort("127.0.0.1", port), nil
+}
+
+// Server exposes the agent API over HTTP with JSON payloads.
+type Server struct {
+	apiKey     string
+	httpServer *http.Server
+
+	mu      sync.Mutex
+	leafs   map[string]*manager.AgentLeaf // Leafs started through this agent, by ID
+	configs map[string]*models.StemConfig // Stem configs of the leafs, used to stop them gracefully
+
+	// Process hooks, replaced in tests
+	startProcess  func(stemName, version, leafID string, config *models.StemConfig) (int, int, error)
+	stopProcess   func(pid int, config *models.StemConfig) error
+	processAlive  func(pid int) bool
+	processMemory func(pid int) (int64, error)
+	processCPU    func(pid int) (time.Duration, error)
+}
+
+// NewServer creates an agent server bound to address. When apiKey is non-empty, every request must present it.
+func NewServer(address, apiKey string) *Server {
+	if address == "" {
+		address = DefaultListenAddress
+	}
+	s := &Server{
+		apiKey:        apiKey,
+		leafs:         make(map[string]*manager.AgentLeaf),
+		configs:       make(map[string]*models.StemConfig),
+		startProcess:  manager.StartLeafProcess,
+		stopProcess:   manager.StopLeafProcess,
+		processAlive:  manager.LeafProcessAlive,
+		processMemory: manager.LeafProcessMemory,
+		processCPU:    manager.LeafProcessCPUTime,
+	}
+	s.httpServer = &http.Server{
+		Addr:    address,
+		Handler: s.Handler(),
+	}
+	return s
+}
+
+// Handler builds the HTTP handler serving all agent routes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /leafs", s.handleListLeafs)
+	mux.HandleFunc("POST /leafs", s.handleStartLeaf)
+	mux.HandleFunc("GET /leafs/{leafID}", s.handleGetLeaf)
+	mux.HandleFunc("DELETE /leafs/{leafID}", s.handleStopLeaf)
+	mux.HandleFunc("GET /leafs/{leafID}/logs", s.handleLeafLogs)
+	return httpapi.RequireAPIKey(s.apiKey, manager.AgentAPIKeyHeader, nil, mux)
+}
+
+// Start binds the listen address and serves requests in the background.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", s.httpServer.Addr, err)
+	}
+	go func() {
+		log.Printf("Agent API listening on %s", listener.Addr())
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Agent API server stopped with error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown gracefully stops the server, waiting for in-flight requests until ctx expires.
+// Leaf processes keep running.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+// lookup returns a copy of a tracked leaf with its current health, memory use, and CPU time.
+func (s *Server) lookup(leafID string) (*manager.AgentLeaf, bool) {
+	s.mu.Lock()
+	leaf, ok := s.leafs[leafID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	status := *leaf
+	status.Alive = s.processAlive(leaf.PID)
+	if status.Alive {
+		if memory, err := s.processMemory(leaf.PID); err == nil {
+			status.MemoryBytes = memory
+		}
+		if cpuTime, err := s.processCPU(leaf.PID); err == nil {
+			status.CPUSeconds = cpuTime.Seconds()
+		}
+	}
+	return &status, true
+}
+
+// handleListLeafs serves GET /leafs with the health of every leaf started through this agent.
+func (s *Server) handleListLeafs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.leafs))
+	for id := range s.leafs {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	sort.Strings(ids)
+
+	leafs := make([]*manager.AgentLeaf, 0, len(ids))
+	for _, id := range ids {
+		if leaf, ok := s.lookup(id); ok {
+			leafs = append(leafs, leaf)
+		}
+	}
+	httpapi.WriteJSON(w, http.StatusOK, leafs)
+}
+
+// handleStartLeaf serves POST /leafs, starting a leaf and responding once it is ready.
+func (s *Server) handleStartLeaf(w http.ResponseWriter, r *http.Request) {
+	var request manager.AgentStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid start request: %v", err))
+		return
+	}
+	if request.StemName == "" || request.Version == "" || !validLeafID(request.LeafID) {
+		httpapi.WriteError(w, http.StatusBadRequest, errors.New("stemName, version, and a valid leafId are required"))
+		return
+	}
+
+	s.mu.Lock()
+	_, exists := s.leafs[request.LeafID]
+	s.mu.Unlock()
+	if exists {
+		httpapi.WriteError(w, http.StatusConflict, fmt.Errorf("leaf %s already exists", request.LeafID))
+		return
+	}
+
+	pid, port, err := s.startProcess(request.StemName, request.Version, request.LeafID, &request.Config)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	leaf := &manager.AgentLeaf{ID: request.LeafID, PID: pid, Port: port, Alive: true}
+	s.mu.Lock()
+	s.leafs[leaf.ID] = leaf
+	s.configs[leaf.ID] = &request.Config
+	s.mu.Unlock()
+	log.Printf("Started leaf %s of stem %s version %s with PID %d on port %d", leaf.ID, request.StemName, request.Version, pid, port)
+	httpapi.WriteJSON(w, http.StatusCreated, leaf)
+}
+
+// handleGetLeaf serves GET /leafs/{leafID} with the health of a leaf.
+func (s *Server) handleGetLeaf(w http.ResponseWriter, r *http.Request) {
+	leaf, ok := s.lookup(r.PathValue("leafID"))
+	if !ok {
+		httpapi.WriteError(w, http.StatusNotFound, fmt.Errorf("leaf %s not found", r.PathValue("leafID")))
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, leaf)
+}
+
+// handleStopLeaf serves DELETE /leafs/{leafID}, stopping the leaf's process tree.
+func (s *Server) handleStopLeaf(w http.ResponseWriter, r *http.Request) {
+	leafID := r.PathValue("leafID")
+	leaf, ok := s.lookup(leafID)
+	if !ok {
+		httpapi.WriteError(w, http.StatusNotFound, fmt.Errorf("leaf %s not found", leafID))
+		return
+	}
+	s.mu.Lock()
+	config := s.configs[leafID]
+	s.mu.Unlock()
+	if leaf.Alive {
+		if err := s.stopProcess(leaf.PID, config); err != nil {
+			httpapi.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.leafs, leafID)
+	delete(s.configs, leafID)
+	s.mu.Unlock()
+	log.Printf("Stopped leaf %s", leafID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleLeafLogs serves GET /leafs/{leafID}/logs as plain text, with the same tail, offset, and length
+// parameters as the admin API. With follow=true, the response stays open and streams new output
+// until the leaf exits or the client disconnects.
+func (s *Server) handleLeafLogs(w http.ResponseWriter, r *http.Request) {
+	leafID := r.PathValue("leafID")
+	leaf, ok := s.lookup(leafID)
+	if !ok {
+		httpapi.WriteError(w, http.StatusNotFound, fmt.Errorf("leaf %s not found", leafID))
+		return
+	}
+
+	params := r.URL.Query()
+	var opts manager.LogReadOptions
+	for name, target := range map[string]*int64{"offset": &opts.Offset, "length": &opts.Length} {
+		if raw := params.Get(name); raw != "" {
+			value, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || value < 0 {
+				httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s must be a non-negative integer", name))
+				return
+			}
+			*target = value
+		}
+	}
+	if raw := params.Get("tail"); raw != "" {
+		tail, err := strconv.Atoi(raw)
+		if err != nil || tail < 1 {
+			httpapi.WriteError(w, http.StatusBadRequest, errors.New("tail must be a positive integer"))
+			return
+		}
+		opts.TailLines = tail
+	}
+
+	data, err := manager.ReadLeafLogFiles(leafID, opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, os.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		httpapi.WriteError(w, status, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+	if params.Get("follow") != "true" {
+		return
+	}
+
+	// Stream output appended after the initial read, starting at the end of the whole history
+	flusher, _ := w.(http.Flusher)
+	offset, err := manager.LeafLogSize(leafID)
+	if err != nil {
+		return
+	}
+	ticker := time.NewTicker(httpapi.LogFollowInterval)
+	defer ticker.Stop()
+	for alive := leaf.Alive; ; {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := manager.ReadLeafLogFiles(leafID, manager.LogReadOptions{Offset: offset})
+		if err != nil {
+			return
+		}
+		if len(data) > 0 {
+			offset += int64(len(data))
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+			continue
+		}
+		// Stop once the leaf has exited and its remaining output was sent
+		if !alive {
+			return
+		}
+		if current, ok := s.lookup(leafID); !ok || !current.Alive {
+			alive = false
+		}
+	}
+}
+
+// validLeafID reports whether leafID can safely name a log file.
+func validLeafID(leafID string) bool {
+	return leafID != "" && leafID != "." && leafID != ".." && !strings.ContainsAny(leafID, `/\`)
+}
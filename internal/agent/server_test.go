@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProcesses replaces process management so tests do not spawn anything.
+type fakeProcesses struct {
+	mu      sync.Mutex
+	alive   map[int]bool
+	stopped []int
+}
+
+func newTestServer(t *testing.T, apiKey string) (*Server, *fakeProcesses, *httptest.Server) {
+	processes := &fakeProcesses{alive: map[int]bool{}}
+	server := NewServer("", apiKey)
+	server.startProcess = func(stemName, version, leafID string, config *models.StemConfig) (int, int, error) {
+		processes.mu.Lock()
+		defer processes.mu.Unlock()
+		processes.alive[100] = true
+		return 100, 8100, nil
+	}
+	server.stopProcess = func(pid int, config *models.StemConfig) error {
+		processes.mu.Lock()
+		defer processes.mu.Unlock()
+		processes.alive[pid] = false
+		processes.stopped = append(processes.stopped, pid)
+		return nil
+	}
+	server.processAlive = func(pid int) bool {
+		processes.mu.Lock()
+		defer processes.mu.Unlock()
+		return processes.alive[pid]
+	}
+	server.processMemory = func(pid int) (int64, error) {
+		return 64 << 20, nil
+	}
+	server.processCPU = func(pid int) (time.Duration, error) {
+		return 1500 * time.Millisecond, nil
+	}
+
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+	return server, processes, httpServer
+}
+
+func TestServer_LeafLifecycleThroughClient(t *testing.T) {
+	logFolder := t.TempDir()
+	t.Setenv("PLANTARIUM_LOG_FOLDER", logFolder)
+	_, processes, httpServer := newTestServer(t, "agent-key")
+
+	client, err := manager.NewAgentClient(httpServer.URL, "agent-key", "")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	assert.Equal(t, "127.0.0.1", client.Host())
+
+	leaf, err := client.StartLeaf(manager.AgentStartRequest{StemName: "api", Version: "v1", LeafID: "api-v1-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, &manager.AgentLeaf{ID: "api-v1-1", PID: 100, Port: 8100, Alive: true}, leaf)
+
+	_, err = client.StartLeaf(manager.AgentStartRequest{StemName: "api", Version: "v1", LeafID: "api-v1-1"})
+	assert.ErrorContains(t, err, "409")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(logFolder, "api-v1-1.log"), []byte("one\ntwo\nthree\n"), 0644))
+	logs, err := client.ReadLeafLogs("api-v1-1", manager.LogReadOptions{TailLines: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "two\nthree\n", string(logs))
+
+	status, err := client.GetLeaf("api-v1-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(64<<20), status.MemoryBytes)
+	assert.Equal(t, 1.5, status.CPUSeconds)
+
+	assert.NoError(t, client.StopLeaf("api-v1-1"))
+	assert.Equal(t, []int{100}, processes.stopped)
+
+	// Stopped leafs are forgotten, and stopping them again is not an error
+	_, err = client.GetLeaf("api-v1-1")
+	assert.ErrorContains(t, err, "404")
+	assert.NoError(t, client.StopLeaf("api-v1-1"))
+}
+
+func TestServer_RequiresAPIKey(t *testing.T) {
+	_, _, httpServer := newTestServer(t, "agent-key")
+
+	resp, err := http.Get(httpServer.URL + "/leafs")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	client, _ := manager.NewAgentClient(httpServer.URL, "wrong", "")
+	_, err = client.StartLeaf(manager.AgentStartRequest{StemName: "api", Version: "v1", LeafID: "api-v1-1"})
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestLoopbackAddress(t *testing.T) {
+	address, err := LoopbackAddress(":50052")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:50052", address)
+	address, err = LoopbackAddress("10.0.0.5:9000")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:9000", address)
+	_, err = LoopbackAddress("50052")
+	assert.Error(t, err)
+}
+
+func TestServer_RejectsUnsafeLeafID(t *testing.T) {
+	_, _, httpServer := newTestServer(t, "")
+	client, _ := manager.NewAgentClient(httpServer.URL, "", "")
+
+	_, err := client.StartLeaf(manager.AgentStartRequest{StemName: "api", Version: "v1", LeafID: "../api"})
+	assert.ErrorContains(t, err, "400")
+}
+
+func TestServer_FollowLogs(t *testing.T) {
+	logFolder := t.TempDir()
+	t.Setenv("PLANTARIUM_LOG_FOLDER", logFolder)
+	_, processes, httpServer := newTestServer(t, "")
+	client, _ := manager.NewAgentClient(httpServer.URL, "", "")
+
+	logPath := filepath.Join(logFolder, "api-v1-1.log")
+	assert.NoError(t, os.WriteFile(logPath, []byte("started\n"), 0644))
+	_, err := client.StartLeaf(manager.AgentStartRequest{StemName: "api", Version: "v1", LeafID: "api-v1-1"})
+	assert.NoError(t, err)
+
+	resp, err := http.Get(httpServer.URL + "/leafs/api-v1-1/logs?follow=true")
+	if err != nil {
+		t.Fatalf("failed to follow logs: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "started\n", line)
+
+	// Output appended while following is streamed
+	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = file.WriteString("serving\n")
+	assert.NoError(t, err)
+	file.Close()
+
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "serving\n", line)
+
+	// The stream ends once the leaf has exited
+	processes.mu.Lock()
+	processes.alive[100] = false
+	processes.mu.Unlock()
+	done := make(chan string, 1)
+	go func() {
+		rest, _ := reader.ReadString(0)
+		done <- rest
+	}()
+	select {
+	case rest := <-done:
+		assert.Empty(t, strings.TrimSpace(rest))
+	case <-time.After(5 * time.Second):
+		t.Fatal("log stream did not end after the leaf exited")
+	}
+}
@@ -0,0 +1,17 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+)
+
+// handleAlerts serves GET /alerts, returning the alerts currently firing ordered by stem and rule.
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if s.Alerts == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("alerts are not evaluated"))
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, s.Alerts.FiringAlerts())
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Alerts(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1",
+		Config: &models.StemConfig{Name: "api", Version: "v1", Alerts: &models.AlertConfig{MinHealthyLeafs: 1}}}
+	leafManager := new(manager.MockLeafManager)
+	leafManager.On("ListLeafs", key, repos.LeafQuery{}).Return([]*models.Leaf{}, 0, nil)
+	alerts := manager.NewAlertEngine(repos.NewStemRepository(db), leafManager, new(manager.MockProxyClient))
+	alerts.Evaluate()
+
+	server := NewServer("", "", new(manager.MockStemManager), leafManager, new(manager.MockSnapshotManager), nil)
+	server.Alerts = alerts
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/alerts", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var firing []models.Alert
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &firing))
+	if assert.Len(t, firing, 1) {
+		assert.Equal(t, models.AlertHealthyLeafs, firing[0].Rule)
+		assert.Equal(t, models.AlertFiring, firing[0].State)
+	}
+
+	// Alerts not evaluated
+	server.Alerts = nil
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/alerts", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
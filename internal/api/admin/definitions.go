@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+// MaxDefinitionBytes bounds the size of an imported stem definition.
+const MaxDefinitionBytes = 1 << 20
+
+// yamlContentType is the content type of exported stem definitions.
+const yamlContentType = "application/yaml"
+
+// handleExportStem serves GET /stems/{name}/{version}/export, returning the stem definition as YAML.
+func (s *Server) handleExportStem(w http.ResponseWriter, r *http.Request) {
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+
+	if _, err := s.StemManager.FetchStemInfo(key); err != nil {
+		httpapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	definition, err := s.StemManager.ExportStem(key)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := yaml.Marshal(definition)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to encode stem definition: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", yamlContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", key.Name+"-"+key.Version+".yaml"))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// handleImportStem serves POST /stems/import, registering a stem from a YAML definition in the body.
+func (s *Server) handleImportStem(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxDefinitionBytes))
+	if err != nil {
+		httpapi.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("failed to read stem definition: %v", err))
+		return
+	}
+
+	var definition manager.StemDefinition
+	if err := yaml.UnmarshalStrict(body, &definition); err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid stem definition: %v", err))
+		return
+	}
+
+	key := storage.StemKey{Name: definition.Config.Name, Version: definition.Config.Version}
+	started := time.Now()
+	err = s.StemManager.ImportStem(definition, manager.RegisterOptions{DeployedBy: s.actor(r)})
+	s.recordDeployment(r, models.DeploymentDeploy, key, map[string]string{"definition": "import"}, started, err)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrStemExists) {
+			status = http.StatusConflict
+		}
+		httpapi.WriteError(w, status, err)
+		return
+	}
+
+	stem, err := s.StemManager.FetchStemInfo(key)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusCreated, newStemResponse(stem))
+}
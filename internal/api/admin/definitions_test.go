@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestClient_ExportImportStem(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := httptest.NewServer(NewServer("", "secret", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil).Handler())
+	defer server.Close()
+
+	stemKey := storage.StemKey{Name: "hello-service", Version: "v1.1"}
+	stem := &models.Stem{Name: "hello-service", Version: "v1.1", WorkingURL: "/hello"}
+	definition := &manager.StemDefinition{
+		FormatVersion: manager.StemDefinitionFormatVersion,
+		Config:        models.StemConfig{Name: "hello-service", Version: "v1.1", URL: "/hello", Command: "java -jar hello-service.jar"},
+		Instances:     2,
+	}
+	mockStemManager.On("FetchStemInfo", stemKey).Return(stem, nil)
+	mockStemManager.On("ExportStem", stemKey).Return(definition, nil)
+	// Imports without a named actor are attributed to the API key
+	mockStemManager.On("ImportStem", *definition, manager.RegisterOptions{DeployedBy: "api-key"}).Return(nil)
+
+	// Export through HAProxy's /herbarium prefix and import the result unchanged
+	api := client.NewClient(server.URL+manager.AdminAPIPath, "secret")
+	exported, err := api.ExportStem("hello-service", "v1.1")
+	assert.NoError(t, err)
+	assert.Contains(t, string(exported), "instances: 2")
+
+	err = api.ImportStem(exported)
+	assert.NoError(t, err)
+	mockStemManager.AssertExpectations(t)
+
+	// Wrong key is rejected
+	_, err = client.NewClient(server.URL, "wrong").ExportStem("hello-service", "v1.1")
+	assert.Error(t, err)
+}
+
+func TestServer_ExportStem_NotFound(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	stemKey := storage.StemKey{Name: "missing", Version: "v1.0"}
+	mockStemManager.On("FetchStemInfo", stemKey).Return(nil, fmt.Errorf("stem not found"))
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stems/missing/v1.0/export", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServer_ImportStem_Errors(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	// Malformed YAML and unknown fields are rejected before reaching the manager
+	for _, body := range []string{"config: [", "formatVersion: 1\nbogus: true\n"} {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/import", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+
+	mockStemManager.On("ImportStem", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: hello-service version v1.1", manager.ErrStemExists))
+	rec := httptest.NewRecorder()
+	body := "formatVersion: 1\nconfig:\n  name: hello-service\n  version: v1.1\n"
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/import", strings.NewReader(body)))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	mockStemManager.ExpectedCalls = nil
+	mockStemManager.On("ImportStem", mock.Anything, mock.Anything).Return(errors.New("bind failed"))
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/import", strings.NewReader(body)))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// MaxDeployArchiveBytes bounds the size of an uploaded service archive.
+const MaxDeployArchiveBytes = 512 << 20
+
+// gzipContentType is the content type of uploaded service archives.
+const gzipContentType = "application/gzip"
+
+// deployArtifactRequest is the JSON body of POST /stems/deploy referencing an artifact instead of holding it.
+type deployArtifactRequest struct {
+	Artifact  string `json:"artifact"`  // https://, s3://, or oci:// URL of the archive
+	SHA256    string `json:"sha256"`    // Checksum the archive must match (optional)
+	Signature string `json:"signature"` // URL of the archive's detached signature (optional)
+}
+
+// handleDeployStem serves POST /stems/deploy, unpacking the gzip-compressed tar of a service version
+// directory in the body, or downloaded from the artifact URL of a JSON body, and registering it as a stem.
+func (s *Server) handleDeployStem(w http.ResponseWriter, r *http.Request) {
+	var key storage.StemKey
+	var err error
+	var parameters map[string]string
+	options := manager.RegisterOptions{DeployedBy: s.actor(r)}
+	started := time.Now()
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var request deployArtifactRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&request); err != nil {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid deploy request: %v", err))
+			return
+		}
+		if request.Artifact == "" {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("artifact is required"))
+			return
+		}
+		parameters = map[string]string{"artifact": request.Artifact}
+		if request.SHA256 != "" {
+			parameters["sha256"] = request.SHA256
+		}
+		if request.Signature != "" {
+			parameters["signature"] = request.Signature
+		}
+		key, err = s.StemManager.DeployArtifact(models.ArtifactConfig{URL: request.Artifact, SHA256: request.SHA256, Signature: request.Signature}, options)
+	} else {
+		parameters = map[string]string{"artifact": "upload"}
+		key, err = s.StemManager.DeployStem(http.MaxBytesReader(w, r.Body, MaxDeployArchiveBytes), options)
+	}
+	s.recordDeployment(r, models.DeploymentDeploy, key, parameters, started, err)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		status := http.StatusInternalServerError
+		switch {
+		case errors.As(err, &tooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, manager.ErrInvalidDeployment):
+			status = http.StatusBadRequest
+		case errors.Is(err, manager.ErrStemExists):
+			status = http.StatusConflict
+		case errors.Is(err, manager.ErrArtifactFetch):
+			status = http.StatusBadGateway
+		case errors.Is(err, manager.ErrArtifactVerification):
+			status = http.StatusUnprocessableEntity
+		}
+		httpapi.WriteError(w, status, err)
+		return
+	}
+
+	stem, err := s.StemManager.FetchStemInfo(key)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusCreated, newStemResponse(stem))
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestClient_DeployStem(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := httptest.NewServer(NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil).Handler())
+	defer server.Close()
+
+	key := storage.StemKey{Name: "billing", Version: "v2"}
+	anonymous := manager.RegisterOptions{DeployedBy: "anonymous"}
+	mockStemManager.On("DeployStem", mock.Anything, anonymous).Return(key, nil).Once()
+	mockStemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "billing", Version: "v2", WorkingURL: "/billing"}, nil)
+
+	stem, err := client.NewClient(server.URL, "").DeployStem(strings.NewReader("archive"))
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", stem.Name)
+	assert.Equal(t, "/billing", stem.URL)
+
+	// Rejected archives and existing versions map to client errors
+	mockStemManager.On("DeployStem", mock.Anything, anonymous).Return(storage.StemKey{}, fmt.Errorf("%w: archive has no config.yaml", manager.ErrInvalidDeployment)).Once()
+	_, err = client.NewClient(server.URL, "").DeployStem(strings.NewReader("archive"))
+	assert.ErrorContains(t, err, "status code: 400")
+
+	mockStemManager.On("DeployStem", mock.Anything, anonymous).Return(key, fmt.Errorf("%w: billing version v2", manager.ErrStemExists)).Once()
+	rec := httptest.NewRecorder()
+	server.Config.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/deploy", strings.NewReader("archive")))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Artifacts are referenced by URL, and artifacts that can't be downloaded are a gateway error
+	artifact := models.ArtifactConfig{URL: "oci://registry.internal/billing:v2", Signature: "https://releases.internal/billing-v2.sig"}
+	mockStemManager.On("DeployArtifact", artifact, manager.RegisterOptions{DeployedBy: "ci@build-7"}).Return(key, nil).Once()
+	stem, err = client.NewClient(server.URL, "").SetActor("ci@build-7").DeployArtifact(artifact)
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", stem.Name)
+
+	s3 := models.ArtifactConfig{URL: "s3://releases/billing.tar.gz"}
+	mockStemManager.On("DeployArtifact", s3, anonymous).Return(storage.StemKey{}, fmt.Errorf("%w s3://releases/billing.tar.gz: status 403", manager.ErrArtifactFetch)).Once()
+	_, err = client.NewClient(server.URL, "").DeployArtifact(s3)
+	assert.ErrorContains(t, err, "status code: 502")
+
+	// Artifacts failing their checksum or signature are unprocessable
+	mockStemManager.On("DeployArtifact", s3, anonymous).Return(storage.StemKey{}, fmt.Errorf("%w: digest mismatch", manager.ErrArtifactVerification)).Once()
+	_, err = client.NewClient(server.URL, "").DeployArtifact(s3)
+	assert.ErrorContains(t, err, "status code: 422")
+
+	rec = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/stems/deploy", strings.NewReader(`{}`))
+	request.Header.Set("Content-Type", "application/json")
+	server.Config.Handler.ServeHTTP(rec, request)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockStemManager.AssertExpectations(t)
+}
@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// recordDeployment records a change to a stem that started at the given time in the deployment history,
+// attributed to the actor of the request, and returns the entry.
+func (s *Server) recordDeployment(r *http.Request, action models.DeploymentAction, key storage.StemKey, parameters map[string]string, started time.Time, err error) models.Deployment {
+	return s.Deployments.Record(manager.CompletedDeployment(s.actor(r), action, key, parameters, started, err))
+}
+
+// handleUnregisterStem serves DELETE /stems/{name}/{version}, stopping the stem's leafs and unregistering it.
+// It returns the deployment history entry of the change.
+func (s *Server) handleUnregisterStem(w http.ResponseWriter, r *http.Request) {
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+	if _, err := s.StemManager.FetchStemInfo(key); err != nil {
+		httpapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	started := time.Now()
+	err := s.StemManager.UnregisterStem(key)
+	entry := s.recordDeployment(r, models.DeploymentUnregister, key, nil, started, err)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, entry)
+}
+
+// handleDeployments serves GET /deployments, returning the deployment history oldest first.
+//
+// Supported query parameters: stem (stem name), actor, action, outcome, since (RFC 3339 time), after (return
+// entries with a greater sequence number), and limit.
+func (s *Server) handleDeployments(w http.ResponseWriter, r *http.Request) {
+	if s.Deployments == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("the deployment history is disabled"))
+		return
+	}
+	params := r.URL.Query()
+
+	query := manager.DeploymentQuery{
+		Stem:    params.Get("stem"),
+		Actor:   params.Get("actor"),
+		Action:  models.DeploymentAction(params.Get("action")),
+		Outcome: models.DeploymentOutcome(params.Get("outcome")),
+		Limit:   DefaultPageLimit,
+	}
+	if raw := params.Get("since"); raw != "" {
+		since, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("since must be an RFC 3339 time"))
+			return
+		}
+		query.Since = since
+	}
+	if raw := params.Get("after"); raw != "" {
+		after, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("after must be a non-negative integer"))
+			return
+		}
+		query.AfterSeq = after
+	}
+	if raw := params.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit))
+			return
+		}
+		query.Limit = limit
+	}
+
+	entries, err := s.Deployments.List(query)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if entries == nil {
+		entries = []models.Deployment{}
+	}
+	httpapi.WriteJSON(w, http.StatusOK, entries)
+}
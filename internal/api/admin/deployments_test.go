@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Deployments(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := NewServer("", "secret", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	rec := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/deployments", nil)
+	request.Header.Set(APIKeyHeader, "secret")
+	server.Handler().ServeHTTP(rec, request)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	history, err := manager.OpenDeploymentHistory(filepath.Join(t.TempDir(), "deployments.jsonl"))
+	assert.NoError(t, err)
+	defer history.Close()
+	server.Deployments = history
+
+	key := storage.StemKey{Name: "billing", Version: "v1"}
+	mockStemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "billing", Version: "v1"}, nil)
+	mockStemManager.On("Scale", key, 4).Return(nil)
+	mockStemManager.On("Scale", key, 99).Return(manager.ErrScaleOutOfRange)
+	mockStemManager.On("UnregisterStem", key).Return(nil)
+
+	send := func(method, path, body, actor string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set(APIKeyHeader, "secret")
+		if actor != "" {
+			request.Header.Set(ActorHeader, actor)
+		}
+		server.Handler().ServeHTTP(rec, request)
+		return rec
+	}
+	assert.Equal(t, http.StatusOK, send(http.MethodPut, "/stems/billing/v1/scale", `{"replicas": 4}`, "alice@laptop").Code)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPut, "/stems/billing/v1/scale", `{"replicas": 99}`, "").Code)
+	rec = send(http.MethodDelete, "/stems/billing/v1", "", "bob@laptop")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"action":"unregister"`)
+	mockStemManager.AssertExpectations(t)
+
+	entries, err := history.List(manager.DeploymentQuery{})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, "alice@laptop", entries[0].Actor)
+		assert.Equal(t, map[string]string{"replicas": "4"}, entries[0].Parameters)
+		assert.Equal(t, "api-key", entries[1].Actor)
+		assert.Equal(t, models.DeploymentFailed, entries[1].Outcome)
+		assert.True(t, strings.Contains(entries[1].Error, manager.ErrScaleOutOfRange.Error()))
+		assert.Equal(t, "bob@laptop", entries[2].Actor)
+		assert.Equal(t, models.DeploymentUnregister, entries[2].Action)
+	}
+
+	// Actors are recorded as valid UTF-8 without control characters, cut at a character
+	actorRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+	actorRequest.Header.Set(ActorHeader, "eve\x1b[2J\tadmin")
+	assert.Equal(t, "eve[2Jadmin", server.actor(actorRequest))
+	actorRequest.Header.Set(ActorHeader, "a"+strings.Repeat("é", maxActorLength))
+	truncated := server.actor(actorRequest)
+	assert.True(t, utf8.ValidString(truncated))
+	assert.Len(t, truncated, maxActorLength-1)
+
+	rec = send(http.MethodGet, "/deployments?action=scale&outcome=failed", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"actor":"api-key"`)
+	assert.NotContains(t, rec.Body.String(), "alice@laptop")
+	rec = send(http.MethodGet, "/deployments?stem=reports", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/deployments?since=yesterday", "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/deployments?limit=0", "", "").Code)
+
+	// Stems that are not registered are not unregistered, and nothing is recorded
+	mockStemManager.On("FetchStemInfo", storage.StemKey{Name: "missing", Version: "v1"}).Return(nil, errors.New("stem not found"))
+	assert.Equal(t, http.StatusNotFound, send(http.MethodDelete, "/stems/missing/v1", "", "").Code)
+	entries, err = history.List(manager.DeploymentQuery{Stem: "missing"})
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
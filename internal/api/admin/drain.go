@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+)
+
+// drainRequest is the optional body of POST /drain.
+type drainRequest struct {
+	Handoff bool `json:"handoff"` // Start each leaf's replacement on another node before stopping it
+}
+
+// handleDrain serves GET /drain, reporting the progress of draining the host.
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if s.Drain == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("draining is not available"))
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, s.Drain.Status())
+}
+
+// handleStartDrain serves POST /drain, refusing deployments and new leafs on this host and stopping its leafs
+// in the background. Clients poll GET /drain until safeToReboot is set.
+func (s *Server) handleStartDrain(w http.ResponseWriter, r *http.Request) {
+	if s.Drain == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("draining is not available"))
+		return
+	}
+	var request drainRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid drain request: %v", err))
+			return
+		}
+	}
+	httpapi.WriteJSON(w, http.StatusAccepted, s.Drain.Start(request.Handoff))
+}
+
+// handleCancelDrain serves DELETE /drain, accepting deployments and starting leafs on this host again.
+func (s *Server) handleCancelDrain(w http.ResponseWriter, r *http.Request) {
+	if s.Drain == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("draining is not available"))
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, s.Drain.Cancel())
+}
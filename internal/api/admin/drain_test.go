@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Drain(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/drain", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	server.Drain = manager.NewDrain(repos.NewStemRepository(db), new(manager.MockLeafManager))
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+	api := client.NewClient(httpServer.URL, "")
+
+	status, err := api.Drain()
+	assert.NoError(t, err)
+	assert.False(t, status.Draining)
+
+	// A host without leafs is drained at once
+	status, err = api.StartDrain(true)
+	assert.NoError(t, err)
+	assert.True(t, status.Draining)
+	assert.True(t, status.Handoff)
+	assert.Eventually(t, func() bool {
+		status, err := api.Drain()
+		return err == nil && status.SafeToReboot
+	}, time.Second, 10*time.Millisecond)
+
+	status, err = api.CancelDrain()
+	assert.NoError(t, err)
+	assert.False(t, status.Draining)
+}
@@ -0,0 +1,18 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+)
+
+// handleDrift serves POST /drift, repairing where the proxy's configuration drifted from the state right away
+// instead of at the next scheduled check, and returning what drifted.
+func (s *Server) handleDrift(w http.ResponseWriter, r *http.Request) {
+	if s.Drift == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("proxy drift is not reconciled"))
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, s.Drift.Reconcile())
+}
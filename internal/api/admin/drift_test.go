@@ -0,0 +1,36 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Drift(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	reconciler := manager.NewDriftReconciler(repos.NewStemRepository(db), new(manager.MockProxyClient))
+
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	server.Drift = reconciler
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drift", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var report models.DriftReport
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Empty(t, report.MissingBackends)
+	assert.Equal(t, []string{"the proxy does not list its backends and servers"}, report.Errors)
+
+	// Drift not reconciled
+	server.Drift = nil
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drift", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
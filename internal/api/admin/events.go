@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// handleEvents serves GET /events, returning recent platform events oldest first.
+//
+// Supported query parameters: stem (stem name), type (event type), after (return events with a greater
+// sequence number), and limit. Clients poll with after set to the last sequence number they saw.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.Events == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("events are not recorded"))
+		return
+	}
+	params := r.URL.Query()
+
+	query := manager.EventQuery{Stem: params.Get("stem"), Type: models.EventType(params.Get("type")), Limit: DefaultPageLimit}
+	if raw := params.Get("after"); raw != "" {
+		after, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("after must be a non-negative integer"))
+			return
+		}
+		query.AfterSeq = after
+	}
+	if raw := params.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit))
+			return
+		}
+		query.Limit = limit
+	}
+
+	events := s.Events.List(query)
+	if events == nil {
+		events = []models.Event{}
+	}
+	httpapi.WriteJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Events(t *testing.T) {
+	events := manager.NewEventLog(0)
+	events.Record(models.Event{Type: models.EventLeafRecycled, Stem: "api", Leaf: "api-1", Message: "recycled"})
+	events.Record(models.Event{Type: models.EventLeafMemoryExceeded, Stem: "worker", Leaf: "worker-1", Message: "too large"})
+	events.Record(models.Event{Type: models.EventLeafMemoryExceeded, Stem: "api", Leaf: "api-2", Message: "too large"})
+
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	server.Events = events
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events?stem=api&after=1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var listed []models.Event
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, uint64(3), listed[0].Seq)
+		assert.Equal(t, "api-2", listed[0].Leaf)
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events?type=LEAF_MEMORY_EXCEEDED&limit=1", nil))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, "worker-1", listed[0].Leaf)
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events?after=-1", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Events not recorded
+	server.Events = nil
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// JournalReader queries the state journal.
+type JournalReader interface {
+	Query(query storage.JournalQuery) ([]storage.JournalEntry, error)
+}
+
+// handleJournal serves GET /journal, returning recorded state mutations oldest first.
+//
+// Supported query parameters: since and until (RFC 3339 timestamps), stem (stem name),
+// after (return entries with a greater sequence number), and limit.
+func (s *Server) handleJournal(w http.ResponseWriter, r *http.Request) {
+	if s.Journal == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("state journal is disabled"))
+		return
+	}
+	params := r.URL.Query()
+
+	query := storage.JournalQuery{StemName: params.Get("stem"), Limit: DefaultPageLimit}
+	for name, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if raw := params.Get(name); raw != "" {
+			value, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s must be an RFC 3339 timestamp", name))
+				return
+			}
+			*target = value
+		}
+	}
+	if raw := params.Get("after"); raw != "" {
+		after, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("after must be a non-negative integer"))
+			return
+		}
+		query.AfterSeq = after
+	}
+	if raw := params.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit))
+			return
+		}
+		query.Limit = limit
+	}
+
+	entries, err := s.Journal.Query(query)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if entries == nil {
+		entries = []storage.JournalEntry{}
+	}
+	httpapi.WriteJSON(w, http.StatusOK, entries)
+}
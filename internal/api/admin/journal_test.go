@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Journal(t *testing.T) {
+	journal, err := storage.OpenFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	defer journal.Close()
+	for _, name := range []string{"api", "worker", "api"} {
+		assert.NoError(t, journal.Append(&storage.JournalEntry{Op: storage.OpStemSaved, StemKey: storage.StemKey{Name: name, Version: "v1"}, Stem: &models.Stem{Name: name}}))
+	}
+
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), journal)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/journal?stem=api&after=1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var entries []storage.JournalEntry
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, uint64(3), entries[0].Seq)
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/journal?since=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Journaling disabled
+	server = NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/journal", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// rollResponse names the leaf that took over from the rolled one.
+type rollResponse struct {
+	LeafID string `json:"leafId"`
+}
+
+// handleRollLeaf serves POST /stems/{name}/{version}/leafs/{leafID}/roll, replacing a running leaf with a
+// fresh one so it picks up changes to the stem's environment and secrets without a redeploy.
+func (s *Server) handleRollLeaf(w http.ResponseWriter, r *http.Request) {
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+	leafID := r.PathValue("leafID")
+	stem, err := s.StemManager.FetchStemInfo(key)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if _, ok := stem.LeafInstances[leafID]; !ok {
+		httpapi.WriteError(w, http.StatusNotFound, fmt.Errorf("leaf %s not found in stem %s version %s", leafID, key.Name, key.Version))
+		return
+	}
+
+	freshID, err := s.LeafManager.RollLeaf(key, leafID)
+	switch {
+	case errors.Is(err, manager.ErrLeafNotRunning):
+		httpapi.WriteError(w, http.StatusConflict, err)
+	case err != nil:
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+	default:
+		httpapi.WriteJSON(w, http.StatusOK, rollResponse{LeafID: freshID})
+	}
+}
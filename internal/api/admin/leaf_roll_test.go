@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_RollLeaf(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockLeafManager := new(manager.MockLeafManager)
+	server := NewServer("", "", mockStemManager, mockLeafManager, new(manager.MockSnapshotManager), nil)
+
+	key := storage.StemKey{Name: "checkout", Version: "1.0.0"}
+	mockStemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "checkout", Version: "1.0.0", LeafInstances: map[string]*models.Leaf{
+		"checkout-1": {ID: "checkout-1", Status: models.StatusRunning},
+		"checkout-2": {ID: "checkout-2", Status: models.StatusStandby},
+	}}, nil)
+	mockLeafManager.On("RollLeaf", key, "checkout-1").Return("checkout-3", nil)
+	mockLeafManager.On("RollLeaf", key, "checkout-2").Return("", fmt.Errorf("cannot roll leaf checkout-2: %w", manager.ErrLeafNotRunning))
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/checkout/1.0.0/leafs/checkout-1/roll", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"leafId":"checkout-3"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/checkout/1.0.0/leafs/checkout-2/roll", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code, "a standby leaf is a conflict, not a failure")
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/checkout/1.0.0/leafs/missing/roll", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockLeafManager.AssertNotCalled(t, "RollLeaf", key, "missing")
+
+	mockStemManager.On("FetchStemInfo", storage.StemKey{Name: "missing", Version: "1.0.0"}).Return(nil, errors.New("stem missing with version 1.0.0 not found"))
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/missing/1.0.0/leafs/checkout-1/roll", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,149 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// handleLeafLogs serves GET /stems/{name}/{version}/leafs/{leafID}/logs as plain text.
+//
+// Supported query parameters: tail (last N lines), or offset and length (byte range across
+// rotated segments, oldest first). Without parameters the beginning of the history is returned.
+// since (an RFC 3339 time or a duration such as 10m) drops lines written earlier, and with
+// follow=true the response stays open and streams new output until the leaf is gone or the
+// client disconnects.
+func (s *Server) handleLeafLogs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+
+	var opts manager.LogReadOptions
+	for name, target := range map[string]*int64{"offset": &opts.Offset, "length": &opts.Length} {
+		if raw := params.Get(name); raw != "" {
+			value, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || value < 0 {
+				httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s must be a non-negative integer", name))
+				return
+			}
+			*target = value
+		}
+	}
+	if raw := params.Get("tail"); raw != "" {
+		tail, err := strconv.Atoi(raw)
+		if err != nil || tail < 1 {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("tail must be a positive integer"))
+			return
+		}
+		opts.TailLines = tail
+	}
+	var filter *manager.LogSinceFilter
+	if raw := params.Get("since"); raw != "" {
+		since, err := parseSince(raw, time.Now())
+		if err != nil {
+			httpapi.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter = &manager.LogSinceFilter{Since: since}
+	}
+	leafID := r.PathValue("leafID")
+
+	data, err := s.LeafManager.ReadLeafLogs(key, leafID, opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, os.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		httpapi.WriteError(w, status, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(filterLog(filter, data))
+	if params.Get("follow") != "true" {
+		return
+	}
+
+	// Stream output appended after the initial read. A tail doesn't tell where the history ends, so it is
+	// found by reading on from the start
+	offset := opts.Offset + int64(len(data))
+	if opts.TailLines > 0 {
+		if offset, err = s.logEnd(key, leafID); err != nil {
+			return
+		}
+	}
+	flusher, _ := w.(http.Flusher)
+	ticker := time.NewTicker(httpapi.LogFollowInterval)
+	defer ticker.Stop()
+	for present := true; ; {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := s.LeafManager.ReadLeafLogs(key, leafID, manager.LogReadOptions{Offset: offset})
+		if err != nil {
+			return
+		}
+		if len(data) > 0 {
+			offset += int64(len(data))
+			if _, err := w.Write(filterLog(filter, data)); err != nil {
+				return
+			}
+			continue
+		}
+		// Stop once the leaf was removed from its stem and its remaining output was sent
+		if !present {
+			return
+		}
+		if stem, err := s.StemManager.FetchStemInfo(key); err != nil || stem.LeafInstances[leafID] == nil {
+			present = false
+		}
+	}
+}
+
+// logEnd returns the size of a leaf's log history. Leafs run by agents keep their logs on the agent's host,
+// so the history is read through in chunks rather than measured.
+func (s *Server) logEnd(key storage.StemKey, leafID string) (int64, error) {
+	var offset int64
+	for {
+		data, err := s.LeafManager.ReadLeafLogs(key, leafID, manager.LogReadOptions{Offset: offset, Length: manager.MaxLogReadBytes})
+		if err != nil {
+			return 0, err
+		}
+		if len(data) == 0 {
+			return offset, nil
+		}
+		offset += int64(len(data))
+	}
+}
+
+// filterLog applies filter to data, or returns data unchanged when filter is nil.
+func filterLog(filter *manager.LogSinceFilter, data []byte) []byte {
+	if filter == nil {
+		return data
+	}
+	return filter.Filter(data)
+}
+
+// parseSince reads a since parameter, either an RFC 3339 time or a duration before now.
+func parseSince(raw string, now time.Time) (time.Time, error) {
+	if since, err := time.Parse(time.RFC3339, raw); err == nil {
+		return since, nil
+	}
+	if age, err := time.ParseDuration(raw); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("since must be an RFC 3339 time or a non-negative duration, got %q", raw)
+}
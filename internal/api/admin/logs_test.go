@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_LeafLogs(t *testing.T) {
+	mockLeafManager := new(manager.MockLeafManager)
+	server := NewServer("", "", new(manager.MockStemManager), mockLeafManager, new(manager.MockSnapshotManager), nil)
+
+	stemKey := storage.StemKey{Name: "hello-service", Version: "v1.1"}
+	mockLeafManager.On("ReadLeafLogs", stemKey, "leaf-1", manager.LogReadOptions{TailLines: 2}).
+		Return([]byte("line 5\nline 6\n"), nil)
+	mockLeafManager.On("ReadLeafLogs", stemKey, "leaf-2", manager.LogReadOptions{Offset: 10, Length: 20}).
+		Return(nil, fmt.Errorf("no logs found for leaf leaf-2: %w", os.ErrNotExist))
+
+	req := httptest.NewRequest(http.MethodGet, "/stems/hello-service/v1.1/leafs/leaf-1/logs?tail=2", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "line 5\nline 6\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/stems/hello-service/v1.1/leafs/leaf-2/logs?offset=10&length=20", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/stems/hello-service/v1.1/leafs/leaf-1/logs?tail=zero", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockLeafManager.AssertExpectations(t)
+}
+
+func TestServer_LeafLogs_SinceAndFollow(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockLeafManager := new(manager.MockLeafManager)
+	server := NewServer("", "", mockStemManager, mockLeafManager, new(manager.MockSnapshotManager), nil)
+
+	stemKey := storage.StemKey{Name: "hello-service", Version: "v1.1"}
+	history := "2024-05-01T11:00:00Z old\n2024-05-01T13:00:00Z new\n"
+	mockLeafManager.On("ReadLeafLogs", stemKey, "leaf-1", manager.LogReadOptions{TailLines: 2}).Return([]byte(history), nil)
+	mockLeafManager.On("ReadLeafLogs", stemKey, "leaf-1", manager.LogReadOptions{Length: manager.MaxLogReadBytes}).Return([]byte(history), nil)
+	end := int64(len(history))
+	mockLeafManager.On("ReadLeafLogs", stemKey, "leaf-1", manager.LogReadOptions{Offset: end, Length: manager.MaxLogReadBytes}).Return([]byte{}, nil)
+	mockLeafManager.On("ReadLeafLogs", stemKey, "leaf-1", manager.LogReadOptions{Offset: end}).Return([]byte("2024-05-01T13:00:01Z appended\n"), nil).Once()
+	mockLeafManager.On("ReadLeafLogs", stemKey, "leaf-1", manager.LogReadOptions{Offset: end + 30}).Return([]byte{}, nil)
+	mockStemManager.On("FetchStemInfo", stemKey).Return(&models.Stem{Name: "hello-service", Version: "v1.1"}, nil)
+
+	// The leaf is gone from its stem, so following ends after the appended output
+	req := httptest.NewRequest(http.MethodGet, "/stems/hello-service/v1.1/leafs/leaf-1/logs?tail=2&since=2024-05-01T12:00:00Z&follow=true", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2024-05-01T13:00:00Z new\n2024-05-01T13:00:01Z appended\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/stems/hello-service/v1.1/leafs/leaf-1/logs?since=yesterday", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	since, err := parseSince("10m", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-10*time.Minute), since)
+
+	since, err = parseSince("2024-05-01T08:00:00Z", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), since)
+
+	_, err = parseSince("-5m", now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// maxMaintenanceRequestBytes bounds the body of POST /maintenance, which may carry an HTML page.
+const maxMaintenanceRequestBytes = 1 << 20
+
+// maintenanceRequest is the optional body of POST /maintenance.
+type maintenanceRequest struct {
+	Page string `json:"page"` // HTML page to serve, empty for the configured page
+}
+
+// handleMaintenance serves GET /maintenance, reporting whether the platform is in maintenance mode.
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if s.Maintenance == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("maintenance mode is not available"))
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, s.Maintenance.Status())
+}
+
+// handleEnterMaintenance serves POST /maintenance, switching all backends to the maintenance page and
+// blocking new deployments.
+func (s *Server) handleEnterMaintenance(w http.ResponseWriter, r *http.Request) {
+	if s.Maintenance == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("maintenance mode is not available"))
+		return
+	}
+	var request maintenanceRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMaintenanceRequestBytes)).Decode(&request); err != nil {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid maintenance request: %v", err))
+			return
+		}
+	}
+	status, err := s.Maintenance.Enter(request.Page)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, status)
+}
+
+// handleExitMaintenance serves DELETE /maintenance, routing requests to the leafs again.
+func (s *Server) handleExitMaintenance(w http.ResponseWriter, r *http.Request) {
+	if s.Maintenance == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("maintenance mode is not available"))
+		return
+	}
+	status, err := s.Maintenance.Exit()
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, status)
+}
+
+// handleStemMaintenance serves PUT (on) and DELETE (off) /stems/{name}/{version}/maintenance, switching the
+// servers of a single stem into or out of maintenance while its leafs keep running.
+func (s *Server) handleStemMaintenance(on bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+		if _, err := s.StemManager.FetchStemInfo(key); err != nil {
+			httpapi.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if err := s.StemManager.SetMaintenance(key, on); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, manager.ErrMaintenance) {
+				status = http.StatusConflict
+			}
+			httpapi.WriteError(w, status, err)
+			return
+		}
+		stem, err := s.StemManager.FetchStemInfo(key)
+		if err != nil {
+			httpapi.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		httpapi.WriteJSON(w, http.StatusOK, newStemResponse(stem))
+	}
+}
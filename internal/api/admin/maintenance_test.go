@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/embeddedproxy"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Maintenance(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[storage.StemKey{Name: "api", Version: "v1"}] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api"}}
+	embedded := embeddedproxy.NewEmbeddedProxy(embeddedproxy.EmbeddedConfig{})
+	assert.NoError(t, embedded.BindStem("api", proxy.BackendOptions{}))
+
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	server.Maintenance = manager.NewMaintenance(repos.NewStemRepository(db), embedded, "")
+	serve := func(method, body string) (int, models.MaintenanceStatus) {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(method, "/maintenance", strings.NewReader(body)))
+		var status models.MaintenanceStatus
+		json.Unmarshal(rec.Body.Bytes(), &status)
+		return rec.Code, status
+	}
+
+	code, status := serve(http.MethodPost, `{"page": "<h1>Upgrading</h1>"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, status.Enabled)
+	assert.Equal(t, []string{"api"}, status.Backends)
+
+	rec := httptest.NewRecorder()
+	embedded.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "<h1>Upgrading</h1>", rec.Body.String())
+
+	code, status = serve(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, status.Enabled)
+
+	code, status = serve(http.MethodDelete, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, status.Enabled)
+
+	code, _ = serve(http.MethodPost, `{"page": `)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Maintenance mode not available
+	server.Maintenance = nil
+	code, _ = serve(http.MethodGet, "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestServer_StemMaintenance(t *testing.T) {
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	stemManager := new(manager.MockStemManager)
+	stemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "api", Version: "v1", Maintenance: true}, nil)
+	stemManager.On("FetchStemInfo", storage.StemKey{Name: "missing", Version: "v1"}).Return(nil, assert.AnError)
+	stemManager.On("SetMaintenance", key, true).Return(nil).Once()
+	stemManager.On("SetMaintenance", key, false).Return(manager.ErrMaintenance).Once()
+	server := NewServer("", "", stemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/api/v1/maintenance", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var stem stemResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stem))
+	assert.True(t, stem.Maintenance)
+
+	// Stems can't be switched while the platform is in maintenance mode
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/stems/api/v1/maintenance", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/missing/v1/maintenance", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	stemManager.AssertExpectations(t)
+}
@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// metricsContentType is the content type of the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelEscaper escapes label values as the text exposition format expects.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsWriter writes metric families in the Prometheus text exposition format.
+type metricsWriter struct {
+	builder strings.Builder
+}
+
+// family starts a metric family of the given type: counter or gauge.
+func (m *metricsWriter) family(name, kind, help string) {
+	fmt.Fprintf(&m.builder, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample of the current family, labelled with name and value pairs.
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.builder.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+		}
+		m.builder.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	m.builder.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+// handleMetrics serves GET /metrics in the Prometheus text format, for scrapers given the API key as a bearer
+// token. It exports the cold starts of every stem: how many requests its graft node held until a leaf was ready
+// and how long they waited. With storage inspected, it exports the size and lock contention of storage too.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	stems := s.StemManager.ReadSnapshot().Stems()
+
+	families := []struct {
+		name, kind, help string
+		value            func(stem int) float64
+	}{
+		{"herbarium_cold_starts_total", "counter", "Leafs started by a graft node for the requests it held.",
+			func(i int) float64 { return float64(stems[i].ColdStarts.Count) }},
+		{"herbarium_cold_start_requests_total", "counter", "Requests that arrived during cold starts.",
+			func(i int) float64 { return float64(stems[i].ColdStarts.Requests) }},
+		{"herbarium_cold_start_wait_seconds_total", "counter", "Time requests waited for a leaf during cold starts, summed.",
+			func(i int) float64 { return stems[i].ColdStarts.TotalWait.Seconds() }},
+		{"herbarium_cold_start_max_requests", "gauge", "Most requests that arrived during a single cold start.",
+			func(i int) float64 { return float64(stems[i].ColdStarts.MaxRequests) }},
+		{"herbarium_cold_start_max_wait_seconds", "gauge", "Longest a request waited for a leaf during a cold start.",
+			func(i int) float64 { return stems[i].ColdStarts.MaxWait.Seconds() }},
+	}
+
+	var metrics metricsWriter
+	for _, family := range families {
+		metrics.family(family.name, family.kind, family.help)
+		for i, stem := range stems {
+			metrics.sample(family.name, family.value(i), "stem", stem.Name, "version", stem.Version)
+		}
+	}
+	if s.Storage != nil {
+		writeStorageMetrics(&metrics, s.Storage.Stats())
+	}
+	w.Header().Set("Content-Type", metricsContentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(metrics.builder.String()))
+}
+
+// writeStorageMetrics writes the size and lock contention of the state storage.
+func writeStorageMetrics(metrics *metricsWriter, stats storage.Stats) {
+	families := []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"herbarium_storage_stems", "gauge", "Stems held in storage.", float64(stats.Stems)},
+		{"herbarium_storage_leafs", "gauge", "Leafs of all stems held in storage.", float64(stats.Leafs)},
+		{"herbarium_storage_graft_nodes", "gauge", "Stems with a graft node set.", float64(stats.GraftNodes)},
+		{"herbarium_storage_nodes", "gauge", "Nodes leafs can be placed on.", float64(stats.Nodes)},
+		{"herbarium_storage_journal_entries", "gauge", "Sequence number of the last journal entry.", float64(stats.JournalEntries)},
+		{"herbarium_storage_journal_bytes", "gauge", "Size of the journal in bytes.", float64(stats.JournalBytes)},
+		{"herbarium_storage_lock_waits_total", "counter", "Storage lock acquisitions that had to wait.", float64(stats.LockWaits)},
+		{"herbarium_storage_lock_wait_seconds_total", "counter", "Time spent waiting for storage locks, summed.", stats.LockWaitTime.Seconds()},
+	}
+	for _, family := range families {
+		metrics.family(family.name, family.kind, family.help)
+		metrics.sample(family.name, family.value)
+	}
+}
@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockStemManager.On("ReadSnapshot").Return(storage.NewStateView(time.Now(), 0, map[storage.StemKey]*models.Stem{
+		{Name: "api", Version: "v1"}:      {Name: "api", Version: "v1", ColdStarts: models.ColdStartStats{Count: 2, Requests: 5, MaxRequests: 4, TotalWait: 7500 * time.Millisecond, MaxWait: 2 * time.Second}},
+		{Name: `odd"name`, Version: "v2"}: {Name: `odd"name`, Version: "v2"},
+	}))
+	server := NewServer("", "secret", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	// Scrapers authenticate with a bearer token
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, metricsContentType, rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE herbarium_cold_starts_total counter\n")
+	assert.Contains(t, body, `herbarium_cold_starts_total{stem="api",version="v1"} 2`+"\n")
+	assert.Contains(t, body, `herbarium_cold_start_requests_total{stem="api",version="v1"} 5`+"\n")
+	assert.Contains(t, body, `herbarium_cold_start_wait_seconds_total{stem="api",version="v1"} 7.5`+"\n")
+	assert.Contains(t, body, `herbarium_cold_start_max_requests{stem="api",version="v1"} 4`+"\n")
+	assert.Contains(t, body, `herbarium_cold_start_max_wait_seconds{stem="api",version="v1"} 2`+"\n")
+	assert.Contains(t, body, `herbarium_cold_starts_total{stem="odd\"name",version="v2"} 0`+"\n")
+}
+
+func TestServer_StorageMetrics(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockStemManager.On("ReadSnapshot").Return(storage.NewStateView(time.Now(), 0, map[storage.StemKey]*models.Stem{}))
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	// Storage metrics are only exported when storage is inspected
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.NotContains(t, rec.Body.String(), "herbarium_storage_")
+
+	server.Storage = storage.GetTestStorage()
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE herbarium_storage_leafs gauge\n")
+	assert.Contains(t, body, "herbarium_storage_stems 2\n")
+	assert.Contains(t, body, "herbarium_storage_leafs 2\n")
+	assert.Contains(t, body, "herbarium_storage_graft_nodes 1\n")
+	assert.Contains(t, body, "herbarium_storage_lock_wait_seconds_total 0\n")
+}
@@ -0,0 +1,130 @@
+package admin
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"gopkg.in/yaml.v2"
+)
+
+// OpenAPIPath is where the OpenAPI document of the admin API is served, with a .yaml or .json extension.
+const OpenAPIPath = "/openapi"
+
+// DocsPath is where Swagger UI is served when enabled with api.swagger_ui.
+const DocsPath = "/docs"
+
+// openAPIDocument describes every v1 route of Server.routes. Keep the two in step; the tests compare them.
+//
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+// openAPIJSON converts openAPIDocument to JSON once, on first use.
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(openAPIDocument, &document); err != nil {
+		return nil, fmt.Errorf("failed to decode OpenAPI document: %v", err)
+	}
+	document, err := jsonCompatible(document)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+})
+
+// jsonCompatible converts the map[interface{}]interface{} values yaml.v2 decodes mappings into to
+// map[string]interface{}, which encoding/json can encode.
+func jsonCompatible(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("OpenAPI document has non-string key %v", key)
+			}
+			item, err := jsonCompatible(item)
+			if err != nil {
+				return nil, err
+			}
+			converted[name] = item
+		}
+		return converted, nil
+	case []interface{}:
+		for i, item := range value {
+			item, err := jsonCompatible(item)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = item
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+// isPublicDocument reports whether r fetches the OpenAPI document or Swagger UI, at the root or under
+// manager.AdminAPIPath, of any API version.
+func isPublicDocument(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	path := strings.TrimPrefix(r.URL.Path, manager.AdminAPIPath)
+	for _, version := range APIVersions {
+		path = strings.TrimPrefix(path, "/"+version)
+	}
+	return path == OpenAPIPath+".yaml" || path == OpenAPIPath+".json" || path == DocsPath
+}
+
+// handleOpenAPIYAML serves the OpenAPI document as written.
+func (s *Server) handleOpenAPIYAML(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPIDocument)
+}
+
+// handleOpenAPIJSON serves the OpenAPI document as JSON, which most client generators prefer.
+func (s *Server) handleOpenAPIJSON(w http.ResponseWriter, r *http.Request) {
+	document, err := openAPIJSON()
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at the JSON document next to it, which resolves
+// both at the root and under manager.AdminAPIPath.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Herbarium Admin API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// handleDocs serves Swagger UI, or 404 unless api.swagger_ui enables it.
+func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	if !s.SwaggerUI {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("swagger UI is disabled"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
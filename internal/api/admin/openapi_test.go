@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestOpenAPIDocument_CoversRoutes(t *testing.T) {
+	var document struct {
+		Paths map[string]map[string]interface{} `yaml:"paths"`
+	}
+	assert.NoError(t, yaml.Unmarshal(openAPIDocument, &document))
+
+	var documented []string
+	for path, operations := range document.Paths {
+		for method := range operations {
+			if method != "parameters" {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	var served []string
+	for _, route := range server.routes("v1") {
+		served = append(served, route.pattern)
+	}
+	sort.Strings(documented)
+	sort.Strings(served)
+	assert.Equal(t, served, documented)
+}
+
+func TestServer_OpenAPI(t *testing.T) {
+	server := NewServer("", "secret", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	// The documents are public, and served under the HAProxy path as well
+	for _, path := range []string{"/openapi.json", manager.AdminAPIPath + "/openapi.json"} {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var document map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+		assert.Equal(t, "3.0.3", document["openapi"])
+	}
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, openAPIDocument, rec.Body.Bytes())
+
+	// Swagger UI is off unless enabled, and the API itself still needs the key
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	server.SwaggerUI = true
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `url: "openapi.json"`)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stems", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,28 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// handleProxyConfig serves GET /proxy/config, rendering the configuration of the backends, servers, and routing
+// rules herbarium manages in the proxy, read live from it.
+func (s *Server) handleProxyConfig(w http.ResponseWriter, r *http.Request) {
+	exporter, ok := s.Proxy.(proxy.ConfigExporter)
+	if !ok {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("the proxy does not export its configuration"))
+		return
+	}
+	config, err := exporter.ExportConfig()
+	if err != nil {
+		httpapi.WriteError(w, http.StatusBadGateway, fmt.Errorf("failed to export proxy configuration: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(config))
+}
@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/stretchr/testify/assert"
+)
+
+// exportingProxyClient is a MockProxyClient that also renders its managed configuration.
+type exportingProxyClient struct {
+	*manager.MockProxyClient
+	config string
+	err    error
+}
+
+func (c *exportingProxyClient) ExportConfig() (string, error) {
+	return c.config, c.err
+}
+
+func TestServer_ProxyConfig(t *testing.T) {
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	proxyClient := &exportingProxyClient{MockProxyClient: new(manager.MockProxyClient), config: "backend api\n  server api-1 localhost:8001\n"}
+	server.Proxy = proxyClient
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/config", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "backend api\n  server api-1 localhost:8001\n", rec.Body.String())
+
+	// The proxy could not be reached
+	proxyClient.err = assert.AnError
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/config", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+
+	// Proxies that can't render their configuration
+	server.Proxy = new(manager.MockProxyClient)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/config", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
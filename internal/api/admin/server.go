@@ -0,0 +1,220 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// DefaultListenAddress is used when the global config does not set api.listen_address.
+const DefaultListenAddress = manager.DefaultAPIListenAddress
+
+// APIVersions lists the admin API versions served, oldest first, each under /<version>. Within a version,
+// changes are additive only: new routes, optional parameters, and response fields. Anything else ships in
+// a new version, next to the old ones.
+var APIVersions = []string{"v1"}
+
+// LegacyAPIVersion is the version served at the unversioned paths, which integrations that predate API
+// versioning use. It stays v1 when newer versions are added.
+const LegacyAPIVersion = "v1"
+
+// APIKeyHeader is the request header carrying the API key. A bearer token in Authorization is accepted as well.
+const APIKeyHeader = "X-API-Key"
+
+// ActorHeader is the request header naming who acts through the API key, e.g. the user running the CLI.
+const ActorHeader = "X-Herbarium-Actor"
+
+// maxActorLength caps the actor names recorded from ActorHeader.
+const maxActorLength = 128
+
+// Server exposes the herbarium admin API over HTTP with JSON payloads.
+type Server struct {
+	StemManager     manager.StemManagerInterface
+	LeafManager     manager.LeafManagerInterface
+	SnapshotManager manager.SnapshotManagerInterface
+	Journal         JournalReader              // Nil when journaling is disabled
+	Events          *manager.EventLog          // Nil when events are not recorded
+	Alerts          *manager.AlertEngine       // Nil when alerts are not evaluated
+	Maintenance     *manager.Maintenance       // Nil when maintenance mode is not available
+	Drain           *manager.Drain             // Nil when the host can't be drained
+	Sweeper         *manager.Sweeper           // Nil when orphans are not swept
+	Drift           *manager.DriftReconciler   // Nil when proxy drift is not reconciled
+	Proxy           proxy.ProxyClient          // Nil when the proxy's configuration is not exported
+	Janitor         *manager.Janitor           // Nil when tombstones are not kept
+	Deployments     *manager.DeploymentHistory // Nil when the deployment history is disabled
+	Stats           *manager.StatsCollector    // Nil when stats are not collected
+	Storage         StorageInspector           // Nil when storage is not inspected
+	SwaggerUI       bool                       // Serve Swagger UI at /docs
+	apiKey          string
+	httpServer      *http.Server
+	addr            net.Addr
+}
+
+// NewServer creates a new admin API server bound to the given address. When apiKey is non-empty,
+// every request must present it.
+func NewServer(address, apiKey string, stemManager manager.StemManagerInterface, leafManager manager.LeafManagerInterface, snapshotManager manager.SnapshotManagerInterface, journal JournalReader) *Server {
+	if address == "" {
+		address = DefaultListenAddress
+	}
+
+	s := &Server{
+		StemManager:     stemManager,
+		LeafManager:     leafManager,
+		SnapshotManager: snapshotManager,
+		Journal:         journal,
+		apiKey:          apiKey,
+	}
+	s.httpServer = &http.Server{
+		Addr:    address,
+		Handler: s.Handler(),
+	}
+	return s
+}
+
+// route is an admin API route: a ServeMux pattern and the handler serving it.
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// routes lists the routes of an admin API version, nil for unknown versions. Each v1 route is described in
+// the OpenAPI document. A new version starts from the routes of the previous one and replaces those whose
+// contract it breaks, so both can be served side by side.
+func (s *Server) routes(version string) []route {
+	if version != "v1" {
+		return nil
+	}
+	return []route{
+		{"GET /stems", s.handleListStems},
+		{"POST /stems/import", s.handleImportStem},
+		{"POST /stems/deploy", s.handleDeployStem},
+		{"GET /stems/{name}/versions", s.handleStemVersions},
+		{"POST /stems/{name}/rollback", s.handleRollbackStem},
+		{"DELETE /stems/{name}/{version}", s.handleUnregisterStem},
+		{"GET /stems/{name}/{version}/export", s.handleExportStem},
+		{"PUT /stems/{name}/{version}/config", s.handleUpdateStemConfig},
+		{"PUT /stems/{name}/{version}/scale", s.handleScaleStem},
+		{"PUT /stems/{name}/{version}/traffic-split", s.handleSetTrafficSplit},
+		{"GET /stems/{name}/{version}/leafs", s.handleListLeafs},
+		{"POST /stems/{name}/{version}/leafs/promote", s.handlePromoteLeaf},
+		{"PUT /stems/{name}/{version}/maintenance", s.handleStemMaintenance(true)},
+		{"DELETE /stems/{name}/{version}/maintenance", s.handleStemMaintenance(false)},
+		{"GET /stems/{name}/{version}/leafs/{leafID}/logs", s.handleLeafLogs},
+		{"POST /stems/{name}/{version}/leafs/{leafID}/roll", s.handleRollLeaf},
+		{"GET /tombstones", s.handleListTombstones},
+		{"GET /tombstones/{name}/{version}", s.handleGetTombstone},
+		{"GET /snapshots", s.handleListSnapshots},
+		{"POST /snapshots", s.handleCreateSnapshot},
+		{"GET /journal", s.handleJournal},
+		{"GET /events", s.handleEvents},
+		{"GET /deployments", s.handleDeployments},
+		{"GET /alerts", s.handleAlerts},
+		{"GET /maintenance", s.handleMaintenance},
+		{"POST /maintenance", s.handleEnterMaintenance},
+		{"DELETE /maintenance", s.handleExitMaintenance},
+		{"GET /drain", s.handleDrain},
+		{"POST /drain", s.handleStartDrain},
+		{"DELETE /drain", s.handleCancelDrain},
+		{"POST /sweep", s.handleSweep},
+		{"POST /drift", s.handleDrift},
+		{"GET /proxy/config", s.handleProxyConfig},
+		{"GET /stats", s.handleStats},
+		{"GET /storage", s.handleStorage},
+		{"GET /metrics", s.handleMetrics},
+	}
+}
+
+// Handler builds the HTTP handler serving all admin API routes. Each version is served under /<version>,
+// and LegacyAPIVersion at the unversioned paths as well. Both are served at the root (direct access) and
+// under manager.AdminAPIPath (access through HAProxy, which forwards the path as is).
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, version := range APIVersions {
+		mux.Handle("/"+version+"/", http.StripPrefix("/"+version, s.versionHandler(version)))
+	}
+	mux.Handle("/", s.versionHandler(LegacyAPIVersion))
+
+	root := http.NewServeMux()
+	root.Handle(manager.AdminAPIPath+"/", http.StripPrefix(manager.AdminAPIPath, mux))
+	root.Handle("/", mux)
+	return httpapi.RequireAPIKey(s.apiKey, APIKeyHeader, isPublicDocument, root)
+}
+
+// versionHandler serves the routes of an admin API version, with the API description and Swagger UI.
+func (s *Server) versionHandler(version string) http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range s.routes(version) {
+		mux.HandleFunc(route.pattern, route.handler)
+	}
+	mux.HandleFunc("GET "+OpenAPIPath+".yaml", s.handleOpenAPIYAML)
+	mux.HandleFunc("GET "+OpenAPIPath+".json", s.handleOpenAPIJSON)
+	mux.HandleFunc("GET "+DocsPath, s.handleDocs)
+	return mux
+}
+
+// actor identifies who sent a request: the user named in ActorHeader, or else the API key it presented. All
+// holders of the API key can name any user, so the actor attributes changes rather than authenticating them.
+// Invalid UTF-8 and control characters are dropped from the header, and long names are cut at a character.
+func (s *Server) actor(r *http.Request) string {
+	actor := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(r.Header.Get(ActorHeader), ""))
+	if actor = strings.TrimSpace(actor); actor != "" {
+		if len(actor) > maxActorLength {
+			cut := maxActorLength
+			for cut > 0 && !utf8.RuneStart(actor[cut]) {
+				cut--
+			}
+			actor = actor[:cut]
+		}
+		return actor
+	}
+	if s.apiKey != "" {
+		return "api-key"
+	}
+	return "anonymous"
+}
+
+// Start binds the listen address and serves requests in the background.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", s.httpServer.Addr, err)
+	}
+	s.Serve(listener)
+	return nil
+}
+
+// Serve serves the admin API on an existing listener in the background, e.g. a socket-activated one.
+func (s *Server) Serve(listener net.Listener) {
+	s.addr = listener.Addr()
+	go func() {
+		log.Printf("Admin API listening on %s", listener.Addr())
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Admin API server stopped with error: %v", err)
+		}
+	}()
+}
+
+// Addr returns the address the server listens on, nil until it serves.
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+// Shutdown gracefully stops the server, waiting for in-flight requests until ctx expires.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
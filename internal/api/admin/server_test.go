@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestServer_APIKey(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockStemManager.On("ListStems", mock.AnythingOfType("repos.StemQuery")).Return([]*models.Stem{}, 0, nil)
+	server := NewServer("", "secret", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	cases := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"missing key", "", "", http.StatusUnauthorized},
+		{"wrong key", APIKeyHeader, "guess", http.StatusUnauthorized},
+		{"api key header", APIKeyHeader, "secret", http.StatusOK},
+		{"bearer token", "Authorization", "Bearer secret", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/stems", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+			assert.Equal(t, tc.status, rec.Code)
+		})
+	}
+}
+
+func TestServer_ReservedPathPrefix(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockStemManager.On("ListStems", repos.StemQuery{Limit: DefaultPageLimit}).Return([]*models.Stem{}, 0, nil)
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	// Requests routed through HAProxy keep the reserved path prefix
+	req := httptest.NewRequest(http.MethodGet, manager.AdminAPIPath+"/stems", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockStemManager.AssertExpectations(t)
+}
+
+func TestServer_APIVersions(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockStemManager.On("ListStems", repos.StemQuery{Limit: DefaultPageLimit}).Return([]*models.Stem{}, 0, nil)
+	server := NewServer("", "secret", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	// v1 is served under its prefix and, for older integrations, at the unversioned paths
+	cases := map[string]int{
+		"/v1/stems":                        http.StatusOK,
+		manager.AdminAPIPath + "/v1/stems": http.StatusOK,
+		"/stems":                           http.StatusOK,
+		"/v2/stems":                        http.StatusNotFound,
+		"/v1/openapi.json":                 http.StatusOK,
+		manager.AdminAPIPath + "/v1/docs":  http.StatusNotFound,
+		manager.AdminAPIPath + "/v1/bogus": http.StatusNotFound,
+	}
+	for path, status := range cases {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(APIKeyHeader, "secret")
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		assert.Equal(t, status, rec.Code, path)
+	}
+}
@@ -0,0 +1,33 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+)
+
+// snapshotResponse is returned after a snapshot is created.
+type snapshotResponse struct {
+	Name string `json:"name"`
+}
+
+// handleListSnapshots serves GET /snapshots, listing stored state snapshots newest first.
+func (s *Server) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := s.SnapshotManager.ListSnapshots()
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, snapshots)
+}
+
+// handleCreateSnapshot serves POST /snapshots, writing a snapshot of the current state on demand.
+// Snapshots are restored at startup with `herbarium --restore`.
+func (s *Server) handleCreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	name, err := s.SnapshotManager.CreateSnapshot()
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusCreated, snapshotResponse{Name: name})
+}
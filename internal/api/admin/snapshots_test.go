@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Snapshots(t *testing.T) {
+	mockSnapshotManager := new(manager.MockSnapshotManager)
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), mockSnapshotManager, nil)
+
+	mockSnapshotManager.On("CreateSnapshot").Return("herbarium-20260101T000000.000Z.snapshot.json", nil).Once()
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/snapshots", nil))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), "herbarium-20260101T000000.000Z.snapshot.json")
+
+	mockSnapshotManager.On("ListSnapshots").Return([]manager.SnapshotInfo{
+		{Name: "herbarium-20260101T000000.000Z.snapshot.json", CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Size: 42},
+	}, nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/snapshots", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var snapshots []manager.SnapshotInfo
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snapshots))
+	assert.Len(t, snapshots, 1)
+
+	mockSnapshotManager.On("CreateSnapshot").Return("", errors.New("disk full"))
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/snapshots", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// statsResponse is the admin API representation of a leaf's resource and request sample.
+type statsResponse struct {
+	Stem        string            `json:"stem"`
+	Version     string            `json:"version"`
+	LeafID      string            `json:"leafId"`
+	PID         int               `json:"pid"`
+	Port        int               `json:"port"`
+	Status      models.LeafStatus `json:"status"`
+	MemoryBytes int64             `json:"memoryBytes"`
+	CPUSeconds  float64           `json:"cpuSeconds"`
+	Requests    int64             `json:"requests"`
+	Sampled     time.Time         `json:"sampled"`
+}
+
+// handleStats serves GET /stats, sampling the memory, CPU time, and requests of every leaf. CPU time and
+// requests are cumulative, so clients derive rates from successive samples; requests is -1 when the proxy
+// can't count them.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if s.Stats == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("stats are not collected"))
+		return
+	}
+	stats, err := s.Stats.Collect()
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]statsResponse, 0, len(stats))
+	for _, sample := range stats {
+		items = append(items, statsResponse{
+			Stem:        sample.Stem,
+			Version:     sample.Version,
+			LeafID:      sample.LeafID,
+			PID:         sample.PID,
+			Port:        sample.Port,
+			Status:      sample.Status,
+			MemoryBytes: sample.MemoryBytes,
+			CPUSeconds:  sample.CPUTime.Seconds(),
+			Requests:    sample.Requests,
+			Sampled:     sample.Sampled,
+		})
+	}
+	httpapi.WriteJSON(w, http.StatusOK, items)
+}
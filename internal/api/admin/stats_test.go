@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Stats(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1",
+		LeafInstances: map[string]*models.Leaf{"api-1": {ID: "api-1", PID: 100, Port: 8001, Status: models.StatusRunning}}}
+	mockLeafManager := new(manager.MockLeafManager)
+	mockLeafManager.On("LeafResources", key, "api-1").Return(&manager.LeafResources{MemoryBytes: 64 << 20, CPUTime: 1500 * time.Millisecond}, nil)
+
+	server := NewServer("", "", new(manager.MockStemManager), mockLeafManager, new(manager.MockSnapshotManager), nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	server.Stats = manager.NewStatsCollector(repos.NewStemRepository(db), mockLeafManager, new(manager.MockProxyClient))
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	stats, err := client.NewClient(httpServer.URL, "").Stats()
+	assert.NoError(t, err)
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, "api-1", stats[0].LeafID)
+		assert.Equal(t, int64(64<<20), stats[0].MemoryBytes)
+		assert.Equal(t, 1.5, stats[0].CPUSeconds)
+		assert.Equal(t, int64(-1), stats[0].Requests)
+	}
+}
@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+// handleUpdateStemConfig serves PUT /stems/{name}/{version}/config, applying the YAML stem config in the body
+// to the registered stem in place. With roll=true the running leafs are replaced to pick up a changed env or
+// command. The name and version may be left out of the config.
+func (s *Server) handleUpdateStemConfig(w http.ResponseWriter, r *http.Request) {
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+	if _, err := s.StemManager.FetchStemInfo(key); err != nil {
+		httpapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxDefinitionBytes))
+	if err != nil {
+		httpapi.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("failed to read stem config: %v", err))
+		return
+	}
+	var config models.StemConfig
+	if err := yaml.UnmarshalStrict(body, &config); err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid stem config: %v", err))
+		return
+	}
+	if config.Name == "" {
+		config.Name = key.Name
+	}
+	if config.Version == "" {
+		config.Version = key.Version
+	}
+	if config.Name != key.Name || config.Version != key.Version {
+		httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("config must keep the name %s and version %s of the stem", key.Name, key.Version))
+		return
+	}
+
+	opts := manager.UpdateOptions{RollLeafs: r.URL.Query().Get("roll") == "true"}
+	if err := s.StemManager.UpdateStemConfig(key, config, opts); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrMaintenance) {
+			status = http.StatusConflict
+		}
+		httpapi.WriteError(w, status, err)
+		return
+	}
+	stem, err := s.StemManager.FetchStemInfo(key)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, newStemResponse(stem))
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_UpdateStemConfig(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	key := storage.StemKey{Name: "billing", Version: "1.0.0"}
+	mockStemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "billing", Version: "1.0.0", WorkingURL: "/payments"}, nil)
+	config := models.StemConfig{Name: "billing", Version: "1.0.0", URL: "/payments", Command: "./billing", Env: map[string]string{"MODE": "fast"}}
+	mockStemManager.On("UpdateStemConfig", key, config, manager.UpdateOptions{RollLeafs: true}).Return(nil).Once()
+	mockStemManager.On("UpdateStemConfig", key, config, manager.UpdateOptions{}).Return(manager.ErrMaintenance).Once()
+
+	// The name and version come from the path
+	body := "url: /payments\ncommand: ./billing\nenv:\n  MODE: fast\n"
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/config?roll=true", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"url":"/payments"`)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/config", strings.NewReader(body)))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/config", strings.NewReader("name: payments\n")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/config", strings.NewReader("colour: blue\n")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockStemManager.AssertExpectations(t)
+}
@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// maxScaleRequestBytes bounds the body of PUT /stems/{name}/{version}/scale.
+const maxScaleRequestBytes = 1 << 10
+
+// scaleRequest is the body of PUT /stems/{name}/{version}/scale.
+type scaleRequest struct {
+	Replicas *int `json:"replicas"` // Number of running leafs the stem should have
+}
+
+// handleScaleStem serves PUT /stems/{name}/{version}/scale, starting or stopping leafs until the stem runs
+// the requested number.
+func (s *Server) handleScaleStem(w http.ResponseWriter, r *http.Request) {
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+	if _, err := s.StemManager.FetchStemInfo(key); err != nil {
+		httpapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var request scaleRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxScaleRequestBytes)).Decode(&request); err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid scale request: %v", err))
+		return
+	}
+	if request.Replicas == nil {
+		httpapi.WriteError(w, http.StatusBadRequest, errors.New("invalid scale request: replicas is required"))
+		return
+	}
+	started := time.Now()
+	err := s.StemManager.Scale(key, *request.Replicas)
+	s.recordDeployment(r, models.DeploymentScale, key, map[string]string{"replicas": strconv.Itoa(*request.Replicas)}, started, err)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, manager.ErrScaleOutOfRange):
+			status = http.StatusBadRequest
+		case errors.Is(err, repos.ErrConflict):
+			status = http.StatusConflict
+		}
+		httpapi.WriteError(w, status, err)
+		return
+	}
+	stem, err := s.StemManager.FetchStemInfo(key)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, newStemResponse(stem))
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_ScaleStem(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	key := storage.StemKey{Name: "billing", Version: "1.0.0"}
+	replicas := 3
+	mockStemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "billing", Version: "1.0.0", Replicas: &replicas}, nil)
+	mockStemManager.On("Scale", key, 3).Return(nil).Once()
+	mockStemManager.On("Scale", key, 9).Return(manager.ErrScaleOutOfRange).Once()
+	mockStemManager.On("FetchStemInfo", storage.StemKey{Name: "missing", Version: "1.0.0"}).Return(nil, assert.AnError)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/scale", strings.NewReader(`{"replicas": 3}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"replicas":3`)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/scale", strings.NewReader(`{"replicas": 9}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/scale", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/missing/1.0.0/scale", strings.NewReader(`{"replicas": 1}`)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockStemManager.AssertExpectations(t)
+}
@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// stemVersionResponse is the admin API representation of an entry of a stem's version history.
+type stemVersionResponse struct {
+	Name           string               `json:"name"`
+	Version        string               `json:"version"`
+	Status         models.VersionStatus `json:"status"`
+	RegisteredAt   time.Time            `json:"registeredAt"`
+	UnregisteredAt *time.Time           `json:"unregisteredAt,omitempty"`
+	Registrations  int                  `json:"registrations"`
+	Previous       string               `json:"previous,omitempty"`
+	URL            string               `json:"url,omitempty"`
+	Artifact       string               `json:"artifactDigest,omitempty"`
+	GitCommit      string               `json:"gitCommit,omitempty"`
+	BuildTime      *time.Time           `json:"buildTime,omitempty"`
+	DeployedBy     string               `json:"deployedBy,omitempty"`
+	DeployedAt     *time.Time           `json:"deployedAt,omitempty"`
+}
+
+func newStemVersionResponse(entry *models.StemVersion) stemVersionResponse {
+	resp := stemVersionResponse{
+		Name:          entry.Name,
+		Version:       entry.Version,
+		Status:        entry.Status,
+		RegisteredAt:  entry.RegisteredAt,
+		Registrations: entry.Registrations,
+		Previous:      entry.Previous,
+		Artifact:      entry.Metadata.ArtifactDigest,
+		GitCommit:     entry.Metadata.GitCommit,
+		DeployedBy:    entry.Metadata.DeployedBy,
+	}
+	if entry.Config != nil {
+		resp.URL = entry.Config.URL
+	}
+	if !entry.UnregisteredAt.IsZero() {
+		resp.UnregisteredAt = &entry.UnregisteredAt
+	}
+	if !entry.Metadata.BuildTime.IsZero() {
+		resp.BuildTime = &entry.Metadata.BuildTime
+	}
+	if !entry.Metadata.DeployedAt.IsZero() {
+		resp.DeployedAt = &entry.Metadata.DeployedAt
+	}
+	return resp
+}
+
+// handleStemVersions serves GET /stems/{name}/versions, listing every version ever registered for the stem,
+// first registered first, for deployment timelines.
+func (s *Server) handleStemVersions(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	history, err := s.StemManager.StemVersions(name)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(history) == 0 {
+		httpapi.WriteError(w, http.StatusNotFound, fmt.Errorf("stem %s was never registered", name))
+		return
+	}
+
+	items := make([]stemVersionResponse, 0, len(history))
+	for _, entry := range history {
+		items = append(items, newStemVersionResponse(entry))
+	}
+	httpapi.WriteJSON(w, http.StatusOK, items)
+}
+
+// handleRollbackStem serves POST /stems/{name}/rollback, returning the stem to the version registered before
+// its newest one, which is unregistered.
+func (s *Server) handleRollbackStem(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	started := time.Now()
+	key, err := s.StemManager.Rollback(name, manager.RegisterOptions{DeployedBy: s.actor(r)})
+	if err != nil {
+		key.Name = name
+	}
+	s.recordDeployment(r, models.DeploymentRollback, key, nil, started, err)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrNoRollback) {
+			status = http.StatusConflict
+		}
+		httpapi.WriteError(w, status, err)
+		return
+	}
+
+	stem, err := s.StemManager.FetchStemInfo(key)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, newStemResponse(stem))
+}
@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_StemVersions(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	registered := time.Date(2026, 10, 1, 6, 30, 0, 0, time.UTC)
+	mockStemManager.On("StemVersions", "billing").Return([]*models.StemVersion{
+		{Name: "billing", Version: "v1", Status: models.VersionUnregistered, RegisteredAt: registered, UnregisteredAt: registered.Add(time.Hour), Registrations: 1},
+		{Name: "billing", Version: "v2", Status: models.VersionActive, RegisteredAt: registered.Add(time.Hour), Registrations: 1, Previous: "v1",
+			Config: &models.StemConfig{URL: "/billing"}, Metadata: models.VersionMetadata{GitCommit: "4f2a9c1", DeployedBy: "alice@laptop"}},
+	}, nil)
+	mockStemManager.On("StemVersions", "missing").Return([]*models.StemVersion{}, nil)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stems/billing/versions", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[
+		{"name": "billing", "version": "v1", "status": "unregistered", "registeredAt": "2026-10-01T06:30:00Z",
+		 "unregisteredAt": "2026-10-01T07:30:00Z", "registrations": 1},
+		{"name": "billing", "version": "v2", "status": "active", "registeredAt": "2026-10-01T07:30:00Z", "registrations": 1,
+		 "previous": "v1", "url": "/billing", "gitCommit": "4f2a9c1", "deployedBy": "alice@laptop"}]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stems/missing/versions", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServer_RollbackStem(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	key := storage.StemKey{Name: "billing", Version: "v1"}
+	mockStemManager.On("Rollback", "billing", manager.RegisterOptions{DeployedBy: "bob@laptop"}).Return(key, nil)
+	mockStemManager.On("Rollback", "reports", manager.RegisterOptions{DeployedBy: "anonymous"}).
+		Return(storage.StemKey{}, fmt.Errorf("%w: version v1 is the first version of stem reports", manager.ErrNoRollback))
+	mockStemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "billing", Version: "v1"}, nil)
+
+	rec := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/stems/billing/rollback", nil)
+	request.Header.Set(ActorHeader, "bob@laptop")
+	server.Handler().ServeHTTP(rec, request)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"version":"v1"`)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/reports/rollback", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "first version")
+	mockStemManager.AssertExpectations(t)
+}
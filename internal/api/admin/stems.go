@@ -0,0 +1,250 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Pagination defaults applied to listing endpoints.
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// stemResponse is the admin API representation of a stem.
+type stemResponse struct {
+	Name        string                `json:"name"`
+	Type        models.StemType       `json:"type"`
+	Version     string                `json:"version"`
+	URL         string                `json:"url"`
+	Backend     string                `json:"backend"`
+	Labels      map[string]string     `json:"labels,omitempty"`
+	LeafCount   int                   `json:"leafCount"`
+	HasGraft    bool                  `json:"hasGraftNode"`
+	Maintenance bool                  `json:"maintenance,omitempty"`
+	Replicas    *int                  `json:"replicas,omitempty"`
+	Split       map[string]int        `json:"trafficSplit,omitempty"`
+	Restarts    int                   `json:"restarts"`
+	LeafStarts  int                   `json:"leafStarts"`
+	ColdStarts  models.ColdStartStats `json:"coldStarts"`
+	Artifact    string                `json:"artifactDigest,omitempty"`
+	GitCommit   string                `json:"gitCommit,omitempty"`
+	BuildTime   *time.Time            `json:"buildTime,omitempty"`
+	DeployedBy  string                `json:"deployedBy,omitempty"`
+	DeployedAt  *time.Time            `json:"deployedAt,omitempty"`
+}
+
+// leafResponse is the admin API representation of a leaf.
+type leafResponse struct {
+	ID            string             `json:"id"`
+	PID           int                `json:"pid"`
+	HAProxyServer string             `json:"haproxyServer"`
+	Port          int                `json:"port"`
+	Status        models.LeafStatus  `json:"status"`
+	Initialized   time.Time          `json:"initialized"`
+	History       []models.LeafStage `json:"history,omitempty"`
+}
+
+// pageResponse wraps a page of items with pagination metadata.
+type pageResponse struct {
+	Items  interface{} `json:"items"`
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+func newStemResponse(stem *models.Stem) stemResponse {
+	resp := stemResponse{
+		Name:        stem.Name,
+		Type:        stem.Type,
+		Version:     stem.Version,
+		URL:         stem.WorkingURL,
+		Backend:     stem.HAProxyBackend,
+		LeafCount:   len(stem.LeafInstances),
+		HasGraft:    stem.GraftNodeLeaf != nil,
+		Maintenance: stem.Maintenance,
+		Replicas:    stem.Replicas,
+		Split:       stem.TrafficSplit,
+		Restarts:    stem.Restarts,
+		LeafStarts:  stem.LeafStarts,
+		ColdStarts:  stem.ColdStarts,
+		Artifact:    stem.Metadata.ArtifactDigest,
+		GitCommit:   stem.Metadata.GitCommit,
+		DeployedBy:  stem.Metadata.DeployedBy,
+	}
+	if stem.Config != nil {
+		resp.Labels = stem.Config.Labels
+	}
+	if !stem.Metadata.BuildTime.IsZero() {
+		resp.BuildTime = &stem.Metadata.BuildTime
+	}
+	if !stem.Metadata.DeployedAt.IsZero() {
+		resp.DeployedAt = &stem.Metadata.DeployedAt
+	}
+	return resp
+}
+
+func newLeafResponse(leaf *models.Leaf) leafResponse {
+	return leafResponse{
+		ID:            leaf.ID,
+		PID:           leaf.PID,
+		HAProxyServer: leaf.HAProxyServer,
+		Port:          leaf.Port,
+		Status:        leaf.Status,
+		Initialized:   leaf.Initialized,
+		History:       leaf.History,
+	}
+}
+
+// handleListStems serves GET /stems.
+//
+// Supported query parameters: type, version, status (leaf status), label (key=value, repeatable),
+// sort (name, version, type), order (asc, desc), offset, and limit.
+func (s *Server) handleListStems(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	offset, limit, err := parsePagination(params)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	descending, err := parseOrder(params)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	query := repos.StemQuery{
+		Type:       models.StemType(strings.ToUpper(params.Get("type"))),
+		Version:    params.Get("version"),
+		LeafStatus: models.LeafStatus(strings.ToUpper(params.Get("status"))),
+		Descending: descending,
+		Offset:     offset,
+		Limit:      limit,
+	}
+
+	switch sortBy := repos.StemSortField(params.Get("sort")); sortBy {
+	case "", repos.StemSortByName, repos.StemSortByVersion, repos.StemSortByType:
+		query.SortBy = sortBy
+	default:
+		httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("unsupported sort field %q", sortBy))
+		return
+	}
+
+	for _, label := range params["label"] {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("label filter %q must be in key=value form", label))
+			return
+		}
+		if query.Labels == nil {
+			query.Labels = make(map[string]string)
+		}
+		query.Labels[key] = value
+	}
+
+	stems, total, err := s.StemManager.ListStems(query)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]stemResponse, 0, len(stems))
+	for _, stem := range stems {
+		items = append(items, newStemResponse(stem))
+	}
+	httpapi.WriteJSON(w, http.StatusOK, pageResponse{Items: items, Total: total, Offset: offset, Limit: limit})
+}
+
+// handleListLeafs serves GET /stems/{name}/{version}/leafs.
+//
+// Supported query parameters: status, sort (id, initialized, port), order (asc, desc), offset, and limit.
+func (s *Server) handleListLeafs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+
+	offset, limit, err := parsePagination(params)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	descending, err := parseOrder(params)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	query := repos.LeafQuery{
+		Status:     models.LeafStatus(strings.ToUpper(params.Get("status"))),
+		Descending: descending,
+		Offset:     offset,
+		Limit:      limit,
+	}
+
+	switch sortBy := repos.LeafSortField(params.Get("sort")); sortBy {
+	case "", repos.LeafSortByID, repos.LeafSortByInitialized, repos.LeafSortByPort:
+		query.SortBy = sortBy
+	default:
+		httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("unsupported sort field %q", sortBy))
+		return
+	}
+
+	if _, err := s.StemManager.FetchStemInfo(key); err != nil {
+		httpapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	leafs, total, err := s.LeafManager.ListLeafs(key, query)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]leafResponse, 0, len(leafs))
+	for _, leaf := range leafs {
+		items = append(items, newLeafResponse(leaf))
+	}
+	httpapi.WriteJSON(w, http.StatusOK, pageResponse{Items: items, Total: total, Offset: offset, Limit: limit})
+}
+
+// parsePagination reads offset and limit, applying DefaultPageLimit and capping at MaxPageLimit.
+func parsePagination(params url.Values) (offset, limit int, err error) {
+	limit = DefaultPageLimit
+	if raw := params.Get("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	if raw := params.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("limit must be a positive integer")
+		}
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+	return offset, limit, nil
+}
+
+// parseOrder reads the sort order, returning true for descending.
+func parseOrder(params url.Values) (bool, error) {
+	switch params.Get("order") {
+	case "", "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	default:
+		return false, fmt.Errorf("order must be asc or desc")
+	}
+}
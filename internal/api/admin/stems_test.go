@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_ListStems(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	expectedQuery := repos.StemQuery{
+		Type:       models.StemTypeDeployment,
+		Labels:     map[string]string{"team": "core"},
+		SortBy:     repos.StemSortByVersion,
+		Descending: true,
+		Offset:     10,
+		Limit:      5,
+	}
+	mockStemManager.On("ListStems", expectedQuery).Return([]*models.Stem{
+		{
+			Name:           "hello-service",
+			Type:           models.StemTypeDeployment,
+			Version:        "v1.1",
+			WorkingURL:     "/hello",
+			HAProxyBackend: "hello",
+			LeafInstances:  map[string]*models.Leaf{"leaf-1": {ID: "leaf-1"}},
+		},
+	}, 11, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/stems?type=deployment&label=team=core&sort=version&order=desc&offset=10&limit=5", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Items []stemResponse `json:"items"`
+		Total int            `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, 11, body.Total)
+	assert.Len(t, body.Items, 1)
+	assert.Equal(t, "hello-service", body.Items[0].Name)
+	assert.Equal(t, 1, body.Items[0].LeafCount)
+
+	mockStemManager.AssertExpectations(t)
+}
+
+func TestServer_ListStems_InvalidParameters(t *testing.T) {
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	for _, query := range []string{"limit=0", "offset=-1", "sort=color", "order=sideways", "label=broken"} {
+		req := httptest.NewRequest(http.MethodGet, "/stems?"+query, nil)
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "expected bad request for %s", query)
+	}
+}
+
+func TestServer_ListLeafs(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockLeafManager := new(manager.MockLeafManager)
+	server := NewServer("", "", mockStemManager, mockLeafManager, new(manager.MockSnapshotManager), nil)
+
+	stemKey := storage.StemKey{Name: "hello-service", Version: "v1.1"}
+	mockStemManager.On("FetchStemInfo", stemKey).Return(&models.Stem{Name: stemKey.Name, Version: stemKey.Version}, nil)
+	mockLeafManager.On("ListLeafs", stemKey, repos.LeafQuery{Status: models.StatusRunning, Limit: DefaultPageLimit}).
+		Return([]*models.Leaf{{ID: "leaf-1", Port: 8000, Status: models.StatusRunning}}, 1, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/stems/hello-service/v1.1/leafs?status=running", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"id":"leaf-1"`)
+
+	// Unknown stem
+	unknownKey := storage.StemKey{Name: "missing", Version: "v1"}
+	mockStemManager.On("FetchStemInfo", unknownKey).Return(nil, errors.New("stem missing with version v1 not found"))
+
+	req = httptest.NewRequest(http.MethodGet, "/stems/missing/v1/leafs", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestClient_ListStems(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockLeafManager := new(manager.MockLeafManager)
+	server := httptest.NewServer(NewServer("", "", mockStemManager, mockLeafManager, new(manager.MockSnapshotManager), nil).Handler())
+	defer server.Close()
+
+	key := storage.StemKey{Name: "billing", Version: "1.0.0"}
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stem := &models.Stem{Name: "billing", Version: "1.0.0", Type: models.StemTypeDeployment, Restarts: 2,
+		Metadata: models.VersionMetadata{GitCommit: "4f2a9c1", DeployedBy: "alice@laptop", DeployedAt: started}}
+	leaf := &models.Leaf{ID: "billing-1", PID: 4242, Port: 8001, Status: models.StatusRunning, Initialized: started}
+	mockStemManager.On("ListStems", repos.StemQuery{Offset: 0, Limit: MaxPageLimit}).Return([]*models.Stem{stem}, 1, nil)
+	mockStemManager.On("FetchStemInfo", key).Return(stem, nil)
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{Offset: 0, Limit: MaxPageLimit}).Return([]*models.Leaf{leaf}, 1, nil)
+	mockStemManager.On("FetchStemInfo", storage.StemKey{Name: "missing", Version: "1.0.0"}).Return(nil, assert.AnError)
+
+	stems, err := client.NewClient(server.URL, "").ListStems()
+	assert.NoError(t, err)
+	assert.Equal(t, []client.StemSummary{{
+		Name:       "billing",
+		Type:       models.StemTypeDeployment,
+		Version:    "1.0.0",
+		Restarts:   2,
+		GitCommit:  "4f2a9c1",
+		DeployedBy: "alice@laptop",
+		DeployedAt: started,
+		Leafs:      []client.LeafSummary{{ID: "billing-1", PID: 4242, Port: 8001, Status: models.StatusRunning, Initialized: started}},
+	}}, stems)
+
+	_, err = client.NewClient(server.URL, "").ListLeafs("missing", "1.0.0")
+	assert.ErrorContains(t, err, "failed to list leafs, status code: 404")
+}
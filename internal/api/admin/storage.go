@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// StorageInspector reports the size and lock contention of the state storage.
+type StorageInspector interface {
+	Stats() storage.Stats
+}
+
+// storageResponse is the admin API representation of the state storage's size and lock contention.
+type storageResponse struct {
+	Stems           int     `json:"stems"`
+	Leafs           int     `json:"leafs"`
+	GraftNodes      int     `json:"graftNodes"`
+	Nodes           int     `json:"nodes"`
+	JournalEntries  uint64  `json:"journalEntries"`
+	JournalBytes    int64   `json:"journalBytes"`
+	LockWaits       uint64  `json:"lockWaits"`
+	LockWaitSeconds float64 `json:"lockWaitSeconds"`
+}
+
+// handleStorage serves GET /storage, counting the stems, leafs, graft nodes, and nodes held in storage,
+// with the size of the journal and the time spent waiting for storage locks since startup.
+func (s *Server) handleStorage(w http.ResponseWriter, r *http.Request) {
+	if s.Storage == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("storage is not inspected"))
+		return
+	}
+	stats := s.Storage.Stats()
+	httpapi.WriteJSON(w, http.StatusOK, storageResponse{
+		Stems:           stats.Stems,
+		Leafs:           stats.Leafs,
+		GraftNodes:      stats.GraftNodes,
+		Nodes:           stats.Nodes,
+		JournalEntries:  stats.JournalEntries,
+		JournalBytes:    stats.JournalBytes,
+		LockWaits:       stats.LockWaits,
+		LockWaitSeconds: stats.LockWaitTime.Seconds(),
+	})
+}
@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Storage(t *testing.T) {
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/storage", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	server.Storage = storage.GetTestStorage()
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	stats, err := client.NewClient(httpServer.URL, "").Storage()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Stems)
+	assert.Equal(t, 2, stats.Leafs)
+	assert.Equal(t, 1, stats.GraftNodes)
+	assert.Zero(t, stats.JournalEntries)
+	assert.Zero(t, stats.LockWaits)
+}
@@ -0,0 +1,18 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+)
+
+// handleSweep serves POST /sweep, reclaiming orphaned leafs, proxy servers, and ports right away instead of
+// at the next scheduled sweep, and returning what was reclaimed.
+func (s *Server) handleSweep(w http.ResponseWriter, r *http.Request) {
+	if s.Sweeper == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("orphans are not swept"))
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, s.Sweeper.Sweep())
+}
@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// tombstoneResponse is the admin API representation of an unregistered stem's tombstone: the stem as it was
+// when it was removed, with its leafs' last status and history.
+type tombstoneResponse struct {
+	stemResponse
+	Deleted time.Time      `json:"deleted"`
+	Leafs   []leafResponse `json:"leafs"`
+}
+
+func newTombstoneResponse(tombstone *models.Stem) tombstoneResponse {
+	resp := tombstoneResponse{stemResponse: newStemResponse(tombstone), Deleted: tombstone.Deleted, Leafs: []leafResponse{}}
+	for _, leaf := range tombstone.LeafInstances {
+		resp.Leafs = append(resp.Leafs, newLeafResponse(leaf))
+	}
+	sort.Slice(resp.Leafs, func(i, j int) bool { return resp.Leafs[i].ID < resp.Leafs[j].ID })
+	return resp
+}
+
+// handleListTombstones serves GET /tombstones, listing the tombstones of unregistered stems that were not
+// purged yet, oldest deletion first.
+func (s *Server) handleListTombstones(w http.ResponseWriter, r *http.Request) {
+	if s.Janitor == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("tombstones are not kept"))
+		return
+	}
+	tombstones, err := s.Janitor.Tombstones()
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]tombstoneResponse, 0, len(tombstones))
+	for _, tombstone := range tombstones {
+		items = append(items, newTombstoneResponse(tombstone))
+	}
+	httpapi.WriteJSON(w, http.StatusOK, items)
+}
+
+// handleGetTombstone serves GET /tombstones/{name}/{version}. The logs of the leafs it lists stay readable
+// through the stem's leaf logs route until the tombstone is purged.
+func (s *Server) handleGetTombstone(w http.ResponseWriter, r *http.Request) {
+	if s.Janitor == nil {
+		httpapi.WriteError(w, http.StatusNotFound, errors.New("tombstones are not kept"))
+		return
+	}
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+	tombstone, err := s.Janitor.Tombstone(key)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, newTombstoneResponse(tombstone))
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/client"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Tombstones(t *testing.T) {
+	server := NewServer("", "", new(manager.MockStemManager), new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tombstones", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	deleted := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}, Tombstones: map[storage.StemKey]*models.Stem{
+		{Name: "api", Version: "v1"}: {Name: "api", Version: "v1", Restarts: 2, Deleted: deleted,
+			LeafInstances: map[string]*models.Leaf{"api-1": {ID: "api-1", Status: models.StatusRunning,
+				History: []models.LeafStage{{Stage: "start", Status: models.StatusStarting}}}}},
+	}}
+	server.Janitor = manager.NewJanitor(repos.NewStemRepository(db), time.Hour)
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+	c := client.NewClient(httpServer.URL, "")
+
+	tombstones, err := c.ListTombstones()
+	assert.NoError(t, err)
+	if assert.Len(t, tombstones, 1) {
+		assert.Equal(t, "api", tombstones[0].Name)
+		assert.Equal(t, 2, tombstones[0].Restarts)
+		assert.True(t, tombstones[0].Deleted.Equal(deleted))
+	}
+
+	tombstone, err := c.GetTombstone("api", "v1")
+	assert.NoError(t, err)
+	if assert.Len(t, tombstone.Leafs, 1) {
+		assert.Equal(t, models.StatusRunning, tombstone.Leafs[0].Status)
+		assert.Len(t, tombstone.Leafs[0].History, 1)
+	}
+
+	_, err = c.GetTombstone("web", "v1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+)
+
+// maxTrafficSplitRequestBytes bounds the body of PUT /stems/{name}/{version}/traffic-split.
+const maxTrafficSplitRequestBytes = 4 << 10
+
+// trafficSplitRequest is the body of PUT /stems/{name}/{version}/traffic-split.
+type trafficSplitRequest struct {
+	Split map[string]int `json:"split"` // Percent of the stem's requests each version gets
+}
+
+// handleSetTrafficSplit serves PUT /stems/{name}/{version}/traffic-split, sharing the requests to the stem's
+// backend between versions of the stem.
+func (s *Server) handleSetTrafficSplit(w http.ResponseWriter, r *http.Request) {
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+	if _, err := s.StemManager.FetchStemInfo(key); err != nil {
+		httpapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var request trafficSplitRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTrafficSplitRequestBytes)).Decode(&request); err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid traffic split request: %v", err))
+		return
+	}
+	if len(request.Split) == 0 {
+		httpapi.WriteError(w, http.StatusBadRequest, errors.New("invalid traffic split request: split is required"))
+		return
+	}
+	if err := s.StemManager.SetTrafficSplit(key, request.Split); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, manager.ErrInvalidSplit):
+			status = http.StatusBadRequest
+		case errors.Is(err, repos.ErrConflict):
+			status = http.StatusConflict
+		}
+		httpapi.WriteError(w, status, err)
+		return
+	}
+	stem, err := s.StemManager.FetchStemInfo(key)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, newStemResponse(stem))
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_SetTrafficSplit(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := NewServer("", "", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+
+	key := storage.StemKey{Name: "billing", Version: "1.0.0"}
+	split := map[string]int{"1.0.0": 90, "1.1.0": 10}
+	mockStemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "billing", Version: "1.0.0", TrafficSplit: split}, nil)
+	mockStemManager.On("SetTrafficSplit", key, split).Return(nil).Once()
+	mockStemManager.On("SetTrafficSplit", key, map[string]int{"1.0.0": 90}).Return(manager.ErrInvalidSplit).Once()
+	mockStemManager.On("FetchStemInfo", storage.StemKey{Name: "missing", Version: "1.0.0"}).Return(nil, assert.AnError)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/traffic-split",
+		strings.NewReader(`{"split": {"1.0.0": 90, "1.1.0": 10}}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"trafficSplit":{"1.0.0":90,"1.1.0":10}`)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/traffic-split", strings.NewReader(`{"split": {"1.0.0": 90}}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/billing/1.0.0/traffic-split", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/stems/missing/1.0.0/traffic-split", strings.NewReader(`{"split": {"1.0.0": 100}}`)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockStemManager.AssertExpectations(t)
+}
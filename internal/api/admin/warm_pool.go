@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/httpapi"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// promoteResponse names the standby leaf that was promoted.
+type promoteResponse struct {
+	LeafID string `json:"leafId"`
+}
+
+// handlePromoteLeaf serves POST /stems/{name}/{version}/leafs/promote, binding a standby leaf of the stem's
+// warm pool to the proxy. Autoscalers call it to add capacity without a cold start.
+func (s *Server) handlePromoteLeaf(w http.ResponseWriter, r *http.Request) {
+	key := storage.StemKey{Name: r.PathValue("name"), Version: r.PathValue("version")}
+	if _, err := s.StemManager.FetchStemInfo(key); err != nil {
+		httpapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	leafID, err := s.LeafManager.PromoteStandbyLeaf(key.Name, key.Version, nil)
+	switch {
+	case errors.Is(err, manager.ErrNoStandbyLeaf):
+		httpapi.WriteError(w, http.StatusConflict, err)
+	case err != nil:
+		httpapi.WriteError(w, http.StatusInternalServerError, err)
+	default:
+		httpapi.WriteJSON(w, http.StatusOK, promoteResponse{LeafID: leafID})
+	}
+}
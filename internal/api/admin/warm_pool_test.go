@@ -0,0 +1,38 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_PromoteLeaf(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	mockLeafManager := new(manager.MockLeafManager)
+	server := NewServer("", "", mockStemManager, mockLeafManager, new(manager.MockSnapshotManager), nil)
+
+	key := storage.StemKey{Name: "checkout", Version: "1.0.0"}
+	mockStemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "checkout", Version: "1.0.0"}, nil)
+	mockStemManager.On("FetchStemInfo", storage.StemKey{Name: "missing", Version: "1.0.0"}).Return(nil, errors.New("stem missing with version 1.0.0 not found"))
+	mockLeafManager.On("PromoteStandbyLeaf", "checkout", "1.0.0", (*string)(nil)).Return("checkout-1.0.0-1", nil).Once()
+	mockLeafManager.On("PromoteStandbyLeaf", "checkout", "1.0.0", (*string)(nil)).Return("", manager.ErrNoStandbyLeaf)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/checkout/1.0.0/leafs/promote", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"leafId":"checkout-1.0.0-1"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/checkout/1.0.0/leafs/promote", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code, "an empty warm pool is a conflict, not a failure")
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stems/missing/1.0.0/leafs/promote", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,57 @@
+// Package httpapi holds what herbarium's HTTP APIs with JSON payloads share: the admin API and the agent API.
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LogFollowInterval is how often a followed log is checked for new output.
+const LogFollowInterval = 500 * time.Millisecond
+
+// ErrorResponse is the JSON body returned for failed requests.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// WriteJSON encodes body as JSON with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode API response: %v", err)
+	}
+}
+
+// WriteError writes an ErrorResponse with the given status code.
+func WriteError(w http.ResponseWriter, status int, err error) {
+	WriteJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+// RequireAPIKey rejects requests that present neither apiKey in header nor as a bearer token. Requests public
+// reports true for are let through without one; public may be nil. An empty apiKey lets every request through.
+func RequireAPIKey(apiKey, header string, public func(r *http.Request) bool, next http.Handler) http.Handler {
+	if apiKey == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if public != nil && public(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		presented := r.Header.Get(header)
+		if presented == "" {
+			presented = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(apiKey)) != 1 {
+			WriteError(w, http.StatusUnauthorized, errors.New("missing or invalid API key"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	public := func(r *http.Request) bool { return r.URL.Path == "/docs" }
+	handler := RequireAPIKey("secret", "X-API-Key", public, next)
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		header string
+		value  string
+		status int
+	}{
+		{"no key", "/stems", "", "", http.StatusUnauthorized},
+		{"wrong key", "/stems", "X-API-Key", "guess", http.StatusUnauthorized},
+		{"key header", "/stems", "X-API-Key", "secret", http.StatusNoContent},
+		{"bearer token", "/stems", "Authorization", "Bearer secret", http.StatusNoContent},
+		{"public request", "/docs", "", "", http.StatusNoContent},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.status, rec.Code)
+			if tc.status == http.StatusUnauthorized {
+				var body ErrorResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+				assert.Equal(t, "missing or invalid API key", body.Error)
+			}
+		})
+	}
+
+	// Without a key every request is let through
+	rec := httptest.NewRecorder()
+	RequireAPIKey("", "X-API-Key", nil, next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stems", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,630 @@
+// Package embeddedproxy implements proxy.ProxyClient with a reverse proxy running inside herbarium,
+// for installations without an external load balancer. HTTP backends are routed by path, UDP backends
+// are published on their own port.
+package embeddedproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// Defaults used when the config leaves a setting empty.
+const (
+	DefaultListenAddress       = ":8080"
+	DefaultHealthCheckInterval = 5 * time.Second
+)
+
+// healthCheckTimeout bounds a single health check request.
+const healthCheckTimeout = 2 * time.Second
+
+// Mirrored requests are sent in the background, bounded in size and time so a slow shadow backend can't hold
+// up or exhaust the proxy.
+const (
+	maxMirroredBody = 1 << 20
+	mirrorTimeout   = 30 * time.Second
+)
+
+// latencySmoothing is the inverse weight of a new response in a server's moving average response time, so
+// the average follows roughly the last few dozen requests.
+const latencySmoothing = 8
+
+// EmbeddedConfig configures the embedded proxy.
+type EmbeddedConfig struct {
+	ListenAddress       string        // Address the proxy listens on, defaults to DefaultListenAddress
+	HealthCheckInterval time.Duration // Interval between active health checks, defaults to DefaultHealthCheckInterval
+}
+
+// server is a leaf behind a backend.
+type server struct {
+	name     string
+	target   *url.URL
+	healthy  atomic.Bool
+	requests atomic.Int64 // Requests proxied to the server since it was bound
+	active   atomic.Int64 // Requests being proxied to the server right now
+	draining atomic.Bool  // Whether the server gets no new requests
+	latency  atomic.Int64 // Moving average response time in nanoseconds, 0 before the first response
+}
+
+// addHeaders adds the CORS headers of a backend to the headers of a response to an allowed origin, and its
+// security headers to the headers of every response.
+func addHeaders(headers http.Header, options proxy.BackendOptions, origin string) {
+	if cors := options.CORS; cors != nil && cors.AllowsOrigin(origin) {
+		for _, header := range cors.Headers(origin) {
+			if header.Name == "Vary" { // Keeps the server's Vary
+				headers.Add(header.Name, header.Value)
+			} else {
+				headers.Set(header.Name, header.Value)
+			}
+		}
+	}
+	if options.SecurityHeaders {
+		for _, header := range proxy.SecurityHeaders {
+			headers.Set(header.Name, header.Value)
+		}
+	}
+}
+
+// route is the host and path requests are routed to a backend by, an empty host matching any.
+type route struct {
+	host string
+	path string
+}
+
+// backend balances requests under its route path across its servers.
+type backend struct {
+	servers     []*server
+	next        atomic.Uint64
+	maintenance atomic.Pointer[string] // Page answering every request while in maintenance, nil otherwise
+}
+
+// EmbeddedProxy routes requests by their host and path to the backend bound last for them, /<name> unless the
+// backend options give a path, and balances them round-robin across the servers that passed their last health check.
+type EmbeddedProxy struct {
+	config     EmbeddedConfig
+	httpServer *http.Server
+	client     *http.Client
+	stop       chan struct{}
+	stopOnce   sync.Once
+
+	mu       sync.RWMutex
+	backends map[string]*backend
+	routes   map[route]string                // Backend names by the host and path they serve
+	options  map[string]proxy.BackendOptions // Options of the backends by name, for rewriting request paths
+	udp      map[string]*udpForwarder        // UDP backends by name, not routed or health checked over HTTP
+}
+
+// NewEmbeddedProxy creates an embedded proxy. Call Start to begin serving and health checking.
+func NewEmbeddedProxy(config EmbeddedConfig) *EmbeddedProxy {
+	if config.ListenAddress == "" {
+		config.ListenAddress = DefaultListenAddress
+	}
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	p := &EmbeddedProxy{
+		config:   config,
+		client:   &http.Client{Timeout: healthCheckTimeout},
+		stop:     make(chan struct{}),
+		backends: make(map[string]*backend),
+		routes:   make(map[route]string),
+		options:  make(map[string]proxy.BackendOptions),
+		udp:      make(map[string]*udpForwarder),
+	}
+	p.httpServer = &http.Server{Addr: config.ListenAddress, Handler: p}
+	return p
+}
+
+// Start binds the listen address, then serves requests and checks server health in the background.
+func (p *EmbeddedProxy) Start() error {
+	listener, err := net.Listen("tcp", p.config.ListenAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", p.config.ListenAddress, err)
+	}
+	go func() {
+		log.Printf("Embedded proxy listening on %s", listener.Addr())
+		if err := p.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Embedded proxy stopped with error: %v", err)
+		}
+	}()
+	go p.healthCheckLoop()
+	return nil
+}
+
+// Close stops health checking and serving.
+func (p *EmbeddedProxy) Close() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.mu.Lock()
+	for name, forwarder := range p.udp {
+		forwarder.Close()
+		delete(p.udp, name)
+	}
+	p.mu.Unlock()
+	return p.httpServer.Close()
+}
+
+// BindStem creates an empty backend for a stem, replacing any existing one. HTTP backends must use HTTP/1.1
+// with HTTP health checks; UDP backends start listening on their port right away.
+func (p *EmbeddedProxy) BindStem(backendName string, options proxy.BackendOptions) error {
+	if options.Protocol != "" && options.Protocol != proxy.ProtocolHTTP {
+		return fmt.Errorf("protocol %s is not supported by the embedded proxy", options.Protocol)
+	}
+	if options.HealthCheck != "" && options.HealthCheck != proxy.HealthCheckHTTP {
+		return fmt.Errorf("health check %s is not supported by the embedded proxy", options.HealthCheck)
+	}
+	if options.IsUDP() && options.ListenPort <= 0 {
+		return fmt.Errorf("UDP backend %s needs a listen port", backendName)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if forwarder, ok := p.udp[backendName]; ok {
+		forwarder.Close()
+		delete(p.udp, backendName)
+	}
+	p.backends[backendName] = &backend{}
+	p.options[backendName] = options
+	p.unroute(backendName)
+	if !options.IsUDP() && !options.Shadow {
+		p.routes[route{host: strings.ToLower(options.Host), path: options.RoutePath(backendName)}] = backendName
+	}
+	if options.IsUDP() {
+		forwarder, err := listenUDP(backendName, options.ListenPort, func() *backend {
+			p.mu.RLock()
+			defer p.mu.RUnlock()
+			return p.backends[backendName]
+		})
+		if err != nil {
+			delete(p.backends, backendName)
+			delete(p.options, backendName)
+			return err
+		}
+		p.udp[backendName] = forwarder
+	}
+	return nil
+}
+
+// BindLeaf adds a leaf's server to a backend, replacing a server of the same name.
+func (p *EmbeddedProxy) BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.backends[backendName]
+	if !ok {
+		return fmt.Errorf("backend %s not found", backendName)
+	}
+	servers, _ := withoutServer(b.servers, leafID)
+	p.backends[backendName] = &backend{servers: append(servers, newServer(leafID, serviceAddress, servicePort))}
+	return nil
+}
+
+// UnbindLeaf removes a leaf's server from a backend.
+func (p *EmbeddedProxy) UnbindLeaf(backendName, serverName string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.backends[backendName]
+	if !ok {
+		return fmt.Errorf("backend %s not found", backendName)
+	}
+	servers, found := withoutServer(b.servers, serverName)
+	if !found {
+		return fmt.Errorf("server %s not found in backend %s", serverName, backendName)
+	}
+	p.backends[backendName] = &backend{servers: servers}
+	return nil
+}
+
+// ReplaceLeaf swaps one server for another, so requests never see the backend without either.
+func (p *EmbeddedProxy) ReplaceLeaf(backendName, oldServerName, newServerName, serviceAddress string, servicePort int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.backends[backendName]
+	if !ok {
+		return fmt.Errorf("backend %s not found", backendName)
+	}
+	servers, found := withoutServer(b.servers, oldServerName)
+	if !found {
+		return fmt.Errorf("server %s not found in backend %s", oldServerName, backendName)
+	}
+	p.backends[backendName] = &backend{servers: append(servers, newServer(newServerName, serviceAddress, servicePort))}
+	return nil
+}
+
+// UnbindStem removes a stem's backend.
+func (p *EmbeddedProxy) UnbindStem(backendName string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.backends, backendName)
+	delete(p.options, backendName)
+	p.unroute(backendName)
+	if forwarder, ok := p.udp[backendName]; ok {
+		forwarder.Close()
+		delete(p.udp, backendName)
+	}
+	return nil
+}
+
+// unroute removes the paths routed to a backend. The caller must hold p.mu.
+func (p *EmbeddedProxy) unroute(backendName string) {
+	for r, name := range p.routes {
+		if name == backendName {
+			delete(p.routes, r)
+		}
+	}
+}
+
+// RequestCounts returns how many requests each server of a backend was picked for since it was bound.
+func (p *EmbeddedProxy) RequestCounts(backendName string) (map[string]int64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	b, ok := p.backends[backendName]
+	if !ok {
+		return nil, fmt.Errorf("backend %s not found", backendName)
+	}
+	counts := make(map[string]int64, len(b.servers))
+	for _, s := range b.servers {
+		counts[s.name] = s.requests.Load()
+	}
+	return counts, nil
+}
+
+// ResponseTimes returns the moving average response time of each server of a backend that responded since
+// it was bound.
+func (p *EmbeddedProxy) ResponseTimes(backendName string) (map[string]time.Duration, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	b, ok := p.backends[backendName]
+	if !ok {
+		return nil, fmt.Errorf("backend %s not found", backendName)
+	}
+	times := make(map[string]time.Duration, len(b.servers))
+	for _, s := range b.servers {
+		if latency := s.latency.Load(); latency > 0 {
+			times[s.name] = time.Duration(latency)
+		}
+	}
+	return times, nil
+}
+
+// DrainServer sends a server no new requests while the requests it is handling finish.
+func (p *EmbeddedProxy) DrainServer(backendName, serverName string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	b, ok := p.backends[backendName]
+	if !ok {
+		return fmt.Errorf("backend %s not found", backendName)
+	}
+	for _, s := range b.servers {
+		if s.name == serverName {
+			s.draining.Store(true)
+			return nil
+		}
+	}
+	return fmt.Errorf("server %s not found in backend %s", serverName, backendName)
+}
+
+// Servers returns the names of a backend's servers.
+func (p *EmbeddedProxy) Servers(backendName string) ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	b, ok := p.backends[backendName]
+	if !ok {
+		return nil, fmt.Errorf("backend %s not found", backendName)
+	}
+	names := make([]string, 0, len(b.servers))
+	for _, s := range b.servers {
+		names = append(names, s.name)
+	}
+	return names, nil
+}
+
+// Backends returns the names of the backends.
+func (p *EmbeddedProxy) Backends() ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.backends))
+	for name := range p.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// OwnedBackends returns the names of the backends, all of which herbarium created.
+func (p *EmbeddedProxy) OwnedBackends() ([]string, error) {
+	return p.Backends()
+}
+
+// ActiveSessions returns the requests being proxied to each server of a backend.
+func (p *EmbeddedProxy) ActiveSessions(backendName string) (map[string]int64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	b, ok := p.backends[backendName]
+	if !ok {
+		return nil, fmt.Errorf("backend %s not found", backendName)
+	}
+	sessions := make(map[string]int64, len(b.servers))
+	for _, s := range b.servers {
+		sessions[s.name] = s.active.Load()
+	}
+	return sessions, nil
+}
+
+// EnterMaintenance answers every request to the backends with 503 and the page. Backends that don't exist
+// are skipped.
+func (p *EmbeddedProxy) EnterMaintenance(backendNames []string, page string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range backendNames {
+		if b, ok := p.backends[name]; ok {
+			b.maintenance.Store(&page)
+		}
+	}
+	return nil
+}
+
+// ExitMaintenance routes requests to the backends' servers again.
+func (p *EmbeddedProxy) ExitMaintenance(backendNames []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range backendNames {
+		if b, ok := p.backends[name]; ok {
+			b.maintenance.Store(nil)
+		}
+	}
+	return nil
+}
+
+// SetBackendMaintenance answers every request to the backend with 503 and the page, or routes requests to
+// its servers again.
+func (p *EmbeddedProxy) SetBackendMaintenance(backendName string, enabled bool, page string) error {
+	if enabled {
+		return p.EnterMaintenance([]string{backendName}, page)
+	}
+	return p.ExitMaintenance([]string{backendName})
+}
+
+// ServeHTTP proxies a request to a healthy server of the backend matching its path.
+func (p *EmbeddedProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, b, options := p.route(r.Host, r.URL.Path)
+	if b == nil {
+		http.Error(w, "no backend for path", http.StatusNotFound)
+		return
+	}
+	if page := b.maintenance.Load(); page != nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, *page)
+		return
+	}
+	origin := r.Header.Get("Origin")
+	if cors := options.CORS; cors != nil && r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" && cors.AllowsOrigin(origin) {
+		for _, header := range cors.PreflightHeaders(origin) {
+			w.Header().Set(header.Name, header.Value)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	target := b.pick()
+	if target == nil {
+		http.Error(w, fmt.Sprintf("no healthy servers for backend %s", name), http.StatusServiceUnavailable)
+		return
+	}
+
+	if options.Rewrite != "" {
+		r.URL.Path = options.RewritePath(name, r.URL.Path)
+		r.URL.RawPath = ""
+	}
+	if mirror := options.Mirror; mirror != nil && rand.Intn(100) < mirror.Percent {
+		p.mirror(r, mirror.Backend)
+	}
+	target.requests.Add(1)
+	target.active.Add(1)
+	defer target.active.Add(-1)
+	reverseProxy := httputil.NewSingleHostReverseProxy(target.target)
+	reverseProxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// Take the server out of rotation until the next health check succeeds
+		if target.healthy.Swap(false) {
+			log.Printf("Embedded proxy marked server %s of backend %s down: %v", target.name, name, err)
+		}
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}
+	reverseProxy.ModifyResponse = func(resp *http.Response) error {
+		addHeaders(resp.Header, options, origin)
+		return nil
+	}
+	start := time.Now()
+	reverseProxy.ServeHTTP(w, r)
+	target.observe(time.Since(start))
+}
+
+// mirror sends a copy of a request to a healthy server of the shadow backend in the background and discards the
+// response. The request's body is read ahead to be copied, requests with bodies over maxMirroredBody aren't
+// mirrored.
+func (p *EmbeddedProxy) mirror(r *http.Request, backendName string) {
+	p.mu.RLock()
+	b := p.backends[backendName]
+	p.mu.RUnlock()
+	if b == nil {
+		return
+	}
+	target := b.pick()
+	if target == nil {
+		return
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		read, err := io.ReadAll(io.LimitReader(r.Body, maxMirroredBody+1))
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(read), r.Body), r.Body}
+		if err != nil || len(read) > maxMirroredBody {
+			return
+		}
+		body = read
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	copied := r.Clone(ctx)
+	copied.RequestURI = ""
+	copied.URL.Scheme, copied.URL.Host = target.target.Scheme, target.target.Host
+	copied.Body, copied.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+	target.requests.Add(1)
+	go func() {
+		defer cancel()
+		resp, err := http.DefaultTransport.RoundTrip(copied)
+		if err != nil {
+			log.Printf("Failed to mirror request to server %s of backend %s: %v", target.name, backendName, err)
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// readCloser reads from Reader and closes Closer, for putting back a body that was partly read ahead.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// route returns the backend whose route path is the longest prefix of path on a segment boundary, with its
+// options. Backends routed by the request's host go before backends for any host.
+func (p *EmbeddedProxy) route(host, path string) (string, *backend, proxy.BackendOptions) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var matchedPath, matched string
+	var matchedHost bool
+	for r, name := range p.routes {
+		if r.host != "" && !p.options[name].MatchesHost(host) {
+			continue
+		}
+		if path != r.path && !strings.HasPrefix(path, r.path+"/") {
+			continue
+		}
+		byHost := r.host != ""
+		if (byHost && !matchedHost) || (byHost == matchedHost && len(r.path) > len(matchedPath)) {
+			matchedPath, matched, matchedHost = r.path, name, byHost
+		}
+	}
+	if matched == "" {
+		return "", nil, proxy.BackendOptions{}
+	}
+	return matched, p.backends[matched], p.options[matched]
+}
+
+// pick returns the next healthy server in round-robin order, or nil when none is healthy.
+func (b *backend) pick() *server {
+	count := uint64(len(b.servers))
+	for i := uint64(0); i < count; i++ {
+		s := b.servers[(b.next.Add(1)-1)%count]
+		if s.healthy.Load() && !s.draining.Load() {
+			return s
+		}
+	}
+	return nil
+}
+
+// healthCheckLoop checks every server at the configured interval until Close is called.
+func (p *EmbeddedProxy) healthCheckLoop() {
+	ticker := time.NewTicker(p.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.CheckHealth()
+		}
+	}
+}
+
+// CheckHealth sends HEAD / to every server of the HTTP backends concurrently. A server is healthy when it
+// answers with a status below 500.
+func (p *EmbeddedProxy) CheckHealth() {
+	p.mu.RLock()
+	type check struct {
+		backend string
+		server  *server
+	}
+	var checks []check
+	for name, b := range p.backends {
+		if _, ok := p.udp[name]; ok {
+			continue
+		}
+		for _, s := range b.servers {
+			checks = append(checks, check{backend: name, server: s})
+		}
+	}
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c check) {
+			defer wg.Done()
+			healthy := false
+			resp, err := p.client.Head(c.server.target.String() + "/")
+			if err == nil {
+				resp.Body.Close()
+				healthy = resp.StatusCode < http.StatusInternalServerError
+			}
+			if c.server.healthy.Swap(healthy) != healthy {
+				log.Printf("Embedded proxy server %s of backend %s is now healthy=%t", c.server.name, c.backend, healthy)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// newServer creates a server that is considered healthy until a check fails.
+func newServer(name, address string, port int) *server {
+	s := &server{
+		name:   name,
+		target: &url.URL{Scheme: "http", Host: net.JoinHostPort(address, fmt.Sprint(port))},
+	}
+	s.healthy.Store(true)
+	return s
+}
+
+// observe folds a response time into the server's moving average.
+func (s *server) observe(elapsed time.Duration) {
+	for {
+		previous := s.latency.Load()
+		next := max(int64(elapsed), 1)
+		if previous > 0 {
+			next = previous + (next-previous)/latencySmoothing
+		}
+		if s.latency.CompareAndSwap(previous, next) {
+			return
+		}
+	}
+}
+
+// withoutServer returns a copy of servers without the named one, and whether it was present. Backends are
+// replaced rather than mutated, so requests in flight keep a consistent server list.
+func withoutServer(servers []*server, name string) ([]*server, bool) {
+	result := make([]*server, 0, len(servers)+1)
+	found := false
+	for _, s := range servers {
+		if s.name == name {
+			found = true
+			continue
+		}
+		result = append(result, s)
+	}
+	return result, found
+}
@@ -0,0 +1,424 @@
+package embeddedproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// startLeaf serves a leaf that answers with its name and the request path.
+func startLeaf(t *testing.T, name string, status int) (string, int) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, name+" "+r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber
+}
+
+func get(t *testing.T, handler http.Handler, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestEmbeddedProxy_RoutesAndBalances(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	host1, port1 := startLeaf(t, "leaf-1", http.StatusOK)
+	host2, port2 := startLeaf(t, "leaf-2", http.StatusOK)
+	host3, port3 := startLeaf(t, "leaf-3", http.StatusOK)
+
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", host1, port1))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-2", host2, port2))
+	assert.NoError(t, p.BindStem("hello-admin", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello-admin", "leaf-3", host3, port3))
+
+	_, first := get(t, p, "/hello/greet")
+	_, second := get(t, p, "/hello/greet")
+	assert.ElementsMatch(t, []string{"leaf-1 /hello/greet", "leaf-2 /hello/greet"}, []string{first, second})
+
+	code, body := get(t, p, "/hello-admin")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "leaf-3 /hello-admin", body)
+
+	code, _ = get(t, p, "/hellox")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	assert.NoError(t, p.ReplaceLeaf("hello", "leaf-1", "leaf-3", host3, port3))
+	assert.NoError(t, p.UnbindLeaf("hello", "leaf-2"))
+	_, body = get(t, p, "/hello")
+	assert.Equal(t, "leaf-3 /hello", body)
+
+	assert.ErrorContains(t, p.UnbindLeaf("hello", "leaf-1"), "server leaf-1 not found in backend hello")
+	assert.ErrorContains(t, p.BindLeaf("missing", "leaf-1", host1, port1), "backend missing not found")
+
+	assert.NoError(t, p.UnbindStem("hello"))
+	code, _ = get(t, p, "/hello")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestEmbeddedProxy_RoutesByPath(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	host1, port1 := startLeaf(t, "leaf-1", http.StatusOK)
+	host2, port2 := startLeaf(t, "leaf-2", http.StatusOK)
+
+	assert.NoError(t, p.BindStem("hello-v1", proxy.BackendOptions{Path: "/hello"}))
+	assert.NoError(t, p.BindLeaf("hello-v1", "leaf-1", host1, port1))
+	_, body := get(t, p, "/hello/greet")
+	assert.Equal(t, "leaf-1 /hello/greet", body)
+	code, _ := get(t, p, "/hello-v1")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// The backend bound last for a path serves it
+	assert.NoError(t, p.BindStem("hello-v2", proxy.BackendOptions{Path: "/hello"}))
+	assert.NoError(t, p.BindLeaf("hello-v2", "leaf-2", host2, port2))
+	_, body = get(t, p, "/hello")
+	assert.Equal(t, "leaf-2 /hello", body)
+
+	owned, err := p.OwnedBackends()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hello-v1", "hello-v2"}, owned)
+
+	assert.NoError(t, p.UnbindStem("hello-v2"))
+	code, _ = get(t, p, "/hello")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestEmbeddedProxy_RoutesByHost(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	host1, port1 := startLeaf(t, "leaf-1", http.StatusOK)
+	host2, port2 := startLeaf(t, "leaf-2", http.StatusOK)
+
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", host1, port1))
+	assert.NoError(t, p.BindStem("api_hello", proxy.BackendOptions{Path: "/hello", Host: "api.example.com"}))
+	assert.NoError(t, p.BindLeaf("api_hello", "leaf-2", host2, port2))
+
+	for host, expected := range map[string]string{
+		"api.example.com":      "leaf-2 /hello",
+		"API.example.com:8080": "leaf-2 /hello",
+		"www.example.com":      "leaf-1 /hello",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		assert.Equal(t, expected, rec.Body.String(), host)
+	}
+}
+
+func TestEmbeddedProxy_RewritesPaths(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	host1, port1 := startLeaf(t, "leaf-1", http.StatusOK)
+	host2, port2 := startLeaf(t, "leaf-2", http.StatusOK)
+
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{Rewrite: "/"}))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", host1, port1))
+	assert.NoError(t, p.BindStem("api", proxy.BackendOptions{Rewrite: "/v1"}))
+	assert.NoError(t, p.BindLeaf("api", "leaf-2", host2, port2))
+
+	_, body := get(t, p, "/hello/greet")
+	assert.Equal(t, "leaf-1 /greet", body)
+	_, body = get(t, p, "/hello")
+	assert.Equal(t, "leaf-1 /", body)
+	_, body = get(t, p, "/api/users")
+	assert.Equal(t, "leaf-2 /v1/users", body)
+}
+
+func TestEmbeddedProxy_CORSAndSecurityHeaders(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	host, port := startLeaf(t, "leaf-1", http.StatusOK)
+	cors := &proxy.CORSPolicy{AllowOrigins: []string{"https://app.example.com"}, AllowHeaders: []string{"Authorization"}, MaxAge: 10 * time.Minute}
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{CORS: cors, SecurityHeaders: true}))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", host, port))
+
+	// Preflight requests from allowed origins are answered by the proxy
+	req := httptest.NewRequest(http.MethodOptions, "/hello", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+
+	req = httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	assert.Equal(t, "leaf-1 /hello", rec.Body.String())
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+
+	// Other origins get no CORS headers
+	req = httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+}
+
+func TestEmbeddedProxy_MirrorsRequests(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	host, port := startLeaf(t, "leaf-1", http.StatusOK)
+	mirrored := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- r.Method + " " + r.URL.Path + " " + string(body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(shadow.Close)
+	shadowHost, shadowPort, _ := net.SplitHostPort(shadow.Listener.Addr().String())
+	shadowPortNumber, _ := strconv.Atoi(shadowPort)
+
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{Mirror: &proxy.Mirror{Backend: "shadow_hello-v2", Percent: 100}}))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", host, port))
+	assert.NoError(t, p.BindStem("shadow_hello-v2", proxy.BackendOptions{Path: "/hello", Shadow: true}))
+	assert.NoError(t, p.BindLeaf("shadow_hello-v2", "shadow-1", shadowHost, shadowPortNumber))
+
+	// The client gets the response of the production leaf, the shadow's is discarded
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/hello/greet", strings.NewReader("hi")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "leaf-1 /hello/greet", rec.Body.String())
+	select {
+	case request := <-mirrored:
+		assert.Equal(t, "POST /hello/greet hi", request)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+}
+
+func TestEmbeddedProxy_CountsRequests(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	host1, port1 := startLeaf(t, "leaf-1", http.StatusOK)
+	host2, port2 := startLeaf(t, "leaf-2", http.StatusOK)
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", host1, port1))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-2", host2, port2))
+
+	for i := 0; i < 3; i++ {
+		get(t, p, "/hello")
+	}
+	counts, err := p.RequestCounts("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), counts["leaf-1"]+counts["leaf-2"])
+
+	// A server bound again under the same name starts counting from zero
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", host1, port1))
+	counts, _ = p.RequestCounts("hello")
+	assert.Equal(t, int64(0), counts["leaf-1"])
+
+	_, err = p.RequestCounts("missing")
+	assert.ErrorContains(t, err, "backend missing not found")
+}
+
+func TestEmbeddedProxy_MeasuresResponseTimes(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	t.Cleanup(slow.Close)
+	host, port, _ := net.SplitHostPort(slow.Listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	idleHost, idlePort := startLeaf(t, "idle", http.StatusOK)
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello", "slow", host, portNumber))
+	assert.NoError(t, p.BindLeaf("hello", "idle", idleHost, idlePort))
+	p.backends["hello"].servers[1].healthy.Store(false) // Keeps the request on the slow server
+
+	get(t, p, "/hello")
+	times, err := p.ResponseTimes("hello")
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, times["slow"], 20*time.Millisecond)
+	assert.NotContains(t, times, "idle", "servers without responses report nothing")
+}
+
+func TestEmbeddedProxy_SkipsUnhealthyServers(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	healthyHost, healthyPort := startLeaf(t, "healthy", http.StatusOK)
+	failingHost, failingPort := startLeaf(t, "failing", http.StatusInternalServerError)
+
+	// A closed port stands in for a leaf that stopped responding
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	deadPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello", "healthy", healthyHost, healthyPort))
+	assert.NoError(t, p.BindLeaf("hello", "failing", failingHost, failingPort))
+	assert.NoError(t, p.BindLeaf("hello", "dead", "127.0.0.1", deadPort))
+
+	p.CheckHealth()
+	for i := 0; i < 3; i++ {
+		code, body := get(t, p, "/hello")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "healthy /hello", body)
+	}
+
+	assert.NoError(t, p.UnbindLeaf("hello", "healthy"))
+	code, _ := get(t, p, "/hello")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestEmbeddedProxy_MarksServerDownOnProxyError(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	deadPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello", "dead", "127.0.0.1", deadPort))
+
+	code, _ := get(t, p, "/hello")
+	assert.Equal(t, http.StatusBadGateway, code)
+	code, _ = get(t, p, "/hello")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestEmbeddedProxy_Maintenance(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	host, port := startLeaf(t, "leaf-1", http.StatusOK)
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", host, port))
+
+	assert.NoError(t, p.EnterMaintenance([]string{"hello", "gone"}, "<h1>Down</h1>"))
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/hello/greet", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "<h1>Down</h1>", recorder.Body.String())
+
+	assert.NoError(t, p.ExitMaintenance([]string{"hello", "gone"}))
+	code, body := get(t, p, "/hello/greet")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "leaf-1 /hello/greet", body)
+}
+
+func TestEmbeddedProxy_Servers(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", "localhost", 8001))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-2", "localhost", 8002))
+
+	servers, err := p.Servers("hello")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"leaf-1", "leaf-2"}, servers)
+	_, err = p.Servers("gone")
+	assert.Error(t, err)
+}
+
+func TestEmbeddedProxy_DrainServer(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.WriteString(w, "leaf-1")
+	}))
+	t.Cleanup(slow.Close)
+	slowHost, slowPort, _ := net.SplitHostPort(slow.Listener.Addr().String())
+	slowPortNumber, _ := strconv.Atoi(slowPort)
+	host, port := startLeaf(t, "leaf-2", http.StatusOK)
+	assert.NoError(t, p.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-1", slowHost, slowPortNumber))
+	assert.NoError(t, p.BindLeaf("hello", "leaf-2", host, port))
+
+	// Send requests until one is in flight to the slow leaf
+	done := make(chan struct{})
+	go func() {
+		for {
+			if _, body := get(t, p, "/hello"); body == "leaf-1" {
+				close(done)
+				return
+			}
+		}
+	}()
+	assert.Eventually(t, func() bool {
+		sessions, _ := p.ActiveSessions("hello")
+		return sessions["leaf-1"] == 1
+	}, time.Second, time.Millisecond)
+
+	// A draining server gets no new requests but finishes the one in flight
+	assert.NoError(t, p.DrainServer("hello", "leaf-1"))
+	for i := 0; i < 3; i++ {
+		_, body := get(t, p, "/hello")
+		assert.Equal(t, "leaf-2 /hello", body)
+	}
+	close(release)
+	<-done
+	sessions, err := p.ActiveSessions("hello")
+	assert.NoError(t, err)
+	assert.Zero(t, sessions["leaf-1"])
+
+	assert.ErrorContains(t, p.DrainServer("hello", "missing"), "server missing not found")
+}
+
+func TestEmbeddedProxy_StartAndClose(t *testing.T) {
+	p := NewEmbeddedProxy(EmbeddedConfig{ListenAddress: "127.0.0.1:0"})
+	assert.NoError(t, p.Start())
+	assert.NoError(t, p.Close())
+	assert.NoError(t, p.Close())
+}
+
+func TestEmbeddedProxy_ForwardsUDP(t *testing.T) {
+	// The leaf echoes datagrams back prefixed with its name
+	leaf, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer leaf.Close()
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, client, err := leaf.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			leaf.WriteTo(append([]byte("leaf-1 "), buf[:n]...), client)
+		}
+	}()
+
+	// Find a free port to publish the backend on
+	free, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	publishedPort := free.LocalAddr().(*net.UDPAddr).Port
+	free.Close()
+
+	p := NewEmbeddedProxy(EmbeddedConfig{})
+	defer p.Close()
+	options := proxy.BackendOptions{Transport: proxy.TransportUDP, ListenPort: publishedPort}
+	assert.NoError(t, p.BindStem("dns", options))
+	assert.NoError(t, p.BindLeaf("dns", "leaf-1", "127.0.0.1", leaf.LocalAddr().(*net.UDPAddr).Port))
+
+	client, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(publishedPort)))
+	assert.NoError(t, err)
+	defer client.Close()
+	assert.NoError(t, client.SetDeadline(time.Now().Add(2*time.Second)))
+	_, err = client.Write([]byte("ping"))
+	assert.NoError(t, err)
+	reply := make([]byte, 64)
+	n, err := client.Read(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, "leaf-1 ping", string(reply[:n]))
+
+	// UDP backends are not reachable over HTTP
+	code, _ := get(t, p, "/dns")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	assert.ErrorContains(t, p.BindStem("ntp", proxy.BackendOptions{Transport: proxy.TransportUDP}), "needs a listen port")
+	assert.NoError(t, p.UnbindStem("dns"))
+}
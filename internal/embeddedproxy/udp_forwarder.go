@@ -0,0 +1,145 @@
+package embeddedproxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// udpSessionTimeout ends a client's session when its server sent no reply for this long. The client's
+// next datagram starts a new session, possibly on another server.
+const udpSessionTimeout = time.Minute
+
+// maxDatagramSize fits any UDP payload.
+const maxDatagramSize = 65535
+
+// udpForwarder publishes a UDP backend on a port. Each client is pinned to one server for the length of
+// its session, and the server's replies are relayed back from the published port.
+type udpForwarder struct {
+	name    string
+	conn    net.PacketConn
+	backend func() *backend // Current servers of the backend, nil once the backend is gone
+
+	mu       sync.Mutex
+	sessions map[string]*net.UDPConn // Client address -> connection to the client's server
+	closed   bool
+}
+
+// listenUDP publishes a backend on port and starts forwarding in the background.
+func listenUDP(name string, port int, backend func() *backend) (*udpForwarder, error) {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on UDP port %d: %v", port, err)
+	}
+	f := &udpForwarder{
+		name:     name,
+		conn:     conn,
+		backend:  backend,
+		sessions: make(map[string]*net.UDPConn),
+	}
+	go f.serve()
+	return f, nil
+}
+
+// serve forwards datagrams from clients until the forwarder is closed.
+func (f *udpForwarder) serve() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, client, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Embedded proxy failed to read datagram for backend %s: %v", f.name, err)
+			continue
+		}
+		upstream, err := f.session(client)
+		if err != nil {
+			log.Printf("Embedded proxy dropped datagram from %s for backend %s: %v", client, f.name, err)
+			continue
+		}
+		if _, err := upstream.Write(buf[:n]); err != nil {
+			log.Printf("Embedded proxy failed to forward datagram for backend %s: %v", f.name, err)
+		}
+	}
+}
+
+// session returns the connection to the server a client is pinned to, picking a server for new clients.
+// Only serve creates sessions, so the backend lookup runs without holding the session lock.
+func (f *udpForwarder) session(client net.Addr) (*net.UDPConn, error) {
+	f.mu.Lock()
+	upstream, ok := f.sessions[client.String()]
+	f.mu.Unlock()
+	if ok {
+		return upstream, nil
+	}
+
+	b := f.backend()
+	if b == nil {
+		return nil, fmt.Errorf("backend not found")
+	}
+	target := b.pick()
+	if target == nil {
+		return nil, fmt.Errorf("no servers")
+	}
+	address, err := net.ResolveUDPAddr("udp", target.target.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve server %s: %v", target.name, err)
+	}
+	upstream, err = net.DialUDP("udp", nil, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server %s: %v", target.name, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		upstream.Close()
+		return nil, net.ErrClosed
+	}
+	f.sessions[client.String()] = upstream
+	go f.relay(client, upstream)
+	return upstream, nil
+}
+
+// relay sends a server's replies to the client until the session times out or the server goes away.
+func (f *udpForwarder) relay(client net.Addr, upstream *net.UDPConn) {
+	defer func() {
+		f.mu.Lock()
+		if f.sessions[client.String()] == upstream {
+			delete(f.sessions, client.String())
+		}
+		f.mu.Unlock()
+		upstream.Close()
+	}()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		if err := upstream.SetReadDeadline(time.Now().Add(udpSessionTimeout)); err != nil {
+			return
+		}
+		n, err := upstream.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := f.conn.WriteTo(buf[:n], client); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops publishing the backend and ends all sessions.
+func (f *udpForwarder) Close() error {
+	err := f.conn.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for client, upstream := range f.sessions {
+		upstream.Close()
+		delete(f.sessions, client)
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+// Package ha implements leader election between herbarium replicas sharing a storage backend.
+package ha
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// LeaderLease is the name of the lease held by the active herbarium replica.
+const LeaderLease = "leader"
+
+// DefaultLeaseTTL is the lease TTL used when the global config leaves it unset.
+const DefaultLeaseTTL = 15 * time.Second
+
+// Elector competes for the leader lease. The leader renews it every TTL/3; a standby retries at the same
+// interval, so a standby takes over at most TTL + TTL/3 after the leader stops renewing.
+type Elector struct {
+	lease    storage.Lease
+	holder   string
+	ttl      time.Duration
+	interval time.Duration
+}
+
+// NewElector creates an elector competing for the leader lease as holder. An empty holder defaults to
+// <hostname>-<pid>, and a zero ttl to DefaultLeaseTTL.
+func NewElector(lease storage.Lease, holder string, ttl time.Duration) *Elector {
+	if holder == "" {
+		hostname, _ := os.Hostname()
+		holder = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	return &Elector{lease: lease, holder: holder, ttl: ttl, interval: ttl / 3}
+}
+
+// Holder returns the identity this elector competes as.
+func (e *Elector) Holder() string {
+	return e.holder
+}
+
+// WaitForLeadership blocks until this replica holds the leader lease. It returns false if stop is closed first.
+func (e *Elector) WaitForLeadership(stop <-chan struct{}) bool {
+	waiting := false
+	for {
+		acquired, err := e.lease.AcquireLease(LeaderLease, e.holder, e.ttl)
+		if err != nil {
+			log.Printf("Failed to acquire leader lease: %v", err)
+		} else if acquired {
+			log.Printf("Acquired leadership as %s", e.holder)
+			return true
+		} else if !waiting {
+			log.Printf("Another replica is the leader, running as standby %s", e.holder)
+			waiting = true
+		}
+
+		select {
+		case <-time.After(e.interval):
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// KeepLeadership renews the leader lease in the background until stop is closed. If the lease is taken over,
+// or cannot be renewed for TTL - TTL/3 (leaving a margin before it expires and a standby may take over),
+// lost is called once and renewal stops.
+func (e *Elector) KeepLeadership(stop <-chan struct{}, lost func()) {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			acquired, err := e.lease.AcquireLease(LeaderLease, e.holder, e.ttl)
+			switch {
+			case err == nil && acquired:
+				renewed = time.Now()
+				continue
+			case err == nil:
+				log.Printf("Leader lease was taken over by another replica")
+			case time.Since(renewed) < e.ttl-e.interval:
+				log.Printf("Failed to renew leader lease, retrying: %v", err)
+				continue
+			default:
+				log.Printf("Failed to renew leader lease for %s: %v", time.Since(renewed).Round(time.Second), err)
+			}
+			lost()
+			return
+		}
+	}()
+}
+
+// Release gives up the leader lease so a standby can take over immediately.
+func (e *Elector) Release() error {
+	return e.lease.ReleaseLease(LeaderLease, e.holder)
+}
@@ -0,0 +1,107 @@
+package ha
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryLease is an in-memory storage.Lease with real expiry.
+type memoryLease struct {
+	mu      sync.Mutex
+	holder  string
+	expires time.Time
+	down    bool // Simulates an unreachable backend
+}
+
+func (l *memoryLease) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.down {
+		return false, assert.AnError
+	}
+	if l.holder == holder || l.holder == "" || time.Now().After(l.expires) {
+		l.holder = holder
+		l.expires = time.Now().Add(ttl)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (l *memoryLease) ReleaseLease(name, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == holder {
+		l.holder = ""
+	}
+	return nil
+}
+
+func TestElector_StandbyTakesOverWithinTTL(t *testing.T) {
+	lease := &memoryLease{}
+	ttl := 300 * time.Millisecond
+	leader := NewElector(lease, "a", ttl)
+	standby := NewElector(lease, "b", ttl)
+
+	assert.True(t, leader.WaitForLeadership(nil))
+	stopLeader := make(chan struct{})
+	leader.KeepLeadership(stopLeader, func() { t.Error("leader lost the lease while renewing") })
+
+	elected := make(chan time.Time, 1)
+	go func() {
+		if standby.WaitForLeadership(nil) {
+			elected <- time.Now()
+		}
+	}()
+
+	// The standby stays passive while the leader renews
+	select {
+	case <-elected:
+		t.Fatal("standby was elected while the leader was alive")
+	case <-time.After(2 * ttl):
+	}
+
+	// The leader stops renewing, as if it crashed
+	close(stopLeader)
+	crashed := time.Now()
+	select {
+	case at := <-elected:
+		assert.LessOrEqual(t, at.Sub(crashed), ttl+ttl/3+100*time.Millisecond)
+	case <-time.After(3 * ttl):
+		t.Fatal("standby did not take over")
+	}
+}
+
+func TestElector_StepsDownWhenLeaseCannotBeRenewed(t *testing.T) {
+	lease := &memoryLease{}
+	ttl := 300 * time.Millisecond
+	leader := NewElector(lease, "a", ttl)
+	assert.True(t, leader.WaitForLeadership(nil))
+
+	lost := make(chan time.Time, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	leader.KeepLeadership(stop, func() { lost <- time.Now() })
+
+	lease.mu.Lock()
+	lease.down = true
+	renewedBefore := lease.expires.Add(-ttl)
+	lease.mu.Unlock()
+
+	select {
+	case at := <-lost:
+		// Leadership is given up before the lease expires
+		assert.True(t, at.Before(renewedBefore.Add(ttl)))
+	case <-time.After(3 * ttl):
+		t.Fatal("leader did not step down")
+	}
+}
+
+func TestElector_WaitForLeadershipStops(t *testing.T) {
+	lease := &memoryLease{holder: "other", expires: time.Now().Add(time.Hour)}
+	stop := make(chan struct{})
+	close(stop)
+	assert.False(t, NewElector(lease, "a", time.Second).WaitForLeadership(stop))
+}
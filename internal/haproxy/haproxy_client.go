@@ -3,22 +3,24 @@ package haproxy
 import (
 	"fmt"
 	"log"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 )
 
-// HAProxyClientInterface defines the contract for HAProxy client interactions.
-type HAProxyClientInterface interface {
-	BindStem(backendName string) error
-	BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error
-	UnbindLeaf(backendName, haProxyServer string) error
-	ReplaceLeaf(backendName, oldHAProxyServer, newHAProxyServer, serviceAddress string, servicePort int) error
-	UnbindStem(backendName string) error
-}
+// HAProxyClientInterface is the proxy.ProxyClient implemented by HAProxy clients.
+type HAProxyClientInterface = proxy.ProxyClient
 
 // HAProxyConfig represents the HAProxy configuration needed for initialization.
 type HAProxyConfig struct {
+	Name     string // Instance name used in logs and errors when several instances are configured
 	APIURL   string
 	Username string
 	Password string
+	Frontend string // Frontend herbarium adds a use_backend rule to for every backend, empty to route requests yourself
 }
 
 // HAProxyClient provides a high-level interface for managing the HAProxy configuration.
@@ -39,13 +41,17 @@ func NewHAProxyClient(config HAProxyConfig, configManager HAProxyConfigurationMa
 }
 
 // BindStem creates a backend for a stem in HAProxy.
-func (c *HAProxyClient) BindStem(backendName string) error {
+func (c *HAProxyClient) BindStem(backendName string, options proxy.BackendOptions) error {
 	log.Printf("[HAProxyClient] Attempting to bind stem as backend: %s", backendName)
+	if options.IsUDP() {
+		// The Dataplane API only manages HTTP and TCP backends
+		return fmt.Errorf("UDP backends are not supported by HAProxy")
+	}
 	return c.transactionMiddleware(func(transactionID string) error {
 		log.Printf("[HAProxyClient] Starting transaction for backend creation: transactionID=%s, backendName=%s", transactionID, backendName)
 
 		// Create the backend for the stem if it doesn't exist
-		err := c.configManager.CreateBackend(backendName, transactionID)
+		err := c.configManager.CreateBackend(backendName, options, transactionID)
 		if err != nil {
 			log.Printf("[HAProxyClient] Failed to create backend: backendName=%s, transactionID=%s, error=%v", backendName, transactionID, err)
 			return fmt.Errorf("failed to create backend: %v", err)
@@ -58,13 +64,13 @@ func (c *HAProxyClient) BindStem(backendName string) error {
 
 // BindLeaf adds a leaf service to the specified backend using HAProxy server details.
 func (c *HAProxyClient) BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error {
-	log.Printf("Binding leaf: Backend=%s, LeafID=%s, Address=%s:%d", backendName, leafID, serviceAddress, servicePort)
+	log.Printf("Binding leaf: Backend=%s, LeafID=%s, Address=%s", backendName, leafID, net.JoinHostPort(serviceAddress, strconv.Itoa(servicePort)))
 
 	return c.transactionMiddleware(func(transactionID string) error {
 		log.Printf("Starting HAProxy transaction for binding: TransactionID=%s", transactionID)
 
 		// Construct service address as IP + port
-		address := fmt.Sprintf("%s:%d", serviceAddress, servicePort)
+		address := net.JoinHostPort(serviceAddress, strconv.Itoa(servicePort))
 
 		// Add the leaf as a service in the backend using leaf ID and service address
 		err := c.configManager.AddServer(backendName, leafID, serviceAddress, servicePort, transactionID)
@@ -120,3 +126,155 @@ func (c *HAProxyClient) UnbindStem(backendName string) error {
 		return nil
 	})()
 }
+
+// RequestCounts returns how many requests each server of a backend has handled, read from the runtime
+// statistics outside of any transaction.
+func (c *HAProxyClient) RequestCounts(backendName string) (map[string]int64, error) {
+	counts, err := c.configManager.GetServerRequestCounts(backendName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get request counts: %v", err)
+	}
+	return counts, nil
+}
+
+// ResponseTimes returns the recent average response time of each server of a backend, read from the runtime
+// statistics outside of any transaction.
+func (c *HAProxyClient) ResponseTimes(backendName string) (map[string]time.Duration, error) {
+	times, err := c.configManager.GetServerResponseTimes(backendName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response times: %v", err)
+	}
+	return times, nil
+}
+
+// QueuedRequests returns how many requests are waiting for a server of a backend, read from the runtime
+// statistics outside of any transaction.
+func (c *HAProxyClient) QueuedRequests(backendName string) (int64, error) {
+	queued, err := c.configManager.GetQueuedRequests(backendName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queued requests: %v", err)
+	}
+	return queued, nil
+}
+
+// EjectedServers returns the servers of a backend HAProxy took out of rotation, read from the runtime
+// statistics outside of any transaction.
+func (c *HAProxyClient) EjectedServers(backendName string) ([]string, error) {
+	servers, err := c.configManager.GetDownServers(backendName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get down servers: %v", err)
+	}
+	return servers, nil
+}
+
+// SetServerWeights sets the weights of servers of a backend in a single transaction, so the new split of its
+// requests takes effect at once. Servers are changed in name order.
+func (c *HAProxyClient) SetServerWeights(backendName string, weights map[string]int) error {
+	servers := make([]string, 0, len(weights))
+	for server := range weights {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	txn := c.Transaction()
+	for _, server := range servers {
+		txn.SetServerWeight(backendName, server, weights[server])
+	}
+	return txn.Commit()
+}
+
+// DrainServer sends a server no new requests while the sessions it is handling finish.
+func (c *HAProxyClient) DrainServer(backendName, serverName string) error {
+	return c.configManager.DrainServer(backendName, serverName)
+}
+
+// ActiveSessions returns the sessions each server of a backend is handling.
+func (c *HAProxyClient) ActiveSessions(backendName string) (map[string]int64, error) {
+	sessions, err := c.configManager.GetServerSessions(backendName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+// Servers returns the names of a backend's servers in the current configuration, outside of any transaction.
+func (c *HAProxyClient) Servers(backendName string) ([]string, error) {
+	servers, err := c.configManager.GetServersFromBackend(backendName, "")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(servers))
+	for _, server := range servers {
+		names = append(names, server.Name)
+	}
+	return names, nil
+}
+
+// Backends returns the names of the backends in the current configuration, outside of any transaction.
+func (c *HAProxyClient) Backends() ([]string, error) {
+	return c.backendNames(func(HAProxyBackend) bool { return true })
+}
+
+// OwnedBackends returns the names of the backends in the current configuration that herbarium created.
+func (c *HAProxyClient) OwnedBackends() ([]string, error) {
+	return c.backendNames(func(backend HAProxyBackend) bool { return backend.Description == proxy.OwnerTag })
+}
+
+// backendNames returns the names of the backends in the current configuration that match.
+func (c *HAProxyClient) backendNames(match func(HAProxyBackend) bool) ([]string, error) {
+	backends, err := c.configManager.GetBackends()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(backends))
+	for _, backend := range backends {
+		if match(backend) {
+			names = append(names, backend.Name)
+		}
+	}
+	return names, nil
+}
+
+// EnterMaintenance answers every request to the backends with 503 and the page, in a single transaction so
+// HAProxy switches all of them at once.
+func (c *HAProxyClient) EnterMaintenance(backendNames []string, page string) error {
+	return c.transactionMiddleware(func(transactionID string) error {
+		for _, backendName := range backendNames {
+			if err := c.configManager.AddMaintenanceRule(backendName, page, transactionID); err != nil {
+				return fmt.Errorf("failed to put backend %s into maintenance: %v", backendName, err)
+			}
+		}
+		return nil
+	})()
+}
+
+// ExitMaintenance routes requests to the backends' servers again, in a single transaction.
+func (c *HAProxyClient) ExitMaintenance(backendNames []string) error {
+	return c.transactionMiddleware(func(transactionID string) error {
+		for _, backendName := range backendNames {
+			if err := c.configManager.DeleteMaintenanceRule(backendName, transactionID); err != nil {
+				return fmt.Errorf("failed to take backend %s out of maintenance: %v", backendName, err)
+			}
+		}
+		return nil
+	})()
+}
+
+// SetBackendMaintenance puts all servers of a backend into maintenance and answers its requests with 503 and
+// the page, or routes requests to the servers again, in a single transaction.
+func (c *HAProxyClient) SetBackendMaintenance(backendName string, enabled bool, page string) error {
+	return c.transactionMiddleware(func(transactionID string) error {
+		servers, err := c.configManager.GetServersFromBackend(backendName, transactionID)
+		if err != nil {
+			return fmt.Errorf("failed to get servers of backend %s: %v", backendName, err)
+		}
+		for _, server := range servers {
+			if err := c.configManager.SetServerMaintenance(backendName, server, enabled, transactionID); err != nil {
+				return err
+			}
+		}
+		if enabled {
+			return c.configManager.AddMaintenanceRule(backendName, page, transactionID)
+		}
+		return c.configManager.DeleteMaintenanceRule(backendName, transactionID)
+	})()
+}
@@ -3,6 +3,7 @@ package haproxy
 import (
 	"testing"
 
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -15,7 +16,7 @@ func TestHAProxyClient_BindStem(t *testing.T) {
 	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil)    // Mocking GetCurrentConfigVersion
 	mockManager.On("StartTransaction", int64(1)).Return("txn123", nil) // Mock StartTransaction
 	mockManager.On("CommitTransaction", "txn123").Return(nil)          // Mock CommitTransaction
-	mockManager.On("CreateBackend", "backend1", mock.Anything).Return(nil)
+	mockManager.On("CreateBackend", "backend1", proxy.BackendOptions{}, mock.Anything).Return(nil)
 
 	// Create the HAProxyClient with the mock manager
 	client := &HAProxyClient{
@@ -24,7 +25,7 @@ func TestHAProxyClient_BindStem(t *testing.T) {
 	}
 
 	// Call BindStem
-	err := client.BindStem("backend1")
+	err := client.BindStem("backend1", proxy.BackendOptions{})
 
 	// Assert no errors occurred
 	assert.NoError(t, err)
@@ -32,6 +33,18 @@ func TestHAProxyClient_BindStem(t *testing.T) {
 	// Assert that CreateBackend was called with expected arguments
 	mockManager.AssertExpectations(t)
 }
+func TestHAProxyClient_BindStem_UDP(t *testing.T) {
+	mockManager := new(MockHAProxyConfigurationManager)
+	client := &HAProxyClient{
+		configManager:         mockManager,
+		transactionMiddleware: NewTransactionMiddleware(mockManager),
+	}
+
+	// UDP backends are rejected before a transaction is started
+	err := client.BindStem("dns", proxy.BackendOptions{Transport: proxy.TransportUDP, ListenPort: 53})
+	assert.ErrorContains(t, err, "UDP backends are not supported by HAProxy")
+	mockManager.AssertNotCalled(t, "StartTransaction", mock.Anything)
+}
 func TestHAProxyClient_BindLeaf(t *testing.T) {
 	// Initialize the mock HAProxyConfigurationManager
 	mockManager := new(MockHAProxyConfigurationManager)
@@ -135,3 +148,90 @@ func TestHAProxyClient_UnbindStem(t *testing.T) {
 	// Assert that DeleteServer was called with expected arguments
 	mockManager.AssertExpectations(t)
 }
+func TestHAProxyClient_SetServerWeights(t *testing.T) {
+	// Initialize the mock HAProxyConfigurationManager
+	mockManager := new(MockHAProxyConfigurationManager)
+	v1 := HAProxyServer{Name: "v1-leaf", Address: "localhost", Port: 8001}
+	v2 := HAProxyServer{Name: "v2-leaf", Address: "localhost", Port: 8002}
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil).Once()
+	mockManager.On("StartTransaction", int64(1)).Return("txn123", nil).Once()
+	mockManager.On("GetServersFromBackend", "backend1", "txn123").Return([]HAProxyServer{v1, v2}, nil)
+	mockManager.On("SetServerWeight", "backend1", v1, 256, "txn123").Return(nil)
+	mockManager.On("SetServerWeight", "backend1", v2, 28, "txn123").Return(nil)
+	mockManager.On("CommitTransaction", "txn123").Return(nil).Once()
+
+	// Create the HAProxyClient with the mock manager
+	client := &HAProxyClient{
+		configManager:         mockManager,
+		transactionMiddleware: NewTransactionMiddleware(mockManager),
+	}
+
+	// Both weights change in a single transaction
+	err := client.SetServerWeights("backend1", map[string]int{"v1-leaf": 256, "v2-leaf": 28})
+	assert.NoError(t, err)
+	mockManager.AssertExpectations(t)
+	mockManager.AssertNumberOfCalls(t, "StartTransaction", 1)
+}
+
+func TestHAProxyClient_Maintenance(t *testing.T) {
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil)
+	mockManager.On("StartTransaction", int64(1)).Return("txn123", nil)
+	mockManager.On("CommitTransaction", "txn123").Return(nil)
+	mockManager.On("AddMaintenanceRule", "api", "<h1>Down</h1>", "txn123").Return(nil)
+	mockManager.On("AddMaintenanceRule", "web", "<h1>Down</h1>", "txn123").Return(nil)
+	mockManager.On("DeleteMaintenanceRule", "api", "txn123").Return(nil)
+	mockManager.On("DeleteMaintenanceRule", "web", "txn123").Return(nil)
+
+	client := &HAProxyClient{
+		configManager:         mockManager,
+		transactionMiddleware: NewTransactionMiddleware(mockManager),
+	}
+
+	// All backends switch within a single transaction each way
+	assert.NoError(t, client.EnterMaintenance([]string{"api", "web"}, "<h1>Down</h1>"))
+	assert.NoError(t, client.ExitMaintenance([]string{"api", "web"}))
+	mockManager.AssertExpectations(t)
+	mockManager.AssertNumberOfCalls(t, "CommitTransaction", 2)
+}
+func TestHAProxyClient_SetBackendMaintenance(t *testing.T) {
+	servers := []HAProxyServer{{Name: "api-1", Address: "localhost", Port: 8001}, {Name: "api-2", Address: "localhost", Port: 8002}}
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil)
+	mockManager.On("StartTransaction", int64(1)).Return("txn123", nil)
+	mockManager.On("CommitTransaction", "txn123").Return(nil)
+	mockManager.On("GetServersFromBackend", "api", "txn123").Return(servers, nil)
+	mockManager.On("SetServerMaintenance", "api", servers[0], true, "txn123").Return(nil).Once()
+	mockManager.On("SetServerMaintenance", "api", servers[1], true, "txn123").Return(nil).Once()
+	mockManager.On("AddMaintenanceRule", "api", "<h1>Down</h1>", "txn123").Return(nil)
+	mockManager.On("SetServerMaintenance", "api", servers[0], false, "txn123").Return(nil).Once()
+	mockManager.On("SetServerMaintenance", "api", servers[1], false, "txn123").Return(nil).Once()
+	mockManager.On("DeleteMaintenanceRule", "api", "txn123").Return(nil)
+
+	client := &HAProxyClient{
+		configManager:         mockManager,
+		transactionMiddleware: NewTransactionMiddleware(mockManager),
+	}
+
+	assert.NoError(t, client.SetBackendMaintenance("api", true, "<h1>Down</h1>"))
+	assert.NoError(t, client.SetBackendMaintenance("api", false, ""))
+	mockManager.AssertExpectations(t)
+}
+
+func TestHAProxyClient_OwnedBackends(t *testing.T) {
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetBackends").Return([]HAProxyBackend{{Name: "api", Description: proxy.OwnerTag}, {Name: "legacy", Description: "by hand"}}, nil)
+
+	client := &HAProxyClient{
+		configManager:         mockManager,
+		transactionMiddleware: NewTransactionMiddleware(mockManager),
+	}
+
+	backends, err := client.Backends()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api", "legacy"}, backends)
+
+	owned, err := client.OwnedBackends()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api"}, owned)
+}
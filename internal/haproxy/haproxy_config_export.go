@@ -0,0 +1,95 @@
+package haproxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// configSection is a section of an HAProxy configuration file: its header line, such as "backend api", and the
+// lines beneath it.
+type configSection struct {
+	keyword string   // Section keyword, such as frontend, backend, or cache
+	name    string   // Name following the keyword, empty for global and unnamed defaults
+	lines   []string // Header line first
+}
+
+// ExportConfig returns the parts of the committed HAProxy configuration herbarium manages, as HAProxy reads
+// them: the backends it created with their servers and rules, their caches, and the use_backend rules routing
+// the frontends' requests to them. It is read live from the Dataplane API, for debugging and reviewing changes.
+func (c *HAProxyClient) ExportConfig() (string, error) {
+	raw, err := c.configManager.GetRawConfiguration()
+	if err != nil {
+		return "", fmt.Errorf("failed to get configuration: %v", err)
+	}
+	return managedConfig(raw), nil
+}
+
+// managedConfig cuts the sections and rules herbarium manages out of a configuration file, keeping their order.
+// Backends are herbarium's when they carry proxy.OwnerTag as their description, caches when they are named
+// after one of them, and frontends are reduced to the use_backend rules pointing at one of them.
+func managedConfig(raw string) string {
+	sections := parseConfigSections(raw)
+	owned := make(map[string]bool)
+	for _, section := range sections {
+		if section.keyword != "backend" {
+			continue
+		}
+		for _, line := range section.lines[1:] {
+			if strings.TrimSpace(line) == "description "+proxy.OwnerTag {
+				owned[section.name] = true
+			}
+		}
+	}
+
+	var blocks []string
+	for _, section := range sections {
+		switch section.keyword {
+		case "frontend", "listen":
+			var rules []string
+			for _, line := range section.lines[1:] {
+				if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "use_backend" && owned[fields[1]] {
+					rules = append(rules, line)
+				}
+			}
+			if len(rules) > 0 {
+				blocks = append(blocks, strings.Join(append([]string{section.lines[0]}, rules...), "\n"))
+			}
+		case "backend", "cache":
+			if owned[section.name] {
+				blocks = append(blocks, strings.Join(section.lines, "\n"))
+			}
+		}
+	}
+	if len(blocks) == 0 {
+		return ""
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// parseConfigSections splits a configuration file into its sections. A section starts at every line that isn't
+// indented, a comment, or blank; comments, blank lines, and lines ahead of the first section are dropped.
+func parseConfigSections(raw string) []configSection {
+	var sections []configSection
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			fields := strings.Fields(line)
+			section := configSection{keyword: fields[0], lines: []string{line}}
+			if len(fields) > 1 {
+				section.name = fields[1]
+			}
+			sections = append(sections, section)
+			continue
+		}
+		if len(sections) > 0 {
+			sections[len(sections)-1].lines = append(sections[len(sections)-1].lines, line)
+		}
+	}
+	return sections
+}
@@ -0,0 +1,60 @@
+package haproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rawConfig is a configuration file with backends herbarium created next to ones it didn't.
+const rawConfig = `# _version=42
+global
+  daemon
+
+defaults unnamed_defaults_1
+  mode http
+
+frontend http
+  bind :80
+  use_backend legacy if { path_beg /legacy }
+  use_backend api if { path /api } || { path_beg /api/ }
+
+backend api
+  description managed-by=herbarium
+  http-request cache-use api
+  server api-1 localhost:8001 weight 256
+
+backend legacy
+  server old 10.0.0.1:80
+
+cache api
+  total-max-size 16
+`
+
+func TestManagedConfig(t *testing.T) {
+	expected := `frontend http
+  use_backend api if { path /api } || { path_beg /api/ }
+
+backend api
+  description managed-by=herbarium
+  http-request cache-use api
+  server api-1 localhost:8001 weight 256
+
+cache api
+  total-max-size 16
+`
+	assert.Equal(t, expected, managedConfig(rawConfig))
+	assert.Equal(t, "", managedConfig("global\n  daemon\n"))
+}
+
+func TestHAProxyClient_ExportConfig(t *testing.T) {
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetRawConfiguration").Return(rawConfig, nil)
+	client := &HAProxyClient{configManager: mockManager, transactionMiddleware: NewTransactionMiddleware(mockManager)}
+
+	config, err := client.ExportConfig()
+	assert.NoError(t, err)
+	assert.Contains(t, config, "backend api\n")
+	assert.NotContains(t, config, "legacy")
+	mockManager.AssertExpectations(t)
+}
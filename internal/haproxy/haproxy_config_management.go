@@ -4,8 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/go-resty/resty/v2"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"log"
+	"net"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // HAProxyServer struct represents a backend server in HAProxy.
@@ -13,6 +18,21 @@ type HAProxyServer struct {
 	Name    string `json:"name"`
 	Address string `json:"address"`
 	Port    int    `json:"port"`
+	Weight  int    `json:"weight,omitempty"`
+}
+
+// HAProxyBackend struct represents a backend in HAProxy.
+type HAProxyBackend struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// haproxyBackendSwitchingRule is a use_backend rule of a frontend.
+type haproxyBackendSwitchingRule struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	Cond     string `json:"cond"`
+	CondTest string `json:"cond_test"`
 }
 
 // HAProxyConfigurationManagerInterface defines the methods for managing HAProxy configuration.
@@ -21,15 +41,28 @@ type HAProxyConfigurationManagerInterface interface {
 	StartTransaction(version int64) (string, error)
 	CommitTransaction(transactionID string) error
 	RollbackTransaction(transactionID string) error
-	CreateBackend(backendName, transactionID string) error
+	CreateBackend(backendName string, options proxy.BackendOptions, transactionID string) error
 	AddServer(backendName, serverName, host string, port int, transactionID string) error
 	DeleteServer(backendName, serverName, transactionID string) error
 	GetServersFromBackend(backendName, transactionID string) ([]HAProxyServer, error)
+	GetBackends() ([]HAProxyBackend, error)
+	GetRawConfiguration() (string, error)
+	GetServerRequestCounts(backendName string) (map[string]int64, error)
+	GetServerResponseTimes(backendName string) (map[string]time.Duration, error)
+	AddMaintenanceRule(backendName, page, transactionID string) error
+	DeleteMaintenanceRule(backendName, transactionID string) error
+	SetServerMaintenance(backendName string, server HAProxyServer, enabled bool, transactionID string) error
+	SetServerWeight(backendName string, server HAProxyServer, weight int, transactionID string) error
+	DrainServer(backendName, serverName string) error
+	GetServerSessions(backendName string) (map[string]int64, error)
+	GetQueuedRequests(backendName string) (int64, error)
+	GetDownServers(backendName string) ([]string, error)
 }
 
 // HAProxyConfigurationManager is the concrete implementation of HAProxyConfigurationManagerInterface.
 type HAProxyConfigurationManager struct {
-	client *resty.Client
+	client   *resty.Client
+	frontend string // Frontend the backends are routed from, empty when requests are routed outside of herbarium
 }
 
 // NewHAProxyConfigurationManager initializes the configuration manager with the provided HAProxyConfig.
@@ -41,7 +74,8 @@ func NewHAProxyConfigurationManager(config HAProxyConfig) *HAProxyConfigurationM
 	client.SetDisableWarn(true)
 
 	return &HAProxyConfigurationManager{
-		client: client,
+		client:   client,
+		frontend: config.Frontend,
 	}
 }
 
@@ -52,6 +86,9 @@ func (c *HAProxyConfigurationManager) GetCurrentConfigVersion() (int64, error) {
 		return 0, fmt.Errorf("failed to retrieve version: %v", err)
 	}
 
+	if resp.StatusCode() == 401 || resp.StatusCode() == 403 {
+		return 0, fmt.Errorf("failed to retrieve version: %w, status code: %d", ErrUnauthorized, resp.StatusCode())
+	}
 	if resp.StatusCode() != 200 {
 		return 0, fmt.Errorf("failed to retrieve version, status code: %d, response: %s", resp.StatusCode(), resp.String())
 	}
@@ -71,6 +108,9 @@ func (c *HAProxyConfigurationManager) StartTransaction(version int64) (string, e
 		return "", fmt.Errorf("failed to start transaction: %v", err)
 	}
 
+	if isVersionConflict(resp.StatusCode()) {
+		return "", fmt.Errorf("failed to start transaction from version %d, status code: %d, response: %s: %w", version, resp.StatusCode(), resp.String(), ErrVersionConflict)
+	}
 	if resp.StatusCode() != 201 {
 		return "", fmt.Errorf("failed to start transaction, status code: %d, response: %s", resp.StatusCode(), resp.String())
 	}
@@ -92,6 +132,9 @@ func (c *HAProxyConfigurationManager) CommitTransaction(transactionID string) er
 		return fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
+	if isVersionConflict(resp.StatusCode()) {
+		return fmt.Errorf("failed to commit transaction, status code: %d, response: %s: %w", resp.StatusCode(), resp.String(), ErrVersionConflict)
+	}
 	if resp.StatusCode() != 202 {
 		return fmt.Errorf("failed to commit transaction, status code: %d, response: %s", resp.StatusCode(), resp.String())
 	}
@@ -99,6 +142,12 @@ func (c *HAProxyConfigurationManager) CommitTransaction(transactionID string) er
 	return nil
 }
 
+// isVersionConflict reports whether a Dataplane API status means the configuration version a transaction was
+// started from is outdated: 406 for a version mismatch and 409 for a conflicting change.
+func isVersionConflict(statusCode int) bool {
+	return statusCode == 406 || statusCode == 409
+}
+
 // RollbackTransaction rolls back the specified HAProxy configuration transaction.
 func (c *HAProxyConfigurationManager) RollbackTransaction(transactionID string) error {
 	resp, err := c.client.R().Delete(fmt.Sprintf("/transactions/%s", transactionID))
@@ -114,7 +163,7 @@ func (c *HAProxyConfigurationManager) RollbackTransaction(transactionID string)
 }
 
 // CreateBackend creates a new backend in the HAProxy configuration.
-func (c *HAProxyConfigurationManager) CreateBackend(backendName, transactionID string) error {
+func (c *HAProxyConfigurationManager) CreateBackend(backendName string, options proxy.BackendOptions, transactionID string) error {
 	log.Printf("[HAProxyConfigurationManager] Checking if backend exists: backendName=%s, transactionID=%s", backendName, transactionID)
 
 	// Check if the backend exists by name
@@ -153,9 +202,315 @@ func (c *HAProxyConfigurationManager) CreateBackend(backendName, transactionID s
 	// Create a new backend
 	log.Printf("[HAProxyConfigurationManager] Creating backend: %s", backendName)
 
+	backendData := backendDefinition(backendName, options)
+
+	createResp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		SetBody(backendData).
+		Post("/configuration/backends")
+	if err != nil {
+		log.Printf("[HAProxyConfigurationManager] Error creating backend: backendName=%s, transactionID=%s, error=%v", backendName, transactionID, err)
+		return fmt.Errorf("failed to create backend: %v", err)
+	}
+
+	log.Printf("[HAProxyConfigurationManager] Backend creation response: statusCode=%d, responseBody=%s", createResp.StatusCode(), createResp.String())
+
+	if createResp.StatusCode() != 202 {
+		log.Printf("[HAProxyConfigurationManager] Unexpected status code while creating backend: backendName=%s, transactionID=%s, statusCode=%d, responseBody=%s",
+			backendName, transactionID, createResp.StatusCode(), createResp.String())
+		return fmt.Errorf("unexpected status code while creating backend: %d, response: %s", createResp.StatusCode(), createResp.String())
+	}
+
+	log.Printf("[HAProxyConfigurationManager] Backend %s created successfully", backendName)
+	requestRules := 0
+	if options.Rewrite != "" {
+		pattern, prefix := options.RewritePattern(backendName)
+		rewrite := map[string]interface{}{"type": "replace-path", "path_match": pattern, "path_fmt": prefix + `\1`}
+		if err := c.addRule(backendName, "http_request_rules", requestRules, rewrite, "rewrite", transactionID); err != nil {
+			return err
+		}
+		requestRules++
+	}
+	for _, rule := range rateLimitRules(options.RateLimit) {
+		if err := c.addRule(backendName, "http_request_rules", requestRules, rule, "rate limit", transactionID); err != nil {
+			return err
+		}
+		requestRules++
+	}
+	responseRules := 0
+	if options.CacheMaxAge > 0 {
+		if err := c.addCache(backendName, options.CacheMaxAge, requestRules, transactionID); err != nil {
+			return err
+		}
+		requestRules, responseRules = requestRules+1, 2
+	}
+	requestHeaderRules, responseHeaderRules := headerRules(options)
+	for i, rule := range requestHeaderRules {
+		if err := c.addRule(backendName, "http_request_rules", requestRules+i, rule, "CORS", transactionID); err != nil {
+			return err
+		}
+	}
+	for i, rule := range responseHeaderRules {
+		if err := c.addRule(backendName, "http_response_rules", responseRules+i, rule, rule["hdr_name"].(string), transactionID); err != nil {
+			return err
+		}
+	}
+	if options.Shadow {
+		return nil // Shadow backends are not routed to
+	}
+	if c.frontend != "" && !options.IsUDP() {
+		return c.setBackendSwitchingRule(backendName, options, transactionID)
+	} else if options.Host != "" {
+		return fmt.Errorf("routing backend %s by host %s needs a frontend to add the rule to", backendName, options.Host)
+	}
+	return nil
+}
+
+// addRule inserts an http-request or http-response rule, as named by rules, into a new backend at index.
+// Maintenance rules are inserted ahead of the rules added when the backend is created.
+func (c *HAProxyConfigurationManager) addRule(backendName, rules string, index int, rule map[string]interface{}, what, transactionID string) error {
+	resp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		SetBody(rule).
+		Post(fmt.Sprintf("/configuration/backends/%s/%s/%d", backendName, rules, index))
+	if err != nil {
+		return fmt.Errorf("failed to add %s rule to backend %s: %v", what, backendName, err)
+	}
+	if resp.StatusCode() != 202 && resp.StatusCode() != 201 {
+		return fmt.Errorf("unexpected status code %d when adding %s rule to backend %s: response: %s",
+			resp.StatusCode(), what, backendName, resp.String())
+	}
+	return nil
+}
+
+// cacheSizeMB is the memory the cache of a backend may use.
+const cacheSizeMB = 16
+
+// addCache creates the cache section of a backend, replacing one left by an earlier backend of the same name,
+// and the rules serving responses from it, storing them in it, and setting their Cache-Control max-age unless
+// the server set one. The cache-use rule goes at requestIndex, behind the rules that change the request.
+func (c *HAProxyConfigurationManager) addCache(backendName string, maxAge time.Duration, requestIndex int, transactionID string) error {
+	cachePath := fmt.Sprintf("/configuration/caches/%s", backendName)
+	resp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		Get(cachePath)
+	if err != nil {
+		return fmt.Errorf("failed to check if cache %s exists: %v", backendName, err)
+	}
+	if resp.StatusCode() == 200 {
+		deleteResp, err := c.client.R().
+			SetQueryParam("transaction_id", transactionID).
+			Delete(cachePath)
+		if err != nil {
+			return fmt.Errorf("failed to delete existing cache %s: %v", backendName, err)
+		}
+		if deleteResp.StatusCode() != 202 && deleteResp.StatusCode() != 204 {
+			return fmt.Errorf("unexpected status %d deleting cache %s: %s", deleteResp.StatusCode(), backendName, deleteResp.String())
+		}
+	}
+
+	seconds := int64(maxAge / time.Second)
+	createResp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		SetBody(map[string]interface{}{
+			"name":           backendName,
+			"total_max_size": cacheSizeMB,
+			"max_age":        seconds,
+		}).
+		Post("/configuration/caches")
+	if err != nil {
+		return fmt.Errorf("failed to create cache %s: %v", backendName, err)
+	}
+	if createResp.StatusCode() != 201 && createResp.StatusCode() != 202 {
+		return fmt.Errorf("unexpected status %d creating cache %s: %s", createResp.StatusCode(), backendName, createResp.String())
+	}
+
+	if err := c.addRule(backendName, "http_request_rules", requestIndex,
+		map[string]interface{}{"type": "cache-use", "cache_name": backendName}, "cache-use", transactionID); err != nil {
+		return err
+	}
+	if err := c.addRule(backendName, "http_response_rules", 0,
+		map[string]interface{}{"type": "cache-store", "cache_name": backendName}, "cache-store", transactionID); err != nil {
+		return err
+	}
+	return c.addRule(backendName, "http_response_rules", 1, map[string]interface{}{
+		"type":       "set-header",
+		"hdr_name":   "Cache-Control",
+		"hdr_format": fmt.Sprintf("max-age=%d", seconds),
+		"cond":       "unless",
+		"cond_test":  "{ res.hdr(cache-control) -m found }",
+	}, "Cache-Control", transactionID)
+}
+
+// rateLimitClients is the number of client addresses the stick table of a rate-limited backend tracks.
+const rateLimitClients = 100000
+
+// rateLimitStatusCode answers requests beyond a backend's rate limit.
+const rateLimitStatusCode = 429
+
+// rateLimitRules returns the http-request rules tracking each client address in the backend's stick table and
+// denying its requests beyond the limit, none without a limit.
+func rateLimitRules(limit *proxy.RateLimit) []map[string]interface{} {
+	if limit == nil {
+		return nil
+	}
+	return []map[string]interface{}{
+		{"type": "track-sc0", "track_sc0_key": "src"},
+		{
+			"type":        "deny",
+			"deny_status": rateLimitStatusCode,
+			"cond":        "if",
+			"cond_test":   fmt.Sprintf("{ sc_http_req_rate(0) gt %d }", limit.Requests),
+		},
+	}
+}
+
+// corsOriginVar is the variable the origin of a request is kept in, as http-response rules can't read the
+// request's headers.
+const corsOriginVar = "txn.cors_origin"
+
+// headerRules returns the http-request and http-response rules of a backend's CORS policy and security headers.
+// The request rules remember the request's origin and answer preflight requests from allowed origins, the
+// response rules add the CORS headers to responses to allowed origins and the security headers to all.
+func headerRules(options proxy.BackendOptions) (requestRules, responseRules []map[string]interface{}) {
+	if cors := options.CORS; cors != nil {
+		allowed := fmt.Sprintf("{ var(%s) -m found }", corsOriginVar)
+		if !cors.AnyOrigin() {
+			allowed = fmt.Sprintf("{ var(%s) -m str -i %s }", corsOriginVar, strings.Join(cors.AllowOrigins, " "))
+		}
+		var returnHeaders []map[string]interface{}
+		for _, header := range cors.PreflightHeaders(fmt.Sprintf("%%[var(%s)]", corsOriginVar)) {
+			returnHeaders = append(returnHeaders, map[string]interface{}{"name": header.Name, "fmt": header.Value})
+		}
+		requestRules = append(requestRules,
+			map[string]interface{}{
+				"type":      "set-var",
+				"var_scope": "txn",
+				"var_name":  strings.TrimPrefix(corsOriginVar, "txn."),
+				"var_expr":  "req.hdr(origin)",
+				"cond":      "if",
+				"cond_test": "{ req.hdr(origin) -m found }",
+			},
+			map[string]interface{}{
+				"type":               "return",
+				"return_status_code": 204,
+				"return_hdrs":        returnHeaders,
+				"cond":               "if",
+				"cond_test":          "METH_OPTIONS { req.hdr(access-control-request-method) -m found } " + allowed,
+			})
+		for _, header := range cors.Headers(fmt.Sprintf("%%[var(%s)]", corsOriginVar)) {
+			action := "set-header"
+			if header.Name == "Vary" { // Keeps the leaf's Vary
+				action = "add-header"
+			}
+			responseRules = append(responseRules, map[string]interface{}{
+				"type":       action,
+				"hdr_name":   header.Name,
+				"hdr_format": header.Value,
+				"cond":       "if",
+				"cond_test":  allowed,
+			})
+		}
+	}
+	if options.SecurityHeaders {
+		for _, header := range proxy.SecurityHeaders {
+			responseRules = append(responseRules, map[string]interface{}{
+				"type":       "set-header",
+				"hdr_name":   header.Name,
+				"hdr_format": header.Value,
+			})
+		}
+	}
+	return requestRules, responseRules
+}
+
+// setBackendSwitchingRule routes the requests under the backend's path, and for its host if it has one, that
+// arrive at the frontend to the backend. Rules that routed the backend or the same requests before are replaced,
+// so the backend bound last for them serves them. Rules with a host go ahead of the frontend's other rules, and
+// rules without one behind the rules with a host, so a host's stems aren't shadowed by host-less ones.
+func (c *HAProxyConfigurationManager) setBackendSwitchingRule(backendName string, options proxy.BackendOptions, transactionID string) error {
+	rulesPath := fmt.Sprintf("/configuration/frontends/%s/backend_switching_rules", c.frontend)
+	path := options.RoutePath(backendName)
+	condition := routeCondition(path, options.Host)
+	resp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		Get(rulesPath)
+	if err != nil {
+		return fmt.Errorf("failed to list backend switching rules of frontend %s: %v", c.frontend, err)
+	}
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("failed to list backend switching rules of frontend %s, status code: %d, response: %s", c.frontend, resp.StatusCode(), resp.String())
+	}
+	var rules []haproxyBackendSwitchingRule
+	if err := json.Unmarshal(resp.Body(), &rules); err != nil {
+		return fmt.Errorf("failed to parse backend switching rules: %v", err)
+	}
+
+	replaced := func(rule haproxyBackendSwitchingRule) bool {
+		return rule.Name == backendName || rule.CondTest == condition
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Index < rules[j].Index })
+	position, kept := 0, 0
+	for _, rule := range rules {
+		if replaced(rule) {
+			continue
+		}
+		kept++
+		if options.Host == "" && strings.HasPrefix(rule.CondTest, hostConditionPrefix) {
+			position = kept
+		}
+	}
+
+	// Delete from the last rule, so the indexes of the rules still to delete stay the same
+	for i := len(rules) - 1; i >= 0; i-- {
+		rule := rules[i]
+		if !replaced(rule) {
+			continue
+		}
+		deleteResp, err := c.client.R().
+			SetQueryParam("transaction_id", transactionID).
+			Delete(fmt.Sprintf("%s/%d", rulesPath, rule.Index))
+		if err != nil {
+			return fmt.Errorf("failed to delete backend switching rule %d of frontend %s: %v", rule.Index, c.frontend, err)
+		}
+		if deleteResp.StatusCode() != 202 && deleteResp.StatusCode() != 204 {
+			return fmt.Errorf("unexpected status %d deleting backend switching rule %d of frontend %s: %s", deleteResp.StatusCode(), rule.Index, c.frontend, deleteResp.String())
+		}
+	}
+
+	createResp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		SetBody(haproxyBackendSwitchingRule{Name: backendName, Cond: "if", CondTest: condition}).
+		Post(fmt.Sprintf("%s/%d", rulesPath, position))
+	if err != nil {
+		return fmt.Errorf("failed to route %s to backend %s: %v", path, backendName, err)
+	}
+	if createResp.StatusCode() != 201 && createResp.StatusCode() != 202 {
+		return fmt.Errorf("unexpected status %d routing %s to backend %s: %s", createResp.StatusCode(), path, backendName, createResp.String())
+	}
+	return nil
+}
+
+// hostConditionPrefix starts the conditions matching the host a request is for, ignoring its port.
+const hostConditionPrefix = "{ req.hdr(host),field(1,:) -i "
+
+// routeCondition returns the condition matching requests for path and anything beneath it, for host unless it
+// is empty.
+func routeCondition(path, host string) string {
+	if host == "" {
+		return fmt.Sprintf("{ path %s } || { path_beg %s/ }", path, path)
+	}
+	hostCondition := hostConditionPrefix + host + " }"
+	return fmt.Sprintf("%s { path %s } || %s { path_beg %s/ }", hostCondition, path, hostCondition, path)
+}
+
+// backendDefinition builds the Dataplane API backend for a stem. HTTP/2 protocols are set on default_server
+// so the servers added later inherit them, and HTTP/2 backends keep connections open for multiplexing.
+func backendDefinition(backendName string, options proxy.BackendOptions) map[string]interface{} {
 	backendData := map[string]interface{}{
-		"name": backendName,
-		"mode": "http",
+		"name":        backendName,
+		"description": proxy.OwnerTag,
+		"mode":        "http",
 		"balance": map[string]string{
 			"algorithm": "roundrobin",
 		},
@@ -176,25 +531,79 @@ func (c *HAProxyConfigurationManager) CreateBackend(backendName, transactionID s
 		},
 	}
 
-	createResp, err := c.client.R().
-		SetQueryParam("transaction_id", transactionID).
-		SetBody(backendData).
-		Post("/configuration/backends")
-	if err != nil {
-		log.Printf("[HAProxyConfigurationManager] Error creating backend: backendName=%s, transactionID=%s, error=%v", backendName, transactionID, err)
-		return fmt.Errorf("failed to create backend: %v", err)
+	defaultServer := map[string]interface{}{}
+	switch options.Protocol {
+	case proxy.ProtocolH2C:
+		defaultServer["proto"] = "h2"
+	case proxy.ProtocolH2:
+		defaultServer["ssl"] = "enabled"
+		defaultServer["alpn"] = "h2"
+		defaultServer["verify"] = "none"
+	}
+	if options.IsHTTP2() {
+		backendData["http_connection_mode"] = "http-keep-alive"
 	}
 
-	log.Printf("[HAProxyConfigurationManager] Backend creation response: statusCode=%d, responseBody=%s", createResp.StatusCode(), createResp.String())
+	if options.HealthCheck == proxy.HealthCheckGRPC {
+		// gRPC answers every call with HTTP 200, so a successful check means the server speaks gRPC
+		backendData["http-check"] = map[string]interface{}{
+			"method":  "POST",
+			"uri":     proxy.GRPCHealthCheckPath,
+			"version": "HTTP/2",
+			"headers": []map[string]string{
+				{"name": "content-type", "value": "application/grpc"},
+				{"name": "te", "value": "trailers"},
+			},
+		}
+		defaultServer["check"] = "enabled"
+	}
 
-	if createResp.StatusCode() != 202 {
-		log.Printf("[HAProxyConfigurationManager] Unexpected status code while creating backend: backendName=%s, transactionID=%s, statusCode=%d, responseBody=%s",
-			backendName, transactionID, createResp.StatusCode(), createResp.String())
-		return fmt.Errorf("unexpected status code while creating backend: %d, response: %s", createResp.StatusCode(), createResp.String())
+	if options.MaxConn > 0 {
+		// Requests beyond the limit wait in the backend's queue instead of piling up on the leaf
+		defaultServer["maxconn"] = options.MaxConn
 	}
 
-	log.Printf("[HAProxyConfigurationManager] Backend %s created successfully", backendName)
-	return nil
+	// The Dataplane API takes timeouts in milliseconds
+	for field, timeout := range map[string]time.Duration{
+		"connect_timeout": options.ConnectTimeout,
+		"server_timeout":  options.ServerTimeout,
+		"queue_timeout":   options.QueueTimeout,
+	} {
+		if timeout > 0 {
+			backendData[field] = timeout.Milliseconds()
+		}
+	}
+	if options.Retries != nil {
+		backendData["retries"] = *options.Retries
+	}
+	if options.Compression {
+		backendData["compression"] = map[string]interface{}{
+			"algorithms": []string{"gzip"},
+			"types":      compressedTypes,
+		}
+	}
+
+	if breaker := options.CircuitBreaker; breaker != nil {
+		// Watching responses needs health checks, which also bring an ejected server back once it recovers
+		defaultServer["check"] = "enabled"
+		defaultServer["observe"] = "layer7"
+		defaultServer["error_limit"] = breaker.ErrorLimit
+		defaultServer["on_error"] = breaker.OnError
+	}
+	if limit := options.RateLimit; limit != nil {
+		// Counts the requests of each client address over the period, forgetting clients idle for as long
+		backendData["stick_table"] = map[string]interface{}{
+			"type":   "ip",
+			"size":   rateLimitClients,
+			"expire": limit.Period.Milliseconds(),
+			"store":  fmt.Sprintf("http_req_rate(%dms)", limit.Period.Milliseconds()),
+		}
+	}
+
+	if len(defaultServer) > 0 {
+		backendData["default_server"] = defaultServer
+	}
+	return backendData
 }
 
 // AddServer adds a new server to the specified backend in the HAProxy configuration.
@@ -203,7 +612,7 @@ func (c *HAProxyConfigurationManager) AddServer(backendName, serverName, host st
 		SetQueryParam("transaction_id", transactionID).
 		SetBody(map[string]interface{}{
 			"name":    serverName,
-			"address": host,
+			"address": serverAddress(host),
 			"port":    port,
 		}).
 		Post(fmt.Sprintf("/configuration/backends/%s/servers", backendName))
@@ -223,6 +632,14 @@ func (c *HAProxyConfigurationManager) AddServer(backendName, serverName, host st
 	return nil
 }
 
+// serverAddress brackets IPv6 literals, whose colons HAProxy would otherwise read as a port separator.
+func serverAddress(host string) string {
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "[" + host + "]"
+	}
+	return host
+}
+
 // DeleteServer deletes a specific server from the backend.
 func (c *HAProxyConfigurationManager) DeleteServer(backendName, serverName, transactionID string) error {
 	resp, err := c.client.R().
@@ -254,11 +671,14 @@ func (c *HAProxyConfigurationManager) DeleteServer(backendName, serverName, tran
 	}
 }
 
-// GetServersFromBackend retrieves all servers from a specified backend in the HAProxy configuration.
+// GetServersFromBackend retrieves all servers from a specified backend in the HAProxy configuration. An empty
+// transactionID reads the committed configuration.
 func (c *HAProxyConfigurationManager) GetServersFromBackend(backendName, transactionID string) ([]HAProxyServer, error) {
-	resp, err := c.client.R().
-		SetQueryParam("transaction_id", transactionID).
-		Get(fmt.Sprintf("/configuration/backends/%s/servers", backendName))
+	req := c.client.R()
+	if transactionID != "" {
+		req.SetQueryParam("transaction_id", transactionID)
+	}
+	resp, err := req.Get(fmt.Sprintf("/configuration/backends/%s/servers", backendName))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list servers in backend %s: %v", backendName, err)
 	}
@@ -277,3 +697,319 @@ func (c *HAProxyConfigurationManager) GetServersFromBackend(backendName, transac
 
 	return servers, nil
 }
+
+// GetBackends retrieves all backends in the committed HAProxy configuration.
+func (c *HAProxyConfigurationManager) GetBackends() ([]HAProxyBackend, error) {
+	resp, err := c.client.R().Get("/configuration/backends")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backends: %v", err)
+	}
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("failed to list backends, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+
+	var backends []HAProxyBackend
+	if err := json.Unmarshal(resp.Body(), &backends); err != nil {
+		return nil, fmt.Errorf("failed to parse backend list: %v", err)
+	}
+	return backends, nil
+}
+
+// GetRawConfiguration retrieves the committed HAProxy configuration file as HAProxy reads it.
+func (c *HAProxyConfigurationManager) GetRawConfiguration() (string, error) {
+	resp, err := c.client.R().Get("/configuration/raw")
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch raw configuration: %v", err)
+	}
+	if resp.StatusCode() != 200 {
+		return "", fmt.Errorf("failed to fetch raw configuration, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+
+	var raw struct {
+		Data string `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body(), &raw); err != nil {
+		return "", fmt.Errorf("failed to parse raw configuration: %v", err)
+	}
+	return raw.Data, nil
+}
+
+// haproxyNativeStats is the response of the Dataplane API native stats endpoint, one entry per HAProxy process.
+type haproxyNativeStats []struct {
+	Stats []haproxyServerStats `json:"stats"`
+}
+
+// haproxyServerStats are the runtime statistics of one server, or of a backend as a whole, in one HAProxy
+// process.
+type haproxyServerStats struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Stats struct {
+		Stot   *int64 `json:"stot"`   // Total sessions
+		Scur   *int64 `json:"scur"`   // Current sessions
+		Qcur   *int64 `json:"qcur"`   // Requests waiting in the queue
+		Rtime  *int64 `json:"rtime"`  // Average response time in milliseconds over the last 1024 requests
+		Status string `json:"status"` // UP, DOWN, MAINT, or NOLB, followed by the checks passed towards the next one when changing
+	} `json:"stats"`
+}
+
+// getServerStats retrieves the runtime statistics of a backend's servers from every HAProxy process.
+func (c *HAProxyConfigurationManager) getServerStats(backendName string) ([]haproxyServerStats, error) {
+	return c.getStats(backendName, "server", map[string]string{"type": "server", "parent": backendName})
+}
+
+// getStats retrieves the runtime statistics of the given type matching params from every HAProxy process.
+func (c *HAProxyConfigurationManager) getStats(backendName, statsType string, params map[string]string) ([]haproxyServerStats, error) {
+	resp, err := c.client.R().
+		SetQueryParams(params).
+		Get("/services/haproxy/stats/native")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stats of backend %s: %v", backendName, err)
+	}
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("failed to fetch stats, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+
+	var stats haproxyNativeStats
+	if err := json.Unmarshal(resp.Body(), &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse stats: %v", err)
+	}
+	var items []haproxyServerStats
+	for _, process := range stats {
+		for _, item := range process.Stats {
+			if item.Type == statsType {
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+// GetServerRequestCounts retrieves the total number of sessions each server of a backend has handled since
+// it was added, summed over all HAProxy processes.
+func (c *HAProxyConfigurationManager) GetServerRequestCounts(backendName string) (map[string]int64, error) {
+	servers, err := c.getServerStats(backendName)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	for _, server := range servers {
+		if server.Stats.Stot != nil {
+			counts[server.Name] += *server.Stats.Stot
+		}
+	}
+	return counts, nil
+}
+
+// GetServerSessions retrieves the number of sessions each server of a backend is currently handling, summed
+// over all HAProxy processes.
+func (c *HAProxyConfigurationManager) GetServerSessions(backendName string) (map[string]int64, error) {
+	servers, err := c.getServerStats(backendName)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make(map[string]int64)
+	for _, server := range servers {
+		if server.Stats.Scur != nil {
+			sessions[server.Name] += *server.Stats.Scur
+		}
+	}
+	return sessions, nil
+}
+
+// GetQueuedRequests retrieves the number of requests waiting for a server of a backend, in the backend's queue
+// and those of its servers, summed over all HAProxy processes. Requests only queue once servers have a maxconn.
+func (c *HAProxyConfigurationManager) GetQueuedRequests(backendName string) (int64, error) {
+	backends, err := c.getStats(backendName, "backend", map[string]string{"type": "backend", "name": backendName})
+	if err != nil {
+		return 0, err
+	}
+	servers, err := c.getServerStats(backendName)
+	if err != nil {
+		return 0, err
+	}
+	var queued int64
+	for _, item := range append(backends, servers...) {
+		if item.Stats.Qcur != nil {
+			queued += *item.Stats.Qcur
+		}
+	}
+	return queued, nil
+}
+
+// GetDownServers retrieves the names of a backend's servers that failed their health checks or too many
+// responses, in any HAProxy process, sorted. Servers in maintenance are not down.
+func (c *HAProxyConfigurationManager) GetDownServers(backendName string) ([]string, error) {
+	servers, err := c.getServerStats(backendName)
+	if err != nil {
+		return nil, err
+	}
+	down := make(map[string]bool)
+	for _, server := range servers {
+		if strings.HasPrefix(server.Stats.Status, "DOWN") {
+			down[server.Name] = true
+		}
+	}
+	names := make([]string, 0, len(down))
+	for name := range down {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetServerResponseTimes retrieves the average response time of each server of a backend over its last
+// requests, the slowest of all HAProxy processes.
+func (c *HAProxyConfigurationManager) GetServerResponseTimes(backendName string) (map[string]time.Duration, error) {
+	servers, err := c.getServerStats(backendName)
+	if err != nil {
+		return nil, err
+	}
+	times := make(map[string]time.Duration)
+	for _, server := range servers {
+		if server.Stats.Rtime != nil {
+			times[server.Name] = max(times[server.Name], time.Duration(*server.Stats.Rtime)*time.Millisecond)
+		}
+	}
+	return times, nil
+}
+
+// haproxyHTTPRequestRule is the part of a Dataplane API http-request rule maintenance mode relies on.
+type haproxyHTTPRequestRule struct {
+	Type             string `json:"type"`
+	ReturnStatusCode int    `json:"return_status_code"`
+}
+
+// compressedTypes are the response content types compressed for backends with compression.
+var compressedTypes = []string{"text/html", "text/plain", "text/css", "text/javascript", "application/javascript", "application/json", "image/svg+xml"}
+
+// maintenanceStatusCode is the status the maintenance rule answers requests with.
+const maintenanceStatusCode = 503
+
+// AddMaintenanceRule inserts an http-request rule in front of a backend's other rules, answering every
+// request with 503 and the HTML page instead of passing it to a server.
+func (c *HAProxyConfigurationManager) AddMaintenanceRule(backendName, page, transactionID string) error {
+	resp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		SetBody(map[string]interface{}{
+			"type":                  "return",
+			"return_status_code":    maintenanceStatusCode,
+			"return_content_type":   "text/html",
+			"return_content_format": "string",
+			"return_content":        page,
+		}).
+		Post(fmt.Sprintf("/configuration/backends/%s/http_request_rules/0", backendName))
+	if err != nil {
+		return fmt.Errorf("failed to add maintenance rule to backend %s: %v", backendName, err)
+	}
+	if resp.StatusCode() != 202 && resp.StatusCode() != 201 {
+		return fmt.Errorf("unexpected status code %d when adding maintenance rule to backend %s: response: %s",
+			resp.StatusCode(), backendName, resp.String())
+	}
+	return nil
+}
+
+// DeleteMaintenanceRule removes the rule AddMaintenanceRule inserted, leaving backends without it, or that no
+// longer exist, untouched.
+func (c *HAProxyConfigurationManager) DeleteMaintenanceRule(backendName, transactionID string) error {
+	resp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		Get(fmt.Sprintf("/configuration/backends/%s/http_request_rules/0", backendName))
+	if err != nil {
+		return fmt.Errorf("failed to get first rule of backend %s: %v", backendName, err)
+	}
+	if resp.StatusCode() == 404 {
+		return nil
+	} else if resp.StatusCode() != 200 {
+		return fmt.Errorf("failed to get first rule of backend %s, status code: %d, response: %s", backendName, resp.StatusCode(), resp.String())
+	}
+	var rule haproxyHTTPRequestRule
+	if err := json.Unmarshal(resp.Body(), &rule); err != nil {
+		return fmt.Errorf("failed to parse rule: %v", err)
+	}
+	if rule.Type != "return" || rule.ReturnStatusCode != maintenanceStatusCode {
+		log.Printf("[INFO] Backend %s has no maintenance rule", backendName)
+		return nil
+	}
+
+	resp, err = c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		Delete(fmt.Sprintf("/configuration/backends/%s/http_request_rules/0", backendName))
+	if err != nil {
+		return fmt.Errorf("failed to delete maintenance rule of backend %s: %v", backendName, err)
+	}
+	if resp.StatusCode() != 202 && resp.StatusCode() != 204 {
+		return fmt.Errorf("unexpected status %d deleting maintenance rule of backend %s: %s", resp.StatusCode(), backendName, resp.String())
+	}
+	return nil
+}
+
+// SetServerMaintenance puts a server into the maint state, in which HAProxy neither sends it requests nor
+// checks its health, or back into the ready state.
+func (c *HAProxyConfigurationManager) SetServerMaintenance(backendName string, server HAProxyServer, enabled bool, transactionID string) error {
+	maintenance := "disabled"
+	if enabled {
+		maintenance = "enabled"
+	}
+	body := map[string]interface{}{
+		"name":        server.Name,
+		"address":     server.Address,
+		"port":        server.Port,
+		"maintenance": maintenance,
+	}
+	if server.Weight > 0 {
+		// The server is replaced as a whole, keep a weight set earlier
+		body["weight"] = server.Weight
+	}
+	resp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		SetBody(body).
+		Put(fmt.Sprintf("/configuration/backends/%s/servers/%s", backendName, server.Name))
+	if err != nil {
+		return fmt.Errorf("failed to update server %s of backend %s: %v", server.Name, backendName, err)
+	}
+	if resp.StatusCode() != 202 && resp.StatusCode() != 200 {
+		return fmt.Errorf("unexpected status %d updating server %s of backend %s: %s", resp.StatusCode(), server.Name, backendName, resp.String())
+	}
+	return nil
+}
+
+// SetServerWeight changes the weight of a server, which sets its share of the backend's requests relative to
+// the other servers. HAProxy accepts weights from 0, which sends the server no new requests, to 256.
+func (c *HAProxyConfigurationManager) SetServerWeight(backendName string, server HAProxyServer, weight int, transactionID string) error {
+	if weight < 0 || weight > 256 {
+		return fmt.Errorf("weight %d of server %s is out of range 0-256", weight, server.Name)
+	}
+	resp, err := c.client.R().
+		SetQueryParam("transaction_id", transactionID).
+		SetBody(map[string]interface{}{
+			"name":    server.Name,
+			"address": server.Address,
+			"port":    server.Port,
+			"weight":  weight,
+		}).
+		Put(fmt.Sprintf("/configuration/backends/%s/servers/%s", backendName, server.Name))
+	if err != nil {
+		return fmt.Errorf("failed to update server %s of backend %s: %v", server.Name, backendName, err)
+	}
+	if resp.StatusCode() != 202 && resp.StatusCode() != 200 {
+		return fmt.Errorf("unexpected status %d updating server %s of backend %s: %s", resp.StatusCode(), server.Name, backendName, resp.String())
+	}
+	return nil
+}
+
+// DrainServer puts a server into the drain state through the runtime API, so HAProxy sends it no new
+// requests while the sessions it is handling finish. The change takes effect immediately, outside of
+// any transaction, and lasts until the server is removed.
+func (c *HAProxyConfigurationManager) DrainServer(backendName, serverName string) error {
+	resp, err := c.client.R().
+		SetBody(map[string]interface{}{"admin_state": "drain"}).
+		Put(fmt.Sprintf("/services/haproxy/runtime/backends/%s/servers/%s", backendName, serverName))
+	if err != nil {
+		return fmt.Errorf("failed to drain server %s of backend %s: %v", serverName, backendName, err)
+	}
+	if resp.StatusCode() != 200 && resp.StatusCode() != 202 {
+		return fmt.Errorf("unexpected status %d draining server %s of backend %s: %s", resp.StatusCode(), serverName, backendName, resp.String())
+	}
+	return nil
+}
@@ -1,10 +1,15 @@
 package haproxy
 
 import (
+	"encoding/json"
 	"github.com/go-resty/resty/v2"
 	"github.com/jarcoal/httpmock"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestGetCurrentConfigVersion tests the GetCurrentConfigVersion method
@@ -33,6 +38,22 @@ func TestGetCurrentConfigVersion(t *testing.T) {
 	assert.Equal(t, int64(1), version)
 }
 
+func TestGetCurrentConfigVersion_Unauthorized(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "/configuration/version",
+		httpmock.NewStringResponder(401, `{"code":401,"message":"invalid credentials"}`))
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	_, err := manager.GetCurrentConfigVersion()
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
 func TestStartTransaction(t *testing.T) {
 	// Initialize resty client
 	client := resty.New()
@@ -82,6 +103,30 @@ func TestCommitTransaction(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCommitTransaction_VersionConflict(t *testing.T) {
+	// Initialize resty client
+	client := resty.New()
+
+	// Activate httpmock for the resty client's HTTP client
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	// Register a mock responder rejecting the outdated transaction
+	httpmock.RegisterResponder("PUT", "/transactions/txn123",
+		httpmock.NewStringResponder(406, `{"message": "version mismatch"}`))
+
+	// Initialize the manager with the mocked client
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	// Run the method under test
+	err := manager.CommitTransaction("txn123")
+
+	// Assert the conflict is recognizable
+	assert.ErrorIs(t, err, ErrVersionConflict)
+}
+
 func TestRollbackTransaction(t *testing.T) {
 	// Initialize resty client
 	client := resty.New()
@@ -132,7 +177,7 @@ func TestCreateBackend(t *testing.T) {
 	}
 
 	// Run the method under test
-	err := manager.CreateBackend("backend1", "txn123")
+	err := manager.CreateBackend("backend1", proxy.BackendOptions{}, "txn123")
 
 	// Assert the result
 	assert.NoError(t, err)
@@ -144,6 +189,350 @@ func TestCreateBackend(t *testing.T) {
 	assert.Equal(t, 1, info["POST /configuration/backends"])
 }
 
+func TestCreateBackend_SwitchingRule(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "/configuration/backends/hb-hello-v2",
+		httpmock.NewStringResponder(404, "{}"))
+	var backend map[string]interface{}
+	httpmock.RegisterResponder("POST", "/configuration/backends",
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&backend); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+
+	// The previous version's rule for the path and a manually added rule
+	rulesPath := "/configuration/frontends/http-in/backend_switching_rules"
+	httpmock.RegisterResponder("GET", rulesPath, httpmock.NewStringResponder(200,
+		`[{"index":0,"name":"hb-hello-v1","cond":"if","cond_test":"{ path /hello } || { path_beg /hello/ }"},`+
+			`{"index":1,"name":"legacy","cond":"if","cond_test":"{ path_beg /legacy }"}]`))
+	httpmock.RegisterResponder("DELETE", rulesPath+"/0", httpmock.NewStringResponder(204, ""))
+	var rule haproxyBackendSwitchingRule
+	httpmock.RegisterResponder("POST", rulesPath+"/0",
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&rule); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client:   client,
+		frontend: "http-in",
+	}
+
+	err := manager.CreateBackend("hb-hello-v2", proxy.BackendOptions{Path: "/hello"}, "txn123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, proxy.OwnerTag, backend["description"])
+	assert.Equal(t, haproxyBackendSwitchingRule{Name: "hb-hello-v2", Cond: "if", CondTest: "{ path /hello } || { path_beg /hello/ }"}, rule)
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["DELETE "+rulesPath+"/0"])
+	assert.Equal(t, 0, info["DELETE "+rulesPath+"/1"])
+}
+
+func TestCreateBackend_HostRule(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", `=~^/configuration/backends/`, httpmock.NewStringResponder(404, "{}"))
+	httpmock.RegisterResponder("POST", "/configuration/backends", httpmock.NewStringResponder(202, "{}"))
+	rulesPath := "/configuration/frontends/http-in/backend_switching_rules"
+	httpmock.RegisterResponder("GET", rulesPath, httpmock.NewStringResponder(200,
+		`[{"index":0,"name":"shop_hello","cond":"if","cond_test":"{ req.hdr(host),field(1,:) -i shop.example.com } { path /hello } || { req.hdr(host),field(1,:) -i shop.example.com } { path_beg /hello/ }"},`+
+			`{"index":1,"name":"legacy","cond":"if","cond_test":"{ path_beg /legacy }"}]`))
+	var rules []haproxyBackendSwitchingRule
+	for _, index := range []string{"0", "1"} {
+		httpmock.RegisterResponder("POST", rulesPath+"/"+index,
+			func(req *http.Request) (*http.Response, error) {
+				var rule haproxyBackendSwitchingRule
+				if err := json.NewDecoder(req.Body).Decode(&rule); err != nil {
+					return nil, err
+				}
+				rule.Index = int(req.URL.Path[len(req.URL.Path)-1] - '0')
+				rules = append(rules, rule)
+				return httpmock.NewStringResponse(202, "{}"), nil
+			})
+	}
+
+	manager := &HAProxyConfigurationManager{
+		client:   client,
+		frontend: "http-in",
+	}
+
+	// Rules with a host go first, rules without one behind the rules with a host
+	assert.NoError(t, manager.CreateBackend("api_hello", proxy.BackendOptions{Path: "/hello", Host: "api.example.com"}, "txn123"))
+	assert.NoError(t, manager.CreateBackend("hello", proxy.BackendOptions{}, "txn123"))
+	assert.Equal(t, []haproxyBackendSwitchingRule{
+		{Index: 0, Name: "api_hello", Cond: "if", CondTest: "{ req.hdr(host),field(1,:) -i api.example.com } { path /hello } || { req.hdr(host),field(1,:) -i api.example.com } { path_beg /hello/ }"},
+		{Index: 1, Name: "hello", Cond: "if", CondTest: "{ path /hello } || { path_beg /hello/ }"},
+	}, rules)
+
+	// Without a frontend there is nowhere to route by host
+	manager.frontend = ""
+	assert.ErrorContains(t, manager.CreateBackend("api_hello", proxy.BackendOptions{Host: "api.example.com"}, "txn123"), "needs a frontend")
+}
+
+func TestBackendDefinition_TimeoutsAndRetries(t *testing.T) {
+	retries := 0
+	backend := backendDefinition("batch", proxy.BackendOptions{ServerTimeout: 5 * time.Minute, QueueTimeout: 10 * time.Second, Retries: &retries})
+
+	assert.Equal(t, int64(300000), backend["server_timeout"])
+	assert.Equal(t, int64(10000), backend["queue_timeout"])
+	assert.NotContains(t, backend, "connect_timeout")
+	assert.Equal(t, 0, backend["retries"])
+
+	// Without options HAProxy's defaults apply
+	assert.NotContains(t, backendDefinition("api", proxy.BackendOptions{}), "retries")
+}
+
+func TestCreateBackend_CacheAndCompression(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "/configuration/backends/assets", httpmock.NewStringResponder(404, "{}"))
+	var backend map[string]interface{}
+	httpmock.RegisterResponder("POST", "/configuration/backends",
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&backend); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+	// A cache left by an earlier backend of the same name is replaced
+	httpmock.RegisterResponder("GET", "/configuration/caches/assets", httpmock.NewStringResponder(200, `{"name":"assets"}`))
+	httpmock.RegisterResponder("DELETE", "/configuration/caches/assets", httpmock.NewStringResponder(204, ""))
+	var cache map[string]interface{}
+	httpmock.RegisterResponder("POST", "/configuration/caches",
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&cache); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(201, "{}"), nil
+		})
+	rules := make(map[string]map[string]interface{})
+	httpmock.RegisterResponder("POST", `=~^/configuration/backends/assets/http_(request|response)_rules/\d+$`,
+		func(req *http.Request) (*http.Response, error) {
+			var rule map[string]interface{}
+			if err := json.NewDecoder(req.Body).Decode(&rule); err != nil {
+				return nil, err
+			}
+			rules[strings.TrimPrefix(req.URL.Path, "/configuration/backends/assets/")] = rule
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	err := manager.CreateBackend("assets", proxy.BackendOptions{Rewrite: "/", Compression: true, CacheMaxAge: 5 * time.Minute}, "txn123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"algorithms": []interface{}{"gzip"}, "types": toInterfaces(compressedTypes)}, backend["compression"])
+	assert.Equal(t, map[string]interface{}{"name": "assets", "total_max_size": float64(cacheSizeMB), "max_age": float64(300)}, cache)
+	assert.Equal(t, "replace-path", rules["http_request_rules/0"]["type"])
+	assert.Equal(t, map[string]interface{}{"type": "cache-use", "cache_name": "assets"}, rules["http_request_rules/1"])
+	assert.Equal(t, map[string]interface{}{"type": "cache-store", "cache_name": "assets"}, rules["http_response_rules/0"])
+	assert.Equal(t, "max-age=300", rules["http_response_rules/1"]["hdr_format"])
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE /configuration/caches/assets"])
+}
+
+func TestCreateBackend_RateLimit(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "/configuration/backends/api", httpmock.NewStringResponder(404, "{}"))
+	var backend map[string]interface{}
+	httpmock.RegisterResponder("POST", "/configuration/backends",
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&backend); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+	rules := make(map[string]map[string]interface{})
+	httpmock.RegisterResponder("POST", `=~^/configuration/backends/api/http_request_rules/\d+$`,
+		func(req *http.Request) (*http.Response, error) {
+			var rule map[string]interface{}
+			if err := json.NewDecoder(req.Body).Decode(&rule); err != nil {
+				return nil, err
+			}
+			rules[strings.TrimPrefix(req.URL.Path, "/configuration/backends/api/")] = rule
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	err := manager.CreateBackend("api", proxy.BackendOptions{Rewrite: "/", RateLimit: &proxy.RateLimit{Requests: 100, Period: 10 * time.Second}}, "txn123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"type": "ip", "size": float64(rateLimitClients), "expire": float64(10000), "store": "http_req_rate(10000ms)",
+	}, backend["stick_table"])
+	assert.Equal(t, "replace-path", rules["http_request_rules/0"]["type"])
+	assert.Equal(t, map[string]interface{}{"type": "track-sc0", "track_sc0_key": "src"}, rules["http_request_rules/1"])
+	assert.Equal(t, map[string]interface{}{
+		"type": "deny", "deny_status": float64(429), "cond": "if", "cond_test": "{ sc_http_req_rate(0) gt 100 }",
+	}, rules["http_request_rules/2"])
+	assert.NotContains(t, backendDefinition("api", proxy.BackendOptions{}), "stick_table")
+}
+
+func TestBackendDefinition_CircuitBreaker(t *testing.T) {
+	backend := backendDefinition("api", proxy.BackendOptions{CircuitBreaker: &proxy.CircuitBreaker{ErrorLimit: 10, OnError: proxy.OnErrorMarkDown}})
+	assert.Equal(t, map[string]interface{}{
+		"check": "enabled", "observe": "layer7", "error_limit": 10, "on_error": "mark-down",
+	}, backend["default_server"])
+}
+
+func TestGetDownServers(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	// One entry per HAProxy process, a server down in any of them is down
+	httpmock.RegisterResponder("GET", "/services/haproxy/stats/native?parent=api&type=server", httpmock.NewStringResponder(200, `[
+		{"stats": [
+			{"name": "s1", "type": "server", "stats": {"status": "UP"}},
+			{"name": "s2", "type": "server", "stats": {"status": "DOWN"}},
+			{"name": "s3", "type": "server", "stats": {"status": "MAINT"}}
+		]},
+		{"stats": [
+			{"name": "s1", "type": "server", "stats": {"status": "DOWN 1/2"}},
+			{"name": "s2", "type": "server", "stats": {"status": "DOWN"}}
+		]}
+	]`))
+
+	manager := &HAProxyConfigurationManager{client: client}
+	down, err := manager.GetDownServers("api")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"s1", "s2"}, down)
+}
+
+func TestHeaderRules(t *testing.T) {
+	cors := &proxy.CORSPolicy{AllowOrigins: []string{"https://a.example.com", "https://b.example.com"}, MaxAge: time.Minute}
+	requestRules, responseRules := headerRules(proxy.BackendOptions{CORS: cors, SecurityHeaders: true})
+
+	assert.Len(t, requestRules, 2)
+	assert.Equal(t, "set-var", requestRules[0]["type"])
+	assert.Equal(t, "req.hdr(origin)", requestRules[0]["var_expr"])
+	allowed := "{ var(txn.cors_origin) -m str -i https://a.example.com https://b.example.com }"
+	assert.Equal(t, "return", requestRules[1]["type"])
+	assert.Equal(t, 204, requestRules[1]["return_status_code"])
+	assert.Equal(t, "METH_OPTIONS { req.hdr(access-control-request-method) -m found } "+allowed, requestRules[1]["cond_test"])
+	assert.Contains(t, requestRules[1]["return_hdrs"], map[string]interface{}{"name": "Access-Control-Allow-Origin", "fmt": "%[var(txn.cors_origin)]"})
+	assert.Contains(t, requestRules[1]["return_hdrs"], map[string]interface{}{"name": "Access-Control-Max-Age", "fmt": "60"})
+
+	// Two CORS headers for allowed origins, then the security headers for all responses
+	assert.Len(t, responseRules, 2+len(proxy.SecurityHeaders))
+	assert.Equal(t, map[string]interface{}{
+		"type": "set-header", "hdr_name": "Access-Control-Allow-Origin", "hdr_format": "%[var(txn.cors_origin)]", "cond": "if", "cond_test": allowed,
+	}, responseRules[0])
+	assert.Equal(t, "add-header", responseRules[1]["type"])
+	assert.Equal(t, map[string]interface{}{"type": "set-header", "hdr_name": "X-Frame-Options", "hdr_format": "DENY"}, responseRules[3])
+
+	// Any origin is answered with *
+	requestRules, responseRules = headerRules(proxy.BackendOptions{CORS: &proxy.CORSPolicy{AllowOrigins: []string{"*"}}})
+	assert.Equal(t, "METH_OPTIONS { req.hdr(access-control-request-method) -m found } { var(txn.cors_origin) -m found }", requestRules[1]["cond_test"])
+	assert.Equal(t, "*", responseRules[0]["hdr_format"])
+
+	requestRules, responseRules = headerRules(proxy.BackendOptions{})
+	assert.Empty(t, requestRules)
+	assert.Empty(t, responseRules)
+}
+
+// toInterfaces converts strings to the values decoding them from JSON yields.
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+func TestCreateBackend_Rewrite(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "/configuration/backends/hello",
+		httpmock.NewStringResponder(404, "{}"))
+	httpmock.RegisterResponder("POST", "/configuration/backends",
+		httpmock.NewStringResponder(202, "{}"))
+	var rule map[string]interface{}
+	httpmock.RegisterResponder("POST", "/configuration/backends/hello/http_request_rules/0",
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&rule); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	err := manager.CreateBackend("hello", proxy.BackendOptions{Rewrite: "/v1"}, "txn123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"type": "replace-path", "path_match": "^/hello/?(.*)$", "path_fmt": `/v1/\1`}, rule)
+}
+
+func TestCreateBackend_GRPC(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "/configuration/backends/grpc-service",
+		httpmock.NewStringResponder(404, "{}"))
+
+	// Capture the backend definition sent to the Dataplane API
+	var backend map[string]interface{}
+	httpmock.RegisterResponder("POST", "/configuration/backends",
+		func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&backend); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	err := manager.CreateBackend("grpc-service", proxy.BackendOptions{Protocol: proxy.ProtocolH2C, HealthCheck: proxy.HealthCheckGRPC}, "txn123")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "http-keep-alive", backend["http_connection_mode"])
+	assert.Equal(t, map[string]interface{}{"proto": "h2", "check": "enabled"}, backend["default_server"])
+	check := backend["http-check"].(map[string]interface{})
+	assert.Equal(t, "POST", check["method"])
+	assert.Equal(t, proxy.GRPCHealthCheckPath, check["uri"])
+	assert.Equal(t, "HTTP/2", check["version"])
+}
+
+func TestBackendDefinition_H2(t *testing.T) {
+	backend := backendDefinition("secure-service", proxy.BackendOptions{Protocol: proxy.ProtocolH2})
+	assert.Equal(t, map[string]interface{}{"ssl": "enabled", "alpn": "h2", "verify": "none"}, backend["default_server"])
+	assert.Equal(t, "HEAD", backend["http-check"].(map[string]interface{})["method"])
+
+	backend = backendDefinition("plain-service", proxy.BackendOptions{})
+	assert.NotContains(t, backend, "default_server")
+	assert.Equal(t, "http-server-close", backend["http_connection_mode"])
+
+	backend = backendDefinition("limited-service", proxy.BackendOptions{MaxConn: 20})
+	assert.Equal(t, map[string]interface{}{"maxconn": 20}, backend["default_server"])
+}
+
 func TestAddServer(t *testing.T) {
 	// Initialize resty client
 	client := resty.New()
@@ -168,6 +557,32 @@ func TestAddServer(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestAddServer_IPv6(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	// IPv6 literals are registered bracketed, names and IPv4 addresses as given
+	var addresses []string
+	httpmock.RegisterResponder("POST", "/configuration/backends/backend1/servers",
+		func(req *http.Request) (*http.Response, error) {
+			var body map[string]interface{}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			addresses = append(addresses, body["address"].(string))
+			return httpmock.NewStringResponse(201, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+	for _, host := range []string{"::1", "127.0.0.1", "localhost"} {
+		assert.NoError(t, manager.AddServer("backend1", "server1", host, 8000, "txn123"))
+	}
+	assert.Equal(t, []string{"[::1]", "127.0.0.1", "localhost"}, addresses)
+}
+
 func TestDeleteServer(t *testing.T) {
 	// Initialize resty client
 	client := resty.New()
@@ -192,6 +607,42 @@ func TestDeleteServer(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestGetBackends(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "/configuration/backends",
+		httpmock.NewStringResponder(200, `[{"name":"api","mode":"http","description":"managed-by=herbarium"},{"name":"legacy","mode":"tcp"}]`))
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	backends, err := manager.GetBackends()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []HAProxyBackend{{Name: "api", Description: proxy.OwnerTag}, {Name: "legacy"}}, backends)
+}
+
+func TestGetRawConfiguration(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "/configuration/raw",
+		httpmock.NewStringResponder(200, `{"_version":42,"data":"global\n  daemon\n"}`))
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	raw, err := manager.GetRawConfiguration()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "global\n  daemon\n", raw)
+}
+
 func TestGetServersFromBackend(t *testing.T) {
 	// Initialize resty client
 	client := resty.New()
@@ -217,3 +668,217 @@ func TestGetServersFromBackend(t *testing.T) {
 	assert.Len(t, servers, 1)
 	assert.Equal(t, "server1", servers[0].Name)
 }
+
+func TestGetServerRequestCounts(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	// Two HAProxy processes each report their share of the sessions
+	httpmock.RegisterResponder("GET", "/services/haproxy/stats/native?parent=backend1&type=server",
+		httpmock.NewStringResponder(200, `[
+			{"runtimeAPI":"/var/run/haproxy-1.sock","stats":[{"name":"server1","type":"server","backend_name":"backend1","stats":{"stot":7}}]},
+			{"runtimeAPI":"/var/run/haproxy-2.sock","stats":[{"name":"server1","type":"server","backend_name":"backend1","stats":{"stot":5}},
+				{"name":"backend1","type":"backend","stats":{"stot":12}}]}
+		]`))
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	counts, err := manager.GetServerRequestCounts("backend1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"server1": 12}, counts)
+}
+
+func TestGetServerResponseTimes(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	// The slowest process wins, servers without requests report no response time
+	httpmock.RegisterResponder("GET", "/services/haproxy/stats/native?parent=backend1&type=server",
+		httpmock.NewStringResponder(200, `[
+			{"stats":[{"name":"server1","type":"server","stats":{"rtime":120}},{"name":"server2","type":"server","stats":{}}]},
+			{"stats":[{"name":"server1","type":"server","stats":{"rtime":80}}]}
+		]`))
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	times, err := manager.GetServerResponseTimes("backend1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"server1": 120 * time.Millisecond}, times)
+}
+
+func TestGetQueuedRequests(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	// The backend's queue and those of its servers count, in every process
+	httpmock.RegisterResponder("GET", "/services/haproxy/stats/native?name=backend1&type=backend",
+		httpmock.NewStringResponder(200, `[
+			{"stats":[{"name":"backend1","type":"backend","stats":{"qcur":4}}]},
+			{"stats":[{"name":"backend1","type":"backend","stats":{"qcur":1}}]}
+		]`))
+	httpmock.RegisterResponder("GET", "/services/haproxy/stats/native?parent=backend1&type=server",
+		httpmock.NewStringResponder(200, `[
+			{"stats":[{"name":"server1","type":"server","stats":{"qcur":2}},{"name":"server2","type":"server","stats":{}}]}
+		]`))
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	queued, err := manager.GetQueuedRequests("backend1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), queued)
+}
+
+func TestAddMaintenanceRule(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	var rule map[string]interface{}
+	httpmock.RegisterResponder("POST", "/configuration/backends/backend1/http_request_rules/0",
+		func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "txn123", req.URL.Query().Get("transaction_id"))
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&rule))
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	err := manager.AddMaintenanceRule("backend1", "<h1>Down</h1>", "txn123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "return", rule["type"])
+	assert.Equal(t, float64(503), rule["return_status_code"])
+	assert.Equal(t, "text/html", rule["return_content_type"])
+	assert.Equal(t, "<h1>Down</h1>", rule["return_content"])
+}
+
+func TestDeleteMaintenanceRule(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	// backend1 answers with the maintenance page, backend2 starts with another rule, backend3 has no rules
+	httpmock.RegisterResponder("GET", "/configuration/backends/backend1/http_request_rules/0",
+		httpmock.NewStringResponder(200, `{"index":0,"type":"return","return_status_code":503}`))
+	httpmock.RegisterResponder("GET", "/configuration/backends/backend2/http_request_rules/0",
+		httpmock.NewStringResponder(200, `{"index":0,"type":"set-header","hdr_name":"X-Forwarded-Proto"}`))
+	httpmock.RegisterResponder("GET", "/configuration/backends/backend3/http_request_rules/0",
+		httpmock.NewStringResponder(404, `{"code":404,"message":"not found"}`))
+	httpmock.RegisterResponder("DELETE", "/configuration/backends/backend1/http_request_rules/0",
+		httpmock.NewStringResponder(204, ""))
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	assert.NoError(t, manager.DeleteMaintenanceRule("backend1", "txn123"))
+	assert.NoError(t, manager.DeleteMaintenanceRule("backend2", "txn123"))
+	assert.NoError(t, manager.DeleteMaintenanceRule("backend3", "txn123"))
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE /configuration/backends/backend1/http_request_rules/0"])
+	assert.Zero(t, httpmock.GetCallCountInfo()["DELETE /configuration/backends/backend2/http_request_rules/0"])
+}
+
+func TestSetServerMaintenance(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	var server map[string]interface{}
+	httpmock.RegisterResponder("PUT", "/configuration/backends/backend1/servers/server1",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&server))
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	err := manager.SetServerMaintenance("backend1", HAProxyServer{Name: "server1", Address: "localhost", Port: 8080}, true, "txn123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "server1", "address": "localhost", "port": float64(8080), "maintenance": "enabled"}, server)
+}
+
+func TestSetServerWeight(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	var server map[string]interface{}
+	httpmock.RegisterResponder("PUT", "/configuration/backends/backend1/servers/server1",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&server))
+			return httpmock.NewStringResponse(202, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	err := manager.SetServerWeight("backend1", HAProxyServer{Name: "server1", Address: "localhost", Port: 8080}, 50, "txn123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "server1", "address": "localhost", "port": float64(8080), "weight": float64(50)}, server)
+
+	err = manager.SetServerWeight("backend1", HAProxyServer{Name: "server1"}, 300, "txn123")
+	assert.EqualError(t, err, "weight 300 of server server1 is out of range 0-256")
+}
+
+func TestGetServerSessions(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "/services/haproxy/stats/native?parent=backend1&type=server",
+		httpmock.NewStringResponder(200, `[
+			{"stats":[{"name":"server1","type":"server","stats":{"scur":2}},{"name":"server2","type":"server","stats":{}}]},
+			{"stats":[{"name":"server1","type":"server","stats":{"scur":1}}]}
+		]`))
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	sessions, err := manager.GetServerSessions("backend1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), sessions["server1"])
+	assert.Zero(t, sessions["server2"])
+}
+
+func TestDrainServer(t *testing.T) {
+	client := resty.New()
+	httpmock.ActivateNonDefault(client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	var state map[string]interface{}
+	httpmock.RegisterResponder("PUT", "/services/haproxy/runtime/backends/backend1/servers/server1",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&state))
+			return httpmock.NewStringResponse(200, "{}"), nil
+		})
+
+	manager := &HAProxyConfigurationManager{
+		client: client,
+	}
+
+	err := manager.DrainServer("backend1", "server1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"admin_state": "drain"}, state)
+}
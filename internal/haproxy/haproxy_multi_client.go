@@ -0,0 +1,458 @@
+package haproxy
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// HAProxyInstance is a named HAProxy Dataplane API endpoint.
+type HAProxyInstance struct {
+	Name   string
+	Client HAProxyClientInterface
+}
+
+// PartialFailureError reports an operation that failed on some HAProxy instances.
+// Succeeded lists the instances that applied the change, which is not rolled back there.
+type PartialFailureError struct {
+	Operation string
+	Succeeded []string
+	Failed    map[string]error
+}
+
+// Error summarizes the failed instances and their errors.
+func (e *PartialFailureError) Error() string {
+	names := make([]string, 0, len(e.Failed))
+	for name := range e.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failures := make([]string, 0, len(names))
+	for _, name := range names {
+		failures = append(failures, fmt.Sprintf("%s: %v", name, e.Failed[name]))
+	}
+	return fmt.Sprintf("%s failed on %d of %d HAProxy instances (%s)", e.Operation, len(e.Failed),
+		len(e.Failed)+len(e.Succeeded), strings.Join(failures, "; "))
+}
+
+// Unwrap returns the errors of the failed instances, so errors.Is finds them.
+func (e *PartialFailureError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// MultiHAProxyClient applies every operation to several HAProxy instances, such as a redundant load
+// balancer pair. Each instance runs the operation in its own transaction, concurrently with the others.
+type MultiHAProxyClient struct {
+	instances []HAProxyInstance
+}
+
+// NewMultiHAProxyClient creates a client applying operations to all instances.
+func NewMultiHAProxyClient(instances []HAProxyInstance) *MultiHAProxyClient {
+	return &MultiHAProxyClient{instances: instances}
+}
+
+// NewHAProxyClients creates a client for each configuration, combining them when there is more than one.
+func NewHAProxyClients(configs []HAProxyConfig) HAProxyClientInterface {
+	instances := make([]HAProxyInstance, len(configs))
+	for i, config := range configs {
+		instances[i] = HAProxyInstance{
+			Name:   config.Name,
+			Client: NewHAProxyClient(config, NewHAProxyConfigurationManager(config)),
+		}
+	}
+	if len(instances) == 1 {
+		return instances[0].Client
+	}
+	return NewMultiHAProxyClient(instances)
+}
+
+// each runs operation against every instance and returns a PartialFailureError if any of them failed.
+func (c *MultiHAProxyClient) each(operation string, fn func(client HAProxyClientInterface) error) error {
+	errs := make([]error, len(c.instances))
+	var wg sync.WaitGroup
+	for i, instance := range c.instances {
+		wg.Add(1)
+		go func(i int, instance HAProxyInstance) {
+			defer wg.Done()
+			errs[i] = fn(instance.Client)
+		}(i, instance)
+	}
+	wg.Wait()
+
+	failure := &PartialFailureError{Operation: operation, Failed: make(map[string]error)}
+	for i, instance := range c.instances {
+		if errs[i] != nil {
+			log.Printf("[HAProxyClient] %s failed on instance %s: %v", operation, instance.Name, errs[i])
+			failure.Failed[instance.Name] = errs[i]
+		} else {
+			failure.Succeeded = append(failure.Succeeded, instance.Name)
+		}
+	}
+	if len(failure.Failed) > 0 {
+		return failure
+	}
+	return nil
+}
+
+// BindStem creates the backend on every instance.
+func (c *MultiHAProxyClient) BindStem(backendName string, options proxy.BackendOptions) error {
+	return c.each(fmt.Sprintf("binding stem %s", backendName), func(client HAProxyClientInterface) error {
+		return client.BindStem(backendName, options)
+	})
+}
+
+// BindLeaf adds the leaf's server to the backend on every instance.
+func (c *MultiHAProxyClient) BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error {
+	return c.each(fmt.Sprintf("binding leaf %s", leafID), func(client HAProxyClientInterface) error {
+		return client.BindLeaf(backendName, leafID, serviceAddress, servicePort)
+	})
+}
+
+// UnbindLeaf removes the leaf's server from the backend on every instance.
+func (c *MultiHAProxyClient) UnbindLeaf(backendName, haProxyServer string) error {
+	return c.each(fmt.Sprintf("unbinding leaf %s", haProxyServer), func(client HAProxyClientInterface) error {
+		return client.UnbindLeaf(backendName, haProxyServer)
+	})
+}
+
+// ReplaceLeaf swaps the leaf's server in the backend on every instance.
+func (c *MultiHAProxyClient) ReplaceLeaf(backendName, oldHAProxyServer, newHAProxyServer, serviceAddress string, servicePort int) error {
+	return c.each(fmt.Sprintf("replacing leaf %s with %s", oldHAProxyServer, newHAProxyServer), func(client HAProxyClientInterface) error {
+		return client.ReplaceLeaf(backendName, oldHAProxyServer, newHAProxyServer, serviceAddress, servicePort)
+	})
+}
+
+// UnbindStem removes the backend's servers on every instance.
+func (c *MultiHAProxyClient) UnbindStem(backendName string) error {
+	return c.each(fmt.Sprintf("unbinding stem %s", backendName), func(client HAProxyClientInterface) error {
+		return client.UnbindStem(backendName)
+	})
+}
+
+// EnterMaintenance puts the backends into maintenance on every instance.
+func (c *MultiHAProxyClient) EnterMaintenance(backendNames []string, page string) error {
+	return c.each("entering maintenance", func(client HAProxyClientInterface) error {
+		switcher, ok := client.(proxy.MaintenanceSwitcher)
+		if !ok {
+			return fmt.Errorf("instance does not support maintenance mode")
+		}
+		return switcher.EnterMaintenance(backendNames, page)
+	})
+}
+
+// ExitMaintenance takes the backends out of maintenance on every instance.
+func (c *MultiHAProxyClient) ExitMaintenance(backendNames []string) error {
+	return c.each("exiting maintenance", func(client HAProxyClientInterface) error {
+		switcher, ok := client.(proxy.MaintenanceSwitcher)
+		if !ok {
+			return fmt.Errorf("instance does not support maintenance mode")
+		}
+		return switcher.ExitMaintenance(backendNames)
+	})
+}
+
+// SetBackendMaintenance puts the servers of a backend into maintenance, or takes them out, on every instance.
+func (c *MultiHAProxyClient) SetBackendMaintenance(backendName string, enabled bool, page string) error {
+	return c.each(fmt.Sprintf("switching maintenance of %s", backendName), func(client HAProxyClientInterface) error {
+		switcher, ok := client.(proxy.BackendMaintenanceSwitcher)
+		if !ok {
+			return fmt.Errorf("instance does not support maintenance mode")
+		}
+		return switcher.SetBackendMaintenance(backendName, enabled, page)
+	})
+}
+
+// SetServerWeights sets the weights of servers of a backend on every instance.
+func (c *MultiHAProxyClient) SetServerWeights(backendName string, weights map[string]int) error {
+	return c.each(fmt.Sprintf("setting server weights of %s", backendName), func(client HAProxyClientInterface) error {
+		setter, ok := client.(proxy.WeightSetter)
+		if !ok {
+			return fmt.Errorf("instance does not support setting server weights")
+		}
+		return setter.SetServerWeights(backendName, weights)
+	})
+}
+
+// ExportConfig returns the managed configuration of every instance, each under a comment naming it.
+func (c *MultiHAProxyClient) ExportConfig() (string, error) {
+	var mu sync.Mutex
+	exports := make(map[HAProxyClientInterface]string, len(c.instances))
+	err := c.each("exporting configuration", func(client HAProxyClientInterface) error {
+		exporter, ok := client.(proxy.ConfigExporter)
+		if !ok {
+			return fmt.Errorf("instance does not export its configuration")
+		}
+		config, err := exporter.ExportConfig()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		exports[client] = config
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(c.instances))
+	for _, instance := range c.instances {
+		parts = append(parts, fmt.Sprintf("# HAProxy instance %s\n%s", instance.Name, exports[instance.Client]))
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// DrainServer drains a server on every instance.
+func (c *MultiHAProxyClient) DrainServer(backendName, serverName string) error {
+	return c.each(fmt.Sprintf("draining %s", serverName), func(client HAProxyClientInterface) error {
+		drainer, ok := client.(proxy.Drainer)
+		if !ok {
+			return fmt.Errorf("instance does not support draining")
+		}
+		return drainer.DrainServer(backendName, serverName)
+	})
+}
+
+// ActiveSessions sums the sessions each server of a backend is handling across all instances.
+func (c *MultiHAProxyClient) ActiveSessions(backendName string) (map[string]int64, error) {
+	var mu sync.Mutex
+	sessions := make(map[string]int64)
+	err := c.each(fmt.Sprintf("counting active sessions of %s", backendName), func(client HAProxyClientInterface) error {
+		drainer, ok := client.(proxy.Drainer)
+		if !ok {
+			return fmt.Errorf("instance does not report active sessions")
+		}
+		instanceSessions, err := drainer.ActiveSessions(backendName)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for server, count := range instanceSessions {
+			sessions[server] += count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Servers returns the servers of a backend on any instance, so servers left behind on a single instance are
+// listed too.
+func (c *MultiHAProxyClient) Servers(backendName string) ([]string, error) {
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	err := c.each(fmt.Sprintf("listing servers of %s", backendName), func(client HAProxyClientInterface) error {
+		lister, ok := client.(proxy.ServerLister)
+		if !ok {
+			return fmt.Errorf("instance does not list servers")
+		}
+		servers, err := lister.Servers(backendName)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, server := range servers {
+			seen[server] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(seen))
+	for server := range seen {
+		names = append(names, server)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Backends returns the backends present on every instance, so a backend missing on a single instance is
+// reported missing.
+func (c *MultiHAProxyClient) Backends() ([]string, error) {
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	err := c.each("listing backends", func(client HAProxyClientInterface) error {
+		lister, ok := client.(proxy.BackendLister)
+		if !ok {
+			return fmt.Errorf("instance does not list backends")
+		}
+		backends, err := lister.Backends()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, backend := range backends {
+			seen[backend]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(seen))
+	for backend, instances := range seen {
+		if instances == len(c.instances) {
+			names = append(names, backend)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// OwnedBackends returns the backends herbarium created on any instance, so its backends left behind on a
+// single instance are listed too.
+func (c *MultiHAProxyClient) OwnedBackends() ([]string, error) {
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	err := c.each("listing owned backends", func(client HAProxyClientInterface) error {
+		reporter, ok := client.(proxy.OwnershipReporter)
+		if !ok {
+			return fmt.Errorf("instance does not tag its backends")
+		}
+		backends, err := reporter.OwnedBackends()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, backend := range backends {
+			seen[backend] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(seen))
+	for backend := range seen {
+		names = append(names, backend)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RequestCounts sums the requests each server of a backend has handled across all instances. Instances that
+// can't report counts fail the whole call, since a partial sum would undercount.
+func (c *MultiHAProxyClient) RequestCounts(backendName string) (map[string]int64, error) {
+	var mu sync.Mutex
+	counts := make(map[string]int64)
+	err := c.each(fmt.Sprintf("counting requests of %s", backendName), func(client HAProxyClientInterface) error {
+		counter, ok := client.(proxy.RequestCounter)
+		if !ok {
+			return fmt.Errorf("instance does not report request counts")
+		}
+		instanceCounts, err := counter.RequestCounts(backendName)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for server, count := range instanceCounts {
+			counts[server] += count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// QueuedRequests sums the requests waiting for a server of a backend across all instances, as each instance
+// queues the requests it received.
+func (c *MultiHAProxyClient) QueuedRequests(backendName string) (int64, error) {
+	var mu sync.Mutex
+	var queued int64
+	err := c.each(fmt.Sprintf("counting queued requests of %s", backendName), func(client HAProxyClientInterface) error {
+		reporter, ok := client.(proxy.QueueReporter)
+		if !ok {
+			return fmt.Errorf("instance does not report queued requests")
+		}
+		instanceQueued, err := reporter.QueuedRequests(backendName)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		queued += instanceQueued
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return queued, nil
+}
+
+// EjectedServers returns the servers of a backend any instance took out of rotation, as a leaf failing its
+// responses on one instance is failing them on all.
+func (c *MultiHAProxyClient) EjectedServers(backendName string) ([]string, error) {
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	err := c.each(fmt.Sprintf("listing ejected servers of %s", backendName), func(client HAProxyClientInterface) error {
+		reporter, ok := client.(proxy.EjectionReporter)
+		if !ok {
+			return fmt.Errorf("instance does not report ejected servers")
+		}
+		servers, err := reporter.EjectedServers(backendName)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, server := range servers {
+			seen[server] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(seen))
+	for server := range seen {
+		names = append(names, server)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ResponseTimes returns the recent average response time of each server of a backend, the slowest reported
+// by any instance.
+func (c *MultiHAProxyClient) ResponseTimes(backendName string) (map[string]time.Duration, error) {
+	var mu sync.Mutex
+	times := make(map[string]time.Duration)
+	err := c.each(fmt.Sprintf("measuring response times of %s", backendName), func(client HAProxyClientInterface) error {
+		reporter, ok := client.(proxy.LatencyReporter)
+		if !ok {
+			return fmt.Errorf("instance does not report response times")
+		}
+		instanceTimes, err := reporter.ResponseTimes(backendName)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for server, responseTime := range instanceTimes {
+			times[server] = max(times[server], responseTime)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return times, nil
+}
@@ -0,0 +1,110 @@
+package haproxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newMockInstance creates an instance backed by a mock configuration manager with its own transaction ID.
+func newMockInstance(name, transactionID string) (HAProxyInstance, *MockHAProxyConfigurationManager) {
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil)
+	mockManager.On("StartTransaction", int64(1)).Return(transactionID, nil)
+	client := &HAProxyClient{
+		configManager:         mockManager,
+		transactionMiddleware: NewTransactionMiddleware(mockManager),
+	}
+	return HAProxyInstance{Name: name, Client: client}, mockManager
+}
+
+func TestMultiHAProxyClient_BindLeafOnAllInstances(t *testing.T) {
+	primary, primaryManager := newMockInstance("lb-a", "txn-a")
+	secondary, secondaryManager := newMockInstance("lb-b", "txn-b")
+	primaryManager.On("AddServer", "backend1", "server1", "10.0.0.5", 8080, "txn-a").Return(nil)
+	primaryManager.On("CommitTransaction", "txn-a").Return(nil)
+	secondaryManager.On("AddServer", "backend1", "server1", "10.0.0.5", 8080, "txn-b").Return(nil)
+	secondaryManager.On("CommitTransaction", "txn-b").Return(nil)
+
+	client := NewMultiHAProxyClient([]HAProxyInstance{primary, secondary})
+	assert.NoError(t, client.BindLeaf("backend1", "server1", "10.0.0.5", 8080))
+
+	primaryManager.AssertExpectations(t)
+	secondaryManager.AssertExpectations(t)
+}
+
+func TestMultiHAProxyClient_ReportsPartialFailure(t *testing.T) {
+	primary, primaryManager := newMockInstance("lb-a", "txn-a")
+	secondary, secondaryManager := newMockInstance("lb-b", "txn-b")
+	primaryManager.On("DeleteServer", "backend1", "server1", "txn-a").Return(nil)
+	primaryManager.On("CommitTransaction", "txn-a").Return(nil)
+	secondaryManager.On("DeleteServer", "backend1", "server1", "txn-b").Return(errors.New("connection refused"))
+	secondaryManager.On("RollbackTransaction", "txn-b").Return(nil)
+
+	client := NewMultiHAProxyClient([]HAProxyInstance{primary, secondary})
+	err := client.UnbindLeaf("backend1", "server1")
+
+	// Only the failing instance rolls back its transaction
+	var partial *PartialFailureError
+	if assert.ErrorAs(t, err, &partial) {
+		assert.Equal(t, []string{"lb-a"}, partial.Succeeded)
+		assert.Contains(t, partial.Failed, "lb-b")
+	}
+	assert.ErrorContains(t, err, "unbinding leaf server1 failed on 1 of 2 HAProxy instances (lb-b: failed to unbind leaf service: connection refused)")
+	primaryManager.AssertExpectations(t)
+	secondaryManager.AssertExpectations(t)
+}
+
+func TestMultiHAProxyClient_SumsRequestCounts(t *testing.T) {
+	primary, primaryManager := newMockInstance("lb-a", "txn-a")
+	secondary, secondaryManager := newMockInstance("lb-b", "txn-b")
+	primaryManager.On("GetServerRequestCounts", "backend1").Return(map[string]int64{"server1": 10, "server2": 3}, nil)
+	secondaryManager.On("GetServerRequestCounts", "backend1").Return(map[string]int64{"server1": 5}, nil)
+
+	client := NewMultiHAProxyClient([]HAProxyInstance{primary, secondary})
+	counts, err := client.RequestCounts("backend1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"server1": 15, "server2": 3}, counts)
+}
+
+func TestMultiHAProxyClient_ExportsConfigOfEveryInstance(t *testing.T) {
+	primary, primaryManager := newMockInstance("lb-a", "txn-a")
+	secondary, secondaryManager := newMockInstance("lb-b", "txn-b")
+	primaryManager.On("GetRawConfiguration").Return("backend api\n  description managed-by=herbarium\n", nil)
+	secondaryManager.On("GetRawConfiguration").Return("backend api\n  description managed-by=herbarium\n  server api-1 localhost:8001\n", nil)
+
+	client := NewMultiHAProxyClient([]HAProxyInstance{primary, secondary})
+	config, err := client.ExportConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "# HAProxy instance lb-a\nbackend api\n  description managed-by=herbarium\n\n"+
+		"# HAProxy instance lb-b\nbackend api\n  description managed-by=herbarium\n  server api-1 localhost:8001\n", config)
+}
+
+func TestMultiHAProxyClient_ListsServersOfAnyInstance(t *testing.T) {
+	primary, primaryManager := newMockInstance("lb-a", "txn-a")
+	secondary, secondaryManager := newMockInstance("lb-b", "txn-b")
+	primaryManager.On("GetServersFromBackend", "backend1", "").Return([]HAProxyServer{{Name: "server2"}, {Name: "server1"}}, nil)
+	secondaryManager.On("GetServersFromBackend", "backend1", "").Return([]HAProxyServer{{Name: "server1"}, {Name: "stale"}}, nil)
+
+	client := NewMultiHAProxyClient([]HAProxyInstance{primary, secondary})
+	servers, err := client.Servers("backend1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"server1", "server2", "stale"}, servers)
+}
+
+func TestMultiHAProxyClient_ListsBackendsOfEveryInstance(t *testing.T) {
+	primary, primaryManager := newMockInstance("lb-a", "txn-a")
+	secondary, secondaryManager := newMockInstance("lb-b", "txn-b")
+	primaryManager.On("GetBackends").Return([]HAProxyBackend{{Name: "web"}, {Name: "api"}}, nil)
+	secondaryManager.On("GetBackends").Return([]HAProxyBackend{{Name: "api"}}, nil)
+
+	client := NewMultiHAProxyClient([]HAProxyInstance{primary, secondary})
+	backends, err := client.Backends()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api"}, backends)
+}
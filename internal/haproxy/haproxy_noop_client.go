@@ -0,0 +1,58 @@
+package haproxy
+
+import (
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// HAProxy modes selectable with haproxy.mode.
+const (
+	ModeDataplane = "dataplane" // Manage HAProxy through its Dataplane API (default)
+	ModeNone      = "none"      // Run without HAProxy, logging what would have been configured
+)
+
+// NoopHAProxyClient stands in for HAProxy during local development: it changes nothing and logs every
+// operation, so services can run under herbarium without HAProxy or the Dataplane API installed. Requests
+// reach the leafs directly on the ports it logs.
+type NoopHAProxyClient struct{}
+
+// NewNoopHAProxyClient returns a client that only logs what it is asked to configure.
+func NewNoopHAProxyClient() *NoopHAProxyClient {
+	log.Printf("[HAProxyClient] haproxy.mode is %s, proxy changes are only logged", ModeNone)
+	return &NoopHAProxyClient{}
+}
+
+// BindStem logs the backend that would have been created.
+func (c *NoopHAProxyClient) BindStem(backendName string, options proxy.BackendOptions) error {
+	log.Printf("[HAProxyClient] Would create backend %s for %s", backendName, options.RoutePath(backendName))
+	return nil
+}
+
+// BindLeaf logs the server that would have been added, with the address the leaf serves requests at.
+func (c *NoopHAProxyClient) BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error {
+	log.Printf("[HAProxyClient] Would add server %s to backend %s, the leaf serves at %s",
+		leafID, backendName, net.JoinHostPort(serviceAddress, strconv.Itoa(servicePort)))
+	return nil
+}
+
+// UnbindLeaf logs the server that would have been removed.
+func (c *NoopHAProxyClient) UnbindLeaf(backendName, serverName string) error {
+	log.Printf("[HAProxyClient] Would remove server %s from backend %s", serverName, backendName)
+	return nil
+}
+
+// ReplaceLeaf logs the servers that would have been swapped.
+func (c *NoopHAProxyClient) ReplaceLeaf(backendName, oldServerName, newServerName, serviceAddress string, servicePort int) error {
+	log.Printf("[HAProxyClient] Would replace server %s of backend %s with %s, the leaf serves at %s",
+		oldServerName, backendName, newServerName, net.JoinHostPort(serviceAddress, strconv.Itoa(servicePort)))
+	return nil
+}
+
+// UnbindStem logs the backend that would have been emptied.
+func (c *NoopHAProxyClient) UnbindStem(backendName string) error {
+	log.Printf("[HAProxyClient] Would remove the servers of backend %s", backendName)
+	return nil
+}
@@ -0,0 +1,371 @@
+package haproxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// ErrUnauthorized is returned when the Dataplane API rejects herbarium's credentials.
+var ErrUnauthorized = errors.New("the Dataplane API rejected the credentials")
+
+// ErrDegraded is returned by a DeferringClient for everything but bindings while HAProxy is unreachable.
+var ErrDegraded = errors.New("HAProxy is unreachable, herbarium is running degraded")
+
+// maxReconnectBackoff caps the wait between checks of a DeferringClient waiting for HAProxy.
+const maxReconnectBackoff = time.Minute
+
+// maxDeferredAttempts bounds how often a DeferringClient applies a deferred binding HAProxy rejects before
+// dropping it, leaving the drift reconciler to repair the backend.
+const maxDeferredAttempts = 5
+
+// Pinger is implemented by HAProxy clients that can check that the Dataplane API is reachable and accepts
+// their credentials.
+type Pinger interface {
+	Ping() error
+}
+
+// Ping reads the configuration version, which needs the Dataplane API to be reachable and accept the client's
+// credentials.
+func (c *HAProxyClient) Ping() error {
+	_, err := c.configManager.GetCurrentConfigVersion()
+	return err
+}
+
+// Ping checks every instance.
+func (c *MultiHAProxyClient) Ping() error {
+	return c.each("checking the Dataplane API", func(client HAProxyClientInterface) error {
+		pinger, ok := client.(Pinger)
+		if !ok {
+			return nil
+		}
+		return pinger.Ping()
+	})
+}
+
+// PreflightConfig sets how the Dataplane API is checked at startup.
+type PreflightConfig struct {
+	Attempts int           // Checks before giving up, at least 1
+	Backoff  time.Duration // Wait after the first failed check, doubled after every further one
+	Degraded bool          // Defer bindings until HAProxy is reachable instead of failing when it stays unreachable
+}
+
+// Preflight checks that the Dataplane API behind client is reachable and accepts its credentials before
+// herbarium relies on it, retrying with backoff. Rejected credentials fail at once, as retrying won't fix them.
+// When HAProxy stays unreachable, Preflight fails, or with PreflightConfig.Degraded returns a DeferringClient
+// that holds bindings back until it is reachable again. A reachable HAProxy gets client itself.
+func Preflight(client HAProxyClientInterface, config PreflightConfig) (HAProxyClientInterface, error) {
+	pinger, ok := client.(Pinger)
+	if !ok {
+		return client, nil
+	}
+	var err error
+	wait := config.Backoff
+	for attempt := 1; attempt <= max(config.Attempts, 1); attempt++ {
+		if attempt > 1 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		if err = pinger.Ping(); err == nil {
+			return client, nil
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			return nil, fmt.Errorf("HAProxy preflight failed: %w", err)
+		}
+		log.Printf("HAProxy preflight check %d of %d failed: %v", attempt, max(config.Attempts, 1), err)
+	}
+	if !config.Degraded {
+		return nil, fmt.Errorf("HAProxy is unreachable after %d checks: %w", max(config.Attempts, 1), err)
+	}
+	log.Printf("HAProxy is unreachable, starting degraded with proxy bindings deferred until it is reachable")
+	return NewDeferringClient(client, config.Backoff), nil
+}
+
+// deferredBinding is a binding a DeferringClient holds back, described for logs.
+type deferredBinding struct {
+	description string
+	apply       func() error
+	failures    int // Times HAProxy rejected it once reachable
+}
+
+// DeferringClient runs herbarium degraded while HAProxy is unreachable: stems register and leafs start as
+// usual, but their bindings are queued instead of failing, and everything else the client offers fails with
+// ErrDegraded. The client checks HAProxy in the background with growing backoff, and once it is reachable
+// applies the queued bindings in order and passes everything through from then on. A binding that fails is
+// kept queued with the ones after it and retried with the same backoff, so none is lost or overtaken by a
+// later one; after maxDeferredAttempts failures it is dropped.
+type DeferringClient struct {
+	client HAProxyClientInterface
+
+	mu       sync.RWMutex // Held for writing while the queued bindings are applied
+	degraded bool
+	queueMu  sync.Mutex
+	deferred []deferredBinding
+	resumed  chan struct{} // Closed once the queued bindings were applied
+}
+
+// NewDeferringClient returns a degraded client for the unreachable HAProxy behind client, checking it every
+// backoff at first.
+func NewDeferringClient(client HAProxyClientInterface, backoff time.Duration) *DeferringClient {
+	c := &DeferringClient{client: client, degraded: true, resumed: make(chan struct{})}
+	go c.reconnect(backoff)
+	return c
+}
+
+// Degraded reports whether HAProxy has not been reachable yet, and bindings are deferred.
+func (c *DeferringClient) Degraded() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.degraded
+}
+
+// Resumed returns a channel closed once HAProxy was reachable again and the deferred bindings were applied.
+func (c *DeferringClient) Resumed() <-chan struct{} {
+	return c.resumed
+}
+
+// reconnect checks HAProxy until it is reachable and every deferred binding was applied, then stops deferring.
+// Clients that can't be checked are tried after the first wait.
+func (c *DeferringClient) reconnect(backoff time.Duration) {
+	pinger, ok := c.client.(Pinger)
+	wait := max(backoff, time.Millisecond)
+	for {
+		time.Sleep(wait)
+		var err error
+		if ok {
+			err = pinger.Ping()
+		}
+		if err != nil {
+			log.Printf("HAProxy is still unreachable, checking again in %s: %v", min(wait*2, maxReconnectBackoff), err)
+		} else if err = c.resume(); err == nil {
+			return
+		} else {
+			log.Printf("HAProxy is reachable but %v, retrying in %s", err, min(wait*2, maxReconnectBackoff))
+		}
+		wait = min(wait*2, maxReconnectBackoff)
+	}
+}
+
+// resume applies the deferred bindings in the order they were made and stops deferring. Bindings made
+// meanwhile wait for it, so none overtakes a deferred one. At the first binding that fails it stops, keeping
+// that binding and the ones after it queued, and returns an error.
+func (c *DeferringClient) resume() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+
+	applied, dropped := 0, 0
+	for len(c.deferred) > 0 {
+		binding := &c.deferred[0]
+		if err := binding.apply(); err != nil {
+			binding.failures++
+			if binding.failures < maxDeferredAttempts {
+				log.Printf("Failed to %s after HAProxy became reachable, attempt %d of %d: %v", binding.description, binding.failures, maxDeferredAttempts, err)
+				return fmt.Errorf("%d deferred bindings are still pending", len(c.deferred))
+			}
+			log.Printf("Failed to %s after %d attempts, dropping it for the drift reconciler to repair: %v", binding.description, binding.failures, err)
+			dropped++
+		} else {
+			applied++
+		}
+		c.deferred = c.deferred[1:]
+	}
+	c.deferred = nil
+	c.degraded = false
+	close(c.resumed)
+	log.Printf("HAProxy is reachable, applied the remaining %d deferred bindings and dropped %d", applied, dropped)
+	return nil
+}
+
+// binding applies a binding, or queues it while degraded.
+func (c *DeferringClient) binding(description string, apply func() error) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.degraded {
+		return apply()
+	}
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	c.deferred = append(c.deferred, deferredBinding{description: description, apply: apply})
+	log.Printf("HAProxy is unreachable, deferring: %s", description)
+	return nil
+}
+
+// capability returns the client as T, failing while degraded or when the client doesn't implement T.
+func capability[T any](c *DeferringClient) (T, error) {
+	var zero T
+	if c.Degraded() {
+		return zero, ErrDegraded
+	}
+	implementation, ok := c.client.(T)
+	if !ok {
+		return zero, fmt.Errorf("the HAProxy client does not implement %T", &zero)
+	}
+	return implementation, nil
+}
+
+// BindStem creates the backend, or defers it while degraded.
+func (c *DeferringClient) BindStem(backendName string, options proxy.BackendOptions) error {
+	return c.binding(fmt.Sprintf("bind stem %s", backendName), func() error {
+		return c.client.BindStem(backendName, options)
+	})
+}
+
+// BindLeaf adds the leaf's server, or defers it while degraded.
+func (c *DeferringClient) BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error {
+	return c.binding(fmt.Sprintf("bind leaf %s to backend %s", leafID, backendName), func() error {
+		return c.client.BindLeaf(backendName, leafID, serviceAddress, servicePort)
+	})
+}
+
+// UnbindLeaf removes the leaf's server, or defers it while degraded.
+func (c *DeferringClient) UnbindLeaf(backendName, serverName string) error {
+	return c.binding(fmt.Sprintf("unbind server %s from backend %s", serverName, backendName), func() error {
+		return c.client.UnbindLeaf(backendName, serverName)
+	})
+}
+
+// ReplaceLeaf swaps the servers, or defers it while degraded.
+func (c *DeferringClient) ReplaceLeaf(backendName, oldServerName, newServerName, serviceAddress string, servicePort int) error {
+	return c.binding(fmt.Sprintf("replace server %s of backend %s with %s", oldServerName, backendName, newServerName), func() error {
+		return c.client.ReplaceLeaf(backendName, oldServerName, newServerName, serviceAddress, servicePort)
+	})
+}
+
+// UnbindStem removes the backend's servers, or defers it while degraded.
+func (c *DeferringClient) UnbindStem(backendName string) error {
+	return c.binding(fmt.Sprintf("unbind stem %s", backendName), func() error {
+		return c.client.UnbindStem(backendName)
+	})
+}
+
+// RequestCounts passes through once HAProxy is reachable.
+func (c *DeferringClient) RequestCounts(backendName string) (map[string]int64, error) {
+	counter, err := capability[proxy.RequestCounter](c)
+	if err != nil {
+		return nil, err
+	}
+	return counter.RequestCounts(backendName)
+}
+
+// ResponseTimes passes through once HAProxy is reachable.
+func (c *DeferringClient) ResponseTimes(backendName string) (map[string]time.Duration, error) {
+	reporter, err := capability[proxy.LatencyReporter](c)
+	if err != nil {
+		return nil, err
+	}
+	return reporter.ResponseTimes(backendName)
+}
+
+// QueuedRequests passes through once HAProxy is reachable.
+func (c *DeferringClient) QueuedRequests(backendName string) (int64, error) {
+	reporter, err := capability[proxy.QueueReporter](c)
+	if err != nil {
+		return 0, err
+	}
+	return reporter.QueuedRequests(backendName)
+}
+
+// EjectedServers passes through once HAProxy is reachable.
+func (c *DeferringClient) EjectedServers(backendName string) ([]string, error) {
+	reporter, err := capability[proxy.EjectionReporter](c)
+	if err != nil {
+		return nil, err
+	}
+	return reporter.EjectedServers(backendName)
+}
+
+// DrainServer passes through once HAProxy is reachable.
+func (c *DeferringClient) DrainServer(backendName, serverName string) error {
+	drainer, err := capability[proxy.Drainer](c)
+	if err != nil {
+		return err
+	}
+	return drainer.DrainServer(backendName, serverName)
+}
+
+// ActiveSessions passes through once HAProxy is reachable.
+func (c *DeferringClient) ActiveSessions(backendName string) (map[string]int64, error) {
+	drainer, err := capability[proxy.Drainer](c)
+	if err != nil {
+		return nil, err
+	}
+	return drainer.ActiveSessions(backendName)
+}
+
+// Servers passes through once HAProxy is reachable.
+func (c *DeferringClient) Servers(backendName string) ([]string, error) {
+	lister, err := capability[proxy.ServerLister](c)
+	if err != nil {
+		return nil, err
+	}
+	return lister.Servers(backendName)
+}
+
+// Backends passes through once HAProxy is reachable.
+func (c *DeferringClient) Backends() ([]string, error) {
+	lister, err := capability[proxy.BackendLister](c)
+	if err != nil {
+		return nil, err
+	}
+	return lister.Backends()
+}
+
+// OwnedBackends passes through once HAProxy is reachable.
+func (c *DeferringClient) OwnedBackends() ([]string, error) {
+	reporter, err := capability[proxy.OwnershipReporter](c)
+	if err != nil {
+		return nil, err
+	}
+	return reporter.OwnedBackends()
+}
+
+// SetServerWeights passes through once HAProxy is reachable.
+func (c *DeferringClient) SetServerWeights(backendName string, weights map[string]int) error {
+	setter, err := capability[proxy.WeightSetter](c)
+	if err != nil {
+		return err
+	}
+	return setter.SetServerWeights(backendName, weights)
+}
+
+// ExportConfig passes through once HAProxy is reachable.
+func (c *DeferringClient) ExportConfig() (string, error) {
+	exporter, err := capability[proxy.ConfigExporter](c)
+	if err != nil {
+		return "", err
+	}
+	return exporter.ExportConfig()
+}
+
+// EnterMaintenance passes through once HAProxy is reachable.
+func (c *DeferringClient) EnterMaintenance(backendNames []string, page string) error {
+	switcher, err := capability[proxy.MaintenanceSwitcher](c)
+	if err != nil {
+		return err
+	}
+	return switcher.EnterMaintenance(backendNames, page)
+}
+
+// ExitMaintenance passes through once HAProxy is reachable.
+func (c *DeferringClient) ExitMaintenance(backendNames []string) error {
+	switcher, err := capability[proxy.MaintenanceSwitcher](c)
+	if err != nil {
+		return err
+	}
+	return switcher.ExitMaintenance(backendNames)
+}
+
+// SetBackendMaintenance passes through once HAProxy is reachable.
+func (c *DeferringClient) SetBackendMaintenance(backendName string, enabled bool, page string) error {
+	switcher, err := capability[proxy.BackendMaintenanceSwitcher](c)
+	if err != nil {
+		return err
+	}
+	return switcher.SetBackendMaintenance(backendName, enabled, page)
+}
@@ -0,0 +1,157 @@
+package haproxy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyClient is an HAProxy client whose Dataplane API is reachable once up is set, recording the bindings
+// it applied. The next rejects leaf bindings fail.
+type flakyClient struct {
+	up      atomic.Bool
+	pings   atomic.Int32
+	rejects atomic.Int32
+	mu      sync.Mutex
+	calls   []string
+}
+
+func (c *flakyClient) Ping() error {
+	c.pings.Add(1)
+	if !c.up.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (c *flakyClient) record(call string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+	return nil
+}
+
+func (c *flakyClient) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+func (c *flakyClient) BindStem(backendName string, options proxy.BackendOptions) error {
+	return c.record("bind " + backendName)
+}
+
+func (c *flakyClient) BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error {
+	if c.rejects.Add(-1) >= 0 {
+		return errors.New("transaction conflict")
+	}
+	return c.record(fmt.Sprintf("bind %s/%s", backendName, leafID))
+}
+
+func (c *flakyClient) UnbindLeaf(backendName, serverName string) error {
+	return c.record(fmt.Sprintf("unbind %s/%s", backendName, serverName))
+}
+
+func (c *flakyClient) ReplaceLeaf(backendName, oldServerName, newServerName, serviceAddress string, servicePort int) error {
+	return c.record(fmt.Sprintf("replace %s/%s", backendName, oldServerName))
+}
+
+func (c *flakyClient) UnbindStem(backendName string) error {
+	return c.record("unbind " + backendName)
+}
+
+func (c *flakyClient) Servers(backendName string) ([]string, error) {
+	return []string{"server1"}, nil
+}
+
+func TestPreflight(t *testing.T) {
+	// A reachable HAProxy gets the client itself
+	client := &flakyClient{}
+	client.up.Store(true)
+	checked, err := Preflight(client, PreflightConfig{Attempts: 3, Backoff: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Same(t, client, checked)
+
+	// An unreachable one fails after every check
+	client = &flakyClient{}
+	_, err = Preflight(client, PreflightConfig{Attempts: 3, Backoff: time.Millisecond})
+	assert.EqualError(t, err, "HAProxy is unreachable after 3 checks: connection refused")
+	assert.Equal(t, int32(3), client.pings.Load())
+
+	// Rejected credentials fail at once
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetCurrentConfigVersion").Return(int64(0), fmt.Errorf("failed to retrieve version: %w, status code: 401", ErrUnauthorized)).Once()
+	_, err = Preflight(&HAProxyClient{configManager: mockManager}, PreflightConfig{Attempts: 3, Backoff: time.Millisecond, Degraded: true})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	mockManager.AssertExpectations(t)
+}
+
+func TestPreflight_Degraded(t *testing.T) {
+	client := &flakyClient{}
+	checked, err := Preflight(client, PreflightConfig{Attempts: 2, Backoff: time.Millisecond, Degraded: true})
+	assert.NoError(t, err)
+	deferring, ok := checked.(*DeferringClient)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	// Bindings are queued while HAProxy is unreachable, everything else fails
+	assert.True(t, deferring.Degraded())
+	assert.NoError(t, deferring.BindStem("api", proxy.BackendOptions{}))
+	assert.NoError(t, deferring.BindLeaf("api", "api-1", "localhost", 8001))
+	_, err = deferring.Servers("api")
+	assert.ErrorIs(t, err, ErrDegraded)
+	assert.Empty(t, client.recorded())
+
+	// Once it is reachable they are applied in order, and later ones pass through
+	client.up.Store(true)
+	select {
+	case <-deferring.Resumed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("deferred bindings were not applied")
+	}
+	assert.False(t, deferring.Degraded())
+	assert.NoError(t, deferring.UnbindLeaf("api", "api-1"))
+	assert.Equal(t, []string{"bind api", "bind api/api-1", "unbind api/api-1"}, client.recorded())
+	servers, err := deferring.Servers("api")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"server1"}, servers)
+}
+
+func TestDeferringClient_RetriesFailedBindings(t *testing.T) {
+	// A binding HAProxy rejects stays queued, ahead of the ones made after it, until it is applied
+	client := &flakyClient{}
+	client.rejects.Store(2)
+	deferring := NewDeferringClient(client, time.Millisecond)
+	assert.NoError(t, deferring.BindStem("api", proxy.BackendOptions{}))
+	assert.NoError(t, deferring.BindLeaf("api", "api-1", "localhost", 8001))
+	assert.NoError(t, deferring.UnbindLeaf("api", "api-0"))
+	client.up.Store(true)
+	select {
+	case <-deferring.Resumed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("deferred bindings were not applied")
+	}
+	assert.Equal(t, []string{"bind api", "bind api/api-1", "unbind api/api-0"}, client.recorded())
+
+	// One that keeps failing is dropped, so it doesn't hold back the others forever
+	client = &flakyClient{}
+	client.rejects.Store(maxDeferredAttempts)
+	deferring = NewDeferringClient(client, time.Millisecond)
+	assert.NoError(t, deferring.BindLeaf("api", "api-1", "localhost", 8001))
+	assert.NoError(t, deferring.UnbindLeaf("api", "api-0"))
+	client.up.Store(true)
+	select {
+	case <-deferring.Resumed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("deferred bindings were not applied")
+	}
+	assert.False(t, deferring.Degraded())
+	assert.Equal(t, []string{"unbind api/api-0"}, client.recorded())
+}
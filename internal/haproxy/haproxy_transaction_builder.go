@@ -0,0 +1,100 @@
+package haproxy
+
+import (
+	"fmt"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// TransactionBuilder collects configuration operations and applies them in a single HAProxy transaction, so
+// HAProxy reloads once and either all of them take effect or none does. Operations run in the order they were
+// added; the first one failing rolls the transaction back. A builder is not safe for concurrent use.
+type TransactionBuilder struct {
+	configManager HAProxyConfigurationManagerInterface
+	middleware    TransactionMiddleware
+	operations    []transactionOperation
+}
+
+// transactionOperation is one operation of a TransactionBuilder, described for error messages.
+type transactionOperation struct {
+	description string
+	apply       func(transactionID string) error
+}
+
+// NewTransactionBuilder returns an empty TransactionBuilder applying its operations through configManager.
+func NewTransactionBuilder(configManager HAProxyConfigurationManagerInterface) *TransactionBuilder {
+	return &TransactionBuilder{configManager: configManager, middleware: NewTransactionMiddleware(configManager)}
+}
+
+// Transaction returns an empty TransactionBuilder applying its operations to the client's HAProxy.
+func (c *HAProxyClient) Transaction() *TransactionBuilder {
+	return &TransactionBuilder{configManager: c.configManager, middleware: c.transactionMiddleware}
+}
+
+// CreateBackend adds creating a backend, replacing any existing one.
+func (b *TransactionBuilder) CreateBackend(backendName string, options proxy.BackendOptions) *TransactionBuilder {
+	return b.add(fmt.Sprintf("create backend %s", backendName), func(transactionID string) error {
+		if options.IsUDP() {
+			return fmt.Errorf("UDP backends are not supported by HAProxy")
+		}
+		return b.configManager.CreateBackend(backendName, options, transactionID)
+	})
+}
+
+// AddServer adds adding a server to a backend.
+func (b *TransactionBuilder) AddServer(backendName, serverName, host string, port int) *TransactionBuilder {
+	return b.add(fmt.Sprintf("add server %s to backend %s", serverName, backendName), func(transactionID string) error {
+		return b.configManager.AddServer(backendName, serverName, host, port, transactionID)
+	})
+}
+
+// DeleteServer adds removing a server from a backend.
+func (b *TransactionBuilder) DeleteServer(backendName, serverName string) *TransactionBuilder {
+	return b.add(fmt.Sprintf("delete server %s from backend %s", serverName, backendName), func(transactionID string) error {
+		return b.configManager.DeleteServer(backendName, serverName, transactionID)
+	})
+}
+
+// SetServerWeight adds changing the share of a backend's requests a server gets. The server may be one added
+// earlier in the same transaction.
+func (b *TransactionBuilder) SetServerWeight(backendName, serverName string, weight int) *TransactionBuilder {
+	return b.add(fmt.Sprintf("set weight of server %s in backend %s", serverName, backendName), func(transactionID string) error {
+		servers, err := b.configManager.GetServersFromBackend(backendName, transactionID)
+		if err != nil {
+			return err
+		}
+		for _, server := range servers {
+			if server.Name == serverName {
+				return b.configManager.SetServerWeight(backendName, server, weight, transactionID)
+			}
+		}
+		return fmt.Errorf("server not found")
+	})
+}
+
+// Len returns the number of operations added so far.
+func (b *TransactionBuilder) Len() int {
+	return len(b.operations)
+}
+
+// Commit applies the operations in a single transaction. A builder without operations commits nothing. If the
+// transaction hits a version conflict, all operations are replayed in a new one.
+func (b *TransactionBuilder) Commit() error {
+	if len(b.operations) == 0 {
+		return nil
+	}
+	return b.middleware(func(transactionID string) error {
+		for _, operation := range b.operations {
+			if err := operation.apply(transactionID); err != nil {
+				return fmt.Errorf("failed to %s: %v", operation.description, err)
+			}
+		}
+		return nil
+	})()
+}
+
+// add appends an operation and returns the builder for chaining.
+func (b *TransactionBuilder) add(description string, apply func(transactionID string) error) *TransactionBuilder {
+	b.operations = append(b.operations, transactionOperation{description: description, apply: apply})
+	return b
+}
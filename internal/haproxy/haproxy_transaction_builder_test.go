@@ -0,0 +1,85 @@
+package haproxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionBuilder_Commit(t *testing.T) {
+	// Initialize the mock HAProxyConfigurationManager
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil).Once()
+	mockManager.On("StartTransaction", int64(1)).Return("txn123", nil).Once()
+	mockManager.On("CreateBackend", "backend1", proxy.BackendOptions{}, "txn123").Return(nil)
+	mockManager.On("AddServer", "backend1", "server1", "localhost", 8001, "txn123").Return(nil)
+	mockManager.On("AddServer", "backend1", "server2", "localhost", 8002, "txn123").Return(nil)
+	server2 := HAProxyServer{Name: "server2", Address: "localhost", Port: 8002}
+	mockManager.On("GetServersFromBackend", "backend1", "txn123").Return([]HAProxyServer{{Name: "server1", Address: "localhost", Port: 8001}, server2}, nil)
+	mockManager.On("SetServerWeight", "backend1", server2, 10, "txn123").Return(nil)
+	mockManager.On("CommitTransaction", "txn123").Return(nil).Once()
+
+	// Compose the backend, its servers and a weight into one transaction
+	builder := NewTransactionBuilder(mockManager).
+		CreateBackend("backend1", proxy.BackendOptions{}).
+		AddServer("backend1", "server1", "localhost", 8001).
+		AddServer("backend1", "server2", "localhost", 8002).
+		SetServerWeight("backend1", "server2", 10)
+	assert.Equal(t, 4, builder.Len())
+	err := builder.Commit()
+
+	// Assert that everything was applied with a single commit
+	assert.NoError(t, err)
+	mockManager.AssertExpectations(t)
+	mockManager.AssertNumberOfCalls(t, "StartTransaction", 1)
+}
+
+func TestTransactionBuilder_RollsBackOnFailure(t *testing.T) {
+	// Initialize the mock HAProxyConfigurationManager
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil)
+	mockManager.On("StartTransaction", int64(1)).Return("txn123", nil)
+	mockManager.On("CreateBackend", "backend1", proxy.BackendOptions{}, "txn123").Return(nil)
+	mockManager.On("AddServer", "backend1", "server1", "localhost", 8001, "txn123").Return(errors.New("port in use"))
+	mockManager.On("RollbackTransaction", "txn123").Return(nil)
+
+	// The second server is never added once the first one fails
+	err := NewTransactionBuilder(mockManager).
+		CreateBackend("backend1", proxy.BackendOptions{}).
+		AddServer("backend1", "server1", "localhost", 8001).
+		AddServer("backend1", "server2", "localhost", 8002).
+		Commit()
+
+	// Assert that the failing operation is named and nothing was committed
+	assert.EqualError(t, err, "failed to add server server1 to backend backend1: port in use")
+	mockManager.AssertExpectations(t)
+	mockManager.AssertNotCalled(t, "CommitTransaction", "txn123")
+	mockManager.AssertNumberOfCalls(t, "AddServer", 1)
+}
+
+func TestTransactionBuilder_UnknownServerWeight(t *testing.T) {
+	// Initialize the mock HAProxyConfigurationManager
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil)
+	mockManager.On("StartTransaction", int64(1)).Return("txn123", nil)
+	mockManager.On("GetServersFromBackend", "backend1", "txn123").Return([]HAProxyServer{}, nil)
+	mockManager.On("RollbackTransaction", "txn123").Return(nil)
+
+	err := NewTransactionBuilder(mockManager).SetServerWeight("backend1", "missing", 10).Commit()
+
+	assert.EqualError(t, err, "failed to set weight of server missing in backend backend1: server not found")
+	mockManager.AssertExpectations(t)
+}
+
+func TestTransactionBuilder_Empty(t *testing.T) {
+	// Initialize the mock HAProxyConfigurationManager, which expects no calls
+	mockManager := new(MockHAProxyConfigurationManager)
+
+	err := NewTransactionBuilder(mockManager).Commit()
+
+	// Assert that no transaction was started
+	assert.NoError(t, err)
+	mockManager.AssertExpectations(t)
+}
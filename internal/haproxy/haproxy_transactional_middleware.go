@@ -1,48 +1,111 @@
 package haproxy
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"sync"
+	"time"
 )
 
 // TransactionMiddleware is a middleware that manages transactions for HAProxy operations.
 type TransactionMiddleware func(next func(transactionID string) error) func() error
 
-// NewTransactionMiddleware creates a new TransactionMiddleware using the provided configManager interface.
+// ErrVersionConflict is returned when HAProxy rejects a transaction because its configuration changed since the
+// transaction started, for example because another tool committed a change in the meantime.
+var ErrVersionConflict = errors.New("configuration version conflict")
+
+// MaxTransactionAttempts is how many transactions an operation is run in before a version conflict is given up on.
+const MaxTransactionAttempts = 3
+
+// PendingTransaction is a transaction started by herbarium that was not committed or rolled back yet.
+type PendingTransaction struct {
+	ID      string
+	Version int64 // Configuration version the transaction was started from
+	Started time.Time
+}
+
+// pendingTransactions holds the open transactions of every HAProxy client in this process, by ID.
+var pendingTransactions = struct {
+	sync.Mutex
+	open map[string]PendingTransaction
+}{open: make(map[string]PendingTransaction)}
+
+// PendingTransactions returns the transactions currently open, oldest first.
+func PendingTransactions() []PendingTransaction {
+	pendingTransactions.Lock()
+	defer pendingTransactions.Unlock()
+	transactions := make([]PendingTransaction, 0, len(pendingTransactions.open))
+	for _, transaction := range pendingTransactions.open {
+		transactions = append(transactions, transaction)
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].Started.Before(transactions[j].Started) })
+	return transactions
+}
+
+// NewTransactionMiddleware creates a new TransactionMiddleware using the provided configManager interface. When
+// HAProxy rejects a transaction on a version conflict, the operation is replayed in a new transaction started from
+// the current version, up to MaxTransactionAttempts times.
 func NewTransactionMiddleware(configManager HAProxyConfigurationManagerInterface) TransactionMiddleware {
 	return func(next func(transactionID string) error) func() error {
 		return func() error {
-			// Retrieve the current config version using the interface method
-			cfgVer, err := configManager.GetCurrentConfigVersion()
-			if err != nil {
-				log.Printf("[ERROR] Failed to get config version: %v", err)
-				return fmt.Errorf("failed to retrieve configuration version: %v", err)
+			var err error
+			for attempt := 1; attempt <= MaxTransactionAttempts; attempt++ {
+				err = runTransaction(configManager, next)
+				if !errors.Is(err, ErrVersionConflict) {
+					return err
+				}
+				log.Printf("[WARN] Transaction attempt %d of %d hit a version conflict: %v", attempt, MaxTransactionAttempts, err)
 			}
-			log.Printf("[INFO] Got config version: %d", cfgVer)
+			return fmt.Errorf("giving up after %d transactions: %w", MaxTransactionAttempts, err)
+		}
+	}
+}
 
-			// Start the transaction using the interface method
-			transactionID, err := configManager.StartTransaction(cfgVer)
-			if err != nil {
-				log.Printf("[ERROR] Failed to start transaction: %v", err)
-				return fmt.Errorf("failed to start transaction: %v", err)
-			}
-			log.Printf("[INFO] Started transaction: %s", transactionID)
-
-			var executionErr error
-			defer func() {
-				// Rollback or commit the transaction depending on execution outcome
-				if executionErr != nil {
-					log.Printf("[ERROR] Rolling back transaction %s: %v", transactionID, executionErr)
-					configManager.RollbackTransaction(transactionID)
-				} else {
-					log.Printf("[INFO] Committing transaction: %s", transactionID)
-					configManager.CommitTransaction(transactionID)
-				}
-			}()
+// runTransaction runs next in a transaction started from the current configuration version, committing it if
+// next succeeds and rolling it back otherwise.
+func runTransaction(configManager HAProxyConfigurationManagerInterface, next func(transactionID string) error) error {
+	// Retrieve the current config version using the interface method
+	cfgVer, err := configManager.GetCurrentConfigVersion()
+	if err != nil {
+		log.Printf("[ERROR] Failed to get config version: %v", err)
+		return fmt.Errorf("failed to retrieve configuration version: %v", err)
+	}
+	log.Printf("[INFO] Got config version: %d", cfgVer)
+
+	// Start the transaction using the interface method
+	transactionID, err := configManager.StartTransaction(cfgVer)
+	if err != nil {
+		log.Printf("[ERROR] Failed to start transaction: %v", err)
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	log.Printf("[INFO] Started transaction: %s", transactionID)
+	pendingTransactions.Lock()
+	pendingTransactions.open[transactionID] = PendingTransaction{ID: transactionID, Version: cfgVer, Started: time.Now()}
+	pendingTransactions.Unlock()
+	defer func() {
+		pendingTransactions.Lock()
+		delete(pendingTransactions.open, transactionID)
+		pendingTransactions.Unlock()
+	}()
+
+	log.Printf("[INFO] Executing operation with transaction: %s", transactionID)
+	if executionErr := next(transactionID); executionErr != nil {
+		// Roll back the transaction so a failed operation leaves no partial changes
+		log.Printf("[ERROR] Rolling back transaction %s: %v", transactionID, executionErr)
+		configManager.RollbackTransaction(transactionID)
+		return executionErr
+	}
 
-			log.Printf("[INFO] Executing operation with transaction: %s", transactionID)
-			executionErr = next(transactionID)
-			return executionErr
+	log.Printf("[INFO] Committing transaction: %s", transactionID)
+	if err := configManager.CommitTransaction(transactionID); err != nil {
+		log.Printf("[ERROR] Failed to commit transaction %s: %v", transactionID, err)
+		if errors.Is(err, ErrVersionConflict) {
+			// The outdated transaction can't be committed anymore, drop it before replaying the operation
+			configManager.RollbackTransaction(transactionID)
 		}
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	return nil
 }
@@ -2,6 +2,7 @@ package haproxy
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -113,3 +114,102 @@ func TestTransactionMiddleware_StartTransactionError(t *testing.T) {
 	// Assert that the expected methods were called
 	mockManager.AssertExpectations(t)
 }
+
+func TestTransactionMiddleware_CommitTransactionError(t *testing.T) {
+	// Initialize the mock HAProxyConfigurationManager
+	mockManager := new(MockHAProxyConfigurationManager)
+
+	// Set up the mock methods
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil)
+	mockManager.On("StartTransaction", int64(1)).Return("txn123", nil)
+	mockManager.On("CommitTransaction", "txn123").Return(errors.New("version mismatch"))
+
+	// Define the middleware
+	middleware := NewTransactionMiddleware(mockManager)
+
+	// Execute the middleware with an operation that succeeds
+	err := middleware(func(transactionID string) error {
+		return nil
+	})()
+
+	// Assert that the commit failure is reported
+	assert.ErrorContains(t, err, "failed to commit transaction: version mismatch")
+
+	// Assert that the expected methods were called
+	mockManager.AssertExpectations(t)
+}
+
+func TestTransactionMiddleware_RetriesVersionConflict(t *testing.T) {
+	// Initialize the mock HAProxyConfigurationManager
+	mockManager := new(MockHAProxyConfigurationManager)
+
+	// The first commit loses against a change made by another tool, the replay commits from the new version
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil).Once()
+	mockManager.On("GetCurrentConfigVersion").Return(int64(2), nil).Once()
+	mockManager.On("StartTransaction", int64(1)).Return("txn1", nil)
+	mockManager.On("StartTransaction", int64(2)).Return("txn2", nil)
+	mockManager.On("CommitTransaction", "txn1").Return(fmt.Errorf("status code: 406: %w", ErrVersionConflict))
+	mockManager.On("RollbackTransaction", "txn1").Return(nil)
+	mockManager.On("CommitTransaction", "txn2").Return(nil)
+
+	// Define the middleware
+	middleware := NewTransactionMiddleware(mockManager)
+
+	// Execute the middleware, recording the transactions the operation ran in
+	var transactions []string
+	err := middleware(func(transactionID string) error {
+		transactions = append(transactions, transactionID)
+		return nil
+	})()
+
+	// Assert that the operation was replayed in a new transaction
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"txn1", "txn2"}, transactions)
+	mockManager.AssertExpectations(t)
+}
+
+func TestTransactionMiddleware_GivesUpOnVersionConflict(t *testing.T) {
+	// Initialize the mock HAProxyConfigurationManager
+	mockManager := new(MockHAProxyConfigurationManager)
+
+	// Every commit conflicts
+	mockManager.On("GetCurrentConfigVersion").Return(int64(1), nil)
+	mockManager.On("StartTransaction", int64(1)).Return("txn123", nil)
+	mockManager.On("CommitTransaction", "txn123").Return(fmt.Errorf("status code: 409: %w", ErrVersionConflict))
+	mockManager.On("RollbackTransaction", "txn123").Return(nil)
+
+	// Define the middleware
+	middleware := NewTransactionMiddleware(mockManager)
+
+	// Execute the middleware, counting the attempts
+	attempts := 0
+	err := middleware(func(transactionID string) error {
+		attempts++
+		return nil
+	})()
+
+	// Assert that the conflict is reported after the last attempt
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.Equal(t, MaxTransactionAttempts, attempts)
+	mockManager.AssertNumberOfCalls(t, "CommitTransaction", MaxTransactionAttempts)
+}
+
+func TestTransactionMiddleware_PendingTransactions(t *testing.T) {
+	mockManager := new(MockHAProxyConfigurationManager)
+	mockManager.On("GetCurrentConfigVersion").Return(int64(7), nil)
+	mockManager.On("StartTransaction", int64(7)).Return("txn-pending", nil)
+	mockManager.On("CommitTransaction", "txn-pending").Return(nil)
+
+	// The transaction is pending while the operation runs
+	var pending []PendingTransaction
+	err := NewTransactionMiddleware(mockManager)(func(transactionID string) error {
+		pending = PendingTransactions()
+		return nil
+	})()
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "txn-pending", pending[0].ID)
+		assert.Equal(t, int64(7), pending[0].Version)
+	}
+	assert.Empty(t, PendingTransactions())
+}
@@ -1,6 +1,9 @@
 package haproxy
 
 import (
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -34,8 +37,8 @@ func (m *MockHAProxyConfigurationManager) RollbackTransaction(transactionID stri
 }
 
 // CreateBackend mocks the CreateBackend method
-func (m *MockHAProxyConfigurationManager) CreateBackend(backendName, transactionID string) error {
-	args := m.Called(backendName, transactionID)
+func (m *MockHAProxyConfigurationManager) CreateBackend(backendName string, options proxy.BackendOptions, transactionID string) error {
+	args := m.Called(backendName, options, transactionID)
 	return args.Error(0)
 }
 
@@ -56,3 +59,87 @@ func (m *MockHAProxyConfigurationManager) GetServersFromBackend(backendName, tra
 	args := m.Called(backendName, transactionID)
 	return args.Get(0).([]HAProxyServer), args.Error(1)
 }
+
+// GetBackends mocks the GetBackends method
+func (m *MockHAProxyConfigurationManager) GetBackends() ([]HAProxyBackend, error) {
+	args := m.Called()
+	if backends, ok := args.Get(0).([]HAProxyBackend); ok {
+		return backends, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GetRawConfiguration mocks the GetRawConfiguration method
+func (m *MockHAProxyConfigurationManager) GetRawConfiguration() (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+// GetServerRequestCounts mocks the GetServerRequestCounts method
+func (m *MockHAProxyConfigurationManager) GetServerRequestCounts(backendName string) (map[string]int64, error) {
+	args := m.Called(backendName)
+	if counts, ok := args.Get(0).(map[string]int64); ok {
+		return counts, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GetServerResponseTimes mocks the GetServerResponseTimes method
+func (m *MockHAProxyConfigurationManager) GetServerResponseTimes(backendName string) (map[string]time.Duration, error) {
+	args := m.Called(backendName)
+	if times, ok := args.Get(0).(map[string]time.Duration); ok {
+		return times, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// GetQueuedRequests mocks the GetQueuedRequests method
+func (m *MockHAProxyConfigurationManager) GetQueuedRequests(backendName string) (int64, error) {
+	args := m.Called(backendName)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// GetDownServers mocks the GetDownServers method
+func (m *MockHAProxyConfigurationManager) GetDownServers(backendName string) ([]string, error) {
+	args := m.Called(backendName)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+// AddMaintenanceRule mocks the AddMaintenanceRule method
+func (m *MockHAProxyConfigurationManager) AddMaintenanceRule(backendName, page, transactionID string) error {
+	args := m.Called(backendName, page, transactionID)
+	return args.Error(0)
+}
+
+// DeleteMaintenanceRule mocks the DeleteMaintenanceRule method
+func (m *MockHAProxyConfigurationManager) DeleteMaintenanceRule(backendName, transactionID string) error {
+	args := m.Called(backendName, transactionID)
+	return args.Error(0)
+}
+
+// SetServerMaintenance mocks the SetServerMaintenance method
+func (m *MockHAProxyConfigurationManager) SetServerMaintenance(backendName string, server HAProxyServer, enabled bool, transactionID string) error {
+	args := m.Called(backendName, server, enabled, transactionID)
+	return args.Error(0)
+}
+
+// SetServerWeight mocks the SetServerWeight method
+func (m *MockHAProxyConfigurationManager) SetServerWeight(backendName string, server HAProxyServer, weight int, transactionID string) error {
+	args := m.Called(backendName, server, weight, transactionID)
+	return args.Error(0)
+}
+
+// DrainServer mocks the DrainServer method
+func (m *MockHAProxyConfigurationManager) DrainServer(backendName, serverName string) error {
+	args := m.Called(backendName, serverName)
+	return args.Error(0)
+}
+
+// GetServerSessions mocks the GetServerSessions method
+func (m *MockHAProxyConfigurationManager) GetServerSessions(backendName string) (map[string]int64, error) {
+	args := m.Called(backendName)
+	if sessions, ok := args.Get(0).(map[string]int64); ok {
+		return sessions, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
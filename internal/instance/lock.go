@@ -0,0 +1,100 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LockFileName is the lock file created in the Plantarium root folder by the running instance.
+const LockFileName = ".herbarium.lock"
+
+// ErrLocked is returned by Acquire when another instance already holds the lock.
+var ErrLocked = errors.New("another herbarium instance is already running")
+
+// Lock is an exclusive lock on a Plantarium root folder, held for the lifetime of the process.
+type Lock struct {
+	file    *os.File
+	pidFile string
+}
+
+// Acquire takes the exclusive lock for rootFolder, so two instances can't manage the same root folder
+// and HAProxy backends, and writes the current PID to pidFile if it is not empty.
+func Acquire(rootFolder, pidFile string) (*Lock, error) {
+	lockPath := filepath.Join(rootFolder, LockFileName)
+
+	// Don't truncate before locking: the file holds the PID of the current owner
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %v", lockPath, err)
+	}
+
+	locked, err := tryLockFile(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock %s: %v", lockPath, err)
+	}
+	if !locked {
+		owner := readOwnerPID(file)
+		file.Close()
+		if owner != "" {
+			return nil, fmt.Errorf("%w (PID %s) for %s", ErrLocked, owner, rootFolder)
+		}
+		return nil, fmt.Errorf("%w for %s", ErrLocked, rootFolder)
+	}
+
+	l := &Lock{file: file}
+	if err := writePID(file); err != nil {
+		l.Release()
+		return nil, fmt.Errorf("failed to write lock file %s: %v", lockPath, err)
+	}
+
+	if pidFile != "" {
+		if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			l.Release()
+			return nil, fmt.Errorf("failed to write PID file %s: %v", pidFile, err)
+		}
+		l.pidFile = pidFile
+	}
+
+	return l, nil
+}
+
+// Release removes the PID file and releases the lock.
+func (l *Lock) Release() error {
+	if l.pidFile != "" {
+		if err := os.Remove(l.pidFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove PID file %s: %v", l.pidFile, err)
+		}
+		l.pidFile = ""
+	}
+
+	// Closing the file drops the lock; the lock file itself is left in place so that
+	// a concurrently starting instance never locks an unlinked file
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to release lock: %v", err)
+	}
+	return nil
+}
+
+// writePID replaces the lock file contents with the current PID.
+func writePID(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
+
+// readOwnerPID returns the PID recorded in the lock file, or an empty string if it can't be read.
+func readOwnerPID(file *os.File) string {
+	content, err := io.ReadAll(io.NewSectionReader(file, 0, 32))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
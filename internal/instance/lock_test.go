@@ -0,0 +1,50 @@
+package instance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquire_SingleInstance(t *testing.T) {
+	rootFolder := t.TempDir()
+
+	lock, err := Acquire(rootFolder, "")
+	if err != nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+
+	// A second instance against the same root folder is rejected
+	_, err = Acquire(rootFolder, "")
+	assert.True(t, errors.Is(err, ErrLocked), "expected ErrLocked, got %v", err)
+	assert.Contains(t, err.Error(), strconv.Itoa(os.Getpid()))
+
+	// Once released, the lock can be taken again
+	assert.NoError(t, lock.Release())
+	lock, err = Acquire(rootFolder, "")
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Release())
+}
+
+func TestAcquire_PIDFile(t *testing.T) {
+	rootFolder := t.TempDir()
+	pidFile := filepath.Join(t.TempDir(), "herbarium.pid")
+
+	lock, err := Acquire(rootFolder, pidFile)
+	if err != nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+
+	content, err := os.ReadFile(pidFile)
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), strings.TrimSpace(string(content)))
+
+	assert.NoError(t, lock.Release())
+	_, err = os.Stat(pidFile)
+	assert.True(t, os.IsNotExist(err), "expected PID file to be removed on release")
+}
@@ -0,0 +1,193 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// AgentAPIKeyHeader is the request header carrying the API key of a remote agent.
+const AgentAPIKeyHeader = "X-API-Key"
+
+// LeafRuntime defines the operations herbarium uses to run leafs on a remote host, through an agent or over SSH.
+type LeafRuntime interface {
+	Host() string                                                    // Address HAProxy uses to reach leafs on the remote host.
+	StartLeaf(request AgentStartRequest) (*AgentLeaf, error)         // Starts a leaf process on the remote host.
+	StopLeaf(leafID string) error                                    // Stops a leaf process and its children.
+	GetLeaf(leafID string) (*AgentLeaf, error)                       // Reports the health of a leaf process.
+	ReadLeafLogs(leafID string, opts LogReadOptions) ([]byte, error) // Returns part of a leaf's log history.
+}
+
+// AgentStartRequest asks an agent to start a leaf of a stem.
+type AgentStartRequest struct {
+	StemName string            `json:"stemName"`
+	Version  string            `json:"version"`
+	LeafID   string            `json:"leafId"`
+	Config   models.StemConfig `json:"config"`
+}
+
+// AgentLeaf describes a leaf process running on an agent.
+type AgentLeaf struct {
+	ID          string  `json:"id"`
+	PID         int     `json:"pid"`
+	Port        int     `json:"port"`
+	Host        string  `json:"host,omitempty"` // Address the leaf is reached at when it isn't the runtime's host, such as a pod IP
+	Alive       bool    `json:"alive"`
+	MemoryBytes int64   `json:"memoryBytes,omitempty"` // Resident memory of a live leaf, 0 when unknown
+	CPUSeconds  float64 `json:"cpuSeconds,omitempty"`  // CPU time a live leaf used so far, 0 when unknown
+}
+
+// AgentClient talks to a herbarium agent over its HTTP API.
+type AgentClient struct {
+	client *resty.Client
+	host   string
+}
+
+// NewAgentClient creates a client for the agent at baseURL (e.g. http://10.0.0.5:50052). host is the address
+// HAProxy uses to reach the agent's leafs; it defaults to the host name of baseURL.
+func NewAgentClient(baseURL, apiKey, host string) (*AgentClient, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid agent URL %q", baseURL)
+	}
+	if host == "" {
+		host = parsed.Hostname()
+	}
+
+	client := resty.New()
+	client.SetBaseURL(baseURL)
+	if apiKey != "" {
+		client.SetHeader(AgentAPIKeyHeader, apiKey)
+	}
+	client.SetTimeout(ServiceStartupTimeout + 10*time.Second)
+	client.SetDisableWarn(true)
+
+	return &AgentClient{client: client, host: host}, nil
+}
+
+// Host returns the address HAProxy uses to reach leafs on the agent's host.
+func (a *AgentClient) Host() string {
+	return a.host
+}
+
+// StartLeaf starts a leaf process on the agent and waits until it is ready.
+func (a *AgentClient) StartLeaf(request AgentStartRequest) (*AgentLeaf, error) {
+	var leaf AgentLeaf
+	resp, err := a.client.R().SetBody(request).SetResult(&leaf).Post("/leafs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach agent: %v", err)
+	}
+	if resp.StatusCode() != http.StatusCreated {
+		return nil, fmt.Errorf("agent failed to start leaf, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+	return &leaf, nil
+}
+
+// StopLeaf stops a leaf process on the agent. A leaf unknown to the agent is considered stopped.
+func (a *AgentClient) StopLeaf(leafID string) error {
+	resp, err := a.client.R().Delete("/leafs/" + url.PathEscape(leafID))
+	if err != nil {
+		return fmt.Errorf("failed to reach agent: %v", err)
+	}
+	if resp.StatusCode() != http.StatusNoContent && resp.StatusCode() != http.StatusNotFound {
+		return fmt.Errorf("agent failed to stop leaf, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+	return nil
+}
+
+// GetLeaf reports the health of a leaf process on the agent.
+func (a *AgentClient) GetLeaf(leafID string) (*AgentLeaf, error) {
+	var leaf AgentLeaf
+	resp, err := a.client.R().SetResult(&leaf).Get("/leafs/" + url.PathEscape(leafID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach agent: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("agent failed to report leaf, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+	return &leaf, nil
+}
+
+// Ping checks that the agent answers, by listing its leafs.
+func (a *AgentClient) Ping() error {
+	resp, err := a.client.R().Get("/leafs")
+	if err != nil {
+		return fmt.Errorf("failed to reach agent: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("agent failed to list leafs, status code: %d", resp.StatusCode())
+	}
+	return nil
+}
+
+// ReadLeafLogs returns part of a leaf's log history from the agent.
+func (a *AgentClient) ReadLeafLogs(leafID string, opts LogReadOptions) ([]byte, error) {
+	request := a.client.R()
+	if opts.TailLines > 0 {
+		request.SetQueryParam("tail", strconv.Itoa(opts.TailLines))
+	}
+	if opts.Offset > 0 {
+		request.SetQueryParam("offset", strconv.FormatInt(opts.Offset, 10))
+	}
+	if opts.Length > 0 {
+		request.SetQueryParam("length", strconv.FormatInt(opts.Length, 10))
+	}
+	resp, err := request.Get("/leafs/" + url.PathEscape(leafID) + "/logs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach agent: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("agent failed to read leaf logs, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+	return resp.Body(), nil
+}
+
+// StartLeafProcess starts a leaf process for a stem on a free local port and waits until it is ready.
+// Agents use it to run leafs on behalf of a remote herbarium. The port is only reserved while the leaf
+// starts; once it is bound, the host itself keeps other leafs off it.
+func StartLeafProcess(stemName, version, leafID string, config *models.StemConfig) (pid, port int, err error) {
+	port, err = allocateLeafPort(config, leafID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find an available port: %v", err)
+	}
+	defer releaseLeafPort(config, port)
+	pid, err = startLeafInternal(stemName, version, leafID, port, config)
+	if err != nil {
+		return 0, 0, err
+	}
+	return pid, port, nil
+}
+
+// StopLeafProcess asks a leaf process to shut down with its stem's stop signal, then stops it and any
+// children it spawned if it is still running after the stop timeout.
+func StopLeafProcess(pid int, config *models.StemConfig) error {
+	return stopLeafProcess(pid, config)
+}
+
+// LeafProcessAlive reports whether a leaf process is still running.
+func LeafProcessAlive(pid int) bool {
+	return processAlive(pid)
+}
+
+// LeafProcessMemory returns the resident memory of a leaf process in bytes.
+func LeafProcessMemory(pid int) (int64, error) {
+	return processMemory(pid)
+}
+
+// LeafProcessCPUTime returns the CPU time a leaf process used so far.
+func LeafProcessCPUTime(pid int) (time.Duration, error) {
+	return processCPUTime(pid)
+}
+
+// leafHost returns the address HAProxy and graft nodes use to reach a leaf.
+func leafHost(leaf *models.Leaf) string {
+	if leaf.Host == "" {
+		return "localhost"
+	}
+	return leaf.Host
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLeafManager_RemoteLeafLifecycle(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	leafRepo := repos.NewLeafRepository(db)
+	stemRepo := repos.NewStemRepository(db)
+
+	agentName := "edge-1"
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	config := models.StemConfig{Name: "api", Version: "v1", URL: "/api", Command: "api --port {{.PORT}}", Agent: &agentName}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api", Config: &config, LeafInstances: map[string]*models.Leaf{}}
+
+	mockAgent := new(MockAgentClient)
+	mockAgent.On("Host").Return("10.0.0.5")
+	mockAgent.On("StartLeaf", mock.MatchedBy(func(request AgentStartRequest) bool {
+		return request.StemName == "api" && request.Config.Command == config.Command
+	})).Return(&AgentLeaf{PID: 4242, Port: 8005, Alive: true}, nil)
+
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindLeaf", "api", mock.Anything, "10.0.0.5", 8005).Return(nil)
+
+	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, stemRepo)
+	leafManager.Agents = map[string]LeafRuntime{agentName: mockAgent}
+
+	leafID, err := leafManager.StartLeaf("api", "v1", nil)
+	assert.NoError(t, err)
+	leaf, err := leafRepo.FindLeafByID(key, leafID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, agentName, leaf.Agent)
+		assert.Equal(t, "10.0.0.5", leaf.Host)
+		assert.Equal(t, 4242, leaf.PID)
+	}
+
+	// Logs are read from the agent
+	mockAgent.On("ReadLeafLogs", leafID, LogReadOptions{TailLines: 5}).Return([]byte("ready\n"), nil)
+	logs, err := leafManager.ReadLeafLogs(key, leafID, LogReadOptions{TailLines: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, "ready\n", string(logs))
+
+	// Stopping goes through the agent instead of killing a local PID
+	mockHAProxyClient.On("UnbindLeaf", "api", leafID).Return(nil)
+	mockAgent.On("StopLeaf", leafID).Return(nil)
+	assert.NoError(t, leafManager.StopLeaf("api", "v1", leafID))
+	_, err = leafRepo.FindLeafByID(key, leafID)
+	assert.Error(t, err)
+
+	mockAgent.AssertExpectations(t)
+	mockHAProxyClient.AssertExpectations(t)
+}
+
+func TestLeafManager_StartLeafUnknownAgent(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	agentName := "missing"
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", Config: &models.StemConfig{Agent: &agentName}, LeafInstances: map[string]*models.Leaf{}}
+
+	leafManager := NewLeafManager(repos.NewLeafRepository(db), new(MockProxyClient), repos.NewStemRepository(db))
+	_, err := leafManager.StartLeaf("api", "v1", nil)
+	assert.ErrorContains(t, err, "unknown agent missing")
+}
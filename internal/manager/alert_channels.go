@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Alerting channel types selectable in the global config.
+const (
+	AlertChannelLog     = "log"     // Writes alerts to the herbarium log
+	AlertChannelWebhook = "webhook" // Posts alerts as JSON to a URL
+)
+
+// webhookTimeout bounds a single webhook delivery, so a slow receiver can't hold up alert evaluation.
+const webhookTimeout = 5 * time.Second
+
+// AlertChannel delivers alerts to the people responsible for a stem.
+type AlertChannel interface {
+	Send(alert models.Alert) error
+}
+
+// NewAlertChannel creates a channel of the given type. Only webhooks use url and headers.
+func NewAlertChannel(channelType, url string, headers map[string]string) (AlertChannel, error) {
+	switch channelType {
+	case AlertChannelLog:
+		return LogChannel{}, nil
+	case AlertChannelWebhook:
+		if url == "" {
+			return nil, fmt.Errorf("webhook channel needs a url")
+		}
+		return NewWebhookChannel(url, headers), nil
+	default:
+		return nil, fmt.Errorf("unknown alerting channel type %q", channelType)
+	}
+}
+
+// LogChannel writes alerts to the herbarium log.
+type LogChannel struct{}
+
+// Send logs the alert.
+func (LogChannel) Send(alert models.Alert) error {
+	log.Printf("[Alert] %s %s: %s", alert.State, alert.Rule, alert.Message)
+	return nil
+}
+
+// WebhookChannel posts alerts as JSON to a URL.
+type WebhookChannel struct {
+	url    string
+	client *resty.Client
+}
+
+// NewWebhookChannel creates a channel posting to url with the given extra headers.
+func NewWebhookChannel(url string, headers map[string]string) *WebhookChannel {
+	client := resty.New()
+	client.SetTimeout(webhookTimeout)
+	client.SetHeader("Content-Type", "application/json")
+	client.SetHeaders(headers)
+	client.SetDisableWarn(true)
+	return &WebhookChannel{url: url, client: client}
+}
+
+// Send posts the alert, failing unless the receiver answers with a 2xx status.
+func (c *WebhookChannel) Send(alert models.Alert) error {
+	resp, err := c.client.R().SetBody(alert).Post(c.url)
+	if err != nil {
+		return fmt.Errorf("failed to post alert to %s: %v", c.url, err)
+	}
+	if !resp.IsSuccess() {
+		return fmt.Errorf("webhook %s answered with status %d: %s", c.url, resp.StatusCode(), resp.String())
+	}
+	return nil
+}
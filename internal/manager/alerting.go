@@ -0,0 +1,356 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultAlertInterval is how often the alert engine evaluates the stems' thresholds.
+const DefaultAlertInterval = 30 * time.Second
+
+// restartWindow is the period leaf starts are counted over for maxRestartsPerHour.
+const restartWindow = time.Hour
+
+// AlertEngine evaluates the alert thresholds stems declare and notifies their channels when an alert starts
+// firing and when it resolves, but not while it keeps firing. Every notification is also recorded as an event.
+type AlertEngine struct {
+	StemRepo    repos.StemRepositoryInterface
+	LeafManager LeafManagerInterface
+	ProxyClient proxy.ProxyClient
+	Channels    map[string]AlertChannel // Channels by name; stems without alerts.channels notify all of them
+	Events      *EventLog               // Receives an event for every notification, nil to only send them
+
+	mu     sync.Mutex
+	now    func() time.Time
+	firing map[alertKey]*models.Alert
+	starts map[storage.StemKey]*leafStarts
+	warned map[storage.StemKey]bool // Stems already warned that the proxy can't measure their latency
+}
+
+// alertKey identifies an alert: one per stem and rule.
+type alertKey struct {
+	stem storage.StemKey
+	rule models.AlertRule
+}
+
+// leafStarts tracks the leafs seen for a stem and when new ones started, to measure its restart rate.
+type leafStarts struct {
+	seen  map[string]bool
+	times []time.Time
+}
+
+// alertCheck is the outcome of evaluating one threshold.
+type alertCheck struct {
+	rule      models.AlertRule
+	breached  bool
+	value     string
+	threshold string
+	message   string
+}
+
+// NewAlertEngine creates an AlertEngine for the stems in stemRepo without any channels.
+func NewAlertEngine(stemRepo repos.StemRepositoryInterface, leafManager LeafManagerInterface, proxyClient proxy.ProxyClient) *AlertEngine {
+	return &AlertEngine{
+		StemRepo:    stemRepo,
+		LeafManager: leafManager,
+		ProxyClient: proxyClient,
+		Channels:    make(map[string]AlertChannel),
+		now:         time.Now,
+		firing:      make(map[alertKey]*models.Alert),
+		starts:      make(map[storage.StemKey]*leafStarts),
+		warned:      make(map[storage.StemKey]bool),
+	}
+}
+
+// StartSchedule evaluates the alert thresholds every interval until stop is closed.
+func (e *AlertEngine) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Evaluating alert thresholds every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("alert engine", func() { e.Evaluate() })
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Evaluate checks the thresholds of every stem declaring alerts and returns the alerts that started firing
+// or resolved. Alerts of stems that were removed or no longer declare alerts are dropped silently.
+func (e *AlertEngine) Evaluate() []models.Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stems, err := e.StemRepo.GetAllStems()
+	if err != nil {
+		log.Printf("Failed to list stems for alerting: %v", err)
+		return nil
+	}
+	var changed []models.Alert
+	evaluated := make(map[storage.StemKey]bool)
+	for _, stem := range stems {
+		if stem.Config == nil || stem.Config.Alerts == nil {
+			continue
+		}
+		key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+		evaluated[key] = true
+		for _, check := range e.checkStem(key, stem) {
+			if alert := e.transition(key, stem.Config.Alerts, check); alert != nil {
+				changed = append(changed, *alert)
+			}
+		}
+	}
+
+	for key := range e.firing {
+		if !evaluated[key.stem] {
+			delete(e.firing, key)
+		}
+	}
+	for key := range e.starts {
+		if !evaluated[key] {
+			delete(e.starts, key)
+		}
+	}
+	return changed
+}
+
+// FiringAlerts returns the alerts currently firing, ordered by stem and rule.
+func (e *AlertEngine) FiringAlerts() []models.Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := make([]models.Alert, 0, len(e.firing))
+	for _, alert := range e.firing {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Stem != alerts[j].Stem {
+			return alerts[i].Stem < alerts[j].Stem
+		}
+		if alerts[i].Version != alerts[j].Version {
+			return alerts[i].Version < alerts[j].Version
+		}
+		return alerts[i].Rule < alerts[j].Rule
+	})
+	return alerts
+}
+
+// checkStem evaluates the thresholds a stem declares. Thresholds that can't be measured right now are left out,
+// so their alerts keep their state.
+func (e *AlertEngine) checkStem(key storage.StemKey, stem *models.Stem) []alertCheck {
+	config := stem.Config.Alerts
+	var checks []alertCheck
+
+	leafs, _, err := e.LeafManager.ListLeafs(key, repos.LeafQuery{})
+	if err != nil {
+		log.Printf("Failed to list leafs of stem %s version %s for alerting: %v", stem.Name, stem.Version, err)
+		return nil
+	}
+	restarts := e.countRestarts(key, leafs)
+	if config.MaxRestartsPerHour > 0 {
+		checks = append(checks, alertCheck{
+			rule:      models.AlertRestartRate,
+			breached:  restarts > config.MaxRestartsPerHour,
+			value:     strconv.Itoa(restarts),
+			threshold: strconv.Itoa(config.MaxRestartsPerHour),
+			message: fmt.Sprintf("Stem %s version %s started %d leafs within the last hour, the limit is %d",
+				stem.Name, stem.Version, restarts, config.MaxRestartsPerHour),
+		})
+	}
+
+	if config.MinHealthyLeafs > 0 {
+		running := 0
+		for _, leaf := range leafs {
+			if leaf.Status == models.StatusRunning {
+				running++
+			}
+		}
+		checks = append(checks, alertCheck{
+			rule:      models.AlertHealthyLeafs,
+			breached:  running < config.MinHealthyLeafs,
+			value:     strconv.Itoa(running),
+			threshold: strconv.Itoa(config.MinHealthyLeafs),
+			message: fmt.Sprintf("Stem %s version %s has %d running leafs, the minimum is %d",
+				stem.Name, stem.Version, running, config.MinHealthyLeafs),
+		})
+	}
+
+	if maxLatency, err := time.ParseDuration(config.MaxLatency); err == nil && maxLatency > 0 {
+		if check, ok := e.checkLatency(key, stem, maxLatency); ok {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// countRestarts records the leafs of a stem that appeared since the last evaluation and returns how many
+// started within the restart window. The leafs a stem has when it is first evaluated don't count.
+func (e *AlertEngine) countRestarts(key storage.StemKey, leafs []*models.Leaf) int {
+	now := e.now()
+	starts, known := e.starts[key]
+	if !known {
+		starts = &leafStarts{seen: make(map[string]bool)}
+		e.starts[key] = starts
+	}
+	for _, leaf := range leafs {
+		if starts.seen[leaf.ID] {
+			continue
+		}
+		starts.seen[leaf.ID] = true
+		if known {
+			started := leaf.Initialized
+			if started.IsZero() {
+				started = now
+			}
+			starts.times = append(starts.times, started)
+		}
+	}
+
+	// Forget leafs that are gone and starts that left the window
+	current := make(map[string]bool, len(leafs))
+	for _, leaf := range leafs {
+		current[leaf.ID] = true
+	}
+	for id := range starts.seen {
+		if !current[id] {
+			delete(starts.seen, id)
+		}
+	}
+	recent := starts.times[:0]
+	for _, started := range starts.times {
+		if now.Sub(started) < restartWindow {
+			recent = append(recent, started)
+		}
+	}
+	starts.times = recent
+	return len(recent)
+}
+
+// checkLatency compares the slowest leaf of a stem with its latency threshold. It reports false when the proxy
+// can't measure response times.
+func (e *AlertEngine) checkLatency(key storage.StemKey, stem *models.Stem, maxLatency time.Duration) (alertCheck, bool) {
+	reporter, ok := e.ProxyClient.(proxy.LatencyReporter)
+	if !ok || !proxied(stem.Config) {
+		if !e.warned[key] {
+			log.Printf("The proxy does not measure response times of stem %s, alerts.maxLatency is ignored", stem.Name)
+			e.warned[key] = true
+		}
+		return alertCheck{}, false
+	}
+	times, err := reporter.ResponseTimes(stem.HAProxyBackend)
+	if err != nil {
+		log.Printf("Failed to get response times of stem %s: %v", stem.Name, err)
+		return alertCheck{}, false
+	}
+
+	var slowestServer string
+	var slowest time.Duration
+	for server, responseTime := range times {
+		if responseTime > slowest || (responseTime == slowest && server < slowestServer) {
+			slowestServer, slowest = server, responseTime
+		}
+	}
+	message := fmt.Sprintf("No leaf of stem %s version %s has responded recently, the limit is %s", stem.Name, stem.Version, maxLatency)
+	if slowestServer != "" {
+		message = fmt.Sprintf("Slowest leaf %s of stem %s version %s responds in %s on average, the limit is %s",
+			slowestServer, stem.Name, stem.Version, slowest, maxLatency)
+	}
+	return alertCheck{
+		rule:      models.AlertLatency,
+		breached:  slowest > maxLatency,
+		value:     slowest.String(),
+		threshold: maxLatency.String(),
+		message:   message,
+	}, true
+}
+
+// transition updates the state of a stem's alert after a check and notifies its channels when the alert
+// starts firing or resolves, returning the alert in that case.
+func (e *AlertEngine) transition(key storage.StemKey, config *models.AlertConfig, check alertCheck) *models.Alert {
+	now := e.now()
+	id := alertKey{stem: key, rule: check.rule}
+	current, firing := e.firing[id]
+	switch {
+	case check.breached && !firing:
+		alert := &models.Alert{
+			Stem:      key.Name,
+			Version:   key.Version,
+			Rule:      check.rule,
+			State:     models.AlertFiring,
+			Value:     check.value,
+			Threshold: check.threshold,
+			Message:   check.message,
+			Since:     now,
+			Time:      now,
+		}
+		e.firing[id] = alert
+		e.notify(config, *alert)
+		return alert
+	case check.breached:
+		current.Value, current.Message = check.value, check.message
+		return nil
+	case firing:
+		resolved := *current
+		resolved.State = models.AlertResolved
+		resolved.Value, resolved.Message, resolved.Time = check.value, check.message, now
+		delete(e.firing, id)
+		e.notify(config, resolved)
+		return &resolved
+	}
+	return nil
+}
+
+// notify records an alert as an event and sends it to the stem's channels. A restart rate alert starting to
+// fire is also recorded as the stem crash-looping.
+func (e *AlertEngine) notify(config *models.AlertConfig, alert models.Alert) {
+	eventType := models.EventAlertFiring
+	if alert.State == models.AlertResolved {
+		eventType = models.EventAlertResolved
+	}
+	e.Events.Record(models.Event{
+		Time:    alert.Time,
+		Type:    eventType,
+		Stem:    alert.Stem,
+		Version: alert.Version,
+		Message: alert.Message,
+	})
+	if alert.Rule == models.AlertRestartRate && alert.State == models.AlertFiring {
+		e.Events.Record(models.Event{
+			Time:    alert.Time,
+			Type:    models.EventLeafCrashLooping,
+			Stem:    alert.Stem,
+			Version: alert.Version,
+			Message: alert.Message,
+		})
+	}
+
+	names := config.Channels
+	if len(names) == 0 {
+		for name := range e.Channels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		channel, ok := e.Channels[name]
+		if !ok {
+			log.Printf("Alert of stem %s refers to unknown channel %s", alert.Stem, name)
+			continue
+		}
+		if err := channel.Send(alert); err != nil {
+			log.Printf("Failed to send alert of stem %s to channel %s: %v", alert.Stem, name, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingChannel is an AlertChannel keeping the alerts it was sent.
+type recordingChannel struct {
+	alerts []models.Alert
+}
+
+func (c *recordingChannel) Send(alert models.Alert) error {
+	c.alerts = append(c.alerts, alert)
+	return nil
+}
+
+// latencyProxyClient is a MockProxyClient that also reports response times.
+type latencyProxyClient struct {
+	*MockProxyClient
+	times map[string]time.Duration
+}
+
+func (c *latencyProxyClient) ResponseTimes(backendName string) (map[string]time.Duration, error) {
+	return c.times, nil
+}
+
+func TestAlertEngine_HealthyLeafsAndLatency(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api",
+			Alerts: &models.AlertConfig{MinHealthyLeafs: 2, MaxLatency: "500ms", Channels: []string{"ops"}}}}
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{}).Return([]*models.Leaf{
+		{ID: "api-1", Status: models.StatusRunning},
+		{ID: "api-2", Status: models.StatusStarting},
+	}, 2, nil).Once()
+
+	proxyClient := &latencyProxyClient{MockProxyClient: new(MockProxyClient),
+		times: map[string]time.Duration{"api-1": 200 * time.Millisecond, "api-2": 800 * time.Millisecond}}
+	ops, other := &recordingChannel{}, &recordingChannel{}
+	engine := NewAlertEngine(repos.NewStemRepository(db), mockLeafManager, proxyClient)
+	engine.Channels = map[string]AlertChannel{"ops": ops, "other": other}
+	engine.Events = NewEventLog(0)
+
+	changed := engine.Evaluate()
+	if assert.Len(t, changed, 2) {
+		assert.Equal(t, models.AlertHealthyLeafs, changed[0].Rule)
+		assert.Equal(t, "1", changed[0].Value)
+		assert.Equal(t, models.AlertLatency, changed[1].Rule)
+		assert.Equal(t, "Slowest leaf api-2 of stem api version v1 responds in 800ms on average, the limit is 500ms", changed[1].Message)
+	}
+	assert.Len(t, ops.alerts, 2)
+	assert.Empty(t, other.alerts)
+	assert.Len(t, engine.FiringAlerts(), 2)
+
+	// Alerts that keep firing are not sent again
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{}).Return([]*models.Leaf{
+		{ID: "api-1", Status: models.StatusRunning},
+		{ID: "api-2", Status: models.StatusStarting},
+	}, 2, nil).Once()
+	assert.Empty(t, engine.Evaluate())
+	assert.Len(t, ops.alerts, 2)
+
+	// Both leafs running and responding quickly resolves both alerts
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{}).Return([]*models.Leaf{
+		{ID: "api-1", Status: models.StatusRunning},
+		{ID: "api-2", Status: models.StatusRunning},
+	}, 2, nil).Once()
+	proxyClient.times["api-2"] = 300 * time.Millisecond
+	changed = engine.Evaluate()
+	if assert.Len(t, changed, 2) {
+		assert.Equal(t, models.AlertResolved, changed[0].State)
+		assert.Equal(t, models.AlertResolved, changed[1].State)
+	}
+	assert.Len(t, ops.alerts, 4)
+	assert.Empty(t, engine.FiringAlerts())
+	assert.Len(t, engine.Events.List(EventQuery{Type: models.EventAlertFiring}), 2)
+	assert.Len(t, engine.Events.List(EventQuery{Type: models.EventAlertResolved}), 2)
+}
+
+func TestAlertEngine_RestartRate(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "worker", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "worker", Version: "v1",
+		Config: &models.StemConfig{Name: "worker", Version: "v1", Alerts: &models.AlertConfig{MaxRestartsPerHour: 1}}}
+
+	leafs := func(ids ...string) []*models.Leaf {
+		var result []*models.Leaf
+		for _, id := range ids {
+			result = append(result, &models.Leaf{ID: id, Status: models.StatusRunning, Initialized: now})
+		}
+		return result
+	}
+	mockLeafManager := new(MockLeafManager)
+	engine := NewAlertEngine(repos.NewStemRepository(db), mockLeafManager, new(MockProxyClient))
+	engine.now = func() time.Time { return now }
+	channel := &recordingChannel{}
+	engine.Channels = map[string]AlertChannel{"log": channel}
+	engine.Events = NewEventLog(0)
+
+	// The leafs running at the first evaluation are not restarts
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{}).Return(leafs("w-1", "w-2"), 2, nil).Once()
+	assert.Empty(t, engine.Evaluate())
+
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{}).Return(leafs("w-2", "w-3"), 2, nil).Once()
+	assert.Empty(t, engine.Evaluate())
+
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{}).Return(leafs("w-3", "w-4"), 2, nil).Once()
+	changed := engine.Evaluate()
+	if assert.Len(t, changed, 1) {
+		assert.Equal(t, models.AlertRestartRate, changed[0].Rule)
+		assert.Equal(t, "2", changed[0].Value)
+		assert.Equal(t, "1", changed[0].Threshold)
+	}
+	assert.Len(t, channel.alerts, 1)
+	assert.Len(t, engine.Events.List(EventQuery{Type: models.EventLeafCrashLooping}), 1)
+
+	// Restarts leave the window after an hour
+	now = now.Add(restartWindow)
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{}).Return(leafs("w-3", "w-4"), 2, nil).Once()
+	changed = engine.Evaluate()
+	if assert.Len(t, changed, 1) {
+		assert.Equal(t, models.AlertResolved, changed[0].State)
+	}
+
+	// Removing the stem drops its state without notifying
+	delete(db.Stems, key)
+	assert.Empty(t, engine.Evaluate())
+	assert.Len(t, channel.alerts, 2)
+}
+
+func TestWebhookChannel_Send(t *testing.T) {
+	var received models.Alert
+	var token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("Authorization")
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		if received.Stem == "broken" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	channel, err := NewAlertChannel(AlertChannelWebhook, server.URL, map[string]string{"Authorization": "Bearer secret"})
+	assert.NoError(t, err)
+	assert.NoError(t, channel.Send(models.Alert{Stem: "api", Rule: models.AlertLatency, State: models.AlertFiring}))
+	assert.Equal(t, "Bearer secret", token)
+	assert.Equal(t, models.AlertLatency, received.Rule)
+
+	assert.Error(t, channel.Send(models.Alert{Stem: "broken"}))
+
+	_, err = NewAlertChannel("pager", "", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,232 @@
+package manager
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Signature formats of detached artifact signatures.
+const (
+	SignatureMinisign = "minisign"
+	SignatureCosign   = "cosign"
+)
+
+// ErrArtifactVerification is returned when an artifact doesn't match its checksum or signature, or lacks a
+// required signature.
+var ErrArtifactVerification = errors.New("artifact verification failed")
+
+// SigningPolicy is how herbarium checks the signatures of artifacts. The key is the operator's, not the
+// deployer's, so a deploy can't bring the key its own signature is checked against.
+type SigningPolicy struct {
+	Type      string // minisign or cosign
+	PublicKey string // Public key, inline or the path of a key file
+	Required  bool   // Refuse artifacts without a signature, and uploaded archives
+}
+
+// ArtifactExpectation is what a fetched artifact is checked against.
+type ArtifactExpectation struct {
+	SHA256    string // Hex SHA-256 of the archive, optionally prefixed with sha256:
+	Signature string // URL of the detached signature, defaulting next to the artifact when signatures are required
+}
+
+// Verify checks a fetched artifact against its expected checksum and the detached signature of the signing
+// policy. It returns whether the artifact was verified by either.
+func (f *ArtifactFetcher) Verify(artifact *Artifact, expected ArtifactExpectation) (bool, error) {
+	verified := false
+	if expected.SHA256 != "" {
+		want := "sha256:" + strings.ToLower(strings.TrimPrefix(expected.SHA256, "sha256:"))
+		if artifact.Digest != want {
+			return false, fmt.Errorf("%w: %s has digest %s instead of %s", ErrArtifactVerification, artifact.URL, artifact.Digest, want)
+		}
+		verified = true
+	}
+
+	var policy SigningPolicy
+	if f != nil {
+		policy = f.Signing
+	}
+	signatureURL := expected.Signature
+	if signatureURL == "" && policy.Required {
+		if strings.HasPrefix(artifact.URL, "oci://") {
+			return false, fmt.Errorf("%w: %s needs the URL of its signature", ErrArtifactVerification, artifact.URL)
+		}
+		signatureURL = artifact.URL + ".sig"
+		if policy.Type == SignatureMinisign {
+			signatureURL = artifact.URL + ".minisig"
+		}
+	}
+	if signatureURL == "" {
+		return verified, nil
+	}
+	if policy.PublicKey == "" {
+		return false, fmt.Errorf("%w: %s is signed, but no artifacts.signing.public_key is configured", ErrArtifactVerification, artifact.URL)
+	}
+
+	signature, err := f.Fetch(signatureURL)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch signature: %w", err)
+	}
+	defer signature.Remove()
+	signatureData, err := os.ReadFile(signature.Path)
+	if err != nil {
+		return false, err
+	}
+	key, err := readKey(policy.PublicKey)
+	if err != nil {
+		return false, err
+	}
+	file, err := os.Open(artifact.Path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	switch policy.Type {
+	case SignatureMinisign:
+		err = verifyMinisign(file, signatureData, key)
+	case SignatureCosign:
+		err = verifyCosign(file, signatureData, key)
+	default:
+		err = fmt.Errorf("unknown signature type %q", policy.Type)
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: signature %s of %s: %v", ErrArtifactVerification, signatureURL, artifact.URL, err)
+	}
+	return true, nil
+}
+
+// maxLegacyMinisignSize bounds the archives accepted with a legacy minisign signature, which signs the whole
+// archive and so needs it in memory. Larger archives must be signed prehashed, with minisign -H.
+const maxLegacyMinisignSize = 64 << 20
+
+// readKey returns an inline key as it is, or else the contents of the key file it names. A key is inline when
+// it spans several lines, starts with minisign's comment line, or is a lone minisign public key line.
+func readKey(key string) ([]byte, error) {
+	if strings.Contains(key, "\n") || strings.HasPrefix(key, "untrusted comment:") {
+		return []byte(key), nil
+	}
+	if data, err := base64.StdEncoding.DecodeString(key); err == nil && len(data) == 42 {
+		return []byte(key), nil
+	}
+	data, err := os.ReadFile(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %v", err)
+	}
+	return data, nil
+}
+
+// verifyMinisign checks a minisign signature of the archive, with its global signature over the trusted
+// comment. Both legacy signatures of the file and prehashed ones of its BLAKE2b-512 hash are accepted.
+func verifyMinisign(archive io.Reader, signature, publicKey []byte) error {
+	key, err := minisignDecode(string(publicKey), 42)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(string(signature), "\r\n", "\n")), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("not a minisign signature")
+	}
+	sig, err := minisignDecode(lines[1], 74)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid global signature")
+	}
+	if string(key[2:10]) != string(sig[2:10]) {
+		return fmt.Errorf("signed with key %X, not the configured key %X", reverse(sig[2:10]), reverse(key[2:10]))
+	}
+
+	var message []byte
+	switch string(sig[:2]) {
+	case "Ed":
+		if message, err = io.ReadAll(io.LimitReader(archive, maxLegacyMinisignSize+1)); err != nil {
+			return err
+		}
+		if len(message) > maxLegacyMinisignSize {
+			return fmt.Errorf("legacy signatures are only accepted for archives up to %d MiB, sign it with minisign -H", maxLegacyMinisignSize>>20)
+		}
+	case "ED":
+		hash, err := blake2b.New512(nil)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(hash, archive); err != nil {
+			return err
+		}
+		message = hash.Sum(nil)
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", sig[:2])
+	}
+	publicKeyBytes := ed25519.PublicKey(key[10:])
+	if !ed25519.Verify(publicKeyBytes, message, sig[10:]) {
+		return fmt.Errorf("signature does not match")
+	}
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(publicKeyBytes, append(append([]byte(nil), sig[10:]...), trusted...), global) {
+		return fmt.Errorf("global signature over the trusted comment does not match")
+	}
+	return nil
+}
+
+// minisignDecode decodes the base64 line of a minisign key or signature, skipping its comment line.
+func minisignDecode(text string, size int) ([]byte, error) {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", size, len(data))
+	}
+	return data, nil
+}
+
+// reverse returns b in reverse order, as minisign prints key IDs.
+func reverse(b []byte) []byte {
+	reversed := make([]byte, len(b))
+	for i := range b {
+		reversed[len(b)-1-i] = b[i]
+	}
+	return reversed
+}
+
+// verifyCosign checks a signature made with cosign sign-blob --key: the base64 of an ECDSA signature over
+// the SHA-256 of the archive.
+func verifyCosign(archive io.Reader, signature, publicKey []byte) error {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return fmt.Errorf("public key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("public key is not an ECDSA key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("signature is not base64 encoded")
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, archive); err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(key, hash.Sum(nil), sig) {
+		return fmt.Errorf("signature does not match")
+	}
+	return nil
+}
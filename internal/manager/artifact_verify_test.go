@@ -0,0 +1,211 @@
+package manager
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignSign returns the minisign public key and a signature of data, prehashed when algorithm is ED.
+func minisignSign(t *testing.T, data []byte, algorithm string) (string, string) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	message := data
+	if algorithm == "ED" {
+		hash := blake2b.Sum512(data)
+		message = hash[:]
+	}
+	signature := ed25519.Sign(private, message)
+	trusted := "timestamp:1760000000\tfile:billing.tar.gz"
+	global := ed25519.Sign(private, append(append([]byte(nil), signature...), trusted...))
+	key := "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), public...)) + "\n"
+	return key, "untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), keyID...), signature...)) + "\n" +
+		"trusted comment: " + trusted + "\n" + base64.StdEncoding.EncodeToString(global) + "\n"
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	archive := []byte("archive")
+	for _, algorithm := range []string{"Ed", "ED"} {
+		key, signature := minisignSign(t, archive, algorithm)
+		assert.NoError(t, verifyMinisign(strings.NewReader("archive"), []byte(signature), []byte(key)), algorithm)
+		assert.ErrorContains(t, verifyMinisign(strings.NewReader("tampered"), []byte(signature), []byte(key)), "signature does not match")
+	}
+
+	// Signatures of another key and altered trusted comments are refused
+	key, _ := minisignSign(t, archive, "Ed")
+	_, other := minisignSign(t, archive, "Ed")
+	assert.ErrorContains(t, verifyMinisign(strings.NewReader("archive"), []byte(other), []byte(key)), "signature does not match")
+	key, signature := minisignSign(t, archive, "Ed")
+	altered := strings.Replace(signature, "file:billing", "file:reports", 1)
+	assert.ErrorContains(t, verifyMinisign(strings.NewReader("archive"), []byte(altered), []byte(key)), "trusted comment does not match")
+
+	// Legacy signatures of archives too large to hold in memory are refused without reading them whole
+	key, signature = minisignSign(t, archive, "Ed")
+	large := io.LimitReader(zeroReader{}, maxLegacyMinisignSize+1<<20)
+	assert.ErrorContains(t, verifyMinisign(large, []byte(signature), []byte(key)), "minisign -H")
+}
+
+// zeroReader reads endless zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestReadKey(t *testing.T) {
+	key, _ := minisignSign(t, []byte("archive"), "ED")
+	keyLine := strings.Split(key, "\n")[1]
+
+	// Inline keys, with or without their comment line, are used as they are
+	for _, inline := range []string{key, strings.TrimSpace(key), keyLine} {
+		data, err := readKey(inline)
+		assert.NoError(t, err)
+		assert.Equal(t, inline, string(data))
+	}
+
+	// Anything else names a key file, whatever it starts with
+	path := filepath.Join(t.TempDir(), "RWkeys.pub")
+	assert.NoError(t, os.WriteFile(path, []byte(key), 0o600))
+	data, err := readKey(path)
+	assert.NoError(t, err)
+	assert.Equal(t, key, string(data))
+	_, err = readKey(filepath.Join(t.TempDir(), "RWmissing.pub"))
+	assert.ErrorContains(t, err, "failed to read public key")
+}
+
+func TestVerifyCosign(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	assert.NoError(t, err)
+	key := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	digest := sha256.Sum256([]byte("archive"))
+	sig, err := ecdsa.SignASN1(rand.Reader, private, digest[:])
+	assert.NoError(t, err)
+	signature := []byte(base64.StdEncoding.EncodeToString(sig))
+
+	assert.NoError(t, verifyCosign(strings.NewReader("archive"), signature, key))
+	assert.ErrorContains(t, verifyCosign(strings.NewReader("tampered"), signature, key), "signature does not match")
+	assert.ErrorContains(t, verifyCosign(strings.NewReader("archive"), signature, []byte("RWQ")), "not PEM encoded")
+}
+
+func TestArtifactFetcher_Verify(t *testing.T) {
+	archive := []byte("archive")
+	key, signature := minisignSign(t, archive, "ED")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/billing.tar.gz", "/unsigned.tar.gz":
+			w.Write(archive)
+		case "/billing.tar.gz.minisig":
+			w.Write([]byte(signature))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var fetcher *ArtifactFetcher
+	artifact, err := fetcher.Fetch(server.URL + "/billing.tar.gz")
+	assert.NoError(t, err)
+	defer artifact.Remove()
+	digest := sha256.Sum256(archive)
+
+	// Without a checksum or signature nothing is verified
+	verified, err := fetcher.Verify(artifact, ArtifactExpectation{})
+	assert.NoError(t, err)
+	assert.False(t, verified)
+
+	verified, err = fetcher.Verify(artifact, ArtifactExpectation{SHA256: strings.ToUpper(hex.EncodeToString(digest[:]))})
+	assert.NoError(t, err)
+	assert.True(t, verified)
+	_, err = fetcher.Verify(artifact, ArtifactExpectation{SHA256: "sha256:" + strings.Repeat("0", 64)})
+	assert.True(t, errors.Is(err, ErrArtifactVerification), "%v", err)
+
+	// Signatures need a configured key, and are found next to the artifact when required
+	_, err = fetcher.Verify(artifact, ArtifactExpectation{Signature: server.URL + "/billing.tar.gz.minisig"})
+	assert.ErrorContains(t, err, "no artifacts.signing.public_key is configured")
+	fetcher = &ArtifactFetcher{Signing: SigningPolicy{Type: SignatureMinisign, PublicKey: key, Required: true}}
+	verified, err = fetcher.Verify(artifact, ArtifactExpectation{})
+	assert.NoError(t, err)
+	assert.True(t, verified)
+
+	unsigned, err := fetcher.Fetch(server.URL + "/unsigned.tar.gz")
+	assert.NoError(t, err)
+	defer unsigned.Remove()
+	_, err = fetcher.Verify(unsigned, ArtifactExpectation{})
+	assert.True(t, errors.Is(err, ErrArtifactFetch), "%v", err)
+	_, err = fetcher.Verify(&Artifact{URL: "oci://registry.internal/billing:v2"}, ArtifactExpectation{})
+	assert.True(t, errors.Is(err, ErrArtifactVerification), "%v", err)
+
+	// Keys are also read from files
+	path := filepath.Join(t.TempDir(), "minisign.pub")
+	assert.NoError(t, os.WriteFile(path, []byte(key), 0644))
+	fetcher.Signing.PublicKey = path
+	_, err = fetcher.Verify(artifact, ArtifactExpectation{})
+	assert.NoError(t, err)
+}
+
+func TestStemManager_VerifiedArtifacts(t *testing.T) {
+	rootFolder := t.TempDir()
+	t.Setenv("PLANTARIUM_ROOT_FOLDER", rootFolder)
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	mockLeafManager := new(MockLeafManager)
+	mockProxyClient := new(MockProxyClient)
+	stemManager := NewStemManager(repos.NewStemRepository(herbariumDB), mockLeafManager, mockProxyClient)
+	mockProxyClient.On("BindStem", "reports", proxy.BackendOptions{}).Return(nil)
+	mockLeafManager.On("StartLeaf", "reports", "v1", (*string)(nil)).Return("leaf", nil)
+	instances := 1
+
+	archive := deploymentArchive(t, map[string]string{"bin/reports": "binary"}).Bytes()
+	digest := sha256.Sum256(archive)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	// A stem whose artifact doesn't match its checksum is not registered
+	config := models.StemConfig{Name: "reports", Version: "v1", URL: "/reports", Command: "./bin/reports", MinInstances: &instances,
+		Artifact: &models.ArtifactConfig{URL: server.URL + "/reports.tar.gz", SHA256: strings.Repeat("0", 64)}}
+	err := stemManager.RegisterStem(config)
+	assert.True(t, errors.Is(err, ErrArtifactVerification), "%v", err)
+	_, err = stemManager.FetchStemInfo(storage.StemKey{Name: "reports", Version: "v1"})
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(rootFolder, "services", "reports", "v1", "bin", "reports"))
+
+	// The verified digest is recorded on the stem
+	config.Artifact.SHA256 = hex.EncodeToString(digest[:])
+	assert.NoError(t, stemManager.RegisterStem(config))
+	stem, err := stemManager.FetchStemInfo(storage.StemKey{Name: "reports", Version: "v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:"+hex.EncodeToString(digest[:]), stem.Metadata.ArtifactDigest)
+
+	// Uploads are refused when signatures are required
+	stemManager.Artifacts = &ArtifactFetcher{Signing: SigningPolicy{Type: SignatureCosign, Required: true}}
+	_, err = stemManager.DeployStem(strings.NewReader("archive"))
+	assert.True(t, errors.Is(err, ErrArtifactVerification), "%v", err)
+}
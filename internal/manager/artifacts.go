@@ -0,0 +1,456 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultArtifactTimeout bounds how long downloading an artifact may take.
+const DefaultArtifactTimeout = 10 * time.Minute
+
+// MaxArtifactBytes caps the size of a downloaded artifact.
+const MaxArtifactBytes = 512 << 20
+
+// ErrArtifactFetch is returned when an artifact can't be downloaded from where it is stored.
+var ErrArtifactFetch = errors.New("failed to fetch artifact")
+
+// OCI media types of the manifests and layers herbarium reads artifacts from.
+const (
+	ociManifestType    = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body, as signed for S3 GET requests.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Credentials are how herbarium signs requests to S3 or a compatible store. Without an access key,
+// requests are sent anonymously.
+type S3Credentials struct {
+	Endpoint        string // S3 API URL, objects are addressed path-style below it
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// RegistryCredentials are how herbarium authenticates to an OCI registry.
+type RegistryCredentials struct {
+	Username string
+	Password string
+	Insecure bool // Plain HTTP instead of HTTPS
+}
+
+// Artifact is a downloaded artifact, kept in a temporary file until it is unpacked.
+type Artifact struct {
+	URL    string // Where the artifact was fetched from
+	Path   string // Temporary file holding it, removed by Remove
+	Digest string // SHA-256 of its contents, as sha256:<hex>
+
+	Annotations map[string]string // Annotations of an OCI artifact's manifest and layer, nil for other artifacts
+}
+
+// Remove deletes the temporary file of the artifact.
+func (a *Artifact) Remove() {
+	os.Remove(a.Path)
+}
+
+// ArtifactFetcher downloads the archives of service versions from https:// URLs, S3 buckets, and OCI
+// registries. A nil fetcher downloads with the defaults and without credentials.
+type ArtifactFetcher struct {
+	Timeout    time.Duration                  // How long a download may take
+	S3         S3Credentials                  // Credentials of s3:// artifacts
+	Registries map[string]RegistryCredentials // Credentials of oci:// artifacts by registry host
+	Signing    SigningPolicy                  // How detached signatures of artifacts are checked
+}
+
+// NewArtifactFetcherFromConfig creates the fetcher configured by the artifacts section of the global config,
+// with the AWS environment variables as defaults for S3.
+func NewArtifactFetcherFromConfig(config *models.GlobalConfig) *ArtifactFetcher {
+	settings := config.Artifacts
+	timeout, err := time.ParseDuration(settings.Timeout)
+	if settings.Timeout != "" && err != nil {
+		log.Printf("Invalid artifacts.timeout %q, using %s: %v", settings.Timeout, DefaultArtifactTimeout, err)
+	}
+	fetcher := &ArtifactFetcher{
+		Timeout: timeout,
+		S3: S3Credentials{
+			Endpoint:        settings.S3.Endpoint,
+			Region:          firstNonEmpty(settings.S3.Region, os.Getenv("AWS_REGION"), "us-east-1"),
+			AccessKeyID:     firstNonEmpty(settings.S3.AccessKeyID, os.Getenv("AWS_ACCESS_KEY_ID")),
+			SecretAccessKey: firstNonEmpty(settings.S3.SecretAccessKey, os.Getenv("AWS_SECRET_ACCESS_KEY")),
+			SessionToken:    firstNonEmpty(settings.S3.SessionToken, os.Getenv("AWS_SESSION_TOKEN")),
+		},
+		Registries: make(map[string]RegistryCredentials),
+		Signing:    SigningPolicy{Type: settings.Signing.Type, PublicKey: settings.Signing.PublicKey, Required: settings.Signing.Required},
+	}
+	for _, registry := range settings.Registries {
+		fetcher.Registries[registry.Host] = RegistryCredentials{Username: registry.Username, Password: registry.Password, Insecure: registry.Insecure}
+	}
+	return fetcher
+}
+
+// Fetch downloads the artifact at rawURL to a temporary file, which the caller removes. Artifacts from OCI
+// registries are checked against the digest of their layer.
+func (f *ArtifactFetcher) Fetch(rawURL string) (*Artifact, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: artifact %q is not a URL", ErrInvalidDeployment, rawURL)
+	}
+	client := &http.Client{Timeout: DefaultArtifactTimeout}
+	if f != nil && f.Timeout > 0 {
+		client.Timeout = f.Timeout
+	}
+
+	var body io.ReadCloser
+	var expected string
+	var annotations map[string]string
+	started := time.Now()
+	switch parsed.Scheme {
+	case "https", "http":
+		body, err = f.fetchHTTP(client, rawURL)
+	case "s3":
+		body, err = f.fetchS3(client, parsed.Host, strings.TrimPrefix(parsed.Path, "/"))
+	case "oci":
+		body, expected, annotations, err = f.fetchOCI(client, parsed.Host, strings.TrimPrefix(parsed.Path, "/"))
+	default:
+		return nil, fmt.Errorf("%w: artifact %s must be an https://, s3://, or oci:// URL", ErrInvalidDeployment, rawURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrArtifactFetch, rawURL, err)
+	}
+	defer body.Close()
+
+	file, err := os.CreateTemp("", "herbarium-artifact-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact file: %v", err)
+	}
+	artifact := &Artifact{URL: rawURL, Path: file.Name(), Annotations: annotations}
+	digest := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, digest), io.LimitReader(body, MaxArtifactBytes+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		artifact.Remove()
+		return nil, fmt.Errorf("%w %s: %v", ErrArtifactFetch, rawURL, err)
+	}
+	if written > MaxArtifactBytes {
+		artifact.Remove()
+		return nil, fmt.Errorf("%w: artifact %s is larger than %d bytes", ErrInvalidDeployment, rawURL, MaxArtifactBytes)
+	}
+	artifact.Digest = "sha256:" + hex.EncodeToString(digest.Sum(nil))
+	if expected != "" && artifact.Digest != expected {
+		artifact.Remove()
+		return nil, fmt.Errorf("%w: artifact %s has digest %s instead of %s", ErrInvalidDeployment, rawURL, artifact.Digest, expected)
+	}
+	log.Printf("Fetched artifact %s (%d bytes, %s) in %s", rawURL, written, artifact.Digest, time.Since(started).Round(time.Millisecond))
+	return artifact, nil
+}
+
+// fetchHTTP downloads an artifact served over HTTP.
+func (f *ArtifactFetcher) fetchHTTP(client *http.Client, rawURL string) (io.ReadCloser, error) {
+	request, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return artifactBody(client.Do(request))
+}
+
+// fetchS3 downloads an object, signing the request with the fetcher's S3 credentials.
+func (f *ArtifactFetcher) fetchS3(client *http.Client, bucket, key string) (io.ReadCloser, error) {
+	var credentials S3Credentials
+	if f != nil {
+		credentials = f.S3
+	}
+	if credentials.Region == "" {
+		credentials.Region = "us-east-1"
+	}
+	endpoint := credentials.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + credentials.Region + ".amazonaws.com"
+	}
+	request, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/"+bucket+"/"+key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if credentials.AccessKeyID != "" {
+		signS3Request(request, credentials, time.Now())
+	}
+	return artifactBody(client.Do(request))
+}
+
+// signS3Request adds an AWS Signature Version 4 authorization to a GET request, signing its host and every
+// header already set on it.
+func signS3Request(request *http.Request, credentials S3Credentials, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if credentials.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{request.Method, s3EscapePath(request.URL.Path), request.URL.RawQuery,
+		canonicalHeaders.String(), signedHeaders, emptyPayloadHash}, "\n")
+	scope := amzDate[:8] + "/" + credentials.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{amzDate[:8], credentials.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// s3EscapePath URI-encodes an object path as S3 signs it, keeping the slashes.
+func s3EscapePath(path string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(path) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', strings.IndexByte("-._~/", b) >= 0:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// fetchOCI downloads the archive layer of an artifact in an OCI registry, referenced as <repository>:<tag> or
+// <repository>@<digest>, and returns it with the layer's digest and the annotations of the manifest and layer.
+func (f *ArtifactFetcher) fetchOCI(client *http.Client, registry, reference string) (io.ReadCloser, string, map[string]string, error) {
+	repository, tag := reference, "latest"
+	if at := strings.Index(reference, "@"); at >= 0 {
+		repository, tag = reference[:at], reference[at+1:]
+	} else if colon := strings.LastIndex(reference, ":"); colon > strings.LastIndex(reference, "/") {
+		repository, tag = reference[:colon], reference[colon+1:]
+	}
+	var credentials RegistryCredentials
+	if f != nil {
+		credentials = f.Registries[registry]
+	}
+	registryClient := &ociClient{client: client, credentials: credentials, base: "https://" + registry + "/v2/" + repository}
+	if credentials.Insecure {
+		registryClient.base = "http://" + registry + "/v2/" + repository
+	}
+
+	manifestBody, err := registryClient.get("/manifests/"+tag, ociManifestType+", "+dockerManifestType)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(manifestBody, 1<<20))
+	manifestBody.Close()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if strings.HasPrefix(tag, "sha256:") {
+		if digest := sha256.Sum256(data); "sha256:"+hex.EncodeToString(digest[:]) != tag {
+			return nil, "", nil, fmt.Errorf("manifest does not match digest %s", tag)
+		}
+	}
+	var manifest struct {
+		Annotations map[string]string `json:"annotations"`
+		Layers      []struct {
+			MediaType   string            `json:"mediaType"`
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, "", nil, fmt.Errorf("failed to decode manifest: %v", err)
+	}
+	// The archive is the only layer, or the first gzip-compressed one
+	layer := -1
+	for i, candidate := range manifest.Layers {
+		if len(manifest.Layers) == 1 || strings.HasSuffix(candidate.MediaType, "gzip") {
+			layer = i
+			break
+		}
+	}
+	if layer < 0 {
+		return nil, "", nil, fmt.Errorf("manifest of %s has no gzip-compressed layer", reference)
+	}
+	digest := manifest.Layers[layer].Digest
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil, "", nil, fmt.Errorf("layer digest %q is not a sha256 digest", digest)
+	}
+	annotations := manifest.Annotations
+	for name, value := range manifest.Layers[layer].Annotations {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[name] = value
+	}
+	blob, err := registryClient.get("/blobs/"+digest, "")
+	return blob, digest, annotations, err
+}
+
+// ociClient sends requests to a repository of an OCI registry, answering its authentication challenges.
+type ociClient struct {
+	client        *http.Client
+	credentials   RegistryCredentials
+	base          string // Registry URL of the repository, up to /v2/<repository>
+	authorization string // Authorization header once a challenge was answered
+}
+
+// get requests path below the repository, authenticating once when the registry asks for it.
+func (c *ociClient) get(path, accept string) (io.ReadCloser, error) {
+	send := func() (*http.Response, error) {
+		request, err := http.NewRequest(http.MethodGet, c.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		if c.authorization != "" {
+			request.Header.Set("Authorization", c.authorization)
+		}
+		return c.client.Do(request)
+	}
+	resp, err := send()
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && c.authorization == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authenticate(challenge); err != nil {
+			return nil, err
+		}
+		resp, err = send()
+	}
+	return artifactBody(resp, err)
+}
+
+// authenticate answers a registry's challenge: basic credentials, or a bearer token from its token service.
+func (c *ociClient) authenticate(challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.credentials.Username == "" {
+			return fmt.Errorf("registry requires credentials")
+		}
+		request, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+		request.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+		c.authorization = request.Header.Get("Authorization")
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("registry asks for unsupported authentication %q", challenge)
+	}
+
+	values := parseChallenge(params)
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return fmt.Errorf("registry challenge %q has no token realm", challenge)
+	}
+	query := tokenURL.Query()
+	for _, name := range []string{"service", "scope"} {
+		if values[name] != "" {
+			query.Set(name, values[name])
+		}
+	}
+	tokenURL.RawQuery = query.Encode()
+	request, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.credentials.Username != "" {
+		request.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+	}
+	body, err := artifactBody(c.client.Do(request))
+	if err != nil {
+		return fmt.Errorf("failed to get registry token: %v", err)
+	}
+	defer body.Close()
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to decode registry token: %v", err)
+	}
+	c.authorization = "Bearer " + firstNonEmpty(token.Token, token.AccessToken)
+	return nil
+}
+
+// parseChallenge reads the key="value" parameters of a WWW-Authenticate challenge.
+func parseChallenge(params string) map[string]string {
+	values := make(map[string]string)
+	for params != "" {
+		key, rest, found := strings.Cut(params, "=")
+		if !found {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		values[key] = value
+		params = strings.TrimSpace(rest)
+	}
+	return values
+}
+
+// artifactBody returns the body of a successful download, failing on any other status.
+func artifactBody(resp *http.Response, err error) (io.ReadCloser, error) {
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return resp.Body, nil
+}
+
+// firstNonEmpty returns the first of values that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,240 @@
+package manager
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+const (
+	// DefaultAutoscaleInterval is how often the autoscaler checks the stems' autoscale targets.
+	DefaultAutoscaleInterval = 30 * time.Second
+
+	// DefaultScaleDownDelay is how long a stem's signals must stay low before a leaf is removed.
+	DefaultScaleDownDelay = 5 * time.Minute
+
+	// autoscaleTolerance is how far above its target a signal may be before leafs are added.
+	autoscaleTolerance = 0.1
+
+	// scaleDownRatio is the share of their target all signals must stay below for a leaf to be removed.
+	scaleDownRatio = 0.5
+)
+
+// Autoscaler scales stems on how saturated their leafs are, as measured by the proxy: requests waiting in the
+// proxy's queues and the leafs' average response time, each against the stem's target. A stem whose signals
+// exceed their target gets as many leafs as bring the busiest signal back to it, up to maxInstances. A stem
+// whose signals all stay below half their target for scaleDownDelay loses one leaf at a time, down to its
+// minInstances, its disruption.minHealthy, or the leafs its schedule asks for, and only as far as its disruption
+// budget allows. Stems scaled to zero are left to their graft node.
+type Autoscaler struct {
+	StemRepo    repos.StemRepositoryInterface
+	LeafManager LeafManagerInterface
+	ProxyClient proxy.ProxyClient
+	StemManager StemManagerInterface
+	Budget      *DisruptionBudget // Limits leaf removals, shared with the recycler
+
+	mu        sync.Mutex                    // Serializes passes
+	now       func() time.Time              // Clock scale-down delays are measured against
+	calmSince map[storage.StemKey]time.Time // Since when the signals of each stem stayed low
+	warned    map[storage.StemKey]bool      // Stems already warned about a signal the proxy can't measure
+}
+
+// NewAutoscaler creates an Autoscaler for the stems in stemRepo, scaled through stemManager.
+func NewAutoscaler(stemRepo repos.StemRepositoryInterface, leafManager LeafManagerInterface, proxyClient proxy.ProxyClient, stemManager StemManagerInterface) *Autoscaler {
+	return &Autoscaler{
+		StemRepo:    stemRepo,
+		LeafManager: leafManager,
+		ProxyClient: proxyClient,
+		StemManager: stemManager,
+		Budget:      NewDisruptionBudget(),
+		now:         time.Now,
+		calmSince:   make(map[storage.StemKey]time.Time),
+		warned:      make(map[storage.StemKey]bool),
+	}
+}
+
+// StartSchedule checks the autoscale targets every interval until stop is closed.
+func (a *Autoscaler) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Checking autoscale targets every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("autoscaler", func() { a.ScaleOnce() })
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// ScaleOnce scales every stem with autoscale targets whose leafs are saturated or idle, and returns how many
+// stems were scaled.
+func (a *Autoscaler) ScaleOnce() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stems, err := a.StemRepo.GetAllStems()
+	if err != nil {
+		log.Printf("Failed to list stems for autoscaling: %v", err)
+		return 0
+	}
+
+	scaled := 0
+	autoscaled := make(map[storage.StemKey]bool)
+	for _, stem := range stems {
+		if stem.Config == nil || stem.Config.Autoscale == nil || !proxied(stem.Config) {
+			continue
+		}
+		key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+		autoscaled[key] = true
+		if a.autoscale(key, stem) {
+			scaled++
+		}
+	}
+
+	for key := range a.calmSince {
+		if !autoscaled[key] {
+			delete(a.calmSince, key)
+		}
+	}
+	return scaled
+}
+
+// autoscale scales a stem on its signals and reports whether it was scaled.
+func (a *Autoscaler) autoscale(key storage.StemKey, stem *models.Stem) bool {
+	config := stem.Config
+	if config.MaxInstances == nil {
+		a.warnOnce(key, "Stem %s version %s sets autoscale without maxInstances, it is not autoscaled", key.Name, key.Version)
+		return false
+	}
+	running, err := a.LeafManager.GetRunningLeafs(key)
+	if err != nil {
+		log.Printf("Failed to retrieve running leafs of stem %s for autoscaling: %v", key.Name, err)
+		return false
+	}
+	current := len(running)
+	if current == 0 {
+		return false
+	}
+	ratio, measured := a.saturation(key, stem, running)
+	if !measured {
+		return false
+	}
+
+	now := a.now()
+	target := current
+	switch {
+	case ratio > 1+autoscaleTolerance:
+		delete(a.calmSince, key)
+		target = min(int(math.Ceil(float64(current)*ratio)), *config.MaxInstances)
+	case ratio < scaleDownRatio:
+		floor, err := scheduledInstances(config, now)
+		if err != nil || current <= max(floor, minHealthyOf(config)) {
+			delete(a.calmSince, key)
+			return false
+		}
+		since, calm := a.calmSince[key]
+		if !calm {
+			a.calmSince[key] = now
+			return false
+		}
+		if now.Sub(since) < scaleDownDelayOf(config.Autoscale) {
+			return false
+		}
+		if err := a.Budget.Allow(stem); err != nil {
+			log.Printf("Holding back scale-down of stem %s version %s: %v", key.Name, key.Version, err)
+			return false
+		}
+		a.calmSince[key] = now // Another full delay before the next leaf is removed
+		target = current - 1
+	default:
+		delete(a.calmSince, key)
+	}
+	if target == current {
+		return false
+	}
+
+	log.Printf("Autoscaling stem %s version %s from %d to %d leafs at %.0f%% of its targets", key.Name, key.Version, current, target, ratio*100)
+	if err := a.StemManager.Scale(key, target); err != nil {
+		log.Printf("Failed to autoscale stem %s version %s: %v", key.Name, key.Version, err)
+		return false
+	}
+	a.Budget.Changed(key)
+	return true
+}
+
+// saturation returns how far the busiest signal of a stem is from its target, 1 meaning on target. It reports
+// false when no signal could be measured.
+func (a *Autoscaler) saturation(key storage.StemKey, stem *models.Stem, running []models.Leaf) (float64, bool) {
+	targets := stem.Config.Autoscale
+	ratio, measured := 0.0, false
+
+	if targets.TargetQueue > 0 {
+		if reporter, ok := a.ProxyClient.(proxy.QueueReporter); ok {
+			queued, err := reporter.QueuedRequests(stem.HAProxyBackend)
+			if err != nil {
+				log.Printf("Failed to get queued requests of stem %s: %v", stem.Name, err)
+			} else {
+				ratio, measured = max(ratio, float64(queued)/float64(targets.TargetQueue*int64(len(running)))), true
+			}
+		} else {
+			a.warnOnce(key, "The proxy does not report queued requests of stem %s, autoscale.targetQueue is ignored", stem.Name)
+		}
+	}
+
+	if latency, err := time.ParseDuration(targets.TargetLatency); err == nil && latency > 0 {
+		if reporter, ok := a.ProxyClient.(proxy.LatencyReporter); ok {
+			times, err := reporter.ResponseTimes(stem.HAProxyBackend)
+			if err != nil {
+				log.Printf("Failed to get response times of stem %s: %v", stem.Name, err)
+			} else {
+				ratio, measured = max(ratio, float64(averageResponseTime(times, running))/float64(latency)), true
+			}
+		} else {
+			a.warnOnce(key, "The proxy does not measure response times of stem %s, autoscale.targetLatency is ignored", stem.Name)
+		}
+	}
+	return ratio, measured
+}
+
+// warnOnce logs a warning about a stem the first time it comes up.
+func (a *Autoscaler) warnOnce(key storage.StemKey, format string, args ...interface{}) {
+	if !a.warned[key] {
+		log.Printf(format, args...)
+		a.warned[key] = true
+	}
+}
+
+// averageResponseTime returns the average response time of the running leafs that responded recently, 0 when
+// none did.
+func averageResponseTime(times map[string]time.Duration, running []models.Leaf) time.Duration {
+	var total time.Duration
+	responded := 0
+	for _, leaf := range running {
+		if responseTime, ok := times[leaf.HAProxyServer]; ok {
+			total += responseTime
+			responded++
+		}
+	}
+	if responded == 0 {
+		return 0
+	}
+	return total / time.Duration(responded)
+}
+
+// scaleDownDelayOf returns how long the signals of a stem must stay low before a leaf is removed.
+func scaleDownDelayOf(config *models.AutoscaleConfig) time.Duration {
+	if delay, err := time.ParseDuration(config.ScaleDownDelay); err == nil && delay > 0 {
+		return delay
+	}
+	return DefaultScaleDownDelay
+}
@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// saturatedProxyClient is a MockProxyClient that also reports queued requests and response times.
+type saturatedProxyClient struct {
+	*MockProxyClient
+	queued int64
+	times  map[string]time.Duration
+}
+
+func (c *saturatedProxyClient) QueuedRequests(backendName string) (int64, error) {
+	return c.queued, nil
+}
+
+func (c *saturatedProxyClient) ResponseTimes(backendName string) (map[string]time.Duration, error) {
+	return c.times, nil
+}
+
+func TestAutoscaler_ScaleOnce(t *testing.T) {
+	one, six := 1, 6
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api", Config: &models.StemConfig{
+		Name:         "api",
+		Version:      "v1",
+		MinInstances: &one,
+		MaxInstances: &six,
+		Autoscale:    &models.AutoscaleConfig{TargetQueue: 5, TargetLatency: "200ms", ScaleDownDelay: "2m"},
+	}}
+	running := []models.Leaf{
+		{ID: "api-1", HAProxyServer: "api-1", Status: models.StatusRunning},
+		{ID: "api-2", HAProxyServer: "api-2", Status: models.StatusRunning},
+	}
+	leafManager := new(MockLeafManager)
+	leafManager.On("GetRunningLeafs", key).Return(running, nil)
+	stemManager := new(MockStemManager)
+	proxyClient := &saturatedProxyClient{MockProxyClient: new(MockProxyClient)}
+
+	autoscaler := NewAutoscaler(repos.NewStemRepository(db), leafManager, proxyClient, stemManager)
+	now := time.Now()
+	autoscaler.now = func() time.Time { return now }
+
+	// 20 queued requests are twice the target of two leafs; the slower signal decides
+	proxyClient.queued = 20
+	proxyClient.times = map[string]time.Duration{"api-1": 100 * time.Millisecond, "api-2": 140 * time.Millisecond}
+	stemManager.On("Scale", key, 4).Return(nil).Once()
+	assert.Equal(t, 1, autoscaler.ScaleOnce())
+
+	// Latency three times the target asks for more, capped at maxInstances
+	proxyClient.queued = 0
+	proxyClient.times = map[string]time.Duration{"api-1": 600 * time.Millisecond, "api-2": 600 * time.Millisecond, "gone": time.Minute}
+	stemManager.On("Scale", key, 6).Return(nil).Once()
+	assert.Equal(t, 1, autoscaler.ScaleOnce())
+
+	// Close to the target nothing changes
+	proxyClient.times = map[string]time.Duration{"api-1": 210 * time.Millisecond}
+	assert.Equal(t, 0, autoscaler.ScaleOnce())
+
+	// Idle leafs are removed one at a time once the delay has passed
+	proxyClient.times = nil
+	assert.Equal(t, 0, autoscaler.ScaleOnce())
+	now = now.Add(time.Minute)
+	assert.Equal(t, 0, autoscaler.ScaleOnce())
+	now = now.Add(time.Minute)
+	stemManager.On("Scale", key, 1).Return(nil).Once()
+	assert.Equal(t, 1, autoscaler.ScaleOnce())
+	now = now.Add(time.Minute)
+	assert.Equal(t, 0, autoscaler.ScaleOnce())
+	stemManager.AssertExpectations(t)
+
+	// Stems at their minInstances are not scaled down
+	leafManager.ExpectedCalls = nil
+	leafManager.On("GetRunningLeafs", key).Return(running[:1], nil)
+	now = now.Add(time.Hour)
+	assert.Equal(t, 0, autoscaler.ScaleOnce())
+	assert.Equal(t, 0, autoscaler.ScaleOnce())
+	stemManager.AssertExpectations(t)
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/plantarium-platform/herbarium-go/internal/haproxy"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Backend naming strategies selected by proxy.backend_naming.strategy.
+const (
+	BackendNamingURL  = "url"  // Backends are named after the stem's host and URL, so every version of a stem shares one
+	BackendNamingStem = "stem" // Backends are named after the stem's name and version, routed by the URL as their path
+)
+
+// invalidBackendChars matches characters HAProxy does not allow in backend names.
+var invalidBackendChars = regexp.MustCompile(`[^A-Za-z0-9_.:-]`)
+
+// BackendNaming names the proxy backends of stems.
+type BackendNaming struct {
+	Strategy string // BackendNamingURL (default) or BackendNamingStem
+	Prefix   string // Prepended to the backend names of BackendNamingStem
+}
+
+// NewBackendNaming returns the naming configured by proxy.backend_naming. Backends that aren't named after
+// their URL are routed by a rule herbarium adds to the HAProxy frontend, so a managed HAProxy needs
+// haproxy.frontend.
+func NewBackendNaming(config *models.GlobalConfig) (BackendNaming, error) {
+	naming := BackendNaming{Strategy: config.Proxy.BackendNaming.Strategy, Prefix: config.Proxy.BackendNaming.Prefix}
+	switch naming.Strategy {
+	case "", BackendNamingURL:
+	case BackendNamingStem:
+		managesHAProxy := (config.Proxy.Type == "" || config.Proxy.Type == proxy.TypeHAProxy) && config.HAProxy.Mode != haproxy.ModeNone
+		if managesHAProxy && config.HAProxy.Frontend == "" {
+			return naming, fmt.Errorf("proxy.backend_naming.strategy %q needs haproxy.frontend to route requests to the backends", naming.Strategy)
+		}
+		if invalidBackendChars.MatchString(naming.Prefix) {
+			return naming, fmt.Errorf("proxy.backend_naming.prefix %q may only contain letters, digits, '_', '.', ':', and '-'", naming.Prefix)
+		}
+	default:
+		return naming, fmt.Errorf("proxy.backend_naming.strategy %q is not one of url or stem", naming.Strategy)
+	}
+	return naming, nil
+}
+
+// Name returns the name of the backend serving a stem.
+func (n BackendNaming) Name(config models.StemConfig) string {
+	if config.Shadow {
+		return shadowBackend(config.Name, config.Version)
+	}
+	if n.Strategy != BackendNamingStem {
+		if config.Host != "" {
+			return invalidBackendChars.ReplaceAllString(config.Host, "_") + "_" + strings.TrimPrefix(config.URL, "/")
+		}
+		return strings.TrimPrefix(config.URL, "/")
+	}
+	name := invalidBackendChars.ReplaceAllString(config.Name, "_")
+	version := invalidBackendChars.ReplaceAllString(config.Version, "_")
+	return n.Prefix + name + "-" + version
+}
+
+// shadowBackend returns the name of the backend of a shadow stem. Shadow backends aren't routed, so they are
+// named after the stem's name and version whatever the naming strategy, letting the versions mirroring to
+// them find them.
+func shadowBackend(name, version string) string {
+	return "shadow_" + invalidBackendChars.ReplaceAllString(name, "_") + "-" + invalidBackendChars.ReplaceAllString(version, "_")
+}
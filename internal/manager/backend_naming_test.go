@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/haproxy"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendNaming_Name(t *testing.T) {
+	config := models.StemConfig{Name: "hello service", Version: "1.0/beta", URL: "/hello"}
+
+	assert.Equal(t, "hello", BackendNaming{}.Name(config))
+	assert.Equal(t, "hello", BackendNaming{Strategy: BackendNamingURL, Prefix: "hb-"}.Name(config))
+	assert.Equal(t, "hb-hello_service-1.0_beta", BackendNaming{Strategy: BackendNamingStem, Prefix: "hb-"}.Name(config))
+
+	config.Host = "api.example.com"
+	assert.Equal(t, "api.example.com_hello", BackendNaming{}.Name(config))
+	assert.Equal(t, "hb-hello_service-1.0_beta", BackendNaming{Strategy: BackendNamingStem, Prefix: "hb-"}.Name(config))
+
+	// Shadow stems are named after their name and version with any strategy
+	config.Shadow = true
+	assert.Equal(t, "shadow_hello_service-1.0_beta", BackendNaming{}.Name(config))
+	assert.Equal(t, "shadow_hello_service-1.0_beta", BackendNaming{Strategy: BackendNamingStem, Prefix: "hb-"}.Name(config))
+}
+
+func TestNewBackendNaming(t *testing.T) {
+	config := &models.GlobalConfig{}
+	naming, err := NewBackendNaming(config)
+	assert.NoError(t, err)
+	assert.Equal(t, BackendNaming{}, naming)
+
+	config.Proxy.BackendNaming.Strategy = BackendNamingStem
+	_, err = NewBackendNaming(config)
+	assert.EqualError(t, err, `proxy.backend_naming.strategy "stem" needs haproxy.frontend to route requests to the backends`)
+
+	config.HAProxy.Frontend = "http-in"
+	config.Proxy.BackendNaming.Prefix = "hb-"
+	naming, err = NewBackendNaming(config)
+	assert.NoError(t, err)
+	assert.Equal(t, BackendNaming{Strategy: BackendNamingStem, Prefix: "hb-"}, naming)
+
+	// Without a managed HAProxy there is no frontend to route from
+	config.HAProxy.Frontend = ""
+	config.HAProxy.Mode = haproxy.ModeNone
+	_, err = NewBackendNaming(config)
+	assert.NoError(t, err)
+	config.HAProxy.Mode = ""
+
+	// Proxies other than HAProxy route the backends themselves
+	config.Proxy.Type = proxy.TypeEmbedded
+	_, err = NewBackendNaming(config)
+	assert.NoError(t, err)
+
+	config.Proxy.BackendNaming.Prefix = "hb/"
+	_, err = NewBackendNaming(config)
+	assert.Error(t, err)
+
+	config.Proxy.BackendNaming.Strategy = "random"
+	_, err = NewBackendNaming(config)
+	assert.EqualError(t, err, `proxy.backend_naming.strategy "random" is not one of url or stem`)
+}
@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// coldStart holds the requests a graft node receives while it starts the leaf they wait for. The first request
+// starts the leaf, the ones arriving meanwhile wait for the same start instead of starting leafs of their own.
+// Once a start succeeds, later requests get its leaf right away; after a failed one, the next request tries
+// again.
+type coldStart struct {
+	mu       sync.Mutex
+	attempt  *coldStartAttempt // Start in progress, nil when none is
+	arrivals []time.Time       // When the requests waiting for the attempt arrived, oldest first
+	leaf     *models.Leaf      // Leaf started for the graft node, nil until a start succeeded
+}
+
+// coldStartAttempt is a single try at starting the leaf of a graft node.
+type coldStartAttempt struct {
+	done chan struct{} // Closed once the attempt finished
+	leaf *models.Leaf
+	err  error
+}
+
+// wait returns the leaf the graft node started, calling start on the first request and holding the requests
+// arriving until it returns. When start succeeds, the requests it held are passed to record.
+func (c *coldStart) wait(start func() (*models.Leaf, error), record func(models.ColdStart)) (*models.Leaf, error) {
+	c.mu.Lock()
+	if c.leaf != nil {
+		defer c.mu.Unlock()
+		return c.leaf, nil
+	}
+	c.arrivals = append(c.arrivals, time.Now())
+	if attempt := c.attempt; attempt != nil {
+		c.mu.Unlock()
+		<-attempt.done
+		return attempt.leaf, attempt.err
+	}
+	attempt := &coldStartAttempt{done: make(chan struct{})}
+	c.attempt = attempt
+	c.mu.Unlock()
+
+	attempt.leaf, attempt.err = start()
+	ready := time.Now()
+
+	c.mu.Lock()
+	arrivals := c.arrivals
+	c.attempt, c.arrivals = nil, nil
+	if attempt.err == nil {
+		c.leaf = attempt.leaf
+	}
+	close(attempt.done)
+	c.mu.Unlock()
+
+	if attempt.err == nil {
+		record(newColdStart(arrivals, ready))
+	}
+	return attempt.leaf, attempt.err
+}
+
+// newColdStart sums up the requests that arrived before the leaf was ready.
+func newColdStart(arrivals []time.Time, ready time.Time) models.ColdStart {
+	coldStart := models.ColdStart{Started: arrivals[0], Requests: len(arrivals), MaxWait: ready.Sub(arrivals[0])}
+	for _, arrived := range arrivals {
+		coldStart.TotalWait += ready.Sub(arrived)
+	}
+	return coldStart
+}
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColdStart_Wait(t *testing.T) {
+	cold := &coldStart{}
+	var recorded []models.ColdStart
+	record := func(coldStart models.ColdStart) { recorded = append(recorded, coldStart) }
+
+	// A failed start is not recorded, the next request tries again
+	_, err := cold.wait(func() (*models.Leaf, error) { return nil, errors.New("no port") }, record)
+	assert.EqualError(t, err, "no port")
+	assert.Empty(t, recorded)
+
+	// Requests arriving during the start wait for the same leaf
+	release := make(chan struct{})
+	starts := 0
+	start := func() (*models.Leaf, error) {
+		starts++
+		<-release
+		return &models.Leaf{ID: "api-1"}, nil
+	}
+	var wg sync.WaitGroup
+	leafs := make([]*models.Leaf, 3)
+	for i := range leafs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			leafs[i], _ = cold.wait(start, record)
+		}(i)
+	}
+	assert.Eventually(t, func() bool {
+		cold.mu.Lock()
+		defer cold.mu.Unlock()
+		return len(cold.arrivals) == 3
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, 1, starts)
+	for _, leaf := range leafs {
+		assert.Equal(t, "api-1", leaf.ID)
+	}
+	if assert.Len(t, recorded, 1) {
+		assert.Equal(t, 3, recorded[0].Requests)
+		assert.GreaterOrEqual(t, recorded[0].MaxWait, 10*time.Millisecond)
+		assert.GreaterOrEqual(t, recorded[0].TotalWait, 3*recorded[0].MaxWait-30*time.Millisecond)
+	}
+
+	// Later requests get the started leaf without a new cold start
+	leaf, err := cold.wait(start, record)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-1", leaf.ID)
+	assert.Equal(t, 1, starts)
+	assert.Len(t, recorded, 1)
+}
+
+func TestColdStartStats_Add(t *testing.T) {
+	var stats models.ColdStartStats
+	first := time.Now()
+	stats.Add(models.ColdStart{Started: first, Requests: 4, TotalWait: 6 * time.Second, MaxWait: 2 * time.Second})
+	stats.Add(models.ColdStart{Started: first.Add(time.Hour), Requests: 1, TotalWait: 3 * time.Second, MaxWait: 3 * time.Second})
+	assert.Equal(t, models.ColdStartStats{
+		Count:       2,
+		Requests:    5,
+		MaxRequests: 4,
+		TotalWait:   9 * time.Second,
+		MaxWait:     3 * time.Second,
+		Last:        first.Add(time.Hour),
+	}, stats)
+}
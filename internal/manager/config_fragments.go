@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SharedConfigFolder is the folder under the root folder holding config fragments that service configs
+// pull in with extends.
+const SharedConfigFolder = "shared"
+
+// extendsKey is the config key naming the fragments a config extends, as one file or a list of files.
+const extendsKey = "extends"
+
+// mergeConfigFragments resolves the extends key of a service config: the named fragments under sharedDir are
+// merged in order, each over the previous one, and the config itself over all of them. Mappings such as env
+// are merged key by key; lists and scalars are replaced. Fragments may extend other fragments. A config
+// without extends is returned unchanged.
+func mergeConfigFragments(content []byte, sharedDir string) ([]byte, error) {
+	var config map[interface{}]interface{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+	if _, ok := config[extendsKey]; !ok {
+		return content, nil
+	}
+
+	merged, err := resolveFragments(config, sharedDir, nil)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(merged)
+}
+
+// resolveFragments returns config merged over the fragments it extends. chain lists the fragments being
+// resolved, to detect cycles.
+func resolveFragments(config map[interface{}]interface{}, sharedDir string, chain []string) (map[interface{}]interface{}, error) {
+	names, err := extendedFragments(config[extendsKey])
+	if err != nil {
+		return nil, err
+	}
+	delete(config, extendsKey)
+
+	base := map[interface{}]interface{}{}
+	for _, name := range names {
+		path, err := fragmentPath(sharedDir, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, seen := range chain {
+			if seen == path {
+				return nil, fmt.Errorf("config fragment %s extends itself", name)
+			}
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config fragment %s: %v", name, err)
+		}
+		var fragment map[interface{}]interface{}
+		if err := yaml.Unmarshal(content, &fragment); err != nil {
+			return nil, fmt.Errorf("failed to decode config fragment %s: %v", name, err)
+		}
+		if fragment == nil {
+			continue
+		}
+		if fragment, err = resolveFragments(fragment, sharedDir, append(chain, path)); err != nil {
+			return nil, err
+		}
+		base = mergeYAMLMaps(base, fragment)
+	}
+	return mergeYAMLMaps(base, config), nil
+}
+
+// extendedFragments returns the fragment names of an extends value, a string or a list of strings.
+func extendedFragments(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		names := make([]string, 0, len(value))
+		for _, item := range value {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("extends must list fragment file names, got %v", item)
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	default:
+		return nil, fmt.Errorf("extends must be a fragment file name or a list of them, got %v", value)
+	}
+}
+
+// fragmentPath returns the path of a fragment, which must stay inside sharedDir.
+func fragmentPath(sharedDir, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("config fragment %q must be a path inside the %s folder", name, SharedConfigFolder)
+	}
+	return filepath.Join(sharedDir, clean), nil
+}
+
+// mergeYAMLMaps returns base with override merged over it, recursing into mappings both have.
+func mergeYAMLMaps(base, override map[interface{}]interface{}) map[interface{}]interface{} {
+	merged := make(map[interface{}]interface{}, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseMap, baseIsMap := merged[key].(map[interface{}]interface{})
+		overrideMap, overrideIsMap := value.(map[interface{}]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[key] = mergeYAMLMaps(baseMap, overrideMap)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
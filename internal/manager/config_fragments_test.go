@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func writeFragment(t *testing.T, root, name, content string) {
+	path := filepath.Join(root, SharedConfigFolder, name)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestMergeConfigFragments(t *testing.T) {
+	root := t.TempDir()
+	sharedDir := filepath.Join(root, SharedConfigFolder)
+	writeFragment(t, root, "base.yaml", `
+env:
+  LOG_FORMAT: json
+  REGION: eu-west
+stopTimeout: 10s
+`)
+	writeFragment(t, root, "java/defaults.yaml", `
+extends: base.yaml
+runtime: java
+env:
+  JAVA_OPTS: -Xmx512m
+probe:
+  type: http
+  path: /health
+`)
+	writeFragment(t, root, "tracing.yaml", `
+env:
+  OTEL_ENABLED: "true"
+`)
+
+	content, err := mergeConfigFragments([]byte(`
+name: billing
+version: v2
+url: /billing
+extends: [java/defaults.yaml, tracing.yaml]
+env:
+  REGION: us-east
+probe:
+  path: /ready
+`), sharedDir)
+	assert.NoError(t, err)
+	var config models.StemConfig
+	assert.NoError(t, yaml.UnmarshalStrict(content, &config))
+	assert.Equal(t, "billing", config.Name)
+	assert.Equal(t, "java", config.Runtime)
+	assert.Equal(t, "10s", config.StopTimeout)
+	assert.Equal(t, map[string]string{"LOG_FORMAT": "json", "REGION": "us-east", "JAVA_OPTS": "-Xmx512m", "OTEL_ENABLED": "true"}, config.Env)
+	assert.Equal(t, &models.ProbeConfig{Type: ProbeHTTP, Path: "/ready"}, config.Probe)
+
+	// Configs without extends are left as written
+	plain := []byte("name: plain\n")
+	content, err = mergeConfigFragments(plain, sharedDir)
+	assert.NoError(t, err)
+	assert.Equal(t, plain, content)
+
+	writeFragment(t, root, "loop.yaml", "extends: loop.yaml\n")
+	_, err = mergeConfigFragments([]byte("extends: loop.yaml\n"), sharedDir)
+	assert.ErrorContains(t, err, "extends itself")
+	_, err = mergeConfigFragments([]byte("extends: ../services/secret.yaml\n"), sharedDir)
+	assert.ErrorContains(t, err, "must be a path inside the shared folder")
+	_, err = mergeConfigFragments([]byte("extends: missing.yaml\n"), sharedDir)
+	assert.ErrorContains(t, err, "failed to read config fragment missing.yaml")
+}
+
+func TestValidateConfigurations_Fragments(t *testing.T) {
+	root := t.TempDir()
+	writeTestConfig(t, filepath.Join(root, "system", "herbarium"), `
+haproxy:
+  url: "http://localhost:8080"
+security:
+  api_key: "key"
+`)
+	writeFragment(t, root, "defaults.yaml", `
+command: "./start --port={{.PORT}}"
+startMesage: "started"
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "api"), `
+extends: defaults.yaml
+name: api
+url: /api
+version: "v1.0"
+`)
+
+	// Fragments are validated as part of the configs extending them
+	report := ValidateConfigurations(root)
+	assert.False(t, report.Valid())
+	assert.Contains(t, report.String(), "field startMesage not found")
+}
@@ -0,0 +1,137 @@
+package manager
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ConfigAPIVersion is the schema version of the service and global configs this herbarium reads.
+	ConfigAPIVersion = "herbarium/v1"
+
+	// LegacyConfigAPIVersion is assumed for configs without apiVersion, which predate schema versioning.
+	LegacyConfigAPIVersion = "herbarium/v0"
+)
+
+// apiVersionKey is the config key holding the schema version.
+const apiVersionKey = "apiVersion"
+
+// configMigration upgrades a config from one schema version to the next. Migrate rewrites the decoded
+// config in place and reports deprecated settings it replaced through warn.
+type configMigration struct {
+	From    string
+	To      string
+	Migrate func(config map[interface{}]interface{}, warn func(format string, args ...interface{})) error
+}
+
+// serviceConfigMigrations upgrade service configs, in order.
+var serviceConfigMigrations = []configMigration{
+	{From: LegacyConfigAPIVersion, To: ConfigAPIVersion, Migrate: migrateLegacyServiceConfig},
+}
+
+// globalConfigMigrations upgrade the global config, in order.
+var globalConfigMigrations = []configMigration{
+	{From: LegacyConfigAPIVersion, To: ConfigAPIVersion, Migrate: migrateLegacyGlobalConfig},
+}
+
+// migrateServiceConfig upgrades a service config to ConfigAPIVersion, returning the upgraded config and
+// warnings about deprecated settings it still uses.
+func migrateServiceConfig(content []byte) ([]byte, []string, error) {
+	return migrateConfig(content, serviceConfigMigrations)
+}
+
+// migrateGlobalConfig upgrades the global config to ConfigAPIVersion, returning the upgraded config and
+// warnings about deprecated settings it still uses.
+func migrateGlobalConfig(content []byte) ([]byte, []string, error) {
+	return migrateConfig(content, globalConfigMigrations)
+}
+
+// migrateConfig runs the migrations from the config's apiVersion up to ConfigAPIVersion. A config already at
+// ConfigAPIVersion is returned unchanged.
+func migrateConfig(content []byte, migrations []configMigration) ([]byte, []string, error) {
+	var config map[interface{}]interface{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, nil, err
+	}
+	if config == nil {
+		return content, nil, nil
+	}
+
+	version := LegacyConfigAPIVersion
+	if value, ok := config[apiVersionKey]; ok {
+		if version, ok = value.(string); !ok {
+			return nil, nil, fmt.Errorf("apiVersion must be a string, got %v", value)
+		}
+	}
+	if version == ConfigAPIVersion {
+		return content, nil, nil
+	}
+
+	var warnings []string
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+	for _, migration := range migrations {
+		if migration.From != version {
+			continue
+		}
+		if err := migration.Migrate(config, warn); err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate config from %s to %s: %v", migration.From, migration.To, err)
+		}
+		version = migration.To
+	}
+	if version != ConfigAPIVersion {
+		return nil, nil, fmt.Errorf("unsupported apiVersion %q, expected %s", version, ConfigAPIVersion)
+	}
+
+	config[apiVersionKey] = ConfigAPIVersion
+	migrated, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrated, warnings, nil
+}
+
+// migrateLegacyServiceConfig upgrades an unversioned service config. The legacy ServiceConfig shape wrapped
+// the service in a services list, and dependencies could be listed by name alone.
+func migrateLegacyServiceConfig(config map[interface{}]interface{}, warn func(format string, args ...interface{})) error {
+	if value, ok := config["services"]; ok {
+		services, ok := value.([]interface{})
+		if !ok || len(services) != 1 {
+			return fmt.Errorf("services must list exactly one service, put each service in its own folder")
+		}
+		service, ok := services[0].(map[interface{}]interface{})
+		if !ok {
+			return fmt.Errorf("services must list a service config, got %v", services[0])
+		}
+		delete(config, "services")
+		for key, value := range service {
+			if _, ok := config[key]; !ok {
+				config[key] = value
+			}
+		}
+		warn("services is deprecated, move the service's settings to the top level of config.yaml")
+	}
+
+	if dependencies, ok := config["dependencies"].([]interface{}); ok {
+		for i, dependency := range dependencies {
+			if name, ok := dependency.(string); ok {
+				dependencies[i] = map[interface{}]interface{}{"name": name}
+				warn("dependency %s is listed by name, which is deprecated; use - name: %s", name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateLegacyGlobalConfig upgrades an unversioned global config. plantarium.root_folder has no effect, as
+// PLANTARIUM_ROOT_FOLDER decides the root folder, so it is only reported.
+func migrateLegacyGlobalConfig(config map[interface{}]interface{}, warn func(format string, args ...interface{})) error {
+	if plantarium, ok := config["plantarium"].(map[interface{}]interface{}); ok {
+		if _, ok := plantarium["root_folder"]; ok {
+			warn("plantarium.root_folder is deprecated and ignored, set PLANTARIUM_ROOT_FOLDER instead")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMigrateServiceConfig(t *testing.T) {
+	// The legacy ServiceConfig wrapped the service in a services list
+	content, warnings, err := migrateServiceConfig([]byte(`
+services:
+  - name: billing
+    url: /billing
+    version: v2
+    dependencies: [postgres, {name: redis, schema: billing}]
+`))
+	assert.NoError(t, err)
+	var config models.StemConfig
+	assert.NoError(t, yaml.UnmarshalStrict(content, &config))
+	assert.Equal(t, ConfigAPIVersion, config.APIVersion)
+	assert.Equal(t, "billing", config.Name)
+	assert.Equal(t, "/billing", config.URL)
+	assert.Equal(t, []models.Dependency{{Name: "postgres"}, {Name: "redis", Schema: "billing"}}, config.Dependencies)
+	assert.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "services is deprecated")
+	assert.Contains(t, warnings[1], "dependency postgres is listed by name")
+
+	// Unversioned configs in the current shape only gain an apiVersion
+	content, warnings, err = migrateServiceConfig([]byte("name: api\nversion: v1\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.NoError(t, yaml.UnmarshalStrict(content, &config))
+	assert.Equal(t, ConfigAPIVersion, config.APIVersion)
+
+	current := []byte("apiVersion: herbarium/v1\nname: api\n")
+	content, warnings, err = migrateServiceConfig(current)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, current, content)
+
+	_, _, err = migrateServiceConfig([]byte("apiVersion: herbarium/v9\nname: api\n"))
+	assert.ErrorContains(t, err, `unsupported apiVersion "herbarium/v9"`)
+	_, _, err = migrateServiceConfig([]byte("services: [{name: a}, {name: b}]\n"))
+	assert.ErrorContains(t, err, "services must list exactly one service")
+}
+
+func TestValidateConfigurations_Migrations(t *testing.T) {
+	root := t.TempDir()
+	writeTestConfig(t, filepath.Join(root, "system", "herbarium"), `
+plantarium:
+  root_folder: /opt/plantarium
+haproxy:
+  url: "http://localhost:8080"
+security:
+  api_key: "key"
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "api"), `
+services:
+  - name: api
+    url: /api
+    command: "./api --port={{.PORT}}"
+    version: "v1.0"
+`)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "services"), 0755))
+
+	// Deprecated settings are warnings, the migrated configs are valid
+	report := ValidateConfigurations(root)
+	assert.True(t, report.Valid(), report.String())
+	assert.Contains(t, report.String(), "warning: plantarium.root_folder is deprecated")
+	assert.Contains(t, report.String(), "warning: services is deprecated")
+}
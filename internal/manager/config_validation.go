@@ -0,0 +1,1203 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/policy"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+// validationPort is the sample port used to render command templates during validation.
+const validationPort = 10000
+
+// ConfigValidationResult holds the problems found in a single configuration file.
+type ConfigValidationResult struct {
+	Name     string   // Service name, or "herbarium" for the global config
+	Path     string   // Path of the validated config file or service directory
+	Errors   []string // Problems that would prevent the platform from running the service
+	Warnings []string // Suspicious settings that don't block startup
+}
+
+// ConfigValidationReport is the outcome of validating the global config and all service configs.
+type ConfigValidationReport struct {
+	Results []*ConfigValidationResult
+}
+
+// Valid reports whether no errors were found.
+func (r *ConfigValidationReport) Valid() bool {
+	for _, result := range r.Results {
+		if len(result.Errors) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the report in a human-readable form.
+func (r *ConfigValidationReport) String() string {
+	var b strings.Builder
+	errorCount, warningCount := 0, 0
+	for _, result := range r.Results {
+		status := "OK"
+		if len(result.Errors) > 0 {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "[%s] %s (%s)\n", status, result.Name, result.Path)
+		for _, e := range result.Errors {
+			fmt.Fprintf(&b, "    error: %s\n", e)
+		}
+		for _, w := range result.Warnings {
+			fmt.Fprintf(&b, "    warning: %s\n", w)
+		}
+		errorCount += len(result.Errors)
+		warningCount += len(result.Warnings)
+	}
+	fmt.Fprintf(&b, "%d configs checked, %d errors, %d warnings\n", len(r.Results), errorCount, warningCount)
+	return b.String()
+}
+
+func (r *ConfigValidationResult) errorf(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+func (r *ConfigValidationResult) warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// ValidateConfigurations loads the global config and every system and deployment service config
+// under rootFolder and validates them without starting anything. Unlike InitializePlatform, services
+// that fail to load are reported instead of skipped.
+func ValidateConfigurations(rootFolder string) *ConfigValidationReport {
+	p := &PlatformManager{BasePath: rootFolder, isWindows: runtime.GOOS == "windows"}
+	report := &ConfigValidationReport{}
+
+	globalResult, globalConfig := validateGlobalConfig(filepath.Join(rootFolder, "system", "herbarium", "config.yaml"))
+	report.Results = append(report.Results, globalResult)
+	agents := make(map[string]bool)
+	channels := make(map[string]bool)
+	proxyType := proxy.TypeHAProxy
+	if globalConfig != nil {
+		for _, agent := range globalConfig.Agents {
+			agents[agent.Name] = true
+		}
+		if globalConfig.Kubernetes.Kubeconfig != "" || globalConfig.Kubernetes.InCluster {
+			agents[KubernetesRuntimeName] = true
+		}
+		if globalConfig.Firecracker.Enabled {
+			agents[FirecrackerRuntimeName] = true
+		}
+		for _, channel := range globalConfig.Alerting.Channels {
+			channels[channel.Name] = true
+		}
+		if globalConfig.Proxy.Type != "" {
+			proxyType = globalConfig.Proxy.Type
+		}
+	}
+
+	var services []Service
+	var serviceResults []*ConfigValidationResult
+
+	// System components are loaded directly, deployments through their "current" version
+	systemPath := filepath.Join(rootFolder, "system")
+	servicesPath := filepath.Join(rootFolder, "services")
+	for _, base := range []struct {
+		path   string
+		system bool
+	}{{systemPath, true}, {servicesPath, false}} {
+		entries, err := os.ReadDir(base.path)
+		if err != nil {
+			result := &ConfigValidationResult{Name: filepath.Base(base.path), Path: base.path}
+			result.errorf("failed to read directory: %v", err)
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() || (base.system && entry.Name() == "herbarium") {
+				continue
+			}
+			result := &ConfigValidationResult{Name: entry.Name(), Path: filepath.Join(base.path, entry.Name())}
+
+			var service Service
+			if base.system {
+				service, err = p.loadServiceConfigForSystem(base.path, entry.Name())
+			} else {
+				service, err = p.loadServiceConfig(base.path, entry.Name())
+			}
+			if err != nil {
+				result.errorf("%v", err)
+				report.Results = append(report.Results, result)
+				continue
+			}
+
+			result.Path = filepath.Join(service.VersionDir, "config.yaml")
+			if content, warnings, err := p.readServiceConfig(service.VersionDir); err == nil {
+				result.Warnings = append(result.Warnings, warnings...)
+				checkUnknownFields(result, content, &models.StemConfig{})
+			}
+			services = append(services, service)
+			serviceResults = append(serviceResults, result)
+			report.Results = append(report.Results, result)
+		}
+	}
+
+	validateServices(services, serviceResults, agents, channels, proxyType)
+	if globalConfig != nil && len(globalConfig.Admission.Policies) > 0 {
+		// Invalid policies are reported with the global config
+		if engine, err := policy.NewEngine(globalConfig.Admission.Policies); err == nil {
+			for i, service := range services {
+				for _, violation := range engine.Evaluate(service.Config) {
+					serviceResults[i].errorf("%s", violation)
+				}
+			}
+		}
+	}
+	return report
+}
+
+// validateGlobalConfig checks that the global config parses and its addresses are usable. The parsed
+// config is returned for checks that span services, or nil if it could not be parsed.
+func validateGlobalConfig(path string) (*ConfigValidationResult, *models.GlobalConfig) {
+	result := &ConfigValidationResult{Name: "herbarium", Path: path}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		result.errorf("failed to read global config: %v", err)
+		return result, nil
+	}
+	content, warnings, err := migrateGlobalConfig(content)
+	if err != nil {
+		result.errorf("failed to parse global config: %v", err)
+		return result, nil
+	}
+	result.Warnings = append(result.Warnings, warnings...)
+	var config models.GlobalConfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		result.errorf("failed to parse global config: %v", err)
+		return result, nil
+	}
+	checkUnknownFields(result, content, &models.GlobalConfig{})
+
+	switch config.Proxy.Type {
+	case "", proxy.TypeHAProxy:
+		validateHAProxyConfig(result, &config)
+	case proxy.TypeNginx:
+		if config.Proxy.Nginx.ConfigFile == "" {
+			result.errorf("proxy.nginx.config_file is required")
+		}
+		if config.Proxy.Nginx.Template != "" {
+			if _, err := os.Stat(config.Proxy.Nginx.Template); err != nil {
+				result.errorf("proxy.nginx.template %s is not readable: %v", config.Proxy.Nginx.Template, err)
+			}
+		}
+	case proxy.TypeTraefik:
+		if address := config.Proxy.Traefik.ListenAddress; address != "" {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				result.errorf("proxy.traefik.listen_address %q is not a valid host:port: %v", address, err)
+			}
+		}
+	case proxy.TypeEmbedded:
+		if address := config.Proxy.Embedded.ListenAddress; address != "" {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				result.errorf("proxy.embedded.listen_address %q is not a valid host:port: %v", address, err)
+			}
+		}
+		if interval := config.Proxy.Embedded.HealthCheckInterval; interval != "" {
+			if parsed, err := time.ParseDuration(interval); err != nil || parsed <= 0 {
+				result.errorf("proxy.embedded.health_check_interval %q is not a positive duration", interval)
+			}
+		}
+	default:
+		result.errorf("proxy.type %q is not one of haproxy, nginx, traefik, or embedded", config.Proxy.Type)
+	}
+	if _, err := NewBackendNaming(&config); err != nil {
+		result.errorf("%v", err)
+	}
+	if config.Security.APIKey == "" {
+		result.warnf("security.api_key is empty; the admin API will reject all requests")
+	}
+	if config.API.ListenAddress != "" {
+		if _, port, err := net.SplitHostPort(config.API.ListenAddress); err != nil {
+			result.errorf("api.listen_address %q is invalid: %v", config.API.ListenAddress, err)
+		} else if _, err := strconv.Atoi(port); err != nil {
+			result.errorf("api.listen_address %q has a non-numeric port", config.API.ListenAddress)
+		}
+	}
+	if config.Snapshot.Interval != "" {
+		if interval, err := time.ParseDuration(config.Snapshot.Interval); err != nil || interval <= 0 {
+			result.errorf("snapshot.interval %q is not a positive duration", config.Snapshot.Interval)
+		}
+	}
+	if config.Recycler.Interval != "" {
+		if interval, err := time.ParseDuration(config.Recycler.Interval); err != nil || interval <= 0 {
+			result.errorf("recycler.interval %q is not a positive duration", config.Recycler.Interval)
+		}
+	}
+	if config.Sweeper.Interval != "" {
+		if interval, err := time.ParseDuration(config.Sweeper.Interval); err != nil || interval <= 0 {
+			result.errorf("sweeper.interval %q is not a positive duration", config.Sweeper.Interval)
+		}
+	}
+	if config.Scheduler.Interval != "" {
+		if interval, err := time.ParseDuration(config.Scheduler.Interval); err != nil || interval <= 0 {
+			result.errorf("scheduler.interval %q is not a positive duration", config.Scheduler.Interval)
+		}
+	}
+	validateLeafAddresses(result, "leafs.bind_address", config.Leafs.BindAddress, "leafs.advertise_address", config.Leafs.AdvertiseAddress)
+	validateAlerting(result, &config)
+	validateNotifications(result, config.Notifications)
+	validateHooks(result, &config)
+	validateArtifactSigning(result, &config)
+	if _, err := policy.NewEngine(config.Admission.Policies); err != nil {
+		result.errorf("admission.policies: %v", err)
+	}
+	if pageFile := config.Maintenance.PageFile; pageFile != "" {
+		if info, err := os.Stat(pageFile); err != nil || info.IsDir() {
+			result.errorf("maintenance.page_file %s is not a readable file", pageFile)
+		} else if config.Proxy.Type == proxy.TypeNginx || config.Proxy.Type == proxy.TypeTraefik {
+			result.warnf("maintenance.page_file is set, but the %s proxy does not support maintenance mode", config.Proxy.Type)
+		}
+	}
+	switch strings.ToLower(config.Storage.Backend) {
+	case "", "memory":
+	case "redis", "etcd":
+		if config.Storage.Address == "" {
+			result.warnf("storage.address is empty; the %s backend will use its default local address", config.Storage.Backend)
+		}
+	default:
+		result.errorf("storage.backend %q is not one of memory, redis, etcd", config.Storage.Backend)
+	}
+	if config.HA.Enabled {
+		if backend := strings.ToLower(config.Storage.Backend); backend != "redis" && backend != "etcd" {
+			result.errorf("ha.enabled requires storage.backend redis or etcd")
+		}
+	}
+	if config.HA.LeaseTTL != "" {
+		if ttl, err := time.ParseDuration(config.HA.LeaseTTL); err != nil || ttl < 3*time.Second {
+			result.errorf("ha.lease_ttl %q is not a duration of at least 3s", config.HA.LeaseTTL)
+		}
+	}
+	agentNames := make(map[string]bool)
+	for i, agent := range config.Agents {
+		switch {
+		case agent.Name == "":
+			result.errorf("agents[%d] has no name", i)
+		case agentNames[agent.Name]:
+			result.errorf("agent name %s is used more than once", agent.Name)
+		case agent.Name == SSHRuntimeName:
+			result.errorf("agent name %s is reserved for stems run over SSH", agent.Name)
+		case agent.Name == StaticRuntimeName:
+			result.errorf("agent name %s is reserved for static stems", agent.Name)
+		case agent.Name == KubernetesRuntimeName:
+			result.errorf("agent name %s is reserved for stems run in Kubernetes", agent.Name)
+		case agent.Name == FirecrackerRuntimeName:
+			result.errorf("agent name %s is reserved for stems run in microVMs", agent.Name)
+		}
+		agentNames[agent.Name] = true
+		if u, err := url.Parse(agent.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			result.errorf("agent %s url %q is not a valid absolute URL", agent.Name, agent.URL)
+		}
+		if agent.APIKey == "" {
+			result.warnf("agent %s has no api_key", agent.Name)
+		}
+	}
+	nodeNames := make(map[string]bool)
+	for i, node := range config.Nodes {
+		switch {
+		case node.Name == "":
+			result.errorf("nodes[%d] has no name", i)
+		case nodeNames[node.Name]:
+			result.errorf("node name %s is used more than once", node.Name)
+		}
+		nodeNames[node.Name] = true
+		if node.Agent != "" && !agentNames[node.Agent] {
+			result.errorf("node %s refers to unknown agent %s", node.Name, node.Agent)
+		}
+		if node.MemoryMB < 0 {
+			result.errorf("node %s memory_mb must not be negative, got %d", node.Name, node.MemoryMB)
+		}
+	}
+	return result, &config
+}
+
+// validateAlerting checks the alert evaluation interval and the channels alerts are sent to.
+func validateAlerting(result *ConfigValidationResult, config *models.GlobalConfig) {
+	if config.Alerting.Interval != "" {
+		if interval, err := time.ParseDuration(config.Alerting.Interval); err != nil || interval <= 0 {
+			result.errorf("alerting.interval %q is not a positive duration", config.Alerting.Interval)
+		}
+	}
+	names := make(map[string]bool)
+	for i, channel := range config.Alerting.Channels {
+		switch {
+		case channel.Name == "":
+			result.errorf("alerting.channels[%d] has no name", i)
+		case names[channel.Name]:
+			result.errorf("alerting channel name %s is used more than once", channel.Name)
+		}
+		names[channel.Name] = true
+		switch channel.Type {
+		case AlertChannelLog:
+		case AlertChannelWebhook:
+			if u, err := url.Parse(channel.URL); err != nil || u.Scheme == "" || u.Host == "" {
+				result.errorf("alerting channel %s url %q is not a valid absolute URL", channel.Name, channel.URL)
+			}
+		default:
+			result.errorf("alerting channel %s type %q is not one of log or webhook", channel.Name, channel.Type)
+		}
+	}
+}
+
+// validateNotifications checks the hooks posting events to webhooks and Slack.
+func validateNotifications(result *ConfigValidationResult, notifications []models.NotificationConfig) {
+	names := make(map[string]bool)
+	for i, notification := range notifications {
+		switch {
+		case notification.Name == "":
+			result.errorf("notifications[%d] has no name", i)
+		case names[notification.Name]:
+			result.errorf("notification name %s is used more than once", notification.Name)
+		}
+		names[notification.Name] = true
+		if _, ok := defaultNotificationTemplates[notification.Type]; !ok {
+			result.errorf("notification %s type %q is not one of webhook or slack", notification.Name, notification.Type)
+		}
+		if u, err := url.Parse(notification.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			result.errorf("notification %s url %q is not a valid absolute URL", notification.Name, notification.URL)
+		}
+		for _, eventType := range notification.Events {
+			if !slices.Contains(models.EventTypes, eventType) {
+				result.errorf("notification %s event %q is not a known event type", notification.Name, eventType)
+			}
+		}
+		if notification.Template != "" {
+			if _, err := template.New(notification.Name).Funcs(notificationFuncs).Parse(notification.Template); err != nil {
+				result.errorf("notification %s template is invalid: %v", notification.Name, err)
+			}
+		}
+		if notification.Retries != nil && *notification.Retries < 0 {
+			result.errorf("notification %s retries must not be negative, got %d", notification.Name, *notification.Retries)
+		}
+	}
+}
+
+// validateHooks checks that the hook plugins and executables exist and run at known extension points.
+func validateHooks(result *ConfigValidationResult, config *models.GlobalConfig) {
+	for _, path := range config.Hooks.Plugins {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			result.errorf("hooks plugin %s is not a file", path)
+		}
+	}
+	for i, executable := range config.Hooks.Executables {
+		if executable.Path == "" {
+			result.errorf("hooks.executables[%d] has no path", i)
+		} else if info, err := os.Stat(executable.Path); err != nil || info.IsDir() {
+			result.errorf("hook executable %s is not a file", executable.Path)
+		}
+		if len(executable.Points) == 0 {
+			result.warnf("hook executable %s has no points and never runs", executable.Path)
+		}
+		for _, point := range executable.Points {
+			if _, err := hooks.ParsePoint(point); err != nil {
+				result.errorf("hook executable %s: %v", executable.Path, err)
+			}
+		}
+		if executable.Timeout != "" {
+			if timeout, err := time.ParseDuration(executable.Timeout); err != nil || timeout <= 0 {
+				result.errorf("hook executable %s timeout %q is not a positive duration", executable.Path, executable.Timeout)
+			}
+		}
+	}
+}
+
+// validateHAProxyConfig checks the HAProxy Dataplane API endpoints.
+func validateHAProxyConfig(result *ConfigValidationResult, config *models.GlobalConfig) {
+	if len(config.HAProxy.Instances) == 0 {
+		if config.HAProxy.URL == "" {
+			result.errorf("haproxy.url is required")
+		} else if u, err := url.Parse(config.HAProxy.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			result.errorf("haproxy.url %q is not a valid absolute URL", config.HAProxy.URL)
+		}
+	} else if config.HAProxy.URL != "" {
+		result.warnf("haproxy.url is ignored when haproxy.instances is set")
+	}
+	instanceNames := make(map[string]bool)
+	for i, instance := range config.HAProxy.Instances {
+		switch {
+		case instance.Name == "":
+			result.errorf("haproxy.instances[%d] has no name", i)
+		case instanceNames[instance.Name]:
+			result.errorf("haproxy instance name %s is used more than once", instance.Name)
+		}
+		instanceNames[instance.Name] = true
+		if u, err := url.Parse(instance.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			result.errorf("haproxy instance %s url %q is not a valid absolute URL", instance.Name, instance.URL)
+		}
+	}
+}
+
+// checkUnknownFields reports YAML keys of content that don't map to any field of target, which are otherwise
+// silently ignored (e.g. a misspelled startMessage).
+func checkUnknownFields(result *ConfigValidationResult, content []byte, target interface{}) {
+	err := yaml.UnmarshalStrict(content, target)
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		for _, e := range typeErr.Errors {
+			result.errorf("%s", e)
+		}
+	} else if err != nil {
+		result.errorf("%v", err)
+	}
+}
+
+// validateServices checks each service config on its own and against the other services,
+// resolving dependencies and agents and detecting name and URL collisions.
+func validateServices(services []Service, results []*ConfigValidationResult, agents, channels map[string]bool, proxyType string) {
+	names := make(map[string]int)
+	urls := make(map[string]string)
+	udpPorts := make(map[int]string)
+	for _, service := range services {
+		names[service.Config.Name]++
+	}
+
+	for i, service := range services {
+		config := service.Config
+		result := results[i]
+
+		if config.Name == "" {
+			result.errorf("name is required")
+		} else if names[config.Name] > 1 {
+			result.errorf("name %s is used by more than one service", config.Name)
+		}
+		if config.Version == "" {
+			result.errorf("version is required")
+		}
+
+		cleanURL := strings.TrimPrefix(config.URL, "/")
+		route := strings.ToLower(config.Host) + "/" + cleanURL
+		switch {
+		case config.URL == "":
+			result.errorf("url is required")
+		case reservedURL(config.URL):
+			result.errorf("url %s is reserved for the herbarium admin API", config.URL)
+		case config.Shadow:
+			// Shadow stems share the URL of the version mirroring to them
+		case urls[route] != "" && config.Host != "":
+			result.errorf("url %s of host %s is already used by service %s", config.URL, config.Host, urls[route])
+		case urls[route] != "":
+			result.errorf("url %s is already used by service %s", config.URL, urls[route])
+		default:
+			urls[route] = config.Name
+		}
+		switch {
+		case config.Host == "":
+		case strings.ContainsAny(config.Host, "/: "):
+			result.errorf("host %q must be a hostname without scheme, port, or path", config.Host)
+		case proxyType == proxy.TypeNginx:
+			result.warnf("host is passed to the nginx template but not routed by herbarium")
+		}
+
+		if config.Static != nil {
+			validateStatic(result, &config)
+		} else if config.Kubernetes == nil || strings.TrimSpace(config.Command) != "" {
+			validateCommand(result, config.Command) // Pods run their image's entrypoint without one
+		}
+
+		if config.MinInstances != nil && *config.MinInstances < 0 {
+			result.errorf("minInstances must not be negative, got %d", *config.MinInstances)
+		}
+		if config.MaxInstances != nil {
+			if *config.MaxInstances < 1 {
+				result.errorf("maxInstances must be at least 1, got %d", *config.MaxInstances)
+			} else if config.MinInstances != nil && *config.MinInstances > *config.MaxInstances {
+				result.errorf("minInstances %d must not exceed maxInstances %d", *config.MinInstances, *config.MaxInstances)
+			}
+		}
+		for i, schedule := range config.Schedules {
+			if _, err := parseSchedule(schedule); err != nil {
+				result.errorf("schedule %d: %v", i+1, err)
+			} else if config.MaxInstances != nil && schedule.Instances > *config.MaxInstances {
+				result.errorf("schedule %d: instances %d must not exceed maxInstances %d", i+1, schedule.Instances, *config.MaxInstances)
+			}
+		}
+		if config.PortRange != "" {
+			if first, last, err := parsePortRange(config.PortRange); err != nil {
+				result.errorf("portRange: %v", err)
+			} else if isUDPStem(&config) && !proxied(&config) && config.UDP != nil && config.UDP.Port > 0 &&
+				(config.UDP.Port < first || config.UDP.Port > last) {
+				result.errorf("udp.port %d is outside portRange %s", config.UDP.Port, config.PortRange)
+			}
+		}
+		switch config.IPFamily {
+		case "", IPFamilyIPv4, IPFamilyIPv6, IPFamilyDual:
+		default:
+			result.errorf("ipFamily %q must be %s, %s or %s", config.IPFamily, IPFamilyIPv4, IPFamilyIPv6, IPFamilyDual)
+		}
+		validateLeafAddresses(result, "bindAddress", config.BindAddress, "advertiseAddress", config.AdvertiseAddress)
+		if config.WarmPool != nil {
+			if *config.WarmPool < 0 {
+				result.errorf("warmPool must not be negative, got %d", *config.WarmPool)
+			} else if *config.WarmPool > 0 && !proxied(&config) {
+				result.errorf("warmPool requires a stem routed through the proxy")
+			}
+		}
+		if config.Recycle != nil {
+			validateRecycle(result, &config, proxyType)
+		}
+		if config.Probe != nil {
+			validateProbe(result, &config)
+		}
+		if config.Autoscale != nil {
+			validateAutoscale(result, &config, proxyType)
+		}
+		if config.Disruption != nil {
+			validateDisruption(result, &config)
+		}
+		if config.Alerts != nil {
+			validateAlerts(result, &config, channels, proxyType)
+		}
+		if config.Agent != nil && *config.Agent != "" && !agents[*config.Agent] {
+			result.errorf("agent %s is not configured in the global config", *config.Agent)
+		}
+		if config.SSH != nil {
+			validateSSH(result, &config)
+		}
+		if config.Kubernetes != nil {
+			validateKubernetes(result, &config, agents)
+		}
+		if config.Firecracker != nil {
+			validateFirecracker(result, &config, agents)
+		}
+		if config.Nix != nil {
+			validateNix(result, &config)
+		}
+		if config.Artifact != nil {
+			validateArtifact(result, &config)
+		}
+		if config.Build != nil && config.Build.Time != "" {
+			if _, err := time.Parse(time.RFC3339, config.Build.Time); err != nil {
+				result.errorf("build.time %q is not an RFC 3339 time", config.Build.Time)
+			}
+		}
+		if config.Placement != nil {
+			if config.Placement.MemoryMB < 0 {
+				result.errorf("placement.memoryMB must not be negative, got %d", config.Placement.MemoryMB)
+			}
+			if stemRuntimeName(&config) != "" {
+				result.warnf("placement is ignored for stems pinned to an agent or ssh host")
+			}
+		}
+		if config.Backend != nil {
+			validateBackend(result, config.Backend, proxyType)
+		}
+		if config.Backend != nil && config.Backend.Mirror != nil {
+			validateMirror(result, &config, proxyType)
+		}
+		validateRuntime(result, &config)
+		switch config.Transport {
+		case "", proxy.TransportTCP:
+			if config.UDP != nil {
+				result.warnf("udp is ignored unless transport is udp")
+			}
+		case proxy.TransportUDP:
+			validateUDP(result, &config, proxyType)
+			if config.UDP != nil && config.UDP.Port > 0 {
+				if other, ok := udpPorts[config.UDP.Port]; ok {
+					result.errorf("udp.port %d is already used by service %s", config.UDP.Port, other)
+				} else {
+					udpPorts[config.UDP.Port] = config.Name
+				}
+			}
+		default:
+			result.errorf("transport %q is not one of tcp or udp", config.Transport)
+		}
+
+		for _, dependency := range config.Dependencies {
+			if dependency.Name == "" {
+				result.errorf("dependency without a name")
+			} else if names[dependency.Name] == 0 {
+				result.errorf("dependency %s does not match any known service", dependency.Name)
+			} else if dependency.Name == config.Name {
+				result.errorf("service depends on itself")
+			}
+		}
+	}
+}
+
+// validateSSH checks the remote host settings of a stem run over SSH.
+func validateSSH(result *ConfigValidationResult, config *models.StemConfig) {
+	if config.Agent != nil && *config.Agent != "" {
+		result.errorf("agent and ssh cannot both be set")
+	}
+	if config.SSH.Host == "" {
+		result.errorf("ssh.host is required")
+	}
+	if config.SSH.IdentityFile == "" {
+		result.errorf("ssh.identityFile is required")
+	} else if _, err := os.Stat(config.SSH.IdentityFile); err != nil {
+		result.errorf("ssh.identityFile %s is not readable: %v", config.SSH.IdentityFile, err)
+	}
+	if config.SSH.WorkingDir == "" {
+		result.errorf("ssh.workingDir is required")
+	}
+	if config.SSH.Port < 0 || config.SSH.Port > 65535 {
+		result.errorf("ssh.port %d is out of range", config.SSH.Port)
+	}
+	if config.DataDir != nil && *config.DataDir != "" {
+		result.warnf("dataDir is not created on the ssh host")
+	}
+}
+
+// validateArtifact checks the artifact a stem's files are fetched from.
+func validateArtifact(result *ConfigValidationResult, config *models.StemConfig) {
+	parsed, err := url.Parse(config.Artifact.URL)
+	switch {
+	case config.Artifact.URL == "":
+		result.errorf("artifact.url is required")
+	case err != nil || parsed.Host == "":
+		result.errorf("artifact.url %q is not a URL", config.Artifact.URL)
+	case parsed.Scheme == "http":
+		result.warnf("artifact.url %s is fetched over plain HTTP", config.Artifact.URL)
+	case parsed.Scheme != "https" && parsed.Scheme != "s3" && parsed.Scheme != "oci":
+		result.errorf("artifact.url %s must be an https://, s3://, or oci:// URL", config.Artifact.URL)
+	}
+	if checksum := strings.TrimPrefix(config.Artifact.SHA256, "sha256:"); config.Artifact.SHA256 != "" {
+		if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+			result.errorf("artifact.sha256 %q is not a hex SHA-256 checksum", config.Artifact.SHA256)
+		}
+	}
+}
+
+// validateArtifactSigning checks the policy deployed artifacts' signatures are verified by.
+func validateArtifactSigning(result *ConfigValidationResult, config *models.GlobalConfig) {
+	signing := config.Artifacts.Signing
+	switch signing.Type {
+	case "":
+		if signing.PublicKey != "" || signing.Required {
+			result.errorf("artifacts.signing.type is required")
+		}
+		return
+	case SignatureMinisign, SignatureCosign:
+	default:
+		result.errorf("artifacts.signing.type %q is not one of minisign or cosign", signing.Type)
+	}
+	if signing.PublicKey == "" {
+		result.errorf("artifacts.signing.public_key is required")
+	} else if _, err := readKey(signing.PublicKey); err != nil {
+		result.errorf("artifacts.signing.public_key: %v", err)
+	}
+}
+
+// validateNix checks the nix environment of a stem, which only leafs run on this host get.
+func validateNix(result *ConfigValidationResult, config *models.StemConfig) {
+	switch {
+	case config.Nix.Flake == "" && len(config.Nix.Packages) == 0:
+		result.errorf("nix needs a flake or packages")
+	case config.Nix.Flake != "" && len(config.Nix.Packages) > 0:
+		result.errorf("nix.flake and nix.packages cannot be combined")
+	}
+	for _, pkg := range config.Nix.Packages {
+		if strings.TrimSpace(pkg) == "" {
+			result.errorf("nix.packages contains an empty package")
+		}
+	}
+	if (config.Agent != nil && *config.Agent != "") || config.SSH != nil || config.Static != nil || config.Kubernetes != nil || config.Firecracker != nil {
+		result.errorf("nix environments only apply to leafs run on this host, not with agent, ssh, static, kubernetes, or firecracker")
+	}
+}
+
+// validateKubernetes checks the pods of a stem run in Kubernetes.
+func validateKubernetes(result *ConfigValidationResult, config *models.StemConfig, agents map[string]bool) {
+	if !agents[KubernetesRuntimeName] {
+		result.errorf("kubernetes needs kubernetes.kubeconfig or kubernetes.in_cluster in the global config")
+	}
+	if (config.Agent != nil && *config.Agent != "") || config.SSH != nil || config.Static != nil {
+		result.errorf("kubernetes cannot be combined with agent, ssh, or static")
+	}
+	if config.Kubernetes.Image == "" {
+		result.errorf("kubernetes.image is required")
+	}
+	if config.Kubernetes.Port < 0 || config.Kubernetes.Port > 65535 {
+		result.errorf("kubernetes.port %d is out of range", config.Kubernetes.Port)
+	}
+	if config.Transport == proxy.TransportUDP {
+		result.errorf("stems run in Kubernetes cannot use transport udp")
+	}
+	if config.DataDir != nil && *config.DataDir != "" {
+		result.warnf("dataDir is not created for pods")
+	}
+	if config.PortRange != "" {
+		result.warnf("portRange is ignored for pods, which listen on kubernetes.port")
+	}
+}
+
+// validateFirecracker checks the microVMs of a stem run in Firecracker.
+func validateFirecracker(result *ConfigValidationResult, config *models.StemConfig, agents map[string]bool) {
+	if !agents[FirecrackerRuntimeName] {
+		result.errorf("firecracker needs firecracker.enabled in the global config")
+	}
+	if (config.Agent != nil && *config.Agent != "") || config.SSH != nil || config.Static != nil || config.Kubernetes != nil {
+		result.errorf("firecracker cannot be combined with agent, ssh, static, or kubernetes")
+	}
+	for _, file := range []struct{ name, path string }{{"kernel", config.Firecracker.Kernel}, {"rootfs", config.Firecracker.RootFS}} {
+		if file.path == "" {
+			result.errorf("firecracker.%s is required", file.name)
+		} else if _, err := os.Stat(file.path); err != nil {
+			result.errorf("firecracker.%s %s is not readable: %v", file.name, file.path, err)
+		}
+	}
+	if config.Firecracker.VCPUs < 0 || config.Firecracker.MemoryMB < 0 {
+		result.errorf("firecracker.vcpus and firecracker.memoryMB must not be negative")
+	}
+	if config.Firecracker.Port < 0 || config.Firecracker.Port > 65535 {
+		result.errorf("firecracker.port %d is out of range", config.Firecracker.Port)
+	}
+	if config.Transport == proxy.TransportUDP {
+		result.errorf("stems run in microVMs cannot use transport udp")
+	}
+	if config.Probe != nil && config.Probe.Type == ProbeExec {
+		result.warnf("exec probes run on the host, not in the microVM")
+	}
+}
+
+// validateCORS checks the origins and preflight cache duration of a stem's CORS policy.
+func validateCORS(result *ConfigValidationResult, cors *models.CORSConfig) {
+	if len(cors.AllowOrigins) == 0 {
+		result.errorf("backend.cors.allowOrigins is required")
+	}
+	for _, origin := range cors.AllowOrigins {
+		switch {
+		case origin == "*":
+			if cors.AllowCredentials {
+				result.errorf("backend.cors.allowCredentials can't be used with the origin *")
+			}
+		case !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://"), strings.Count(origin, "/") > 2, strings.ContainsAny(origin, " "):
+			result.errorf("backend.cors.allowOrigins %q is not * or a scheme://host[:port] origin", origin)
+		}
+	}
+	if cors.MaxAge != "" {
+		if maxAge, err := time.ParseDuration(cors.MaxAge); err != nil || maxAge < 0 {
+			result.errorf("backend.cors.maxAge %q is not a duration of 0 or more", cors.MaxAge)
+		}
+	}
+}
+
+// validateMirror checks that a stem mirrors a share of its requests to another version of itself, and warns
+// when the proxy doesn't mirror them.
+func validateMirror(result *ConfigValidationResult, config *models.StemConfig, proxyType string) {
+	mirror := config.Backend.Mirror
+	switch {
+	case mirror.Version == "":
+		result.errorf("backend.mirror.version is required")
+	case mirror.Version == config.Version:
+		result.errorf("backend.mirror.version must be another version than the stem's own")
+	}
+	if mirror.Percent < 1 || mirror.Percent > 100 {
+		result.errorf("backend.mirror.percent must be between 1 and 100, got %d", mirror.Percent)
+	}
+	if config.Shadow {
+		result.errorf("a shadow stem can't mirror its requests")
+	}
+	switch proxyType {
+	case proxy.TypeNginx:
+		result.warnf("backend.mirror is passed to the nginx template but not applied by herbarium")
+	case proxy.TypeEmbedded, proxy.TypeTraefik:
+	default:
+		result.warnf("backend.mirror is not applied by the %s proxy, only by the embedded and traefik proxies", proxyType)
+	}
+}
+
+// validateBackend checks a stem's backend protocol and health check, and that the proxy supports them.
+func validateBackend(result *ConfigValidationResult, backend *models.BackendConfig, proxyType string) {
+	options := proxy.BackendOptions{Protocol: backend.Protocol, HealthCheck: backend.HealthCheck}
+	switch options.Protocol {
+	case "", proxy.ProtocolHTTP, proxy.ProtocolH2C, proxy.ProtocolH2:
+	default:
+		result.errorf("backend.protocol %q is not one of http, h2c, or h2", options.Protocol)
+	}
+	switch {
+	case backend.MaxConn < 0:
+		result.errorf("backend.maxConn must not be negative, got %d", backend.MaxConn)
+	case backend.MaxConn > 0 && proxyType != proxy.TypeHAProxy:
+		result.warnf("backend.maxConn is only enforced by the haproxy proxy")
+	}
+	for _, timeout := range []struct{ field, value string }{
+		{"connectTimeout", backend.ConnectTimeout},
+		{"serverTimeout", backend.ServerTimeout},
+		{"queueTimeout", backend.QueueTimeout},
+	} {
+		if timeout.value == "" {
+			continue
+		}
+		if parsed, err := time.ParseDuration(timeout.value); err != nil || parsed <= 0 {
+			result.errorf("backend.%s %q is not a positive duration", timeout.field, timeout.value)
+		} else if proxyType != proxy.TypeHAProxy {
+			result.warnf("backend.%s is only enforced by the haproxy proxy", timeout.field)
+		}
+	}
+	if backend.CacheMaxAge != "" {
+		if maxAge, err := time.ParseDuration(backend.CacheMaxAge); err != nil || maxAge < time.Second {
+			result.errorf("backend.cacheMaxAge %q is not a duration of 1s or more", backend.CacheMaxAge)
+		} else if proxyType == proxy.TypeNginx {
+			result.warnf("backend.cacheMaxAge is passed to the nginx template but not applied by herbarium")
+		} else if proxyType != proxy.TypeHAProxy {
+			result.warnf("backend.cacheMaxAge is ignored by the %s proxy", proxyType)
+		}
+	}
+	if backend.CORS != nil {
+		validateCORS(result, backend.CORS)
+	}
+	if breaker := backend.CircuitBreaker; breaker != nil {
+		if breaker.ErrorLimit <= 0 {
+			result.errorf("backend.circuitBreaker.errorLimit must be positive, got %d", breaker.ErrorLimit)
+		}
+		switch breaker.OnError {
+		case "", proxy.OnErrorMarkDown, proxy.OnErrorSuddenDeath:
+		default:
+			result.errorf("backend.circuitBreaker.onError %q is not one of mark-down or sudden-death", breaker.OnError)
+		}
+		if proxyType != proxy.TypeHAProxy {
+			result.warnf("backend.circuitBreaker is only enforced by the haproxy proxy")
+		}
+	}
+	if rateLimit := backend.RateLimit; rateLimit != nil {
+		if rateLimit.Requests <= 0 {
+			result.errorf("backend.rateLimit.requests must be positive, got %d", rateLimit.Requests)
+		}
+		if rateLimit.Period != "" {
+			if period, err := time.ParseDuration(rateLimit.Period); err != nil || period < time.Millisecond {
+				result.errorf("backend.rateLimit.period %q is not a duration of 1ms or more", rateLimit.Period)
+			}
+		}
+		switch proxyType {
+		case proxy.TypeNginx:
+			result.warnf("backend.rateLimit is passed to the nginx template but not applied by herbarium")
+		case proxy.TypeEmbedded:
+			result.warnf("backend.rateLimit is ignored by the embedded proxy")
+		}
+	}
+	if (backend.CORS != nil || backend.SecurityHeaders) && proxyType == proxy.TypeNginx {
+		result.warnf("backend.cors and backend.securityHeaders are passed to the nginx template but not applied by herbarium")
+	}
+	switch {
+	case backend.Compression && proxyType == proxy.TypeNginx:
+		result.warnf("backend.compression is passed to the nginx template but not applied by herbarium")
+	case backend.Compression && proxyType == proxy.TypeEmbedded:
+		result.warnf("backend.compression is ignored by the embedded proxy")
+	}
+	switch {
+	case backend.Retries != nil && *backend.Retries < 0:
+		result.errorf("backend.retries must not be negative, got %d", *backend.Retries)
+	case backend.Retries != nil && proxyType != proxy.TypeHAProxy:
+		result.warnf("backend.retries is only enforced by the haproxy proxy")
+	}
+	switch {
+	case backend.StripPrefix && backend.Rewrite != "":
+		result.errorf("backend.stripPrefix and backend.rewrite are mutually exclusive")
+	case backend.Rewrite != "" && !strings.HasPrefix(backend.Rewrite, "/"):
+		result.errorf("backend.rewrite %q must start with /", backend.Rewrite)
+	case (backend.StripPrefix || backend.Rewrite != "") && proxyType == proxy.TypeNginx:
+		result.warnf("backend.stripPrefix and backend.rewrite are passed to the nginx template but not applied by herbarium")
+	}
+	switch options.HealthCheck {
+	case "", proxy.HealthCheckHTTP:
+	case proxy.HealthCheckGRPC:
+		if !options.IsHTTP2() {
+			result.errorf("backend.healthCheck grpc requires backend.protocol h2c or h2")
+		}
+	default:
+		result.errorf("backend.healthCheck %q is not one of http or grpc", options.HealthCheck)
+	}
+
+	switch {
+	case proxyType == proxy.TypeEmbedded && (options.IsHTTP2() || options.HealthCheck == proxy.HealthCheckGRPC):
+		result.errorf("the embedded proxy supports only http backends")
+	case proxyType == proxy.TypeNginx && options.HealthCheck == proxy.HealthCheckGRPC:
+		result.warnf("backend.healthCheck is passed to the nginx template but not checked by nginx itself")
+	}
+}
+
+// validateUDP checks the routing, port, and probe of a UDP stem.
+func validateUDP(result *ConfigValidationResult, config *models.StemConfig, proxyType string) {
+	if config.SSH != nil {
+		result.errorf("UDP stems cannot run leafs over ssh")
+	}
+	if config.Backend != nil {
+		result.warnf("backend is ignored for UDP stems")
+	}
+	if config.UDP == nil {
+		return
+	}
+	if config.UDP.Port < 0 || config.UDP.Port > 65535 {
+		result.errorf("udp.port %d is out of range", config.UDP.Port)
+	}
+	switch config.UDP.Routing {
+	case "", UDPRoutingDirect:
+	case UDPRoutingProxy:
+		if config.UDP.Port == 0 {
+			result.errorf("udp.port is required for proxy routing")
+		}
+		if proxyType != proxy.TypeTraefik && proxyType != proxy.TypeEmbedded {
+			result.errorf("the %s proxy cannot route UDP; use udp.routing direct or the traefik or embedded proxy", proxyType)
+		}
+	default:
+		result.errorf("udp.routing %q is not one of direct or proxy", config.UDP.Routing)
+	}
+	if config.UDP.Probe != "" {
+		if _, err := hex.DecodeString(config.UDP.Probe); err != nil {
+			result.errorf("udp.probe is not valid hex: %v", err)
+		}
+	}
+}
+
+// validateRuntime checks a stem's runtime adapter and the readiness and shutdown settings overriding it.
+func validateRuntime(result *ConfigValidationResult, config *models.StemConfig) {
+	if config.Runtime != "" {
+		if _, ok := runtimeAdapters[config.Runtime]; !ok {
+			result.errorf("runtime %q is not one of java, node, python, or go", config.Runtime)
+		}
+		if config.Static != nil {
+			result.warnf("runtime is ignored for static stems")
+		}
+	}
+	if config.HealthPath != "" && !strings.HasPrefix(config.HealthPath, "/") {
+		result.errorf("healthPath %q must start with /", config.HealthPath)
+	}
+	if config.StopSignal != "" && !slices.Contains(StopSignals, config.StopSignal) {
+		result.errorf("stopSignal %q is not one of %s", config.StopSignal, strings.Join(StopSignals, ", "))
+	}
+	if config.StopTimeout != "" {
+		if timeout, err := time.ParseDuration(config.StopTimeout); err != nil || timeout <= 0 {
+			result.errorf("stopTimeout %q is not a positive duration", config.StopTimeout)
+		}
+	}
+	if config.DrainTimeout != "" {
+		if timeout, err := time.ParseDuration(config.DrainTimeout); err != nil || timeout < 0 {
+			result.errorf("drainTimeout %q is not a duration of 0 or more", config.DrainTimeout)
+		}
+	}
+}
+
+// validateProbe checks how a stem's leafs are probed for readiness and liveness.
+func validateProbe(result *ConfigValidationResult, config *models.StemConfig) {
+	probe := config.Probe
+	switch probe.Type {
+	case ProbeTCP, ProbeGRPC:
+	case ProbeHTTP:
+		if probe.Path != "" && !strings.HasPrefix(probe.Path, "/") {
+			result.errorf("probe.path %q must start with /", probe.Path)
+		}
+		if probe.ExpectedStatus != 0 && (probe.ExpectedStatus < 100 || probe.ExpectedStatus > 599) {
+			result.errorf("probe.expectedStatus %d is not an HTTP status", probe.ExpectedStatus)
+		}
+	case ProbeExec:
+		if strings.TrimSpace(probe.Command) == "" {
+			result.errorf("probe.command is required for exec probes")
+		} else if _, err := template.New("probe").Parse(probe.Command); err != nil {
+			result.errorf("invalid probe.command template: %v", err)
+		}
+	default:
+		result.errorf("probe.type %q is not one of tcp, http, exec, or grpc", probe.Type)
+	}
+	if probe.Timeout != "" {
+		if timeout, err := time.ParseDuration(probe.Timeout); err != nil || timeout <= 0 {
+			result.errorf("probe.timeout %q is not a positive duration", probe.Timeout)
+		}
+	}
+	if probe.FailureThreshold < 0 {
+		result.errorf("probe.failureThreshold must not be negative, got %d", probe.FailureThreshold)
+	}
+	if isUDPStem(config) {
+		result.errorf("probe is not supported for UDP stems, use udp.probe")
+	}
+	if config.Static != nil {
+		result.warnf("probe is ignored for static stems")
+	}
+}
+
+// validateRecycle checks the limits after which a stem's leafs are replaced, and that they can be enforced.
+func validateRecycle(result *ConfigValidationResult, config *models.StemConfig, proxyType string) {
+	recycle := config.Recycle
+	if recycle.MaxAge != "" {
+		if maxAge, err := time.ParseDuration(recycle.MaxAge); err != nil || maxAge <= 0 {
+			result.errorf("recycle.maxAge %q is not a positive duration", recycle.MaxAge)
+		}
+	}
+	switch {
+	case recycle.MaxRequests < 0:
+		result.errorf("recycle.maxRequests must not be negative, got %d", recycle.MaxRequests)
+	case recycle.MaxRequests > 0 && !proxied(config):
+		result.errorf("recycle.maxRequests requires a stem routed through the proxy")
+	case recycle.MaxRequests > 0 && (proxyType == proxy.TypeNginx || proxyType == proxy.TypeTraefik):
+		result.warnf("the %s proxy does not count requests; recycle.maxRequests is ignored", proxyType)
+	}
+	switch {
+	case recycle.MaxMemoryMB < 0:
+		result.errorf("recycle.maxMemoryMB must not be negative, got %d", recycle.MaxMemoryMB)
+	case recycle.MaxMemoryMB > 0 && config.Static != nil:
+		result.warnf("static leafs are served by herbarium itself; recycle.maxMemoryMB is ignored")
+	}
+	if recycle.MaxAge == "" && recycle.MaxRequests == 0 && recycle.MaxMemoryMB == 0 {
+		result.warnf("recycle sets none of maxRequests, maxAge, or maxMemoryMB; leafs are never recycled")
+	}
+	if config.Transport == proxy.TransportUDP && config.UDP != nil && config.UDP.Routing != UDPRoutingProxy && config.UDP.Port > 0 {
+		result.errorf("recycle cannot start a replacement leaf while the old one holds the fixed udp.port")
+	}
+}
+
+// validateAutoscale checks a stem's autoscale targets and that the proxy measures them.
+func validateAutoscale(result *ConfigValidationResult, config *models.StemConfig, proxyType string) {
+	autoscale := config.Autoscale
+	if !proxied(config) {
+		result.errorf("autoscale requires a stem routed through the proxy")
+		return
+	}
+	if config.MaxInstances == nil {
+		result.errorf("autoscale requires maxInstances")
+	}
+	if autoscale.TargetLatency != "" {
+		if latency, err := time.ParseDuration(autoscale.TargetLatency); err != nil || latency <= 0 {
+			result.errorf("autoscale.targetLatency %q is not a positive duration", autoscale.TargetLatency)
+		} else if proxyType == proxy.TypeNginx || proxyType == proxy.TypeTraefik {
+			result.warnf("the %s proxy does not measure response times; autoscale.targetLatency is ignored", proxyType)
+		}
+	}
+	if autoscale.ScaleDownDelay != "" {
+		if delay, err := time.ParseDuration(autoscale.ScaleDownDelay); err != nil || delay <= 0 {
+			result.errorf("autoscale.scaleDownDelay %q is not a positive duration", autoscale.ScaleDownDelay)
+		}
+	}
+	switch {
+	case autoscale.TargetQueue < 0:
+		result.errorf("autoscale.targetQueue must not be negative, got %d", autoscale.TargetQueue)
+	case autoscale.TargetQueue > 0 && proxyType != proxy.TypeHAProxy:
+		result.warnf("the %s proxy does not queue requests; autoscale.targetQueue is ignored", proxyType)
+	case autoscale.TargetQueue > 0 && (config.Backend == nil || config.Backend.MaxConn == 0):
+		result.warnf("requests only queue once backend.maxConn is set; autoscale.targetQueue never triggers without it")
+	}
+	if autoscale.TargetQueue == 0 && autoscale.TargetLatency == "" {
+		result.warnf("autoscale sets neither targetQueue nor targetLatency; the stem is never autoscaled")
+	}
+}
+
+// validateDisruption checks a stem's disruption budget.
+func validateDisruption(result *ConfigValidationResult, config *models.StemConfig) {
+	disruption := config.Disruption
+	if disruption.MaxUnavailable < 0 {
+		result.errorf("disruption.maxUnavailable must not be negative, got %d", disruption.MaxUnavailable)
+	}
+	if disruption.MinHealthy < 0 {
+		result.errorf("disruption.minHealthy must not be negative, got %d", disruption.MinHealthy)
+	} else if config.MaxInstances != nil && disruption.MinHealthy > *config.MaxInstances {
+		result.errorf("disruption.minHealthy %d must not exceed maxInstances %d", disruption.MinHealthy, *config.MaxInstances)
+	}
+	if disruption.ScaleDownCooldown != "" {
+		if cooldown, err := time.ParseDuration(disruption.ScaleDownCooldown); err != nil || cooldown <= 0 {
+			result.errorf("disruption.scaleDownCooldown %q is not a positive duration", disruption.ScaleDownCooldown)
+		}
+	}
+	if config.Autoscale == nil && config.Recycle == nil && livenessThreshold(config) == 0 {
+		result.warnf("disruption has no effect on stems that are neither autoscaled nor recycled")
+	}
+}
+
+// validateAlerts checks a stem's alert thresholds and the channels they notify.
+func validateAlerts(result *ConfigValidationResult, config *models.StemConfig, channels map[string]bool, proxyType string) {
+	alerts := config.Alerts
+	if alerts.MaxRestartsPerHour < 0 {
+		result.errorf("alerts.maxRestartsPerHour must not be negative, got %d", alerts.MaxRestartsPerHour)
+	}
+	if alerts.MinHealthyLeafs < 0 {
+		result.errorf("alerts.minHealthyLeafs must not be negative, got %d", alerts.MinHealthyLeafs)
+	}
+	if alerts.MaxLatency != "" {
+		switch maxLatency, err := time.ParseDuration(alerts.MaxLatency); {
+		case err != nil || maxLatency <= 0:
+			result.errorf("alerts.maxLatency %q is not a positive duration", alerts.MaxLatency)
+		case !proxied(config):
+			result.errorf("alerts.maxLatency requires a stem routed through the proxy")
+		case proxyType == proxy.TypeNginx || proxyType == proxy.TypeTraefik:
+			result.warnf("the %s proxy does not measure response times; alerts.maxLatency is ignored", proxyType)
+		}
+	}
+	for _, channel := range alerts.Channels {
+		if !channels[channel] {
+			result.errorf("alerts channel %s is not configured in the global config", channel)
+		}
+	}
+}
+
+// validateStatic checks a stem whose directory is served by herbarium instead of a leaf process.
+func validateStatic(result *ConfigValidationResult, config *models.StemConfig) {
+	if strings.TrimSpace(config.Command) != "" {
+		result.warnf("command is ignored for static stems")
+	}
+	if (config.Agent != nil && *config.Agent != "") || config.SSH != nil {
+		result.errorf("static stems are served by herbarium and cannot run on an agent or over ssh")
+	}
+	if config.Transport == proxy.TransportUDP {
+		result.errorf("static stems cannot use transport udp")
+	}
+	if config.Backend != nil && (config.Backend.Protocol == proxy.ProtocolH2C || config.Backend.Protocol == proxy.ProtocolH2 ||
+		config.Backend.HealthCheck == proxy.HealthCheckGRPC) {
+		result.errorf("static stems are served over http only")
+	}
+	if filepath.IsAbs(config.Static.Root) {
+		if info, err := os.Stat(config.Static.Root); err != nil {
+			result.errorf("static.root %s is not readable: %v", config.Static.Root, err)
+		} else if !info.IsDir() {
+			result.errorf("static.root %s is not a directory", config.Static.Root)
+		}
+	}
+	if strings.ContainsAny(config.Static.Index, `/\`) {
+		result.errorf("static.index %q must be a file name", config.Static.Index)
+	}
+}
+
+// validateLeafAddresses checks that a bind address is an IP address and an advertise address a host without a port.
+func validateLeafAddresses(result *ConfigValidationResult, bindField, bind, advertiseField, advertise string) {
+	if bind != "" && bind != "localhost" && net.ParseIP(bind) == nil {
+		result.errorf("%s %q is not an IP address", bindField, bind)
+	}
+	if advertise != "" {
+		if _, _, err := net.SplitHostPort(advertise); err == nil || strings.ContainsAny(advertise, "/[] ") {
+			result.errorf("%s %q must be a host name or IP address without a port", advertiseField, advertise)
+		}
+	}
+}
+
+// validateCommand renders the command template the same way leafs are started.
+func validateCommand(result *ConfigValidationResult, command string) {
+	if strings.TrimSpace(command) == "" {
+		result.errorf("command is required")
+		return
+	}
+	rendered, err := prepareCommandWithTemplate(command, map[string]interface{}{
+		"PORT": validationPort,
+		"HOST": "localhost",
+	})
+	if err != nil {
+		result.errorf("invalid command template: %v", err)
+		return
+	}
+	if strings.TrimSpace(rendered) == "" {
+		result.errorf("command renders to an empty string")
+	}
+	if strings.Contains(rendered, "<no value>") {
+		result.errorf("command references an unknown placeholder; only {{.PORT}} is available")
+	}
+}
@@ -0,0 +1,317 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestConfig writes a config.yaml into dir, creating it if needed.
+func writeTestConfig(t *testing.T, dir, content string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config in %s: %v", dir, err)
+	}
+}
+
+func TestValidateConfigurations_Valid(t *testing.T) {
+	root := t.TempDir()
+	writeTestConfig(t, filepath.Join(root, "system", "herbarium"), `
+haproxy:
+  url: "http://localhost:8080"
+security:
+  api_key: "key"
+api:
+  listen_address: "localhost:50051"
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "postgres"), `
+name: postgres
+url: /postgres
+command: "postgres -p {{.PORT}}"
+version: "v1.0"
+`)
+	writeTestConfig(t, filepath.Join(root, "services", "api", "v1.0"), `
+name: api
+url: /api
+command: "./api --port={{.PORT}}"
+version: "v1.0"
+dependencies:
+  - name: postgres
+    schema: api
+`)
+	if err := os.Symlink("v1.0", filepath.Join(root, "services", "api", "current")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	report := ValidateConfigurations(root)
+	assert.True(t, report.Valid(), report.String())
+	assert.Len(t, report.Results, 3)
+}
+
+func TestValidateConfigurations_Invalid(t *testing.T) {
+	root := t.TempDir()
+	writeTestConfig(t, filepath.Join(root, "system", "herbarium"), `
+haproxy:
+  url: "localhost"
+sweeper:
+  interval: never
+leafs:
+  bind_address: eth0
+alerting:
+  channels:
+    - name: slack
+      type: slack
+notifications:
+  - name: deploys
+    type: teams
+    url: https://hooks.example.com/deploys
+    events: [DEPLOY_SUCCEEDED, DEPLOY_FAILED]
+    template: "{{.Message"
+hooks:
+  executables:
+    - path: /nonexistent/policy-check
+      points: [before_register_stem, before_deploy]
+admission:
+  policies:
+    - name: ownership
+      stems: ["bill*"]
+      requiredLabels: [team]
+      allowedCommands: ["./*"]
+maintenance:
+  page_file: /nonexistent/maintenance.html
+artifacts:
+  signing:
+    type: gpg
+    required: true
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "broken"), `
+name: broken
+url: /herbarium
+command: "./run {{.PORT"
+startmessage: "ready"
+dependencies:
+  - name: missing
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "remote"), `
+name: remote
+version: v1
+url: /remote
+host: "remote.example.com:8080"
+command: "./run {{.PORT}}"
+ssh:
+  user: deploy
+minInstances: 3
+maxInstances: 2
+portRange: 9010-9000
+ipFamily: ipv5
+advertiseAddress: "10.0.0.5:9000"
+placement:
+  memoryMB: -1
+backend:
+  healthCheck: grpc
+  maxConn: -1
+  rewrite: api/v1
+  serverTimeout: forever
+  cacheMaxAge: 500ms
+  cors:
+    allowOrigins: ["*", app.example.com]
+    allowCredentials: true
+  mirror:
+    version: v1
+    percent: 0
+  circuitBreaker:
+    errorLimit: 0
+    onError: explode
+  rateLimit:
+    requests: 0
+    period: often
+  retries: -1
+schedules:
+  - days: [weekdays]
+    from: "08:00"
+    to: "20:00"
+    instances: 5
+  - from: "8pm"
+    to: "06:00"
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "dns"), `
+name: dns
+version: v1
+url: /dns
+command: "./dns --port {{.PORT}}"
+transport: udp
+warmPool: -1
+udp:
+  routing: proxy
+  probe: "not hex"
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "docs"), `
+name: docs
+version: v1
+url: /docs
+agent: edge
+static:
+  root: /does/not/exist
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "pods"), `
+name: pods
+version: v1
+url: /pods
+kubernetes:
+  port: 70000
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "sandbox"), `
+name: sandbox
+version: v1
+url: /sandbox
+command: ./sandbox
+firecracker:
+  rootfs: /nonexistent/sandbox.ext4
+  vcpus: -1
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "toolchain"), `
+name: toolchain
+version: v1
+url: /toolchain
+command: java -jar app.jar
+nix:
+  flake: .#app
+  packages: [jdk21, ""]
+artifact:
+  url: ftp://releases.internal/toolchain.tar.gz
+  sha256: abc
+build:
+  commit: 4f2a9c1
+  time: yesterday
+`)
+	writeTestConfig(t, filepath.Join(root, "system", "billing"), `
+name: billing
+version: v1
+url: /billing
+command: "java -jar billing.jar --server.port={{.PORT}}"
+runtime: ruby
+healthPath: health
+stopSignal: SIGSTOP
+stopTimeout: soon
+drainTimeout: -1s
+probe:
+  type: exec
+  timeout: quick
+  failureThreshold: -1
+recycle:
+  maxRequests: -5
+  maxAge: forever
+  maxMemoryMB: -1
+alerts:
+  maxRestartsPerHour: -1
+  maxLatency: fast
+  channels: [pager]
+autoscale:
+  targetQueue: -1
+  targetLatency: slow
+disruption:
+  maxUnavailable: -1
+  minHealthy: -2
+  scaleDownCooldown: later
+`)
+	if err := os.MkdirAll(filepath.Join(root, "services", "no-current"), 0755); err != nil {
+		t.Fatalf("failed to create service dir: %v", err)
+	}
+
+	report := ValidateConfigurations(root)
+	assert.False(t, report.Valid())
+
+	output := report.String()
+	for _, expected := range []string{
+		"haproxy.url \"localhost\" is not a valid absolute URL",
+		"security.api_key is empty",
+		"field startmessage not found",
+		"version is required",
+		"reserved for the herbarium admin API",
+		"invalid command template",
+		"dependency missing does not match any known service",
+		"failed to resolve current version for service no-current",
+		"ssh.host is required",
+		"ssh.identityFile is required",
+		"minInstances 3 must not exceed maxInstances 2",
+		"schedule 1: instances 5 must not exceed maxInstances 2",
+		`schedule 2: from: "8pm" is not a HH:MM time`,
+		`sweeper.interval "never" is not a positive duration`,
+		`artifacts.signing.type "gpg" is not one of minisign or cosign`,
+		"artifacts.signing.public_key is required",
+		`portRange: invalid port range "9010-9000"`,
+		`ipFamily "ipv5" must be ipv4, ipv6 or dual`,
+		`leafs.bind_address "eth0" is not an IP address`,
+		`advertiseAddress "10.0.0.5:9000" must be a host name or IP address without a port`,
+		"probe.command is required for exec probes",
+		`probe.timeout "quick" is not a positive duration`,
+		"probe.failureThreshold must not be negative, got -1",
+		"placement.memoryMB must not be negative",
+		"backend.healthCheck grpc requires backend.protocol h2c or h2",
+		"udp.port is required for proxy routing",
+		"the haproxy proxy cannot route UDP",
+		"udp.probe is not valid hex",
+		"warmPool must not be negative, got -1",
+		"static stems are served by herbarium and cannot run on an agent or over ssh",
+		"static.root /does/not/exist is not readable",
+		"kubernetes needs kubernetes.kubeconfig or kubernetes.in_cluster in the global config",
+		"kubernetes.image is required",
+		"kubernetes.port 70000 is out of range",
+		"firecracker needs firecracker.enabled in the global config",
+		"firecracker.kernel is required",
+		"firecracker.rootfs /nonexistent/sandbox.ext4 is not readable",
+		"firecracker.vcpus and firecracker.memoryMB must not be negative",
+		"nix.flake and nix.packages cannot be combined",
+		"nix.packages contains an empty package",
+		"artifact.url ftp://releases.internal/toolchain.tar.gz must be an https://, s3://, or oci:// URL",
+		`artifact.sha256 "abc" is not a hex SHA-256 checksum`,
+		`build.time "yesterday" is not an RFC 3339 time`,
+		"runtime \"ruby\" is not one of java, node, python, or go",
+		"healthPath \"health\" must start with /",
+		"stopSignal \"SIGSTOP\" is not one of SIGTERM",
+		"stopTimeout \"soon\" is not a positive duration",
+		"drainTimeout \"-1s\" is not a duration of 0 or more",
+		"recycle.maxRequests must not be negative, got -5",
+		"recycle.maxAge \"forever\" is not a positive duration",
+		"recycle.maxMemoryMB must not be negative, got -1",
+		"alerts.maxRestartsPerHour must not be negative, got -1",
+		"autoscale requires maxInstances",
+		"autoscale.targetQueue must not be negative, got -1",
+		`autoscale.targetLatency "slow" is not a positive duration`,
+		"backend.maxConn must not be negative, got -1",
+		`backend.rewrite "api/v1" must start with /`,
+		`backend.serverTimeout "forever" is not a positive duration`,
+		"backend.retries must not be negative, got -1",
+		`backend.cacheMaxAge "500ms" is not a duration of 1s or more`,
+		"backend.cors.allowCredentials can't be used with the origin *",
+		`backend.cors.allowOrigins "app.example.com" is not * or a scheme://host[:port] origin`,
+		"backend.rateLimit.requests must be positive, got 0",
+		"backend.circuitBreaker.errorLimit must be positive, got 0",
+		"backend.mirror.version must be another version than the stem's own",
+		"backend.mirror.percent must be between 1 and 100, got 0",
+		`backend.circuitBreaker.onError "explode" is not one of mark-down or sudden-death`,
+		`backend.rateLimit.period "often" is not a duration of 1ms or more`,
+		`host "remote.example.com:8080" must be a hostname without scheme, port, or path`,
+		"disruption.maxUnavailable must not be negative, got -1",
+		"disruption.minHealthy must not be negative, got -2",
+		`disruption.scaleDownCooldown "later" is not a positive duration`,
+		"alerts.maxLatency \"fast\" is not a positive duration",
+		"alerts channel pager is not configured in the global config",
+		"alerting channel slack type \"slack\" is not one of log or webhook",
+		"notification deploys type \"teams\" is not one of webhook or slack",
+		"notification deploys event \"DEPLOY_FAILED\" is not a known event type",
+		"notification deploys template is invalid",
+		"hook executable /nonexistent/policy-check is not a file",
+		"hook executable /nonexistent/policy-check: unknown extension point \"before_deploy\"",
+		"maintenance.page_file /nonexistent/maintenance.html is not a readable file",
+		"denied by policy ownership: command \"java -jar billing.jar --server.port={{.PORT}}\" is not allowed",
+		"denied by policy ownership: required label team is missing",
+	} {
+		assert.True(t, strings.Contains(output, expected), "expected report to contain %q:\n%s", expected, output)
+	}
+}
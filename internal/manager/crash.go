@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// CrashReport describes a panic recovered in a background worker, logged as a single JSON line.
+type CrashReport struct {
+	Time   time.Time `json:"time"`
+	Worker string    `json:"worker"` // What was running, such as "recycler" or "graft node of stem api version v1"
+	Panic  string    `json:"panic"`  // The value passed to panic
+	Stack  string    `json:"stack"`  // Stack of the panicking goroutine
+}
+
+// crashEvents receives a WORKER_CRASHED event for every recovered panic. Workers run all over the process,
+// many without an event log of their own, so it is shared like leafPorts.
+var crashEvents atomic.Pointer[EventLog]
+
+// ReportCrashesTo records an event in events for every panic recovered from now on, nil to only log them.
+func ReportCrashesTo(events *EventLog) {
+	crashEvents.Store(events)
+}
+
+// RunRecovered runs fn and recovers a panic in it as a crash report, so the platform keeps running.
+func RunRecovered(worker string, fn func()) {
+	defer recoverCrash(worker)
+	fn()
+}
+
+// recoverCrash recovers a panic of worker and reports it. It must be deferred directly.
+func recoverCrash(worker string) {
+	if value := recover(); value != nil {
+		reportCrash(worker, value)
+	}
+}
+
+// recoverHandler serves requests with handler, answering a request it panics on with 500 Internal Server
+// Error after reporting the crash.
+func recoverHandler(worker string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			if value == http.ErrAbortHandler {
+				panic(value) // Aborting a response is not a crash
+			}
+			reportCrash(worker, value)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}()
+		handler(w, r)
+	}
+}
+
+// reportCrash logs the crash report for a recovered panic and records a WORKER_CRASHED event.
+func reportCrash(worker string, value any) CrashReport {
+	report := CrashReport{
+		Time:   time.Now(),
+		Worker: worker,
+		Panic:  fmt.Sprint(value),
+		Stack:  string(debug.Stack()),
+	}
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("[CRASH] %s panicked: %s\n%s", worker, report.Panic, report.Stack)
+	} else {
+		log.Printf("[CRASH] %s", encoded)
+	}
+	crashEvents.Load().Record(models.Event{
+		Time:    report.Time,
+		Type:    models.EventWorkerCrashed,
+		Message: fmt.Sprintf("Recovered from a panic in %s: %s", worker, report.Panic),
+	})
+	return report
+}
@@ -0,0 +1,54 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunRecovered(t *testing.T) {
+	events := NewEventLog(10)
+	ReportCrashesTo(events)
+	defer ReportCrashesTo(nil)
+
+	ran := false
+	RunRecovered("recycler", func() { ran = true })
+	assert.True(t, ran)
+	assert.Empty(t, events.List(EventQuery{}))
+
+	// The panic is reported and doesn't reach the caller
+	assert.NotPanics(t, func() {
+		RunRecovered("recycler", func() { panic("index out of range") })
+	})
+	crashes := events.List(EventQuery{Type: models.EventWorkerCrashed})
+	if assert.Len(t, crashes, 1) {
+		assert.Equal(t, "Recovered from a panic in recycler: index out of range", crashes[0].Message)
+	}
+}
+
+func TestRecoverHandler(t *testing.T) {
+	events := NewEventLog(10)
+	ReportCrashesTo(events)
+	defer ReportCrashesTo(nil)
+
+	handler := recoverHandler("graft node of stem api version v1", func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map")
+	})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	crashes := events.List(EventQuery{Type: models.EventWorkerCrashed})
+	if assert.Len(t, crashes, 1) {
+		assert.Equal(t, "Recovered from a panic in graft node of stem api version v1: nil map", crashes[0].Message)
+	}
+
+	// Aborted responses are left to net/http
+	aborting := recoverHandler("graft node", func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		aborting(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	})
+}
@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DependencyReachableTimeout is how long a dependency's leaf may take to become reachable.
+const DependencyReachableTimeout = 30 * time.Second
+
+// dependencyProbeInterval is how often an unreachable dependency is probed again.
+const dependencyProbeInterval = 500 * time.Millisecond
+
+// DependencyTarget is a dependency of a stem being provisioned. Provisioners run in order, and earlier ones
+// fill in what later ones need, such as the address the dependency is reached at.
+type DependencyTarget struct {
+	Stem       models.StemConfig // Config of the stem declaring the dependency
+	Dependency models.Dependency
+	Key        storage.StemKey // Stem providing the dependency, once found
+	Host       string          // Host a running leaf of the dependency is reached at, once started
+	Port       int             // Port of that leaf
+}
+
+// DependencyProvisioner prepares a dependency of a stem before the stem's leafs start. An error keeps the
+// stem from being registered.
+type DependencyProvisioner interface {
+	Provision(target *DependencyTarget) error
+}
+
+// NewDependencyProvisioners returns the provisioners every dependency goes through: its stem is started,
+// checked for reachability, and its schema created through provision_dependency hooks.
+func NewDependencyProvisioners(stemRepo repos.StemRepositoryInterface, leafManager LeafManagerInterface, registry *hooks.Registry) []DependencyProvisioner {
+	return []DependencyProvisioner{
+		&DependencyStemProvisioner{StemRepo: stemRepo, LeafManager: leafManager},
+		&ReachabilityProvisioner{StemRepo: stemRepo, Timeout: DependencyReachableTimeout},
+		&SchemaHookProvisioner{Hooks: registry},
+	}
+}
+
+// DependencyStemProvisioner makes sure the stem providing a dependency runs a leaf, starting one when it
+// only has a graft node or no leafs at all.
+type DependencyStemProvisioner struct {
+	StemRepo    repos.StemRepositoryInterface
+	LeafManager LeafManagerInterface
+}
+
+// Provision finds the dependency's stem, using its newest registered version, and a running leaf of it.
+func (p *DependencyStemProvisioner) Provision(target *DependencyTarget) error {
+	stems, err := p.StemRepo.GetAllStems()
+	if err != nil {
+		return err
+	}
+	var versions []*models.Stem
+	for _, stem := range stems {
+		if stem.Name == target.Dependency.Name {
+			versions = append(versions, stem)
+		}
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("dependency %s is not registered", target.Dependency.Name)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	target.Key = storage.StemKey{Name: versions[0].Name, Version: versions[0].Version}
+
+	leafs, err := p.LeafManager.GetRunningLeafs(target.Key)
+	if err != nil {
+		return err
+	}
+	if len(leafs) == 0 {
+		log.Printf("Starting a leaf of dependency %s version %s for stem %s", target.Key.Name, target.Key.Version, target.Stem.Name)
+		if _, err := p.LeafManager.StartLeaf(target.Key.Name, target.Key.Version, nil); err != nil {
+			return fmt.Errorf("failed to start dependency %s: %v", target.Key.Name, err)
+		}
+		if leafs, err = p.LeafManager.GetRunningLeafs(target.Key); err != nil {
+			return err
+		}
+		if len(leafs) == 0 {
+			return fmt.Errorf("dependency %s has no running leaf", target.Key.Name)
+		}
+	}
+	target.Host = leafHost(&leafs[0])
+	target.Port = leafs[0].Port
+	return nil
+}
+
+// ReachabilityProvisioner waits until the dependency's leaf passes the dependency stem's own probe.
+type ReachabilityProvisioner struct {
+	StemRepo repos.StemRepositoryInterface
+	Timeout  time.Duration
+}
+
+// Provision probes the leaf found by DependencyStemProvisioner until it answers or Timeout passes.
+func (p *ReachabilityProvisioner) Provision(target *DependencyTarget) error {
+	if target.Port == 0 {
+		return nil // Not started by herbarium, e.g. a UDP stem with a fixed port; nothing to probe
+	}
+	var config *models.StemConfig
+	if stem, err := p.StemRepo.FetchStem(target.Key); err == nil {
+		config = stem.Config
+	}
+	prober := proberOf(config)
+
+	deadline := time.Now().Add(p.Timeout)
+	for {
+		err := prober.Probe(target.Host, target.Port)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("dependency %s is not reachable at %s:%d: %v", target.Key.Name, target.Host, target.Port, err)
+		}
+		time.Sleep(dependencyProbeInterval)
+	}
+}
+
+// SchemaHookProvisioner creates the schema a stem declares for a dependency by running the hooks at
+// hooks.ProvisionDependency, which know how to talk to the dependency. Dependencies without a schema are
+// skipped.
+type SchemaHookProvisioner struct {
+	Hooks *hooks.Registry
+}
+
+// Provision runs the provision_dependency hooks; the first failure is returned.
+func (p *SchemaHookProvisioner) Provision(target *DependencyTarget) error {
+	if target.Dependency.Schema == "" {
+		return nil
+	}
+	dependency := target.Dependency
+	op := hooks.Operation{Stem: target.Stem, Dependency: &dependency, Host: target.Host, Port: target.Port}
+	if err := p.Hooks.Before(hooks.ProvisionDependency, &op); err != nil {
+		return fmt.Errorf("failed to create schema %s: %v", dependency.Schema, err)
+	}
+	return nil
+}
+
+// provisionDependencies runs every dependency of a stem through the provisioners, in declaration order.
+func (s *StemManager) provisionDependencies(config models.StemConfig) error {
+	for _, dependency := range config.Dependencies {
+		target := &DependencyTarget{Stem: config, Dependency: dependency}
+		for _, provisioner := range s.Provisioners {
+			if err := provisioner.Provision(target); err != nil {
+				return fmt.Errorf("failed to provision dependency %s of stem %s: %v", dependency.Name, config.Name, err)
+			}
+		}
+		if len(s.Provisioners) > 0 {
+			log.Printf("Provisioned dependency %s of stem %s version %s", dependency.Name, config.Name, config.Version)
+		}
+	}
+	return nil
+}
+
+// orderByDependencies orders services so that each comes after the services it depends on, keeping the
+// original order otherwise. Dependencies outside services and cycles are left for provisioning to report.
+func orderByDependencies(services []Service) []Service {
+	index := make(map[string]int, len(services))
+	for i, service := range services {
+		index[service.Config.Name] = i
+	}
+
+	ordered := make([]Service, 0, len(services))
+	state := make([]int, len(services)) // 0 unvisited, 1 visiting, 2 done
+	var visit func(i int)
+	visit = func(i int) {
+		if state[i] != 0 {
+			return
+		}
+		state[i] = 1
+		for _, dependency := range services[i].Config.Dependencies {
+			if j, ok := index[dependency.Name]; ok {
+				visit(j)
+			}
+		}
+		state[i] = 2
+		ordered = append(ordered, services[i])
+	}
+	for i := range services {
+		visit(i)
+	}
+	return ordered
+}
@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderByDependencies(t *testing.T) {
+	service := func(name string, dependencies ...string) Service {
+		config := models.StemConfig{Name: name}
+		for _, dependency := range dependencies {
+			config.Dependencies = append(config.Dependencies, models.Dependency{Name: dependency})
+		}
+		return Service{Config: config}
+	}
+	services := []Service{
+		service("billing", "postgres", "cache"),
+		service("reports", "billing"),
+		service("postgres"),
+		service("mail", "smtp"), // Unknown dependencies don't reorder
+		service("cache"),
+	}
+
+	var names []string
+	for _, ordered := range orderByDependencies(services) {
+		names = append(names, ordered.Config.Name)
+	}
+	assert.Equal(t, []string{"postgres", "cache", "billing", "reports", "mail"}, names)
+}
+
+func TestDependencyProvisioners(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	postgres := storage.StemKey{Name: "postgres", Version: "16"}
+	db.Stems[postgres] = &models.Stem{Name: "postgres", Version: "16", LeafInstances: map[string]*models.Leaf{}}
+	db.Stems[storage.StemKey{Name: "postgres", Version: "15"}] = &models.Stem{Name: "postgres", Version: "15"}
+	running := []models.Leaf{{ID: "postgres-1", Host: "127.0.0.1", Port: port, Status: models.StatusRunning}}
+
+	// Only a graft node runs, so the newest version gets a leaf first
+	leafManager := new(MockLeafManager)
+	leafManager.On("GetRunningLeafs", postgres).Return(nil, nil).Once()
+	leafManager.On("StartLeaf", "postgres", "16", (*string)(nil)).Return("postgres-1", nil).Once()
+	leafManager.On("GetRunningLeafs", postgres).Return(running, nil)
+
+	var provisioned []hooks.Operation
+	registry := hooks.NewRegistry()
+	registry.Register(hooks.ProvisionDependency, hooks.HookFunc(func(op *hooks.Operation) error {
+		provisioned = append(provisioned, *op)
+		if op.Dependency.Schema == "broken" {
+			return errors.New("permission denied")
+		}
+		return nil
+	}))
+
+	stemManager := &StemManager{Provisioners: NewDependencyProvisioners(repos.NewStemRepository(db), leafManager, registry)}
+	config := models.StemConfig{Name: "billing", Version: "v2", Dependencies: []models.Dependency{{Name: "postgres", Schema: "billing"}}}
+	assert.NoError(t, stemManager.provisionDependencies(config))
+	leafManager.AssertExpectations(t)
+	if assert.Len(t, provisioned, 1) {
+		assert.Equal(t, hooks.ProvisionDependency, provisioned[0].Point)
+		assert.Equal(t, "billing", provisioned[0].Stem.Name)
+		assert.Equal(t, models.Dependency{Name: "postgres", Schema: "billing"}, *provisioned[0].Dependency)
+		assert.Equal(t, "127.0.0.1", provisioned[0].Host)
+		assert.Equal(t, port, provisioned[0].Port)
+	}
+
+	// Failing hooks, missing stems, and unreachable leafs keep the stem from starting
+	config.Dependencies = []models.Dependency{{Name: "postgres", Schema: "broken"}}
+	assert.ErrorContains(t, stemManager.provisionDependencies(config), "failed to create schema broken: permission denied")
+	config.Dependencies = []models.Dependency{{Name: "redis"}}
+	assert.ErrorContains(t, stemManager.provisionDependencies(config), "dependency redis is not registered")
+
+	listener.Close()
+	stemManager.Provisioners[1].(*ReachabilityProvisioner).Timeout = 100 * time.Millisecond
+	config.Dependencies = []models.Dependency{{Name: "postgres"}}
+	assert.ErrorContains(t, stemManager.provisionDependencies(config), "dependency postgres is not reachable")
+}
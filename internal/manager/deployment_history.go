@@ -0,0 +1,194 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DeploymentHistory records who deployed, scaled, unregistered, and rolled back stems, with the parameters
+// and outcome of each change, in an append-only file of JSON lines. Unlike the state journal, which records
+// every mutation of the state, it answers release management questions such as who rolled out what and
+// when, and is kept for good. A nil DeploymentHistory discards entries.
+type DeploymentHistory struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	seq  uint64
+}
+
+// ReloadActor is the actor of the changes a reload of the configuration makes.
+const ReloadActor = "reload"
+
+// CompletedDeployment describes a change to a stem that started at the given time and just ended, failed
+// if err is set.
+func CompletedDeployment(actor string, action models.DeploymentAction, key storage.StemKey, parameters map[string]string, started time.Time, err error) models.Deployment {
+	entry := models.Deployment{
+		Time:       started.UTC(),
+		Duration:   time.Since(started),
+		Actor:      actor,
+		Action:     action,
+		Stem:       key.Name,
+		Version:    key.Version,
+		Parameters: parameters,
+		Outcome:    models.DeploymentSucceeded,
+	}
+	if err != nil {
+		entry.Outcome = models.DeploymentFailed
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// DeploymentQuery filters the entries returned by List. Zero fields match everything.
+type DeploymentQuery struct {
+	Stem     string                   // Only changes of this stem
+	Actor    string                   // Only changes initiated by this actor
+	Action   models.DeploymentAction  // Only changes of this kind
+	Outcome  models.DeploymentOutcome // Only changes with this outcome
+	Since    time.Time                // Only changes initiated at or after this time
+	AfterSeq uint64                   // Only entries with a greater sequence number
+	Limit    int                      // Maximum number of entries, the oldest matching ones first
+}
+
+func (q DeploymentQuery) matches(entry models.Deployment) bool {
+	switch {
+	case entry.Seq <= q.AfterSeq:
+		return false
+	case q.Stem != "" && entry.Stem != q.Stem:
+		return false
+	case q.Actor != "" && entry.Actor != q.Actor:
+		return false
+	case q.Action != "" && entry.Action != q.Action:
+		return false
+	case q.Outcome != "" && entry.Outcome != q.Outcome:
+		return false
+	case !q.Since.IsZero() && entry.Time.Before(q.Since):
+		return false
+	}
+	return true
+}
+
+// OpenDeploymentHistory opens or creates the deployment history at path, continuing the sequence of
+// existing entries.
+func OpenDeploymentHistory(path string) (*DeploymentHistory, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory of deployment history %s: %v", path, err)
+	}
+	entries, err := readDeploymentHistory(path, DeploymentQuery{})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open deployment history %s: %v", path, err)
+	}
+	// Terminate a line truncated by a crash, so the next entry starts on its own line
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if reader, err := os.Open(path); err == nil {
+			_, readErr := reader.ReadAt(last, info.Size()-1)
+			reader.Close()
+			if readErr == nil && last[0] != '\n' {
+				if _, err := file.Write([]byte{'\n'}); err != nil {
+					file.Close()
+					return nil, fmt.Errorf("failed to repair deployment history %s: %v", path, err)
+				}
+			}
+		}
+	}
+	history := &DeploymentHistory{path: path, file: file}
+	if len(entries) > 0 {
+		history.seq = entries[len(entries)-1].Seq
+	}
+	return history, nil
+}
+
+// Record assigns an entry the next sequence number, and the current time if it has none, then logs and
+// appends it. A failure to write the entry is logged, the change it describes already happened.
+func (h *DeploymentHistory) Record(entry models.Deployment) models.Deployment {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.Outcome == models.DeploymentFailed {
+		log.Printf("[Deployment] %s of stem %s version %s by %s failed: %s", entry.Action, entry.Stem, entry.Version, entry.Actor, entry.Error)
+	} else {
+		log.Printf("[Deployment] %s of stem %s version %s by %s %s", entry.Action, entry.Stem, entry.Version, entry.Actor, entry.Outcome)
+	}
+	if h == nil {
+		return entry
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry.Seq = h.seq + 1
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to encode deployment history entry: %v", err)
+		return entry
+	}
+	if _, err := h.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write deployment history entry: %v", err)
+		return entry
+	}
+	h.seq = entry.Seq
+	return entry
+}
+
+// List returns the entries matching query, oldest first.
+func (h *DeploymentHistory) List(query DeploymentQuery) ([]models.Deployment, error) {
+	if h == nil {
+		return nil, nil
+	}
+	return readDeploymentHistory(h.path, query)
+}
+
+// Close closes the history file.
+func (h *DeploymentHistory) Close() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
+
+// readDeploymentHistory reads the entries of a deployment history file matching query, oldest first. Lines
+// that can't be read, such as one truncated by a crash mid-write, are skipped.
+func readDeploymentHistory(path string, query DeploymentQuery) ([]models.Deployment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []models.Deployment
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry models.Deployment
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Ignoring unreadable deployment history entry at %s:%d: %v", path, line, err)
+			continue
+		}
+		if !query.matches(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+		if query.Limit > 0 && len(entries) >= query.Limit {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read deployment history %s: %v", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeploymentHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "deployments.jsonl")
+	history, err := OpenDeploymentHistory(path)
+	assert.NoError(t, err)
+
+	key := storage.StemKey{Name: "billing", Version: "v1"}
+	started := time.Now().Add(-time.Second)
+	entry := history.Record(CompletedDeployment("alice@laptop", models.DeploymentDeploy, key, map[string]string{"artifact": "upload"}, started, nil))
+	assert.Equal(t, uint64(1), entry.Seq)
+	assert.Equal(t, models.DeploymentSucceeded, entry.Outcome)
+	assert.GreaterOrEqual(t, entry.Duration, time.Second)
+	history.Record(CompletedDeployment("bob@laptop", models.DeploymentScale, key, map[string]string{"replicas": "4"}, time.Now(), errors.New("out of range")))
+	history.Record(CompletedDeployment(ReloadActor, models.DeploymentUnregister, storage.StemKey{Name: "reports", Version: "v3"}, nil, time.Now(), nil))
+
+	entries, err := history.List(DeploymentQuery{Stem: "billing"})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	entries, err = history.List(DeploymentQuery{Outcome: models.DeploymentFailed})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "bob@laptop", entries[0].Actor)
+		assert.Equal(t, "out of range", entries[0].Error)
+		assert.Equal(t, map[string]string{"replicas": "4"}, entries[0].Parameters)
+	}
+	entries, err = history.List(DeploymentQuery{AfterSeq: 1, Limit: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, uint64(2), entries[0].Seq)
+	}
+	entries, err = history.List(DeploymentQuery{Since: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.NoError(t, history.Close())
+
+	// A line truncated by a crash is skipped, and the sequence continues after reopening
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"seq":4,"actor":"car`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	history, err = OpenDeploymentHistory(path)
+	assert.NoError(t, err)
+	defer history.Close()
+	entry = history.Record(CompletedDeployment("carol@laptop", models.DeploymentRollback, key, nil, time.Now(), nil))
+	assert.Equal(t, uint64(4), entry.Seq)
+	entries, err = history.List(DeploymentQuery{Actor: "carol@laptop"})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, models.DeploymentRollback, entries[0].Action)
+	}
+}
+
+func TestDeploymentHistory_Nil(t *testing.T) {
+	var history *DeploymentHistory
+	entry := history.Record(models.Deployment{Actor: "alice@laptop", Action: models.DeploymentDeploy, Stem: "billing"})
+	assert.False(t, entry.Time.IsZero())
+	entries, err := history.List(DeploymentQuery{})
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.NoError(t, history.Close())
+}
@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/haproxy"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DumpDiagnostics writes a diagnostic dump of the platform to a timestamped file in the log folder, for
+// analysis after an incident, and returns its path.
+func (p *PlatformManager) DumpDiagnostics() (string, error) {
+	folder := getLogFolder()
+	if err := os.MkdirAll(folder, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create log folder %s: %v", folder, err)
+	}
+	path := filepath.Join(folder, fmt.Sprintf("herbarium-diagnostics-%s.txt", time.Now().UTC().Format("20060102T150405.000Z")))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create diagnostics file: %v", err)
+	}
+	defer file.Close()
+
+	if err := p.WriteDiagnostics(file); err != nil {
+		return path, err
+	}
+	log.Printf("Wrote diagnostic dump to %s", path)
+	return path, file.Close()
+}
+
+// WriteDiagnostics writes the stems with their leafs and graft nodes, the reserved leaf ports, the pending
+// HAProxy transactions, and the stacks of all goroutines. Parts that can't be read are noted and skipped.
+func (p *PlatformManager) WriteDiagnostics(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "herbarium diagnostics at %s, pid %d, %s %s/%s, %d goroutines\n",
+		time.Now().UTC().Format(time.RFC3339), os.Getpid(), runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumGoroutine())
+
+	state := p.StemManager.ReadSnapshot()
+	fmt.Fprintf(out, "\n== Stems (%d) at journal entry %d\n", len(state.Stems()), state.JournalSeq)
+	for _, stem := range state.Stems() {
+		writeStemDiagnostics(out, stem)
+	}
+
+	reservations := leafPorts.reservations()
+	fmt.Fprintf(out, "\n== Reserved leaf ports (%d)\n", len(reservations))
+	for _, reservation := range reservations {
+		fmt.Fprintf(out, "%s %s\n", portKey(reservation.network, reservation.port), reservation.owner)
+	}
+
+	transactions := haproxy.PendingTransactions()
+	fmt.Fprintf(out, "\n== Pending HAProxy transactions (%d)\n", len(transactions))
+	for _, transaction := range transactions {
+		fmt.Fprintf(out, "%s version=%d open for %s\n", transaction.ID, transaction.Version, time.Since(transaction.Started).Round(time.Millisecond))
+	}
+
+	fmt.Fprintln(out, "\n== Goroutines")
+	if err := pprof.Lookup("goroutine").WriteTo(out, 2); err != nil {
+		fmt.Fprintf(out, "failed to write goroutine stacks: %v\n", err)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write diagnostics: %v", err)
+	}
+	return nil
+}
+
+// writeStemDiagnostics writes a stem with its leafs, ordered by ID, and its graft node.
+func writeStemDiagnostics(out io.Writer, stem *models.Stem) {
+	replicas := "-"
+	if stem.Replicas != nil {
+		replicas = fmt.Sprint(*stem.Replicas)
+	}
+	fmt.Fprintf(out, "%s %s type=%s url=%s backend=%s replicas=%s maintenance=%t restarts=%d\n",
+		stem.Name, stem.Version, stem.Type, stem.WorkingURL, stem.HAProxyBackend, replicas, stem.Maintenance, stem.Restarts)
+
+	ids := make([]string, 0, len(stem.LeafInstances))
+	for id := range stem.LeafInstances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprint(out, "  leaf ")
+		writeLeafDiagnostics(out, stem.LeafInstances[id])
+	}
+	if stem.GraftNodeLeaf != nil {
+		fmt.Fprint(out, "  graft node ")
+		writeLeafDiagnostics(out, stem.GraftNodeLeaf)
+	}
+}
+
+// writeLeafDiagnostics writes a leaf on a single line.
+func writeLeafDiagnostics(out io.Writer, leaf *models.Leaf) {
+	fmt.Fprintf(out, "%s %s pid=%d port=%d server=%s", leaf.ID, leaf.Status, leaf.PID, leaf.Port, leaf.HAProxyServer)
+	if leaf.Node != "" {
+		fmt.Fprintf(out, " node=%s", leaf.Node)
+	}
+	if leaf.Agent != "" {
+		fmt.Fprintf(out, " agent=%s", leaf.Agent)
+	}
+	if leaf.Host != "" {
+		fmt.Fprintf(out, " host=%s", leaf.Host)
+	}
+	fmt.Fprintf(out, " initialized=%s\n", leaf.Initialized.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlatformManager_DumpDiagnostics(t *testing.T) {
+	logFolder := t.TempDir()
+	t.Setenv("PLANTARIUM_LOG_FOLDER", logFolder)
+
+	initialized := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockStemManager := new(MockStemManager)
+	mockStemManager.On("ReadSnapshot").Return(storage.NewStateView(initialized, 42, map[storage.StemKey]*models.Stem{
+		{Name: "api", Version: "v1"}: {Name: "api", Version: "v1", WorkingURL: "/api", HAProxyBackend: "api", LeafInstances: map[string]*models.Leaf{
+			"api-2": {ID: "api-2", Status: models.StatusRunning, PID: 12, Port: 8002, HAProxyServer: "api-2", Node: "edge", Agent: "edge-1", Initialized: initialized},
+			"api-1": {ID: "api-1", Status: models.StatusRunning, PID: 11, Port: 8001, HAProxyServer: "api-1", Initialized: initialized},
+		}},
+		{Name: "idle", Version: "v1"}: {Name: "idle", Version: "v1", WorkingURL: "/idle", HAProxyBackend: "idle",
+			GraftNodeLeaf: &models.Leaf{ID: "idle-graft", Status: models.StatusRunning, Port: 8003, Initialized: initialized}},
+	}))
+	port, err := leafPorts.Allocate("tcp", 20000, "api-3")
+	assert.NoError(t, err)
+	defer leafPorts.Release("tcp", port)
+
+	platformManager := NewPlatformManager(mockStemManager, nil, new(MockProxyClient), &models.GlobalConfig{})
+	path, err := platformManager.DumpDiagnostics()
+	assert.NoError(t, err)
+	assert.Equal(t, logFolder, filepath.Dir(path))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	dump := string(content)
+	assert.Contains(t, dump, "== Stems (2) at journal entry 42\napi v1 type= url=/api backend=api replicas=- maintenance=false restarts=0\n"+
+		"  leaf api-1 RUNNING pid=11 port=8001 server=api-1 initialized=2024-05-01T12:00:00Z\n"+
+		"  leaf api-2 RUNNING pid=12 port=8002 server=api-2 node=edge agent=edge-1 initialized=2024-05-01T12:00:00Z\n")
+	assert.Contains(t, dump, "  graft node idle-graft RUNNING pid=0 port=8003 server= initialized=2024-05-01T12:00:00Z\n")
+	assert.Contains(t, dump, portKey("tcp", port)+" api-3\n")
+	assert.Contains(t, dump, "== Pending HAProxy transactions (0)\n")
+	assert.True(t, strings.Contains(dump, "== Goroutines\ngoroutine "), "goroutine stacks are dumped")
+}
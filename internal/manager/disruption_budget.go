@@ -0,0 +1,78 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultMaxUnavailable is how many leafs of a stem may be stopping at once unless its disruption config says
+// otherwise.
+const DefaultMaxUnavailable = 1
+
+// DisruptionBudget keeps the autoscaler and the recycler, which share it, from taking leafs of a stem out of
+// service faster than its disruption config allows: no more than maxUnavailable leafs stopping at once, and no
+// leaf removed within scaleDownCooldown of the stem's last autoscaling or recycling.
+type DisruptionBudget struct {
+	mu      sync.Mutex
+	now     func() time.Time              // Clock cooldowns are measured against
+	changed map[storage.StemKey]time.Time // When the autoscaler or recycler last changed the leafs of each stem
+}
+
+// NewDisruptionBudget creates an empty DisruptionBudget.
+func NewDisruptionBudget() *DisruptionBudget {
+	return &DisruptionBudget{
+		now:     time.Now,
+		changed: make(map[storage.StemKey]time.Time),
+	}
+}
+
+// Allow returns nil when a leaf of a stem may be taken out of service now, otherwise why it may not.
+func (b *DisruptionBudget) Allow(stem *models.Stem) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	maxUnavailable, cooldown := DefaultMaxUnavailable, time.Duration(0)
+	if config := stem.Config; config != nil && config.Disruption != nil {
+		if config.Disruption.MaxUnavailable > 0 {
+			maxUnavailable = config.Disruption.MaxUnavailable
+		}
+		cooldown, _ = time.ParseDuration(config.Disruption.ScaleDownCooldown)
+	}
+
+	stopping := 0
+	for _, leaf := range stem.LeafInstances {
+		if leaf.Status == models.StatusStopping {
+			stopping++
+		}
+	}
+	if stopping >= maxUnavailable {
+		return fmt.Errorf("%d leafs are stopping, at most %d may be at once", stopping, maxUnavailable)
+	}
+
+	key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+	if changed, ok := b.changed[key]; ok && cooldown > 0 {
+		if left := cooldown - b.now().Sub(changed); left > 0 {
+			return fmt.Errorf("cooling down for another %s", left.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// Changed records that the autoscaler or recycler changed the leafs of a stem, starting its cooldown.
+func (b *DisruptionBudget) Changed(key storage.StemKey) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.changed[key] = b.now()
+}
+
+// minHealthyOf returns the running leafs the autoscaler keeps a stem at, at least.
+func minHealthyOf(config *models.StemConfig) int {
+	if config == nil || config.Disruption == nil {
+		return 0
+	}
+	return config.Disruption.MinHealthy
+}
@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisruptionBudget_Allow(t *testing.T) {
+	budget := NewDisruptionBudget()
+	now := time.Now()
+	budget.now = func() time.Time { return now }
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	stem := &models.Stem{Name: "api", Version: "v1", Config: &models.StemConfig{Name: "api"}, LeafInstances: map[string]*models.Leaf{
+		"api-1": {ID: "api-1", Status: models.StatusRunning},
+		"api-2": {ID: "api-2", Status: models.StatusStopping},
+	}}
+
+	// One leaf may be stopping at a time unless the stem allows more
+	assert.EqualError(t, budget.Allow(stem), "1 leafs are stopping, at most 1 may be at once")
+	stem.Config.Disruption = &models.DisruptionConfig{MaxUnavailable: 2, ScaleDownCooldown: "2m"}
+	assert.NoError(t, budget.Allow(stem))
+
+	// Changes start the cooldown
+	budget.Changed(key)
+	now = now.Add(90 * time.Second)
+	assert.EqualError(t, budget.Allow(stem), "cooling down for another 30s")
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, budget.Allow(stem))
+}
+
+func TestRecycler_DisruptionBudget(t *testing.T) {
+	now := time.Now()
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api", Config: &models.StemConfig{
+		Name:       "api",
+		Version:    "v1",
+		URL:        "/api",
+		Recycle:    &models.RecycleConfig{MaxAge: "1h"},
+		Disruption: &models.DisruptionConfig{ScaleDownCooldown: "10m"},
+	}}
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("GetRunningLeafs", key).Return([]models.Leaf{
+		{ID: "api-1", HAProxyServer: "api-1", Initialized: now.Add(-3 * time.Hour)},
+		{ID: "api-2", HAProxyServer: "api-2", Initialized: now.Add(-2 * time.Hour)},
+	}, nil)
+	mockLeafManager.On("StartLeaf", "api", "v1", (*string)(nil)).Return("api-3", nil)
+	mockLeafManager.On("StopLeaf", "api", "v1", "api-1").Return(nil).Once()
+
+	recycler := NewRecycler(repos.NewStemRepository(db), mockLeafManager, new(MockProxyClient))
+	recycler.now = func() time.Time { return now }
+	recycler.Budget.now = recycler.now
+
+	// The second due leaf waits for the cooldown of the first replacement
+	assert.Equal(t, 1, recycler.RecycleOnce())
+	now = now.Add(5 * time.Minute)
+	assert.Equal(t, 0, recycler.RecycleOnce())
+	now = now.Add(5 * time.Minute)
+	mockLeafManager.On("StopLeaf", "api", "v1", "api-1").Return(nil).Once()
+	assert.Equal(t, 1, recycler.RecycleOnce())
+	mockLeafManager.AssertExpectations(t)
+}
+
+func TestAutoscaler_MinHealthy(t *testing.T) {
+	one, six := 1, 6
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api", Config: &models.StemConfig{
+		Name:         "api",
+		Version:      "v1",
+		MinInstances: &one,
+		MaxInstances: &six,
+		Autoscale:    &models.AutoscaleConfig{TargetLatency: "200ms", ScaleDownDelay: "1m"},
+		Disruption:   &models.DisruptionConfig{MinHealthy: 2},
+	}}
+	running := []models.Leaf{
+		{ID: "api-1", HAProxyServer: "api-1", Status: models.StatusRunning},
+		{ID: "api-2", HAProxyServer: "api-2", Status: models.StatusRunning},
+	}
+	leafManager := new(MockLeafManager)
+	leafManager.On("GetRunningLeafs", key).Return(running, nil)
+	stemManager := new(MockStemManager)
+	proxyClient := &saturatedProxyClient{MockProxyClient: new(MockProxyClient)}
+
+	autoscaler := NewAutoscaler(repos.NewStemRepository(db), leafManager, proxyClient, stemManager)
+	now := time.Now()
+	autoscaler.now = func() time.Time { return now }
+
+	// Idle, but already at minHealthy
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 0, autoscaler.ScaleOnce())
+		now = now.Add(time.Minute)
+	}
+	stemManager.AssertNotCalled(t, "Scale")
+}
@@ -0,0 +1,237 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// ErrDraining is returned for deployments attempted, and leafs started on this host, while the host is draining.
+var ErrDraining = errors.New("the host is draining")
+
+// Drain empties this host for maintenance such as a reboot. While draining, it vetoes stem registrations, so it
+// is registered as a hook at hooks.BeforeRegisterStem, and the leaf manager starts no leafs on this host. The
+// leafs running here are stopped gracefully one at a time, each handed to another registered node first when
+// asked for and the stem's placement allows it. The host is safe to reboot once every leaf was handled and
+// none is left.
+type Drain struct {
+	StemRepo    repos.StemRepositoryInterface
+	LeafManager LeafManagerInterface
+	Events      *EventLog // Receives an event when draining starts and when the host is drained, nil to only log them
+
+	mu        sync.Mutex
+	now       func() time.Time
+	since     time.Time // Zero while not draining
+	handoff   bool      // Whether leafs are handed to other nodes
+	finished  bool      // Whether every leaf on the host was handled
+	handedOff []string
+	stopped   []string
+	failed    []string
+}
+
+// NewDrain creates a Drain for the stems in stemRepo, which is not draining.
+func NewDrain(stemRepo repos.StemRepositoryInterface, leafManager LeafManagerInterface) *Drain {
+	return &Drain{
+		StemRepo:    stemRepo,
+		LeafManager: leafManager,
+		now:         time.Now,
+	}
+}
+
+// Start begins draining the host in the background, handing leafs to other nodes when handoff is set. Starting
+// again while draining changes nothing.
+func (d *Drain) Start(handoff bool) models.DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.since.IsZero() {
+		return d.status()
+	}
+
+	d.since, d.handoff, d.finished = d.now(), handoff, false
+	d.handedOff, d.stopped, d.failed = nil, nil, nil
+	log.Printf("Draining the host, handoff to other nodes: %t", handoff)
+	d.Events.Record(models.Event{
+		Time:    d.since,
+		Type:    models.EventDrainStarted,
+		Message: "Started draining the host, deployments and new leafs on this host are refused",
+	})
+	since := d.since
+	go RunRecovered("drain", func() { d.run(since) })
+	return d.status()
+}
+
+// Cancel ends draining, so deployments are accepted and leafs start on this host again. Leafs already stopped
+// are not restarted. Cancelling while not draining changes nothing.
+func (d *Drain) Cancel() models.DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.since.IsZero() {
+		log.Printf("Stopped draining the host after %s", d.now().Sub(d.since).Round(time.Second))
+		d.since = time.Time{}
+	}
+	return d.status()
+}
+
+// Status reports the progress of draining.
+func (d *Drain) Status() models.DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status()
+}
+
+// Draining reports whether the host is draining, false when d is nil.
+func (d *Drain) Draining() bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.since.IsZero()
+}
+
+// Run vetoes stem registrations while the host is draining.
+func (d *Drain) Run(op *hooks.Operation) error {
+	if d.Draining() {
+		return ErrDraining
+	}
+	return nil
+}
+
+// run hands off or stops every leaf on this host, one at a time, unless draining is cancelled or restarted.
+func (d *Drain) run(since time.Time) {
+	stems, err := d.StemRepo.GetAllStems()
+	if err != nil {
+		log.Printf("Failed to list stems to drain: %v", err)
+		d.record(since, &d.failed, fmt.Sprintf("listing stems: %v", err))
+	}
+	for _, stem := range stems {
+		for _, leaf := range hostLeafs(stem) {
+			if !d.current(since) {
+				return
+			}
+			d.drainLeaf(since, stem, leaf)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.since != since {
+		return
+	}
+	d.finished = true
+	status := d.status()
+	if !status.SafeToReboot {
+		log.Printf("Drained the host, but %d leafs failed to stop and %d are left", len(status.Failed), len(status.Remaining))
+		return
+	}
+	log.Printf("Drained the host, it is safe to reboot")
+	d.Events.Record(models.Event{
+		Type: models.EventHostDrained,
+		Message: fmt.Sprintf("Drained the host after %s: %d leafs handed off, %d stopped, safe to reboot",
+			d.now().Sub(since).Round(time.Second), len(status.HandedOff), len(status.Stopped)),
+	})
+}
+
+// drainLeaf stops a leaf on this host, starting its replacement on another node first when handing off.
+// Standby leafs and stems pinned to this host are only stopped.
+func (d *Drain) drainLeaf(since time.Time, stem *models.Stem, leaf *models.Leaf) {
+	d.mu.Lock()
+	handoff := d.handoff
+	d.mu.Unlock()
+
+	var replacement string
+	if handoff && leaf.Status == models.StatusRunning && stemRuntimeName(stem.Config) == "" {
+		var err error
+		if replacement, err = d.LeafManager.StartLeaf(stem.Name, stem.Version, nil); err != nil {
+			log.Printf("Leaf %s of stem %s version %s could not be handed off and is stopped: %v", leaf.ID, stem.Name, stem.Version, err)
+		}
+	}
+	if err := d.LeafManager.StopLeaf(stem.Name, stem.Version, leaf.ID); err != nil {
+		log.Printf("Failed to stop leaf %s of stem %s version %s while draining: %v", leaf.ID, stem.Name, stem.Version, err)
+		d.record(since, &d.failed, fmt.Sprintf("%s: %v", leaf.ID, err))
+		return
+	}
+	if replacement != "" {
+		log.Printf("Handed leaf %s of stem %s version %s off to %s", leaf.ID, stem.Name, stem.Version, replacement)
+		d.record(since, &d.handedOff, leaf.ID+"="+replacement)
+	} else {
+		d.record(since, &d.stopped, leaf.ID)
+	}
+}
+
+// current reports whether draining that started at since is still going on.
+func (d *Drain) current(since time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.since == since
+}
+
+// record appends an entry to one of the lists of the drain that started at since, unless it was cancelled.
+func (d *Drain) record(since time.Time, list *[]string, entry string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.since == since {
+		*list = append(*list, entry)
+	}
+}
+
+// status builds the current status. The caller must hold mu.
+func (d *Drain) status() models.DrainStatus {
+	if d.since.IsZero() {
+		return models.DrainStatus{}
+	}
+	since := d.since
+	status := models.DrainStatus{
+		Draining:  true,
+		Since:     &since,
+		Handoff:   d.handoff,
+		HandedOff: append([]string(nil), d.handedOff...),
+		Stopped:   append([]string(nil), d.stopped...),
+		Failed:    append([]string(nil), d.failed...),
+		Finished:  d.finished,
+	}
+	stems, err := d.StemRepo.GetAllStems()
+	if err != nil {
+		log.Printf("Failed to list stems for the drain status: %v", err)
+		return status
+	}
+	for _, stem := range stems {
+		for _, leaf := range hostLeafs(stem) {
+			status.Remaining = append(status.Remaining, leaf.ID)
+		}
+	}
+	sort.Strings(status.Remaining)
+	status.SafeToReboot = d.finished && len(status.Failed) == 0 && len(status.Remaining) == 0
+	return status
+}
+
+// hostLeafs returns the leafs of a stem that run on this host, including static leafs served by herbarium,
+// ordered by ID.
+func hostLeafs(stem *models.Stem) []*models.Leaf {
+	var leafs []*models.Leaf
+	for _, leaf := range stem.LeafInstances {
+		if leaf.Agent == "" || leaf.Agent == StaticRuntimeName {
+			leafs = append(leafs, leaf)
+		}
+	}
+	sort.Slice(leafs, func(i, j int) bool { return leafs[i].ID < leafs[j].ID })
+	return leafs
+}
+
+// remoteNodes returns the nodes run by an agent, leaving out this host.
+func remoteNodes(nodes []*models.Node) []*models.Node {
+	var remote []*models.Node
+	for _, node := range nodes {
+		if node.Agent != "" {
+			remote = append(remote, node)
+		}
+	}
+	return remote
+}
@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDrain_StartAndFinish(t *testing.T) {
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", Config: &models.StemConfig{Name: "api"}, LeafInstances: map[string]*models.Leaf{
+		"api-1": {ID: "api-1", Status: models.StatusRunning},
+		"api-2": {ID: "api-2", Status: models.StatusStandby},
+		"api-r": {ID: "api-r", Status: models.StatusRunning, Node: "edge", Agent: "edge-1"},
+	}}
+	leafRepo := repos.NewLeafRepository(db)
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("StartLeaf", "api", "v1", (*string)(nil)).Return("api-3", nil).Once()
+	mockLeafManager.On("StopLeaf", "api", "v1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		assert.NoError(t, leafRepo.RemoveLeaf(key, args.String(2)))
+	})
+
+	drain := NewDrain(repos.NewStemRepository(db), mockLeafManager)
+	drain.Events = NewEventLog(10)
+	assert.NoError(t, drain.Run(&hooks.Operation{}))
+
+	status := drain.Start(true)
+	assert.True(t, status.Draining)
+	assert.True(t, status.Handoff)
+	assert.True(t, errors.Is(drain.Run(&hooks.Operation{}), ErrDraining))
+
+	assert.Eventually(t, func() bool { return drain.Status().Finished }, time.Second, 10*time.Millisecond)
+	status = drain.Status()
+	assert.True(t, status.SafeToReboot)
+	assert.Equal(t, []string{"api-1=api-3"}, status.HandedOff)
+	assert.Equal(t, []string{"api-2"}, status.Stopped)
+	assert.Empty(t, status.Failed)
+	assert.Empty(t, status.Remaining)
+	mockLeafManager.AssertExpectations(t)
+	mockLeafManager.AssertNotCalled(t, "StopLeaf", "api", "v1", "api-r")
+
+	events := drain.Events.List(EventQuery{})
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, models.EventDrainStarted, events[0].Type)
+		assert.Equal(t, models.EventHostDrained, events[1].Type)
+	}
+
+	// Cancelling accepts deployments again
+	assert.False(t, drain.Cancel().Draining)
+	assert.NoError(t, drain.Run(&hooks.Operation{}))
+}
+
+func TestDrain_FailedLeafIsNotSafe(t *testing.T) {
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", Config: &models.StemConfig{Name: "api"}, LeafInstances: map[string]*models.Leaf{
+		"api-1": {ID: "api-1", Status: models.StatusRunning},
+	}}
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("StopLeaf", "api", "v1", "api-1").Return(errors.New("process did not exit"))
+
+	drain := NewDrain(repos.NewStemRepository(db), mockLeafManager)
+	drain.Start(false)
+
+	assert.Eventually(t, func() bool { return drain.Status().Finished }, time.Second, 10*time.Millisecond)
+	status := drain.Status()
+	assert.False(t, status.SafeToReboot)
+	assert.Equal(t, []string{"api-1: process did not exit"}, status.Failed)
+	assert.Equal(t, []string{"api-1"}, status.Remaining)
+	mockLeafManager.AssertNotCalled(t, "StartLeaf", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestLeafManager_PlacementWhileDraining(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	stemRepo := repos.NewStemRepository(db)
+	nodeRepo := repos.NewNodeRepository(db)
+	assert.NoError(t, nodeRepo.SaveNode(&models.Node{Name: "local"}))
+
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api", Config: &models.StemConfig{Name: "api", Version: "v1"},
+		LeafInstances: map[string]*models.Leaf{}}
+
+	leafManager := NewLeafManager(repos.NewLeafRepository(db), new(MockProxyClient), stemRepo)
+	leafManager.NodeRepo = nodeRepo
+	leafManager.Drain = NewDrain(stemRepo, new(MockLeafManager))
+	leafManager.Drain.since = time.Now()
+
+	// Only this host is registered
+	_, err := leafManager.StartLeaf("api", "v1", nil)
+	assert.True(t, errors.Is(err, ErrDraining))
+
+	// Leafs go to other nodes
+	assert.NoError(t, nodeRepo.SaveNode(&models.Node{Name: "edge", Address: "192.168.1.20", Agent: "edge-1"}))
+	node, err := leafManager.placeLeaf(db.Stems[key])
+	if assert.NoError(t, err) {
+		assert.Equal(t, "edge", node.Name)
+	}
+}
@@ -0,0 +1,267 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultDriftInterval is how often the proxy's configuration is checked against the state.
+const DefaultDriftInterval = 10 * time.Minute
+
+// DriftReconciler repairs the proxy's configuration where it drifted from the state, for example after the proxy
+// was restarted with an old configuration or edited by hand: it recreates missing backends, rebinds running leafs
+// missing their server, and unbinds servers pointing at no live leaf. Backends herbarium created for no current
+// stem are emptied of their servers, when the proxy tags the backends it created; other backends no stem owns are
+// reported and left alone. Like the sweeper, a drift is only repaired when two checks in a row find it, so changes herbarium is in
+// the middle of making are left alone. Proxies that can't list their backends and servers are not checked.
+type DriftReconciler struct {
+	StemRepo    repos.StemRepositoryInterface
+	ProxyClient proxy.ProxyClient
+	Maintenance *Maintenance // Provides the page of recreated backends of stems in maintenance
+	Events      *EventLog    // Receives an event for every reconciliation that repaired something, nil to only log it
+
+	mu       sync.Mutex      // Serializes reconciliations
+	suspects map[string]bool // Drifts the previous check found
+}
+
+// NewDriftReconciler creates a DriftReconciler for the stems in stemRepo and the backends of proxyClient.
+func NewDriftReconciler(stemRepo repos.StemRepositoryInterface, proxyClient proxy.ProxyClient) *DriftReconciler {
+	return &DriftReconciler{
+		StemRepo:    stemRepo,
+		ProxyClient: proxyClient,
+		suspects:    make(map[string]bool),
+	}
+}
+
+// StartSchedule reconciles every interval until stop is closed.
+func (r *DriftReconciler) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Checking the proxy configuration for drift every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("drift reconciler", func() { r.Reconcile() })
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Reconcile compares the proxy's backends and servers with the stems and their leafs, repairs what drifted, and
+// returns what it found.
+func (r *DriftReconciler) Reconcile() models.DriftReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := models.DriftReport{MissingBackends: []string{}, MissingServers: []string{}, StaleServers: []string{}, StaleBackends: []string{}, ForeignBackends: []string{}}
+	backendLister, ok := r.ProxyClient.(proxy.BackendLister)
+	serverLister, listsServers := r.ProxyClient.(proxy.ServerLister)
+	if !ok || !listsServers {
+		report.Errors = append(report.Errors, "the proxy does not list its backends and servers")
+		return report
+	}
+	backends, err := backendLister.Backends()
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list backends: %v", err))
+		return report
+	}
+	stems, err := r.StemRepo.GetAllStems()
+	if err != nil {
+		log.Printf("Failed to list stems for drift detection: %v", err)
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list stems: %v", err))
+		return report
+	}
+
+	present := make(map[string]bool, len(backends))
+	for _, backend := range backends {
+		present[backend] = true
+	}
+	// The admin API is bound as a system backend without a stem
+	owned := map[string]bool{strings.TrimPrefix(AdminAPIPath, "/"): true}
+	suspects := make(map[string]bool)
+	for _, stem := range stems {
+		if stem.HAProxyBackend == "" || !proxied(stem.Config) {
+			continue
+		}
+		owned[stem.HAProxyBackend] = true
+		if !present[stem.HAProxyBackend] {
+			r.recreateBackend(stem, suspects, &report)
+			continue
+		}
+		r.reconcileServers(serverLister, stem, stems, suspects, &report)
+	}
+	tagged := r.taggedBackends(&report)
+	sort.Strings(backends)
+	for _, backend := range backends {
+		switch {
+		case owned[backend]:
+		case tagged[backend]:
+			r.emptyStaleBackend(serverLister, backend, suspects, &report)
+		default:
+			report.ForeignBackends = append(report.ForeignBackends, backend)
+		}
+	}
+	r.suspects = suspects
+
+	if repaired := len(report.MissingBackends) + len(report.MissingServers) + len(report.StaleServers) + len(report.StaleBackends); repaired > 0 {
+		message := fmt.Sprintf("Repaired proxy drift: recreated %d backends, rebound %d servers, unbound %d stale servers, and emptied %d stale backends",
+			len(report.MissingBackends), len(report.MissingServers), len(report.StaleServers), len(report.StaleBackends))
+		log.Print(message)
+		r.Events.Record(models.Event{Type: models.EventDriftReconciled, Message: message})
+	}
+	return report
+}
+
+// suspect reports whether the previous check already found the drift, remembering it for the next one otherwise.
+func (r *DriftReconciler) suspect(drift string, suspects map[string]bool) bool {
+	if r.suspects[drift] {
+		return true
+	}
+	suspects[drift] = true
+	return false
+}
+
+// taggedBackends returns the backends the proxy reports herbarium created, none when it doesn't tag them.
+func (r *DriftReconciler) taggedBackends(report *models.DriftReport) map[string]bool {
+	tagged := make(map[string]bool)
+	reporter, ok := r.ProxyClient.(proxy.OwnershipReporter)
+	if !ok {
+		return tagged
+	}
+	backends, err := reporter.OwnedBackends()
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list backends created by herbarium: %v", err))
+		return tagged
+	}
+	for _, backend := range backends {
+		tagged[backend] = true
+	}
+	return tagged
+}
+
+// emptyStaleBackend unbinds the servers of a backend herbarium created for a stem that is gone. Empty backends
+// are left in place, as the proxy may still route to them.
+func (r *DriftReconciler) emptyStaleBackend(lister proxy.ServerLister, backend string, suspects map[string]bool, report *models.DriftReport) {
+	servers, err := lister.Servers(backend)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list servers of backend %s: %v", backend, err))
+		return
+	}
+	if len(servers) == 0 || !r.suspect("stale-backend:"+backend, suspects) {
+		return
+	}
+	if err := r.ProxyClient.UnbindStem(backend); err != nil {
+		suspects["stale-backend:"+backend] = true
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to empty stale backend %s: %v", backend, err))
+		return
+	}
+	report.StaleBackends = append(report.StaleBackends, backend)
+}
+
+// recreateBackend creates a stem's missing backend and binds the servers of its running leafs. Standby leafs
+// stay out of the proxy until they are promoted, and graft nodes are rebound by the next cold start.
+func (r *DriftReconciler) recreateBackend(stem *models.Stem, suspects map[string]bool, report *models.DriftReport) {
+	if !r.suspect("backend:"+stem.HAProxyBackend, suspects) {
+		return
+	}
+	if err := r.ProxyClient.BindStem(stem.HAProxyBackend, backendOptions(stem.Config, stem.HAProxyBackend)); err != nil {
+		suspects["backend:"+stem.HAProxyBackend] = true
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to recreate backend %s: %v", stem.HAProxyBackend, err))
+		return
+	}
+	report.MissingBackends = append(report.MissingBackends, stem.HAProxyBackend)
+	for _, leaf := range sortedLeafs(stem) {
+		if leaf.Status != models.StatusRunning {
+			continue
+		}
+		if err := r.ProxyClient.BindLeaf(stem.HAProxyBackend, leaf.HAProxyServer, leafHost(leaf), leaf.Port); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to rebind leaf %s to backend %s: %v", leaf.ID, stem.HAProxyBackend, err))
+		}
+	}
+	if stem.Maintenance {
+		if err := switchStemMaintenance(r.ProxyClient, r.Maintenance, stem, true); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to put backend %s into maintenance: %v", stem.HAProxyBackend, err))
+		}
+	}
+}
+
+// reconcileServers rebinds the running leafs of a stem that are missing their server, and unbinds the servers of
+// its backend that point at no live leaf: one the stem doesn't have, or a leaf started here whose process is gone.
+func (r *DriftReconciler) reconcileServers(lister proxy.ServerLister, stem *models.Stem, stems []*models.Stem, suspects map[string]bool, report *models.DriftReport) {
+	servers, err := lister.Servers(stem.HAProxyBackend)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list servers of backend %s: %v", stem.HAProxyBackend, err))
+		return
+	}
+	bound := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		bound[server] = true
+	}
+
+	live := make(map[string]bool, len(stem.LeafInstances)+1)
+	for _, leaf := range sortedLeafs(stem) {
+		if leaf.Agent == "" && leaf.Status == models.StatusRunning && !processAlive(leaf.PID) {
+			continue
+		}
+		live[leaf.HAProxyServer] = true
+		if leaf.Status != models.StatusRunning || bound[leaf.HAProxyServer] {
+			continue
+		}
+		server := stem.HAProxyBackend + "/" + leaf.HAProxyServer
+		if !r.suspect("missing:"+server, suspects) {
+			continue
+		}
+		if err := r.ProxyClient.BindLeaf(stem.HAProxyBackend, leaf.HAProxyServer, leafHost(leaf), leaf.Port); err != nil {
+			suspects["missing:"+server] = true
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to rebind leaf %s to backend %s: %v", leaf.ID, stem.HAProxyBackend, err))
+			continue
+		}
+		report.MissingServers = append(report.MissingServers, server)
+	}
+	if stem.GraftNodeLeaf != nil {
+		live[stem.GraftNodeLeaf.HAProxyServer] = true
+	}
+	// The other versions in the stem's traffic split are bound by splitting it, not rebound here
+	for _, leaf := range splitLeafs(stem, stems) {
+		if leaf.Status == models.StatusRunning && (leaf.Agent != "" || processAlive(leaf.PID)) {
+			live[leaf.HAProxyServer] = true
+		}
+	}
+
+	for _, name := range servers {
+		if live[name] {
+			continue
+		}
+		server := stem.HAProxyBackend + "/" + name
+		if !r.suspect("stale:"+server, suspects) {
+			continue
+		}
+		if err := r.ProxyClient.UnbindLeaf(stem.HAProxyBackend, name); err != nil {
+			suspects["stale:"+server] = true
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to unbind stale server %s from backend %s: %v", name, stem.HAProxyBackend, err))
+			continue
+		}
+		report.StaleServers = append(report.StaleServers, server)
+	}
+}
+
+// sortedLeafs returns the leafs of a stem ordered by ID.
+func sortedLeafs(stem *models.Stem) []*models.Leaf {
+	leafs := make([]*models.Leaf, 0, len(stem.LeafInstances))
+	for _, leaf := range stem.LeafInstances {
+		leafs = append(leafs, leaf)
+	}
+	sort.Slice(leafs, func(i, j int) bool { return leafs[i].ID < leafs[j].ID })
+	return leafs
+}
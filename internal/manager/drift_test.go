@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"os"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// backendListingProxyClient is a listingProxyClient that also lists its backends.
+type backendListingProxyClient struct {
+	*listingProxyClient
+	backends []string
+}
+
+func (c *backendListingProxyClient) Backends() ([]string, error) {
+	return c.backends, nil
+}
+
+// taggingProxyClient is a backendListingProxyClient that also reports which backends herbarium created.
+type taggingProxyClient struct {
+	*backendListingProxyClient
+	owned []string
+}
+
+func (c *taggingProxyClient) OwnedBackends() ([]string, error) {
+	return c.owned, nil
+}
+
+func TestDriftReconciler_Reconcile(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[storage.StemKey{Name: "api", Version: "v1"}] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api"},
+		LeafInstances: map[string]*models.Leaf{
+			"alive":   {ID: "alive", PID: os.Getpid(), HAProxyServer: "alive", Port: 8001, Status: models.StatusRunning},
+			"unbound": {ID: "unbound", PID: os.Getpid(), HAProxyServer: "unbound", Port: 8002, Status: models.StatusRunning},
+			"dead":    {ID: "dead", PID: 1 << 30, HAProxyServer: "dead", Port: 8003, Status: models.StatusRunning},
+			"standby": {ID: "standby", PID: os.Getpid(), HAProxyServer: "standby", Port: 8004, Status: models.StatusStandby},
+		}}
+	db.Stems[storage.StemKey{Name: "web", Version: "v1"}] = &models.Stem{Name: "web", Version: "v1", HAProxyBackend: "web",
+		Config: &models.StemConfig{Name: "web", Version: "v1", URL: "/web"},
+		LeafInstances: map[string]*models.Leaf{
+			"web-1": {ID: "web-1", PID: os.Getpid(), HAProxyServer: "web-1", Host: "10.0.0.2", Port: 8010, Status: models.StatusRunning},
+			"web-2": {ID: "web-2", HAProxyServer: "web-2", Port: 8011, Status: models.StatusStarting},
+		}}
+
+	proxyClient := &backendListingProxyClient{
+		listingProxyClient: &listingProxyClient{MockProxyClient: new(MockProxyClient), servers: map[string][]string{"api": {"alive", "dead", "stale"}}},
+		backends:           []string{"api", "herbarium", "legacy"},
+	}
+	proxyClient.On("BindStem", "web", proxy.BackendOptions{}).Return(nil).Once()
+	proxyClient.On("BindLeaf", "web", "web-1", "10.0.0.2", 8010).Return(nil).Once()
+	proxyClient.On("BindLeaf", "api", "unbound", "localhost", 8002).Return(nil).Once()
+	proxyClient.On("UnbindLeaf", "api", "dead").Return(nil).Once()
+	proxyClient.On("UnbindLeaf", "api", "stale").Return(nil).Once()
+
+	reconciler := NewDriftReconciler(repos.NewStemRepository(db), proxyClient)
+	reconciler.Events = NewEventLog(0)
+
+	// Drifts are only repaired when the next check still finds them, foreign backends are always reported
+	report := reconciler.Reconcile()
+	assert.Empty(t, report.MissingBackends)
+	assert.Empty(t, report.MissingServers)
+	assert.Empty(t, report.StaleServers)
+	assert.Equal(t, []string{"legacy"}, report.ForeignBackends)
+	assert.Empty(t, proxyClient.Calls)
+
+	report = reconciler.Reconcile()
+	assert.Equal(t, []string{"web"}, report.MissingBackends)
+	assert.Equal(t, []string{"api/unbound"}, report.MissingServers)
+	assert.Equal(t, []string{"api/dead", "api/stale"}, report.StaleServers)
+	assert.Equal(t, []string{"legacy"}, report.ForeignBackends)
+	assert.Empty(t, report.Errors)
+	proxyClient.AssertExpectations(t)
+
+	events := reconciler.Events.List(EventQuery{})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, models.EventDriftReconciled, events[0].Type)
+		assert.Equal(t, "Repaired proxy drift: recreated 1 backends, rebound 1 servers, unbound 2 stale servers, and emptied 0 stale backends", events[0].Message)
+	}
+}
+
+func TestDriftReconciler_EmptiesStaleTaggedBackends(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[storage.StemKey{Name: "api", Version: "v2"}] = &models.Stem{Name: "api", Version: "v2", HAProxyBackend: "hb-api-v2",
+		Config: &models.StemConfig{Name: "api", Version: "v2", URL: "/api"}, LeafInstances: map[string]*models.Leaf{}}
+
+	proxyClient := &taggingProxyClient{
+		backendListingProxyClient: &backendListingProxyClient{
+			listingProxyClient: &listingProxyClient{MockProxyClient: new(MockProxyClient), servers: map[string][]string{"hb-api-v1": {"api-1"}}},
+			backends:           []string{"hb-api-v1", "hb-api-v2", "hb-old-v1", "legacy"},
+		},
+		owned: []string{"hb-api-v1", "hb-api-v2", "hb-old-v1"},
+	}
+	proxyClient.On("UnbindStem", "hb-api-v1").Return(nil).Once()
+
+	reconciler := NewDriftReconciler(repos.NewStemRepository(db), proxyClient)
+
+	// Tagged backends of no stem are not foreign, and only emptied when the next check still finds their servers
+	report := reconciler.Reconcile()
+	assert.Empty(t, report.StaleBackends)
+	assert.Equal(t, []string{"legacy"}, report.ForeignBackends)
+
+	report = reconciler.Reconcile()
+	assert.Equal(t, []string{"hb-api-v1"}, report.StaleBackends)
+	assert.Equal(t, []string{"legacy"}, report.ForeignBackends)
+	assert.Empty(t, report.Errors)
+	proxyClient.AssertExpectations(t)
+}
+
+func TestDriftReconciler_ProxyWithoutListing(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	reconciler := NewDriftReconciler(repos.NewStemRepository(db), new(MockProxyClient))
+
+	report := reconciler.Reconcile()
+	assert.Equal(t, []string{"the proxy does not list its backends and servers"}, report.Errors)
+}
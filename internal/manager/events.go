@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultEventCapacity is how many events an EventLog keeps before dropping the oldest.
+const DefaultEventCapacity = 1000
+
+// EventLog keeps the most recent platform events in memory, where the admin API serves them to stem owners.
+// A nil EventLog discards events.
+type EventLog struct {
+	mu       sync.Mutex
+	events   []models.Event // Oldest first
+	capacity int
+	seq      uint64
+
+	subscribers []func(models.Event) // Called with every recorded event
+}
+
+// EventQuery filters the events returned by List. Zero fields match everything.
+type EventQuery struct {
+	Stem     string           // Only events of this stem
+	Type     models.EventType // Only events of this type
+	AfterSeq uint64           // Only events with a greater sequence number
+	Limit    int              // Maximum number of events, the oldest matching ones first
+}
+
+// NewEventLog creates an EventLog keeping up to capacity events, DefaultEventCapacity if it is not positive.
+func NewEventLog(capacity int) *EventLog {
+	if capacity <= 0 {
+		capacity = DefaultEventCapacity
+	}
+	return &EventLog{capacity: capacity}
+}
+
+// Subscribe registers fn to be called with every event recorded from now on. Subscribers are called
+// synchronously, after the event is stored, and must not block.
+func (l *EventLog) Subscribe(fn func(models.Event)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subscribers = append(l.subscribers, fn)
+}
+
+// Record assigns an event the next sequence number, and the current time if it has none, then logs and stores
+// it and passes it to the subscribers.
+func (l *EventLog) Record(event models.Event) models.Event {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	log.Printf("[Event] %s: %s", event.Type, event.Message)
+	if l == nil {
+		return event
+	}
+
+	l.mu.Lock()
+	l.seq++
+	event.Seq = l.seq
+	if len(l.events) == l.capacity {
+		l.events = append(l.events[:0], l.events[1:]...)
+	}
+	l.events = append(l.events, event)
+	subscribers := l.subscribers
+	l.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+	return event
+}
+
+// List returns the stored events matching query, oldest first.
+func (l *EventLog) List(query EventQuery) []models.Event {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var events []models.Event
+	for _, event := range l.events {
+		if event.Seq <= query.AfterSeq ||
+			(query.Stem != "" && event.Stem != query.Stem) ||
+			(query.Type != "" && event.Type != query.Type) {
+			continue
+		}
+		events = append(events, event)
+		if query.Limit > 0 && len(events) == query.Limit {
+			break
+		}
+	}
+	return events
+}
@@ -0,0 +1,37 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventLog(t *testing.T) {
+	events := NewEventLog(2)
+	for _, leaf := range []string{"api-1", "api-2", "api-3"} {
+		recorded := events.Record(models.Event{Type: models.EventLeafRecycled, Stem: "api", Leaf: leaf})
+		assert.False(t, recorded.Time.IsZero())
+	}
+
+	// The oldest event is dropped once the log is full, sequence numbers keep counting
+	listed := events.List(EventQuery{})
+	if assert.Len(t, listed, 2) {
+		assert.Equal(t, uint64(2), listed[0].Seq)
+		assert.Equal(t, "api-3", listed[1].Leaf)
+	}
+	assert.Len(t, events.List(EventQuery{AfterSeq: 2}), 1)
+	assert.Empty(t, events.List(EventQuery{Stem: "worker"}))
+	assert.Empty(t, events.List(EventQuery{Type: models.EventLeafMemoryExceeded}))
+
+	// Subscribers see events recorded after they subscribed, with their sequence number
+	var seen []uint64
+	events.Subscribe(func(event models.Event) { seen = append(seen, event.Seq) })
+	events.Record(models.Event{Type: models.EventDeploySucceeded, Stem: "api"})
+	assert.Equal(t, []uint64{4}, seen)
+
+	// A nil log discards events
+	var discarded *EventLog
+	discarded.Record(models.Event{Type: models.EventLeafRecycled})
+	assert.Nil(t, discarded.List(EventQuery{}))
+}
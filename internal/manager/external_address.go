@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// detectAdvertiseAddress sets leafs.advertise_address to the address this host reaches HAProxy through when
+// a Dataplane API runs on another host, which cannot reach leafs registered at localhost. A configured
+// advertise address is kept.
+func detectAdvertiseAddress(config *models.GlobalConfig) {
+	if config.Leafs.AdvertiseAddress != "" || (config.Proxy.Type != "" && config.Proxy.Type != proxy.TypeHAProxy) {
+		return
+	}
+	for _, instance := range haproxyConfigs(config) {
+		u, err := url.Parse(instance.APIURL)
+		if err != nil || u.Hostname() == "" || u.Hostname() == "localhost" {
+			continue
+		}
+		address, remote, err := routableAddress(u.Hostname())
+		if err != nil {
+			log.Printf("Failed to determine the address HAProxy %s reaches this host at, leafs are registered at localhost: %v", instance.Name, err)
+			return
+		}
+		if remote {
+			log.Printf("HAProxy %s runs on another host, registering leafs at %s", instance.Name, address)
+			config.Leafs.AdvertiseAddress = address
+			return
+		}
+	}
+}
+
+// routableAddress returns the address of the interface this host reaches host through, and whether host is
+// another host. Dialing UDP only consults the routing table, no packets are sent.
+func routableAddress(host string) (string, bool, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(host, "9"))
+	if err != nil {
+		return "", false, fmt.Errorf("no route to %s: %v", host, err)
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	remote := conn.RemoteAddr().(*net.UDPAddr).IP
+	if remote.IsLoopback() || local.Equal(remote) {
+		return local.String(), false, nil
+	}
+	return local.String(), true, nil
+}
@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectAdvertiseAddress(t *testing.T) {
+	t.Run("local HAProxy keeps localhost", func(t *testing.T) {
+		for _, url := range []string{"http://localhost:5555", "http://127.0.0.1:5555", "http://[::1]:5555"} {
+			config := &models.GlobalConfig{}
+			config.HAProxy.URL = url
+			detectAdvertiseAddress(config)
+			assert.Empty(t, config.Leafs.AdvertiseAddress, url)
+		}
+	})
+
+	t.Run("configured address and other proxies are left alone", func(t *testing.T) {
+		config := &models.GlobalConfig{}
+		config.HAProxy.URL = "http://192.0.2.10:5555"
+		config.Leafs.AdvertiseAddress = "app-1.internal"
+		detectAdvertiseAddress(config)
+		assert.Equal(t, "app-1.internal", config.Leafs.AdvertiseAddress)
+
+		config = &models.GlobalConfig{}
+		config.HAProxy.URL = "http://192.0.2.10:5555"
+		config.Proxy.Type = proxy.TypeNginx
+		detectAdvertiseAddress(config)
+		assert.Empty(t, config.Leafs.AdvertiseAddress)
+	})
+
+	t.Run("remote HAProxy gets the routable address", func(t *testing.T) {
+		address, remote, err := routableAddress("192.0.2.10")
+		if err != nil || !remote {
+			t.Skipf("no route to a remote address: %v", err)
+		}
+		config := &models.GlobalConfig{}
+		config.HAProxy.URL = "http://192.0.2.10:5555"
+		detectAdvertiseAddress(config)
+		assert.Equal(t, address, config.Leafs.AdvertiseAddress)
+	})
+}
+
+func TestRoutableAddress_Local(t *testing.T) {
+	address, remote, err := routableAddress("127.0.0.1")
+	assert.NoError(t, err)
+	assert.False(t, remote)
+	assert.Equal(t, "127.0.0.1", address)
+}
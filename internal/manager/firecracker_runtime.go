@@ -0,0 +1,401 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// FirecrackerRuntimeName is the runtime name of stems whose leafs run in Firecracker microVMs.
+const FirecrackerRuntimeName = "firecracker"
+
+// Defaults of the microVMs of stems and of the firecracker section of the global config.
+const (
+	DefaultFirecrackerSubnet   = "172.30.0.0/16"
+	DefaultFirecrackerPort     = 8080
+	DefaultFirecrackerVCPUs    = 1
+	DefaultFirecrackerMemoryMB = 256
+)
+
+// firecrackerSocketTimeout bounds how long a started Firecracker process may take to open its API socket.
+const firecrackerSocketTimeout = 5 * time.Second
+
+// firecrackerPollInterval is how often a booting microVM is checked for its API socket and readiness.
+var firecrackerPollInterval = 200 * time.Millisecond
+
+// ipCommand runs the ip tool setting up the tap devices of microVMs.
+var ipCommand = func(args ...string) error {
+	if output, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ip %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// FirecrackerRuntime runs each leaf in its own Firecracker microVM, isolating untrusted deployments behind a
+// kernel of their own. Every microVM gets a /30 of the runtime's subnet on a tap device: the host end is the
+// first address, the guest the second, and the proxy reaches the leaf at the guest address. The root
+// filesystem's init reads the leaf's command, env, and port from the microVM metadata service (MMDS) under
+// herbarium. Herbarium must run as root on a Linux host with KVM. MicroVMs don't survive a herbarium restart.
+type FirecrackerRuntime struct {
+	Binary   string // Firecracker executable
+	StateDir string // Directory of the API sockets
+
+	subnet *net.IPNet
+	mu     sync.Mutex
+	vms    map[string]*microVM // Running microVMs by leaf ID
+	slots  map[int]bool        // /30s of the subnet in use
+}
+
+// microVM is a Firecracker process running a leaf.
+type microVM struct {
+	slot        int
+	tap         string
+	socket      string
+	guestIP     string
+	port        int
+	stopTimeout time.Duration
+	cmd         *exec.Cmd
+	logFile     *os.File
+	exited      chan struct{} // Closed once the Firecracker process exited
+}
+
+// firecrackerMetadata is what the root filesystem's init reads from the MMDS to start the leaf.
+type firecrackerMetadata struct {
+	LeafID  string            `json:"leafId"`
+	Stem    string            `json:"stem"`
+	Version string            `json:"version"`
+	Command string            `json:"command"`
+	Env     map[string]string `json:"env"`
+	Port    int               `json:"port"`
+}
+
+// NewFirecrackerRuntime creates a runtime starting microVMs with binary, keeping their API sockets in stateDir
+// and addressing them from subnet, an IPv4 CIDR of at least a /30.
+func NewFirecrackerRuntime(binary, stateDir, subnet string) (*FirecrackerRuntime, error) {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil || network.IP.To4() == nil {
+		return nil, fmt.Errorf("firecracker subnet %q is not an IPv4 CIDR", subnet)
+	}
+	if ones, _ := network.Mask.Size(); ones > 30 {
+		return nil, fmt.Errorf("firecracker subnet %q is smaller than a /30", subnet)
+	}
+	if binary == "" {
+		binary = "firecracker"
+	}
+	return &FirecrackerRuntime{
+		Binary:   binary,
+		StateDir: stateDir,
+		subnet:   network,
+		vms:      make(map[string]*microVM),
+		slots:    make(map[int]bool),
+	}, nil
+}
+
+// NewFirecrackerRuntimeFromConfig creates the runtime configured by the firecracker section of the global
+// config, nil unless it is enabled.
+func NewFirecrackerRuntimeFromConfig(config *models.GlobalConfig) (*FirecrackerRuntime, error) {
+	if !config.Firecracker.Enabled {
+		return nil, nil
+	}
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("firecracker microVMs only run on Linux")
+	}
+	stateDir := config.Firecracker.StateDir
+	if stateDir == "" {
+		stateDir = filepath.Join(config.Plantarium.RootFolder, "system", "herbarium", "firecracker")
+	}
+	subnet := config.Firecracker.Subnet
+	if subnet == "" {
+		subnet = DefaultFirecrackerSubnet
+	}
+	return NewFirecrackerRuntime(config.Firecracker.Binary, stateDir, subnet)
+}
+
+// Host returns localhost. Leafs are reached at their microVM's guest address, which StartLeaf reports.
+func (f *FirecrackerRuntime) Host() string {
+	return "localhost"
+}
+
+// StartLeaf boots a microVM for the leaf and waits until the leaf in it passes its stem's readiness probe,
+// tearing the microVM down when it exits or isn't ready within ServiceStartupTimeout.
+func (f *FirecrackerRuntime) StartLeaf(request AgentStartRequest) (*AgentLeaf, error) {
+	config := request.Config
+	spec := config.Firecracker
+	if spec == nil || spec.Kernel == "" || spec.RootFS == "" {
+		return nil, fmt.Errorf("stem %s has no firecracker kernel and rootfs", request.StemName)
+	}
+	metadata := firecrackerMetadata{LeafID: request.LeafID, Stem: request.StemName, Version: request.Version,
+		Env: config.Env, Port: spec.Port}
+	if metadata.Port == 0 {
+		metadata.Port = DefaultFirecrackerPort
+	}
+	command, err := prepareCommandWithTemplate(config.Command, map[string]interface{}{"PORT": metadata.Port})
+	if err != nil {
+		return nil, err
+	}
+	metadata.Command = command
+
+	vm, hostIP, err := f.allocate(request.LeafID)
+	if err != nil {
+		return nil, err
+	}
+	vm.port = metadata.Port
+	vm.stopTimeout = behaviorOf(&config).stopTimeout
+	if err := f.boot(vm, hostIP, spec, metadata); err != nil {
+		f.destroy(request.LeafID, vm)
+		return nil, err
+	}
+
+	prober := proberOf(&config)
+	deadline := time.Now().Add(ServiceStartupTimeout)
+	for {
+		select {
+		case <-vm.exited:
+			f.destroy(request.LeafID, vm)
+			return nil, fmt.Errorf("microVM of leaf %s exited while booting", request.LeafID)
+		default:
+		}
+		err := prober.Probe(vm.guestIP, vm.port)
+		if err == nil {
+			log.Printf("Leaf %s is ready in its microVM at %s:%d", request.LeafID, vm.guestIP, vm.port)
+			return &AgentLeaf{ID: request.LeafID, PID: vm.cmd.Process.Pid, Port: vm.port, Host: vm.guestIP, Alive: true}, nil
+		}
+		if time.Now().After(deadline) {
+			f.destroy(request.LeafID, vm)
+			return nil, fmt.Errorf("leaf %s was not ready in its microVM within %s: %v", request.LeafID, ServiceStartupTimeout, err)
+		}
+		time.Sleep(firecrackerPollInterval)
+	}
+}
+
+// allocate reserves a /30 of the subnet for a leaf's microVM and returns it with the host end's address.
+func (f *FirecrackerRuntime) allocate(leafID string) (*microVM, net.IP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.vms[leafID]; ok {
+		return nil, nil, fmt.Errorf("leaf %s already has a microVM", leafID)
+	}
+	ones, bits := f.subnet.Mask.Size()
+	slots := 1 << (bits - ones - 2)
+	for slot := 0; slot < slots; slot++ {
+		if f.slots[slot] {
+			continue
+		}
+		f.slots[slot] = true
+		hostIP, guestIP := slotAddresses(f.subnet, slot)
+		vm := &microVM{slot: slot, tap: fmt.Sprintf("fc-tap%d", slot), guestIP: guestIP.String(), exited: make(chan struct{})}
+		f.vms[leafID] = vm
+		return vm, hostIP, nil
+	}
+	return nil, nil, fmt.Errorf("all %d microVM addresses of subnet %s are in use", slots, f.subnet)
+}
+
+// boot sets up the tap device of a microVM, starts Firecracker with the leaf's console output going to its log
+// file, and configures and starts the microVM through the API socket.
+func (f *FirecrackerRuntime) boot(vm *microVM, hostIP net.IP, spec *models.FirecrackerConfig, metadata firecrackerMetadata) error {
+	for _, args := range [][]string{
+		{"tuntap", "add", "dev", vm.tap, "mode", "tap"},
+		{"addr", "add", hostIP.String() + "/30", "dev", vm.tap},
+		{"link", "set", vm.tap, "up"},
+	} {
+		if err := ipCommand(args...); err != nil {
+			return fmt.Errorf("failed to set up tap device %s: %v", vm.tap, err)
+		}
+	}
+
+	if err := os.MkdirAll(f.StateDir, 0700); err != nil {
+		return fmt.Errorf("failed to create firecracker state directory: %v", err)
+	}
+	vm.socket = filepath.Join(f.StateDir, metadata.LeafID+".sock")
+	os.Remove(vm.socket)
+	logFile, err := setupLogFile(getLogFolder(), metadata.LeafID, storage.StemKey{Name: metadata.Stem, Version: metadata.Version})
+	if err != nil {
+		return fmt.Errorf("failed to create log file: %v", err)
+	}
+	vm.logFile = logFile
+	vm.cmd = exec.Command(f.Binary, "--api-sock", vm.socket)
+	vm.cmd.Stdout = logFile
+	vm.cmd.Stderr = logFile
+	if err := vm.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start firecracker: %v", err)
+	}
+	go func() {
+		vm.cmd.Wait()
+		close(vm.exited)
+	}()
+
+	deadline := time.Now().Add(firecrackerSocketTimeout)
+	for {
+		if _, err := os.Stat(vm.socket); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("firecracker did not open its API socket within %s", firecrackerSocketTimeout)
+		}
+		time.Sleep(firecrackerPollInterval)
+	}
+	return configureMicroVM(firecrackerClient(vm.socket), vm, hostIP, spec, metadata)
+}
+
+// configureMicroVM sets the machine, kernel, read-only root drive, network interface, and metadata of a
+// microVM through its API, then starts it. The guest address is set with the kernel's ip= argument.
+func configureMicroVM(client *http.Client, vm *microVM, hostIP net.IP, spec *models.FirecrackerConfig, metadata firecrackerMetadata) error {
+	vcpus, memory := spec.VCPUs, spec.MemoryMB
+	if vcpus == 0 {
+		vcpus = DefaultFirecrackerVCPUs
+	}
+	if memory == 0 {
+		memory = DefaultFirecrackerMemoryMB
+	}
+	guestIP := net.ParseIP(vm.guestIP).To4()
+	bootArgs := fmt.Sprintf("console=ttyS0 reboot=k panic=1 pci=off ip=%s::%s:255.255.255.252::eth0:off", vm.guestIP, hostIP)
+
+	for _, call := range []struct {
+		path string
+		body any
+	}{
+		{"/machine-config", map[string]any{"vcpu_count": vcpus, "mem_size_mib": memory}},
+		{"/boot-source", map[string]any{"kernel_image_path": spec.Kernel, "boot_args": bootArgs}},
+		{"/drives/rootfs", map[string]any{"drive_id": "rootfs", "path_on_host": spec.RootFS, "is_root_device": true, "is_read_only": true}},
+		{"/network-interfaces/eth0", map[string]any{"iface_id": "eth0", "host_dev_name": vm.tap,
+			"guest_mac": fmt.Sprintf("06:00:%02x:%02x:%02x:%02x", guestIP[0], guestIP[1], guestIP[2], guestIP[3])}},
+		{"/mmds/config", map[string]any{"version": "V2", "network_interfaces": []string{"eth0"}}},
+		{"/mmds", map[string]any{"herbarium": metadata}},
+		{"/actions", map[string]any{"action_type": "InstanceStart"}},
+	} {
+		if err := firecrackerPut(client, call.path, call.body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StopLeaf asks the microVM of a leaf to shut down with Ctrl+Alt+Del, kills it after the stem's stop timeout,
+// and removes its tap device and socket. A leaf without a microVM is considered stopped.
+func (f *FirecrackerRuntime) StopLeaf(leafID string) error {
+	f.mu.Lock()
+	vm, ok := f.vms[leafID]
+	f.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if err := firecrackerPut(firecrackerClient(vm.socket), "/actions", map[string]any{"action_type": "SendCtrlAltDel"}); err != nil {
+		log.Printf("Failed to ask microVM of leaf %s to shut down: %v", leafID, err)
+	}
+	select {
+	case <-vm.exited:
+	case <-time.After(vm.stopTimeout):
+		log.Printf("MicroVM of leaf %s did not shut down within %s, killing it", leafID, vm.stopTimeout)
+	}
+	f.destroy(leafID, vm)
+	return nil
+}
+
+// destroy kills the Firecracker process of a microVM if it is still running and releases what it held.
+func (f *FirecrackerRuntime) destroy(leafID string, vm *microVM) {
+	if vm.cmd != nil && vm.cmd.Process != nil {
+		select {
+		case <-vm.exited:
+		default:
+			vm.cmd.Process.Kill()
+			<-vm.exited
+		}
+	}
+	if err := ipCommand("link", "del", vm.tap); err != nil {
+		log.Printf("Failed to remove tap device %s of leaf %s: %v", vm.tap, leafID, err)
+	}
+	if vm.socket != "" {
+		os.Remove(vm.socket)
+	}
+	if vm.logFile != nil {
+		vm.logFile.Close()
+	}
+	f.mu.Lock()
+	delete(f.vms, leafID)
+	delete(f.slots, vm.slot)
+	f.mu.Unlock()
+}
+
+// GetLeaf reports whether the microVM of a leaf is running.
+func (f *FirecrackerRuntime) GetLeaf(leafID string) (*AgentLeaf, error) {
+	f.mu.Lock()
+	vm, ok := f.vms[leafID]
+	f.mu.Unlock()
+	if !ok {
+		return &AgentLeaf{ID: leafID}, nil
+	}
+	leaf := &AgentLeaf{ID: leafID, Port: vm.port, Host: vm.guestIP, Alive: true}
+	if vm.cmd != nil && vm.cmd.Process != nil {
+		leaf.PID = vm.cmd.Process.Pid
+	}
+	select {
+	case <-vm.exited:
+		leaf.Alive = false
+	default:
+	}
+	return leaf, nil
+}
+
+// ReadLeafLogs returns the console output of a leaf's microVM, kept in the local log folder.
+func (f *FirecrackerRuntime) ReadLeafLogs(leafID string, opts LogReadOptions) ([]byte, error) {
+	return ReadLeafLogFiles(leafID, opts)
+}
+
+// slotAddresses returns the host and guest addresses of a /30 of subnet.
+func slotAddresses(subnet *net.IPNet, slot int) (host, guest net.IP) {
+	base := binary.BigEndian.Uint32(subnet.IP.To4()) + uint32(slot)*4
+	host, guest = make(net.IP, 4), make(net.IP, 4)
+	binary.BigEndian.PutUint32(host, base+1)
+	binary.BigEndian.PutUint32(guest, base+2)
+	return host, guest
+}
+
+// firecrackerClient returns an HTTP client talking to the Firecracker API on socket.
+func firecrackerClient(socket string) *http.Client {
+	return &http.Client{
+		Timeout: firecrackerSocketTimeout,
+		Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}},
+	}
+}
+
+// firecrackerPut sends a PUT to the Firecracker API, failing unless it answers with a 2xx status.
+func firecrackerPut(client *http.Client, path string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPut, "http://localhost"+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to reach firecracker API: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("firecracker failed PUT %s with status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package manager
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlotAddresses(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR(DefaultFirecrackerSubnet)
+	host, guest := slotAddresses(subnet, 0)
+	assert.Equal(t, "172.30.0.1", host.String())
+	assert.Equal(t, "172.30.0.2", guest.String())
+	host, guest = slotAddresses(subnet, 70)
+	assert.Equal(t, "172.30.1.25", host.String())
+	assert.Equal(t, "172.30.1.26", guest.String())
+}
+
+func TestConfigureMicroVM(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "leaf.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	var paths []string
+	bodies := map[string]map[string]any{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		paths = append(paths, r.URL.Path)
+		bodies[r.URL.Path] = body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	vm := &microVM{tap: "fc-tap3", guestIP: "172.30.0.14"}
+	spec := &models.FirecrackerConfig{Kernel: "/images/vmlinux", RootFS: "/images/billing.ext4", MemoryMB: 512}
+	metadata := firecrackerMetadata{LeafID: "billing-v1-1", Stem: "billing", Version: "v1", Command: "./billing --port 8080",
+		Env: map[string]string{"LOG_LEVEL": "info"}, Port: 8080}
+	assert.NoError(t, configureMicroVM(firecrackerClient(socket), vm, net.ParseIP("172.30.0.13"), spec, metadata))
+
+	// The microVM is started only once it is fully configured
+	assert.Equal(t, []string{"/machine-config", "/boot-source", "/drives/rootfs", "/network-interfaces/eth0", "/mmds/config", "/mmds", "/actions"}, paths)
+	assert.Equal(t, map[string]any{"vcpu_count": float64(1), "mem_size_mib": float64(512)}, bodies["/machine-config"])
+	assert.Contains(t, bodies["/boot-source"]["boot_args"], "ip=172.30.0.14::172.30.0.13:255.255.255.252::eth0:off")
+	assert.Equal(t, true, bodies["/drives/rootfs"]["is_read_only"])
+	assert.Equal(t, "06:00:ac:1e:00:0e", bodies["/network-interfaces/eth0"]["guest_mac"])
+	assert.Equal(t, map[string]any{"leafId": "billing-v1-1", "stem": "billing", "version": "v1", "command": "./billing --port 8080",
+		"env": map[string]any{"LOG_LEVEL": "info"}, "port": float64(8080)}, bodies["/mmds"]["herbarium"])
+	assert.Equal(t, "InstanceStart", bodies["/actions"]["action_type"])
+}
+
+func TestFirecrackerRuntime(t *testing.T) {
+	_, err := NewFirecrackerRuntime("", t.TempDir(), "172.30.0.0/31")
+	assert.ErrorContains(t, err, "smaller than a /30")
+	_, err = NewFirecrackerRuntime("", t.TempDir(), "fd00::/64")
+	assert.ErrorContains(t, err, "not an IPv4 CIDR")
+
+	// A /29 holds two microVMs
+	firecracker, err := NewFirecrackerRuntime("", t.TempDir(), "10.0.0.0/29")
+	assert.NoError(t, err)
+	first, _, err := firecracker.allocate("a")
+	assert.NoError(t, err)
+	_, _, err = firecracker.allocate("a")
+	assert.ErrorContains(t, err, "leaf a already has a microVM")
+	_, hostIP, err := firecracker.allocate("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", hostIP.String())
+	_, _, err = firecracker.allocate("c")
+	assert.ErrorContains(t, err, "all 2 microVM addresses of subnet 10.0.0.0/29 are in use")
+
+	// Stopping releases the address
+	ip := ipCommand
+	var removed [][]string
+	ipCommand = func(args ...string) error { removed = append(removed, args); return nil }
+	defer func() { ipCommand = ip }()
+	firecracker.destroy("a", first)
+	assert.Equal(t, [][]string{{"link", "del", "fc-tap0"}}, removed)
+	vm, _, err := firecracker.allocate("c")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", vm.guestIP)
+
+	assert.NoError(t, firecracker.StopLeaf("unknown"), "a leaf without a microVM is stopped")
+	leaf, err := firecracker.GetLeaf("unknown")
+	assert.NoError(t, err)
+	assert.False(t, leaf.Alive)
+
+	_, err = firecracker.StartLeaf(AgentStartRequest{StemName: "billing", LeafID: "billing-v1-1", Config: models.StemConfig{
+		Command: "./billing", Firecracker: &models.FirecrackerConfig{Kernel: "/images/vmlinux"}}})
+	assert.ErrorContains(t, err, "stem billing has no firecracker kernel and rootfs")
+
+	// Without firecracker enabled, stems with firecracker have no runtime
+	_, err = remoteRuntime(nil, &models.StemConfig{Firecracker: &models.FirecrackerConfig{}}, FirecrackerRuntimeName)
+	assert.ErrorContains(t, err, "firecracker is not enabled in the global config")
+}
@@ -0,0 +1,44 @@
+package manager
+
+import "github.com/plantarium-platform/herbarium-go/pkg/models"
+
+// IP families a stem's local leafs are reached over, selectable per stem.
+const (
+	IPFamilyIPv4 = "ipv4" // 127.0.0.1
+	IPFamilyIPv6 = "ipv6" // ::1
+	IPFamilyDual = "dual" // Both 127.0.0.1 and ::1, routed over IPv4
+)
+
+// loopbackHosts returns the addresses a local leaf of a stem must be ready at. The proxy routes to the first.
+// Stems without an IP family use localhost, whichever family it resolves to.
+func loopbackHosts(config *models.StemConfig) []string {
+	family := ""
+	if config != nil {
+		family = config.IPFamily
+	}
+	switch family {
+	case IPFamilyIPv4:
+		return []string{"127.0.0.1"}
+	case IPFamilyIPv6:
+		return []string{"::1"}
+	case IPFamilyDual:
+		return []string{"127.0.0.1", "::1"}
+	default:
+		return []string{"localhost"}
+	}
+}
+
+// localLeafHost returns the address the proxy reaches a stem's local leafs at.
+func localLeafHost(config *models.StemConfig) string {
+	return loopbackHosts(config)[0]
+}
+
+// readyAt reports whether ready holds for every host.
+func readyAt(hosts []string, ready func(host string) bool) bool {
+	for _, host := range hosts {
+		if !ready(host) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultJanitorInterval is how often the janitor looks for tombstones past their retention.
+const DefaultJanitorInterval = 10 * time.Minute
+
+// DefaultTombstoneRetention is how long the tombstone of an unregistered stem is kept.
+const DefaultTombstoneRetention = 24 * time.Hour
+
+// Janitor purges the tombstones unregistered stems leave behind once they are older than the retention,
+// together with the log files of the leafs kept in them. Until then, the final state and logs of a removed
+// stem can be looked into.
+type Janitor struct {
+	StemRepo  repos.StemRepositoryInterface
+	Retention time.Duration // How long tombstones are kept
+
+	mu sync.Mutex // Serializes purges
+}
+
+// NewJanitor creates a Janitor keeping the tombstones in stemRepo for the given retention.
+func NewJanitor(stemRepo repos.StemRepositoryInterface, retention time.Duration) *Janitor {
+	return &Janitor{StemRepo: stemRepo, Retention: retention}
+}
+
+// StartSchedule purges expired tombstones every interval until stop is closed.
+func (j *Janitor) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Purging tombstones of unregistered stems after %s, checking every %s", j.Retention, interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("janitor", func() { j.Purge(time.Now()) })
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Purge drops the tombstones that are older than the retention at now, removes the log files of their leafs,
+// and returns the keys of the purged stems.
+func (j *Janitor) Purge(now time.Time) []storage.StemKey {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	purged, err := j.StemRepo.PurgeTombstones(now.Add(-j.Retention))
+	if err != nil {
+		log.Printf("Failed to purge tombstones: %v", err)
+		return nil
+	}
+
+	keys := make([]storage.StemKey, 0, len(purged))
+	for _, tombstone := range purged {
+		key := storage.StemKey{Name: tombstone.Name, Version: tombstone.Version}
+		log.Printf("Purged tombstone of stem %s version %s, unregistered at %s", key.Name, key.Version, tombstone.Deleted.Format(time.RFC3339))
+		removeTombstoneLogs(tombstone)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Tombstones lists the tombstones of unregistered stems, oldest deletion first.
+func (j *Janitor) Tombstones() ([]*models.Stem, error) {
+	return j.StemRepo.ListTombstones()
+}
+
+// Tombstone returns the tombstone of an unregistered stem.
+func (j *Janitor) Tombstone(key storage.StemKey) (*models.Stem, error) {
+	return j.StemRepo.FetchTombstone(key)
+}
+
+// removeTombstoneLogs removes the local log files, rotated segments included, of the leafs and the graft node
+// kept in a tombstone. Logs of leafs run by an agent or over SSH stay on their remote host.
+func removeTombstoneLogs(tombstone *models.Stem) {
+	leafs := make([]*models.Leaf, 0, len(tombstone.LeafInstances)+1)
+	for _, leaf := range tombstone.LeafInstances {
+		leafs = append(leafs, leaf)
+	}
+	if tombstone.GraftNodeLeaf != nil {
+		leafs = append(leafs, tombstone.GraftNodeLeaf)
+	}
+
+	for _, leaf := range leafs {
+		if leaf.Agent != "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(getLogFolder(), leaf.ID+leafOwnerSuffix)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove owner of leaf %s: %v", leaf.ID, err)
+		}
+		segments, err := leafLogSegments(getLogFolder(), leaf.ID)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to list logs of leaf %s: %v", leaf.ID, err)
+			continue
+		}
+		for _, segment := range segments {
+			if err := os.Remove(segment); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to remove log %s of leaf %s: %v", segment, leaf.ID, err)
+			}
+		}
+	}
+}
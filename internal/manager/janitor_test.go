@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJanitor_Purge(t *testing.T) {
+	logFolder := t.TempDir()
+	t.Setenv("PLANTARIUM_LOG_FOLDER", logFolder)
+	for _, name := range []string{"api-v1-1.log", "api-v1-1.log.1", "web-v1-1.log"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(logFolder, name), []byte("output\n"), 0644))
+	}
+
+	now := time.Now()
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}, Tombstones: map[storage.StemKey]*models.Stem{
+		{Name: "api", Version: "v1"}: {Name: "api", Version: "v1", Deleted: now.Add(-2 * time.Hour),
+			LeafInstances: map[string]*models.Leaf{"api-v1-1": {ID: "api-v1-1"}}},
+		{Name: "web", Version: "v1"}: {Name: "web", Version: "v1", Deleted: now.Add(-time.Minute),
+			LeafInstances: map[string]*models.Leaf{"web-v1-1": {ID: "web-v1-1"}}},
+	}}
+	janitor := NewJanitor(repos.NewStemRepository(db), time.Hour)
+
+	// Only the tombstone past the retention is purged, with its leafs' logs
+	assert.Equal(t, []storage.StemKey{{Name: "api", Version: "v1"}}, janitor.Purge(now))
+	tombstones, err := janitor.Tombstones()
+	assert.NoError(t, err)
+	if assert.Len(t, tombstones, 1) {
+		assert.Equal(t, "web", tombstones[0].Name)
+	}
+	for name, kept := range map[string]bool{"api-v1-1.log": false, "api-v1-1.log.1": false, "web-v1-1.log": true} {
+		_, err := os.Stat(filepath.Join(logFolder, name))
+		assert.Equal(t, kept, err == nil, name)
+	}
+
+	assert.Empty(t, janitor.Purge(now))
+}
@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// In-cluster service account files, used when herbarium runs in a pod without a kubeconfig.
+const (
+	serviceAccountDir   = "/var/run/secrets/kubernetes.io/serviceaccount"
+	serviceAccountToken = serviceAccountDir + "/token"
+	serviceAccountCA    = serviceAccountDir + "/ca.crt"
+	serviceAccountNS    = serviceAccountDir + "/namespace"
+)
+
+// KubeConnection is how herbarium reaches a cluster's API server, as read from a kubeconfig context or the pod's
+// service account.
+type KubeConnection struct {
+	Server    string      // API server URL
+	Token     string      // Bearer token, empty when a client certificate is used
+	Namespace string      // Namespace of the context, empty for default
+	TLS       *tls.Config // Trusted CAs and client certificate
+}
+
+// kubeconfig is the part of a kubeconfig file herbarium understands.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// LoadKubeconfig reads the connection of a context from a kubeconfig file, the current context when context is
+// empty. Token and certificate authentication are supported; exec and auth provider plugins are not.
+func LoadKubeconfig(path, context string) (*KubeConnection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %v", err)
+	}
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig %s: %v", path, err)
+	}
+	if context == "" {
+		context = config.CurrentContext
+	}
+	// Relative file references are relative to the kubeconfig
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(filepath.Dir(path), file)
+	}
+
+	for _, named := range config.Contexts {
+		if named.Name != context {
+			continue
+		}
+		connection := &KubeConnection{Namespace: named.Context.Namespace, TLS: &tls.Config{}}
+		found := false
+		for _, cluster := range config.Clusters {
+			if cluster.Name != named.Context.Cluster {
+				continue
+			}
+			found = true
+			connection.Server = cluster.Cluster.Server
+			connection.TLS.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+			ca, err := fileOrData(resolve(cluster.Cluster.CertificateAuthority), cluster.Cluster.CertificateAuthorityData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read certificate authority of cluster %s: %v", cluster.Name, err)
+			}
+			if ca != nil {
+				connection.TLS.RootCAs = x509.NewCertPool()
+				if !connection.TLS.RootCAs.AppendCertsFromPEM(ca) {
+					return nil, fmt.Errorf("certificate authority of cluster %s holds no PEM certificate", cluster.Name)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("context %s refers to unknown cluster %s", context, named.Context.Cluster)
+		}
+		for _, user := range config.Users {
+			if user.Name != named.Context.User {
+				continue
+			}
+			connection.Token = user.User.Token
+			if user.User.TokenFile != "" {
+				token, err := os.ReadFile(resolve(user.User.TokenFile))
+				if err != nil {
+					return nil, fmt.Errorf("failed to read token of user %s: %v", user.Name, err)
+				}
+				connection.Token = strings.TrimSpace(string(token))
+			}
+			cert, err := fileOrData(resolve(user.User.ClientCertificate), user.User.ClientCertificateData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read client certificate of user %s: %v", user.Name, err)
+			}
+			key, err := fileOrData(resolve(user.User.ClientKey), user.User.ClientKeyData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read client key of user %s: %v", user.Name, err)
+			}
+			if cert != nil && key != nil {
+				pair, err := tls.X509KeyPair(cert, key)
+				if err != nil {
+					return nil, fmt.Errorf("invalid client certificate of user %s: %v", user.Name, err)
+				}
+				connection.TLS.Certificates = []tls.Certificate{pair}
+			}
+		}
+		if connection.Server == "" {
+			return nil, fmt.Errorf("cluster of context %s has no server", context)
+		}
+		return connection, nil
+	}
+	return nil, fmt.Errorf("kubeconfig %s has no context %q", path, context)
+}
+
+// InClusterConnection returns the connection of the service account of the pod herbarium runs in.
+func InClusterConnection() (*KubeConnection, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes pod: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	token, err := os.ReadFile(serviceAccountToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %v", err)
+	}
+	connection := &KubeConnection{Server: "https://" + net.JoinHostPort(host, port), Token: strings.TrimSpace(string(token)), TLS: &tls.Config{}}
+	if ca, err := os.ReadFile(serviceAccountCA); err == nil {
+		connection.TLS.RootCAs = x509.NewCertPool()
+		connection.TLS.RootCAs.AppendCertsFromPEM(ca)
+	}
+	if namespace, err := os.ReadFile(serviceAccountNS); err == nil {
+		connection.Namespace = strings.TrimSpace(string(namespace))
+	}
+	return connection, nil
+}
+
+// fileOrData returns base64 data inlined in a kubeconfig, or else the contents of file, nil when neither is set.
+func fileOrData(file, data string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
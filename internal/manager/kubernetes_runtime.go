@@ -0,0 +1,386 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// KubernetesRuntimeName is the runtime name of stems whose leafs run as pods in a Kubernetes cluster.
+const KubernetesRuntimeName = "kubernetes"
+
+// DefaultKubernetesPort is the container port of leaf pods whose stem sets none.
+const DefaultKubernetesPort = 8080
+
+// Labels and annotations herbarium puts on the leaf pods it creates.
+const (
+	KubernetesManagedByLabel = "app.kubernetes.io/managed-by"
+	KubernetesStemLabel      = "herbarium.plantarium.io/stem"
+	KubernetesVersionLabel   = "herbarium.plantarium.io/version"
+	KubernetesLeafAnnotation = "herbarium.plantarium.io/leaf-id"
+)
+
+const (
+	kubernetesLeafContainer  = "leaf"           // Name of the container running the leaf in its pod
+	kubernetesRequestTimeout = 30 * time.Second // Bounds every request to the API server
+	kubernetesMaxLabelLength = 63               // Longest label value Kubernetes allows
+	kubernetesMaxPodName     = 253              // Longest pod name Kubernetes allows
+)
+
+// kubernetesPollInterval is how often a starting leaf pod is checked for readiness.
+var kubernetesPollInterval = time.Second
+
+// invalidKubernetesNameChars matches characters Kubernetes does not allow in pod names and label values.
+var invalidKubernetesNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// KubernetesRuntime runs leafs as pods in a Kubernetes cluster, one pod per leaf named after it. The proxy
+// reaches a leaf at its pod's IP, so herbarium must run where pod IPs are routable, such as in the cluster.
+// Pods aren't restarted by Kubernetes; a leaf whose pod failed is replaced by herbarium like any dead leaf.
+type KubernetesRuntime struct {
+	client    *resty.Client
+	namespace string
+	behavior  leafBehavior // Readiness and stop settings of the stem, defaults without a stem
+}
+
+// kubePod is the part of a Kubernetes pod herbarium sets and reads.
+type kubePod struct {
+	APIVersion string      `json:"apiVersion,omitempty"`
+	Kind       string      `json:"kind,omitempty"`
+	Metadata   kubeMeta    `json:"metadata"`
+	Spec       kubePodSpec `json:"spec"`
+	Status     struct {
+		Phase      string `json:"phase,omitempty"`
+		PodIP      string `json:"podIP,omitempty"`
+		Reason     string `json:"reason,omitempty"`
+		Message    string `json:"message,omitempty"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+type kubeMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type kubePodSpec struct {
+	Containers                    []kubeContainer     `json:"containers"`
+	RestartPolicy                 string              `json:"restartPolicy,omitempty"`
+	TerminationGracePeriodSeconds *int64              `json:"terminationGracePeriodSeconds,omitempty"`
+	ServiceAccountName            string              `json:"serviceAccountName,omitempty"`
+	NodeSelector                  map[string]string   `json:"nodeSelector,omitempty"`
+	ImagePullSecrets              []map[string]string `json:"imagePullSecrets,omitempty"`
+}
+
+type kubeContainer struct {
+	Name           string           `json:"name"`
+	Image          string           `json:"image"`
+	Command        []string         `json:"command,omitempty"`
+	Env            []kubeEnvVar     `json:"env,omitempty"`
+	Ports          []map[string]int `json:"ports,omitempty"`
+	Resources      *kubeResources   `json:"resources,omitempty"`
+	ReadinessProbe map[string]any   `json:"readinessProbe,omitempty"`
+}
+
+type kubeEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type kubeResources struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+// NewKubernetesRuntime creates a runtime starting leaf pods in namespace through the API server of connection.
+// namespace defaults to the connection's namespace, and to default without one.
+func NewKubernetesRuntime(connection *KubeConnection, namespace string) (*KubernetesRuntime, error) {
+	parsed, err := url.Parse(connection.Server)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid Kubernetes API server %q", connection.Server)
+	}
+	if namespace == "" {
+		namespace = connection.Namespace
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	client := resty.New()
+	client.SetBaseURL(strings.TrimSuffix(connection.Server, "/"))
+	if connection.Token != "" {
+		client.SetAuthToken(connection.Token)
+	}
+	if connection.TLS != nil {
+		client.SetTLSClientConfig(connection.TLS)
+	}
+	client.SetHeader("Content-Type", "application/json")
+	client.SetHeader("Accept", "application/json")
+	client.SetTimeout(kubernetesRequestTimeout)
+	client.SetDisableWarn(true)
+
+	return &KubernetesRuntime{client: client, namespace: namespace, behavior: behaviorOf(nil)}, nil
+}
+
+// NewKubernetesRuntimeFromConfig creates the runtime configured by the kubernetes section of the global config,
+// nil when it configures no cluster.
+func NewKubernetesRuntimeFromConfig(config *models.GlobalConfig) (*KubernetesRuntime, error) {
+	var connection *KubeConnection
+	var err error
+	switch {
+	case config.Kubernetes.InCluster:
+		connection, err = InClusterConnection()
+	case config.Kubernetes.Kubeconfig != "":
+		connection, err = LoadKubeconfig(config.Kubernetes.Kubeconfig, config.Kubernetes.Context)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKubernetesRuntime(connection, config.Kubernetes.Namespace)
+}
+
+// forStem returns the runtime with the readiness and stop settings of a stem.
+func (k *KubernetesRuntime) forStem(config *models.StemConfig) *KubernetesRuntime {
+	stemRuntime := *k
+	stemRuntime.behavior = behaviorOf(config)
+	return &stemRuntime
+}
+
+// Host returns the API server's host. Leafs are reached at their pod's IP, which StartLeaf reports.
+func (k *KubernetesRuntime) Host() string {
+	parsed, _ := url.Parse(k.client.BaseURL)
+	return parsed.Hostname()
+}
+
+// StartLeaf creates a pod for the leaf and waits until it is ready, deleting it when it fails or doesn't become
+// ready within ServiceStartupTimeout.
+func (k *KubernetesRuntime) StartLeaf(request AgentStartRequest) (*AgentLeaf, error) {
+	pod, err := k.leafPod(request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.R().SetBody(pod).Post(k.podsPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Kubernetes API server: %v", err)
+	}
+	if resp.StatusCode() != http.StatusCreated {
+		return nil, fmt.Errorf("kubernetes failed to create pod %s, status code: %d, response: %s", pod.Metadata.Name, resp.StatusCode(), resp.String())
+	}
+	log.Printf("Created pod %s/%s for leaf %s", k.namespace, pod.Metadata.Name, request.LeafID)
+
+	port := pod.Spec.Containers[0].Ports[0]["containerPort"]
+	deadline := time.Now().Add(ServiceStartupTimeout)
+	for {
+		current, err := k.pod(request.LeafID)
+		switch {
+		case err != nil:
+			log.Printf("Failed to check pod %s of starting leaf %s: %v", pod.Metadata.Name, request.LeafID, err)
+		case ready(current) && current.Status.PodIP != "":
+			return &AgentLeaf{ID: request.LeafID, Port: port, Host: current.Status.PodIP, Alive: true}, nil
+		case current.Status.Phase == "Failed" || current.Status.Phase == "Succeeded":
+			return nil, k.abandonLeaf(request.LeafID, fmt.Errorf("pod %s exited with phase %s: %s",
+				pod.Metadata.Name, current.Status.Phase, strings.TrimSpace(current.Status.Reason+" "+current.Status.Message)))
+		}
+		if time.Now().After(deadline) {
+			return nil, k.abandonLeaf(request.LeafID, fmt.Errorf("pod %s was not ready within %s", pod.Metadata.Name, ServiceStartupTimeout))
+		}
+		time.Sleep(kubernetesPollInterval)
+	}
+}
+
+// abandonLeaf deletes the pod of a leaf that failed to start and returns the failure.
+func (k *KubernetesRuntime) abandonLeaf(leafID string, err error) error {
+	if stopErr := k.StopLeaf(leafID); stopErr != nil {
+		log.Printf("Failed to delete pod of leaf %s after its start failed: %v", leafID, stopErr)
+	}
+	return err
+}
+
+// StopLeaf deletes the pod of a leaf, giving it the stem's stop timeout to shut down. A leaf without a pod is
+// considered stopped.
+func (k *KubernetesRuntime) StopLeaf(leafID string) error {
+	grace := strconv.FormatInt(int64(k.behavior.stopTimeout/time.Second), 10)
+	resp, err := k.client.R().SetQueryParam("gracePeriodSeconds", grace).Delete(k.podsPath() + "/" + kubernetesPodName(leafID))
+	if err != nil {
+		return fmt.Errorf("failed to reach Kubernetes API server: %v", err)
+	}
+	if !resp.IsSuccess() && resp.StatusCode() != http.StatusNotFound {
+		return fmt.Errorf("kubernetes failed to delete pod, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+	return nil
+}
+
+// GetLeaf reports whether the pod of a leaf is running and ready.
+func (k *KubernetesRuntime) GetLeaf(leafID string) (*AgentLeaf, error) {
+	pod, err := k.pod(leafID)
+	if err != nil {
+		return nil, err
+	}
+	leaf := &AgentLeaf{ID: leafID, Host: pod.Status.PodIP, Alive: pod.Status.Phase == "Running" && ready(pod)}
+	if containers := pod.Spec.Containers; len(containers) > 0 && len(containers[0].Ports) > 0 {
+		leaf.Port = containers[0].Ports[0]["containerPort"]
+	}
+	return leaf, nil
+}
+
+// ReadLeafLogs returns the log of a leaf's container. Only TailLines is supported; the API server keeps no byte
+// offsets into rotated logs.
+func (k *KubernetesRuntime) ReadLeafLogs(leafID string, opts LogReadOptions) ([]byte, error) {
+	request := k.client.R().SetHeader("Accept", "text/plain").SetQueryParam("container", kubernetesLeafContainer)
+	if opts.TailLines > 0 {
+		request.SetQueryParam("tailLines", strconv.Itoa(opts.TailLines))
+	}
+	if opts.Length > 0 {
+		request.SetQueryParam("limitBytes", strconv.FormatInt(opts.Length, 10))
+	}
+	resp, err := request.Get(k.podsPath() + "/" + kubernetesPodName(leafID) + "/log")
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Kubernetes API server: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("kubernetes failed to read pod logs, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+	return resp.Body(), nil
+}
+
+// pod fetches the pod of a leaf.
+func (k *KubernetesRuntime) pod(leafID string) (*kubePod, error) {
+	var pod kubePod
+	resp, err := k.client.R().SetResult(&pod).Get(k.podsPath() + "/" + kubernetesPodName(leafID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Kubernetes API server: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("kubernetes failed to report pod, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+	return &pod, nil
+}
+
+// podsPath returns the API path of the pods in the runtime's namespace.
+func (k *KubernetesRuntime) podsPath() string {
+	return "/api/v1/namespaces/" + url.PathEscape(k.namespace) + "/pods"
+}
+
+// leafPod maps the stem config of a leaf to its pod: the stem's env, with PORT set to the container port, and
+// its command, run by sh in the container when set. Readiness is checked on the port, at the stem's health
+// path if it has one, and the pod gets the stem's stop timeout to shut down.
+func (k *KubernetesRuntime) leafPod(request AgentStartRequest) (*kubePod, error) {
+	config := request.Config
+	if config.Kubernetes == nil || config.Kubernetes.Image == "" {
+		return nil, fmt.Errorf("stem %s has no kubernetes image", request.StemName)
+	}
+	spec := config.Kubernetes
+	port := spec.Port
+	if port == 0 {
+		port = DefaultKubernetesPort
+	}
+
+	container := kubeContainer{
+		Name:  kubernetesLeafContainer,
+		Image: spec.Image,
+		Ports: []map[string]int{{"containerPort": port}},
+		Env:   []kubeEnvVar{{Name: "PORT", Value: strconv.Itoa(port)}},
+	}
+	if strings.TrimSpace(config.Command) != "" {
+		command, err := prepareCommandWithTemplate(config.Command, map[string]interface{}{"PORT": port})
+		if err != nil {
+			return nil, err
+		}
+		container.Command = []string{"/bin/sh", "-c", command}
+	}
+	names := make([]string, 0, len(config.Env))
+	for name := range config.Env {
+		if name != "PORT" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		container.Env = append(container.Env, kubeEnvVar{Name: name, Value: config.Env[name]})
+	}
+	if spec.CPU != "" || spec.Memory != "" {
+		resources := map[string]string{}
+		if spec.CPU != "" {
+			resources["cpu"] = spec.CPU
+		}
+		if spec.Memory != "" {
+			resources["memory"] = spec.Memory
+		}
+		container.Resources = &kubeResources{Requests: resources, Limits: resources}
+	}
+	if k.behavior.healthPath != "" {
+		container.ReadinessProbe = map[string]any{"httpGet": map[string]any{"path": k.behavior.healthPath, "port": port}, "periodSeconds": 1}
+	} else {
+		container.ReadinessProbe = map[string]any{"tcpSocket": map[string]any{"port": port}, "periodSeconds": 1}
+	}
+
+	grace := int64(k.behavior.stopTimeout / time.Second)
+	pod := &kubePod{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata: kubeMeta{
+			Name:      kubernetesPodName(request.LeafID),
+			Namespace: k.namespace,
+			Labels: map[string]string{
+				KubernetesManagedByLabel: "herbarium",
+				KubernetesStemLabel:      kubernetesLabelValue(request.StemName),
+				KubernetesVersionLabel:   kubernetesLabelValue(request.Version),
+			},
+			Annotations: map[string]string{KubernetesLeafAnnotation: request.LeafID},
+		},
+		Spec: kubePodSpec{
+			Containers:                    []kubeContainer{container},
+			RestartPolicy:                 "Never",
+			TerminationGracePeriodSeconds: &grace,
+			ServiceAccountName:            spec.ServiceAccount,
+			NodeSelector:                  spec.NodeSelector,
+		},
+	}
+	for _, secret := range spec.ImagePullSecrets {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, map[string]string{"name": secret})
+	}
+	return pod, nil
+}
+
+// ready reports whether a pod's Ready condition is true.
+func ready(pod *kubePod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == "Ready" {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
+
+// kubernetesPodName returns the name of the pod of a leaf, its ID made a valid DNS subdomain.
+func kubernetesPodName(leafID string) string {
+	name := strings.Trim(invalidKubernetesNameChars.ReplaceAllString(strings.ToLower(leafID), "-"), "-.")
+	if len(name) > kubernetesMaxPodName {
+		name = strings.TrimRight(name[:kubernetesMaxPodName], "-.")
+	}
+	return name
+}
+
+// kubernetesLabelValue returns value made a valid label value.
+func kubernetesLabelValue(value string) string {
+	value = strings.Trim(invalidKubernetesNameChars.ReplaceAllString(strings.ToLower(value), "-"), "-.")
+	if len(value) > kubernetesMaxLabelLength {
+		value = strings.TrimRight(value[:kubernetesMaxLabelLength], "-.")
+	}
+	return value
+}
@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKubernetes is an API server keeping pods in memory, which become ready on the second check.
+type fakeKubernetes struct {
+	mu      sync.Mutex
+	pods    map[string]map[string]any
+	checks  map[string]int
+	deletes []string
+	fail    bool // Whether created pods fail instead of becoming ready
+}
+
+func (f *fakeKubernetes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	const prefix = "/api/v1/namespaces/leafs/pods"
+	if r.Header.Get("Authorization") != "Bearer cluster-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == prefix:
+		var pod map[string]any
+		json.NewDecoder(r.Body).Decode(&pod)
+		name := pod["metadata"].(map[string]any)["name"].(string)
+		f.pods[name] = pod
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(pod)
+	case r.Method == http.MethodGet && filepath.Dir(r.URL.Path) == prefix:
+		name := filepath.Base(r.URL.Path)
+		pod, ok := f.pods[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.checks[name]++
+		status := map[string]any{"phase": "Pending"}
+		switch {
+		case f.fail:
+			status = map[string]any{"phase": "Failed", "reason": "Error"}
+		case f.checks[name] > 1:
+			status = map[string]any{"phase": "Running", "podIP": "10.244.1.7",
+				"conditions": []map[string]string{{"type": "Ready", "status": "True"}}}
+		}
+		pod["status"] = status
+		json.NewEncoder(w).Encode(pod)
+	case r.Method == http.MethodDelete && filepath.Dir(r.URL.Path) == prefix:
+		name := filepath.Base(r.URL.Path)
+		f.deletes = append(f.deletes, name+"?"+r.URL.RawQuery)
+		delete(f.pods, name)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestKubernetesRuntime(t *testing.T) {
+	pollInterval := kubernetesPollInterval
+	kubernetesPollInterval = time.Millisecond
+	defer func() { kubernetesPollInterval = pollInterval }()
+
+	cluster := &fakeKubernetes{pods: map[string]map[string]any{}, checks: map[string]int{}}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+
+	kubernetes, err := NewKubernetesRuntime(&KubeConnection{Server: server.URL, Token: "cluster-token", Namespace: "leafs"}, "")
+	assert.NoError(t, err)
+	config := &models.StemConfig{Name: "Billing_API", Version: "v2", Command: "./billing --port {{.PORT}}", HealthPath: "/health",
+		StopTimeout: "20s", Env: map[string]string{"LOG_LEVEL": "info", "PORT": "1"},
+		Kubernetes: &models.KubernetesConfig{Image: "registry.internal/billing:2", Port: 9000, Memory: "256Mi",
+			ImagePullSecrets: []string{"registry"}}}
+	runtime, err := remoteRuntime(map[string]LeafRuntime{KubernetesRuntimeName: kubernetes}, config, KubernetesRuntimeName)
+	assert.NoError(t, err)
+
+	// The leaf is reached at the IP of its ready pod
+	leaf, err := runtime.StartLeaf(AgentStartRequest{StemName: "Billing_API", Version: "v2", LeafID: "Billing_API-v2-1", Config: *config})
+	assert.NoError(t, err)
+	assert.Equal(t, &AgentLeaf{ID: "Billing_API-v2-1", Port: 9000, Host: "10.244.1.7", Alive: true}, leaf)
+
+	pod := cluster.pods["billing-api-v2-1"]
+	if assert.NotNil(t, pod) {
+		metadata := pod["metadata"].(map[string]any)
+		assert.Equal(t, map[string]any{KubernetesManagedByLabel: "herbarium", KubernetesStemLabel: "billing-api", KubernetesVersionLabel: "v2"}, metadata["labels"])
+		assert.Equal(t, map[string]any{KubernetesLeafAnnotation: "Billing_API-v2-1"}, metadata["annotations"])
+		spec := pod["spec"].(map[string]any)
+		assert.Equal(t, "Never", spec["restartPolicy"])
+		assert.Equal(t, float64(20), spec["terminationGracePeriodSeconds"])
+		assert.Equal(t, []any{map[string]any{"name": "registry"}}, spec["imagePullSecrets"])
+		container := spec["containers"].([]any)[0].(map[string]any)
+		assert.Equal(t, "registry.internal/billing:2", container["image"])
+		assert.Equal(t, []any{"/bin/sh", "-c", "./billing --port 9000"}, container["command"])
+		assert.Equal(t, []any{
+			map[string]any{"name": "PORT", "value": "9000"},
+			map[string]any{"name": "LOG_LEVEL", "value": "info"},
+		}, container["env"])
+		assert.Equal(t, map[string]any{"requests": map[string]any{"memory": "256Mi"}, "limits": map[string]any{"memory": "256Mi"}}, container["resources"])
+		assert.Equal(t, map[string]any{"path": "/health", "port": float64(9000)}, container["readinessProbe"].(map[string]any)["httpGet"])
+	}
+
+	remote, err := runtime.GetLeaf("Billing_API-v2-1")
+	assert.NoError(t, err)
+	assert.True(t, remote.Alive)
+
+	assert.NoError(t, runtime.StopLeaf("Billing_API-v2-1"))
+	assert.NoError(t, runtime.StopLeaf("Billing_API-v2-1"), "a leaf without a pod is stopped")
+	assert.Equal(t, []string{"billing-api-v2-1?gracePeriodSeconds=20"}, cluster.deletes[:1])
+
+	// A pod that fails is deleted and fails the start
+	cluster.fail = true
+	_, err = runtime.StartLeaf(AgentStartRequest{StemName: "Billing_API", Version: "v2", LeafID: "Billing_API-v2-2", Config: *config})
+	assert.ErrorContains(t, err, "pod billing-api-v2-2 exited with phase Failed: Error")
+	assert.NotContains(t, cluster.pods, "billing-api-v2-2")
+
+	// Without a configured cluster, stems with kubernetes have no runtime
+	_, err = remoteRuntime(nil, config, KubernetesRuntimeName)
+	assert.ErrorContains(t, err, "no kubernetes cluster is configured")
+}
+
+func TestLoadKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("file-token\n"), 0600))
+	path := filepath.Join(dir, "config")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+current-context: dev
+clusters:
+  - name: dev-cluster
+    cluster:
+      server: https://dev.k8s.internal:6443
+      insecure-skip-tls-verify: true
+  - name: prod-cluster
+    cluster:
+      server: https://prod.k8s.internal:6443
+users:
+  - name: dev-user
+    user:
+      token: dev-token
+  - name: prod-user
+    user:
+      tokenFile: token
+contexts:
+  - name: dev
+    context: {cluster: dev-cluster, user: dev-user, namespace: herbarium}
+  - name: prod
+    context: {cluster: prod-cluster, user: prod-user}
+`), 0600))
+
+	dev, err := LoadKubeconfig(path, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dev.k8s.internal:6443", dev.Server)
+	assert.Equal(t, "dev-token", dev.Token)
+	assert.Equal(t, "herbarium", dev.Namespace)
+	assert.True(t, dev.TLS.InsecureSkipVerify)
+
+	// Token files are relative to the kubeconfig
+	prod, err := LoadKubeconfig(path, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://prod.k8s.internal:6443", prod.Server)
+	assert.Equal(t, "file-token", prod.Token)
+
+	_, err = LoadKubeconfig(path, "staging")
+	assert.ErrorContains(t, err, `has no context "staging"`)
+}
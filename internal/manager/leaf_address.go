@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"net"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// withAddressDefaults returns config with the manager's bind and advertise addresses filled in where the stem
+// leaves them empty. The stem's own config is not modified.
+func (l *LeafManager) withAddressDefaults(config *models.StemConfig) *models.StemConfig {
+	if config == nil || l.BindAddress == "" && l.AdvertiseAddress == "" {
+		return config
+	}
+	resolved := *config
+	if resolved.BindAddress == "" {
+		resolved.BindAddress = l.BindAddress
+	}
+	if resolved.AdvertiseAddress == "" {
+		resolved.AdvertiseAddress = l.AdvertiseAddress
+	}
+	return &resolved
+}
+
+// bindHost returns the interface a stem's local leafs listen on.
+func bindHost(config *models.StemConfig) string {
+	if config != nil && config.BindAddress != "" {
+		return config.BindAddress
+	}
+	return localLeafHost(config)
+}
+
+// advertisedHost returns the address the proxy reaches a stem's local leafs at: the advertise address,
+// else a specific bind address, else the loopback address.
+func advertisedHost(config *models.StemConfig) string {
+	if config != nil && config.AdvertiseAddress != "" {
+		return config.AdvertiseAddress
+	}
+	if config != nil && config.BindAddress != "" && !wildcardAddress(config.BindAddress) {
+		return config.BindAddress
+	}
+	return localLeafHost(config)
+}
+
+// readinessHosts returns the addresses a local leaf must be ready at. Leafs bound to a specific interface
+// are only reachable there, those bound to all interfaces are checked on loopback.
+func readinessHosts(config *models.StemConfig) []string {
+	if config != nil && config.BindAddress != "" && !wildcardAddress(config.BindAddress) {
+		return []string{config.BindAddress}
+	}
+	return loopbackHosts(config)
+}
+
+// wildcardAddress reports whether address stands for all interfaces, such as 0.0.0.0 or ::.
+func wildcardAddress(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsUnspecified()
+}
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeafAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    models.StemConfig
+		bind      string
+		advertise string
+		ready     []string
+	}{
+		{"defaults", models.StemConfig{}, "localhost", "localhost", []string{"localhost"}},
+		{"ip family", models.StemConfig{IPFamily: IPFamilyIPv6}, "::1", "::1", []string{"::1"}},
+		{"specific interface", models.StemConfig{BindAddress: "10.0.0.5"}, "10.0.0.5", "10.0.0.5", []string{"10.0.0.5"}},
+		{"all interfaces", models.StemConfig{BindAddress: "0.0.0.0"}, "0.0.0.0", "localhost", []string{"localhost"}},
+		{"all interfaces, dual-stack", models.StemConfig{BindAddress: "::", IPFamily: IPFamilyDual}, "::", "127.0.0.1", []string{"127.0.0.1", "::1"}},
+		{"advertised", models.StemConfig{BindAddress: "0.0.0.0", AdvertiseAddress: "app-1.internal"}, "0.0.0.0", "app-1.internal", []string{"localhost"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.bind, bindHost(&test.config))
+			assert.Equal(t, test.advertise, advertisedHost(&test.config))
+			assert.Equal(t, test.ready, readinessHosts(&test.config))
+		})
+	}
+}
+
+func TestLeafManager_WithAddressDefaults(t *testing.T) {
+	leafManager := &LeafManager{}
+	config := &models.StemConfig{Name: "billing"}
+	assert.Same(t, config, leafManager.withAddressDefaults(config), "without defaults the config is used as is")
+
+	// Stems override the manager's defaults, which fill in the rest without touching the stem
+	leafManager.BindAddress, leafManager.AdvertiseAddress = "0.0.0.0", "app-1.internal"
+	config.BindAddress = "10.0.0.5"
+	resolved := leafManager.withAddressDefaults(config)
+	assert.Equal(t, "10.0.0.5", resolved.BindAddress)
+	assert.Equal(t, "app-1.internal", resolved.AdvertiseAddress)
+	assert.Empty(t, config.AdvertiseAddress)
+}
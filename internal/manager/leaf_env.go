@@ -0,0 +1,24 @@
+package manager
+
+import (
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// withEnvDefaults returns config with the manager's default environment variables merged beneath the stem's
+// own: Env first, then TypeEnv for the stem's type, then the stem's env, each overriding the previous one. The
+// stem's own config is not modified.
+func (l *LeafManager) withEnvDefaults(stemType models.StemType, config *models.StemConfig) *models.StemConfig {
+	typeEnv := l.TypeEnv[stemType]
+	if config == nil || len(l.Env) == 0 && len(typeEnv) == 0 {
+		return config
+	}
+	env := make(map[string]string, len(l.Env)+len(typeEnv)+len(config.Env))
+	for _, layer := range []map[string]string{l.Env, typeEnv, config.Env} {
+		for name, value := range layer {
+			env[name] = value
+		}
+	}
+	resolved := *config
+	resolved.Env = env
+	return &resolved
+}
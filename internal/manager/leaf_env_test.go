@@ -0,0 +1,27 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeafManager_WithEnvDefaults(t *testing.T) {
+	leafManager := &LeafManager{}
+	config := &models.StemConfig{Name: "billing", Env: map[string]string{"REGION": "us-east"}}
+	assert.Same(t, config, leafManager.withEnvDefaults(models.StemTypeDeployment, config), "without defaults the config is used as is")
+
+	// The stem's env wins over its type's defaults, which win over the platform-wide ones
+	leafManager.Env = map[string]string{"HTTP_PROXY": "http://proxy:3128", "REGION": "eu-west", "LOG_LEVEL": "info"}
+	leafManager.TypeEnv = map[models.StemType]map[string]string{
+		models.StemTypeSystem:     {"LOG_LEVEL": "warn"},
+		models.StemTypeDeployment: {"LOG_LEVEL": "debug"},
+	}
+	resolved := leafManager.withEnvDefaults(models.StemTypeDeployment, config)
+	assert.Equal(t, map[string]string{"HTTP_PROXY": "http://proxy:3128", "REGION": "us-east", "LOG_LEVEL": "debug"}, resolved.Env)
+	assert.Equal(t, map[string]string{"REGION": "us-east"}, config.Env)
+
+	resolved = leafManager.withEnvDefaults(models.StemTypeSystem, &models.StemConfig{Name: "postgres"})
+	assert.Equal(t, map[string]string{"HTTP_PROXY": "http://proxy:3128", "REGION": "eu-west", "LOG_LEVEL": "warn"}, resolved.Env)
+}
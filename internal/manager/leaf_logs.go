@@ -0,0 +1,318 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// MaxLogReadBytes caps how much log data a single ReadLeafLogs call returns.
+const MaxLogReadBytes = 4 << 20
+
+// logReadChunkSize is the block size used when scanning log files backwards for tail reads.
+const logReadChunkSize = 64 << 10
+
+// LogReadOptions selects which part of a leaf's log history ReadLeafLogs returns.
+// TailLines takes precedence over the byte range when both are set.
+type LogReadOptions struct {
+	TailLines int   // Return only the last N lines
+	Offset    int64 // Byte offset into the concatenated log history (oldest segment first)
+	Length    int64 // Number of bytes to return from Offset, 0 means up to MaxLogReadBytes
+}
+
+// ReadLeafLogs returns part of a leaf's log history, including rotated segments (<leafID>.log.N,
+// where higher N is older). The leaf does not need to be running, so logs of stopped leafs
+// remain readable as long as their files exist.
+func (l *LeafManager) ReadLeafLogs(key storage.StemKey, leafID string, opts LogReadOptions) ([]byte, error) {
+	if err := l.validateLogLeafID(key, leafID); err != nil {
+		return nil, err
+	}
+
+	// Logs of leafs run by an agent or over SSH stay on the remote host
+	if leaf, err := l.LeafRepo.FindLeafByID(key, leafID); err == nil && leaf.Agent != "" {
+		stem, err := l.StemRepo.FetchStem(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find stem %s: %v", key, err)
+		}
+		runtime, err := remoteRuntime(l.Agents, stem.Config, leaf.Agent)
+		if err != nil {
+			return nil, fmt.Errorf("leaf %s runs on an unavailable runtime: %v", leafID, err)
+		}
+		return runtime.ReadLeafLogs(leafID, opts)
+	}
+
+	return ReadLeafLogFiles(leafID, opts)
+}
+
+// ReadLeafLogFiles returns part of the log history a leaf left in the local log folder. Unlike ReadLeafLogs,
+// it does not check that the leaf belongs to a stem; callers must ensure leafID names a single file.
+func ReadLeafLogFiles(leafID string, opts LogReadOptions) ([]byte, error) {
+	segments, err := leafLogSegments(getLogFolder(), leafID)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.TailLines > 0 {
+		return tailLogSegments(segments, opts.TailLines)
+	}
+	return readLogRange(segments, opts.Offset, opts.Length)
+}
+
+// validateLogLeafID ensures leafID names a single file and belongs to the stem, either as a current leaf
+// or graft node, or, for stopped leafs, by the owner recorded next to its logs when it started. Leaf IDs
+// are not parsed: names and versions may contain dashes, so an ID prefix can match more than one stem.
+func (l *LeafManager) validateLogLeafID(key storage.StemKey, leafID string) error {
+	if leafID == "" || leafID == "." || leafID == ".." || strings.ContainsAny(leafID, `/\`) {
+		return fmt.Errorf("invalid leaf ID %q", leafID)
+	}
+	if _, err := l.LeafRepo.FindLeafByID(key, leafID); err == nil {
+		return nil
+	}
+	if graftNode, err := l.LeafRepo.GetGraftNode(key); err == nil && graftNode != nil && graftNode.ID == leafID {
+		return nil
+	}
+	if owner, err := leafOwner(getLogFolder(), leafID); err == nil && owner == key {
+		return nil
+	}
+	return fmt.Errorf("leaf %s does not belong to stem %s version %s: %w", leafID, key.Name, key.Version, os.ErrNotExist)
+}
+
+// leafOwnerSuffix is appended to a leaf ID to name the file recording the stem version the leaf's logs
+// belong to, so the logs of stopped leafs stay readable through that stem, and only through it.
+const leafOwnerSuffix = ".owner"
+
+// recordLeafOwner records in the log folder that the logs of a leaf belong to the stem version key.
+func recordLeafOwner(logFolder, leafID string, key storage.StemKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(logFolder, leafID+leafOwnerSuffix), data, 0644)
+}
+
+// leafOwner returns the stem version recorded as the owner of a leaf's logs.
+func leafOwner(logFolder, leafID string) (storage.StemKey, error) {
+	var key storage.StemKey
+	data, err := os.ReadFile(filepath.Join(logFolder, leafID+leafOwnerSuffix))
+	if err != nil {
+		return key, err
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return key, fmt.Errorf("invalid owner of leaf %s: %v", leafID, err)
+	}
+	return key, nil
+}
+
+// LeafLogSize returns the total size of the log history a leaf left in the local log folder.
+func LeafLogSize(leafID string) (int64, error) {
+	segments, err := leafLogSegments(getLogFolder(), leafID)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, path := range segments {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat log segment %s: %v", path, err)
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// leafLogSegments lists the log files of a leaf ordered from oldest to newest.
+func leafLogSegments(logFolder, leafID string) ([]string, error) {
+	current := filepath.Join(logFolder, leafID+".log")
+
+	rotated, err := filepath.Glob(filepath.Join(logFolder, leafID+".log.*"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated logs for leaf %s: %v", leafID, err)
+	}
+
+	type segment struct {
+		path  string
+		index int
+	}
+	var numbered []segment
+	for _, path := range rotated {
+		index, err := strconv.Atoi(strings.TrimPrefix(path, current+"."))
+		if err != nil {
+			continue // Not a numbered rotation (e.g. compressed archives)
+		}
+		numbered = append(numbered, segment{path: path, index: index})
+	}
+	sort.Slice(numbered, func(i, j int) bool {
+		return numbered[i].index > numbered[j].index
+	})
+
+	segments := make([]string, 0, len(numbered)+1)
+	for _, s := range numbered {
+		segments = append(segments, s.path)
+	}
+	if _, err := os.Stat(current); err == nil {
+		segments = append(segments, current)
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("no logs found for leaf %s: %w", leafID, os.ErrNotExist)
+	}
+	return segments, nil
+}
+
+// tailLogSegments returns the last n lines across the segments, reading backwards from the newest.
+func tailLogSegments(segments []string, n int) ([]byte, error) {
+	var collected []byte
+	lines := 0
+
+	for i := len(segments) - 1; i >= 0 && lines <= n && len(collected) < MaxLogReadBytes; i-- {
+		file, err := os.Open(segments[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log segment %s: %v", segments[i], err)
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to stat log segment %s: %v", segments[i], err)
+		}
+
+		pos := info.Size()
+		for pos > 0 && lines <= n && len(collected) < MaxLogReadBytes {
+			size := int64(logReadChunkSize)
+			if pos < size {
+				size = pos
+			}
+			pos -= size
+
+			chunk := make([]byte, size)
+			if _, err := file.ReadAt(chunk, pos); err != nil && !errors.Is(err, io.EOF) {
+				file.Close()
+				return nil, fmt.Errorf("failed to read log segment %s: %v", segments[i], err)
+			}
+			collected = append(chunk, collected...)
+			lines = bytes.Count(collected, []byte("\n"))
+		}
+		file.Close()
+	}
+
+	// Drop a trailing newline so it doesn't count as an empty last line, then keep the last n lines
+	trimmed := bytes.TrimSuffix(collected, []byte("\n"))
+	for count := 0; ; {
+		idx := bytes.LastIndexByte(trimmed, '\n')
+		if idx < 0 {
+			break
+		}
+		count++
+		if count == n {
+			return collected[idx+1:], nil
+		}
+		trimmed = trimmed[:idx]
+	}
+	return collected, nil
+}
+
+// readLogRange returns length bytes starting at offset of the concatenated segments.
+func readLogRange(segments []string, offset, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("offset and length must not be negative")
+	}
+	if length == 0 || length > MaxLogReadBytes {
+		length = MaxLogReadBytes
+	}
+
+	var buf bytes.Buffer
+	for _, path := range segments {
+		if int64(buf.Len()) >= length {
+			break
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat log segment %s: %v", path, err)
+		}
+		if offset >= info.Size() {
+			offset -= info.Size()
+			continue
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log segment %s: %v", path, err)
+		}
+		_, err = io.Copy(&buf, io.LimitReader(io.NewSectionReader(file, offset, info.Size()-offset), length-int64(buf.Len())))
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log segment %s: %v", path, err)
+		}
+		offset = 0
+	}
+	return buf.Bytes(), nil
+}
+
+// logTimestampLayouts are the leading timestamps LogSinceFilter recognizes. Fractional seconds are accepted
+// after the seconds of every layout.
+var logTimestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006/01/02 15:04:05", "2006-01-02T15:04:05"}
+
+// LogSinceFilter drops log lines written before Since. Leafs write their output as is, so a line is dated by
+// the timestamp it starts with; lines without one, such as stack traces, follow the line before them. The
+// filter keeps its state between calls, so it can be fed a log in chunks that split lines.
+type LogSinceFilter struct {
+	Since time.Time
+
+	drop    bool // Whether the current line is dropped
+	midLine bool // Whether the last chunk ended inside a line
+}
+
+// Filter returns the lines of data written at or after Since.
+func (f *LogSinceFilter) Filter(data []byte) []byte {
+	var kept []byte
+	for len(data) > 0 {
+		line := data
+		if end := bytes.IndexByte(data, '\n'); end >= 0 {
+			line = data[:end+1]
+		}
+		if !f.midLine {
+			if written, ok := leadingTimestamp(line); ok {
+				f.drop = written.Before(f.Since)
+			}
+		}
+		if !f.drop {
+			kept = append(kept, line...)
+		}
+		f.midLine = line[len(line)-1] != '\n'
+		data = data[len(line):]
+	}
+	return kept
+}
+
+// leadingTimestamp parses the timestamp a log line starts with, optionally in square brackets. Timestamps
+// without a zone are taken as local time.
+func leadingTimestamp(line []byte) (time.Time, bool) {
+	text := strings.TrimPrefix(string(line), "[")
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return time.Time{}, false
+	}
+	candidates := []string{strings.TrimSuffix(fields[0], "]")}
+	if len(fields) > 1 {
+		candidates = append(candidates, fields[0]+" "+strings.TrimSuffix(fields[1], "]"))
+	}
+	for _, candidate := range candidates {
+		for _, layout := range logTimestampLayouts {
+			if written, err := time.ParseInLocation(layout, candidate, time.Local); err == nil {
+				return written, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
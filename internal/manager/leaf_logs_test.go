@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeafManager_ReadLeafLogs(t *testing.T) {
+	tempLogDir := t.TempDir()
+	err := os.Setenv("PLANTARIUM_LOG_FOLDER", tempLogDir)
+	assert.NoError(t, err, "failed to set PLANTARIUM_LOG_FOLDER environment variable")
+	defer os.Unsetenv("PLANTARIUM_LOG_FOLDER")
+
+	leafStorage := storage.GetTestStorage()
+	leafManager := NewLeafManager(repos.NewLeafRepository(leafStorage), new(MockProxyClient), repos.NewStemRepository(leafStorage))
+
+	stemKey := storage.StemKey{Name: "system-service", Version: "1.0.0"}
+	leafID := "system-service-1.0.0-1672574400000000000"
+
+	// Two rotated segments (higher index is older) and the current log
+	writeLog := func(name, content string) {
+		err := os.WriteFile(filepath.Join(tempLogDir, name), []byte(content), 0644)
+		assert.NoError(t, err, "failed to write log segment %s", name)
+	}
+	writeLog(leafID+".log.2", "line 1\nline 2\n")
+	writeLog(leafID+".log.1", "line 3\nline 4\n")
+	writeLog(leafID+".log", "line 5\nline 6\n")
+	writeLog(leafID+".log.3.gz", "ignored")
+	assert.NoError(t, recordLeafOwner(tempLogDir, leafID, stemKey))
+
+	// Tail spans segments
+	data, err := leafManager.ReadLeafLogs(stemKey, leafID, LogReadOptions{TailLines: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, "line 4\nline 5\nline 6\n", string(data))
+
+	// Tail larger than history returns everything
+	data, err = leafManager.ReadLeafLogs(stemKey, leafID, LogReadOptions{TailLines: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\n", string(data))
+
+	// Byte range across segment boundary
+	data, err = leafManager.ReadLeafLogs(stemKey, leafID, LogReadOptions{Offset: 7, Length: 14})
+	assert.NoError(t, err)
+	assert.Equal(t, "line 2\nline 3\n", string(data))
+
+	// Existing leaf from repository is accepted even without the generated ID prefix
+	writeLog("leaf-1.log", "hello\n")
+	data, err = leafManager.ReadLeafLogs(stemKey, "leaf-1", LogReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+
+	// A stopped leaf is readable through the stem recorded as its owner only, even when another stem's leaf
+	// IDs share its prefix: stem a version b-c and stem a-b version c both generate IDs starting a-b-c-
+	writeLog("a-b-c-1.log", "secret\n")
+	assert.NoError(t, recordLeafOwner(tempLogDir, "a-b-c-1", storage.StemKey{Name: "a", Version: "b-c"}))
+	data, err = leafManager.ReadLeafLogs(storage.StemKey{Name: "a", Version: "b-c"}, "a-b-c-1", LogReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "secret\n", string(data))
+	_, err = leafManager.ReadLeafLogs(storage.StemKey{Name: "a-b", Version: "c"}, "a-b-c-1", LogReadOptions{})
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// Foreign leaf IDs and path traversal are rejected
+	_, err = leafManager.ReadLeafLogs(stemKey, "other-leaf", LogReadOptions{})
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	_, err = leafManager.ReadLeafLogs(stemKey, "../secret", LogReadOptions{})
+	assert.Error(t, err)
+
+	// Missing logs
+	assert.NoError(t, recordLeafOwner(tempLogDir, "system-service-1.0.0-1", stemKey))
+	_, err = leafManager.ReadLeafLogs(stemKey, "system-service-1.0.0-1", LogReadOptions{})
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestLogSinceFilter(t *testing.T) {
+	since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	filter := &LogSinceFilter{Since: since}
+
+	// Untimestamped lines before the first timestamp are kept, continuation lines follow their line
+	assert.Equal(t, "starting\n", string(filter.Filter([]byte("starting\n2024-05-01T11:59:00Z old\n  at Old.java\n"))))
+	assert.Equal(t, "[2024-05-01T12:00:01Z] new\n  at New.java\n",
+		string(filter.Filter([]byte("[2024-05-01T12:00:01Z] new\n  at New.java\n"))))
+
+	// A line split across chunks keeps the decision made at its start
+	filter = &LogSinceFilter{Since: since}
+	assert.Empty(t, filter.Filter([]byte("2024-05-01T11:00:00Z partial ")))
+	assert.Empty(t, filter.Filter([]byte("2024-05-01T13:00:00Z rest\n")))
+	assert.Equal(t, "2024/05/03 12:30:00.250 next\n", string(filter.Filter([]byte("2024/05/03 12:30:00.250 next\n"))))
+}
@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/plantarium-platform/herbarium-go/internal/haproxy"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"github.com/plantarium-platform/herbarium-go/internal/storage"
 	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
 	"github.com/plantarium-platform/herbarium-go/pkg/models"
 	"io"
 	"log"
@@ -19,7 +21,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 )
@@ -30,40 +34,88 @@ const (
 	ServiceCheckInterval  = 50 * time.Millisecond
 )
 
+// serviceStartupTimeout bounds the wait for a leaf to become ready, ServiceStartupTimeout unless replaced in tests.
+var serviceStartupTimeout = ServiceStartupTimeout
+
+// DataDirEnvVar is the environment variable through which a leaf receives its stem's data directory.
+const DataDirEnvVar = "PLANTARIUM_DATA_DIR"
+
+// dataDirPermissions restricts the data directory to the owner and group running herbarium.
+const dataDirPermissions os.FileMode = 0750
+
 // LeafManagerInterface defines methods for managing leafs.
 type LeafManagerInterface interface {
-	StartLeaf(stemName, version string, replaceServer *string) (string, error) // Starts a new leaf instance, optionally replacing an existing server in HAProxy.
-	StopLeaf(stemName, version, leafID string) error                           // Stops a specific leaf instance.
-	GetRunningLeafs(key storage.StemKey) ([]models.Leaf, error)                // Retrieves all running leafs for a stem.
-	StartGraftNodeLeaf(stemName, version string) (string, error)               // Starts a graft node leaf and proxies requests to the real instance.
+	StartLeaf(stemName, version string, replaceServer *string) (string, error)            // Starts a new leaf instance, optionally replacing an existing server in HAProxy.
+	StopLeaf(stemName, version, leafID string) error                                      // Stops a specific leaf instance.
+	RollLeaf(key storage.StemKey, leafID string) (string, error)                          // Replaces a running leaf with a fresh one without dropping requests.
+	GetRunningLeafs(key storage.StemKey) ([]models.Leaf, error)                           // Retrieves all running leafs for a stem.
+	StartGraftNodeLeaf(stemName, version string) (string, error)                          // Starts a graft node leaf and proxies requests to the real instance.
+	StopGraftNodeLeaf(stemName, version string) error                                     // Shuts down and unbinds a stem's graft node, if it has one.
+	ListLeafs(key storage.StemKey, query repos.LeafQuery) ([]*models.Leaf, int, error)    // Lists a stem's leafs matching the query along with the total match count.
+	ReadLeafLogs(key storage.StemKey, leafID string, opts LogReadOptions) ([]byte, error) // Returns part of a leaf's log history, including rotated segments.
+	PromoteStandbyLeaf(stemName, version string, replaceServer *string) (string, error)   // Binds a ready standby leaf to the proxy and refills the warm pool.
+	FillWarmPool(stemName, version string) (int, error)                                   // Starts standby leafs until the stem's warm pool is full.
+	LeafResources(key storage.StemKey, leafID string) (*LeafResources, error)             // Measures the memory a leaf uses.
 }
 
 // LeafManager manages leaf instances and interacts with the Leaf repository and HAProxy client.
 type LeafManager struct {
-	LeafRepo      repos.LeafRepositoryInterface
-	StemRepo      repos.StemRepositoryInterface
-	HAProxyClient haproxy.HAProxyClientInterface
+	LeafRepo    repos.LeafRepositoryInterface
+	StemRepo    repos.StemRepositoryInterface
+	ProxyClient proxy.ProxyClient
+	Agents      map[string]LeafRuntime        // Remote agents by name, for stems whose config sets agent
+	NodeRepo    repos.NodeRepositoryInterface // Nodes leafs are placed on, nil disables placement
+	Events      *EventLog                     // Receives an event when a stem's last running leaf stops, nil to skip the check
+	Hooks       *hooks.Registry               // Hooks vetoing or enriching leaf starts and binds, nil for none
+	Drain       *Drain                        // Refuses leafs on this host while it is draining, nil to never refuse them
+
+	BindAddress      string                                // Interface leafs on this host listen on unless their stem sets one, empty for loopback
+	AdvertiseAddress string                                // Address the proxy reaches leafs on this host at unless their stem sets one
+	Env              map[string]string                     // Environment variables of every leaf unless its stem sets them
+	TypeEnv          map[models.StemType]map[string]string // Environment variables of the leafs of system or deployment stems, over Env
+	Secrets          *SecretStore                          // Resolves secret:// references in leaf env, nil without a secrets provider
+	Nix              *NixEnvironments                      // Builds the nix environments of stems, nil to refuse stems declaring one
+
+	poolMu  sync.Mutex               // Guards promotions and filling
+	filling map[storage.StemKey]bool // Stems whose warm pool is being filled
+
+	graftMu      sync.Mutex                           // Guards graftServers
+	graftServers map[storage.StemKey]*graftNodeServer // Servers of graft nodes waiting for their first request
 }
 
 // NewLeafManager creates a new LeafManager with the given repository and HAProxy client.
-func NewLeafManager(leafRepo repos.LeafRepositoryInterface, haproxyClient haproxy.HAProxyClientInterface, stemRepo repos.StemRepositoryInterface) *LeafManager {
+func NewLeafManager(leafRepo repos.LeafRepositoryInterface, proxyClient proxy.ProxyClient, stemRepo repos.StemRepositoryInterface) *LeafManager {
 	return &LeafManager{
-		LeafRepo:      leafRepo,
-		StemRepo:      stemRepo,
-		HAProxyClient: haproxyClient,
+		LeafRepo:    leafRepo,
+		StemRepo:    stemRepo,
+		ProxyClient: proxyClient,
 	}
 }
 
-// FindAvailablePort starts from a given base port and finds the first available port.
-func findAvailablePort(startPort int) (int, error) {
-	for port := startPort; port < 65535; port++ {
-		ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-		if err == nil {
-			ln.Close() // Port is available
-			return port, nil
+// placeLeaf selects the registered node a new leaf of stem runs on, or nil when no nodes are registered.
+func (l *LeafManager) placeLeaf(stem *models.Stem) (*models.Node, error) {
+	if l.NodeRepo == nil {
+		return nil, nil
+	}
+	nodes, err := l.NodeRepo.GetAllNodes()
+	if err != nil || len(nodes) == 0 {
+		return nil, err
+	}
+	if l.Drain.Draining() {
+		if nodes = remoteNodes(nodes); len(nodes) == 0 {
+			return nil, ErrDraining
 		}
 	}
-	return 0, fmt.Errorf("no available ports found")
+	stems, err := l.StemRepo.GetAllStems()
+	if err != nil {
+		return nil, err
+	}
+
+	var placement *models.PlacementConfig
+	if stem.Config != nil {
+		placement = stem.Config.Placement
+	}
+	return placeLeaf(nodes, stems, placement)
 }
 
 // StartLeaf starts a new leaf instance for the given stem and version.
@@ -92,8 +144,8 @@ func findAvailablePort(startPort int) (int, error) {
 //     - Returns the Process ID (PID) of the running process if successful.
 //     If the process fails to start, an error is returned.
 //
-//  5. **Bind the Leaf to HAProxy**: The HAProxy client (`HAProxyClient`) binds the leaf
-//     instance to the appropriate HAProxy backend specified in the stem configuration.
+//  5. **Bind the Leaf to the Proxy**: The proxy client (`ProxyClient`) binds the leaf
+//     instance to the proxy backend specified in the stem configuration.
 //     The backend is responsible for routing traffic to the leaf. If binding fails, the
 //     method ensures proper error reporting.
 //
@@ -122,18 +174,18 @@ func findAvailablePort(startPort int) (int, error) {
 // 6. The repository saves the leaf details under `ping-service-stem`.
 // 7. The method returns the leaf ID `ping-service-stem-v1.0-1672574400`.
 func (l *LeafManager) StartLeaf(stemName, version string, replaceServer *string) (string, error) {
+	return l.startLeaf(stemName, version, replaceServer, false)
+}
+
+// startLeaf starts a leaf as StartLeaf does. Standby leafs are not bound to the proxy and are saved with
+// StatusStandby, to be bound later by PromoteStandbyLeaf. The before_start_leaf hooks may veto the start or
+// change the config the leaf is started with.
+func (l *LeafManager) startLeaf(stemName, version string, replaceServer *string, standby bool) (startedID string, err error) {
 	log.Printf("Starting leaf for stem: %s, version: %s", stemName, version)
 
 	// Generate a unique leaf ID
 	leafID := fmt.Sprintf("%s-%s-%d", stemName, version, time.Now().UnixNano())
 
-	// Find an available port for the leaf
-	leafPort, err := findAvailablePort(8000)
-	if err != nil {
-		log.Printf("Failed to find an available port: %v", err)
-		return "", fmt.Errorf("failed to find an available port: %v", err)
-	}
-
 	// Retrieve stem configuration
 	stemKey := storage.StemKey{Name: stemName, Version: version}
 	stem, err := l.StemRepo.FetchStem(stemKey)
@@ -142,46 +194,208 @@ func (l *LeafManager) StartLeaf(stemName, version string, replaceServer *string)
 		return "", fmt.Errorf("failed to find stem configuration: %v", err)
 	}
 
-	// Start the leaf process
-	pid, err := l.startLeafInternal(stemName, version, leafID, leafPort, stem.Config)
+	// The leaf process is started with the default env merged in and the config as the hooks left it
+	config := l.withEnvDefaults(stem.Type, stem.Config)
+	op := hooks.Operation{LeafID: leafID}
+	if config != nil {
+		op.Stem = *config
+		if err := l.Hooks.Before(hooks.BeforeStartLeaf, &op); err != nil {
+			log.Printf("Start of leaf %s was vetoed: %v", leafID, err)
+			return "", fmt.Errorf("start of leaf %s was vetoed: %v", leafID, err)
+		}
+		config = &op.Stem
+	}
+	defer func() { l.Hooks.After(hooks.AfterStartLeaf, op, err) }()
+
+	// Secret references are resolved after the hooks ran, so only the leaf sees the values
+	config, err = l.resolveSecrets(stemKey, config)
 	if err != nil {
-		log.Printf("Failed to start leaf process for %s version %s: %v", stemName, version, err)
-		return "", fmt.Errorf("failed to start leaf process: %v", err)
+		log.Printf("Failed to resolve secrets of leaf %s: %v", leafID, err)
+		return "", fmt.Errorf("failed to resolve secrets: %w", err)
 	}
 
-	// HAProxy integration
-	if replaceServer != nil {
-		// Replace an existing server in HAProxy
-		err = l.HAProxyClient.ReplaceLeaf(stem.HAProxyBackend, *replaceServer, leafID, "localhost", leafPort)
+	// Static stems are served by herbarium, stems assigned to an agent or an SSH host run their leafs on that host, others are placed on a registered node
+	runtimeName := stemRuntimeName(stem.Config)
+	var node *models.Node
+	if runtimeName == "" {
+		node, err = l.placeLeaf(stem)
 		if err != nil {
-			log.Printf("Failed to replace server %s with leaf %s in HAProxy: %v", *replaceServer, leafID, err)
-			return "", fmt.Errorf("failed to replace server in HAProxy: %v", err)
+			log.Printf("Failed to place leaf for %s version %s: %v", stemName, version, err)
+			return "", fmt.Errorf("failed to place leaf: %w", err)
+		}
+		if node != nil {
+			log.Printf("Placed leaf %s on node %s", leafID, node.Name)
+			runtimeName = node.Agent
 		}
+	}
+	if (runtimeName == "" || runtimeName == StaticRuntimeName) && l.Drain.Draining() {
+		return "", fmt.Errorf("leaf %s would run on this host: %w", leafID, ErrDraining)
+	}
+
+	// The leaf and its start are saved together once it is up; until then, a failure rolls back the port,
+	// the process, and the proxy binding, so no half-started leaf is left behind
+	tx := l.LeafRepo.Begin()
+	defer tx.Rollback()
+
+	var pid, leafPort int
+	var leafHost string
+	if runtimeName != "" {
+		if isUDPStem(stem.Config) && runtimeName == SSHRuntimeName {
+			return "", fmt.Errorf("UDP stems cannot run leafs over SSH")
+		}
+		runtime, err := remoteRuntime(l.Agents, stem.Config, runtimeName)
+		if err != nil {
+			log.Printf("Stem %s version %s has no usable leaf runtime: %v", stemName, version, err)
+			return "", err
+		}
+		remote, err := runtime.StartLeaf(AgentStartRequest{StemName: stemName, Version: version, LeafID: leafID, Config: *config})
+		if err != nil {
+			log.Printf("Failed to start leaf for %s version %s on %s: %v", stemName, version, runtimeName, err)
+			return "", fmt.Errorf("failed to start leaf on %s: %v", runtimeName, err)
+		}
+		pid, leafPort, leafHost = remote.PID, remote.Port, runtime.Host()
+		if remote.Host != "" {
+			leafHost = remote.Host
+		}
+		tx.OnRollback(func() {
+			if err := runtime.StopLeaf(leafID); err != nil {
+				log.Printf("Failed to stop leaf %s on %s after its start failed: %v", leafID, runtimeName, err)
+			}
+		})
 	} else {
-		// Bind a new server to HAProxy
-		err = l.HAProxyClient.BindLeaf(stem.HAProxyBackend, leafID, "localhost", leafPort)
+		// Leafs on this host listen on the bind address and are advertised to the proxy
+		config = l.withAddressDefaults(config)
+		leafHost = advertisedHost(config)
+
+		// The stem's nix environment is built before its first leaf starts
+		config, err = l.withNixEnvironment(stemName, version, config)
 		if err != nil {
-			log.Printf("Failed to bind leaf %s to HAProxy: %v", leafID, err)
-			return "", fmt.Errorf("failed to bind leaf to HAProxy: %v", err)
+			log.Printf("Failed to prepare nix environment of leaf %s: %v", leafID, err)
+			return "", err
+		}
+
+		// Reserve a port for the leaf, released when the leaf stops
+		leafPort, err = allocateLeafPort(stem.Config, leafID)
+		if err != nil {
+			log.Printf("Failed to find an available port: %v", err)
+			return "", fmt.Errorf("failed to find an available port: %v", err)
+		}
+		tx.OnRollback(func() { releaseLeafPort(stem.Config, leafPort) })
+
+		// Start the leaf process
+		pid, err = startLeafInternal(stemName, version, leafID, leafPort, config)
+		if err != nil {
+			log.Printf("Failed to start leaf process for %s version %s: %v", stemName, version, err)
+			return "", fmt.Errorf("failed to start leaf process: %v", err)
+		}
+		tx.OnRollback(func() {
+			if err := killProcessTree(pid); err != nil {
+				log.Printf("Failed to kill process %d of leaf %s after its start failed: %v", pid, leafID, err)
+			}
+		})
+	}
+
+	nodeName := ""
+	if node != nil {
+		nodeName = node.Name
+		if node.Address != "" {
+			leafHost = node.Address
 		}
 	}
+	op.Host, op.Port = leafHost, leafPort
+
+	// HAProxy integration, skipped for standby leafs and UDP stems whose leafs are reached directly
+	if standby {
+		log.Printf("Leaf %s of stem %s is kept on standby on port %d", leafID, stemName, leafPort)
+	} else if !proxied(stem.Config) {
+		log.Printf("Leaf %s of UDP stem %s is reached directly on port %d", leafID, stemName, leafPort)
+	} else if err := l.bindLeaf(stem, op, leafID, replaceServer); err != nil {
+		return "", err
+	} else if replaceServer == nil {
+		// A replaced server can't be brought back, so only a new one is unbound
+		tx.OnRollback(func() {
+			if err := l.ProxyClient.UnbindLeaf(stem.HAProxyBackend, leafID); err != nil {
+				log.Printf("Failed to unbind leaf %s after its start failed: %v", leafID, err)
+			}
+		})
+	}
 
-	// Save the leaf in the repository
-	err = l.LeafRepo.AddLeaf(stemKey, leafID, leafID, pid, leafPort, time.Now())
-	if err != nil {
+	// Save the leaf in the repository and count its start
+	leaf := &models.Leaf{
+		ID:            leafID,
+		PID:           pid,
+		HAProxyServer: leafID,
+		Port:          leafPort,
+		Status:        models.StatusRunning,
+		Initialized:   time.Now(),
+		Agent:         runtimeName,
+		Node:          nodeName,
+	}
+	if leafHost != "localhost" {
+		leaf.Host = leafHost
+	}
+	if standby {
+		leaf.Status = models.StatusStandby
+	}
+	l.LeafRepo.StageLeaf(tx, stemKey, leaf)
+	l.StemRepo.StageLeafStart(tx, stemKey)
+	if err := tx.Commit(); err != nil {
 		log.Printf("Leaf %s started but failed to save to repository: %v", leafID, err)
 		return "", fmt.Errorf("leaf started, but failed to save to repository: %v", err)
 	}
 
-	leafURL := fmt.Sprintf("http://localhost:%d", leafPort)
+	leafURL := "http://" + net.JoinHostPort(leafHost, strconv.Itoa(leafPort))
+	if isUDPStem(stem.Config) {
+		leafURL = "udp://" + net.JoinHostPort(leafHost, strconv.Itoa(leafPort))
+	}
 	log.Printf("Leaf started successfully: ID=%s, URL=%s", leafID, leafURL)
 
 	return leafID, nil
 }
 
+// bindLeaf binds a started leaf to the proxy as server, replacing replaceServer if set, unless a
+// before_proxy_bind hook vetoes it. op describes the leaf with the config it was started with.
+func (l *LeafManager) bindLeaf(stem *models.Stem, op hooks.Operation, server string, replaceServer *string) error {
+	leafID := op.LeafID
+	bind := hooks.Operation{Stem: op.Stem, LeafID: leafID, Backend: stem.HAProxyBackend, Host: op.Host, Port: op.Port}
+	if err := l.Hooks.Before(hooks.BeforeProxyBind, &bind); err != nil {
+		log.Printf("Binding leaf %s to HAProxy was vetoed: %v", leafID, err)
+		return fmt.Errorf("binding leaf %s to HAProxy was vetoed: %v", leafID, err)
+	}
+
+	var err error
+	if replaceServer != nil {
+		// Replace an existing server in HAProxy
+		err = l.ProxyClient.ReplaceLeaf(stem.HAProxyBackend, *replaceServer, server, op.Host, op.Port)
+		if err != nil {
+			log.Printf("Failed to replace server %s with leaf %s in HAProxy: %v", *replaceServer, leafID, err)
+			err = fmt.Errorf("failed to replace server in HAProxy: %v", err)
+		}
+	} else {
+		// Bind a new server to HAProxy
+		err = l.ProxyClient.BindLeaf(stem.HAProxyBackend, server, op.Host, op.Port)
+		if err != nil {
+			log.Printf("Failed to bind leaf %s to HAProxy: %v", leafID, err)
+			err = fmt.Errorf("failed to bind leaf to HAProxy: %v", err)
+		}
+	}
+	l.Hooks.After(hooks.AfterProxyBind, bind, err)
+	return err
+}
+
+// StopLeaf stops a leaf in stages, each timed, logged and added to the leaf's status history: the proxy
+// drains the leaf and unbinds it, the leaf gets its stop signal and is killed if it doesn't exit in time,
+// then it is removed from the repository. Standby leafs were never bound, so they skip draining and
+// unbinding. Remote leafs are stopped by their runtime in a single stage. A failed stage leaves the leaf
+// stopping, with the failure in its history.
 func (l *LeafManager) StopLeaf(stemName, version, leafID string) error {
-	// Use StemKey to retrieve the stem
-	stemKey := storage.StemKey{Name: stemName, Version: version}
+	return l.stopLeaf(storage.StemKey{Name: stemName, Version: version}, leafID, false)
+}
+
+// stopLeaf runs the stages of StopLeaf. A leaf whose server was replaced, or that was unbound by an earlier
+// attempt to stop it, is no longer bound, so it skips draining and unbinding.
+func (l *LeafManager) stopLeaf(stemKey storage.StemKey, leafID string, replaced bool) error {
+	stemName, version := stemKey.Name, stemKey.Version
 	stem, err := l.StemRepo.FetchStem(stemKey)
 	if err != nil {
 		return fmt.Errorf("failed to find stem %s: %v", stemKey, err)
@@ -192,33 +406,101 @@ func (l *LeafManager) StopLeaf(stemName, version, leafID string) error {
 	if !exists {
 		return fmt.Errorf("leaf with ID %s not found in stem %s", leafID, stemKey)
 	}
-
-	// Unbind the leaf from HAProxy
-	err = l.HAProxyClient.UnbindLeaf(stem.HAProxyBackend, leaf.HAProxyServer)
-	if err != nil {
-		return fmt.Errorf("failed to unbind leaf from HAProxy: %v", err)
+	// The leaf is only marked stopping if nothing else changed it since it was read, so a concurrent stop,
+	// promotion, or replacement isn't overwritten
+	previousStatus := leaf.Status
+	_, err = l.LeafRepo.CompareAndSwapLeaf(stemKey, leafID, leaf.Revision, func(leaf *models.Leaf) error {
+		leaf.Status = models.StatusStopping
+		return nil
+	})
+	if errors.Is(err, repos.ErrConflict) {
+		return fmt.Errorf("leaf %s changed while being stopped: %w", leafID, err)
 	}
-
-	// Stop the process by PID
-	process, err := os.FindProcess(leaf.PID)
 	if err != nil {
-		return fmt.Errorf("failed to find process with PID %d: %v", leaf.PID, err)
+		return fmt.Errorf("failed to mark leaf %s stopping: %v", leafID, err)
+	}
+	started := time.Now()
+
+	// Drain and unbind the leaf from HAProxy, which never saw standby leafs. A failed drain only cuts the wait short.
+	if proxied(stem.Config) && previousStatus != models.StatusStandby && !replaced && !leafUnbound(leaf) {
+		drainer, ok := l.ProxyClient.(proxy.Drainer)
+		if timeout := drainTimeout(stem.Config); ok && timeout > 0 {
+			l.runStopStage(stemKey, leafID, StopStageDrain, func() error {
+				return drainLeaf(drainer, stem.HAProxyBackend, leaf.HAProxyServer, timeout)
+			})
+		}
+		err = l.runStopStage(stemKey, leafID, StopStageUnbind, func() error {
+			return l.ProxyClient.UnbindLeaf(stem.HAProxyBackend, leaf.HAProxyServer)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to unbind leaf from HAProxy: %v", err)
+		}
 	}
 
-	err = process.Kill()
-	if err != nil {
-		return fmt.Errorf("failed to kill process with PID %d: %v", leaf.PID, err)
+	// Stop the process (and any children it spawned) by PID, on the remote host running it if any
+	if leaf.Agent != "" {
+		runtime, err := remoteRuntime(l.Agents, stem.Config, leaf.Agent)
+		if err != nil {
+			return fmt.Errorf("leaf %s runs on an unavailable runtime: %v", leafID, err)
+		}
+		if err := l.runStopStage(stemKey, leafID, StopStageStop, func() error { return runtime.StopLeaf(leafID) }); err != nil {
+			return err
+		}
+	} else if !processAlive(leaf.PID) {
+		log.Printf("Process %d of leaf %s already exited", leaf.PID, leafID)
+	} else {
+		behavior := behaviorOf(stem.Config)
+		var exited bool
+		l.runStopStage(stemKey, leafID, StopStageTerminate, func() (err error) {
+			exited, err = terminateLeafProcess(leaf.PID, behavior)
+			return err
+		})
+		if !exited {
+			if err := l.runStopStage(stemKey, leafID, StopStageKill, func() error { return killProcessTree(leaf.PID) }); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Remove the leaf from the repository
-	err = l.LeafRepo.RemoveLeaf(stemKey, leafID)
+	// Release the leaf's port and remove it from the repository
+	err = l.runStopStage(stemKey, leafID, StopStageCleanup, func() error {
+		if leaf.Agent == "" {
+			releaseLeafPort(stem.Config, leaf.Port)
+		}
+		return l.LeafRepo.RemoveLeaf(stemKey, leafID)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to remove leaf from repository: %v", err)
 	}
+	log.Printf("Stopped leaf %s of stem %s version %s in %s", leafID, stemName, version, time.Since(started))
 
+	if l.Events != nil && previousStatus == models.StatusRunning {
+		l.recordScaledToZero(stemKey, leafID)
+	}
 	return nil
 }
 
+// recordScaledToZero records an event when the stopped leaf was the last running leaf of its stem.
+func (l *LeafManager) recordScaledToZero(key storage.StemKey, leafID string) {
+	leafs, err := l.LeafRepo.ListLeafs(key)
+	if err != nil {
+		log.Printf("Failed to list leafs of stem %s version %s: %v", key.Name, key.Version, err)
+		return
+	}
+	for _, leaf := range leafs {
+		if leaf.Status == models.StatusRunning {
+			return
+		}
+	}
+	l.Events.Record(models.Event{
+		Type:    models.EventStemScaledToZero,
+		Stem:    key.Name,
+		Version: key.Version,
+		Leaf:    leafID,
+		Message: fmt.Sprintf("Stem %s version %s has no running leafs left after leaf %s stopped", key.Name, key.Version, leafID),
+	})
+}
+
 func (l *LeafManager) GetRunningLeafs(key storage.StemKey) ([]models.Leaf, error) {
 	// Retrieve the stem using StemKey
 	stem, err := l.StemRepo.FetchStem(key)
@@ -241,6 +523,12 @@ func (l *LeafManager) GetRunningLeafs(key storage.StemKey) ([]models.Leaf, error
 
 	return runningLeafs, nil
 }
+
+// ListLeafs returns the page of a stem's leafs matching the query along with the total number of matches.
+func (l *LeafManager) ListLeafs(key storage.StemKey, query repos.LeafQuery) ([]*models.Leaf, int, error) {
+	return l.LeafRepo.QueryLeafs(key, query)
+}
+
 func (l *LeafManager) StartGraftNodeLeaf(stemName, version string) (string, error) {
 	log.Printf("Starting graft node leaf for stem: %s, version: %s", stemName, version)
 
@@ -266,8 +554,9 @@ func (l *LeafManager) StartGraftNodeLeaf(stemName, version string) (string, erro
 	// Generate a unique ID for the graft node leaf
 	graftNodeLeafID := fmt.Sprintf("%s-%s-graftnode", stemName, version)
 
-	// Find an available port for the graft node
-	graftNodePort, err := findAvailablePort(8000)
+	// Reserve a port for the graft node from the stem's port range, like its leafs. The graft node server is
+	// plain HTTP, so the port is a TCP one even for UDP stems; the server holds it until it shuts down.
+	graftNodePort, err := allocateGraftNodePort(stem.Config, graftNodeLeafID)
 	if err != nil {
 		log.Printf("Failed to find an available port for graft node: %v", err)
 		return "", fmt.Errorf("failed to find an available port: %v", err)
@@ -284,8 +573,9 @@ func (l *LeafManager) StartGraftNodeLeaf(stemName, version string) (string, erro
 	}
 
 	// Bind the graft node to the HAProxy backend
-	err = l.HAProxyClient.BindLeaf(stem.HAProxyBackend, graftNodeLeaf.ID, "localhost", graftNodeLeaf.Port)
+	err = l.ProxyClient.BindLeaf(stem.HAProxyBackend, graftNodeLeaf.ID, advertisedHost(l.withAddressDefaults(stem.Config)), graftNodeLeaf.Port)
 	if err != nil {
+		leafPorts.Release("tcp", graftNodePort)
 		log.Printf("Failed to bind graft node to HAProxy backend for stem %s: %v", stemName, err)
 		return "", fmt.Errorf("failed to bind graft node to HAProxy backend: %v", err)
 	}
@@ -293,6 +583,7 @@ func (l *LeafManager) StartGraftNodeLeaf(stemName, version string) (string, erro
 	// Create and bind the graft node server
 	err = l.createAndBindGraftNodeServer(stem, graftNodeLeaf)
 	if err != nil {
+		leafPorts.Release("tcp", graftNodePort)
 		log.Printf("Failed to create and bind graft node for stem %s: %v", stemName, err)
 		return "", err
 	}
@@ -300,6 +591,7 @@ func (l *LeafManager) StartGraftNodeLeaf(stemName, version string) (string, erro
 	// Save the graft node in the repository
 	err = l.LeafRepo.SetGraftNode(stemKey, graftNodeLeaf)
 	if err != nil {
+		l.shutdownGraftNodeServer(stemKey)
 		log.Printf("Failed to save graft node leaf for stem %s: %v", stemName, err)
 		return "", fmt.Errorf("failed to save graft node leaf: %v", err)
 	}
@@ -308,94 +600,173 @@ func (l *LeafManager) StartGraftNodeLeaf(stemName, version string) (string, erro
 	return graftNodeLeafID, nil
 }
 func (l *LeafManager) createAndBindGraftNodeServer(stem *models.Stem, graftNodeLeaf *models.Leaf) error {
-	// Create a new ServeMux and an HTTP server
+	// Create a new ServeMux and an HTTP server, listening where the stem's leafs would so the proxy reaches
+	// it at the address it was bound with
 	mux := http.NewServeMux()
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", graftNodeLeaf.Port),
+		Addr:    net.JoinHostPort(bindHost(l.withAddressDefaults(stem.Config)), strconv.Itoa(graftNodeLeaf.Port)),
 		Handler: mux,
 	}
 
-	// Define a channel to signal server shutdown
-	shutdownChan := make(chan struct{})
-
-	mux.HandleFunc(stem.WorkingURL, func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Received request for graft node of stem %s", stem.Name)
+	stemKey := storage.StemKey{Name: stem.Name, Version: stem.Version}
+	l.graftMu.Lock()
+	if l.graftServers == nil {
+		l.graftServers = make(map[storage.StemKey]*graftNodeServer)
+	}
+	l.graftServers[stemKey] = &graftNodeServer{Server: server, port: graftNodeLeaf.Port}
+	l.graftMu.Unlock()
+
+	// Requests arriving while the stem has no leaf wait for the same one, started by the first of them
+	worker := fmt.Sprintf("graft node of stem %s version %s", stem.Name, stem.Version)
+	cold := &coldStart{}
+	wake := func() (realLeaf *models.Leaf, err error) {
+		// A panic fails the start for every request held, rather than leaving them waiting
+		defer func() {
+			if value := recover(); value != nil {
+				reportCrash(worker, value)
+				realLeaf, err = nil, fmt.Errorf("starting the real instance panicked: %v", value)
+			}
+		}()
 
-		// Start the real instance using StartLeaf with graft node replacement
-		stemKey := storage.StemKey{Name: stem.Name, Version: stem.Version}
-		realLeafID, err := l.StartLeaf(stem.Name, stem.Version, &graftNodeLeaf.ID)
+		// Promote a standby leaf in place of the graft node, or start the real instance if there is none
+		realLeafID, err := l.PromoteStandbyLeaf(stem.Name, stem.Version, &graftNodeLeaf.ID)
+		if errors.Is(err, ErrNoStandbyLeaf) {
+			realLeafID, err = l.StartLeaf(stem.Name, stem.Version, &graftNodeLeaf.ID)
+		}
 		if err != nil {
-			log.Printf("Failed to start real instance for stem %s: %v", stem.Name, err)
-			http.Error(w, "Internal Server Error: Unable to start real instance", http.StatusInternalServerError)
-			return
+			return nil, fmt.Errorf("failed to start real instance: %v", err)
 		}
 
 		// Retrieve the real leaf details
-		realLeaf, err := l.LeafRepo.FindLeafByID(stemKey, realLeafID)
+		realLeaf, err = l.LeafRepo.FindLeafByID(stemKey, realLeafID)
 		if err != nil {
-			log.Printf("Failed to retrieve real leaf from repository for stem %s: %v", stem.Name, err)
-			http.Error(w, "Internal Server Error: Unable to retrieve real instance", http.StatusInternalServerError)
-			return
+			return nil, fmt.Errorf("failed to retrieve real leaf from repository: %v", err)
 		}
 
 		// Clear the graft node from the repository
-		err = l.LeafRepo.ClearGraftNode(stemKey)
+		if err := l.LeafRepo.ClearGraftNode(stemKey); err != nil {
+			return nil, fmt.Errorf("failed to clear graft node: %v", err)
+		}
+		return realLeaf, nil
+	}
+	record := func(coldStart models.ColdStart) {
+		log.Printf("Cold start of stem %s held %d requests for up to %s", stem.Name, coldStart.Requests, coldStart.MaxWait)
+		if err := l.StemRepo.RecordColdStart(stemKey, coldStart); err != nil {
+			log.Printf("Failed to record cold start of stem %s: %v", stem.Name, err)
+		}
+	}
+
+	mux.HandleFunc(stem.WorkingURL, recoverHandler(worker, func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for graft node of stem %s", stem.Name)
+
+		realLeaf, err := cold.wait(wake, record)
 		if err != nil {
-			log.Printf("Failed to clear graft node for stem %s: %v", stem.Name, err)
-			http.Error(w, "Internal Server Error: Unable to clear graft node", http.StatusInternalServerError)
+			log.Printf("Graft node of stem %s could not reach a real instance: %v", stem.Name, err)
+			http.Error(w, "Internal Server Error: Unable to start real instance", http.StatusInternalServerError)
 			return
 		}
 
 		// Proxy the request to the real instance
-		targetURL := fmt.Sprintf("http://localhost:%d%s", realLeaf.Port, r.URL.Path)
+		realAddress := net.JoinHostPort(leafHost(realLeaf), strconv.Itoa(realLeaf.Port))
+		targetURL := fmt.Sprintf("http://%s%s", realAddress, r.URL.Path)
 		proxy := httputil.NewSingleHostReverseProxy(&url.URL{
 			Scheme: "http",
-			Host:   fmt.Sprintf("localhost:%d", realLeaf.Port),
+			Host:   realAddress,
 		})
 		r.URL.Path = strings.TrimPrefix(r.URL.Path, stem.WorkingURL)
-		r.URL.Host = fmt.Sprintf("localhost:%d", realLeaf.Port)
+		r.URL.Host = realAddress
 		r.URL.Scheme = "http"
-		r.Host = fmt.Sprintf("localhost:%d", realLeaf.Port)
+		r.Host = realAddress
 
 		log.Printf("Forwarding request to real instance: %s%s", targetURL, r.URL.Path)
 		proxy.ServeHTTP(w, r)
 
-		// Signal to shutdown the server after the request is handled
-		shutdownChan <- struct{}{}
-	})
+		// Shut the server down after the request is handled, outside of the handler it waits for
+		go RunRecovered(worker, func() { l.shutdownGraftNodeServer(stemKey) })
+	}))
 
 	// Start the graft node server in a goroutine
 	go func() {
+		defer recoverCrash(worker)
 		log.Printf("Starting graft node server for stem %s on %s", stem.Name, server.Addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Printf("Failed to start graft node server for stem %s: %v", stem.Name, err)
 		}
 	}()
+	return nil
+}
 
-	go func() {
-		<-shutdownChan // Wait for the signal to stop
-		log.Printf("Shutting down graft node server for stem %s", stem.Name)
+// graftNodeServer is the server of a graft node, with the port reserved for it.
+type graftNodeServer struct {
+	*http.Server
+	port int
+}
 
-		// Use context.Background() instead of nil
-		if err := server.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down graft node server for stem %s: %v", stem.Name, err)
-		}
-	}()
+// shutdownGraftNodeServer shuts down the server of a stem's graft node, if it is still running, and releases
+// its port.
+func (l *LeafManager) shutdownGraftNodeServer(stemKey storage.StemKey) {
+	l.graftMu.Lock()
+	server := l.graftServers[stemKey]
+	delete(l.graftServers, stemKey)
+	l.graftMu.Unlock()
+	if server == nil {
+		return
+	}
+
+	log.Printf("Shutting down graft node server for stem %s", stemKey.Name)
+	if err := server.Shutdown(context.Background()); err != nil {
+		log.Printf("Error shutting down graft node server for stem %s: %v", stemKey.Name, err)
+	}
+	leafPorts.Release("tcp", server.port)
+}
+
+// StopGraftNodeLeaf tears down a stem's graft node: its server is shut down, unbound from the proxy and
+// cleared from the repository. Stems without a graft node are left alone.
+func (l *LeafManager) StopGraftNodeLeaf(stemName, version string) error {
+	stemKey := storage.StemKey{Name: stemName, Version: version}
+	stem, err := l.StemRepo.FetchStem(stemKey)
+	if err != nil {
+		return fmt.Errorf("failed to find stem %s: %v", stemKey, err)
+	}
+	graftNodeLeaf, err := l.LeafRepo.GetGraftNode(stemKey)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve graft node: %v", err)
+	}
+	if graftNodeLeaf == nil {
+		return nil
+	}
+
+	l.shutdownGraftNodeServer(stemKey)
+	if err := l.ProxyClient.UnbindLeaf(stem.HAProxyBackend, graftNodeLeaf.HAProxyServer); err != nil {
+		return fmt.Errorf("failed to unbind graft node from HAProxy: %v", err)
+	}
+	if err := l.LeafRepo.ClearGraftNode(stemKey); err != nil {
+		return fmt.Errorf("failed to clear graft node: %v", err)
+	}
+	log.Printf("Stopped graft node %s of stem %s version %s", graftNodeLeaf.ID, stemName, version)
 	return nil
 }
-func (l *LeafManager) startLeafInternal(stemName, stemVersion, leafID string, leafPort int, config *models.StemConfig) (int, error) {
+func startLeafInternal(stemName, stemVersion, leafID string, leafPort int, config *models.StemConfig) (int, error) {
 	log.Printf("Starting leaf instance with ID: %s, Stem: %s, Version: %s, Port: %d", leafID, stemName, stemVersion, leafPort)
 
 	// Prepare working directory
-	workingDir, err := getWorkingDirectory(stemName, stemVersion)
+	workingDir, err := getWorkingDirectory(stemName, stemVersion, config)
 	if err != nil {
 		log.Printf("Failed to get working directory for leaf %s: %v", leafID, err)
 		return 0, err
 	}
 
+	// Prepare persistent data directory, if the stem declares one
+	dataDir, err := prepareDataDirectory(config)
+	if err != nil {
+		log.Printf("Failed to prepare data directory for leaf %s: %v", leafID, err)
+		return 0, err
+	}
+
 	// Prepare command with placeholders replaced
 	command, err := prepareCommandWithTemplate(config.Command, map[string]interface{}{
 		"PORT": leafPort,
+		"HOST": bindHost(config),
 	})
 	if err != nil {
 		log.Printf("Failed to prepare command for leaf %s: %v", leafID, err)
@@ -410,10 +781,20 @@ func (l *LeafManager) startLeafInternal(stemName, stemVersion, leafID string, le
 	executable := commandParts[0]
 	args := commandParts[1:]
 
+	// Executables are looked up in the PATH the leaf gets, which a nix environment extends
+	if path, ok := config.Env["PATH"]; ok && !strings.ContainsRune(executable, filepath.Separator) {
+		if found := lookPathIn(executable, path); found != "" {
+			executable = found
+		}
+	}
+
 	// Create and configure the command
 	cmd := exec.Command(executable, args...)
 	cmd.Dir = workingDir
 	cmd.Env = append(os.Environ(), formatEnvVars(config.Env)...)
+	if dataDir != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", DataDirEnvVar, dataDir))
+	}
 
 	// Set up pipes
 	stdoutPipe, stderrPipe, err := setupPipes(cmd)
@@ -423,25 +804,26 @@ func (l *LeafManager) startLeafInternal(stemName, stemVersion, leafID string, le
 	}
 
 	// Set up log file
-	logFile, err := setupLogFile(getLogFolder(), leafID)
+	logFile, err := setupLogFile(getLogFolder(), leafID, storage.StemKey{Name: stemName, Version: stemVersion})
 	if err != nil {
 		log.Printf("Failed to set up log file for leaf %s: %v", leafID, err)
 		return 0, err
 	}
 	defer logFile.Close()
 
-	// Process output and detect readiness
-	startMessage := ""
-	if config.StartMessage != nil {
-		startMessage = *config.StartMessage
-	}
+	// Process output and detect readiness, from the stem's start message or its runtime adapter's patterns
+	behavior := behaviorOf(config)
 
 	messageChan := make(chan string, 1)
 	errorChan := make(chan error, 1)
 
 	// Concurrently log output and detect readiness
-	go logAndDetectOutput(stdoutPipe, logFile, leafID, "stdout", startMessage, messageChan, errorChan)
-	go logAndDetectOutput(stderrPipe, logFile, leafID, "stderr", startMessage, messageChan, errorChan)
+	go RunRecovered("output of leaf "+leafID, func() {
+		logAndDetectOutput(stdoutPipe, logFile, leafID, "stdout", behavior.isStartLine, messageChan, errorChan)
+	})
+	go RunRecovered("output of leaf "+leafID, func() {
+		logAndDetectOutput(stderrPipe, logFile, leafID, "stderr", behavior.isStartLine, messageChan, errorChan)
+	})
 
 	// Start the process
 	if err := cmd.Start(); err != nil {
@@ -450,19 +832,29 @@ func (l *LeafManager) startLeafInternal(stemName, stemVersion, leafID string, le
 	}
 	log.Printf("Leaf %s process started with PID: %d", leafID, cmd.Process.Pid)
 
+	// Tie the process lifetime to herbarium where the platform supports it
+	if err := attachLeafProcess(cmd); err != nil {
+		log.Printf("Failed to attach leaf %s process to herbarium: %v", leafID, err)
+	}
+
 	// Handle process completion in the background
-	go handleProcessCompletion(cmd, logFile, leafID)
+	go RunRecovered("process watcher of leaf "+leafID, func() { handleProcessCompletion(cmd, logFile, leafID) })
 
 	// Wait for readiness (port or start message)
-	if err := waitForServiceToStart(leafPort, startMessage, messageChan, errorChan); err != nil {
+	// A leaf that never became ready is killed here, as the caller only learns its PID once it is ready and
+	// would otherwise release the port while the process still holds it
+	if err := waitForServiceToStart(leafPort, readinessCheck(config), messageChan, errorChan); err != nil {
 		log.Printf("Leaf %s service not ready: %v", leafID, err)
+		if killErr := killProcessTree(cmd.Process.Pid); killErr != nil {
+			log.Printf("Failed to kill process %d of leaf %s that never became ready: %v", cmd.Process.Pid, leafID, killErr)
+		}
 		return 0, fmt.Errorf("leaf service not ready: %v", err)
 	}
 
 	log.Printf("Leaf %s service successfully started on port %d", leafID, leafPort)
 	return cmd.Process.Pid, nil
 }
-func logAndDetectOutput(pipe io.ReadCloser, logFile *os.File, leafID, pipeType, startMessage string, messageChan chan string, errorChan chan error) {
+func logAndDetectOutput(pipe io.ReadCloser, logFile *os.File, leafID, pipeType string, isStartLine func(line string) bool, messageChan chan string, errorChan chan error) {
 	scanner := bufio.NewScanner(pipe)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -470,8 +862,11 @@ func logAndDetectOutput(pipe io.ReadCloser, logFile *os.File, leafID, pipeType,
 		if _, err := logFile.WriteString(line + "\n"); err != nil {
 			log.Printf("[Leaf %s] Error writing to log file: %v", leafID, err)
 		}
-		if startMessage != "" && strings.Contains(line, startMessage) {
-			messageChan <- line
+		if isStartLine(line) {
+			select {
+			case messageChan <- line:
+			default:
+			}
 		}
 	}
 	if err := scanner.Err(); err != nil {
@@ -509,27 +904,64 @@ func formatEnvVars(envVars map[string]string) []string {
 	}
 	return formatted
 }
-func setupLogFile(logFolder, leafID string) (*os.File, error) {
+
+// setupLogFile creates the log file of a leaf and records the stem version owning it.
+func setupLogFile(logFolder, leafID string, owner storage.StemKey) (*os.File, error) {
 	if err := os.MkdirAll(logFolder, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("failed to create log folder: %v", err)
 	}
+	if err := recordLeafOwner(logFolder, leafID, owner); err != nil {
+		return nil, fmt.Errorf("failed to record owner of leaf %s: %v", leafID, err)
+	}
 	logFile := fmt.Sprintf("%s/%s.log", logFolder, leafID)
 	log.Printf("[Leaf %s] Using log file: %s", leafID, logFile)
 	return os.Create(logFile)
 }
 
-func getWorkingDirectory(stemName, stemVersion string) (string, error) {
+// getWorkingDirectory resolves the directory a leaf is started in. By default this is
+// services/<name>/<version> under the root folder; a workingDir in the stem config overrides it.
+// Relative overrides are resolved against the root folder.
+func getWorkingDirectory(stemName, stemVersion string, config *models.StemConfig) (string, error) {
 	rootFolder := os.Getenv("PLANTARIUM_ROOT_FOLDER")
 	if rootFolder == "" {
 		return "", fmt.Errorf("PLANTARIUM_ROOT_FOLDER environment variable is not set")
 	}
 	workingDir := filepath.Join(rootFolder, "services", stemName, stemVersion)
+	if config != nil && config.WorkingDir != nil && *config.WorkingDir != "" {
+		workingDir = resolveAgainstRoot(rootFolder, *config.WorkingDir)
+	}
 	if _, err := os.Stat(workingDir); os.IsNotExist(err) {
 		return "", fmt.Errorf("working directory %s does not exist: %v", workingDir, err)
 	}
 	return workingDir, nil
 }
 
+// prepareDataDirectory creates the persistent data directory declared in the stem config and
+// returns its path. It returns an empty path if the stem does not declare a data directory.
+func prepareDataDirectory(config *models.StemConfig) (string, error) {
+	if config == nil || config.DataDir == nil || *config.DataDir == "" {
+		return "", nil
+	}
+
+	dataDir := resolveAgainstRoot(os.Getenv("PLANTARIUM_ROOT_FOLDER"), *config.DataDir)
+	if err := os.MkdirAll(dataDir, dataDirPermissions); err != nil {
+		return "", fmt.Errorf("failed to create data directory %s: %v", dataDir, err)
+	}
+	// MkdirAll leaves existing directories untouched and is subject to umask, so enforce permissions explicitly
+	if err := os.Chmod(dataDir, dataDirPermissions); err != nil {
+		return "", fmt.Errorf("failed to set permissions on data directory %s: %v", dataDir, err)
+	}
+	return dataDir, nil
+}
+
+// resolveAgainstRoot returns path unchanged if it is absolute, otherwise joins it onto rootFolder.
+func resolveAgainstRoot(rootFolder, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(rootFolder, path)
+}
+
 func setupPipes(cmd *exec.Cmd) (stdout, stderr io.ReadCloser, err error) {
 	stdout, err = cmd.StdoutPipe()
 	if err != nil {
@@ -566,11 +998,10 @@ func handleProcessCompletion(cmd *exec.Cmd, logFile *os.File, leafID string) {
 	}
 }
 
-func waitForServiceToStart(port int, startMessage string, messageChan chan string, errorChan chan error) error {
+func waitForServiceToStart(port int, ready func(port int) bool, messageChan chan string, errorChan chan error) error {
 	start := time.Now()
-	address := fmt.Sprintf("localhost:%d", port)
 
-	for time.Since(start) < ServiceStartupTimeout {
+	for time.Since(start) < serviceStartupTimeout {
 		// Check for start message
 		select {
 		case msg := <-messageChan:
@@ -582,10 +1013,8 @@ func waitForServiceToStart(port int, startMessage string, messageChan chan strin
 			log.Printf("Error while reading logs: %v", err)
 			return fmt.Errorf("error while checking start message: %v", err)
 		default:
-			// Check port availability
-			conn, err := net.DialTimeout("tcp", address, ServiceCheckInterval)
-			if err == nil {
-				_ = conn.Close()
+			// Check whether the service listens on its port
+			if ready(port) {
 				return nil
 			}
 		}
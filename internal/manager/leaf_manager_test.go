@@ -2,11 +2,14 @@ package manager
 
 import (
 	"fmt"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"github.com/plantarium-platform/herbarium-go/internal/storage"
 	"github.com/stretchr/testify/mock"
 	"log"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
@@ -22,14 +25,12 @@ func TestStartLeafWithPingService(t *testing.T) {
 	patch := monkey.Patch(time.Now, func() time.Time { return fakeTime })
 	t.Cleanup(patch.Unpatch)
 
-	tempLogDir := "../../.test-logs"
+	tempLogDir := t.TempDir()
 	err := os.Setenv("PLANTARIUM_LOG_FOLDER", tempLogDir)
 	assert.NoError(t, err, "failed to set PLANTARIUM_LOG_FOLDER environment variable")
 	tempRootDir := "../../testdata"
 	err = os.Setenv("PLANTARIUM_ROOT_FOLDER", tempRootDir)
 	assert.NoError(t, err, "failed to set PLANTARIUM_ROOT_FOLDER environment variable")
-	err = os.MkdirAll(tempLogDir, os.ModePerm)
-	assert.NoError(t, err, "failed to create test log directory")
 
 	leafStorage := storage.GetHerbariumDB()
 	leafRepo := repos.NewLeafRepository(leafStorage)
@@ -63,7 +64,7 @@ func TestStartLeafWithPingService(t *testing.T) {
 
 	leafStorage.Stems[stemKey] = stem
 
-	mockHAProxyClient := new(MockHAProxyClient)
+	mockHAProxyClient := new(MockProxyClient)
 	mockHAProxyClient.On("BindLeaf", "ping-backend", leafID, "localhost", leafPort).Return(nil)
 
 	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, stemRepo)
@@ -104,15 +105,48 @@ func TestStartLeafWithPingService(t *testing.T) {
 			}
 		}
 
-		err = os.RemoveAll(tempLogDir)
-		if err != nil {
-			log.Printf("Failed to remove temporary log directory %s: %v", tempLogDir, err)
-		}
-
 		os.Unsetenv("PLANTARIUM_LOG_FOLDER")
 	})
 }
 
+func TestStartLeaf_NeverReadyLeavesNoProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	timeout := serviceStartupTimeout
+	serviceStartupTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { serviceStartupTimeout = timeout })
+
+	workingDir := t.TempDir()
+	t.Setenv("PLANTARIUM_LOG_FOLDER", t.TempDir())
+	t.Setenv("PLANTARIUM_ROOT_FOLDER", workingDir)
+	pidFile := filepath.Join(workingDir, "leaf.pid")
+	script := filepath.Join(workingDir, "leaf.sh")
+	assert.NoError(t, os.WriteFile(script, []byte("echo $$ > "+pidFile+"\nexec sleep 60\n"), 0o755))
+
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "stuck", Version: "v1"}
+	startMessage := "never printed"
+	db.Stems[key] = &models.Stem{Name: "stuck", Version: "v1", HAProxyBackend: "stuck", LeafInstances: map[string]*models.Leaf{},
+		Config: &models.StemConfig{Name: "stuck", Version: "v1", Command: "sh " + script, StartMessage: &startMessage, WorkingDir: &workingDir}}
+	leafManager := NewLeafManager(repos.NewLeafRepository(db), new(MockProxyClient), repos.NewStemRepository(db))
+
+	_, err := leafManager.StartLeaf("stuck", "v1", nil)
+	assert.ErrorContains(t, err, "not ready")
+	assert.Empty(t, db.Stems[key].LeafInstances)
+	for _, reservation := range leafPorts.reservations() {
+		assert.NotContains(t, reservation.owner, "stuck", "port %d is still reserved", reservation.port)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if assert.NoError(t, err) {
+		var pid int
+		_, err = fmt.Sscan(string(data), &pid)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool { return !processAlive(pid) }, 5*time.Second, 50*time.Millisecond, "process %d of the leaf is still running", pid)
+	}
+}
+
 func determinePingCommand() string {
 	switch runtime.GOOS {
 	case "windows":
@@ -151,7 +185,7 @@ func TestLeafManager_GetRunningLeafs(t *testing.T) {
 
 	leafStorage.Stems[stemKey] = stem
 
-	mockHAProxyClient := new(MockHAProxyClient)
+	mockHAProxyClient := new(MockProxyClient)
 	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, stemRepo)
 
 	err := leafRepo.AddLeaf(stemKey, "leaf1", "haproxy-server", 12345, 8080, time.Now())
@@ -231,23 +265,105 @@ func TestStopLeaf(t *testing.T) {
 	leafStorage.Stems[stemKey] = stem
 
 	// Mock HAProxyClient
-	mockHAProxyClient := new(MockHAProxyClient)
+	mockHAProxyClient := new(MockProxyClient)
 	mockHAProxyClient.On("UnbindLeaf", "test-backend", "haproxy-server").Return(nil)
 
 	// Create the LeafManager
 	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, stemRepo)
+	leafManager.Events = NewEventLog(0)
 
 	// Stop the leaf
 	err = leafManager.StopLeaf(stemKey.Name, stemKey.Version, leafID)
 	assert.NoError(t, err, "failed to stop leaf")
 
-	// Verify HAProxyClient UnbindLeaf was called with correct arguments
+	// Verify ProxyClient UnbindLeaf was called with correct arguments
 	mockHAProxyClient.AssertCalled(t, "UnbindLeaf", "test-backend", "haproxy-server")
 
 	// Verify that the leaf is removed directly in the in-memory database
 	stemInDB, exists := leafStorage.Stems[stemKey]
 	assert.True(t, exists, "stem should still exist in the database")
 	assert.Empty(t, stemInDB.LeafInstances, "stem should have no leaf instances remaining")
+
+	// Stopping the last running leaf scales the stem to zero
+	events := leafManager.Events.List(EventQuery{Type: models.EventStemScaledToZero})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, leafID, events[0].Leaf)
+	}
+}
+
+// drainingProxyClient is a MockProxyClient that drains servers, reporting fewer sessions on every check.
+type drainingProxyClient struct {
+	*MockProxyClient
+	drained  []string
+	sessions int64
+}
+
+func (c *drainingProxyClient) DrainServer(backendName, serverName string) error {
+	c.drained = append(c.drained, serverName)
+	return nil
+}
+
+func (c *drainingProxyClient) ActiveSessions(backendName string) (map[string]int64, error) {
+	sessions := c.sessions
+	if c.sessions > 0 {
+		c.sessions--
+	}
+	return map[string]int64{"haproxy-server": sessions}, nil
+}
+
+func TestStopLeaf_Stages(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	stemKey := storage.StemKey{Name: "test-stem", Version: "v1.0"}
+	leafID := "test-leaf-123"
+
+	cmd := exec.Command("ping", "localhost", "-t")
+	assert.NoError(t, cmd.Start(), "failed to start ping process")
+	defer cmd.Process.Kill()
+	go cmd.Wait()
+
+	db.Stems[stemKey] = &models.Stem{
+		Name:           stemKey.Name,
+		Type:           models.StemTypeDeployment,
+		HAProxyBackend: "test-backend",
+		Version:        stemKey.Version,
+		Config:         &models.StemConfig{Name: stemKey.Name, Version: stemKey.Version, URL: "/test", DrainTimeout: "5s"},
+		LeafInstances: map[string]*models.Leaf{
+			leafID: {ID: leafID, Status: models.StatusRunning, PID: cmd.Process.Pid, HAProxyServer: "haproxy-server"},
+		},
+	}
+
+	mockProxyClient := new(MockProxyClient)
+	proxyClient := &drainingProxyClient{MockProxyClient: mockProxyClient, sessions: 1}
+	mockProxyClient.On("UnbindLeaf", "test-backend", "haproxy-server").Return(assert.AnError).Once()
+	leafManager := NewLeafManager(repos.NewLeafRepository(db), proxyClient, repos.NewStemRepository(db))
+
+	// A failed stage leaves the leaf stopping, with the failure in its history
+	err := leafManager.StopLeaf(stemKey.Name, stemKey.Version, leafID)
+	assert.ErrorContains(t, err, "failed to unbind leaf from HAProxy")
+	leaf := db.Stems[stemKey].LeafInstances[leafID]
+	assert.Equal(t, models.StatusStopping, leaf.Status)
+	assert.Equal(t, []string{"haproxy-server"}, proxyClient.drained)
+	if assert.Len(t, leaf.History, 2) {
+		assert.Equal(t, StopStageDrain, leaf.History[0].Stage)
+		assert.Empty(t, leaf.History[0].Error)
+		assert.Equal(t, StopStageUnbind, leaf.History[1].Stage)
+		assert.Equal(t, assert.AnError.Error(), leaf.History[1].Error)
+	}
+
+	// Stopping again runs the remaining stages, the leaf exits on its stop signal without being killed
+	mockProxyClient.On("UnbindLeaf", "test-backend", "haproxy-server").Return(nil).Once()
+	assert.NoError(t, leafManager.StopLeaf(stemKey.Name, stemKey.Version, leafID))
+	stages := make([]string, len(leaf.History))
+	for i, stage := range leaf.History {
+		stages[i] = stage.Stage
+	}
+	assert.Equal(t, []string{StopStageDrain, StopStageUnbind, StopStageDrain, StopStageUnbind, StopStageTerminate}, stages)
+	assert.Empty(t, db.Stems[stemKey].LeafInstances)
+
+	// A leaf whose process is already gone is only unbound and cleaned up
+	db.Stems[stemKey].LeafInstances["dead-leaf"] = &models.Leaf{ID: "dead-leaf", Status: models.StatusStandby, PID: 1 << 30}
+	assert.NoError(t, leafManager.StopLeaf(stemKey.Name, stemKey.Version, "dead-leaf"))
+	assert.Empty(t, db.Stems[stemKey].LeafInstances)
 }
 
 func TestStartGraftNodeLeaf(t *testing.T) {
@@ -257,13 +373,10 @@ func TestStartGraftNodeLeaf(t *testing.T) {
 	t.Cleanup(patch.Unpatch)
 
 	// Setup temporary log directory
-	tempLogDir := "../../.test-logs"
+	tempLogDir := t.TempDir()
 	err := os.Setenv("PLANTARIUM_LOG_FOLDER", tempLogDir)
 	assert.NoError(t, err, "failed to set PLANTARIUM_LOG_FOLDER environment variable")
 
-	err = os.MkdirAll(tempLogDir, os.ModePerm)
-	assert.NoError(t, err, "failed to create test log directory")
-
 	// Setup in-memory storage and repositories
 	leafStorage := storage.GetHerbariumDB()
 	leafStorage.Clear()
@@ -293,8 +406,8 @@ func TestStartGraftNodeLeaf(t *testing.T) {
 	leafStorage.Stems[stemKey] = stem
 
 	// Mock HAProxyClient
-	mockHAProxyClient := new(MockHAProxyClient)
-	mockHAProxyClient.On("BindStem", "test-backend").Return(nil)
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindStem", "test-backend", proxy.BackendOptions{}).Return(nil)
 	mockHAProxyClient.On("ReplaceLeaf", "test-backend", "test-stem-1.0.0-graftnode", mock.Anything, "localhost", mock.AnythingOfType("int")).Run(func(args mock.Arguments) {
 		log.Printf("ReplaceLeaf called with args: %v", args)
 	}).Return(nil)
@@ -317,12 +430,167 @@ func TestStartGraftNodeLeaf(t *testing.T) {
 	assert.Equal(t, graftNode.ID, "test-stem-1.0.0-graftnode")
 	assert.Equal(t, graftNode.Status, models.StatusRunning)
 
-	t.Cleanup(func() {
-		err = os.RemoveAll(tempLogDir)
-		if err != nil {
-			log.Printf("Failed to remove temporary log directory %s: %v", tempLogDir, err)
+	t.Cleanup(func() { os.Unsetenv("PLANTARIUM_LOG_FOLDER") })
+}
+
+func TestStopGraftNodeLeaf(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	leafRepo := repos.NewLeafRepository(db)
+	stemKey := storage.StemKey{Name: "test-stem", Version: "1.0.0"}
+	db.Stems[stemKey] = &models.Stem{
+		Name:           stemKey.Name,
+		Type:           models.StemTypeDeployment,
+		WorkingURL:     "/test",
+		HAProxyBackend: "test-backend",
+		Version:        stemKey.Version,
+		LeafInstances:  map[string]*models.Leaf{},
+		Config:         &models.StemConfig{Name: "test-service", URL: "/test", Command: determinePingCommand(), Version: stemKey.Version},
+	}
+
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindLeaf", "test-backend", "test-stem-1.0.0-graftnode", "localhost", mock.AnythingOfType("int")).Return(nil)
+	mockHAProxyClient.On("UnbindLeaf", "test-backend", "test-stem-1.0.0-graftnode").Return(nil).Once()
+	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, repos.NewStemRepository(db))
+
+	_, err := leafManager.StartGraftNodeLeaf(stemKey.Name, stemKey.Version)
+	assert.NoError(t, err, "failed to start graft node leaf")
+	graftNode, _ := leafRepo.GetGraftNode(stemKey)
+	address := fmt.Sprintf("localhost:%d", graftNode.Port)
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
 		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond, "graft node server should listen")
 
-		os.Unsetenv("PLANTARIUM_LOG_FOLDER")
-	})
+	// The server stops listening and the graft node is unbound and cleared
+	assert.NoError(t, leafManager.StopGraftNodeLeaf(stemKey.Name, stemKey.Version))
+	_, err = net.Dial("tcp", address)
+	assert.Error(t, err, "graft node server should be shut down")
+	mockHAProxyClient.AssertExpectations(t)
+	graftNode, err = leafRepo.GetGraftNode(stemKey)
+	assert.NoError(t, err)
+	assert.Nil(t, graftNode)
+
+	// Stems without a graft node are left alone
+	assert.NoError(t, leafManager.StopGraftNodeLeaf(stemKey.Name, stemKey.Version))
+}
+
+func TestGetWorkingDirectory_Override(t *testing.T) {
+	tempRootDir := "../../testdata"
+	err := os.Setenv("PLANTARIUM_ROOT_FOLDER", tempRootDir)
+	assert.NoError(t, err, "failed to set PLANTARIUM_ROOT_FOLDER environment variable")
+	defer os.Unsetenv("PLANTARIUM_ROOT_FOLDER")
+
+	// Default layout: services/<name>/<version>
+	workingDir, err := getWorkingDirectory("ping-service-stem", "v1.0", &models.StemConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempRootDir, "services", "ping-service-stem", "v1.0"), workingDir)
+
+	// Relative override is resolved against the root folder
+	override := "services/hello-service/v1.1"
+	workingDir, err = getWorkingDirectory("ping-service-stem", "v1.0", &models.StemConfig{WorkingDir: &override})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempRootDir, override), workingDir)
+
+	// Missing override directory is reported
+	missing := "services/does-not-exist"
+	_, err = getWorkingDirectory("ping-service-stem", "v1.0", &models.StemConfig{WorkingDir: &missing})
+	assert.Error(t, err)
+}
+
+func TestPrepareDataDirectory(t *testing.T) {
+	tempRootDir := t.TempDir()
+	err := os.Setenv("PLANTARIUM_ROOT_FOLDER", tempRootDir)
+	assert.NoError(t, err, "failed to set PLANTARIUM_ROOT_FOLDER environment variable")
+	defer os.Unsetenv("PLANTARIUM_ROOT_FOLDER")
+
+	// No data directory declared
+	dataDir, err := prepareDataDirectory(&models.StemConfig{})
+	assert.NoError(t, err)
+	assert.Empty(t, dataDir)
+
+	// Declared data directory is created under the root folder
+	declared := "data/ping-service-stem"
+	dataDir, err = prepareDataDirectory(&models.StemConfig{DataDir: &declared})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempRootDir, declared), dataDir)
+
+	info, err := os.Stat(dataDir)
+	assert.NoError(t, err, "data directory should exist")
+	assert.True(t, info.IsDir())
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, dataDirPermissions, info.Mode().Perm())
+	}
+}
+
+func TestStartGraftNodeLeaf_PortRange(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	leafRepo := repos.NewLeafRepository(db)
+	stemKey := storage.StemKey{Name: "ranged", Version: "1.0.0"}
+	db.Stems[stemKey] = &models.Stem{
+		Name:           stemKey.Name,
+		WorkingURL:     "/ranged",
+		HAProxyBackend: "ranged-backend",
+		Version:        stemKey.Version,
+		LeafInstances:  map[string]*models.Leaf{},
+		Config:         &models.StemConfig{Name: "ranged", URL: "/ranged", Version: stemKey.Version, PortRange: "19400-19409"},
+	}
+
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindLeaf", "ranged-backend", "ranged-1.0.0-graftnode", "localhost", mock.AnythingOfType("int")).Return(nil)
+	mockHAProxyClient.On("UnbindLeaf", "ranged-backend", "ranged-1.0.0-graftnode").Return(nil)
+	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, repos.NewStemRepository(db))
+
+	_, err := leafManager.StartGraftNodeLeaf(stemKey.Name, stemKey.Version)
+	assert.NoError(t, err)
+	graftNode, _ := leafRepo.GetGraftNode(stemKey)
+	assert.GreaterOrEqual(t, graftNode.Port, 19400)
+	assert.LessOrEqual(t, graftNode.Port, 19409)
+
+	// The port stays reserved until the graft node stops, so no leaf is handed the same one
+	assert.Error(t, leafPorts.Reserve("tcp", graftNode.Port, "other"))
+	assert.NoError(t, leafManager.StopGraftNodeLeaf(stemKey.Name, stemKey.Version))
+	assert.NoError(t, leafPorts.Reserve("tcp", graftNode.Port, "other"))
+	leafPorts.Release("tcp", graftNode.Port)
+}
+
+func TestStartGraftNodeLeaf_BindAddress(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	leafRepo := repos.NewLeafRepository(db)
+	stemKey := storage.StemKey{Name: "bound", Version: "1.0.0"}
+	db.Stems[stemKey] = &models.Stem{
+		Name:           stemKey.Name,
+		WorkingURL:     "/bound",
+		HAProxyBackend: "bound-backend",
+		Version:        stemKey.Version,
+		LeafInstances:  map[string]*models.Leaf{},
+		Config:         &models.StemConfig{Name: "bound", URL: "/bound", Version: stemKey.Version},
+	}
+
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindLeaf", "bound-backend", "bound-1.0.0-graftnode", "127.0.0.1", mock.AnythingOfType("int")).Return(nil)
+	mockHAProxyClient.On("UnbindLeaf", "bound-backend", "bound-1.0.0-graftnode").Return(nil)
+	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, repos.NewStemRepository(db))
+	leafManager.BindAddress = "127.0.0.1"
+
+	_, err := leafManager.StartGraftNodeLeaf(stemKey.Name, stemKey.Version)
+	assert.NoError(t, err)
+	graftNode, _ := leafRepo.GetGraftNode(stemKey)
+
+	// The graft node server listens on the bind address its leafs would, which the proxy was given
+	leafManager.graftMu.Lock()
+	address := leafManager.graftServers[stemKey].Addr
+	leafManager.graftMu.Unlock()
+	assert.Equal(t, fmt.Sprintf("127.0.0.1:%d", graftNode.Port), address)
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond, "graft node server should listen on the bind address")
+	assert.NoError(t, leafManager.StopGraftNodeLeaf(stemKey.Name, stemKey.Version))
+	mockHAProxyClient.AssertExpectations(t)
 }
@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// ErrLeafNotRunning is returned by RollLeaf for leafs that are not running, such as standby or stopping leafs.
+var ErrLeafNotRunning = errors.New("leaf is not running")
+
+// RollLeaf replaces a running leaf with a fresh one, which picks up changes to the stem's environment and
+// secrets without a redeploy. The fresh leaf is started and, once it is ready, swapped for the old leaf in a
+// single proxy change. The proxy then sends the old leaf no new requests, so it only finishes the requests in
+// flight before it is stopped with its stop signal. UDP stems have no proxy, their old leaf is stopped after
+// the fresh one started. The old leaf keeps serving if the fresh one fails to start. It returns the ID of
+// the fresh leaf.
+func (l *LeafManager) RollLeaf(key storage.StemKey, leafID string) (string, error) {
+	stem, err := l.StemRepo.FetchStem(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to find stem %s: %v", key, err)
+	}
+	leaf, exists := stem.LeafInstances[leafID]
+	if !exists {
+		return "", fmt.Errorf("leaf with ID %s not found in stem %s", leafID, key)
+	}
+	if leaf.Status != models.StatusRunning {
+		return "", fmt.Errorf("cannot roll leaf %s with status %s: %w", leafID, leaf.Status, ErrLeafNotRunning)
+	}
+
+	var replaceServer *string
+	if proxied(stem.Config) {
+		replaceServer = &leaf.HAProxyServer
+	}
+	freshID, err := l.StartLeaf(key.Name, key.Version, replaceServer)
+	if err != nil {
+		return "", fmt.Errorf("failed to start a leaf in place of %s: %v", leafID, err)
+	}
+	log.Printf("Leaf %s of stem %s version %s took over from leaf %s", freshID, key.Name, key.Version, leafID)
+
+	if err := l.stopLeaf(key, leafID, replaceServer != nil); err != nil {
+		return freshID, fmt.Errorf("leaf %s took over, but failed to stop leaf %s: %v", freshID, leafID, err)
+	}
+	countRestart(l.StemRepo, key)
+	return freshID, nil
+}
@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLeafManager_RollLeaf(t *testing.T) {
+	t.Setenv("PLANTARIUM_LOG_FOLDER", t.TempDir())
+	t.Setenv("PLANTARIUM_ROOT_FOLDER", "../../testdata")
+
+	cmd := exec.Command("ping", "localhost", "-t")
+	assert.NoError(t, cmd.Start(), "failed to start ping process")
+	defer cmd.Process.Kill()
+	go cmd.Wait()
+
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "ping-service-stem", Version: "v1.0"}
+	startMessage := "from 127.0.0.1"
+	db.Stems[key] = &models.Stem{
+		Name:           key.Name,
+		Type:           models.StemTypeDeployment,
+		WorkingURL:     "/ping",
+		HAProxyBackend: "ping-backend",
+		Version:        key.Version,
+		Config: &models.StemConfig{Name: "ping-service", Version: key.Version, URL: "/ping",
+			Command: determinePingCommand(), StartMessage: &startMessage},
+		LeafInstances: map[string]*models.Leaf{
+			"old-leaf": {ID: "old-leaf", Status: models.StatusRunning, PID: cmd.Process.Pid, HAProxyServer: "old-leaf"},
+			"standby":  {ID: "standby", Status: models.StatusStandby, HAProxyServer: "standby"},
+		},
+	}
+
+	mockProxyClient := new(MockProxyClient)
+	mockProxyClient.On("ReplaceLeaf", "ping-backend", "old-leaf", mock.Anything, "localhost", mock.Anything).Return(nil).Once()
+	leafManager := NewLeafManager(repos.NewLeafRepository(db), mockProxyClient, repos.NewStemRepository(db))
+
+	// The fresh leaf takes over the old leaf's server, which is stopped without being unbound
+	freshID, err := leafManager.RollLeaf(key, "old-leaf")
+	assert.NoError(t, err)
+	mockProxyClient.AssertExpectations(t)
+	mockProxyClient.AssertNotCalled(t, "UnbindLeaf", mock.Anything, mock.Anything)
+	leafs := db.Stems[key].LeafInstances
+	assert.NotContains(t, leafs, "old-leaf")
+	if fresh := leafs[freshID]; assert.NotNil(t, fresh) {
+		defer stopProcessByPID(fresh.PID)
+		assert.Equal(t, models.StatusRunning, fresh.Status)
+	}
+
+	_, err = leafManager.RollLeaf(key, "standby")
+	assert.ErrorIs(t, err, ErrLeafNotRunning)
+	_, err = leafManager.RollLeaf(key, "missing")
+	assert.ErrorContains(t, err, "leaf with ID missing not found")
+}
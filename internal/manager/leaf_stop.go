@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Stages of stopping a leaf, as recorded in its status history.
+const (
+	StopStageDrain     = "drain"     // The proxy sends the leaf no new requests and those in flight finish
+	StopStageUnbind    = "unbind"    // The leaf's server is removed from the proxy
+	StopStageTerminate = "terminate" // The leaf gets its stop signal and exits
+	StopStageKill      = "kill"      // The leaf and its children are killed after they didn't exit in time
+	StopStageStop      = "stop"      // The remote runtime running the leaf stops it
+	StopStageCleanup   = "cleanup"   // The leaf's port is released and the leaf is removed from the repository
+)
+
+// DefaultDrainTimeout is how long requests in flight to a stopping leaf may take to finish when its stem
+// doesn't set drainTimeout.
+const DefaultDrainTimeout = 10 * time.Second
+
+// drainCheckInterval is how often the proxy is asked whether a draining leaf still has requests in flight.
+const drainCheckInterval = 100 * time.Millisecond
+
+// drainTimeout returns how long requests in flight to a stem's stopping leafs may take to finish, 0 to not
+// drain them.
+func drainTimeout(config *models.StemConfig) time.Duration {
+	if config == nil || config.DrainTimeout == "" {
+		return DefaultDrainTimeout
+	}
+	if timeout, err := time.ParseDuration(config.DrainTimeout); err == nil && timeout >= 0 {
+		return timeout
+	}
+	return DefaultDrainTimeout
+}
+
+// leafUnbound reports whether an earlier attempt to stop a leaf already unbound it from the proxy.
+func leafUnbound(leaf *models.Leaf) bool {
+	for _, stage := range leaf.History {
+		if stage.Stage == StopStageUnbind && stage.Error == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// runStopStage runs a stage of stopping a leaf, logs how long it took and adds it to the leaf's status history.
+func (l *LeafManager) runStopStage(key storage.StemKey, leafID, stage string, run func() error) error {
+	started := time.Now()
+	err := run()
+	record := models.LeafStage{Stage: stage, Status: models.StatusStopping, Started: started, Duration: time.Since(started)}
+	if err != nil {
+		record.Error = err.Error()
+		log.Printf("Stopping leaf %s of stem %s version %s: %s failed after %s: %v", leafID, key.Name, key.Version, stage, record.Duration, err)
+	} else {
+		log.Printf("Stopping leaf %s of stem %s version %s: %s took %s", leafID, key.Name, key.Version, stage, record.Duration)
+	}
+
+	// The leaf is gone after a successful cleanup, so only the log shows that stage
+	if stage != StopStageCleanup || err != nil {
+		if historyErr := l.LeafRepo.AddLeafStage(key, leafID, record); historyErr != nil {
+			log.Printf("Failed to record %s stage of leaf %s: %v", stage, leafID, historyErr)
+		}
+	}
+	return err
+}
+
+// drainLeaf stops the proxy from sending a leaf new requests, then waits until the requests in flight
+// finished or the drain timeout passed.
+func drainLeaf(drainer proxy.Drainer, backendName, serverName string, timeout time.Duration) error {
+	if err := drainer.DrainServer(backendName, serverName); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		sessions, err := drainer.ActiveSessions(backendName)
+		if err != nil {
+			return err
+		}
+		active := sessions[serverName]
+		if active == 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%d requests still in flight after %s", active, timeout)
+		}
+		time.Sleep(drainCheckInterval)
+	}
+}
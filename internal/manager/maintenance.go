@@ -0,0 +1,183 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultMaintenancePage is served in maintenance mode when neither the request nor the global config
+// provides a page.
+const DefaultMaintenancePage = `<!DOCTYPE html>
+<html>
+<head><title>Down for maintenance</title></head>
+<body>
+<h1>Down for maintenance</h1>
+<p>This service is undergoing maintenance and will be back shortly.</p>
+</body>
+</html>
+`
+
+// ErrMaintenance is returned for deployments attempted while the platform is in maintenance mode.
+var ErrMaintenance = errors.New("the platform is in maintenance mode")
+
+// Maintenance switches the backends of all stems to a 503 maintenance page and back. While the platform is
+// in maintenance mode it vetoes stem registrations, so it is registered as a hook at
+// hooks.BeforeRegisterStem. The admin API is not a stem and stays reachable.
+type Maintenance struct {
+	StemRepo    repos.StemRepositoryInterface
+	ProxyClient proxy.ProxyClient
+	PageFile    string    // HTML page served when Enter gets none, empty for DefaultMaintenancePage
+	Events      *EventLog // Receives an event when maintenance mode is entered or exited, nil to only log it
+
+	mu       sync.Mutex
+	now      func() time.Time
+	since    time.Time // Zero while not in maintenance mode
+	backends []string  // Backends switched to the page, restored on exit
+}
+
+// NewMaintenance creates a Maintenance for the stems in stemRepo, which is not in maintenance mode.
+func NewMaintenance(stemRepo repos.StemRepositoryInterface, proxyClient proxy.ProxyClient, pageFile string) *Maintenance {
+	return &Maintenance{
+		StemRepo:    stemRepo,
+		ProxyClient: proxyClient,
+		PageFile:    pageFile,
+		now:         time.Now,
+	}
+}
+
+// Enter switches the backends of all proxied stems to the page, or to the configured page when it is empty.
+// Entering again while in maintenance mode changes nothing.
+func (m *Maintenance) Enter(page string) (models.MaintenanceStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.since.IsZero() {
+		return m.status(), nil
+	}
+
+	switcher, ok := m.ProxyClient.(proxy.MaintenanceSwitcher)
+	if !ok {
+		return m.status(), fmt.Errorf("the proxy does not support maintenance mode")
+	}
+	if page == "" {
+		var err error
+		if page, err = m.Page(); err != nil {
+			return m.status(), err
+		}
+	}
+	stems, err := m.StemRepo.GetAllStems()
+	if err != nil {
+		return m.status(), fmt.Errorf("failed to list stems: %v", err)
+	}
+	// Stems already in maintenance keep their servers switched when the platform leaves maintenance mode
+	var backends []string
+	for _, stem := range stems {
+		if stem.HAProxyBackend != "" && proxied(stem.Config) && !stem.Maintenance {
+			backends = append(backends, stem.HAProxyBackend)
+		}
+	}
+	sort.Strings(backends)
+
+	if err := switcher.EnterMaintenance(backends, page); err != nil {
+		return m.status(), fmt.Errorf("failed to enter maintenance mode: %v", err)
+	}
+	m.since, m.backends = m.now(), backends
+	log.Printf("Entered maintenance mode for %d backends", len(backends))
+	m.Events.Record(models.Event{
+		Time:    m.since,
+		Type:    models.EventMaintenanceEntered,
+		Message: fmt.Sprintf("Entered maintenance mode, %d backends answer with the maintenance page", len(backends)),
+	})
+	return m.status(), nil
+}
+
+// Exit routes requests to the leafs of the backends switched by Enter again. Exiting while not in maintenance
+// mode changes nothing.
+func (m *Maintenance) Exit() (models.MaintenanceStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.since.IsZero() {
+		return m.status(), nil
+	}
+
+	switcher, ok := m.ProxyClient.(proxy.MaintenanceSwitcher)
+	if !ok {
+		return m.status(), fmt.Errorf("the proxy does not support maintenance mode")
+	}
+	if err := switcher.ExitMaintenance(m.backends); err != nil {
+		return m.status(), fmt.Errorf("failed to exit maintenance mode: %v", err)
+	}
+	duration := m.now().Sub(m.since).Round(time.Second)
+	m.since, m.backends = time.Time{}, nil
+	log.Printf("Exited maintenance mode after %s", duration)
+	m.Events.Record(models.Event{
+		Type:    models.EventMaintenanceExited,
+		Message: fmt.Sprintf("Exited maintenance mode after %s", duration),
+	})
+	return m.status(), nil
+}
+
+// Status reports whether the platform is in maintenance mode.
+func (m *Maintenance) Status() models.MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status()
+}
+
+// Run vetoes stem registrations while the platform is in maintenance mode.
+func (m *Maintenance) Run(op *hooks.Operation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.since.IsZero() {
+		return ErrMaintenance
+	}
+	return nil
+}
+
+// status builds the current status. The caller must hold mu.
+func (m *Maintenance) status() models.MaintenanceStatus {
+	if m.since.IsZero() {
+		return models.MaintenanceStatus{}
+	}
+	since := m.since
+	return models.MaintenanceStatus{Enabled: true, Since: &since, Backends: append([]string(nil), m.backends...)}
+}
+
+// Page reads the configured page file, falling back to DefaultMaintenancePage when none is configured or m
+// is nil.
+func (m *Maintenance) Page() (string, error) {
+	if m == nil || m.PageFile == "" {
+		return DefaultMaintenancePage, nil
+	}
+	data, err := os.ReadFile(m.PageFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read maintenance page: %v", err)
+	}
+	return string(data), nil
+}
+
+// switchStemMaintenance puts the servers of a stem's backend into maintenance, answering its requests with the
+// page of maintenance, or takes them out again.
+func switchStemMaintenance(proxyClient proxy.ProxyClient, maintenance *Maintenance, stem *models.Stem, enabled bool) error {
+	switcher, ok := proxyClient.(proxy.BackendMaintenanceSwitcher)
+	if !ok {
+		return fmt.Errorf("the proxy does not support maintenance mode")
+	}
+	var page string
+	if enabled {
+		var err error
+		if page, err = maintenance.Page(); err != nil {
+			return err
+		}
+	}
+	return switcher.SetBackendMaintenance(stem.HAProxyBackend, enabled, page)
+}
@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// switchingProxyClient is a MockProxyClient that also records maintenance switches.
+type switchingProxyClient struct {
+	*MockProxyClient
+	backends []string
+	page     string
+	err      error
+}
+
+func (c *switchingProxyClient) EnterMaintenance(backendNames []string, page string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.backends, c.page = backendNames, page
+	return nil
+}
+
+func (c *switchingProxyClient) ExitMaintenance(backendNames []string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.backends, c.page = nil, ""
+	return nil
+}
+
+func TestMaintenance_EnterAndExit(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[storage.StemKey{Name: "web", Version: "v1"}] = &models.Stem{Name: "web", Version: "v1", HAProxyBackend: "web",
+		Config: &models.StemConfig{Name: "web", Version: "v1", URL: "/web"}}
+	db.Stems[storage.StemKey{Name: "api", Version: "v1"}] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api"}}
+	db.Stems[storage.StemKey{Name: "dns", Version: "v1"}] = &models.Stem{Name: "dns", Version: "v1",
+		Config: &models.StemConfig{Name: "dns", Version: "v1", Transport: proxy.TransportUDP}}
+
+	pageFile := filepath.Join(t.TempDir(), "maintenance.html")
+	assert.NoError(t, os.WriteFile(pageFile, []byte("<h1>Back soon</h1>"), 0644))
+	proxyClient := &switchingProxyClient{MockProxyClient: new(MockProxyClient)}
+	maintenance := NewMaintenance(repos.NewStemRepository(db), proxyClient, pageFile)
+	maintenance.Events = NewEventLog(0)
+	maintenance.now = func() time.Time { return now }
+	op := &hooks.Operation{Stem: models.StemConfig{Name: "new", Version: "v1"}}
+	assert.NoError(t, maintenance.Run(op))
+
+	// Proxied stems switch to the configured page and deployments are vetoed
+	status, err := maintenance.Enter("")
+	assert.NoError(t, err)
+	assert.Equal(t, models.MaintenanceStatus{Enabled: true, Since: &now, Backends: []string{"api", "web"}}, status)
+	assert.Equal(t, []string{"api", "web"}, proxyClient.backends)
+	assert.Equal(t, "<h1>Back soon</h1>", proxyClient.page)
+	assert.ErrorIs(t, maintenance.Run(op), ErrMaintenance)
+
+	// Entering again keeps the page
+	_, err = maintenance.Enter("<h1>Other</h1>")
+	assert.NoError(t, err)
+	assert.Equal(t, "<h1>Back soon</h1>", proxyClient.page)
+
+	// A failed exit stays in maintenance mode
+	proxyClient.err = assert.AnError
+	_, err = maintenance.Exit()
+	assert.ErrorContains(t, err, "failed to exit maintenance mode")
+	assert.True(t, maintenance.Status().Enabled)
+
+	proxyClient.err = nil
+	status, err = maintenance.Exit()
+	assert.NoError(t, err)
+	assert.Equal(t, models.MaintenanceStatus{}, status)
+	assert.Nil(t, proxyClient.backends)
+	assert.NoError(t, maintenance.Run(op))
+
+	events := maintenance.Events.List(EventQuery{})
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, models.EventMaintenanceEntered, events[0].Type)
+		assert.Equal(t, models.EventMaintenanceExited, events[1].Type)
+	}
+}
+
+func TestMaintenance_RequiresSwitcher(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	maintenance := NewMaintenance(repos.NewStemRepository(db), new(MockProxyClient), "")
+
+	_, err := maintenance.Enter("")
+	assert.ErrorContains(t, err, "the proxy does not support maintenance mode")
+	assert.False(t, maintenance.Status().Enabled)
+}
+
+// stemSwitchingProxyClient is a MockProxyClient that also records per-backend maintenance switches.
+type stemSwitchingProxyClient struct {
+	*switchingProxyClient
+	pages map[string]string
+}
+
+func (c *stemSwitchingProxyClient) SetBackendMaintenance(backendName string, enabled bool, page string) error {
+	if c.err != nil {
+		return c.err
+	}
+	if enabled {
+		c.pages[backendName] = page
+	} else {
+		delete(c.pages, backendName)
+	}
+	return nil
+}
+
+func TestStemManager_SetMaintenance(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	stemRepo := repos.NewStemRepository(db)
+	apiKey := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[apiKey] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api"}}
+	db.Stems[storage.StemKey{Name: "web", Version: "v1"}] = &models.Stem{Name: "web", Version: "v1", HAProxyBackend: "web",
+		Config: &models.StemConfig{Name: "web", Version: "v1", URL: "/web"}}
+	dnsKey := storage.StemKey{Name: "dns", Version: "v1"}
+	db.Stems[dnsKey] = &models.Stem{Name: "dns", Version: "v1",
+		Config: &models.StemConfig{Name: "dns", Version: "v1", Transport: proxy.TransportUDP}}
+
+	proxyClient := &stemSwitchingProxyClient{
+		switchingProxyClient: &switchingProxyClient{MockProxyClient: new(MockProxyClient)},
+		pages:                make(map[string]string),
+	}
+	stemManager := NewStemManager(stemRepo, new(MockLeafManager), proxyClient)
+	stemManager.Maintenance = NewMaintenance(stemRepo, proxyClient, "")
+
+	// The stem's backend answers with the maintenance page, its leafs are left alone
+	assert.NoError(t, stemManager.SetMaintenance(apiKey, true))
+	assert.Equal(t, map[string]string{"api": DefaultMaintenancePage}, proxyClient.pages)
+	assert.True(t, db.Stems[apiKey].Maintenance)
+	assert.NoError(t, stemManager.SetMaintenance(apiKey, true))
+
+	// The platform leaves stems already in maintenance switched
+	status, err := stemManager.Maintenance.Enter("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web"}, status.Backends)
+	assert.ErrorIs(t, stemManager.SetMaintenance(apiKey, false), ErrMaintenance)
+	_, err = stemManager.Maintenance.Exit()
+	assert.NoError(t, err)
+
+	assert.NoError(t, stemManager.SetMaintenance(apiKey, false))
+	assert.Empty(t, proxyClient.pages)
+	assert.False(t, db.Stems[apiKey].Maintenance)
+
+	// A failed switch leaves the stem as it was
+	proxyClient.err = assert.AnError
+	assert.Error(t, stemManager.SetMaintenance(apiKey, true))
+	assert.False(t, db.Stems[apiKey].Maintenance)
+
+	assert.ErrorContains(t, stemManager.SetMaintenance(dnsKey, true), "is not routed through the proxy")
+	assert.Error(t, stemManager.SetMaintenance(storage.StemKey{Name: "missing", Version: "v1"}, true))
+}
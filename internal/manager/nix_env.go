@@ -0,0 +1,255 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultNixTimeout bounds how long building the nix environment of a stem may take.
+const DefaultNixTimeout = 10 * time.Minute
+
+// ErrNoNix is returned when a stem declares a nix environment and the leaf manager has no way to build it.
+var ErrNoNix = errors.New("nix environments are not enabled")
+
+// nixSearchPaths are the variables a nix environment prepends to instead of replacing.
+var nixSearchPaths = []string{"PATH", "LD_LIBRARY_PATH"}
+
+// nixShellVars are variables of a dev shell that belong to the nix build sandbox, not to the environment.
+var nixShellVars = map[string]bool{
+	"HOME": true, "PWD": true, "OLDPWD": true, "SHLVL": true, "TERM": true, "SHELL": true,
+	"TMPDIR": true, "TMP": true, "TEMP": true, "TEMPDIR": true,
+	"NIX_BUILD_TOP": true, "NIX_BUILD_CORES": true, "NIX_LOG_FD": true, "NIX_ENFORCE_PURITY": true,
+}
+
+// nixCommand runs nix and returns its standard output.
+var nixCommand = func(ctx context.Context, binary string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v: %s", binary, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// NixEnvironments materializes the nix environments stems declare, so their leafs find their runtimes and
+// libraries without them being installed on the host. An environment is built when the first leaf needing it
+// starts and is kept for every later leaf with the same declaration.
+type NixEnvironments struct {
+	Binary  string        // Nix executable
+	Timeout time.Duration // How long building an environment may take
+
+	mu   sync.Mutex
+	envs map[string]*nixEnvironment // Environments by declaration
+}
+
+// nixEnvironment is the environment of one declaration, built once.
+type nixEnvironment struct {
+	mu   sync.Mutex // Held while building, so concurrent leaf starts wait for the same build
+	vars map[string]string
+}
+
+// NewNixEnvironments creates a store building environments with binary, within timeout.
+func NewNixEnvironments(binary string, timeout time.Duration) *NixEnvironments {
+	if binary == "" {
+		binary = "nix"
+	}
+	if timeout <= 0 {
+		timeout = DefaultNixTimeout
+	}
+	return &NixEnvironments{Binary: binary, Timeout: timeout, envs: make(map[string]*nixEnvironment)}
+}
+
+// NewNixEnvironmentsFromConfig creates the store configured by the nix section of the global config.
+func NewNixEnvironmentsFromConfig(config *models.GlobalConfig) *NixEnvironments {
+	timeout, err := time.ParseDuration(config.Nix.Timeout)
+	if config.Nix.Timeout != "" && err != nil {
+		log.Printf("Invalid nix.timeout %q, using %s: %v", config.Nix.Timeout, DefaultNixTimeout, err)
+	}
+	return NewNixEnvironments(config.Nix.Binary, timeout)
+}
+
+// Materialize returns the variables of the environment spec declares, building it unless it was built before.
+// The working directory is where relative flake references like .#billing are resolved.
+func (n *NixEnvironments) Materialize(spec *models.NixConfig, workingDir string) (map[string]string, error) {
+	key := nixKey(spec, workingDir)
+	n.mu.Lock()
+	env, ok := n.envs[key]
+	if !ok {
+		env = &nixEnvironment{}
+		n.envs[key] = env
+	}
+	n.mu.Unlock()
+
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	if env.vars != nil {
+		return env.vars, nil
+	}
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+	var vars map[string]string
+	var err error
+	if spec.Flake != "" {
+		vars, err = n.flakeEnvironment(ctx, spec.Flake, workingDir)
+	} else {
+		vars, err = n.packageEnvironment(ctx, spec.Packages)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to build nix environment: %w", err)
+	}
+	log.Printf("Built nix environment %s in %s", key, time.Since(started).Round(time.Millisecond))
+	env.vars = vars
+	return vars, nil
+}
+
+// flakeEnvironment returns the variables a flake's dev shell exports.
+func (n *NixEnvironments) flakeEnvironment(ctx context.Context, flake, workingDir string) (map[string]string, error) {
+	flake = resolveFlake(flake, workingDir)
+	output, err := nixCommand(ctx, n.Binary, "print-dev-env", "--json", flake)
+	if err != nil {
+		return nil, err
+	}
+	var shell struct {
+		Variables map[string]struct {
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		} `json:"variables"`
+	}
+	if err := json.Unmarshal(output, &shell); err != nil {
+		return nil, fmt.Errorf("failed to parse dev shell of %s: %v", flake, err)
+	}
+	vars := make(map[string]string)
+	for name, variable := range shell.Variables {
+		var value string
+		if variable.Type != "exported" || nixShellVars[name] || json.Unmarshal(variable.Value, &value) != nil {
+			continue
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// packageEnvironment builds packages and returns the PATH and LD_LIBRARY_PATH of their outputs.
+func (n *NixEnvironments) packageEnvironment(ctx context.Context, packages []string) (map[string]string, error) {
+	args := []string{"build", "--no-link", "--print-out-paths"}
+	for _, pkg := range packages {
+		if !strings.Contains(pkg, "#") {
+			pkg = "nixpkgs#" + pkg
+		}
+		args = append(args, pkg)
+	}
+	output, err := nixCommand(ctx, n.Binary, args...)
+	if err != nil {
+		return nil, err
+	}
+	var bins, libs []string
+	for _, out := range strings.Fields(string(output)) {
+		if info, err := os.Stat(filepath.Join(out, "bin")); err == nil && info.IsDir() {
+			bins = append(bins, filepath.Join(out, "bin"))
+		}
+		if info, err := os.Stat(filepath.Join(out, "lib")); err == nil && info.IsDir() {
+			libs = append(libs, filepath.Join(out, "lib"))
+		}
+	}
+	vars := make(map[string]string)
+	if len(bins) > 0 {
+		vars["PATH"] = strings.Join(bins, string(filepath.ListSeparator))
+	}
+	if len(libs) > 0 {
+		vars["LD_LIBRARY_PATH"] = strings.Join(libs, string(filepath.ListSeparator))
+	}
+	return vars, nil
+}
+
+// resolveFlake makes a flake reference relative to the working directory, like .#billing, absolute.
+func resolveFlake(flake, workingDir string) string {
+	if !strings.HasPrefix(flake, ".") {
+		return flake
+	}
+	ref, attribute, found := strings.Cut(flake, "#")
+	flake = filepath.Join(workingDir, ref)
+	if found {
+		flake += "#" + attribute
+	}
+	return flake
+}
+
+// nixKey identifies a declaration, relative flakes by the directory they are resolved in.
+func nixKey(spec *models.NixConfig, workingDir string) string {
+	if spec.Flake != "" {
+		return "flake " + resolveFlake(spec.Flake, workingDir)
+	}
+	packages := append([]string(nil), spec.Packages...)
+	sort.Strings(packages)
+	return "packages " + strings.Join(packages, " ")
+}
+
+// withNixEnvironment returns config with the variables of the stem's nix environment beneath its env. PATH and
+// LD_LIBRARY_PATH are prepended to the stem's or herbarium's own. The stem's own config is not modified.
+func (l *LeafManager) withNixEnvironment(stemName, version string, config *models.StemConfig) (*models.StemConfig, error) {
+	if config == nil || config.Nix == nil {
+		return config, nil
+	}
+	if l.Nix == nil {
+		return nil, fmt.Errorf("stem %s version %s declares a nix environment: %w", stemName, version, ErrNoNix)
+	}
+	workingDir, err := getWorkingDirectory(stemName, version, config)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := l.Nix.Materialize(config.Nix, workingDir)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string, len(vars)+len(config.Env))
+	for name, value := range vars {
+		env[name] = value
+	}
+	for name, value := range config.Env {
+		env[name] = value
+	}
+	for _, name := range nixSearchPaths {
+		nixValue, ok := vars[name]
+		if !ok {
+			continue
+		}
+		base, ok := config.Env[name]
+		if !ok {
+			base = os.Getenv(name)
+		}
+		env[name] = nixValue
+		if base != "" {
+			env[name] += string(filepath.ListSeparator) + base
+		}
+	}
+	resolved := *config
+	resolved.Env = env
+	return &resolved, nil
+}
+
+// lookPathIn finds an executable in the directories of path, empty when none of them has it.
+func lookPathIn(executable, path string) string {
+	for _, dir := range filepath.SplitList(path) {
+		candidate := filepath.Join(dir, executable)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return candidate
+		}
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubNix replaces nixCommand for a test, recording the arguments of every call.
+func stubNix(t *testing.T, output func(args []string) string) *[][]string {
+	calls := &[][]string{}
+	command := nixCommand
+	nixCommand = func(_ context.Context, binary string, args ...string) ([]byte, error) {
+		assert.Equal(t, "nix", binary)
+		*calls = append(*calls, args)
+		return []byte(output(args)), nil
+	}
+	t.Cleanup(func() { nixCommand = command })
+	return calls
+}
+
+func TestNixEnvironments_Packages(t *testing.T) {
+	store := t.TempDir()
+	jdk, ffmpeg := filepath.Join(store, "jdk21"), filepath.Join(store, "ffmpeg")
+	for _, dir := range []string{filepath.Join(jdk, "bin"), filepath.Join(jdk, "lib"), filepath.Join(ffmpeg, "bin")} {
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	calls := stubNix(t, func([]string) string { return jdk + "\n" + ffmpeg + "\n" })
+
+	nix := NewNixEnvironments("", time.Minute)
+	vars, err := nix.Materialize(&models.NixConfig{Packages: []string{"jdk21", "github:acme/tools#ffmpeg"}}, "/services/billing/v1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"PATH":            filepath.Join(jdk, "bin") + ":" + filepath.Join(ffmpeg, "bin"),
+		"LD_LIBRARY_PATH": filepath.Join(jdk, "lib"),
+	}, vars)
+	assert.Equal(t, [][]string{{"build", "--no-link", "--print-out-paths", "nixpkgs#jdk21", "github:acme/tools#ffmpeg"}}, *calls)
+
+	// The same packages in another order are built once
+	_, err = nix.Materialize(&models.NixConfig{Packages: []string{"github:acme/tools#ffmpeg", "jdk21"}}, "/services/billing/v2")
+	assert.NoError(t, err)
+	assert.Len(t, *calls, 1)
+}
+
+func TestNixEnvironments_Flake(t *testing.T) {
+	calls := stubNix(t, func([]string) string {
+		return `{"variables": {
+			"PATH": {"type": "exported", "value": "/nix/store/abc-jdk/bin"},
+			"JAVA_HOME": {"type": "exported", "value": "/nix/store/abc-jdk"},
+			"HOME": {"type": "exported", "value": "/homeless-shelter"},
+			"buildInputs": {"type": "var", "value": "/nix/store/abc-jdk"},
+			"outputs": {"type": "array", "value": ["out"]}
+		}}`
+	})
+
+	nix := NewNixEnvironments("", 0)
+	vars, err := nix.Materialize(&models.NixConfig{Flake: ".#billing"}, "/services/billing/v1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"PATH": "/nix/store/abc-jdk/bin", "JAVA_HOME": "/nix/store/abc-jdk"}, vars)
+	assert.Equal(t, [][]string{{"print-dev-env", "--json", "/services/billing/v1#billing"}}, *calls)
+
+	// Relative flakes of other working directories are other environments
+	_, err = nix.Materialize(&models.NixConfig{Flake: ".#billing"}, "/services/billing/v2")
+	assert.NoError(t, err)
+	assert.Len(t, *calls, 2)
+}
+
+func TestLeafManager_WithNixEnvironment(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("PLANTARIUM_ROOT_FOLDER", root)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "services", "billing", "v1"), 0755))
+	stubNix(t, func([]string) string {
+		return `{"variables": {"PATH": {"type": "exported", "value": "/nix/store/abc-jdk/bin"},
+			"JAVA_HOME": {"type": "exported", "value": "/nix/store/abc-jdk"}}}`
+	})
+
+	config := &models.StemConfig{Name: "billing", Version: "v1", Nix: &models.NixConfig{Flake: "github:acme/envs#jdk21"},
+		Env: map[string]string{"JAVA_HOME": "/opt/jdk", "PATH": "/opt/bin"}}
+	manager := &LeafManager{}
+	_, err := manager.withNixEnvironment("billing", "v1", config)
+	assert.ErrorIs(t, err, ErrNoNix)
+
+	// The stem's env overrides the environment, which is prepended to the stem's PATH
+	manager.Nix = NewNixEnvironments("", 0)
+	resolved, err := manager.withNixEnvironment("billing", "v1", config)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"JAVA_HOME": "/opt/jdk", "PATH": "/nix/store/abc-jdk/bin:/opt/bin"}, resolved.Env)
+	assert.Equal(t, "/opt/bin", config.Env["PATH"], "the stem's config is not modified")
+
+	// Without a PATH of its own, the stem's leafs get herbarium's after the environment's
+	delete(config.Env, "PATH")
+	resolved, err = manager.withNixEnvironment("billing", "v1", config)
+	assert.NoError(t, err)
+	assert.Equal(t, "/nix/store/abc-jdk/bin:"+os.Getenv("PATH"), resolved.Env["PATH"])
+}
+
+func TestLookPathIn(t *testing.T) {
+	bin := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "java"), []byte("#!/bin/sh\n"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "README"), []byte("docs"), 0644))
+
+	assert.Equal(t, filepath.Join(bin, "java"), lookPathIn("java", "/nonexistent:"+bin))
+	assert.Empty(t, lookPathIn("README", bin), "files that aren't executable are skipped")
+	assert.Empty(t, lookPathIn("javac", bin))
+}
@@ -0,0 +1,195 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultNodeMonitorInterval is how often the agents of the registered nodes are checked.
+const DefaultNodeMonitorInterval = 10 * time.Second
+
+// nodeFailureThreshold is how many checks in a row a node's agent must fail before the node is considered lost.
+const nodeFailureThreshold = 3
+
+// nodePinger is implemented by the leaf runtimes that can tell whether their host answers.
+type nodePinger interface {
+	Ping() error // Returns an error when the host doesn't answer
+}
+
+// NodeMonitor keeps stems running when a node is lost. It checks the agent of every registered node, and
+// once an agent failed nodeFailureThreshold checks in a row, it marks the node down, so no leafs are placed on
+// it, and reschedules its leafs: running leafs are replaced by leafs placed on the remaining nodes, taking over
+// their proxy servers, and the records of the other leafs are dropped. The lost leafs can't be stopped while
+// their agent doesn't answer, so they are stopped once it answers again, when the node takes new leafs again.
+// The herbarium host and nodes whose runtime can't be pinged are never considered lost.
+type NodeMonitor struct {
+	LeafManager *LeafManager
+	Events      *EventLog // Receives an event when a node is lost or recovers, nil to only log it
+
+	mu       sync.Mutex          // Serializes checks
+	failures map[string]int      // Failed checks in a row by node
+	lost     map[string][]string // Leafs rescheduled away from each lost node, stopped once it answers again
+}
+
+// NewNodeMonitor creates a NodeMonitor for the nodes leafManager places leafs on.
+func NewNodeMonitor(leafManager *LeafManager) *NodeMonitor {
+	return &NodeMonitor{
+		LeafManager: leafManager,
+		failures:    make(map[string]int),
+		lost:        make(map[string][]string),
+	}
+}
+
+// StartSchedule checks the nodes every interval until stop is closed.
+func (m *NodeMonitor) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Checking the agents of the nodes every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("node monitor", func() { m.Check() })
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Check pings the agent of every node, reschedules the leafs of nodes that were just lost, and brings back
+// lost nodes that answer again.
+func (m *NodeMonitor) Check() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes, err := m.LeafManager.NodeRepo.GetAllNodes()
+	if err != nil {
+		log.Printf("Failed to list nodes: %v", err)
+		return
+	}
+	for _, node := range nodes {
+		pinger, ok := m.LeafManager.Agents[node.Agent].(nodePinger)
+		if node.Agent == "" || !ok {
+			continue
+		}
+		err := pinger.Ping()
+		if err == nil {
+			delete(m.failures, node.Name)
+			if node.Down {
+				m.recover(node)
+			}
+			continue
+		}
+		if node.Down {
+			continue
+		}
+		m.failures[node.Name]++
+		log.Printf("Agent %s of node %s failed its check (%d of %d): %v", node.Agent, node.Name, m.failures[node.Name], nodeFailureThreshold, err)
+		if m.failures[node.Name] >= nodeFailureThreshold {
+			delete(m.failures, node.Name)
+			m.lose(node, err)
+		}
+	}
+}
+
+// setDown marks a node down or up. The stored node is replaced rather than changed, as placement reads it
+// without holding a lock.
+func (m *NodeMonitor) setDown(node *models.Node, down bool) error {
+	updated := *node
+	updated.Down = down
+	return m.LeafManager.NodeRepo.SaveNode(&updated)
+}
+
+// lose marks a node down and reschedules its leafs.
+func (m *NodeMonitor) lose(node *models.Node, cause error) {
+	if err := m.setDown(node, true); err != nil {
+		log.Printf("Failed to mark node %s down: %v", node.Name, err)
+		return
+	}
+	stems, err := m.LeafManager.StemRepo.GetAllStems()
+	if err != nil {
+		log.Printf("Failed to list stems to reschedule the leafs of node %s: %v", node.Name, err)
+		return
+	}
+
+	rescheduled, failed := 0, 0
+	for _, stem := range stems {
+		key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+		standby := false
+		for _, leaf := range stem.LeafInstances {
+			if leaf.Node != node.Name || leaf.Status == models.StatusStarting {
+				continue
+			}
+			if err := m.reschedule(key, stem, leaf); err != nil {
+				log.Printf("Failed to reschedule leaf %s of stem %s version %s: %v", leaf.ID, key.Name, key.Version, err)
+				failed++
+				continue
+			}
+			m.lost[node.Name] = append(m.lost[node.Name], leaf.ID)
+			standby = standby || leaf.Status == models.StatusStandby
+			rescheduled++
+		}
+		if standby {
+			if _, err := m.LeafManager.FillWarmPool(key.Name, key.Version); err != nil {
+				log.Printf("Failed to refill the warm pool of stem %s version %s: %v", key.Name, key.Version, err)
+			}
+		}
+	}
+
+	message := fmt.Sprintf("Node %s was lost (%v), rescheduled %d leafs", node.Name, cause, rescheduled)
+	if failed > 0 {
+		message += fmt.Sprintf(", failed to reschedule %d leafs", failed)
+	}
+	log.Print(message)
+	m.Events.Record(models.Event{Type: models.EventNodeLost, Message: message})
+}
+
+// reschedule replaces a running leaf of a lost node with a leaf placed on another node, then drops the lost
+// leaf's record. A running leaf that can't be replaced is unbound, so the proxy stops sending it requests.
+func (m *NodeMonitor) reschedule(key storage.StemKey, stem *models.Stem, leaf *models.Leaf) error {
+	bound := leaf.Status == models.StatusRunning && proxied(stem.Config) && !leafUnbound(leaf)
+	if leaf.Status == models.StatusRunning {
+		var replaceServer *string
+		if bound {
+			replaceServer = &leaf.HAProxyServer
+		}
+		freshID, err := m.LeafManager.StartLeaf(key.Name, key.Version, replaceServer)
+		if err != nil {
+			log.Printf("Failed to start a leaf in place of leaf %s of stem %s version %s: %v", leaf.ID, key.Name, key.Version, err)
+		} else {
+			log.Printf("Leaf %s of stem %s version %s took over from lost leaf %s", freshID, key.Name, key.Version, leaf.ID)
+			bound = false
+		}
+	}
+	if bound {
+		if err := m.LeafManager.ProxyClient.UnbindLeaf(stem.HAProxyBackend, leaf.HAProxyServer); err != nil {
+			return fmt.Errorf("failed to unbind leaf from the proxy: %v", err)
+		}
+	}
+	return m.LeafManager.LeafRepo.RemoveLeaf(key, leaf.ID)
+}
+
+// recover marks a lost node up again and stops the leafs that were rescheduled away from it.
+func (m *NodeMonitor) recover(node *models.Node) {
+	runtime := m.LeafManager.Agents[node.Agent]
+	for _, leafID := range m.lost[node.Name] {
+		if err := runtime.StopLeaf(leafID); err != nil {
+			log.Printf("Failed to stop lost leaf %s on node %s: %v", leafID, node.Name, err)
+		}
+	}
+	delete(m.lost, node.Name)
+	if err := m.setDown(node, false); err != nil {
+		log.Printf("Failed to mark node %s up: %v", node.Name, err)
+		return
+	}
+
+	message := fmt.Sprintf("Node %s answers again and takes new leafs", node.Name)
+	log.Print(message)
+	m.Events.Record(models.Event{Type: models.EventNodeRecovered, Message: message})
+}
@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNodeMonitor_ReschedulesLeafsOfLostNodes(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	leafRepo := repos.NewLeafRepository(db)
+	stemRepo := repos.NewStemRepository(db)
+	nodeRepo := repos.NewNodeRepository(db)
+	assert.NoError(t, nodeRepo.SaveNode(&models.Node{Name: "edge", Address: "10.0.0.5", Agent: "edge-1"}))
+	assert.NoError(t, nodeRepo.SaveNode(&models.Node{Name: "spare", Address: "10.0.0.6", Agent: "spare-1"}))
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	config := models.StemConfig{Name: "api", Version: "v1", Command: "api --port {{.PORT}}"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api", Config: &config, LeafInstances: map[string]*models.Leaf{
+		"api-1": {ID: "api-1", Status: models.StatusRunning, HAProxyServer: "api-1", Node: "edge", Agent: "edge-1", Host: "10.0.0.5", Port: 8003},
+	}}
+
+	edge := new(MockAgentClient)
+	edge.On("Ping").Return(errors.New("connection refused")).Times(nodeFailureThreshold)
+	edge.On("Ping").Return(nil)
+	edge.On("StopLeaf", "api-1").Return(nil).Once()
+	spare := new(MockAgentClient)
+	spare.On("Ping").Return(nil)
+	spare.On("Host").Return("10.0.0.6")
+	spare.On("StartLeaf", mock.Anything).Return(&AgentLeaf{PID: 78, Port: 8004, Alive: true}, nil).Once()
+	proxyClient := new(MockProxyClient)
+	proxyClient.On("ReplaceLeaf", "api", "api-1", mock.Anything, "10.0.0.6", 8004).Return(nil).Once()
+
+	leafManager := NewLeafManager(leafRepo, proxyClient, stemRepo)
+	leafManager.Agents = map[string]LeafRuntime{"edge-1": edge, "spare-1": spare}
+	leafManager.NodeRepo = nodeRepo
+	monitor := NewNodeMonitor(leafManager)
+	monitor.Events = NewEventLog(DefaultEventCapacity)
+
+	// The node is only lost after failing the threshold of checks in a row
+	for i := 1; i < nodeFailureThreshold; i++ {
+		monitor.Check()
+	}
+	node, _ := nodeRepo.FetchNode("edge")
+	assert.False(t, node.Down)
+	assert.Contains(t, db.Stems[key].LeafInstances, "api-1")
+
+	monitor.Check()
+	node, _ = nodeRepo.FetchNode("edge")
+	assert.True(t, node.Down)
+	leafs := db.Stems[key].LeafInstances
+	if assert.Len(t, leafs, 1) {
+		for _, leaf := range leafs {
+			assert.Equal(t, "spare", leaf.Node)
+			assert.Equal(t, 8004, leaf.Port)
+		}
+	}
+	edge.AssertNotCalled(t, "StopLeaf", "api-1")
+	proxyClient.AssertExpectations(t)
+
+	// Once the agent answers again, the lost leaf is stopped and the node takes leafs again
+	monitor.Check()
+	node, _ = nodeRepo.FetchNode("edge")
+	assert.False(t, node.Down)
+	edge.AssertExpectations(t)
+	spare.AssertExpectations(t)
+
+	var types []models.EventType
+	for _, event := range monitor.Events.List(EventQuery{}) {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []models.EventType{models.EventNodeLost, models.EventNodeRecovered}, types)
+}
+
+func TestNodeMonitor_UnbindsLeafsWithoutANodeToMoveTo(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	leafRepo := repos.NewLeafRepository(db)
+	stemRepo := repos.NewStemRepository(db)
+	nodeRepo := repos.NewNodeRepository(db)
+	assert.NoError(t, nodeRepo.SaveNode(&models.Node{Name: "edge", Address: "10.0.0.5", Agent: "edge-1"}))
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	config := models.StemConfig{Name: "api", Version: "v1", Command: "api --port {{.PORT}}"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api", Config: &config, LeafInstances: map[string]*models.Leaf{
+		"api-1": {ID: "api-1", Status: models.StatusRunning, HAProxyServer: "api-1", Node: "edge", Agent: "edge-1", Host: "10.0.0.5", Port: 8003},
+	}}
+
+	edge := new(MockAgentClient)
+	edge.On("Ping").Return(errors.New("connection refused"))
+	proxyClient := new(MockProxyClient)
+	proxyClient.On("UnbindLeaf", "api", "api-1").Return(nil).Once()
+
+	leafManager := NewLeafManager(leafRepo, proxyClient, stemRepo)
+	leafManager.Agents = map[string]LeafRuntime{"edge-1": edge}
+	leafManager.NodeRepo = nodeRepo
+	monitor := NewNodeMonitor(leafManager)
+	for i := 0; i < nodeFailureThreshold+1; i++ {
+		monitor.Check()
+	}
+
+	assert.Empty(t, db.Stems[key].LeafInstances)
+	proxyClient.AssertExpectations(t)
+	edge.AssertNotCalled(t, "StartLeaf", mock.Anything)
+}
@@ -0,0 +1,154 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Notification hook types selectable in the global config.
+const (
+	NotificationWebhook = "webhook" // Posts the event as JSON
+	NotificationSlack   = "slack"   // Posts the event message to a Slack incoming webhook
+)
+
+// DefaultNotificationRetries is how often a failed delivery is retried when a hook doesn't configure retries.
+const DefaultNotificationRetries = 3
+
+// Waits between delivery retries, growing exponentially from the first to the maximum.
+const (
+	notificationRetryWait    = time.Second
+	notificationRetryMaxWait = 30 * time.Second
+)
+
+// defaultNotificationTemplates render the payload of hooks that don't configure a template.
+var defaultNotificationTemplates = map[string]string{
+	NotificationWebhook: `{{json .}}`,
+	NotificationSlack:   `{"text": {{json (printf "[%s] %s" .Type .Message)}}}`,
+}
+
+// notificationFuncs are the functions available to payload templates. json quotes a value for embedding in JSON.
+var notificationFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// Notifier posts selected events to webhooks and Slack channels. Deliveries run in the background and are
+// retried with a growing wait when the receiver fails or doesn't answer with a 2xx status.
+type Notifier struct {
+	hooks []*notificationHook
+	wg    sync.WaitGroup // Deliveries in flight
+}
+
+// notificationHook is a configured destination with the events it receives.
+type notificationHook struct {
+	name     string
+	url      string
+	events   map[models.EventType]bool // nil to receive every event
+	template *template.Template
+	client   *resty.Client
+}
+
+// NewNotifier creates a Notifier for the configured hooks, failing on a hook it can't deliver to.
+func NewNotifier(configs []models.NotificationConfig) (*Notifier, error) {
+	n := &Notifier{}
+	for _, config := range configs {
+		hook, err := newNotificationHook(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure notification %s: %v", config.Name, err)
+		}
+		n.hooks = append(n.hooks, hook)
+	}
+	return n, nil
+}
+
+// newNotificationHook validates a hook config and parses its template.
+func newNotificationHook(config models.NotificationConfig) (*notificationHook, error) {
+	text, ok := defaultNotificationTemplates[config.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown notification type %q", config.Type)
+	}
+	if config.URL == "" {
+		return nil, fmt.Errorf("%s notification needs a url", config.Type)
+	}
+	if config.Template != "" {
+		text = config.Template
+	}
+	tmpl, err := template.New(config.Name).Funcs(notificationFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %v", err)
+	}
+
+	retries := DefaultNotificationRetries
+	if config.Retries != nil {
+		retries = *config.Retries
+	}
+	client := resty.New()
+	client.SetTimeout(webhookTimeout)
+	client.SetHeader("Content-Type", "application/json")
+	client.SetHeaders(config.Headers)
+	client.SetDisableWarn(true)
+	client.SetRetryCount(retries)
+	client.SetRetryWaitTime(notificationRetryWait)
+	client.SetRetryMaxWaitTime(notificationRetryMaxWait)
+	client.AddRetryCondition(func(resp *resty.Response, err error) bool {
+		return err != nil || !resp.IsSuccess()
+	})
+
+	hook := &notificationHook{name: config.Name, url: config.URL, template: tmpl, client: client}
+	if len(config.Events) > 0 {
+		hook.events = make(map[models.EventType]bool, len(config.Events))
+		for _, eventType := range config.Events {
+			hook.events[eventType] = true
+		}
+	}
+	return hook, nil
+}
+
+// Notify posts an event to every hook selecting its type, without waiting for the deliveries. It can be
+// subscribed to an EventLog.
+func (n *Notifier) Notify(event models.Event) {
+	for _, hook := range n.hooks {
+		if hook.events != nil && !hook.events[event.Type] {
+			continue
+		}
+		n.wg.Add(1)
+		go func(hook *notificationHook) {
+			defer n.wg.Done()
+			defer recoverCrash(fmt.Sprintf("notification %s", hook.name))
+			if err := hook.deliver(event); err != nil {
+				log.Printf("Failed to deliver %s event to notification %s: %v", event.Type, hook.name, err)
+			}
+		}(hook)
+	}
+}
+
+// Wait blocks until the deliveries in flight are done, including their retries.
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+// deliver renders the hook's payload for an event and posts it, retrying failed attempts.
+func (h *notificationHook) deliver(event models.Event) error {
+	var payload bytes.Buffer
+	if err := h.template.Execute(&payload, event); err != nil {
+		return fmt.Errorf("failed to render payload: %v", err)
+	}
+	resp, err := h.client.R().SetBody(payload.Bytes()).Post(h.url)
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %v", h.url, err)
+	}
+	if !resp.IsSuccess() {
+		return fmt.Errorf("%s answered with status %d: %s", h.url, resp.StatusCode(), resp.String())
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifier_Notify(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// The flaky receiver fails twice before accepting the payload
+		if r.URL.Path == "/flaky" && failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received[r.URL.Path] = append(received[r.URL.Path], string(body))
+	}))
+	defer server.Close()
+
+	noRetries := 0
+	notifier, err := NewNotifier([]models.NotificationConfig{
+		{Name: "all", Type: NotificationWebhook, URL: server.URL + "/all"},
+		{Name: "slack", Type: NotificationSlack, URL: server.URL + "/slack", Events: []models.EventType{models.EventStemScaledToZero}},
+		{Name: "custom", Type: NotificationWebhook, URL: server.URL + "/custom", Events: []models.EventType{models.EventDeploySucceeded},
+			Template: `{"service": {{json .Stem}}, "version": {{json .Version}}}`},
+		{Name: "flaky", Type: NotificationWebhook, URL: server.URL + "/flaky", Events: []models.EventType{models.EventDeploySucceeded},
+			Template: `{{.Type}}`},
+		{Name: "impatient", Type: NotificationWebhook, URL: server.URL + "/flaky", Events: []models.EventType{models.EventLeafCrashLooping},
+			Retries: &noRetries},
+	})
+	assert.NoError(t, err)
+	for _, hook := range notifier.hooks {
+		hook.client.SetRetryWaitTime(time.Millisecond).SetRetryMaxWaitTime(time.Millisecond)
+	}
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	notifier.Notify(models.Event{Seq: 1, Time: at, Type: models.EventDeploySucceeded, Stem: "api", Version: "v1", Message: "deployed"})
+	notifier.Wait()
+	notifier.Notify(models.Event{Seq: 2, Time: at, Type: models.EventStemScaledToZero, Stem: "api", Version: "v1", Message: `no "leafs"`})
+	notifier.Wait()
+
+	assert.Equal(t, []string{
+		`{"seq":1,"time":"2024-05-01T12:00:00Z","type":"DEPLOY_SUCCEEDED","stem":"api","version":"v1","message":"deployed"}`,
+		`{"seq":2,"time":"2024-05-01T12:00:00Z","type":"STEM_SCALED_TO_ZERO","stem":"api","version":"v1","message":"no \"leafs\""}`,
+	}, received["/all"])
+	assert.Equal(t, []string{`{"text": "[STEM_SCALED_TO_ZERO] no \"leafs\""}`}, received["/slack"])
+	assert.Equal(t, []string{`{"service": "api", "version": "v1"}`}, received["/custom"])
+	assert.Equal(t, []string{"DEPLOY_SUCCEEDED"}, received["/flaky"])
+
+	// Without retries a single failure drops the delivery
+	mu.Lock()
+	failures = 1
+	mu.Unlock()
+	notifier.Notify(models.Event{Type: models.EventLeafCrashLooping, Stem: "api"})
+	notifier.Wait()
+	assert.Len(t, received["/flaky"], 1)
+
+	_, err = NewNotifier([]models.NotificationConfig{{Name: "broken", Type: NotificationSlack, URL: server.URL, Template: "{{.Message"}})
+	assert.Error(t, err)
+}
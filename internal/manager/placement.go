@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// nodeUsage is the share of a node taken by the leafs placed on it.
+type nodeUsage struct {
+	leafs    int
+	memoryMB int
+}
+
+// placeLeaf selects the node a new leaf of a stem with the given placement constraints runs on.
+// Among the nodes that are up, carry the required labels and have enough free memory, it picks the one with the
+// most free memory, then the fewest leafs, then the lowest name. stems supplies the leafs already placed.
+func placeLeaf(nodes []*models.Node, stems []*models.Stem, placement *models.PlacementConfig) (*models.Node, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no nodes registered")
+	}
+
+	usage := make(map[string]*nodeUsage, len(nodes))
+	for _, node := range nodes {
+		usage[node.Name] = &nodeUsage{}
+	}
+	for _, stem := range stems {
+		memoryMB := 0
+		if stem.Config != nil && stem.Config.Placement != nil {
+			memoryMB = stem.Config.Placement.MemoryMB
+		}
+		for _, leaf := range stem.LeafInstances {
+			if u, ok := usage[leaf.Node]; ok {
+				u.leafs++
+				u.memoryMB += memoryMB
+			}
+		}
+	}
+
+	var required map[string]string
+	requiredMemoryMB := 0
+	if placement != nil {
+		required = placement.Labels
+		requiredMemoryMB = placement.MemoryMB
+	}
+
+	var candidates []*models.Node
+	var rejected []string
+	for _, node := range nodes {
+		switch {
+		case node.Down:
+			rejected = append(rejected, fmt.Sprintf("%s: down", node.Name))
+		case !hasLabels(node.Labels, required):
+			rejected = append(rejected, fmt.Sprintf("%s: missing labels", node.Name))
+		case freeMemoryMB(node, usage[node.Name]) < requiredMemoryMB:
+			rejected = append(rejected, fmt.Sprintf("%s: %d MB free, %d MB required", node.Name, freeMemoryMB(node, usage[node.Name]), requiredMemoryMB))
+		default:
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no node satisfies the placement constraints (%s)", strings.Join(rejected, "; "))
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if freeA, freeB := freeMemoryMB(a, usage[a.Name]), freeMemoryMB(b, usage[b.Name]); freeA != freeB {
+			return freeA > freeB
+		}
+		if usage[a.Name].leafs != usage[b.Name].leafs {
+			return usage[a.Name].leafs < usage[b.Name].leafs
+		}
+		return a.Name < b.Name
+	})
+	return candidates[0], nil
+}
+
+// freeMemoryMB returns the memory of a node not reserved by its leafs, treating unlimited nodes as having the most.
+func freeMemoryMB(node *models.Node, usage *nodeUsage) int {
+	if node.MemoryMB == 0 {
+		return math.MaxInt
+	}
+	return node.MemoryMB - usage.memoryMB
+}
+
+// hasLabels reports whether labels contains every key-value pair of required.
+func hasLabels(labels, required map[string]string) bool {
+	for key, value := range required {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
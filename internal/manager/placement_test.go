@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPlaceLeaf(t *testing.T) {
+	nodes := []*models.Node{
+		{Name: "a", Labels: map[string]string{"zone": "east"}, MemoryMB: 1024},
+		{Name: "b", Labels: map[string]string{"zone": "east", "gpu": "true"}, MemoryMB: 2048},
+		{Name: "c", Labels: map[string]string{"zone": "west"}},
+	}
+	stems := []*models.Stem{{
+		Config: &models.StemConfig{Placement: &models.PlacementConfig{MemoryMB: 768}},
+		LeafInstances: map[string]*models.Leaf{
+			"l1": {ID: "l1", Node: "b"},
+			"l2": {ID: "l2", Node: "b"},
+		},
+	}}
+
+	// Only a has enough memory left among the east nodes (b has 512 MB free)
+	node, err := placeLeaf(nodes, stems, &models.PlacementConfig{Labels: map[string]string{"zone": "east"}, MemoryMB: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", node.Name)
+
+	// Unlimited nodes rank above nodes with finite free memory
+	node, err = placeLeaf(nodes, stems, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", node.Name)
+
+	_, err = placeLeaf(nodes, stems, &models.PlacementConfig{Labels: map[string]string{"gpu": "true"}, MemoryMB: 1024})
+	assert.ErrorContains(t, err, "b: 512 MB free, 1024 MB required")
+	_, err = placeLeaf(nil, stems, nil)
+	assert.ErrorContains(t, err, "no nodes registered")
+
+	// Leafs are not placed on nodes that are down
+	nodes[2].Down = true
+	node, err = placeLeaf(nodes, stems, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", node.Name)
+}
+
+func TestLeafManager_StartLeafOnPlacedNode(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	leafRepo := repos.NewLeafRepository(db)
+	stemRepo := repos.NewStemRepository(db)
+	nodeRepo := repos.NewNodeRepository(db)
+	assert.NoError(t, nodeRepo.SaveNode(&models.Node{Name: "local", Labels: map[string]string{"zone": "east"}}))
+	assert.NoError(t, nodeRepo.SaveNode(&models.Node{Name: "edge", Address: "192.168.1.20", Agent: "edge-1", Labels: map[string]string{"zone": "west"}}))
+
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	config := models.StemConfig{Name: "api", Version: "v1", Command: "api --port {{.PORT}}",
+		Placement: &models.PlacementConfig{Labels: map[string]string{"zone": "west"}}}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api", Config: &config, LeafInstances: map[string]*models.Leaf{}}
+
+	mockAgent := new(MockAgentClient)
+	mockAgent.On("Host").Return("10.0.0.5")
+	mockAgent.On("StartLeaf", mock.Anything).Return(&AgentLeaf{PID: 77, Port: 8003, Alive: true}, nil)
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindLeaf", "api", mock.Anything, "192.168.1.20", 8003).Return(nil)
+
+	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, stemRepo)
+	leafManager.Agents = map[string]LeafRuntime{"edge-1": mockAgent}
+	leafManager.NodeRepo = nodeRepo
+
+	leafID, err := leafManager.StartLeaf("api", "v1", nil)
+	assert.NoError(t, err)
+	leaf, err := leafRepo.FindLeafByID(key, leafID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "edge", leaf.Node)
+		assert.Equal(t, "edge-1", leaf.Agent)
+		assert.Equal(t, "192.168.1.20", leaf.Host)
+	}
+	mockAgent.AssertExpectations(t)
+	mockHAProxyClient.AssertExpectations(t)
+
+	// No node carries the required labels
+	config.Placement.Labels = map[string]string{"zone": "north"}
+	_, err = leafManager.StartLeaf("api", "v1", nil)
+	assert.ErrorContains(t, err, "no node satisfies the placement constraints")
+}
@@ -4,18 +4,41 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/plantarium-platform/herbarium-go/internal/embeddedproxy"
 	"github.com/plantarium-platform/herbarium-go/internal/haproxy"
+	"github.com/plantarium-platform/herbarium-go/internal/nginx"
+	"github.com/plantarium-platform/herbarium-go/internal/policy"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"github.com/plantarium-platform/herbarium-go/internal/storage"
 	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/internal/traefik"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
 	"github.com/plantarium-platform/herbarium-go/pkg/models"
 	"gopkg.in/yaml.v2"
 )
 
+// Admin API defaults and the reserved HAProxy route it is published under.
+const (
+	DefaultAPIListenAddress = "localhost:50051"
+	AdminAPIPath            = "/herbarium"
+	adminAPIServerName      = "herbarium-admin"
+)
+
+// reservedURL reports whether a stem URL is the admin API's route or below it, where a stem would shadow its endpoints.
+func reservedURL(url string) bool {
+	cleanURL, reserved := strings.TrimPrefix(url, "/"), strings.TrimPrefix(AdminAPIPath, "/")
+	return cleanURL == reserved || strings.HasPrefix(cleanURL, reserved+"/")
+}
+
 // PlatformManagerInterface defines the methods for managing the platform lifecycle.
 type PlatformManagerInterface interface {
 	InitializePlatform() error // Entry point for platform initialization.
@@ -30,25 +53,50 @@ type Service struct {
 
 // PlatformManager implements PlatformManagerInterface.
 type PlatformManager struct {
-	StemManager StemManagerInterface
-	LeafManager LeafManagerInterface
-	BasePath    string
-	isWindows   bool
-	Config      *models.GlobalConfig
+	StemManager     StemManagerInterface
+	LeafManager     LeafManagerInterface
+	ProxyClient     proxy.ProxyClient
+	SnapshotManager *SnapshotManager
+	Recycler        *Recycler
+	Sweeper         *Sweeper
+	Drift           *DriftReconciler
+	Nodes           *NodeMonitor // Nil when no nodes are registered
+	Janitor         *Janitor
+	Scheduler       *ScheduleScaler
+	Autoscaler      *Autoscaler
+	Events          *EventLog
+	Alerts          *AlertEngine
+	Stats           *StatsCollector
+	Maintenance     *Maintenance
+	Drain           *Drain
+	Secrets         *SecretStore         // Nil without a secrets provider
+	Journal         *storage.FileJournal // Nil when journaling is disabled
+	Deployments     *DeploymentHistory   // Nil when the deployment history is disabled
+	Backend         storage.Backend      // Nil without a shared storage backend
+	AdminAddress    net.Addr             // Address the admin API serves on, nil to publish the configured one
+	BasePath        string
+	isWindows       bool
+	Config          *models.GlobalConfig
+
+	reloadMu sync.Mutex
+	loaded   map[storage.StemKey]bool // Stems registered from service directories, removed on reload when gone
 }
 
 // NewPlatformManager creates a new instance of PlatformManager with the required dependencies (manual DI for tests).
 func NewPlatformManager(
 	stemManager StemManagerInterface,
 	leafManager LeafManagerInterface,
+	proxyClient proxy.ProxyClient,
 	config *models.GlobalConfig,
 ) *PlatformManager {
 	return &PlatformManager{
 		StemManager: stemManager,
 		LeafManager: leafManager,
+		ProxyClient: proxyClient,
 		BasePath:    config.Plantarium.RootFolder,
 		Config:      config,
 		isWindows:   runtime.GOOS == "windows",
+		loaded:      make(map[storage.StemKey]bool),
 	}
 }
 
@@ -59,29 +107,228 @@ func NewPlatformManagerWithDI() (*PlatformManager, error) {
 		return nil, fmt.Errorf("failed to load global configuration: %w", err)
 	}
 
-	haproxyConfig := haproxy.HAProxyConfig{
-		APIURL:   config.HAProxy.URL,
-		Username: config.HAProxy.Login,
-		Password: config.HAProxy.Password,
+	naming, err := NewBackendNaming(config)
+	if err != nil {
+		return nil, err
+	}
+	proxyClient, err := newProxyClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure %s proxy: %w", config.Proxy.Type, err)
 	}
-
-	haproxyConfigManager := haproxy.NewHAProxyConfigurationManager(haproxyConfig)
-	haproxyClient := haproxy.NewHAProxyClient(haproxyConfig, haproxyConfigManager)
 
 	herbariumDB := storage.GetHerbariumDB()
 
+	// Record every state mutation so it can be replayed and audited
+	var journal *storage.FileJournal
+	if !config.Journal.Disabled {
+		journalFile := config.Journal.File
+		if journalFile == "" {
+			journalFile = filepath.Join(config.Plantarium.RootFolder, "system", "herbarium", "journal.jsonl")
+		}
+		journal, err = storage.OpenFileJournal(journalFile, config.Journal.Fsync)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open state journal: %w", err)
+		}
+		herbariumDB.SetJournal(journal)
+	}
+
+	// Record who changed which stems, for release management
+	var deployments *DeploymentHistory
+	if !config.Deployments.Disabled {
+		deploymentsFile := config.Deployments.File
+		if deploymentsFile == "" {
+			deploymentsFile = filepath.Join(config.Plantarium.RootFolder, "system", "herbarium", "deployments.jsonl")
+		}
+		deployments, err = OpenDeploymentHistory(deploymentsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open deployment history: %w", err)
+		}
+	}
+
+	// Mirror the state to a shared backend so other replicas and tools can observe it, or to files that
+	// outlive the process
+	storagePath := config.Storage.Path
+	if storagePath == "" {
+		storagePath = filepath.Join(config.Plantarium.RootFolder, "system", "herbarium", "state")
+	}
+	backend, err := storage.NewBackend(config.Storage.Backend, config.Storage.Address, config.Storage.Username,
+		config.Storage.Password, config.Storage.DB, config.Storage.Prefix, storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to storage backend: %w", err)
+	}
+	if backend != nil {
+		herbariumDB.SetBackend(backend)
+		log.Printf("Mirroring state to %s storage backend", config.Storage.Backend)
+	}
+
 	stemRepo := repos.NewStemRepository(herbariumDB)
 	leafRepo := repos.NewLeafRepository(herbariumDB)
 
-	leafManager := NewLeafManager(leafRepo, haproxyClient, stemRepo)
-	stemManager := NewStemManager(stemRepo, leafManager, haproxyClient)
+	detectAdvertiseAddress(config)
+	leafManager := NewLeafManager(leafRepo, proxyClient, stemRepo)
+	leafManager.BindAddress = config.Leafs.BindAddress
+	leafManager.AdvertiseAddress = config.Leafs.AdvertiseAddress
+	leafManager.Env = config.Leafs.Env
+	leafManager.TypeEnv = map[models.StemType]map[string]string{
+		models.StemTypeSystem:     config.Leafs.SystemEnv,
+		models.StemTypeDeployment: config.Leafs.DeploymentEnv,
+	}
+	for _, agentConfig := range config.Agents {
+		agent, err := NewAgentClient(agentConfig.URL, agentConfig.APIKey, agentConfig.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure agent %s: %w", agentConfig.Name, err)
+		}
+		if leafManager.Agents == nil {
+			leafManager.Agents = make(map[string]LeafRuntime)
+		}
+		leafManager.Agents[agentConfig.Name] = agent
+	}
+	kubernetes, err := NewKubernetesRuntimeFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Kubernetes: %w", err)
+	}
+	if kubernetes != nil {
+		if leafManager.Agents == nil {
+			leafManager.Agents = make(map[string]LeafRuntime)
+		}
+		leafManager.Agents[KubernetesRuntimeName] = kubernetes
+		log.Printf("Leafs of stems with kubernetes run as pods in namespace %s", kubernetes.namespace)
+	}
+	firecracker, err := NewFirecrackerRuntimeFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Firecracker: %w", err)
+	}
+	if firecracker != nil {
+		if leafManager.Agents == nil {
+			leafManager.Agents = make(map[string]LeafRuntime)
+		}
+		leafManager.Agents[FirecrackerRuntimeName] = firecracker
+		log.Printf("Leafs of stems with firecracker run in microVMs on subnet %s (experimental)", firecracker.subnet)
+	}
+
+	// Register the nodes leafs are placed on
+	if len(config.Nodes) > 0 {
+		nodeRepo := repos.NewNodeRepository(herbariumDB)
+		for _, nodeConfig := range config.Nodes {
+			node := &models.Node{
+				Name:     nodeConfig.Name,
+				Address:  nodeConfig.Address,
+				Agent:    nodeConfig.Agent,
+				Labels:   nodeConfig.Labels,
+				MemoryMB: nodeConfig.MemoryMB,
+			}
+			if err := nodeRepo.SaveNode(node); err != nil {
+				return nil, fmt.Errorf("failed to register node %s: %w", nodeConfig.Name, err)
+			}
+		}
+		leafManager.NodeRepo = nodeRepo
+		log.Printf("Registered %d nodes for leaf placement", len(config.Nodes))
+	}
+	events := NewEventLog(DefaultEventCapacity)
+	notifier, err := NewNotifier(config.Notifications)
+	if err != nil {
+		return nil, err
+	}
+	events.Subscribe(notifier.Notify)
+	ReportCrashesTo(events)
+	leafManager.Events = events
+	maintenance := NewMaintenance(stemRepo, proxyClient, config.Maintenance.PageFile)
+	maintenance.Events = events
+	drain := NewDrain(stemRepo, leafManager)
+	drain.Events = events
+	leafManager.Drain = drain
+	registry, err := newHookRegistry(config, maintenance, drain)
+	if err != nil {
+		return nil, err
+	}
+	leafManager.Hooks = registry
+	leafManager.Nix = NewNixEnvironmentsFromConfig(config)
+	var secrets *SecretStore
+	vault, err := NewVaultClientFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Vault: %w", err)
+	}
+	if vault != nil {
+		secrets = NewSecretStore(vault, stemRepo, leafManager)
+		secrets.Events = events
+		leafManager.Secrets = secrets
+	}
+	stemManager := NewStemManager(stemRepo, leafManager, proxyClient)
+	stemManager.Events = events
+	stemManager.Hooks = registry
+	stemManager.Maintenance = maintenance
+	stemManager.Naming = naming
+	stemManager.Artifacts = NewArtifactFetcherFromConfig(config)
+	stemManager.Provisioners = NewDependencyProvisioners(stemRepo, leafManager, registry)
+
+	snapshotFolder := config.Snapshot.Folder
+	if snapshotFolder == "" {
+		snapshotFolder = filepath.Join(config.Plantarium.RootFolder, "system", "herbarium", "snapshots")
+	}
+	snapshotManager := NewSnapshotManager(herbariumDB, leafManager, proxyClient, snapshotFolder, config.Snapshot.Retain)
+	snapshotManager.Journal = journal
+	snapshotManager.Backend = backend
+	snapshotManager.Agents = leafManager.Agents
+	snapshotManager.Maintenance = maintenance
+
+	recycler := NewRecycler(stemRepo, leafManager, proxyClient)
+	recycler.Events = events
+	autoscaler := NewAutoscaler(stemRepo, leafManager, proxyClient, stemManager)
+	autoscaler.Budget = recycler.Budget
+	sweeper := NewSweeper(stemRepo, leafManager, proxyClient)
+	sweeper.Events = events
+	drift := NewDriftReconciler(stemRepo, proxyClient)
+	drift.Maintenance = maintenance
+	drift.Events = events
+	var nodes *NodeMonitor
+	if leafManager.NodeRepo != nil {
+		nodes = NewNodeMonitor(leafManager)
+		nodes.Events = events
+	}
+	retention := DefaultTombstoneRetention
+	if config.Janitor.Retention != "" {
+		duration, err := time.ParseDuration(config.Janitor.Retention)
+		if err != nil || duration < 0 {
+			log.Printf("Invalid janitor.retention %q, keeping tombstones for %s", config.Janitor.Retention, retention)
+		} else {
+			retention = duration
+		}
+	}
+	alerts := NewAlertEngine(stemRepo, leafManager, proxyClient)
+	alerts.Events = events
+	for _, channelConfig := range config.Alerting.Channels {
+		channel, err := NewAlertChannel(channelConfig.Type, channelConfig.URL, channelConfig.Headers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure alerting channel %s: %w", channelConfig.Name, err)
+		}
+		alerts.Channels[channelConfig.Name] = channel
+	}
 
 	return &PlatformManager{
-		StemManager: stemManager,
-		LeafManager: leafManager,
-		BasePath:    config.Plantarium.RootFolder,
-		Config:      config,
-		isWindows:   runtime.GOOS == "windows",
+		StemManager:     stemManager,
+		LeafManager:     leafManager,
+		ProxyClient:     proxyClient,
+		SnapshotManager: snapshotManager,
+		Recycler:        recycler,
+		Sweeper:         sweeper,
+		Drift:           drift,
+		Nodes:           nodes,
+		Janitor:         NewJanitor(stemRepo, retention),
+		Scheduler:       NewScheduleScaler(stemRepo, stemManager),
+		Autoscaler:      autoscaler,
+		Events:          events,
+		Alerts:          alerts,
+		Stats:           NewStatsCollector(stemRepo, leafManager, proxyClient),
+		Maintenance:     maintenance,
+		Drain:           drain,
+		Secrets:         secrets,
+		Journal:         journal,
+		Deployments:     deployments,
+		Backend:         backend,
+		BasePath:        config.Plantarium.RootFolder,
+		Config:          config,
+		isWindows:       runtime.GOOS == "windows",
+		loaded:          make(map[storage.StemKey]bool),
 	}, nil
 }
 
@@ -89,6 +336,12 @@ func NewPlatformManagerWithDI() (*PlatformManager, error) {
 func (p *PlatformManager) InitializePlatform() error {
 	log.Println("Initializing platform...")
 
+	// Publish the admin API through HAProxy before any service stems claim routes
+	if err := p.bindAdminAPI(); err != nil {
+		log.Printf("Failed to bind admin API to HAProxy: %v", err)
+		return fmt.Errorf("failed to bind admin API: %w", err)
+	}
+
 	// Retrieve system and deployment stems
 	systemStems, deploymentStems, err := p.GetServiceConfigurations()
 	if err != nil {
@@ -96,28 +349,143 @@ func (p *PlatformManager) InitializePlatform() error {
 		return fmt.Errorf("failed to get service configurations: %w", err)
 	}
 
-	// Register system stems
-	for _, stem := range systemStems {
+	// Empty what a previous run left in the proxy, so no traffic reaches servers whose leafs are gone
+	p.syncProxy(append(systemStems, deploymentStems...))
+
+	// Register system stems, dependencies first so they can be provisioned
+	for _, stem := range orderByDependencies(systemStems) {
 		log.Printf("Registering system stem: %s", stem.Config.Name)
 		if err := p.StemManager.RegisterStem(stem.Config); err != nil {
 			log.Printf("Failed to register system stem %s: %v", stem.Config.Name, err)
 			return fmt.Errorf("failed to register system stem %s: %w", stem.Config.Name, err)
 		}
+		p.loaded[storage.StemKey{Name: stem.Config.Name, Version: stem.Config.Version}] = true
 	}
 
 	// Register deployment stems
-	for _, stem := range deploymentStems {
+	for _, stem := range orderByDependencies(deploymentStems) {
 		log.Printf("Registering deployment stem: %s", stem.Config.Name)
 		if err := p.StemManager.RegisterStem(stem.Config); err != nil {
 			log.Printf("Failed to register deployment stem %s: %v", stem.Config.Name, err)
 			return fmt.Errorf("failed to register deployment stem %s: %w", stem.Config.Name, err)
 		}
+		p.loaded[storage.StemKey{Name: stem.Config.Name, Version: stem.Config.Version}] = true
 	}
 
 	log.Println("Platform initialized successfully.")
 	return nil
 }
 
+// RestorePlatform initializes the platform from a snapshot instead of from scratch: state is rebuilt
+// and reconciled by the SnapshotManager, and only services missing from the snapshot are registered.
+func (p *PlatformManager) RestorePlatform(snapshot string) (*RestoreReport, error) {
+	log.Printf("Restoring platform from snapshot %s...", snapshot)
+
+	if err := p.bindAdminAPI(); err != nil {
+		log.Printf("Failed to bind admin API to HAProxy: %v", err)
+		return nil, fmt.Errorf("failed to bind admin API: %w", err)
+	}
+
+	report, err := p.SnapshotManager.RestoreSnapshot(snapshot)
+	if err != nil {
+		log.Printf("Failed to restore snapshot %s: %v", snapshot, err)
+		return nil, fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+
+	systemStems, deploymentStems, err := p.GetServiceConfigurations()
+	if err != nil {
+		log.Printf("Failed to retrieve stem configurations: %v", err)
+		return nil, fmt.Errorf("failed to get service configurations: %w", err)
+	}
+
+	for _, stem := range append(orderByDependencies(systemStems), orderByDependencies(deploymentStems)...) {
+		key := storage.StemKey{Name: stem.Config.Name, Version: stem.Config.Version}
+		p.loaded[key] = true
+		if _, err := p.StemManager.FetchStemInfo(key); err == nil {
+			continue // Restored from the snapshot
+		}
+		log.Printf("Registering stem missing from snapshot: %s", stem.Config.Name)
+		if err := p.StemManager.RegisterStem(stem.Config); err != nil {
+			log.Printf("Failed to register stem %s: %v", stem.Config.Name, err)
+			return nil, fmt.Errorf("failed to register stem %s: %w", stem.Config.Name, err)
+		}
+	}
+
+	log.Println("Platform restored successfully.")
+	return report, nil
+}
+
+// StepDown stops and unbinds every leaf and graft node of a replica that lost the leader lease, so none of
+// them stays in rotation unmanaged. The shared backend is detached first: the state it holds belongs to the
+// new leader, which takes the services over from it.
+func (p *PlatformManager) StepDown() {
+	if p.Backend != nil {
+		storage.GetHerbariumDB().SetBackend(nil)
+	}
+
+	for _, stem := range p.StemManager.ReadSnapshot().Stems() {
+		for leafID := range stem.LeafInstances {
+			if err := p.LeafManager.StopLeaf(stem.Name, stem.Version, leafID); err != nil {
+				log.Printf("Failed to stop leaf %s of stem %s version %s: %v", leafID, stem.Name, stem.Version, err)
+			}
+		}
+		if stem.GraftNodeLeaf != nil {
+			if err := p.LeafManager.StopGraftNodeLeaf(stem.Name, stem.Version); err != nil {
+				log.Printf("Failed to stop graft node of stem %s version %s: %v", stem.Name, stem.Version, err)
+			}
+		}
+	}
+	log.Println("Stepped down, all leafs stopped.")
+}
+
+// bindAdminAPI registers herbarium's own admin API as the system backend for AdminAPIPath,
+// so control-plane traffic enters through the same HAProxy frontend as service traffic. The address the
+// admin API actually serves on, such as a socket passed by systemd, takes precedence over the configured one.
+// Without security.api_key the admin API accepts any request, so it is not published to the proxy's clients.
+func (p *PlatformManager) bindAdminAPI() error {
+	if p.Config.Security.APIKey == "" {
+		log.Printf("security.api_key is not set; not publishing the admin API at %s", AdminAPIPath)
+		return nil
+	}
+	address := p.Config.API.ListenAddress
+	if address == "" {
+		address = DefaultAPIListenAddress
+	}
+	if p.AdminAddress != nil {
+		if p.AdminAddress.Network() != "tcp" {
+			log.Printf("Admin API serves on %s socket %s, which HAProxy can't reach; not publishing it at %s", p.AdminAddress.Network(), p.AdminAddress, AdminAPIPath)
+			return nil
+		}
+		address = p.AdminAddress.String()
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid admin API listen address %s: %v", address, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid admin API port in %s: %v", address, err)
+	}
+	// A wildcard bind is reachable through loopback, or through the advertised address when HAProxy runs elsewhere
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+		if p.Config.Leafs.AdvertiseAddress != "" {
+			host = p.Config.Leafs.AdvertiseAddress
+		}
+	}
+
+	backend := strings.TrimPrefix(AdminAPIPath, "/")
+	log.Printf("Binding admin API %s as system backend %s", net.JoinHostPort(host, strconv.Itoa(port)), backend)
+	if err := p.ProxyClient.BindStem(backend, proxy.BackendOptions{}); err != nil {
+		return fmt.Errorf("failed to create backend %s: %v", backend, err)
+	}
+	if err := p.ProxyClient.BindLeaf(backend, adminAPIServerName, host, port); err != nil {
+		return fmt.Errorf("failed to add admin API server to backend %s: %v", backend, err)
+	}
+	return nil
+}
+
 // GetServiceConfigurations reads the configurations for all services and system components.
 func (p *PlatformManager) GetServiceConfigurations() ([]Service, []Service, error) {
 	var systemServices, deploymentServices []Service
@@ -191,15 +559,16 @@ func (p *PlatformManager) loadServiceConfigForSystem(basePath, serviceName strin
 
 // loadConfigFromPath loads configuration from a specific path.
 func (p *PlatformManager) loadConfigFromPath(path, serviceName string) (Service, error) {
-	configFilePath := filepath.Join(path, "config.yaml")
-	configFile, err := os.Open(configFilePath)
+	content, warnings, err := p.readServiceConfig(path)
 	if err != nil {
-		return Service{}, fmt.Errorf("error opening config file %s: %v", configFilePath, err)
+		return Service{}, fmt.Errorf("error reading config of service %s: %v", serviceName, err)
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning: config of service %s: %s", serviceName, warning)
 	}
-	defer configFile.Close()
 
 	var config models.StemConfig
-	if err := yaml.NewDecoder(configFile).Decode(&config); err != nil {
+	if err := yaml.Unmarshal(content, &config); err != nil {
 		return Service{}, fmt.Errorf("error decoding YAML for service %s: %v", serviceName, err)
 	}
 
@@ -209,6 +578,20 @@ func (p *PlatformManager) loadConfigFromPath(path, serviceName string) (Service,
 	}, nil
 }
 
+// readServiceConfig reads the config.yaml in dir, with the shared fragments it extends merged in, and
+// migrates it to ConfigAPIVersion. Warnings about deprecated settings are returned with it.
+func (p *PlatformManager) readServiceConfig(dir string) ([]byte, []string, error) {
+	configFilePath := filepath.Join(dir, "config.yaml")
+	content, err := os.ReadFile(configFilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening config file %s: %v", configFilePath, err)
+	}
+	if content, err = mergeConfigFragments(content, filepath.Join(p.BasePath, SharedConfigFolder)); err != nil {
+		return nil, nil, err
+	}
+	return migrateServiceConfig(content)
+}
+
 // resolveCurrentPath determines the "current" path for deployment services.
 func (p *PlatformManager) resolveCurrentPath(basePath, serviceName string) (string, error) {
 	currentPath := filepath.Join(basePath, serviceName, "current")
@@ -242,6 +625,14 @@ func loadGlobalConfig() (*models.GlobalConfig, error) {
 		return nil, fmt.Errorf("failed to read global config at %s: %v", configPath, err)
 	}
 
+	configContent, warnings, err := migrateGlobalConfig(configContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse global config: %v", err)
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning: global config: %s", warning)
+	}
+
 	var config models.GlobalConfig
 	if err := yaml.Unmarshal(configContent, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse global config: %v", err)
@@ -250,3 +641,161 @@ func loadGlobalConfig() (*models.GlobalConfig, error) {
 	config.Plantarium.RootFolder = rootFolder
 	return &config, nil
 }
+
+// newProxyClient creates the client for the reverse proxy selected by proxy.type.
+func newProxyClient(config *models.GlobalConfig) (proxy.ProxyClient, error) {
+	switch config.Proxy.Type {
+	case "", proxy.TypeHAProxy:
+		switch config.HAProxy.Mode {
+		case "", haproxy.ModeDataplane:
+		case haproxy.ModeNone:
+			return haproxy.NewNoopHAProxyClient(), nil
+		default:
+			return nil, fmt.Errorf("haproxy.mode %q is not one of dataplane or none", config.HAProxy.Mode)
+		}
+		client := haproxy.NewHAProxyClients(haproxyConfigs(config))
+		if config.HAProxy.Preflight.Disabled {
+			return client, nil
+		}
+		return haproxy.Preflight(client, preflightConfig(config))
+	case proxy.TypeNginx:
+		return nginx.NewNginxClient(nginx.NginxConfig{
+			ConfigFile:    config.Proxy.Nginx.ConfigFile,
+			Template:      config.Proxy.Nginx.Template,
+			ReloadCommand: config.Proxy.Nginx.ReloadCommand,
+			TestCommand:   config.Proxy.Nginx.TestCommand,
+		})
+	case proxy.TypeTraefik:
+		client := traefik.NewTraefikClient(traefik.TraefikConfig{
+			ListenAddress: config.Proxy.Traefik.ListenAddress,
+			APIKey:        config.Proxy.Traefik.APIKey,
+			EntryPoints:   config.Proxy.Traefik.EntryPoints,
+		})
+		if err := client.Start(); err != nil {
+			return nil, err
+		}
+		return client, nil
+	case proxy.TypeEmbedded:
+		var interval time.Duration
+		if config.Proxy.Embedded.HealthCheckInterval != "" {
+			parsed, err := time.ParseDuration(config.Proxy.Embedded.HealthCheckInterval)
+			if err != nil {
+				return nil, fmt.Errorf("invalid health check interval: %v", err)
+			}
+			interval = parsed
+		}
+		client := embeddedproxy.NewEmbeddedProxy(embeddedproxy.EmbeddedConfig{
+			ListenAddress:       config.Proxy.Embedded.ListenAddress,
+			HealthCheckInterval: interval,
+		})
+		if err := client.Start(); err != nil {
+			return nil, err
+		}
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unknown proxy type %q", config.Proxy.Type)
+	}
+}
+
+// haproxyConfigs lists the HAProxy instances every change is applied to: the configured instances, or the
+// single haproxy.url. Instances without credentials use haproxy.login and haproxy.password.
+func haproxyConfigs(config *models.GlobalConfig) []haproxy.HAProxyConfig {
+	if len(config.HAProxy.Instances) == 0 {
+		return []haproxy.HAProxyConfig{{
+			Name:     "default",
+			APIURL:   config.HAProxy.URL,
+			Username: config.HAProxy.Login,
+			Password: config.HAProxy.Password,
+			Frontend: config.HAProxy.Frontend,
+		}}
+	}
+
+	configs := make([]haproxy.HAProxyConfig, 0, len(config.HAProxy.Instances))
+	for _, instance := range config.HAProxy.Instances {
+		instanceConfig := haproxy.HAProxyConfig{
+			Name:     instance.Name,
+			APIURL:   instance.URL,
+			Username: instance.Login,
+			Password: instance.Password,
+			Frontend: config.HAProxy.Frontend,
+		}
+		if instanceConfig.Username == "" {
+			instanceConfig.Username = config.HAProxy.Login
+		}
+		if instanceConfig.Password == "" {
+			instanceConfig.Password = config.HAProxy.Password
+		}
+		configs = append(configs, instanceConfig)
+	}
+	return configs
+}
+
+// Defaults of the HAProxy preflight, which checks the Dataplane API for about 15 seconds.
+const (
+	DefaultPreflightAttempts = 5
+	DefaultPreflightBackoff  = time.Second
+)
+
+// preflightConfig returns how the Dataplane API is checked at startup, set by haproxy.preflight.
+func preflightConfig(config *models.GlobalConfig) haproxy.PreflightConfig {
+	preflight := haproxy.PreflightConfig{
+		Attempts: config.HAProxy.Preflight.Attempts,
+		Backoff:  DefaultPreflightBackoff,
+		Degraded: config.HAProxy.Preflight.Degraded,
+	}
+	if preflight.Attempts <= 0 {
+		preflight.Attempts = DefaultPreflightAttempts
+	}
+	if backoff := config.HAProxy.Preflight.Backoff; backoff != "" {
+		duration, err := time.ParseDuration(backoff)
+		if err != nil || duration <= 0 {
+			log.Printf("Invalid haproxy.preflight.backoff %q, waiting %s after the first failed check", backoff, preflight.Backoff)
+		} else {
+			preflight.Backoff = duration
+		}
+	}
+	return preflight
+}
+
+// newHookRegistry loads the configured Go plugins, hook executables and admission policies. The maintenance
+// mode and drain checks run first, so no other hook sees a deployment they veto.
+func newHookRegistry(config *models.GlobalConfig, maintenance *Maintenance, drain *Drain) (*hooks.Registry, error) {
+	registry := hooks.NewRegistry()
+	registry.Register(hooks.BeforeRegisterStem, maintenance)
+	registry.Register(hooks.BeforeRegisterStem, drain)
+	for _, path := range config.Hooks.Plugins {
+		if err := hooks.LoadPlugin(path, registry); err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded hook plugin %s", path)
+	}
+	for _, executable := range config.Hooks.Executables {
+		var timeout time.Duration
+		if executable.Timeout != "" {
+			duration, err := time.ParseDuration(executable.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout %q of hook %s: %w", executable.Timeout, executable.Path, err)
+			}
+			timeout = duration
+		}
+		hook := hooks.NewExecHook(executable.Path, timeout)
+		for _, name := range executable.Points {
+			point, err := hooks.ParsePoint(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to register hook %s: %w", executable.Path, err)
+			}
+			registry.Register(point, hook)
+		}
+		log.Printf("Registered hook %s at %s", executable.Path, strings.Join(executable.Points, ", "))
+	}
+	if len(config.Admission.Policies) > 0 {
+		engine, err := policy.NewEngine(config.Admission.Policies)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load admission policies: %w", err)
+		}
+		// Registered last, so policies judge the config as the other hooks left it
+		registry.Register(hooks.BeforeRegisterStem, engine)
+		log.Printf("Loaded %d admission policies", len(config.Admission.Policies))
+	}
+	return registry, nil
+}
@@ -2,11 +2,16 @@ package manager
 
 import (
 	"errors"
+	"github.com/plantarium-platform/herbarium-go/internal/haproxy"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
 	"github.com/plantarium-platform/herbarium-go/pkg/models"
 	"github.com/stretchr/testify/mock"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -60,7 +65,7 @@ func TestPlatformManager_InitializePlatform(t *testing.T) {
 	t.Run("successful initialization", func(t *testing.T) {
 		// Mock StemManager
 		mockStemManager := new(MockStemManager)
-		platformManager := NewPlatformManager(mockStemManager, nil, &models.GlobalConfig{
+		platformManager := NewPlatformManager(mockStemManager, nil, newAdminBoundHAProxyClient(), &models.GlobalConfig{
 			Plantarium: struct {
 				RootFolder string `yaml:"root_folder"`
 				LogFolder  string `yaml:"log_folder"`
@@ -89,7 +94,7 @@ func TestPlatformManager_InitializePlatform(t *testing.T) {
 	t.Run("system stem initialization failure", func(t *testing.T) {
 		// Mock StemManager
 		mockStemManager := new(MockStemManager)
-		platformManager := NewPlatformManager(mockStemManager, nil, &models.GlobalConfig{
+		platformManager := NewPlatformManager(mockStemManager, nil, newAdminBoundHAProxyClient(), &models.GlobalConfig{
 			Plantarium: struct {
 				RootFolder string `yaml:"root_folder"`
 				LogFolder  string `yaml:"log_folder"`
@@ -121,7 +126,7 @@ func TestPlatformManager_InitializePlatform(t *testing.T) {
 	t.Run("deployment stem initialization failure", func(t *testing.T) {
 		// Mock StemManager
 		mockStemManager := new(MockStemManager)
-		platformManager := NewPlatformManager(mockStemManager, nil, &models.GlobalConfig{
+		platformManager := NewPlatformManager(mockStemManager, nil, newAdminBoundHAProxyClient(), &models.GlobalConfig{
 			Plantarium: struct {
 				RootFolder string `yaml:"root_folder"`
 				LogFolder  string `yaml:"log_folder"`
@@ -156,6 +161,112 @@ func TestPlatformManager_InitializePlatform(t *testing.T) {
 	})
 }
 
+// newAdminBoundHAProxyClient returns a mock HAProxy client expecting the admin API binding at the default address.
+func newAdminBoundHAProxyClient() *MockProxyClient {
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindStem", "herbarium", proxy.BackendOptions{}).Return(nil)
+	mockHAProxyClient.On("BindLeaf", "herbarium", "herbarium-admin", "localhost", 50051).Return(nil)
+	return mockHAProxyClient
+}
+
+func TestPlatformManager_BindAdminAPI(t *testing.T) {
+	t.Run("wildcard listen address is published via localhost", func(t *testing.T) {
+		mockHAProxyClient := new(MockProxyClient)
+		mockHAProxyClient.On("BindStem", "herbarium", proxy.BackendOptions{}).Return(nil)
+		mockHAProxyClient.On("BindLeaf", "herbarium", "herbarium-admin", "localhost", 9000).Return(nil)
+
+		config := &models.GlobalConfig{}
+		config.Security.APIKey = "admin-key"
+		config.API.ListenAddress = ":9000"
+		platformManager := NewPlatformManager(new(MockStemManager), nil, mockHAProxyClient, config)
+
+		err := platformManager.bindAdminAPI()
+		assert.NoError(t, err)
+		mockHAProxyClient.AssertExpectations(t)
+	})
+
+	t.Run("wildcard listen address is published via the advertised address", func(t *testing.T) {
+		mockHAProxyClient := new(MockProxyClient)
+		mockHAProxyClient.On("BindStem", "herbarium", proxy.BackendOptions{}).Return(nil)
+		mockHAProxyClient.On("BindLeaf", "herbarium", "herbarium-admin", "10.0.0.5", 9000).Return(nil)
+
+		config := &models.GlobalConfig{}
+		config.Security.APIKey = "admin-key"
+		config.API.ListenAddress = "0.0.0.0:9000"
+		config.Leafs.AdvertiseAddress = "10.0.0.5"
+		platformManager := NewPlatformManager(new(MockStemManager), nil, mockHAProxyClient, config)
+
+		err := platformManager.bindAdminAPI()
+		assert.NoError(t, err)
+		mockHAProxyClient.AssertExpectations(t)
+	})
+
+	t.Run("address served on takes precedence over the configured one", func(t *testing.T) {
+		mockHAProxyClient := new(MockProxyClient)
+		mockHAProxyClient.On("BindStem", "herbarium", proxy.BackendOptions{}).Return(nil)
+		mockHAProxyClient.On("BindLeaf", "herbarium", "herbarium-admin", "127.0.0.1", 8443).Return(nil)
+
+		config := &models.GlobalConfig{}
+		config.Security.APIKey = "admin-key"
+		config.API.ListenAddress = "localhost:50051"
+		platformManager := NewPlatformManager(new(MockStemManager), nil, mockHAProxyClient, config)
+		platformManager.AdminAddress = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8443}
+
+		err := platformManager.bindAdminAPI()
+		assert.NoError(t, err)
+		mockHAProxyClient.AssertExpectations(t)
+	})
+
+	t.Run("admin API without an API key is not published", func(t *testing.T) {
+		mockHAProxyClient := new(MockProxyClient)
+		config := &models.GlobalConfig{}
+		config.API.ListenAddress = ":9000"
+		platformManager := NewPlatformManager(new(MockStemManager), nil, mockHAProxyClient, config)
+
+		err := platformManager.bindAdminAPI()
+		assert.NoError(t, err)
+		mockHAProxyClient.AssertNotCalled(t, "BindStem", mock.Anything, mock.Anything)
+		mockHAProxyClient.AssertNotCalled(t, "BindLeaf", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("admin API on a unix socket is not published", func(t *testing.T) {
+		mockHAProxyClient := new(MockProxyClient)
+		config := &models.GlobalConfig{}
+		config.Security.APIKey = "admin-key"
+		platformManager := NewPlatformManager(new(MockStemManager), nil, mockHAProxyClient, config)
+		platformManager.AdminAddress = &net.UnixAddr{Name: "/run/herbarium.sock", Net: "unix"}
+
+		err := platformManager.bindAdminAPI()
+		assert.NoError(t, err)
+		mockHAProxyClient.AssertNotCalled(t, "BindStem", mock.Anything, mock.Anything)
+	})
+
+	t.Run("binding failure aborts initialization", func(t *testing.T) {
+		mockHAProxyClient := new(MockProxyClient)
+		mockHAProxyClient.On("BindStem", "herbarium", proxy.BackendOptions{}).Return(errors.New("dataplane unavailable"))
+
+		config := &models.GlobalConfig{}
+		config.Security.APIKey = "admin-key"
+		mockStemManager := new(MockStemManager)
+		platformManager := NewPlatformManager(mockStemManager, nil, mockHAProxyClient, config)
+
+		err := platformManager.InitializePlatform()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "dataplane unavailable")
+		mockStemManager.AssertNotCalled(t, "RegisterStem", mock.Anything)
+	})
+
+	t.Run("invalid listen address", func(t *testing.T) {
+		config := &models.GlobalConfig{}
+		config.Security.APIKey = "admin-key"
+		config.API.ListenAddress = "localhost"
+		platformManager := NewPlatformManager(new(MockStemManager), nil, new(MockProxyClient), config)
+
+		err := platformManager.bindAdminAPI()
+		assert.Error(t, err)
+	})
+}
+
 func TestNewPlatformManagerWithDI(t *testing.T) {
 	// Set the environment variable for the root folder
 	testRoot := "../../testdata"
@@ -176,10 +287,83 @@ func TestNewPlatformManagerWithDI(t *testing.T) {
 	// Validate the loaded configuration
 	assert.Equal(t, testRoot, platformManager.Config.Plantarium.RootFolder, "RootFolder should match testRoot")
 
-	// Validate HAProxyClient initialization
+	// Validate ProxyClient initialization
 	assert.NotNil(t, platformManager.LeafManager, "LeafManager should be initialized")
 	assert.NotNil(t, platformManager.StemManager, "StemManager should be initialized")
 
 	// Additional validation can check if the dependencies were wired correctly
-	// For example, verify if HAProxyClient or configuration was used as expected.
+	// For example, verify if ProxyClient or configuration was used as expected.
+}
+
+func TestNewProxyClient_HAProxyModes(t *testing.T) {
+	config := &models.GlobalConfig{}
+	config.HAProxy.Mode = haproxy.ModeNone
+	client, err := newProxyClient(config)
+	assert.NoError(t, err)
+	assert.IsType(t, &haproxy.NoopHAProxyClient{}, client)
+	assert.NoError(t, client.BindStem("hello", proxy.BackendOptions{}))
+	assert.NoError(t, client.BindLeaf("hello", "hello-1", "localhost", 8001))
+
+	config.HAProxy.Mode = "docker"
+	_, err = newProxyClient(config)
+	assert.EqualError(t, err, `haproxy.mode "docker" is not one of dataplane or none`)
+}
+
+func TestPlatformManager_SyncProxy(t *testing.T) {
+	journal, err := storage.OpenFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	defer journal.Close()
+	// A previous run registered a stem at /billing that is no longer configured
+	if err := journal.Append(&storage.JournalEntry{Op: storage.OpStemSaved, StemKey: storage.StemKey{Name: "billing", Version: "v1"},
+		Stem: &models.Stem{Name: "billing", Version: "v1", HAProxyBackend: "billing"}}); err != nil {
+		t.Fatalf("failed to append journal entry: %v", err)
+	}
+
+	proxyClient := &backendListingProxyClient{
+		listingProxyClient: &listingProxyClient{MockProxyClient: new(MockProxyClient), servers: map[string][]string{
+			"herbarium": {"herbarium-admin"},
+			"api":       {"api-v1-1", "api-v1-2"},
+			"billing":   {"billing-v1-1"},
+			"legacy":    {"legacy-1"},
+		}},
+		backends: []string{"api", "billing", "herbarium", "legacy"},
+	}
+	proxyClient.On("UnbindLeaf", "api", "api-v1-1").Return(nil).Once()
+	proxyClient.On("UnbindLeaf", "api", "api-v1-2").Return(nil).Once()
+	proxyClient.On("UnbindLeaf", "billing", "billing-v1-1").Return(nil).Once()
+
+	platformManager := NewPlatformManager(new(MockStemManager), nil, proxyClient, &models.GlobalConfig{})
+	platformManager.Journal = journal
+
+	report := platformManager.syncProxy([]Service{{Config: models.StemConfig{Name: "api", Version: "v2", URL: "/api"}}})
+
+	// The configured stem's backend is adopted, the removed stem's emptied, the admin API and foreign backends kept
+	assert.Equal(t, []string{"api"}, report.Adopted)
+	assert.Equal(t, []string{"billing"}, report.Removed)
+	assert.Equal(t, []string{"api/api-v1-1", "api/api-v1-2", "billing/billing-v1-1"}, report.Servers)
+	assert.Empty(t, report.Errors)
+	proxyClient.AssertExpectations(t)
+}
+
+func TestPlatformManager_StepDown(t *testing.T) {
+	mockStemManager := new(MockStemManager)
+	mockStemManager.On("ReadSnapshot").Return(storage.NewStateView(time.Now(), 0, map[storage.StemKey]*models.Stem{
+		{Name: "api", Version: "v1"}: {Name: "api", Version: "v1", LeafInstances: map[string]*models.Leaf{
+			"api-1": {ID: "api-1", Status: models.StatusRunning},
+			"api-2": {ID: "api-2", Status: models.StatusRunning},
+		}},
+		{Name: "idle", Version: "v1"}: {Name: "idle", Version: "v1", GraftNodeLeaf: &models.Leaf{ID: "idle-graft"}},
+	}))
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("StopLeaf", "api", "v1", "api-1").Return(errors.New("haproxy unavailable"))
+	mockLeafManager.On("StopLeaf", "api", "v1", "api-2").Return(nil)
+	mockLeafManager.On("StopGraftNodeLeaf", "idle", "v1").Return(nil)
+
+	platformManager := NewPlatformManager(mockStemManager, mockLeafManager, new(MockProxyClient), &models.GlobalConfig{})
+	platformManager.StepDown()
+
+	// A leaf that fails to stop doesn't keep the others running
+	mockLeafManager.AssertExpectations(t)
 }
@@ -0,0 +1,153 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// ReloadReport summarizes how the configuration on disk was applied by ReloadPlatform.
+type ReloadReport struct {
+	Added   []string `json:"added"`   // Stems registered from new service directories, as name/version
+	Updated []string `json:"updated"` // Registered stems whose changed config was applied
+	Removed []string `json:"removed"` // Stems whose service directory, or current version, is gone
+	Restart []string `json:"restart"` // Global config sections that changed but only apply after a restart
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// ReloadPlatform re-reads the global config and the service directories and applies them without restarting
+// herbarium. The leafs section of the global config applies to leafs started from now on; other changed
+// sections are reported, as they need a restart. Stems with a changed config are updated in place, rolling
+// their leafs; new services are registered, and stems loaded from directories that are gone, or whose current
+// version moved on, are unregistered after the new versions started. Stems registered through the admin API
+// without a service directory are left alone. A stem that fails is reported, the rest is still applied.
+// Registrations and unregistrations are recorded in the deployment history as made by ReloadActor.
+func (p *PlatformManager) ReloadPlatform() (*ReloadReport, error) {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	log.Println("Reloading platform configuration...")
+
+	config, err := loadGlobalConfig()
+	if err != nil {
+		log.Printf("Failed to reload global config, keeping the current one: %v", err)
+		return nil, fmt.Errorf("failed to reload global configuration: %w", err)
+	}
+	detectAdvertiseAddress(config)
+	report := &ReloadReport{Restart: globalConfigChanges(p.Config, config)}
+	for _, section := range report.Restart {
+		log.Printf("Global config section %s changed, restart herbarium to apply it", section)
+	}
+	p.applyLeafsConfig(config)
+	config.Plantarium.RootFolder = p.BasePath
+	p.Config = config
+
+	systemStems, deploymentStems, err := p.GetServiceConfigurations()
+	if err != nil {
+		log.Printf("Failed to retrieve stem configurations: %v", err)
+		return nil, fmt.Errorf("failed to get service configurations: %w", err)
+	}
+
+	found := make(map[storage.StemKey]bool)
+	for _, service := range append(orderByDependencies(systemStems), orderByDependencies(deploymentStems)...) {
+		key := storage.StemKey{Name: service.Config.Name, Version: service.Config.Version}
+		found[key] = true
+		name := key.Name + "/" + key.Version
+
+		stem, err := p.StemManager.FetchStemInfo(key)
+		if err != nil {
+			log.Printf("Registering new stem: %s", name)
+			started := time.Now()
+			err := p.StemManager.RegisterStem(service.Config)
+			p.Deployments.Record(CompletedDeployment(ReloadActor, models.DeploymentDeploy, key, nil, started, err))
+			if err != nil {
+				log.Printf("Failed to register stem %s: %v", name, err)
+				report.Errors = append(report.Errors, fmt.Sprintf("registering %s: %v", name, err))
+				continue
+			}
+			report.Added = append(report.Added, name)
+		} else if stem.Config == nil || !reflect.DeepEqual(*stem.Config, service.Config) {
+			if err := p.StemManager.UpdateStemConfig(key, service.Config, UpdateOptions{RollLeafs: true}); err != nil {
+				log.Printf("Failed to update stem %s: %v", name, err)
+				report.Errors = append(report.Errors, fmt.Sprintf("updating %s: %v", name, err))
+				continue
+			}
+			report.Updated = append(report.Updated, name)
+		}
+		p.loaded[key] = true
+	}
+
+	for _, key := range sortedStemKeys(p.loaded) {
+		if found[key] {
+			continue
+		}
+		name := key.Name + "/" + key.Version
+		log.Printf("Unregistering stem whose service directory is gone: %s", name)
+		started := time.Now()
+		err := p.StemManager.UnregisterStem(key)
+		p.Deployments.Record(CompletedDeployment(ReloadActor, models.DeploymentUnregister, key, nil, started, err))
+		if err != nil {
+			log.Printf("Failed to unregister stem %s: %v", name, err)
+			report.Errors = append(report.Errors, fmt.Sprintf("unregistering %s: %v", name, err))
+			continue
+		}
+		delete(p.loaded, key)
+		report.Removed = append(report.Removed, name)
+	}
+
+	log.Printf("Reloaded platform configuration: %d stems added, %d updated, %d removed, %d errors",
+		len(report.Added), len(report.Updated), len(report.Removed), len(report.Errors))
+	return report, nil
+}
+
+// applyLeafsConfig makes the leaf manager start leafs with the leafs section of a reloaded global config.
+func (p *PlatformManager) applyLeafsConfig(config *models.GlobalConfig) {
+	leafManager, ok := p.LeafManager.(*LeafManager)
+	if !ok {
+		return
+	}
+	leafManager.BindAddress = config.Leafs.BindAddress
+	leafManager.AdvertiseAddress = config.Leafs.AdvertiseAddress
+	leafManager.Env = config.Leafs.Env
+	leafManager.TypeEnv = map[models.StemType]map[string]string{
+		models.StemTypeSystem:     config.Leafs.SystemEnv,
+		models.StemTypeDeployment: config.Leafs.DeploymentEnv,
+	}
+}
+
+// globalConfigChanges names the top-level sections of the global config that differ and need a restart to
+// apply, in the order of the config. The leafs section applies on reload and the root folder can't change.
+func globalConfigChanges(current, updated *models.GlobalConfig) []string {
+	var changes []string
+	currentValue, updatedValue := reflect.ValueOf(*current), reflect.ValueOf(*updated)
+	for i := 0; i < currentValue.NumField(); i++ {
+		name, _, _ := strings.Cut(currentValue.Type().Field(i).Tag.Get("yaml"), ",")
+		if name == "apiVersion" || name == "plantarium" || name == "leafs" {
+			continue
+		}
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), updatedValue.Field(i).Interface()) {
+			changes = append(changes, name)
+		}
+	}
+	return changes
+}
+
+// sortedStemKeys returns the keys of a set of stems ordered by name and version.
+func sortedStemKeys(set map[storage.StemKey]bool) []storage.StemKey {
+	keys := make([]storage.StemKey, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].Version < keys[j].Version
+	})
+	return keys
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPlatformManager_ReloadPlatform(t *testing.T) {
+	testRoot := "../../testdata"
+	assert.NoError(t, os.Setenv("PLANTARIUM_ROOT_FOLDER", testRoot))
+	defer os.Unsetenv("PLANTARIUM_ROOT_FOLDER")
+
+	config := &models.GlobalConfig{}
+	config.Plantarium.RootFolder = testRoot
+	mockStemManager := new(MockStemManager)
+	platformManager := NewPlatformManager(mockStemManager, nil, new(MockProxyClient), config)
+
+	systemServices, deploymentServices, err := platformManager.GetServiceConfigurations()
+	assert.NoError(t, err)
+	planter, hello := systemServices[0].Config, deploymentServices[0].Config
+	planterKey := storage.StemKey{Name: planter.Name, Version: planter.Version}
+	helloKey := storage.StemKey{Name: hello.Name, Version: hello.Version}
+	goneKey := storage.StemKey{Name: "gone", Version: "v1"}
+	platformManager.loaded[planterKey] = true
+	platformManager.loaded[goneKey] = true
+
+	// planter was registered with an older config, hello-service is new, and gone's directory was removed
+	changed := planter
+	changed.Command = "./old-planter.sh"
+	mockStemManager.On("FetchStemInfo", planterKey).Return(&models.Stem{Name: planter.Name, Version: planter.Version, Config: &changed}, nil)
+	mockStemManager.On("FetchStemInfo", helloKey).Return(nil, errors.New("stem not found"))
+	mockStemManager.On("UpdateStemConfig", planterKey, planter, UpdateOptions{RollLeafs: true}).Return(nil)
+	mockStemManager.On("RegisterStem", mock.MatchedBy(func(config models.StemConfig) bool { return config.Name == hello.Name })).Return(nil)
+	mockStemManager.On("UnregisterStem", goneKey).Return(nil)
+
+	report, err := platformManager.ReloadPlatform()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{hello.Name + "/" + hello.Version}, report.Added)
+	assert.Equal(t, []string{planter.Name + "/" + planter.Version}, report.Updated)
+	assert.Equal(t, []string{"gone/v1"}, report.Removed)
+	assert.Empty(t, report.Errors)
+	assert.Contains(t, report.Restart, "haproxy")
+	assert.NotContains(t, report.Restart, "leafs")
+	assert.Equal(t, map[storage.StemKey]bool{planterKey: true, helloKey: true}, platformManager.loaded)
+	mockStemManager.AssertExpectations(t)
+
+	// Unchanged stems are left alone, and a failing stem doesn't stop the reload
+	mockStemManager = new(MockStemManager)
+	platformManager.StemManager = mockStemManager
+	mockStemManager.On("FetchStemInfo", planterKey).Return(&models.Stem{Name: planter.Name, Version: planter.Version, Config: &planter}, nil)
+	mockStemManager.On("FetchStemInfo", helloKey).Return(&models.Stem{Name: hello.Name, Version: hello.Version, Config: &changed}, nil)
+	mockStemManager.On("UpdateStemConfig", helloKey, hello, UpdateOptions{RollLeafs: true}).Return(errors.New("the host is draining"))
+
+	report, err = platformManager.ReloadPlatform()
+	assert.NoError(t, err)
+	assert.Empty(t, report.Added)
+	assert.Empty(t, report.Updated)
+	assert.Empty(t, report.Removed)
+	assert.Empty(t, report.Restart)
+	assert.Equal(t, []string{"updating " + hello.Name + "/" + hello.Version + ": the host is draining"}, report.Errors)
+	mockStemManager.AssertNotCalled(t, "UpdateStemConfig", planterKey, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// LeafBasePort is the first port handed out to leafs.
+const LeafBasePort = 8000
+
+// PortAllocator hands out leaf ports per network ("tcp" or "udp"). A port is reserved from allocation
+// until Release, so leafs starting concurrently never receive the same port before either binds it.
+type PortAllocator struct {
+	mu       sync.Mutex
+	reserved map[string]string // "<port>/<network>" -> owner
+}
+
+// NewPortAllocator creates an allocator with no reservations.
+func NewPortAllocator() *PortAllocator {
+	return &PortAllocator{reserved: make(map[string]string)}
+}
+
+// leafPorts is shared by everything starting leafs in this process, since ports belong to the host.
+var leafPorts = NewPortAllocator()
+
+// maxLeafPort is the last port handed out to leafs.
+const maxLeafPort = 65534
+
+// Allocate reserves the first port from startPort that is neither reserved nor bound on the host.
+func (a *PortAllocator) Allocate(network string, startPort int, owner string) (int, error) {
+	port, err := a.AllocateRange(network, startPort, maxLeafPort, owner)
+	if err != nil {
+		return 0, fmt.Errorf("no available %s ports found", network)
+	}
+	return port, nil
+}
+
+// AllocateRange reserves the first port from first to last, inclusive, that is neither reserved nor bound on
+// the host.
+func (a *PortAllocator) AllocateRange(network string, first, last int, owner string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for port := first; port <= last; port++ {
+		if _, ok := a.reserved[portKey(network, port)]; ok {
+			continue
+		}
+		if portFree(network, port) {
+			a.reserved[portKey(network, port)] = owner
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no available %s ports in range %d-%d", network, first, last)
+}
+
+// Reserve claims a specific port, failing when another owner reserved it or the host already binds it.
+func (a *PortAllocator) Reserve(network string, port int, owner string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if current, ok := a.reserved[portKey(network, port)]; ok {
+		return fmt.Errorf("port %s is already reserved by %s", portKey(network, port), current)
+	}
+	if !portFree(network, port) {
+		return fmt.Errorf("port %s is already in use", portKey(network, port))
+	}
+	a.reserved[portKey(network, port)] = owner
+	return nil
+}
+
+// Release frees a reserved port.
+func (a *PortAllocator) Release(network string, port int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.reserved, portKey(network, port))
+}
+
+// parsePortRange parses a port range such as "9000-9010", or a single port such as "9000".
+func parsePortRange(value string) (first, last int, err error) {
+	lower, upper, isRange := strings.Cut(value, "-")
+	if first, err = strconv.Atoi(strings.TrimSpace(lower)); err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q", value)
+	}
+	last = first
+	if isRange {
+		if last, err = strconv.Atoi(strings.TrimSpace(upper)); err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q", value)
+		}
+	}
+	if first < 1 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("invalid port range %q, ports must be between 1 and 65535 with the lower one first", value)
+	}
+	return first, last, nil
+}
+
+// leafPortRange returns the ports a stem's leafs may listen on: its portRange, or every port from
+// LeafBasePort.
+func leafPortRange(config *models.StemConfig) (first, last int, err error) {
+	if config == nil || config.PortRange == "" {
+		return LeafBasePort, maxLeafPort, nil
+	}
+	return parsePortRange(config.PortRange)
+}
+
+// allocateGraftNodePort reserves the TCP port a stem's graft node serves on, from the stem's port range.
+func allocateGraftNodePort(config *models.StemConfig, graftNodeLeafID string) (int, error) {
+	first, last, err := leafPortRange(config)
+	if err != nil {
+		return 0, err
+	}
+	return leafPorts.AllocateRange("tcp", first, last, graftNodeLeafID)
+}
+
+// portReservation is a reserved port with the leaf it was reserved for.
+type portReservation struct {
+	network string
+	port    int
+	owner   string
+}
+
+// reservations returns the ports currently reserved.
+func (a *PortAllocator) reservations() []portReservation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	reservations := make([]portReservation, 0, len(a.reserved))
+	for key, owner := range a.reserved {
+		var reservation portReservation
+		if _, err := fmt.Sscanf(key, "%d/%s", &reservation.port, &reservation.network); err != nil {
+			continue
+		}
+		reservation.owner = owner
+		reservations = append(reservations, reservation)
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		return portKey(reservations[i].network, reservations[i].port) < portKey(reservations[j].network, reservations[j].port)
+	})
+	return reservations
+}
+
+// portKey formats a port the way it is shown in errors, for example "5353/udp".
+func portKey(network string, port int) string {
+	return fmt.Sprintf("%d/%s", port, network)
+}
+
+// portFree reports whether a port can be bound on all interfaces.
+func portFree(network string, port int) bool {
+	address := fmt.Sprintf(":%d", port)
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
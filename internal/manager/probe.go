@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Probe types selectable with probe.type.
+const (
+	ProbeTCP  = "tcp"
+	ProbeHTTP = "http"
+	ProbeExec = "exec"
+	ProbeGRPC = "grpc"
+)
+
+// Prober checks whether a leaf listening on host and port is healthy, returning why it is not.
+type Prober interface {
+	Probe(host string, port int) error
+}
+
+// TCPProber counts a leaf as healthy once it accepts connections.
+type TCPProber struct {
+	Timeout time.Duration
+}
+
+// Probe connects to the leaf.
+func (p TCPProber) Probe(host string, port int) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), p.Timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HTTPProber counts a leaf as healthy when a GET of Path answers with ExpectedStatus, or with any status
+// below 500 when ExpectedStatus is 0, so leafs without the endpoint are healthy once they serve HTTP at all.
+type HTTPProber struct {
+	Path           string
+	ExpectedStatus int
+	Timeout        time.Duration
+}
+
+// Probe requests the health endpoint of the leaf.
+func (p HTTPProber) Probe(host string, port int) error {
+	client := http.Client{Timeout: p.Timeout}
+	resp, err := client.Get(fmt.Sprintf("http://%s%s", net.JoinHostPort(host, strconv.Itoa(port)), p.Path))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if p.ExpectedStatus != 0 && resp.StatusCode != p.ExpectedStatus {
+		return fmt.Errorf("%s answered with status %d, expected %d", p.Path, resp.StatusCode, p.ExpectedStatus)
+	}
+	if p.ExpectedStatus == 0 && resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s answered with status %d", p.Path, resp.StatusCode)
+	}
+	return nil
+}
+
+// ExecProber counts a leaf as healthy when Command exits with 0. {{.HOST}} and {{.PORT}} in the command are
+// replaced with the leaf's address.
+type ExecProber struct {
+	Command string
+	Dir     string // Directory the command runs in, the stem's working directory
+	Timeout time.Duration
+}
+
+// Probe runs the command against the leaf.
+func (p ExecProber) Probe(host string, port int) error {
+	command, err := prepareCommandWithTemplate(p.Command, map[string]interface{}{
+		"HOST": host,
+		"PORT": port,
+	})
+	if err != nil {
+		return err
+	}
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		return fmt.Errorf("probe command is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+	cmd.Dir = p.Dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("probe command did not finish within %v", p.Timeout)
+		}
+		return fmt.Errorf("probe command failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// probeTimeout returns the time a single probe of a stem may take.
+func probeTimeout(config *models.ProbeConfig) time.Duration {
+	if config != nil {
+		if timeout, err := time.ParseDuration(config.Timeout); err == nil && timeout > 0 {
+			return timeout
+		}
+	}
+	return healthProbeTimeout
+}
+
+// proberOf returns how the leafs of a stem are probed: the stem's probe if it has one, otherwise a GET of its
+// health path, otherwise a TCP connect.
+func proberOf(config *models.StemConfig) Prober {
+	var probe *models.ProbeConfig
+	if config != nil {
+		probe = config.Probe
+	}
+	timeout := probeTimeout(probe)
+	if probe == nil {
+		if healthPath := behaviorOf(config).healthPath; healthPath != "" {
+			return HTTPProber{Path: healthPath, Timeout: timeout}
+		}
+		return TCPProber{Timeout: ServiceCheckInterval}
+	}
+
+	switch probe.Type {
+	case ProbeHTTP:
+		path := probe.Path
+		if path == "" {
+			path = "/"
+		}
+		return HTTPProber{Path: path, ExpectedStatus: probe.ExpectedStatus, Timeout: timeout}
+	case ProbeExec:
+		// Without a working directory, the command runs in herbarium's own
+		dir, _ := getWorkingDirectory(config.Name, config.Version, config)
+		return ExecProber{Command: probe.Command, Dir: dir, Timeout: timeout}
+	case ProbeGRPC:
+		return GRPCProber{Service: probe.Service, Timeout: timeout}
+	default:
+		return TCPProber{Timeout: timeout}
+	}
+}
@@ -0,0 +1,201 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// HTTP/2 frame types and flags used by the gRPC health check.
+const (
+	h2FrameData      = 0x0
+	h2FrameHeaders   = 0x1
+	h2FrameRSTStream = 0x3
+	h2FrameSettings  = 0x4
+	h2FrameGoAway    = 0x7
+
+	h2FlagEndStream  = 0x1
+	h2FlagAck        = 0x1
+	h2FlagEndHeaders = 0x4
+	h2FlagPadded     = 0x8
+)
+
+// h2Preface opens every HTTP/2 connection.
+const h2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// grpcServing is the SERVING status of a grpc.health.v1.HealthCheckResponse.
+const grpcServing = 1
+
+// GRPCProber counts a leaf as healthy when it reports Service as SERVING through the standard gRPC health
+// protocol, grpc.health.v1.Health/Check, over plaintext HTTP/2.
+type GRPCProber struct {
+	Service string
+	Timeout time.Duration
+}
+
+// Probe calls the health service of the leaf. The response headers are not decoded: a server answers a
+// successful check with a HealthCheckResponse message and a failed one with trailers only.
+func (p GRPCProber) Probe(host string, port int) error {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", address, p.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(p.Timeout)); err != nil {
+		return err
+	}
+
+	// Open the connection and send the request on stream 1
+	request := []byte(h2Preface)
+	request = appendH2Frame(request, h2FrameSettings, 0, 0, nil)
+	request = appendH2Frame(request, h2FrameHeaders, h2FlagEndHeaders, 1, grpcHealthHeaders(address))
+	request = appendH2Frame(request, h2FrameData, h2FlagEndStream, 1, grpcHealthRequest(p.Service))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	var message []byte
+	for {
+		frameType, flags, stream, payload, err := readH2Frame(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read health response: %v", err)
+		}
+		switch {
+		case frameType == h2FrameSettings && flags&h2FlagAck == 0:
+			if _, err := conn.Write(appendH2Frame(nil, h2FrameSettings, h2FlagAck, 0, nil)); err != nil {
+				return err
+			}
+		case frameType == h2FrameGoAway:
+			return fmt.Errorf("server closed the connection")
+		case stream != 1:
+		case frameType == h2FrameRSTStream:
+			return fmt.Errorf("server reset the health check")
+		case frameType == h2FrameData:
+			if flags&h2FlagPadded != 0 && len(payload) > 0 {
+				padding := int(payload[0])
+				if padding >= len(payload) {
+					return fmt.Errorf("invalid padding in health response")
+				}
+				payload = payload[1 : len(payload)-padding]
+			}
+			message = append(message, payload...)
+			if len(message) < 5 {
+				continue
+			}
+			if size := 5 + int(binary.BigEndian.Uint32(message[1:5])); len(message) >= size {
+				return grpcHealthStatus(message[5:size])
+			}
+		case frameType == h2FrameHeaders && flags&h2FlagEndStream != 0:
+			return fmt.Errorf("health check failed without a response, the server may not implement grpc.health.v1")
+		}
+	}
+}
+
+// grpcHealthHeaders encodes the request headers of a health check as HPACK literals, which need no
+// header table.
+func grpcHealthHeaders(authority string) []byte {
+	var block []byte
+	for _, field := range [][2]string{
+		{":method", "POST"},
+		{":scheme", "http"},
+		{":path", "/grpc.health.v1.Health/Check"},
+		{":authority", authority},
+		{"content-type", "application/grpc"},
+		{"te", "trailers"},
+	} {
+		block = append(block, 0x00) // Literal without indexing, new name
+		block = appendHPACKString(block, field[0])
+		block = appendHPACKString(block, field[1])
+	}
+	return block
+}
+
+// appendHPACKString appends s as an HPACK string literal without Huffman coding.
+func appendHPACKString(b []byte, s string) []byte {
+	length := len(s)
+	if length < 127 {
+		b = append(b, byte(length))
+	} else {
+		b = append(b, 127)
+		for length -= 127; length >= 128; length >>= 7 {
+			b = append(b, byte(length%128+128))
+		}
+		b = append(b, byte(length))
+	}
+	return append(b, s...)
+}
+
+// grpcHealthRequest encodes a length-prefixed grpc.health.v1.HealthCheckRequest for service.
+func grpcHealthRequest(service string) []byte {
+	var message []byte
+	if service != "" {
+		message = append(message, 0x0a) // Field 1, length-delimited
+		message = binary.AppendUvarint(message, uint64(len(service)))
+		message = append(message, service...)
+	}
+	prefix := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+	return append(prefix, message...)
+}
+
+// grpcHealthStatus decodes a grpc.health.v1.HealthCheckResponse and reports whether its status is SERVING.
+func grpcHealthStatus(message []byte) error {
+	status := uint64(0)
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return fmt.Errorf("invalid health response")
+		}
+		message = message[n:]
+		switch tag & 7 {
+		case 0: // Varint
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return fmt.Errorf("invalid health response")
+			}
+			message = message[n:]
+			if tag>>3 == 1 {
+				status = value
+			}
+		case 2: // Length-delimited
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return fmt.Errorf("invalid health response")
+			}
+			message = message[n+int(length):]
+		default:
+			return fmt.Errorf("invalid health response")
+		}
+	}
+	if status != grpcServing {
+		return fmt.Errorf("health status is %d, not SERVING", status)
+	}
+	return nil
+}
+
+// appendH2Frame appends an HTTP/2 frame to b.
+func appendH2Frame(b []byte, frameType, flags byte, stream uint32, payload []byte) []byte {
+	b = append(b, byte(len(payload)>>16), byte(len(payload)>>8), byte(len(payload)), frameType, flags)
+	b = binary.BigEndian.AppendUint32(b, stream&0x7fffffff)
+	return append(b, payload...)
+}
+
+// readH2Frame reads the next HTTP/2 frame from r.
+func readH2Frame(r io.Reader) (frameType, flags byte, stream uint32, payload []byte, err error) {
+	var header [9]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+	length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	return header[3], header[4], binary.BigEndian.Uint32(header[5:]) & 0x7fffffff, payload, nil
+}
@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProberOf(t *testing.T) {
+	assert.Equal(t, TCPProber{Timeout: ServiceCheckInterval}, proberOf(&models.StemConfig{}))
+	assert.Equal(t, HTTPProber{Path: "/actuator/health", Timeout: healthProbeTimeout}, proberOf(&models.StemConfig{Runtime: RuntimeJava}))
+	assert.Equal(t, HTTPProber{Path: "/", ExpectedStatus: 204, Timeout: 3 * time.Second},
+		proberOf(&models.StemConfig{HealthPath: "/ready", Probe: &models.ProbeConfig{Type: ProbeHTTP, ExpectedStatus: 204, Timeout: "3s"}}))
+	assert.Equal(t, GRPCProber{Service: "billing.v1.Billing", Timeout: healthProbeTimeout},
+		proberOf(&models.StemConfig{Probe: &models.ProbeConfig{Type: ProbeGRPC, Service: "billing.v1.Billing"}}))
+}
+
+func TestHTTPProber_ExpectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	assert.NoError(t, HTTPProber{Path: "/", ExpectedStatus: http.StatusAccepted, Timeout: time.Second}.Probe("127.0.0.1", port))
+	assert.EqualError(t, HTTPProber{Path: "/", ExpectedStatus: http.StatusOK, Timeout: time.Second}.Probe("127.0.0.1", port),
+		"/ answered with status 202, expected 200")
+}
+
+func TestExecProber(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on the test command")
+	}
+	prober := ExecProber{Command: "test {{.PORT}} -eq 8000", Timeout: time.Second}
+	assert.NoError(t, prober.Probe("localhost", 8000))
+	assert.ErrorContains(t, prober.Probe("localhost", 8001), "probe command failed")
+
+	prober = ExecProber{Command: "sleep 5", Timeout: 100 * time.Millisecond}
+	assert.EqualError(t, prober.Probe("localhost", 8000), "probe command did not finish within 100ms")
+}
+
+// serveGRPCHealth answers gRPC health checks on a local port with the status statuses[service], or with
+// trailers only for unknown services.
+func serveGRPCHealth(t *testing.T, statuses map[string]uint64) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				if _, err := io.ReadFull(reader, make([]byte, len(h2Preface))); err != nil {
+					return
+				}
+				var request []byte
+				for {
+					frameType, flags, _, payload, err := readH2Frame(reader)
+					if err != nil {
+						return
+					}
+					if frameType == h2FrameData {
+						request = append(request, payload...)
+						if flags&h2FlagEndStream != 0 {
+							break
+						}
+					}
+				}
+
+				// Decode the service name, which the request carries as field 1
+				service := ""
+				if message := request[5:]; len(message) > 2 {
+					service = string(message[2:])
+				}
+				response := appendH2Frame(nil, h2FrameSettings, 0, 0, nil)
+				response = appendH2Frame(response, h2FrameHeaders, h2FlagEndHeaders, 1, []byte{0x88}) // :status 200
+				if status, ok := statuses[service]; ok {
+					message := []byte{0, 0, 0, 0, 2, 0x08, byte(status)}
+					response = appendH2Frame(response, h2FrameData, 0, 1, message)
+				}
+				response = appendH2Frame(response, h2FrameHeaders, h2FlagEndHeaders|h2FlagEndStream, 1, []byte{0x00})
+				conn.Write(response)
+				io.Copy(io.Discard, reader)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestGRPCProber(t *testing.T) {
+	port := serveGRPCHealth(t, map[string]uint64{"": grpcServing, "billing.v1.Billing": 2})
+
+	assert.NoError(t, GRPCProber{Timeout: time.Second}.Probe("127.0.0.1", port))
+	assert.EqualError(t, GRPCProber{Service: "billing.v1.Billing", Timeout: time.Second}.Probe("127.0.0.1", port),
+		"health status is 2, not SERVING")
+	assert.ErrorContains(t, GRPCProber{Service: "unknown", Timeout: time.Second}.Probe("127.0.0.1", port),
+		"health check failed without a response")
+}
+
+func TestGRPCHealthRequest(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 0, 0}, grpcHealthRequest(""))
+
+	request := grpcHealthRequest("api")
+	assert.Equal(t, uint32(5), binary.BigEndian.Uint32(request[1:5]))
+	assert.Equal(t, []byte{0x0a, 3, 'a', 'p', 'i'}, request[5:])
+}
@@ -0,0 +1,143 @@
+//go:build !windows
+
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// attachLeafProcess is a no-op outside Windows.
+func attachLeafProcess(cmd *exec.Cmd) error {
+	return nil
+}
+
+// killProcessTree terminates a leaf process.
+func killProcessTree(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find process with PID %d: %v", pid, err)
+	}
+
+	err = process.Kill()
+	if err != nil {
+		return fmt.Errorf("failed to kill process with PID %d: %v", pid, err)
+	}
+	return nil
+}
+
+// stopSignals maps the names in StopSignals to signals.
+var stopSignals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// signalProcess sends a named stop signal to a leaf process.
+func signalProcess(pid int, name string) error {
+	signal, ok := stopSignals[name]
+	if !ok {
+		return fmt.Errorf("unsupported stop signal %s", name)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find process with PID %d: %v", pid, err)
+	}
+	if err := process.Signal(signal); err != nil {
+		return fmt.Errorf("failed to send %s to process with PID %d: %v", name, pid, err)
+	}
+	return nil
+}
+
+// processAlive reports whether a process with the given PID is still running. Zombies, which exited but
+// were not yet reaped by their parent, are not, where /proc shows them.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if process.Signal(syscall.Signal(0)) != nil {
+		return false
+	}
+	return !zombie(pid)
+}
+
+// zombie reports whether /proc lists a process in the zombie state.
+func zombie(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name, which may itself contain spaces or parentheses
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+// processMemory returns the resident memory of a process in bytes, read from /proc or, where there is
+// none, from ps.
+func processMemory(pid int) (int64, error) {
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err == nil {
+		for _, line := range strings.Split(string(status), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "VmRSS:" {
+				return parseKilobytes(fields[1])
+			}
+		}
+		// Kernel threads and zombies have no VmRSS
+		return 0, nil
+	}
+	if _, statErr := os.Stat("/proc/self"); statErr == nil {
+		return 0, fmt.Errorf("failed to read memory of process %d: %v", pid, err)
+	}
+	output, err := exec.Command("ps", "-o", "rss=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read memory of process %d: %v", pid, err)
+	}
+	return parseKilobytes(strings.TrimSpace(string(output)))
+}
+
+// clockTicksPerSecond is the unit of the CPU times in /proc/<pid>/stat. Linux fixes it at 100 for user space
+// on every architecture herbarium runs on.
+const clockTicksPerSecond = 100
+
+// processCPUTime returns the CPU time, user and system, a process used so far, read from /proc or, where
+// there is none, from ps.
+func processCPUTime(pid int) (time.Duration, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err == nil {
+		// utime and stime are the 12th and 13th fields after the parenthesized command name
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		if len(fields) < 13 {
+			return 0, fmt.Errorf("unexpected stat of process %d", pid)
+		}
+		var ticks int64
+		for _, field := range fields[11:13] {
+			value, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("unexpected CPU time %q of process %d", field, pid)
+			}
+			ticks += value
+		}
+		return time.Duration(ticks) * time.Second / clockTicksPerSecond, nil
+	}
+	if _, statErr := os.Stat("/proc/self"); statErr == nil {
+		return 0, fmt.Errorf("failed to read CPU time of process %d: %v", pid, err)
+	}
+	output, err := exec.Command("ps", "-o", "time=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read CPU time of process %d: %v", pid, err)
+	}
+	return parseCPUTime(strings.TrimSpace(string(output)))
+}
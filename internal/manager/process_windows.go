@@ -0,0 +1,152 @@
+//go:build windows
+
+package manager
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	leafJob     windows.Handle
+	leafJobErr  error
+	leafJobOnce sync.Once
+)
+
+// getLeafJob lazily creates the job object all leaf processes are assigned to. The job is configured
+// to kill its processes when the last handle closes, so leafs never outlive herbarium.
+func getLeafJob() (windows.Handle, error) {
+	leafJobOnce.Do(func() {
+		job, err := windows.CreateJobObject(nil, nil)
+		if err != nil {
+			leafJobErr = fmt.Errorf("failed to create job object: %v", err)
+			return
+		}
+
+		info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+			BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+				LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+			},
+		}
+		_, err = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+			uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+		if err != nil {
+			windows.CloseHandle(job)
+			leafJobErr = fmt.Errorf("failed to configure job object: %v", err)
+			return
+		}
+		leafJob = job
+	})
+	return leafJob, leafJobErr
+}
+
+// attachLeafProcess assigns a started leaf process to the leaf job object.
+func attachLeafProcess(cmd *exec.Cmd) error {
+	job, err := getLeafJob()
+	if err != nil {
+		return err
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		return fmt.Errorf("failed to open process %d: %v", cmd.Process.Pid, err)
+	}
+	defer windows.CloseHandle(process)
+
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		return fmt.Errorf("failed to assign process %d to job object: %v", cmd.Process.Pid, err)
+	}
+	return nil
+}
+
+// killProcessTree terminates a leaf process together with every child it spawned.
+func killProcessTree(pid int) error {
+	output, err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to kill process tree with PID %d: %v: %s", pid, err, output)
+	}
+	return nil
+}
+
+// signalProcess fails on Windows, which has no stop signals, so leafs are always killed.
+func signalProcess(pid int, name string) error {
+	return fmt.Errorf("stop signal %s is not supported on Windows", name)
+}
+
+// stillActive is the exit code GetExitCodeProcess reports for a running process.
+const stillActive = 259
+
+// processAlive reports whether a process with the given PID is still running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := windows.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == stillActive
+}
+
+// getProcessMemoryInfo is the psapi function reporting a process's working set, which x/sys does not wrap.
+var getProcessMemoryInfo = windows.NewLazySystemDLL("psapi.dll").NewProc("GetProcessMemoryInfo")
+
+// processMemoryCounters is the PROCESS_MEMORY_COUNTERS structure filled by GetProcessMemoryInfo.
+type processMemoryCounters struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// processMemory returns the working set of a process in bytes, the Windows counterpart of resident memory.
+func processMemory(pid int) (int64, error) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION|windows.PROCESS_VM_READ, false, uint32(pid))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open process %d: %v", pid, err)
+	}
+	defer windows.CloseHandle(handle)
+
+	counters := processMemoryCounters{cb: uint32(unsafe.Sizeof(processMemoryCounters{}))}
+	if ok, _, err := getProcessMemoryInfo.Call(uintptr(handle), uintptr(unsafe.Pointer(&counters)), uintptr(counters.cb)); ok == 0 {
+		return 0, fmt.Errorf("failed to read memory of process %d: %v", pid, err)
+	}
+	return int64(counters.WorkingSetSize), nil
+}
+
+// processCPUTime returns the CPU time, user and kernel, a process used so far.
+func processCPUTime(pid int) (time.Duration, error) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open process %d: %v", pid, err)
+	}
+	defer windows.CloseHandle(handle)
+
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return 0, fmt.Errorf("failed to read CPU time of process %d: %v", pid, err)
+	}
+	// The times count 100-nanosecond intervals
+	ticks := func(t windows.Filetime) time.Duration {
+		return time.Duration(uint64(t.HighDateTime)<<32|uint64(t.LowDateTime)) * 100
+	}
+	return ticks(kernel) + ticks(user), nil
+}
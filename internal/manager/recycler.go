@@ -0,0 +1,331 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultRecycleInterval is how often the recycler looks for leafs due for replacement.
+const DefaultRecycleInterval = time.Minute
+
+// Recycler replaces leafs that served too many requests, ran for too long, or use too much memory,
+// protecting services that slowly leak memory, as well as leafs on this host failing their liveness probe and,
+// for stems whose circuit breaker restarts them, leafs the proxy took out of rotation. Ejections of other leafs
+// are recorded as events.
+// The replacement is started, or promoted from the warm pool, before the old leaf is unbound and asked to
+// shut down with its stop signal, so the stem never runs short of leafs. Leafs are only replaced as far as the
+// stem's disruption budget allows.
+type Recycler struct {
+	StemRepo    repos.StemRepositoryInterface
+	LeafManager LeafManagerInterface
+	ProxyClient proxy.ProxyClient
+	Events      *EventLog         // Receives an event for every replaced leaf, nil to only log them
+	Budget      *DisruptionBudget // Limits leaf replacements, shared with the autoscaler
+
+	mu     sync.Mutex               // Serializes passes
+	now    func() time.Time         // Clock leaf ages are measured against
+	warned map[storage.StemKey]bool // Stems already warned that the proxy can't count their requests
+
+	failures map[storage.StemKey]map[string]int  // Liveness probes the running leafs of a stem failed in a row
+	ejected  map[storage.StemKey]map[string]bool // Servers of a stem the proxy had taken out of rotation at the previous pass
+}
+
+// NewRecycler creates a Recycler for the stems in stemRepo.
+func NewRecycler(stemRepo repos.StemRepositoryInterface, leafManager LeafManagerInterface, proxyClient proxy.ProxyClient) *Recycler {
+	return &Recycler{
+		StemRepo:    stemRepo,
+		LeafManager: leafManager,
+		ProxyClient: proxyClient,
+		Budget:      NewDisruptionBudget(),
+		now:         time.Now,
+		warned:      make(map[storage.StemKey]bool),
+		failures:    make(map[storage.StemKey]map[string]int),
+		ejected:     make(map[storage.StemKey]map[string]bool),
+	}
+}
+
+// StartSchedule recycles due leafs every interval until stop is closed.
+func (r *Recycler) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Checking for leafs due for recycling every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("recycler", func() { r.RecycleOnce() })
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// RecycleOnce replaces the most pressing due leaf of every stem configured for recycling and returns how
+// many leafs were replaced. Replacing one leaf per stem and pass spreads the restarts of leafs started together.
+func (r *Recycler) RecycleOnce() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stems, err := r.StemRepo.GetAllStems()
+	if err != nil {
+		log.Printf("Failed to list stems for recycling: %v", err)
+		return 0
+	}
+	recycled := 0
+	for _, stem := range stems {
+		if stem.Config == nil || (stem.Config.Recycle == nil && livenessThreshold(stem.Config) == 0 && circuitBreaker(stem.Config) == nil) {
+			continue
+		}
+		leaf, eventType, reason := r.dueLeaf(stem)
+		if leaf == nil {
+			continue
+		}
+		if err := r.Budget.Allow(stem); err != nil {
+			log.Printf("Holding back recycling of leaf %s of stem %s version %s: %v", leaf.ID, stem.Name, stem.Version, err)
+			continue
+		}
+		if err := r.recycle(stem, leaf, eventType, reason); err != nil {
+			log.Printf("Failed to recycle leaf %s of stem %s version %s: %v", leaf.ID, stem.Name, stem.Version, err)
+			continue
+		}
+		r.Budget.Changed(storage.StemKey{Name: stem.Name, Version: stem.Version})
+		recycled++
+	}
+	return recycled
+}
+
+// dueLeaf returns the running leaf of a stem to replace, along with the event type and the reason: a leaf
+// failing its liveness probe, otherwise a leaf the proxy took out of rotation, otherwise the leaf furthest over
+// the memory limit, otherwise the oldest leaf that reached its maximum age or request count.
+func (r *Recycler) dueLeaf(stem *models.Stem) (*models.Leaf, models.EventType, string) {
+	key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+	leafs, err := r.LeafManager.GetRunningLeafs(key)
+	if err != nil {
+		log.Printf("Failed to list leafs of stem %s version %s for recycling: %v", stem.Name, stem.Version, err)
+		return nil, "", ""
+	}
+	if leaf, reason := r.unhealthyLeaf(key, stem, leafs); leaf != nil {
+		return leaf, models.EventLeafUnhealthy, reason
+	}
+	if leaf := r.ejectedLeaf(key, stem, leafs); leaf != nil {
+		return leaf, models.EventLeafEjected, "was taken out of rotation by the proxy after failing its responses or health checks"
+	}
+	if stem.Config.Recycle == nil {
+		return nil, "", ""
+	}
+	if leaf, memory := r.largestOverLimit(key, leafs, stem.Config.Recycle.MaxMemoryMB); leaf != nil {
+		return leaf, models.EventLeafMemoryExceeded, fmt.Sprintf("used %d MB of memory, over its limit of %d MB",
+			memory>>20, stem.Config.Recycle.MaxMemoryMB)
+	}
+
+	sort.SliceStable(leafs, func(i, j int) bool {
+		return leafs[i].Initialized.Before(leafs[j].Initialized)
+	})
+
+	maxAge, _ := time.ParseDuration(stem.Config.Recycle.MaxAge)
+	maxRequests := stem.Config.Recycle.MaxRequests
+	counts := r.requestCounts(stem)
+	now := r.now()
+	for i := range leafs {
+		leaf := &leafs[i]
+		if age := now.Sub(leaf.Initialized); maxAge > 0 && age >= maxAge {
+			return leaf, models.EventLeafRecycled, fmt.Sprintf("ran for %s", age.Round(time.Second))
+		}
+		if count, ok := counts[leaf.HAProxyServer]; ok && maxRequests > 0 && count >= maxRequests {
+			return leaf, models.EventLeafRecycled, fmt.Sprintf("served %d requests", count)
+		}
+	}
+	return nil, "", ""
+}
+
+// unhealthyLeaf probes the running leafs of a stem on this host and returns the first that failed its
+// liveness probe failureThreshold times in a row, with the reason.
+func (r *Recycler) unhealthyLeaf(key storage.StemKey, stem *models.Stem, leafs []models.Leaf) (*models.Leaf, string) {
+	threshold := livenessThreshold(stem.Config)
+	if threshold == 0 {
+		delete(r.failures, key)
+		return nil, ""
+	}
+
+	prober := proberOf(stem.Config)
+	failures := make(map[string]int)
+	var unhealthy *models.Leaf
+	var reason string
+	for i := range leafs {
+		leaf := &leafs[i]
+		if leaf.Agent != "" {
+			continue
+		}
+		err := prober.Probe(leafHost(leaf), leaf.Port)
+		if err == nil {
+			continue
+		}
+		failures[leaf.ID] = r.failures[key][leaf.ID] + 1
+		log.Printf("Leaf %s of stem %s version %s failed its liveness probe (%d of %d): %v",
+			leaf.ID, stem.Name, stem.Version, failures[leaf.ID], threshold, err)
+		if unhealthy == nil && failures[leaf.ID] >= threshold {
+			unhealthy = leaf
+			reason = fmt.Sprintf("failed its %s probe %d times in a row: %v", stem.Config.Probe.Type, failures[leaf.ID], err)
+		}
+	}
+	r.failures[key] = failures
+	return unhealthy, reason
+}
+
+// ejectedLeaf records an event for every running leaf of a stem with a circuit breaker that the proxy took out
+// of rotation since the previous pass, or returns the first such leaf when the stem has them restarted.
+func (r *Recycler) ejectedLeaf(key storage.StemKey, stem *models.Stem, leafs []models.Leaf) *models.Leaf {
+	breaker := circuitBreaker(stem.Config)
+	reporter, ok := r.ProxyClient.(proxy.EjectionReporter)
+	if breaker == nil || !ok || !proxied(stem.Config) {
+		delete(r.ejected, key)
+		return nil
+	}
+	servers, err := reporter.EjectedServers(stem.HAProxyBackend)
+	if err != nil {
+		log.Printf("Failed to get ejected servers of stem %s version %s: %v", stem.Name, stem.Version, err)
+		return nil
+	}
+	down := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		down[server] = true
+	}
+
+	ejected := make(map[string]bool)
+	var due *models.Leaf
+	for i := range leafs {
+		leaf := &leafs[i]
+		if !down[leaf.HAProxyServer] {
+			continue
+		}
+		ejected[leaf.HAProxyServer] = true
+		if breaker.RestartLeaf {
+			if due == nil {
+				due = leaf
+			}
+			continue
+		}
+		if !r.ejected[key][leaf.HAProxyServer] {
+			r.Events.Record(models.Event{
+				Type:    models.EventLeafEjected,
+				Stem:    stem.Name,
+				Version: stem.Version,
+				Leaf:    leaf.ID,
+				Message: fmt.Sprintf("Leaf %s of stem %s version %s was taken out of rotation by the proxy after failing its responses or health checks",
+					leaf.ID, stem.Name, stem.Version),
+			})
+		}
+	}
+	r.ejected[key] = ejected
+	return due
+}
+
+// circuitBreaker returns the circuit breaker of a stem, nil when it has none.
+func circuitBreaker(config *models.StemConfig) *models.CircuitBreakerConfig {
+	if config == nil || config.Backend == nil {
+		return nil
+	}
+	return config.Backend.CircuitBreaker
+}
+
+// livenessThreshold returns the failed probes in a row after which a leaf of a stem is replaced, 0 when its
+// leafs are not checked for liveness.
+func livenessThreshold(config *models.StemConfig) int {
+	if config == nil || config.Probe == nil || config.Probe.FailureThreshold < 0 {
+		return 0
+	}
+	return config.Probe.FailureThreshold
+}
+
+// largestOverLimit returns the leaf using the most resident memory above limitMB, and how much it uses.
+func (r *Recycler) largestOverLimit(key storage.StemKey, leafs []models.Leaf, limitMB int) (*models.Leaf, int64) {
+	if limitMB <= 0 {
+		return nil, 0
+	}
+	var largest *models.Leaf
+	memory := int64(limitMB) << 20
+	for i := range leafs {
+		resources, err := r.LeafManager.LeafResources(key, leafs[i].ID)
+		if err != nil {
+			log.Printf("Failed to measure memory of leaf %s: %v", leafs[i].ID, err)
+			continue
+		}
+		if resources.MemoryBytes > memory {
+			largest, memory = &leafs[i], resources.MemoryBytes
+		}
+	}
+	if largest == nil {
+		return nil, 0
+	}
+	return largest, memory
+}
+
+// requestCounts returns the requests served by each leaf of a stem with a request limit, by proxy server
+// name, or nil when there is no limit or the proxy can't tell.
+func (r *Recycler) requestCounts(stem *models.Stem) map[string]int64 {
+	if stem.Config.Recycle.MaxRequests <= 0 || !proxied(stem.Config) {
+		return nil
+	}
+	counter, ok := r.ProxyClient.(proxy.RequestCounter)
+	if !ok {
+		key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+		if !r.warned[key] {
+			log.Printf("The proxy does not count requests, recycle.maxRequests of stem %s is ignored", stem.Name)
+			r.warned[key] = true
+		}
+		return nil
+	}
+	counts, err := counter.RequestCounts(stem.HAProxyBackend)
+	if err != nil {
+		log.Printf("Failed to get request counts of stem %s: %v", stem.Name, err)
+		return nil
+	}
+	return counts
+}
+
+// recycle brings up a replacement for a leaf, preferring a standby leaf from the warm pool, then stops it
+// and records an event.
+func (r *Recycler) recycle(stem *models.Stem, leaf *models.Leaf, eventType models.EventType, reason string) error {
+	var replacement string
+	err := ErrNoStandbyLeaf
+	if warmPoolSize(stem.Config) > 0 {
+		replacement, err = r.LeafManager.PromoteStandbyLeaf(stem.Name, stem.Version, nil)
+	}
+	if errors.Is(err, ErrNoStandbyLeaf) {
+		replacement, err = r.LeafManager.StartLeaf(stem.Name, stem.Version, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start replacement leaf: %v", err)
+	}
+
+	if err := r.LeafManager.StopLeaf(stem.Name, stem.Version, leaf.ID); err != nil {
+		return fmt.Errorf("replacement leaf %s started, but failed to stop the old leaf: %v", replacement, err)
+	}
+	countRestart(r.StemRepo, storage.StemKey{Name: stem.Name, Version: stem.Version})
+	r.Events.Record(models.Event{
+		Type:    eventType,
+		Stem:    stem.Name,
+		Version: stem.Version,
+		Leaf:    leaf.ID,
+		Message: fmt.Sprintf("Leaf %s of stem %s version %s %s and was replaced by %s", leaf.ID, stem.Name, stem.Version, reason, replacement),
+	})
+	return nil
+}
+
+// countRestart records that a leaf of the stem was replaced or found dead. The count is informational, so a
+// failure to record it is only logged.
+func countRestart(stemRepo repos.StemRepositoryInterface, key storage.StemKey) {
+	if err := stemRepo.CountStemRestart(key); err != nil {
+		log.Printf("Failed to count a restart of stem %s version %s: %v", key.Name, key.Version, err)
+	}
+}
@@ -0,0 +1,215 @@
+package manager
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingProxyClient is a MockProxyClient that also reports request counts.
+type countingProxyClient struct {
+	*MockProxyClient
+	counts map[string]int64
+}
+
+func (c *countingProxyClient) RequestCounts(backendName string) (map[string]int64, error) {
+	return c.counts, nil
+}
+
+func TestRecycler_RecycleOnce(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	stemRepo := repos.NewStemRepository(db)
+
+	// api is recycled by age, worker by request count, cron not at all
+	apiKey := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[apiKey] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api", Recycle: &models.RecycleConfig{MaxAge: "24h"}}}
+	workerKey := storage.StemKey{Name: "worker", Version: "v1"}
+	db.Stems[workerKey] = &models.Stem{Name: "worker", Version: "v1", HAProxyBackend: "worker",
+		Config: &models.StemConfig{Name: "worker", Version: "v1", URL: "/worker", Recycle: &models.RecycleConfig{MaxRequests: 1000}}}
+	cronKey := storage.StemKey{Name: "cron", Version: "v1"}
+	db.Stems[cronKey] = &models.Stem{Name: "cron", Version: "v1", HAProxyBackend: "cron",
+		Config: &models.StemConfig{Name: "cron", Version: "v1", URL: "/cron"}}
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("GetRunningLeafs", apiKey).Return([]models.Leaf{
+		{ID: "api-young", HAProxyServer: "api-young", Initialized: now.Add(-time.Hour)},
+		{ID: "api-old", HAProxyServer: "api-old", Initialized: now.Add(-30 * time.Hour)},
+		{ID: "api-older", HAProxyServer: "api-older", Initialized: now.Add(-48 * time.Hour)},
+	}, nil)
+	mockLeafManager.On("GetRunningLeafs", workerKey).Return([]models.Leaf{
+		{ID: "worker-1", HAProxyServer: "worker-1", Initialized: now},
+		{ID: "worker-2", HAProxyServer: "worker-2", Initialized: now},
+	}, nil)
+
+	// Only the oldest due leaf of a stem is replaced in a pass
+	mockLeafManager.On("StartLeaf", "api", "v1", (*string)(nil)).Return("api-new", nil).Once()
+	mockLeafManager.On("StopLeaf", "api", "v1", "api-older").Return(nil).Once()
+	mockLeafManager.On("StartLeaf", "worker", "v1", (*string)(nil)).Return("worker-3", nil).Once()
+	mockLeafManager.On("StopLeaf", "worker", "v1", "worker-2").Return(nil).Once()
+
+	proxyClient := &countingProxyClient{MockProxyClient: new(MockProxyClient), counts: map[string]int64{"worker-1": 999, "worker-2": 1000}}
+	recycler := NewRecycler(stemRepo, mockLeafManager, proxyClient)
+	recycler.now = func() time.Time { return now }
+
+	assert.Equal(t, 2, recycler.RecycleOnce())
+	mockLeafManager.AssertExpectations(t)
+	mockLeafManager.AssertNotCalled(t, "GetRunningLeafs", cronKey)
+}
+
+func TestRecycler_PrefersWarmPool(t *testing.T) {
+	now := time.Now()
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	warmPool := 1
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api", WarmPool: &warmPool,
+			Recycle: &models.RecycleConfig{MaxAge: "1h", MaxRequests: 10}}}
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("GetRunningLeafs", key).Return([]models.Leaf{{ID: "api-1", HAProxyServer: "api-1", Initialized: now.Add(-2 * time.Hour)}}, nil)
+	mockLeafManager.On("PromoteStandbyLeaf", "api", "v1", (*string)(nil)).Return("api-standby", nil).Once()
+	mockLeafManager.On("StopLeaf", "api", "v1", "api-1").Return(nil).Once()
+
+	// A proxy without request counts still recycles by age
+	recycler := NewRecycler(repos.NewStemRepository(db), mockLeafManager, new(MockProxyClient))
+	assert.Equal(t, 1, recycler.RecycleOnce())
+	mockLeafManager.AssertExpectations(t)
+	mockLeafManager.AssertNotCalled(t, "StartLeaf", "api", "v1", (*string)(nil))
+
+	// A failed replacement leaves the old leaf running
+	mockLeafManager.On("PromoteStandbyLeaf", "api", "v1", (*string)(nil)).Return("", ErrNoStandbyLeaf).Once()
+	mockLeafManager.On("StartLeaf", "api", "v1", (*string)(nil)).Return("", assert.AnError).Once()
+	assert.Zero(t, recycler.RecycleOnce())
+	mockLeafManager.AssertNumberOfCalls(t, "StopLeaf", 1)
+}
+
+func TestRecycler_MemoryLimit(t *testing.T) {
+	now := time.Now()
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api", Recycle: &models.RecycleConfig{MaxMemoryMB: 512, MaxAge: "24h"}}}
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("GetRunningLeafs", key).Return([]models.Leaf{
+		{ID: "api-1", Initialized: now.Add(-48 * time.Hour)},
+		{ID: "api-2", Initialized: now},
+		{ID: "api-3", Initialized: now},
+	}, nil)
+	mockLeafManager.On("LeafResources", key, "api-1").Return(&LeafResources{MemoryBytes: 100 << 20}, nil)
+	mockLeafManager.On("LeafResources", key, "api-2").Return(&LeafResources{MemoryBytes: 600 << 20}, nil)
+	mockLeafManager.On("LeafResources", key, "api-3").Return(&LeafResources{MemoryBytes: 900 << 20}, nil)
+
+	// The leaf furthest over the limit goes first, even before a leaf past its maximum age
+	mockLeafManager.On("StartLeaf", "api", "v1", (*string)(nil)).Return("api-4", nil).Once()
+	mockLeafManager.On("StopLeaf", "api", "v1", "api-3").Return(nil).Once()
+
+	recycler := NewRecycler(repos.NewStemRepository(db), mockLeafManager, new(MockProxyClient))
+	recycler.Events = NewEventLog(0)
+	assert.Equal(t, 1, recycler.RecycleOnce())
+	mockLeafManager.AssertExpectations(t)
+
+	events := recycler.Events.List(EventQuery{})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, models.EventLeafMemoryExceeded, events[0].Type)
+		assert.Equal(t, "api-3", events[0].Leaf)
+		assert.Equal(t, "Leaf api-3 of stem api version v1 used 900 MB of memory, over its limit of 512 MB and was replaced by api-4", events[0].Message)
+	}
+}
+
+func TestRecycler_Liveness(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	healthyPort := listener.Addr().(*net.TCPAddr).Port
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	deadPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api",
+			Probe: &models.ProbeConfig{Type: ProbeTCP, FailureThreshold: 2}}}
+
+	// Leafs on agents are left to their runtime
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("GetRunningLeafs", key).Return([]models.Leaf{
+		{ID: "api-1", Host: "127.0.0.1", Port: healthyPort},
+		{ID: "api-2", Host: "127.0.0.1", Port: deadPort},
+		{ID: "api-3", Host: "127.0.0.1", Port: deadPort, Agent: "edge"},
+	}, nil)
+	mockLeafManager.On("StartLeaf", "api", "v1", (*string)(nil)).Return("api-4", nil).Once()
+	mockLeafManager.On("StopLeaf", "api", "v1", "api-2").Return(nil).Once()
+
+	recycler := NewRecycler(repos.NewStemRepository(db), mockLeafManager, new(MockProxyClient))
+	recycler.Events = NewEventLog(0)
+	assert.Equal(t, 0, recycler.RecycleOnce(), "a single failed probe is tolerated")
+	assert.Equal(t, 1, recycler.RecycleOnce())
+	mockLeafManager.AssertExpectations(t)
+
+	events := recycler.Events.List(EventQuery{})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, models.EventLeafUnhealthy, events[0].Type)
+		assert.Equal(t, "api-2", events[0].Leaf)
+		assert.Contains(t, events[0].Message, "failed its tcp probe 2 times in a row")
+	}
+}
+
+// ejectingProxyClient is a MockProxyClient that also reports the servers it took out of rotation.
+type ejectingProxyClient struct {
+	*MockProxyClient
+	ejected []string
+}
+
+func (c *ejectingProxyClient) EjectedServers(backendName string) ([]string, error) {
+	return c.ejected, nil
+}
+
+func TestRecycler_CircuitBreaker(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	apiKey := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[apiKey] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api",
+			Backend: &models.BackendConfig{CircuitBreaker: &models.CircuitBreakerConfig{ErrorLimit: 10}}}}
+	workerKey := storage.StemKey{Name: "worker", Version: "v1"}
+	db.Stems[workerKey] = &models.Stem{Name: "worker", Version: "v1", HAProxyBackend: "worker",
+		Config: &models.StemConfig{Name: "worker", Version: "v1", URL: "/worker",
+			Backend: &models.BackendConfig{CircuitBreaker: &models.CircuitBreakerConfig{ErrorLimit: 10, RestartLeaf: true}}}}
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("GetRunningLeafs", apiKey).Return([]models.Leaf{
+		{ID: "api-1", HAProxyServer: "api-1"},
+		{ID: "api-2", HAProxyServer: "api-2"},
+	}, nil)
+	mockLeafManager.On("GetRunningLeafs", workerKey).Return([]models.Leaf{
+		{ID: "worker-1", HAProxyServer: "worker-1"},
+	}, nil)
+	mockLeafManager.On("StartLeaf", "worker", "v1", (*string)(nil)).Return("worker-2", nil)
+	mockLeafManager.On("StopLeaf", "worker", "v1", "worker-1").Return(nil)
+
+	proxyClient := &ejectingProxyClient{MockProxyClient: new(MockProxyClient), ejected: []string{"api-2", "worker-1"}}
+	recycler := NewRecycler(repos.NewStemRepository(db), mockLeafManager, proxyClient)
+	recycler.Events = NewEventLog(0)
+
+	// Only the worker restarts its ejected leafs, the api's ejection is recorded once while it lasts
+	assert.Equal(t, 1, recycler.RecycleOnce())
+	assert.Equal(t, 1, recycler.RecycleOnce())
+	mockLeafManager.AssertNotCalled(t, "StopLeaf", "api", "v1", "api-2")
+
+	events := recycler.Events.List(EventQuery{})
+	var ejected []string
+	for _, event := range events {
+		assert.Equal(t, models.EventLeafEjected, event.Type)
+		ejected = append(ejected, event.Leaf)
+	}
+	assert.ElementsMatch(t, []string{"api-2", "worker-1", "worker-1"}, ejected)
+}
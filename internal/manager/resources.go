@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// LeafResources is a point-in-time measurement of the resources a leaf uses.
+type LeafResources struct {
+	MemoryBytes int64         // Resident memory of the leaf process, 0 when unknown
+	CPUTime     time.Duration // CPU time the leaf process used so far, 0 when unknown
+}
+
+// LeafResources measures a leaf of a stem. Leafs run by herbarium are measured directly, agent and SSH
+// leafs through their runtime. Static leafs are served by herbarium itself and report nothing.
+func (l *LeafManager) LeafResources(key storage.StemKey, leafID string) (*LeafResources, error) {
+	stem, err := l.StemRepo.FetchStem(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stem %s: %v", key, err)
+	}
+	leaf, exists := stem.LeafInstances[leafID]
+	if !exists {
+		return nil, fmt.Errorf("leaf with ID %s not found in stem %s", leafID, key)
+	}
+
+	switch leaf.Agent {
+	case "":
+		memory, err := processMemory(leaf.PID)
+		if err != nil {
+			return nil, err
+		}
+		// CPU time is informational, so a process that can't report it still reports its memory
+		cpuTime, _ := processCPUTime(leaf.PID)
+		return &LeafResources{MemoryBytes: memory, CPUTime: cpuTime}, nil
+	case StaticRuntimeName:
+		return &LeafResources{}, nil
+	}
+	runtime, err := remoteRuntime(l.Agents, stem.Config, leaf.Agent)
+	if err != nil {
+		return nil, fmt.Errorf("leaf %s runs on an unavailable runtime: %v", leafID, err)
+	}
+	remote, err := runtime.GetLeaf(leafID)
+	if err != nil {
+		return nil, err
+	}
+	return &LeafResources{MemoryBytes: remote.MemoryBytes, CPUTime: time.Duration(remote.CPUSeconds * float64(time.Second))}, nil
+}
+
+// parseKilobytes converts a kilobyte count as printed by /proc and ps to bytes.
+func parseKilobytes(value string) (int64, error) {
+	kilobytes, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected memory size %q: %v", value, err)
+	}
+	return kilobytes * 1024, nil
+}
+
+// parseCPUTime converts a CPU time as printed by ps, [[dd-]hh:]mm:ss[.ss], to a duration.
+func parseCPUTime(value string) (time.Duration, error) {
+	var total time.Duration
+	if days, rest, ok := strings.Cut(value, "-"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected CPU time %q", value)
+		}
+		total = time.Duration(count) * 24 * time.Hour
+		value = rest
+	}
+
+	parts := strings.Split(value, ":")
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || len(parts) > 3 {
+		return 0, fmt.Errorf("unexpected CPU time %q", value)
+	}
+	total += time.Duration(seconds * float64(time.Second))
+	for i, unit := range []time.Duration{time.Minute, time.Hour}[:len(parts)-1] {
+		count, err := strconv.Atoi(parts[len(parts)-2-i])
+		if err != nil {
+			return 0, fmt.Errorf("unexpected CPU time %q", value)
+		}
+		total += time.Duration(count) * unit
+	}
+	return total, nil
+}
@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeafManager_LeafResources(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	agentName := "edge-1"
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", Config: &models.StemConfig{Name: "api", Version: "v1", Agent: &agentName},
+		LeafInstances: map[string]*models.Leaf{
+			// The test process stands in for a leaf run by herbarium
+			"api-local":  {ID: "api-local", PID: os.Getpid()},
+			"api-remote": {ID: "api-remote", Agent: agentName},
+			"api-static": {ID: "api-static", Agent: StaticRuntimeName},
+		}}
+
+	mockAgent := new(MockAgentClient)
+	mockAgent.On("GetLeaf", "api-remote").Return(&AgentLeaf{ID: "api-remote", Alive: true, MemoryBytes: 128 << 20, CPUSeconds: 2.5}, nil)
+	leafManager := NewLeafManager(repos.NewLeafRepository(db), new(MockProxyClient), repos.NewStemRepository(db))
+	leafManager.Agents = map[string]LeafRuntime{agentName: mockAgent}
+
+	resources, err := leafManager.LeafResources(key, "api-local")
+	if assert.NoError(t, err) {
+		assert.Positive(t, resources.MemoryBytes)
+	}
+	resources, err = leafManager.LeafResources(key, "api-remote")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(128<<20), resources.MemoryBytes)
+		assert.Equal(t, 2500*time.Millisecond, resources.CPUTime)
+	}
+	resources, err = leafManager.LeafResources(key, "api-static")
+	if assert.NoError(t, err) {
+		assert.Zero(t, resources.MemoryBytes)
+	}
+	_, err = leafManager.LeafResources(key, "api-missing")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestParseCPUTime(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"0:00.03":     30 * time.Millisecond,
+		"01:02:03":    time.Hour + 2*time.Minute + 3*time.Second,
+		"2-00:00:01":  48*time.Hour + time.Second,
+		"12:30":       12*time.Minute + 30*time.Second,
+		"1:02:03.500": time.Hour + 2*time.Minute + 3500*time.Millisecond,
+	} {
+		parsed, err := parseCPUTime(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, parsed, value)
+	}
+	_, err := parseCPUTime("soon")
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Language runtimes with built-in adapters, selected by the runtime field of a stem config.
+const (
+	RuntimeJava   = "java"
+	RuntimeNode   = "node"
+	RuntimePython = "python"
+	RuntimeGo     = "go"
+)
+
+// DefaultStopSignal asks leafs without a runtime adapter or stopSignal to shut down.
+const DefaultStopSignal = "SIGTERM"
+
+// StopSignals are the signals a stem may name as its stopSignal. Windows has none, so leafs there are killed.
+var StopSignals = []string{"SIGTERM", "SIGINT", "SIGQUIT", "SIGHUP", "SIGUSR1", "SIGUSR2"}
+
+// DefaultStopTimeout is how long a leaf may take to exit after its stop signal before it is killed.
+const DefaultStopTimeout = 10 * time.Second
+
+// healthProbeTimeout bounds a single readiness request to a leaf's health endpoint.
+const healthProbeTimeout = time.Second
+
+// RuntimeAdapter holds what herbarium knows about leafs of one language runtime, so their stem configs
+// don't have to spell it out.
+type RuntimeAdapter struct {
+	StartPatterns []string      // Log output showing the leaf is ready, matched case-insensitively
+	HealthPath    string        // HTTP endpoint polled for readiness, ready once it answers without a 5xx status
+	StopSignal    string        // Signal asking the leaf to shut down gracefully
+	StopTimeout   time.Duration // How long the leaf may take to shut down before it is killed
+}
+
+// runtimeAdapters are the built-in adapters by runtime name.
+var runtimeAdapters = map[string]RuntimeAdapter{
+	RuntimeJava: {
+		// Spring Boot, Quarkus, and Jetty log "Started ...", Micronaut "Startup completed in ..."
+		StartPatterns: []string{"Started ", "Startup completed in"},
+		HealthPath:    "/actuator/health",
+		StopSignal:    "SIGTERM",
+		StopTimeout:   30 * time.Second,
+	},
+	RuntimeNode: {
+		// Express, Fastify, NestJS, and Next.js
+		StartPatterns: []string{"listening on", "Server listening at", "Nest application successfully started", "Ready in"},
+		HealthPath:    "/health",
+		StopSignal:    "SIGTERM",
+		StopTimeout:   DefaultStopTimeout,
+	},
+	RuntimePython: {
+		// Uvicorn, Gunicorn, and the Flask and Django development servers; SIGINT lets them clean up
+		StartPatterns: []string{"Application startup complete", "Listening at: ", "Running on http", "Starting development server at"},
+		HealthPath:    "/health",
+		StopSignal:    "SIGINT",
+		StopTimeout:   DefaultStopTimeout,
+	},
+	RuntimeGo: {
+		StartPatterns: []string{"listening on", "server started", "starting server"},
+		HealthPath:    "/healthz",
+		StopSignal:    "SIGTERM",
+		StopTimeout:   DefaultStopTimeout,
+	},
+}
+
+// leafBehavior is how the leafs of a stem are detected as ready and stopped: the stem config where it says
+// so, otherwise the defaults of its runtime adapter.
+type leafBehavior struct {
+	startPatterns []string // Log output showing the leaf is ready
+	ignoreCase    bool     // Whether startPatterns come from an adapter and match case-insensitively
+	healthPath    string
+	stopSignal    string
+	stopTimeout   time.Duration
+}
+
+// behaviorOf resolves the leaf behavior of a stem. An explicit startMessage replaces the adapter's patterns.
+func behaviorOf(config *models.StemConfig) leafBehavior {
+	behavior := leafBehavior{stopSignal: DefaultStopSignal, stopTimeout: DefaultStopTimeout}
+	if config == nil {
+		return behavior
+	}
+	if adapter, ok := runtimeAdapters[config.Runtime]; ok {
+		behavior = leafBehavior{
+			startPatterns: adapter.StartPatterns,
+			ignoreCase:    true,
+			healthPath:    adapter.HealthPath,
+			stopSignal:    adapter.StopSignal,
+			stopTimeout:   adapter.StopTimeout,
+		}
+	}
+	if config.StartMessage != nil && *config.StartMessage != "" {
+		behavior.startPatterns = []string{*config.StartMessage}
+		behavior.ignoreCase = false
+	}
+	if config.HealthPath != "" {
+		behavior.healthPath = config.HealthPath
+	}
+	if config.StopSignal != "" {
+		behavior.stopSignal = config.StopSignal
+	}
+	if timeout, err := time.ParseDuration(config.StopTimeout); err == nil && timeout > 0 {
+		behavior.stopTimeout = timeout
+	}
+	return behavior
+}
+
+// isStartLine reports whether a line of leaf output shows the leaf is ready.
+func (b leafBehavior) isStartLine(line string) bool {
+	if b.ignoreCase {
+		line = strings.ToLower(line)
+	}
+	for _, pattern := range b.startPatterns {
+		if b.ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if strings.Contains(line, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpReady reports whether a leaf answers its health endpoint. Any status below 500 counts, so leafs
+// without the endpoint are ready once they serve HTTP at all.
+func httpReady(host string, port int, healthPath string) bool {
+	return HTTPProber{Path: healthPath, Timeout: healthProbeTimeout}.Probe(host, port) == nil
+}
+
+// stopLeafProcess asks a leaf process to shut down with the stem's stop signal and kills it, together with
+// any children, if it is still running after the stop timeout.
+func stopLeafProcess(pid int, config *models.StemConfig) error {
+	exited, err := terminateLeafProcess(pid, behaviorOf(config))
+	if exited {
+		return nil
+	}
+	log.Printf("Killing process %d: %v", pid, err)
+	return killProcessTree(pid)
+}
+
+// terminateLeafProcess sends a leaf process its stop signal and reports whether it exited within the stop
+// timeout, with the reason when it didn't.
+func terminateLeafProcess(pid int, behavior leafBehavior) (bool, error) {
+	if err := signalProcess(pid, behavior.stopSignal); err != nil {
+		return false, err
+	}
+	for deadline := time.Now().Add(behavior.stopTimeout); time.Now().Before(deadline); time.Sleep(ServiceCheckInterval) {
+		if !processAlive(pid) {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("process %d did not exit within %v of %s", pid, behavior.stopTimeout, behavior.stopSignal)
+}
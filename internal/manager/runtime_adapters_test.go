@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBehaviorOf(t *testing.T) {
+	defaults := behaviorOf(&models.StemConfig{})
+	assert.Equal(t, DefaultStopSignal, defaults.stopSignal)
+	assert.Equal(t, DefaultStopTimeout, defaults.stopTimeout)
+	assert.False(t, defaults.isStartLine("Started Application in 2.3 seconds"))
+
+	java := behaviorOf(&models.StemConfig{Runtime: RuntimeJava})
+	assert.True(t, java.isStartLine("INFO 1 --- [main] c.e.BillingApplication : Started BillingApplication in 2.3 seconds"))
+	assert.True(t, java.isStartLine("[main] INFO io.micronaut.runtime.Micronaut - Startup completed in 412ms"))
+	assert.False(t, java.isStartLine("Starting BillingApplication using Java 21"))
+	assert.Equal(t, "/actuator/health", java.healthPath)
+	assert.Equal(t, 30*time.Second, java.stopTimeout)
+
+	python := behaviorOf(&models.StemConfig{Runtime: RuntimePython})
+	assert.True(t, python.isStartLine("INFO:     Application startup complete."))
+	assert.Equal(t, "SIGINT", python.stopSignal)
+
+	// Settings in the stem config override the adapter, and a start message replaces its patterns
+	startMessage := "Ready to serve"
+	custom := behaviorOf(&models.StemConfig{
+		Runtime:      RuntimeNode,
+		StartMessage: &startMessage,
+		HealthPath:   "/ready",
+		StopSignal:   "SIGQUIT",
+		StopTimeout:  "45s",
+	})
+	assert.True(t, custom.isStartLine("Ready to serve on 8000"))
+	assert.False(t, custom.isStartLine("ready to serve on 8000"), "start messages stay case-sensitive")
+	assert.False(t, custom.isStartLine("listening on 8000"))
+	assert.Equal(t, "/ready", custom.healthPath)
+	assert.Equal(t, "SIGQUIT", custom.stopSignal)
+	assert.Equal(t, 45*time.Second, custom.stopTimeout)
+}
+
+func TestHTTPReady(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/actuator/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	assert.False(t, httpReady("127.0.0.1", port, "/actuator/health"), "a 5xx health status is not ready")
+	status = http.StatusOK
+	assert.True(t, httpReady("127.0.0.1", port, "/actuator/health"))
+	assert.True(t, httpReady("127.0.0.1", port, "/health"), "leafs without the endpoint are ready once they serve HTTP")
+
+	server.Close()
+	assert.False(t, httpReady("127.0.0.1", port, "/actuator/health"))
+}
+
+func TestStopLeafProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stop signals are not supported on Windows")
+	}
+
+	// A leaf shutting down on SIGINT exits before the timeout
+	graceful := exec.Command("sh", "-c", "trap 'exit 0' INT; while true; do sleep 0.1; done")
+	assert.NoError(t, graceful.Start())
+	go graceful.Wait()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	assert.NoError(t, stopLeafProcess(graceful.Process.Pid, &models.StemConfig{Runtime: RuntimePython}))
+	assert.Less(t, time.Since(start), DefaultStopTimeout)
+	assert.False(t, processAlive(graceful.Process.Pid))
+
+	// A leaf ignoring its stop signal is killed once the timeout passes
+	stubborn := exec.Command("sh", "-c", "trap '' TERM; while true; do sleep 0.1; done")
+	assert.NoError(t, stubborn.Start())
+	go stubborn.Wait()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, stopLeafProcess(stubborn.Process.Pid, &models.StemConfig{StopTimeout: "300ms"}))
+	assert.Eventually(t, func() bool { return !processAlive(stubborn.Process.Pid) }, time.Second, ServiceCheckInterval)
+}
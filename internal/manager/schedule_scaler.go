@@ -0,0 +1,208 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultScheduleInterval is how often the schedule scaler checks the stems' scaling schedules.
+const DefaultScheduleInterval = time.Minute
+
+// scheduleDays maps the day names of a schedule to the weekdays they cover.
+var scheduleDays = map[string][]time.Weekday{
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"sun":      {time.Sunday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// ScheduleScaler scales stems with schedules to the leafs their current time window asks for. When a window
+// opens or closes, the stem is scaled to the new count, down to a graft node when it falls back to zero
+// minInstances. Within a window, a stem that runs fewer leafs is scaled back up, while one scaled above the
+// window's count is left alone until the next change.
+type ScheduleScaler struct {
+	StemRepo    repos.StemRepositoryInterface
+	StemManager StemManagerInterface
+
+	mu      sync.Mutex              // Serializes passes
+	now     func() time.Time        // Clock schedules are checked against
+	applied map[storage.StemKey]int // Leafs the schedule of each stem asked for in the previous pass
+}
+
+// NewScheduleScaler creates a ScheduleScaler for the stems in stemRepo, scaled through stemManager.
+func NewScheduleScaler(stemRepo repos.StemRepositoryInterface, stemManager StemManagerInterface) *ScheduleScaler {
+	return &ScheduleScaler{
+		StemRepo:    stemRepo,
+		StemManager: stemManager,
+		now:         time.Now,
+		applied:     make(map[storage.StemKey]int),
+	}
+}
+
+// StartSchedule applies the stems' schedules every interval until stop is closed.
+func (s *ScheduleScaler) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Checking scaling schedules every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("schedule scaler", func() { s.ScaleOnce() })
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// ScaleOnce scales every stem with schedules whose leaf count differs from what its schedule asks for, and
+// returns how many stems were scaled.
+func (s *ScheduleScaler) ScaleOnce() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stems, err := s.StemRepo.GetAllStems()
+	if err != nil {
+		log.Printf("Failed to list stems for scheduled scaling: %v", err)
+		return 0
+	}
+
+	scaled := 0
+	scheduled := make(map[storage.StemKey]bool)
+	for _, stem := range stems {
+		if stem.Config == nil || len(stem.Config.Schedules) == 0 {
+			continue
+		}
+		key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+		scheduled[key] = true
+
+		target, err := scheduledInstances(stem.Config, s.now())
+		if err != nil {
+			log.Printf("Invalid schedule of stem %s version %s: %v", key.Name, key.Version, err)
+			continue
+		}
+		previous, seen := s.applied[key]
+		s.applied[key] = target
+
+		current := desiredInstances(stem)
+		if current == target || (seen && previous == target && current > target) {
+			continue
+		}
+		log.Printf("Schedule of stem %s version %s asks for %d leafs, scaling from %d", key.Name, key.Version, target, current)
+		if err := s.StemManager.Scale(key, target); err != nil {
+			log.Printf("Failed to scale stem %s version %s on schedule: %v", key.Name, key.Version, err)
+			delete(s.applied, key) // Retried on the next pass
+			continue
+		}
+		scaled++
+	}
+
+	for key := range s.applied {
+		if !scheduled[key] {
+			delete(s.applied, key)
+		}
+	}
+	return scaled
+}
+
+// scheduledInstances returns the leafs a stem should run at now: the most any of its active windows asks
+// for, or its minInstances outside all of them, kept within minInstances and maxInstances.
+func scheduledInstances(config *models.StemConfig, now time.Time) (int, error) {
+	minInstances := minInstancesOf(config)
+	target := minInstances
+	for i, schedule := range config.Schedules {
+		window, err := parseSchedule(schedule)
+		if err != nil {
+			return 0, fmt.Errorf("schedule %d: %v", i+1, err)
+		}
+		if window.active(now) && schedule.Instances > target {
+			target = schedule.Instances
+		}
+	}
+	if config.MaxInstances != nil && target > *config.MaxInstances {
+		target = *config.MaxInstances
+	}
+	return target, nil
+}
+
+// scheduleWindow is a parsed ScheduleConfig.
+type scheduleWindow struct {
+	days     [7]bool // Weekdays the window starts on
+	from, to int     // Minutes after midnight
+	location *time.Location
+}
+
+// parseSchedule checks a schedule and returns its window.
+func parseSchedule(schedule models.ScheduleConfig) (*scheduleWindow, error) {
+	window := &scheduleWindow{location: time.Local}
+	if len(schedule.Days) == 0 {
+		window.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, day := range schedule.Days {
+		weekdays, ok := scheduleDays[strings.ToLower(day)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q, expected mon to sun, weekdays, or weekends", day)
+		}
+		for _, weekday := range weekdays {
+			window.days[weekday] = true
+		}
+	}
+
+	var err error
+	if window.from, err = parseClock(schedule.From); err != nil {
+		return nil, fmt.Errorf("from: %v", err)
+	}
+	if window.to, err = parseClock(schedule.To); err != nil {
+		return nil, fmt.Errorf("to: %v", err)
+	}
+	if schedule.Instances < 0 {
+		return nil, fmt.Errorf("instances must not be negative, got %d", schedule.Instances)
+	}
+	if schedule.Timezone != "" {
+		if window.location, err = time.LoadLocation(schedule.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q: %v", schedule.Timezone, err)
+		}
+	}
+	return window, nil
+}
+
+// parseClock parses a HH:MM time of day into minutes after midnight.
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// active reports whether now falls into the window. A window whose end is before its start runs past
+// midnight into the next day, and one whose end equals its start lasts the whole day.
+func (w *scheduleWindow) active(now time.Time) bool {
+	local := now.In(w.location)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	switch {
+	case w.from < w.to:
+		return w.days[day] && minute >= w.from && minute < w.to
+	case w.from > w.to:
+		if minute >= w.from {
+			return w.days[day]
+		}
+		return minute < w.to && w.days[(day+6)%7]
+	default:
+		return w.days[day]
+	}
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestScheduledInstances(t *testing.T) {
+	one, four := 1, 4
+	config := &models.StemConfig{
+		MinInstances: &one,
+		MaxInstances: &four,
+		Schedules: []models.ScheduleConfig{
+			{Days: []string{"weekdays"}, From: "08:00", To: "20:00", Instances: 3},
+			{Days: []string{"fri"}, From: "22:00", To: "02:00", Instances: 6},
+		},
+	}
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("Mon 2006-01-02 15:04", value, time.Local)
+		assert.NoError(t, err)
+		return parsed
+	}
+
+	tests := []struct {
+		now      string
+		expected int
+	}{
+		{"Wed 2026-10-14 08:00", 3},
+		{"Wed 2026-10-14 19:59", 3},
+		{"Wed 2026-10-14 20:00", 1}, // Falls back to minInstances
+		{"Sat 2026-10-17 12:00", 1},
+		{"Fri 2026-10-16 23:00", 4}, // Capped at maxInstances
+		{"Sat 2026-10-17 01:30", 4}, // Past midnight, the window started on friday
+		{"Sun 2026-10-18 01:30", 1},
+	}
+	for _, test := range tests {
+		instances, err := scheduledInstances(config, at(test.now))
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, instances, test.now)
+	}
+
+	config.Schedules = []models.ScheduleConfig{{Days: []string{"someday"}, From: "08:00", To: "20:00"}}
+	_, err := scheduledInstances(config, time.Now())
+	assert.ErrorContains(t, err, `schedule 1: unknown day "someday"`)
+	config.Schedules = []models.ScheduleConfig{{From: "8am", To: "20:00"}}
+	_, err = scheduledInstances(config, time.Now())
+	assert.ErrorContains(t, err, `from: "8am" is not a HH:MM time`)
+}
+
+func TestScheduleScaler_ScaleOnce(t *testing.T) {
+	key := storage.StemKey{Name: "reports", Version: "v1"}
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[key] = &models.Stem{Name: "reports", Version: "v1", Config: &models.StemConfig{
+		Name:      "reports",
+		Version:   "v1",
+		Schedules: []models.ScheduleConfig{{From: "08:00", To: "20:00", Instances: 3}},
+	}}
+	db.Stems[storage.StemKey{Name: "api", Version: "v1"}] = &models.Stem{Name: "api", Version: "v1", Config: &models.StemConfig{Name: "api"}}
+	stemRepo := repos.NewStemRepository(db)
+
+	stemManager := new(MockStemManager)
+	scaler := NewScheduleScaler(stemRepo, stemManager)
+	now := time.Date(2026, 10, 14, 9, 0, 0, 0, time.Local)
+	scaler.now = func() time.Time { return now }
+	replicas := func(count int) { assert.NoError(t, stemRepo.SetStemReplicas(key, &count)) }
+
+	// The window opened, so the stem is scaled up to it
+	stemManager.On("Scale", key, 3).Return(nil).Run(func(_ mock.Arguments) { replicas(3) }).Once()
+	assert.Equal(t, 1, scaler.ScaleOnce())
+
+	// Scaling above the window is left alone, falling below it is not
+	replicas(5)
+	assert.Equal(t, 0, scaler.ScaleOnce())
+	replicas(2)
+	stemManager.On("Scale", key, 3).Return(nil).Run(func(_ mock.Arguments) { replicas(3) }).Once()
+	assert.Equal(t, 1, scaler.ScaleOnce())
+
+	// When the window closes, the stem falls back to zero minInstances
+	now = now.Add(12 * time.Hour)
+	stemManager.On("Scale", key, 0).Return(nil).Run(func(_ mock.Arguments) { replicas(0) }).Once()
+	assert.Equal(t, 1, scaler.ScaleOnce())
+	assert.Equal(t, 0, scaler.ScaleOnce())
+	stemManager.AssertExpectations(t)
+}
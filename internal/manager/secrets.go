@@ -0,0 +1,316 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// SecretRefPrefix starts env values that reference a secret, as secret://<path>#<key>.
+const SecretRefPrefix = "secret://"
+
+// DefaultSecretKey is the key of a secret reference that names none.
+const DefaultSecretKey = "value"
+
+// DefaultSecretInterval is how often leases are renewed and secrets checked for rotation.
+const DefaultSecretInterval = time.Minute
+
+// ErrNoSecretProvider is returned when a leaf's env references a secret and no secrets provider is configured.
+var ErrNoSecretProvider = errors.New("no secrets provider is configured")
+
+// Secret is a secret as read from a provider.
+type Secret struct {
+	Data          map[string]string // Values by key
+	Version       int               // Version of versioned secrets, 0 for others
+	LeaseID       string            // Lease of dynamic secrets, empty for static ones
+	LeaseDuration time.Duration     // How long the lease is valid from when it was read or renewed
+	Renewable     bool              // Whether the lease can be renewed
+}
+
+// SecretProvider reads secrets from a secrets store.
+type SecretProvider interface {
+	ReadSecret(path string) (*Secret, error)                                   // Reads the secret at path
+	RenewLease(leaseID string, increment time.Duration) (time.Duration, error) // Extends a lease, returning its new duration
+}
+
+// SecretStore resolves the secret references in leaf env and keeps the secrets they were resolved from fresh:
+// leases are renewed before they expire, and when a secret changes, by rotation or because its lease could not
+// be renewed, the running leafs using it are rolled to be started with the new value.
+type SecretStore struct {
+	Provider SecretProvider
+	StemRepo repos.StemRepositoryInterface
+	Leafs    LeafManagerInterface // Rolls leafs onto rotated secrets
+	Events   *EventLog
+
+	mu      sync.Mutex
+	secrets map[string]*cachedSecret            // Secrets read, by path
+	users   map[storage.StemKey]map[string]bool // Paths of the secrets each stem's leafs were started with
+}
+
+// cachedSecret is a secret together with when its lease was last read or renewed.
+type cachedSecret struct {
+	*Secret
+	renewed time.Time
+}
+
+// NewSecretStore creates a SecretStore reading secrets from provider and rolling the leafs of the stems in
+// stemRepo when they rotate.
+func NewSecretStore(provider SecretProvider, stemRepo repos.StemRepositoryInterface, leafs LeafManagerInterface) *SecretStore {
+	return &SecretStore{
+		Provider: provider,
+		StemRepo: stemRepo,
+		Leafs:    leafs,
+		secrets:  make(map[string]*cachedSecret),
+		users:    make(map[storage.StemKey]map[string]bool),
+	}
+}
+
+// parseSecretRef splits a secret reference into the secret's path and key, reporting whether value is one.
+func parseSecretRef(value string) (path, key string, ok bool) {
+	if !strings.HasPrefix(value, SecretRefPrefix) {
+		return "", "", false
+	}
+	path, key, found := strings.Cut(strings.TrimPrefix(value, SecretRefPrefix), "#")
+	if !found || key == "" {
+		key = DefaultSecretKey
+	}
+	return strings.Trim(path, "/"), key, true
+}
+
+// hasSecretRefs reports whether any value of env references a secret.
+func hasSecretRefs(env map[string]string) bool {
+	for _, value := range env {
+		if _, _, ok := parseSecretRef(value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns env with its secret references replaced by the values they reference, and remembers that the
+// leafs of the stem use those secrets. Secrets already read are not read again.
+func (s *SecretStore) Resolve(key storage.StemKey, env map[string]string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resolved := make(map[string]string, len(env))
+	paths := make(map[string]bool)
+	for name, value := range env {
+		path, secretKey, ok := parseSecretRef(value)
+		if !ok {
+			resolved[name] = value
+			continue
+		}
+		secret, err := s.read(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secret of env %s: %w", name, err)
+		}
+		secretValue, ok := secret.Data[secretKey]
+		if !ok {
+			return nil, fmt.Errorf("secret %s referenced by env %s has no key %s", path, name, secretKey)
+		}
+		resolved[name] = secretValue
+		paths[path] = true
+	}
+	if len(paths) > 0 {
+		s.users[key] = paths
+	} else {
+		delete(s.users, key)
+	}
+	return resolved, nil
+}
+
+// read returns the secret at path, reading it from the provider when it wasn't read before.
+func (s *SecretStore) read(path string) (*cachedSecret, error) {
+	if cached, ok := s.secrets[path]; ok {
+		return cached, nil
+	}
+	secret, err := s.Provider.ReadSecret(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", path, err)
+	}
+	cached := &cachedSecret{Secret: secret, renewed: time.Now()}
+	s.secrets[path] = cached
+	return cached, nil
+}
+
+// StartSchedule renews leases and checks secrets for rotation every interval until stop is closed.
+func (s *SecretStore) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Renewing secret leases and checking secrets for rotation every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("secrets", func() { s.Refresh(time.Now(), interval) })
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Refresh renews the leases that would expire before the next refresh, interval after now, and reads the other
+// secrets again. Secrets whose values changed, or whose lease ran out, are replaced, and the running leafs of
+// the stems using them are rolled. It returns the paths of the secrets that changed.
+func (s *SecretStore) Refresh(now time.Time, interval time.Duration) []string {
+	rotated := s.refreshSecrets(now, interval)
+	if len(rotated) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	used := make(map[storage.StemKey][]string)
+	var stems []storage.StemKey
+	for key, paths := range s.users {
+		for _, path := range rotated {
+			if paths[path] {
+				used[key] = append(used[key], path)
+			}
+		}
+		if len(used[key]) > 0 {
+			stems = append(stems, key)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(stems, func(i, j int) bool {
+		if stems[i].Name != stems[j].Name {
+			return stems[i].Name < stems[j].Name
+		}
+		return stems[i].Version < stems[j].Version
+	})
+
+	for _, key := range stems {
+		s.rollStem(key, used[key])
+	}
+	return rotated
+}
+
+// refreshSecrets renews or reads again the secrets read so far and returns the paths of those that changed.
+func (s *SecretStore) refreshSecrets(now time.Time, interval time.Duration) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Secrets no stem uses anymore are dropped rather than kept fresh
+	used := make(map[string]bool)
+	for _, stemPaths := range s.users {
+		for path := range stemPaths {
+			used[path] = true
+		}
+	}
+	paths := make([]string, 0, len(s.secrets))
+	for path := range s.secrets {
+		if !used[path] {
+			delete(s.secrets, path)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var rotated []string
+	for _, path := range paths {
+		cached := s.secrets[path]
+		if cached.LeaseID != "" {
+			expires := cached.renewed.Add(cached.LeaseDuration)
+			if expires.After(now.Add(2 * interval)) {
+				continue // Still valid until after the next refresh
+			}
+			if cached.Renewable {
+				duration, err := s.Provider.RenewLease(cached.LeaseID, cached.LeaseDuration)
+				if err == nil {
+					cached.LeaseDuration, cached.renewed = duration, now
+					if expires := now.Add(duration); expires.After(now.Add(2 * interval)) {
+						continue
+					}
+					// The lease reached its maximum TTL, a new secret takes over before it runs out
+				} else {
+					log.Printf("Failed to renew lease of secret %s, reading it again: %v", path, err)
+				}
+			}
+		}
+
+		secret, err := s.Provider.ReadSecret(path)
+		if err != nil {
+			log.Printf("Failed to read secret %s again: %v", path, err)
+			continue
+		}
+		if cached.LeaseID == "" && secret.LeaseID == "" && sameSecret(cached.Secret, secret) {
+			continue
+		}
+		s.secrets[path] = &cachedSecret{Secret: secret, renewed: now}
+		rotated = append(rotated, path)
+	}
+	return rotated
+}
+
+// sameSecret reports whether two reads of a static secret returned the same version and values.
+func sameSecret(a, b *Secret) bool {
+	if a.Version != b.Version || len(a.Data) != len(b.Data) {
+		return false
+	}
+	for key, value := range a.Data {
+		if other, ok := b.Data[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// rollStem rolls the running leafs of a stem onto rotated secrets, one at a time.
+func (s *SecretStore) rollStem(key storage.StemKey, rotated []string) {
+	stem, err := s.StemRepo.FetchStem(key)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.users, key) // The stem was unregistered
+		s.mu.Unlock()
+		return
+	}
+	rolled := 0
+	for _, leaf := range runningLeafs(stem) {
+		if _, err := s.Leafs.RollLeaf(key, leaf.ID); err != nil {
+			log.Printf("Failed to roll leaf %s of stem %s version %s onto rotated secrets: %v", leaf.ID, key.Name, key.Version, err)
+			continue
+		}
+		rolled++
+	}
+	s.Events.Record(models.Event{
+		Type:    models.EventSecretRotated,
+		Stem:    key.Name,
+		Version: key.Version,
+		Message: fmt.Sprintf("Rolled %d leafs of stem %s version %s onto rotated secrets %s", rolled, key.Name, key.Version, strings.Join(rotated, ", ")),
+	})
+}
+
+// resolveSecrets returns config with the secret references in its env resolved by the manager's secret store.
+// The stem's own config is not modified.
+func (l *LeafManager) resolveSecrets(key storage.StemKey, config *models.StemConfig) (*models.StemConfig, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if !hasSecretRefs(config.Env) {
+		if l.Secrets != nil {
+			l.Secrets.Resolve(key, nil) // Forget secrets the stem's leafs no longer use
+		}
+		return config, nil
+	}
+	if l.Secrets == nil {
+		return nil, fmt.Errorf("env of stem %s version %s references secrets: %w", key.Name, key.Version, ErrNoSecretProvider)
+	}
+	env, err := l.Secrets.Resolve(key, config.Env)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *config
+	resolved.Env = env
+	return &resolved, nil
+}
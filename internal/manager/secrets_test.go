@@ -0,0 +1,134 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSecretProvider serves secrets from a map and counts the reads and renewals.
+type fakeSecretProvider struct {
+	secrets  map[string]*Secret
+	reads    int
+	renewals int
+	renewErr error
+	renewTTL time.Duration
+}
+
+func (p *fakeSecretProvider) ReadSecret(path string) (*Secret, error) {
+	p.reads++
+	secret, ok := p.secrets[path]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	copied := *secret
+	return &copied, nil
+}
+
+func (p *fakeSecretProvider) RenewLease(leaseID string, increment time.Duration) (time.Duration, error) {
+	p.renewals++
+	return p.renewTTL, p.renewErr
+}
+
+func TestSecretStore_Resolve(t *testing.T) {
+	provider := &fakeSecretProvider{secrets: map[string]*Secret{
+		"secret/data/api": {Data: map[string]string{"password": "hunter2", "value": "token"}, Version: 1},
+	}}
+	store := NewSecretStore(provider, nil, nil)
+	key := storage.StemKey{Name: "api", Version: "v1"}
+
+	env, err := store.Resolve(key, map[string]string{
+		"DB_PASSWORD": "secret://secret/data/api#password",
+		"API_TOKEN":   "secret:///secret/data/api",
+		"LOG_LEVEL":   "info",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"DB_PASSWORD": "hunter2", "API_TOKEN": "token", "LOG_LEVEL": "info"}, env)
+	assert.Equal(t, 1, provider.reads, "a secret is read once however many env reference it")
+
+	// Unknown secrets and keys fail the resolution
+	_, err = store.Resolve(key, map[string]string{"X": "secret://secret/data/missing#x"})
+	assert.ErrorContains(t, err, "failed to read secret secret/data/missing")
+	_, err = store.Resolve(key, map[string]string{"X": "secret://secret/data/api#user"})
+	assert.ErrorContains(t, err, "has no key user")
+}
+
+func TestLeafManager_ResolveSecrets(t *testing.T) {
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	config := &models.StemConfig{Name: "api", Version: "v1", Env: map[string]string{"DB_PASSWORD": "secret://db#password"}}
+
+	leafManager := &LeafManager{}
+	_, err := leafManager.resolveSecrets(key, config)
+	assert.ErrorIs(t, err, ErrNoSecretProvider)
+
+	leafManager.Secrets = NewSecretStore(&fakeSecretProvider{secrets: map[string]*Secret{
+		"db": {Data: map[string]string{"password": "hunter2"}},
+	}}, nil, nil)
+	resolved, err := leafManager.resolveSecrets(key, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", resolved.Env["DB_PASSWORD"])
+	assert.Equal(t, "secret://db#password", config.Env["DB_PASSWORD"], "the stem's own config keeps the reference")
+}
+
+func TestSecretStore_Refresh(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	api := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[api] = &models.Stem{Name: "api", Version: "v1", Config: &models.StemConfig{Name: "api", Version: "v1"},
+		LeafInstances: map[string]*models.Leaf{
+			"api-v1-1": {ID: "api-v1-1", Status: models.StatusRunning},
+			"api-v1-2": {ID: "api-v1-2", Status: models.StatusStandby},
+		}}
+	worker := storage.StemKey{Name: "worker", Version: "v1"}
+	db.Stems[worker] = &models.Stem{Name: "worker", Version: "v1", Config: &models.StemConfig{Name: "worker", Version: "v1"},
+		LeafInstances: map[string]*models.Leaf{"worker-v1-1": {ID: "worker-v1-1", Status: models.StatusRunning}}}
+
+	provider := &fakeSecretProvider{renewTTL: time.Hour, secrets: map[string]*Secret{
+		"secret/data/api": {Data: map[string]string{"password": "hunter2"}, Version: 1},
+		"database/creds/worker": {Data: map[string]string{"username": "v-worker-1"}, LeaseID: "database/creds/worker/1",
+			LeaseDuration: time.Hour, Renewable: true},
+	}}
+	leafManager := new(MockLeafManager)
+	store := NewSecretStore(provider, repos.NewStemRepository(db), leafManager)
+	store.Events = NewEventLog(0)
+	_, err := store.Resolve(api, map[string]string{"DB_PASSWORD": "secret://secret/data/api#password"})
+	assert.NoError(t, err)
+	_, err = store.Resolve(worker, map[string]string{"DB_USER": "secret://database/creds/worker#username"})
+	assert.NoError(t, err)
+
+	// Unchanged static secrets and leases far from expiring leave the leafs alone
+	now := time.Now()
+	assert.Empty(t, store.Refresh(now, time.Minute))
+	assert.Equal(t, 0, provider.renewals)
+
+	// A new version of a static secret rolls the running leafs using it
+	provider.secrets["secret/data/api"] = &Secret{Data: map[string]string{"password": "correct-horse"}, Version: 2}
+	leafManager.On("RollLeaf", api, "api-v1-1").Return("api-v1-3", nil).Once()
+	assert.Equal(t, []string{"secret/data/api"}, store.Refresh(now, time.Minute))
+	leafManager.AssertExpectations(t)
+	env, err := store.Resolve(api, map[string]string{"DB_PASSWORD": "secret://secret/data/api#password"})
+	assert.NoError(t, err)
+	assert.Equal(t, "correct-horse", env["DB_PASSWORD"])
+	events := store.Events.List(EventQuery{})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, models.EventSecretRotated, events[0].Type)
+		assert.Equal(t, "Rolled 1 leafs of stem api version v1 onto rotated secrets secret/data/api", events[0].Message)
+	}
+
+	// Leases about to expire are renewed
+	later := now.Add(59 * time.Minute)
+	assert.Empty(t, store.Refresh(later, time.Minute))
+	assert.Equal(t, 1, provider.renewals)
+
+	// A lease that can't be renewed is replaced by new credentials, rolling the leafs using them
+	provider.renewErr = errors.New("lease expired")
+	provider.secrets["database/creds/worker"] = &Secret{Data: map[string]string{"username": "v-worker-2"},
+		LeaseID: "database/creds/worker/2", LeaseDuration: time.Hour, Renewable: true}
+	leafManager.On("RollLeaf", worker, "worker-v1-1").Return("worker-v1-2", nil).Once()
+	assert.Equal(t, []string{"database/creds/worker"}, store.Refresh(later.Add(59*time.Minute), time.Minute))
+	leafManager.AssertExpectations(t)
+}
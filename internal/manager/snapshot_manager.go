@@ -0,0 +1,358 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Snapshot defaults, applied when the global config leaves them unset.
+const (
+	DefaultSnapshotRetain = 10
+	LatestSnapshot        = "latest"  // Resolves to the newest snapshot in the snapshot folder
+	BackendSnapshot       = "backend" // Restores the state stored in the shared storage backend
+	snapshotFilePrefix    = "herbarium-"
+	snapshotFileSuffix    = ".snapshot.json"
+	snapshotTimeFormat    = "20060102T150405.000Z"
+)
+
+// SnapshotManagerInterface defines methods for taking and listing state snapshots.
+type SnapshotManagerInterface interface {
+	CreateSnapshot() (string, error)                     // Writes a snapshot of the current state and returns its name.
+	ListSnapshots() ([]SnapshotInfo, error)              // Lists stored snapshots, newest first.
+	RestoreSnapshot(name string) (*RestoreReport, error) // Rebuilds state from a snapshot and reconciles it.
+}
+
+// SnapshotInfo describes a stored snapshot file.
+type SnapshotInfo struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+}
+
+// RestoreReport summarizes how a restored snapshot was reconciled with running processes and HAProxy.
+type RestoreReport struct {
+	Snapshot        string   `json:"snapshot"` // Empty when rebuilt from the journal alone
+	ReplayedEntries int      `json:"replayedEntries"`
+	Stems           int      `json:"stems"`
+	RestoredLeafs   int      `json:"restoredLeafs"` // Leafs whose processes were still running
+	DroppedLeafs    []string `json:"droppedLeafs"`  // Leafs whose processes were gone
+	StartedLeafs    int      `json:"startedLeafs"`  // Leafs or graft nodes started to restore capacity
+	Errors          []string `json:"errors,omitempty"`
+}
+
+// SnapshotManager snapshots HerbariumDB to files and restores it.
+type SnapshotManager struct {
+	DB          *storage.HerbariumDB
+	LeafManager LeafManagerInterface
+	ProxyClient proxy.ProxyClient
+	Journal     *storage.FileJournal   // Optional; entries after a snapshot are replayed on restore
+	Backend     storage.Backend        // Optional shared storage backend, restorable with BackendSnapshot
+	Agents      map[string]LeafRuntime // Remote agents, asked whether their leafs survived
+	Maintenance *Maintenance           // Provides the page for stems restored in maintenance, nil for the default page
+	Folder      string
+	Retain      int
+}
+
+// NewSnapshotManager creates a new SnapshotManager storing snapshots in folder and keeping the newest retain files.
+func NewSnapshotManager(db *storage.HerbariumDB, leafManager LeafManagerInterface, proxyClient proxy.ProxyClient, folder string, retain int) *SnapshotManager {
+	if retain <= 0 {
+		retain = DefaultSnapshotRetain
+	}
+	return &SnapshotManager{
+		DB:          db,
+		LeafManager: leafManager,
+		ProxyClient: proxyClient,
+		Folder:      folder,
+		Retain:      retain,
+	}
+}
+
+// CreateSnapshot writes the current state to a new snapshot file and prunes old ones.
+func (m *SnapshotManager) CreateSnapshot() (string, error) {
+	snapshot, err := m.DB.Snapshot()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(m.Folder, 0750); err != nil {
+		return "", fmt.Errorf("failed to create snapshot folder %s: %v", m.Folder, err)
+	}
+
+	name := snapshotFilePrefix + snapshot.CreatedAt.Format(snapshotTimeFormat) + snapshotFileSuffix
+	if err := storage.WriteSnapshotFile(filepath.Join(m.Folder, name), snapshot); err != nil {
+		return "", err
+	}
+	log.Printf("Snapshot %s created with %d stems", name, len(snapshot.Stems))
+
+	m.prune()
+	return name, nil
+}
+
+// prune removes the oldest snapshots beyond the retention count.
+func (m *SnapshotManager) prune() {
+	snapshots, err := m.ListSnapshots()
+	if err != nil {
+		log.Printf("Failed to list snapshots for pruning: %v", err)
+		return
+	}
+	for i := m.Retain; i < len(snapshots); i++ {
+		if err := os.Remove(filepath.Join(m.Folder, snapshots[i].Name)); err != nil {
+			log.Printf("Failed to remove old snapshot %s: %v", snapshots[i].Name, err)
+		}
+	}
+}
+
+// ListSnapshots lists the snapshot files in the snapshot folder, newest first.
+func (m *SnapshotManager) ListSnapshots() ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(m.Folder)
+	if os.IsNotExist(err) {
+		return []SnapshotInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot folder %s: %v", m.Folder, err)
+	}
+
+	snapshots := make([]SnapshotInfo, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotFilePrefix) || !strings.HasSuffix(name, snapshotFileSuffix) {
+			continue
+		}
+		createdAt, err := time.Parse(snapshotTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, snapshotFilePrefix), snapshotFileSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{Name: name, CreatedAt: createdAt, Size: info.Size()})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// resolveSnapshot maps LatestSnapshot, a snapshot name, or a file path to a snapshot file path.
+func (m *SnapshotManager) resolveSnapshot(name string) (string, error) {
+	if name == LatestSnapshot {
+		snapshots, err := m.ListSnapshots()
+		if err != nil {
+			return "", err
+		}
+		if len(snapshots) == 0 {
+			return "", fmt.Errorf("no snapshots found in %s", m.Folder)
+		}
+		return filepath.Join(m.Folder, snapshots[0].Name), nil
+	}
+	if filepath.Base(name) == name {
+		return filepath.Join(m.Folder, name), nil
+	}
+	return name, nil
+}
+
+// StartSchedule creates a snapshot every interval until stop is closed.
+func (m *SnapshotManager) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Scheduling state snapshots every %s in %s", interval, m.Folder)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("snapshot schedule", func() {
+					if _, err := m.CreateSnapshot(); err != nil {
+						log.Printf("Scheduled snapshot failed: %v", err)
+					}
+				})
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// RestoreSnapshot replaces the current state with a snapshot, replays journal entries recorded after
+// it, and reconciles the result with reality:
+//
+//   - leafs whose processes are gone are dropped, surviving leafs are kept;
+//   - graft nodes are dropped, since they run inside the previous herbarium process;
+//   - every stem's HAProxy backend is recreated with only the surviving leafs;
+//   - stems below the count they were scaled to, or their minInstances, get new leafs, and stems left without any leaf get a graft node.
+//
+// With a journal attached and no snapshots stored, LatestSnapshot replays the whole journal.
+// BackendSnapshot takes over the state stored in the shared backend, e.g. from a replica that went down;
+// the journal is not replayed on top of it.
+// It is meant to run at startup, before any stem is registered.
+func (m *SnapshotManager) RestoreSnapshot(name string) (*RestoreReport, error) {
+	snapshot := &storage.Snapshot{FormatVersion: storage.SnapshotFormatVersion}
+	report := &RestoreReport{DroppedLeafs: []string{}}
+	replay := m.Journal != nil
+
+	path, err := m.resolveSnapshot(name)
+	switch {
+	case name == BackendSnapshot && m.Backend != nil:
+		snapshot, err = storage.LoadBackendSnapshot(m.Backend)
+		if err != nil {
+			return nil, err
+		}
+		report.Snapshot = BackendSnapshot
+		replay = false
+		log.Printf("Restoring state from the storage backend")
+	case err == nil:
+		snapshot, err = storage.ReadSnapshotFile(path)
+		if err != nil {
+			return nil, err
+		}
+		report.Snapshot = filepath.Base(path)
+		log.Printf("Restoring state from snapshot %s taken at %s", path, snapshot.CreatedAt)
+	case name == LatestSnapshot && m.Journal != nil:
+		log.Printf("No snapshots found, rebuilding state from the journal alone")
+	default:
+		return nil, err
+	}
+
+	if err := m.DB.Restore(snapshot); err != nil {
+		return nil, err
+	}
+
+	if replay {
+		entries, err := m.Journal.Query(storage.JournalQuery{AfterSeq: snapshot.JournalSeq})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal: %v", err)
+		}
+		if err := m.DB.Replay(entries); err != nil {
+			return nil, err
+		}
+		report.ReplayedEntries = len(entries)
+		log.Printf("Replayed %d journal entries recorded after the snapshot", len(entries))
+	}
+
+	var stems []*models.Stem
+	_ = m.DB.WithLock(func() error {
+		for _, stem := range m.DB.Stems {
+			stem.GraftNodeLeaf = nil
+			for leafID, leaf := range stem.LeafInstances {
+				if !m.leafAlive(stem.Config, leaf) {
+					log.Printf("Leaf %s of stem %s (PID %d) is no longer running, dropping it", leafID, stem.Name, leaf.PID)
+					delete(stem.LeafInstances, leafID)
+					report.DroppedLeafs = append(report.DroppedLeafs, leafID)
+				}
+			}
+			stems = append(stems, stem)
+		}
+		return nil
+	})
+	sort.Strings(report.DroppedLeafs)
+	sort.Slice(stems, func(i, j int) bool {
+		if stems[i].Name != stems[j].Name {
+			return stems[i].Name < stems[j].Name
+		}
+		return stems[i].Version < stems[j].Version
+	})
+	report.Stems = len(stems)
+
+	for _, stem := range stems {
+		m.reconcileStem(stem, report)
+	}
+
+	log.Printf("State restored: %d stems, %d leafs kept, %d dropped, %d started, %d errors",
+		report.Stems, report.RestoredLeafs, len(report.DroppedLeafs), report.StartedLeafs, len(report.Errors))
+	return report, nil
+}
+
+// reconcileStem rebuilds a restored stem's HAProxy backend and restores its capacity.
+func (m *SnapshotManager) reconcileStem(stem *models.Stem, report *RestoreReport) {
+	fail := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		log.Printf("Restore of stem %s version %s: %s", stem.Name, stem.Version, msg)
+		report.Errors = append(report.Errors, fmt.Sprintf("%s/%s: %s", stem.Name, stem.Version, msg))
+	}
+
+	bind := proxied(stem.Config)
+	if bind {
+		if err := m.ProxyClient.BindStem(stem.HAProxyBackend, backendOptions(stem.Config, stem.HAProxyBackend)); err != nil {
+			fail("failed to recreate backend %s: %v", stem.HAProxyBackend, err)
+			return
+		}
+	}
+
+	leafIDs := make([]string, 0, len(stem.LeafInstances))
+	for leafID := range stem.LeafInstances {
+		leafIDs = append(leafIDs, leafID)
+	}
+	sort.Strings(leafIDs)
+	running := 0
+	for _, leafID := range leafIDs {
+		leaf := stem.LeafInstances[leafID]
+		if leaf.Status != models.StatusStandby {
+			running++
+		}
+		// Standby leafs stay out of the proxy until they are promoted
+		if !bind || leaf.Status == models.StatusStandby {
+			report.RestoredLeafs++
+			continue
+		}
+		if err := m.ProxyClient.BindLeaf(stem.HAProxyBackend, leaf.HAProxyServer, leafHost(leaf), leaf.Port); err != nil {
+			fail("failed to rebind leaf %s: %v", leafID, err)
+			continue
+		}
+		report.RestoredLeafs++
+	}
+	if bind && stem.Maintenance {
+		if err := switchStemMaintenance(m.ProxyClient, m.Maintenance, stem, true); err != nil {
+			fail("failed to put backend %s into maintenance: %v", stem.HAProxyBackend, err)
+		}
+	}
+
+	for desired := desiredInstances(stem); running < desired; running++ {
+		if _, err := m.LeafManager.StartLeaf(stem.Name, stem.Version, nil); err != nil {
+			fail("failed to start leaf: %v", err)
+			return
+		}
+		report.StartedLeafs++
+	}
+	if running == 0 && !isUDPStem(stem.Config) {
+		if _, err := m.LeafManager.StartGraftNodeLeaf(stem.Name, stem.Version); err != nil {
+			fail("failed to start graft node: %v", err)
+			return
+		}
+		report.StartedLeafs++
+	}
+	if warmPoolSize(stem.Config) > 0 {
+		started, err := m.LeafManager.FillWarmPool(stem.Name, stem.Version)
+		report.StartedLeafs += started
+		if err != nil {
+			fail("failed to refill warm pool: %v", err)
+		}
+	}
+}
+
+// leafAlive reports whether a restored leaf's process is still running, asking the remote host for remote leafs.
+func (m *SnapshotManager) leafAlive(config *models.StemConfig, leaf *models.Leaf) bool {
+	if leaf.Agent == "" {
+		return processAlive(leaf.PID)
+	}
+	runtime, err := remoteRuntime(m.Agents, config, leaf.Agent)
+	if err != nil {
+		log.Printf("Cannot check leaf %s: %v", leaf.ID, err)
+		return false
+	}
+	remote, err := runtime.GetLeaf(leaf.ID)
+	if err != nil {
+		log.Printf("Failed to check leaf %s on %s: %v", leaf.ID, leaf.Agent, err)
+		return false
+	}
+	return remote.Alive
+}
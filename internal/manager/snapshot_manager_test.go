@@ -0,0 +1,123 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSnapshotManager_CreateAndList(t *testing.T) {
+	db := storage.GetTestStorage()
+	snapshotManager := NewSnapshotManager(db, new(MockLeafManager), new(MockProxyClient), t.TempDir(), 2)
+
+	for i := 0; i < 3; i++ {
+		_, err := snapshotManager.CreateSnapshot()
+		assert.NoError(t, err)
+		time.Sleep(2 * time.Millisecond) // Snapshot names have millisecond resolution
+	}
+
+	// Only the newest two are retained
+	snapshots, err := snapshotManager.ListSnapshots()
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+	assert.True(t, snapshots[0].CreatedAt.After(snapshots[1].CreatedAt))
+}
+
+func TestSnapshotManager_RestoreSnapshot(t *testing.T) {
+	minInstances := 2
+	source := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{
+		{Name: "api", Version: "v1"}: {
+			Name:           "api",
+			Version:        "v1",
+			HAProxyBackend: "api",
+			Config:         &models.StemConfig{Name: "api", Version: "v1", MinInstances: &minInstances},
+			LeafInstances: map[string]*models.Leaf{
+				"alive": {ID: "alive", PID: os.Getpid(), HAProxyServer: "alive", Port: 8001, Status: models.StatusRunning},
+				"dead":  {ID: "dead", PID: 1 << 30, HAProxyServer: "dead", Port: 8002, Status: models.StatusRunning},
+			},
+		},
+		{Name: "worker", Version: "v1"}: {
+			Name:           "worker",
+			Version:        "v1",
+			HAProxyBackend: "worker",
+			Config:         &models.StemConfig{Name: "worker", Version: "v1"},
+			LeafInstances:  map[string]*models.Leaf{},
+			GraftNodeLeaf:  &models.Leaf{ID: "worker-v1-graftnode", Port: 8003},
+		},
+	}}
+	folder := t.TempDir()
+	name, err := NewSnapshotManager(source, nil, nil, folder, 0).CreateSnapshot()
+	assert.NoError(t, err)
+
+	target := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	mockLeafManager := new(MockLeafManager)
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindStem", mock.Anything, mock.Anything).Return(nil)
+	mockHAProxyClient.On("BindLeaf", "api", "alive", "localhost", 8001).Return(nil)
+	mockLeafManager.On("StartLeaf", "api", "v1", (*string)(nil)).Return("new-leaf", nil)
+	mockLeafManager.On("StartGraftNodeLeaf", "worker", "v1").Return("worker-v1-graftnode", nil)
+
+	report, err := NewSnapshotManager(target, mockLeafManager, mockHAProxyClient, folder, 0).RestoreSnapshot(LatestSnapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, name, report.Snapshot)
+	assert.Equal(t, 2, report.Stems)
+	assert.Equal(t, 1, report.RestoredLeafs)
+	assert.Equal(t, []string{"dead"}, report.DroppedLeafs)
+	assert.Equal(t, 2, report.StartedLeafs)
+	assert.Empty(t, report.Errors)
+
+	api := target.Stems[storage.StemKey{Name: "api", Version: "v1"}]
+	assert.Contains(t, api.LeafInstances, "alive")
+	assert.NotContains(t, api.LeafInstances, "dead")
+	assert.Nil(t, target.Stems[storage.StemKey{Name: "worker", Version: "v1"}].GraftNodeLeaf)
+
+	mockHAProxyClient.AssertExpectations(t)
+	mockLeafManager.AssertExpectations(t)
+}
+
+func TestSnapshotManager_RestoreFromJournal(t *testing.T) {
+	journal, err := storage.OpenFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	defer journal.Close()
+
+	// Take a snapshot, then keep mutating: the later changes only exist in the journal
+	source := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	source.SetJournal(journal)
+	stemRepo := repos.NewStemRepository(source)
+	leafRepo := repos.NewLeafRepository(source)
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	minInstances := 1
+	assert.NoError(t, stemRepo.SaveStem(key, &models.Stem{
+		Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config:        &models.StemConfig{Name: "api", Version: "v1", MinInstances: &minInstances},
+		LeafInstances: map[string]*models.Leaf{},
+	}))
+	folder := t.TempDir()
+	_, err = NewSnapshotManager(source, nil, nil, folder, 0).CreateSnapshot()
+	assert.NoError(t, err)
+	assert.NoError(t, leafRepo.AddLeaf(key, "alive", "alive", os.Getpid(), 8001, time.Now()))
+
+	target := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindStem", "api", proxy.BackendOptions{}).Return(nil)
+	mockHAProxyClient.On("BindLeaf", "api", "alive", "localhost", 8001).Return(nil)
+	snapshotManager := NewSnapshotManager(target, new(MockLeafManager), mockHAProxyClient, folder, 0)
+	snapshotManager.Journal = journal
+
+	report, err := snapshotManager.RestoreSnapshot(LatestSnapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.ReplayedEntries)
+	assert.Equal(t, 1, report.RestoredLeafs)
+	assert.Contains(t, target.Stems[key].LeafInstances, "alive")
+	mockHAProxyClient.AssertExpectations(t)
+}
@@ -0,0 +1,340 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// SSHRuntimeName marks leafs started over SSH in models.Leaf.Agent.
+const SSHRuntimeName = "ssh"
+
+// DefaultSSHLogDir is the remote directory holding leaf logs and PID files when the stem config sets none.
+const DefaultSSHLogDir = "/tmp/herbarium"
+
+// sshConnectTimeout bounds how long a single SSH connection attempt may take.
+const sshConnectTimeout = 10 * time.Second
+
+// sshPollInterval is how often a starting remote leaf is checked for readiness.
+const sshPollInterval = 500 * time.Millisecond
+
+// sshBinary is the SSH client used to reach remote hosts.
+var sshBinary = "ssh"
+
+// SSHRuntime runs leafs on a remote host by executing shell scripts over the system SSH client.
+// It keeps no state of its own: each leaf's PID is kept in <logDir>/<leafID>.pid on the remote host.
+type SSHRuntime struct {
+	config   models.SSHConfig
+	behavior leafBehavior // Readiness and stop settings of the stem, SIGTERM without a stem
+}
+
+// NewSSHRuntime creates a runtime for the remote host described by config.
+func NewSSHRuntime(config models.SSHConfig) *SSHRuntime {
+	if config.LogDir == "" {
+		config.LogDir = DefaultSSHLogDir
+	}
+	return &SSHRuntime{config: config, behavior: behaviorOf(nil)}
+}
+
+// Host returns the address HAProxy uses to reach leafs on the remote host.
+func (r *SSHRuntime) Host() string {
+	return r.config.Host
+}
+
+// StartLeaf starts a leaf process in the background on the remote host and waits until it is ready.
+func (r *SSHRuntime) StartLeaf(request AgentStartRequest) (*AgentLeaf, error) {
+	first, last, err := leafPortRange(&request.Config)
+	if err != nil {
+		return nil, err
+	}
+	port, err := r.findAvailablePort(first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	command, err := prepareCommandWithTemplate(request.Config.Command, map[string]interface{}{
+		"PORT": port,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort variables so the generated script is stable
+	envNames := make([]string, 0, len(request.Config.Env))
+	for name := range request.Config.Env {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	var env strings.Builder
+	for _, name := range envNames {
+		fmt.Fprintf(&env, "export %s=%s\n", name, shellQuote(request.Config.Env[name]))
+	}
+
+	// setsid puts the leaf in its own process group, so StopLeaf can stop its children too
+	logPath, pidPath := r.leafFiles(request.LeafID)
+	script := fmt.Sprintf(`set -e
+mkdir -p %[1]s
+cd %[2]s
+%[3]sif command -v setsid >/dev/null 2>&1; then
+  setsid nohup %[4]s >>%[5]s 2>&1 </dev/null &
+else
+  nohup %[4]s >>%[5]s 2>&1 </dev/null &
+fi
+echo $! >%[6]s
+echo $!
+`, shellQuote(r.config.LogDir), shellQuote(r.config.WorkingDir), env.String(), command, shellQuote(logPath), shellQuote(pidPath))
+
+	output, err := r.run(script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start leaf on %s: %v", r.config.Host, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		return nil, fmt.Errorf("unexpected output starting leaf on %s: %q", r.config.Host, output)
+	}
+
+	if err := r.waitForLeaf(request.LeafID, port, behaviorOf(&request.Config), sshProber(&request.Config)); err != nil {
+		if stopErr := r.StopLeaf(request.LeafID); stopErr != nil {
+			return nil, fmt.Errorf("%v; failed to stop leaf: %v", err, stopErr)
+		}
+		return nil, err
+	}
+	return &AgentLeaf{ID: request.LeafID, PID: pid, Port: port, Alive: true}, nil
+}
+
+// StopLeaf sends the stem's stop signal to a leaf's process group on the remote host and kills the group if
+// it is still running after the stop timeout. A leaf without a PID file is considered stopped.
+func (r *SSHRuntime) StopLeaf(leafID string) error {
+	_, pidPath := r.leafFiles(leafID)
+	signal := strings.TrimPrefix(r.behavior.stopSignal, "SIG")
+	timeout := int((r.behavior.stopTimeout + time.Second - 1) / time.Second)
+	script := fmt.Sprintf(`[ -f %[1]s ] || exit 0
+pid=$(cat %[1]s)
+kill -%[2]s -"$pid" 2>/dev/null || kill -%[2]s "$pid" 2>/dev/null || true
+i=0
+while kill -0 "$pid" 2>/dev/null && [ "$i" -lt %[3]d ]; do sleep 1; i=$((i+1)); done
+kill -KILL -"$pid" 2>/dev/null || kill -KILL "$pid" 2>/dev/null || true
+rm -f %[1]s
+`, shellQuote(pidPath), signal, timeout)
+	if _, err := r.run(script); err != nil {
+		return fmt.Errorf("failed to stop leaf %s on %s: %v", leafID, r.config.Host, err)
+	}
+	return nil
+}
+
+// GetLeaf reports whether a leaf's process is still running on the remote host, and its resident memory.
+func (r *SSHRuntime) GetLeaf(leafID string) (*AgentLeaf, error) {
+	_, pidPath := r.leafFiles(leafID)
+	script := fmt.Sprintf(`[ -f %[1]s ] || exit 0
+pid=$(cat %[1]s)
+if kill -0 "$pid" 2>/dev/null; then echo "$pid alive $(ps -o rss= -p "$pid" 2>/dev/null)"; else echo "$pid"; fi
+`, shellQuote(pidPath))
+	output, err := r.run(script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check leaf %s on %s: %v", leafID, r.config.Host, err)
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("leaf %s not found on %s", leafID, r.config.Host)
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected output checking leaf %s on %s: %q", leafID, r.config.Host, output)
+	}
+	leaf := &AgentLeaf{ID: leafID, PID: pid, Alive: len(fields) > 1}
+	if len(fields) > 2 {
+		leaf.MemoryBytes, _ = parseKilobytes(fields[2])
+	}
+	return leaf, nil
+}
+
+// ReadLeafLogs returns part of a leaf's log on the remote host. Remote logs are not rotated, so the
+// byte range applies to the single log file.
+func (r *SSHRuntime) ReadLeafLogs(leafID string, opts LogReadOptions) ([]byte, error) {
+	logPath, _ := r.leafFiles(leafID)
+	var read string
+	if opts.TailLines > 0 {
+		read = fmt.Sprintf("tail -n %d %s", opts.TailLines, shellQuote(logPath))
+	} else {
+		if opts.Offset < 0 || opts.Length < 0 {
+			return nil, fmt.Errorf("offset and length must not be negative")
+		}
+		length := opts.Length
+		if length == 0 || length > MaxLogReadBytes {
+			length = MaxLogReadBytes
+		}
+		read = fmt.Sprintf("tail -c +%d %s | head -c %d", opts.Offset+1, shellQuote(logPath), length)
+	}
+
+	output, err := r.run(fmt.Sprintf("[ -f %[1]s ] || { echo 'no logs found for leaf' >&2; exit 1; }\n%[2]s\n", shellQuote(logPath), read))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logs of leaf %s on %s: %v", leafID, r.config.Host, err)
+	}
+	if opts.TailLines == 0 && len(output) > MaxLogReadBytes {
+		output = output[:MaxLogReadBytes]
+	}
+	return output, nil
+}
+
+// leafFiles returns the remote log and PID file paths of a leaf.
+func (r *SSHRuntime) leafFiles(leafID string) (logPath, pidPath string) {
+	base := strings.TrimSuffix(r.config.LogDir, "/") + "/" + leafID
+	return base + ".log", base + ".pid"
+}
+
+// findAvailablePort returns the first port from first to last, inclusive, that does not accept connections on
+// the remote host.
+func (r *SSHRuntime) findAvailablePort(first, last int) (int, error) {
+	for port := first; port <= last; port++ {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(r.config.Host, strconv.Itoa(port)), time.Second)
+		if err != nil {
+			return port, nil
+		}
+		conn.Close()
+	}
+	return 0, fmt.Errorf("no available ports in range %d-%d found on %s", first, last, r.config.Host)
+}
+
+// sshProber returns how leafs on an SSH host are probed from here. Exec probes would run on this host, so
+// those leafs are probed with a TCP connect instead, given the probe timeout to cross the network.
+func sshProber(config *models.StemConfig) Prober {
+	switch prober := proberOf(config).(type) {
+	case ExecProber, TCPProber:
+		return TCPProber{Timeout: probeTimeout(config.Probe)}
+	default:
+		return prober
+	}
+}
+
+// waitForLeaf waits until the leaf logs its start message, or one of its runtime adapter's start patterns.
+// Without a start message, a leaf is also ready once it passes the stem's probe.
+func (r *SSHRuntime) waitForLeaf(leafID string, port int, behavior leafBehavior, prober Prober) error {
+	logPath, _ := r.leafFiles(leafID)
+
+	grep := "grep -qF"
+	if behavior.ignoreCase {
+		grep = "grep -qiF"
+	}
+	for _, pattern := range behavior.startPatterns {
+		grep += " -e " + shellQuote(pattern)
+	}
+	explicitMessage := len(behavior.startPatterns) > 0 && !behavior.ignoreCase
+
+	for start := time.Now(); time.Since(start) < ServiceStartupTimeout; time.Sleep(sshPollInterval) {
+		if len(behavior.startPatterns) > 0 {
+			if _, err := r.run(fmt.Sprintf("%s %s\n", grep, shellQuote(logPath))); err == nil {
+				log.Printf("Detected start message of leaf %s on %s", leafID, r.config.Host)
+				return nil
+			}
+		}
+		if !explicitMessage && prober.Probe(r.config.Host, port) == nil {
+			return nil
+		}
+
+		if leaf, err := r.GetLeaf(leafID); err == nil && !leaf.Alive {
+			return fmt.Errorf("leaf %s exited on %s before it was ready", leafID, r.config.Host)
+		}
+	}
+	return fmt.Errorf("leaf %s on %s did not start within %v", leafID, r.config.Host, ServiceStartupTimeout)
+}
+
+// run executes a shell script on the remote host, feeding it to sh over stdin so it needs no quoting.
+func (r *SSHRuntime) run(script string) ([]byte, error) {
+	args := []string{
+		"-o", "BatchMode=yes",
+		"-o", fmt.Sprintf("ConnectTimeout=%d", int(sshConnectTimeout.Seconds())),
+		"-i", r.config.IdentityFile,
+	}
+	if r.config.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+r.config.KnownHostsFile, "-o", "StrictHostKeyChecking=yes")
+	}
+	if r.config.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(r.config.Port))
+	}
+	target := r.config.Host
+	if r.config.User != "" {
+		target = r.config.User + "@" + target
+	}
+	args = append(args, target, "sh", "-s")
+
+	cmd := exec.Command(sshBinary, args...)
+	cmd.Stdin = strings.NewReader(script)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%v: %s", err, message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteRuntime returns the runtime running leafs for a stem: the static runtime for StaticRuntimeName, the
+// SSH runtime described by the stem config for SSHRuntimeName, otherwise the named agent.
+func remoteRuntime(agents map[string]LeafRuntime, config *models.StemConfig, name string) (LeafRuntime, error) {
+	if name == StaticRuntimeName {
+		return staticLeafs, nil
+	}
+	if name == SSHRuntimeName {
+		if config == nil || config.SSH == nil {
+			return nil, fmt.Errorf("stem has no ssh configuration")
+		}
+		sshRuntime := NewSSHRuntime(*config.SSH)
+		sshRuntime.behavior = behaviorOf(config)
+		return sshRuntime, nil
+	}
+	if name == KubernetesRuntimeName {
+		kubernetes, ok := agents[name].(*KubernetesRuntime)
+		if !ok {
+			return nil, fmt.Errorf("no kubernetes cluster is configured in the global config")
+		}
+		return kubernetes.forStem(config), nil
+	}
+	if name == FirecrackerRuntimeName {
+		firecracker, ok := agents[name].(*FirecrackerRuntime)
+		if !ok {
+			return nil, fmt.Errorf("firecracker is not enabled in the global config")
+		}
+		return firecracker, nil
+	}
+	agent, ok := agents[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown agent %s", name)
+	}
+	return agent, nil
+}
+
+// stemRuntimeName returns the name of the remote runtime a stem's leafs run on, empty for local leafs.
+func stemRuntimeName(config *models.StemConfig) string {
+	switch {
+	case config == nil:
+		return ""
+	case config.Static != nil:
+		return StaticRuntimeName
+	case config.SSH != nil:
+		return SSHRuntimeName
+	case config.Kubernetes != nil:
+		return KubernetesRuntimeName
+	case config.Firecracker != nil:
+		return FirecrackerRuntimeName
+	case config.Agent != nil:
+		return *config.Agent
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// useFakeSSH replaces the SSH client with a script that runs the remote script locally and records its arguments.
+func useFakeSSH(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh client is a shell script")
+	}
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" >> " + shellQuote(argsFile) + "\nexec sh -s\n"
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh client: %v", err)
+	}
+
+	previous := sshBinary
+	sshBinary = filepath.Join(dir, "ssh")
+	t.Cleanup(func() { sshBinary = previous })
+	return argsFile
+}
+
+func TestSSHRuntime_LeafLifecycle(t *testing.T) {
+	argsFile := useFakeSSH(t)
+	remoteRoot := t.TempDir()
+
+	startMessage := "ready"
+	sshRuntime := NewSSHRuntime(models.SSHConfig{
+		Host:         "127.0.0.1",
+		Port:         2222,
+		User:         "deploy",
+		IdentityFile: "/keys/deploy",
+		WorkingDir:   remoteRoot,
+		LogDir:       filepath.Join(remoteRoot, "logs"),
+	})
+	assert.Equal(t, "127.0.0.1", sshRuntime.Host())
+
+	leaf, err := sshRuntime.StartLeaf(AgentStartRequest{
+		StemName: "api",
+		Version:  "v1",
+		LeafID:   "api-v1-1",
+		Config: models.StemConfig{
+			Command:      `sh -c 'echo $GREETING on {{.PORT}}; sleep 30'`,
+			Env:          map[string]string{"GREETING": "ready it's"},
+			StartMessage: &startMessage,
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, leaf.PID > 0)
+	assert.True(t, leaf.Port >= 8000)
+	t.Cleanup(func() { _ = sshRuntime.StopLeaf("api-v1-1") })
+
+	args, err := os.ReadFile(argsFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(args), "-i /keys/deploy")
+	assert.Contains(t, string(args), "-p 2222 deploy@127.0.0.1 sh -s")
+
+	status, err := sshRuntime.GetLeaf("api-v1-1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, status) {
+		assert.Equal(t, &AgentLeaf{ID: "api-v1-1", PID: leaf.PID, Alive: true, MemoryBytes: status.MemoryBytes}, status)
+		if _, err := exec.LookPath("ps"); err == nil {
+			assert.Positive(t, status.MemoryBytes, "memory is reported where ps is available")
+		}
+	}
+
+	logs, err := sshRuntime.ReadLeafLogs("api-v1-1", LogReadOptions{TailLines: 1})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(logs), "ready it's on "), "unexpected logs %q", logs)
+	logs, err = sshRuntime.ReadLeafLogs("api-v1-1", LogReadOptions{Offset: 6, Length: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, "it's", string(logs))
+
+	// Stopping removes the PID file, after which the leaf is unknown
+	assert.NoError(t, sshRuntime.StopLeaf("api-v1-1"))
+	_, err = sshRuntime.GetLeaf("api-v1-1")
+	assert.ErrorContains(t, err, "not found")
+	assert.NoError(t, sshRuntime.StopLeaf("api-v1-1"))
+}
+
+func TestSSHRuntime_LeafExitsBeforeReady(t *testing.T) {
+	useFakeSSH(t)
+	remoteRoot := t.TempDir()
+
+	startMessage := "never printed"
+	sshRuntime := NewSSHRuntime(models.SSHConfig{Host: "127.0.0.1", IdentityFile: "/keys/deploy", WorkingDir: remoteRoot, LogDir: remoteRoot})
+	_, err := sshRuntime.StartLeaf(AgentStartRequest{LeafID: "api-v1-2", Config: models.StemConfig{Command: "true", StartMessage: &startMessage}})
+	assert.ErrorContains(t, err, "exited on 127.0.0.1 before it was ready")
+}
+
+func TestRemoteRuntime(t *testing.T) {
+	agent := new(MockAgentClient)
+	agents := map[string]LeafRuntime{"edge-1": agent}
+	sshConfig := &models.StemConfig{SSH: &models.SSHConfig{Host: "10.0.0.7"}}
+
+	assert.Equal(t, SSHRuntimeName, stemRuntimeName(sshConfig))
+	sshRuntime, err := remoteRuntime(agents, sshConfig, SSHRuntimeName)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.7", sshRuntime.Host())
+
+	found, err := remoteRuntime(agents, sshConfig, "edge-1")
+	assert.NoError(t, err)
+	assert.Same(t, agent, found)
+
+	_, err = remoteRuntime(agents, &models.StemConfig{}, SSHRuntimeName)
+	assert.ErrorContains(t, err, "no ssh configuration")
+	_, err = remoteRuntime(agents, nil, "edge-2")
+	assert.ErrorContains(t, err, "unknown agent edge-2")
+}
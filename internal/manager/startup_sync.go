@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+)
+
+// StartupSyncReport lists what syncing the proxy at startup found left behind by a previous run.
+type StartupSyncReport struct {
+	Adopted []string `json:"adopted"`          // Backends of configured stems, emptied and taken over by their registration
+	Removed []string `json:"removed"`          // Backends of stems that are no longer configured, emptied
+	Servers []string `json:"servers"`          // Servers removed from those backends, as backend/server
+	Errors  []string `json:"errors,omitempty"` // What could not be cleaned up
+}
+
+// syncProxy empties the backends a previous run of herbarium left in the proxy before any stem is registered,
+// so no request reaches a server whose leaf is gone. A backend is herbarium's when a configured stem is named
+// after it, which adopts it, or when the journal recorded it for a stem or the proxy tagged it as created by
+// herbarium, which removes its servers. Other backends are left alone, as are proxies that can't list their
+// backends and servers.
+func (p *PlatformManager) syncProxy(services []Service) StartupSyncReport {
+	report := StartupSyncReport{Adopted: []string{}, Removed: []string{}, Servers: []string{}}
+	backendLister, ok := p.ProxyClient.(proxy.BackendLister)
+	serverLister, listsServers := p.ProxyClient.(proxy.ServerLister)
+	if !ok || !listsServers {
+		return report
+	}
+	backends, err := backendLister.Backends()
+	if err != nil {
+		log.Printf("Failed to list proxy backends, skipping startup sync: %v", err)
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list backends: %v", err))
+		return report
+	}
+
+	naming, _ := NewBackendNaming(p.Config) // Validated when the platform manager was created
+	configured := make(map[string]bool, len(services))
+	for _, service := range services {
+		if proxied(&service.Config) {
+			configured[naming.Name(service.Config)] = true
+		}
+	}
+	known := p.journaledBackends()
+	if reporter, ok := p.ProxyClient.(proxy.OwnershipReporter); ok {
+		tagged, err := reporter.OwnedBackends()
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to list backends created by herbarium: %v", err))
+		}
+		for _, backend := range tagged {
+			known[backend] = true
+		}
+	}
+	sort.Strings(backends)
+	for _, backend := range backends {
+		// The admin API was just bound afresh
+		if backend == strings.TrimPrefix(AdminAPIPath, "/") || (!configured[backend] && !known[backend]) {
+			continue
+		}
+		servers, err := serverLister.Servers(backend)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to list servers of backend %s: %v", backend, err))
+			continue
+		}
+		removed := true
+		for _, server := range servers {
+			if err := p.ProxyClient.UnbindLeaf(backend, server); err != nil {
+				removed = false
+				report.Errors = append(report.Errors, fmt.Sprintf("failed to remove server %s from backend %s: %v", server, backend, err))
+				continue
+			}
+			report.Servers = append(report.Servers, backend+"/"+server)
+		}
+		if !removed {
+			continue
+		}
+		if configured[backend] {
+			report.Adopted = append(report.Adopted, backend)
+		} else {
+			report.Removed = append(report.Removed, backend)
+		}
+	}
+
+	log.Printf("Synced proxy at startup: adopted %d backends, emptied %d backends of removed stems, removed %d servers, %d errors",
+		len(report.Adopted), len(report.Removed), len(report.Servers), len(report.Errors))
+	return report
+}
+
+// journaledBackends returns the backends the journal recorded for stems, from this run or earlier ones.
+func (p *PlatformManager) journaledBackends() map[string]bool {
+	backends := make(map[string]bool)
+	if p.Journal == nil {
+		return backends
+	}
+	entries, err := p.Journal.Query(storage.JournalQuery{})
+	if err != nil {
+		log.Printf("Failed to read the journal for backends of earlier runs: %v", err)
+		return backends
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.Stem != nil && entry.Stem.HAProxyBackend != "":
+			backends[entry.Stem.HAProxyBackend] = true
+		case entry.Op == storage.OpStemRouted && entry.Backend != "":
+			backends[entry.Backend] = true
+		}
+	}
+	return backends
+}
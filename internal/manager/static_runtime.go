@@ -0,0 +1,218 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// StaticRuntimeName marks leafs of static stems in models.Leaf.Agent. Their files are served by herbarium itself.
+const StaticRuntimeName = "static"
+
+// DefaultStaticIndex is the file served for directory requests when the stem config sets none.
+const DefaultStaticIndex = "index.html"
+
+// staticShutdownTimeout bounds how long a stopping static leaf waits for in-flight requests.
+const staticShutdownTimeout = 5 * time.Second
+
+// staticLeaf is a file server started for one leaf of a static stem.
+type staticLeaf struct {
+	server  *http.Server
+	port    int
+	logFile *os.File
+}
+
+// StaticRuntime serves the directories of static stems from file servers inside the herbarium process,
+// so leafs of static stems need no process of their own.
+type StaticRuntime struct {
+	mu    sync.Mutex
+	leafs map[string]*staticLeaf
+}
+
+// NewStaticRuntime creates a runtime with no running leafs.
+func NewStaticRuntime() *StaticRuntime {
+	return &StaticRuntime{leafs: make(map[string]*staticLeaf)}
+}
+
+// staticLeafs runs the leafs of all static stems, which live as long as the herbarium process.
+var staticLeafs = NewStaticRuntime()
+
+// Host returns the address the proxy uses to reach static leafs.
+func (r *StaticRuntime) Host() string {
+	return "localhost"
+}
+
+// StartLeaf starts serving the stem's static directory on a free port, logging requests to the leaf's log file.
+func (r *StaticRuntime) StartLeaf(request AgentStartRequest) (*AgentLeaf, error) {
+	if request.Config.Static == nil {
+		return nil, fmt.Errorf("stem %s has no static configuration", request.StemName)
+	}
+	root, err := staticRoot(request.StemName, request.Version, &request.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := allocateLeafPort(&request.Config, request.LeafID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find an available port: %v", err)
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		leafPorts.Release("tcp", port)
+		return nil, fmt.Errorf("failed to listen on port %d: %v", port, err)
+	}
+	logFile, err := setupLogFile(getLogFolder(), request.LeafID, storage.StemKey{Name: request.StemName, Version: request.Version})
+	if err != nil {
+		listener.Close()
+		leafPorts.Release("tcp", port)
+		return nil, err
+	}
+
+	server := &http.Server{Handler: logStaticRequests(logFile, newStaticHandler(root, *request.Config.Static))}
+	leaf := &staticLeaf{server: server, port: port, logFile: logFile}
+	r.mu.Lock()
+	r.leafs[request.LeafID] = leaf
+	r.mu.Unlock()
+
+	go func() {
+		defer recoverCrash(fmt.Sprintf("static leaf %s", request.LeafID))
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Static leaf %s stopped serving: %v", request.LeafID, err)
+		}
+	}()
+	log.Printf("Static leaf %s serving %s on port %d", request.LeafID, root, port)
+
+	return &AgentLeaf{ID: request.LeafID, PID: os.Getpid(), Port: port, Alive: true}, nil
+}
+
+// StopLeaf stops a static leaf's file server and frees its port.
+func (r *StaticRuntime) StopLeaf(leafID string) error {
+	r.mu.Lock()
+	leaf, ok := r.leafs[leafID]
+	delete(r.leafs, leafID)
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("static leaf %s not found", leafID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), staticShutdownTimeout)
+	defer cancel()
+	err := leaf.server.Shutdown(ctx)
+	leaf.logFile.Close()
+	leafPorts.Release("tcp", leaf.port)
+	if err != nil {
+		return fmt.Errorf("failed to stop static leaf %s: %v", leafID, err)
+	}
+	return nil
+}
+
+// GetLeaf reports the health of a static leaf. Leafs restored from a snapshot of an earlier herbarium
+// process are not found, since their file servers ended with that process.
+func (r *StaticRuntime) GetLeaf(leafID string) (*AgentLeaf, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	leaf, ok := r.leafs[leafID]
+	if !ok {
+		return nil, fmt.Errorf("static leaf %s not found", leafID)
+	}
+	return &AgentLeaf{ID: leafID, PID: os.Getpid(), Port: leaf.port, Alive: true}, nil
+}
+
+// ReadLeafLogs returns part of a static leaf's request log, which is kept in the local log folder.
+func (r *StaticRuntime) ReadLeafLogs(leafID string, opts LogReadOptions) ([]byte, error) {
+	return ReadLeafLogFiles(leafID, opts)
+}
+
+// staticRoot resolves the directory a static stem serves. Relative roots are resolved against the stem's
+// working directory.
+func staticRoot(stemName, version string, config *models.StemConfig) (string, error) {
+	root := config.Static.Root
+	if !filepath.IsAbs(root) {
+		workingDir, err := getWorkingDirectory(stemName, version, config)
+		if err != nil {
+			return "", err
+		}
+		root = filepath.Join(workingDir, root)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", fmt.Errorf("static root %s is not readable: %v", root, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("static root %s is not a directory", root)
+	}
+	return root, nil
+}
+
+// newStaticHandler serves files below root. In SPA mode, requests for missing files get the index file, so
+// client-side routes of single-page applications load the application.
+func newStaticHandler(root string, config models.StaticConfig) http.Handler {
+	index := config.Index
+	if index == "" {
+		index = DefaultStaticIndex
+	}
+	dir := http.Dir(root)
+	files := http.FileServer(dir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if config.SPA && path.Ext(r.URL.Path) == "" {
+			f, err := dir.Open(path.Clean("/" + r.URL.Path))
+			if errors.Is(err, os.ErrNotExist) {
+				http.ServeFile(w, r, filepath.Join(root, index))
+				return
+			}
+			if err == nil {
+				f.Close()
+			}
+		}
+		if strings.HasSuffix(r.URL.Path, "/") && index != DefaultStaticIndex {
+			if f, err := dir.Open(path.Join(r.URL.Path, index)); err == nil {
+				f.Close()
+				http.ServeFile(w, r, filepath.Join(root, filepath.FromSlash(path.Join(r.URL.Path, index))))
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// logStaticRequests writes one line per request to a static leaf's log file.
+func logStaticRequests(out io.Writer, next http.Handler) http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(out, "%s %s %s %d %s\n", start.Format(time.RFC3339), r.Method, r.URL.RequestURI(), recorder.status, time.Since(start).Round(time.Millisecond))
+	})
+}
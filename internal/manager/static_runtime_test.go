@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeStaticSite creates a small single-page application build in a temporary directory.
+func writeStaticSite(t *testing.T) string {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":        "<app>",
+		"assets/app.js":     "console.log(1)",
+		"docs/welcome.html": "<welcome>",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestStaticHandler(t *testing.T) {
+	root := writeStaticSite(t)
+	get := func(handler http.Handler, method, path string) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	spa := newStaticHandler(root, models.StaticConfig{SPA: true})
+	status, body := get(spa, http.MethodGet, "/assets/app.js")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "console.log(1)", body)
+	status, body = get(spa, http.MethodGet, "/users/42")
+	assert.Equal(t, http.StatusOK, status, "client-side routes get the index file")
+	assert.Equal(t, "<app>", body)
+	status, _ = get(spa, http.MethodGet, "/assets/missing.js")
+	assert.Equal(t, http.StatusNotFound, status, "missing files are not masked by the index file")
+	status, _ = get(spa, http.MethodPost, "/")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	docs := newStaticHandler(root, models.StaticConfig{Index: "welcome.html"})
+	status, body = get(docs, http.MethodGet, "/docs/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "<welcome>", body)
+	status, _ = get(docs, http.MethodGet, "/users/42")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestStaticRuntime_LeafLifecycle(t *testing.T) {
+	t.Setenv("PLANTARIUM_LOG_FOLDER", t.TempDir())
+	staticRuntime := NewStaticRuntime()
+
+	leaf, err := staticRuntime.StartLeaf(AgentStartRequest{
+		StemName: "docs",
+		Version:  "v1",
+		LeafID:   "docs-v1-1",
+		Config:   models.StemConfig{Static: &models.StaticConfig{Root: writeStaticSite(t)}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, os.Getpid(), leaf.PID)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s:%d/", staticRuntime.Host(), leaf.Port))
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "<app>", string(body))
+	}
+
+	status, err := staticRuntime.GetLeaf("docs-v1-1")
+	assert.NoError(t, err)
+	assert.True(t, status.Alive)
+	logs, err := staticRuntime.ReadLeafLogs("docs-v1-1", LogReadOptions{TailLines: 1})
+	assert.NoError(t, err)
+	assert.Contains(t, string(logs), "GET / 200")
+
+	// Stopping frees the port for the next leaf
+	assert.NoError(t, staticRuntime.StopLeaf("docs-v1-1"))
+	assert.NoError(t, leafPorts.Reserve("tcp", leaf.Port, "docs-v1-2"))
+	leafPorts.Release("tcp", leaf.Port)
+	_, err = staticRuntime.GetLeaf("docs-v1-1")
+	assert.ErrorContains(t, err, "not found")
+
+	_, err = staticRuntime.StartLeaf(AgentStartRequest{LeafID: "docs-v1-3", Config: models.StemConfig{Static: &models.StaticConfig{Root: "/does/not/exist"}}})
+	assert.ErrorContains(t, err, "is not readable")
+}
+
+func TestStemRuntimeName_Static(t *testing.T) {
+	config := &models.StemConfig{Static: &models.StaticConfig{}}
+	assert.Equal(t, StaticRuntimeName, stemRuntimeName(config))
+	runtime, err := remoteRuntime(nil, config, StaticRuntimeName)
+	assert.NoError(t, err)
+	assert.Same(t, staticLeafs, runtime)
+}
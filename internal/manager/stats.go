@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// LeafStats is a point-in-time sample of what a leaf uses and serves. CPU time and requests are cumulative,
+// so rates are derived from two samples.
+type LeafStats struct {
+	Stem        string
+	Version     string
+	LeafID      string
+	PID         int
+	Port        int
+	Status      models.LeafStatus
+	MemoryBytes int64         // Resident memory, 0 when unknown
+	CPUTime     time.Duration // CPU time used so far, 0 when unknown
+	Requests    int64         // Requests served so far, -1 when the proxy can't count them
+	Sampled     time.Time     // When the sample was taken
+}
+
+// StatsCollector samples the resource use and request counts of every running leaf, for live views such
+// as herbarium top.
+type StatsCollector struct {
+	StemRepo    repos.StemRepositoryInterface
+	LeafManager LeafManagerInterface
+	ProxyClient proxy.ProxyClient
+
+	now func() time.Time // Clock samples are stamped with
+}
+
+// NewStatsCollector creates a StatsCollector for the stems in stemRepo.
+func NewStatsCollector(stemRepo repos.StemRepositoryInterface, leafManager LeafManagerInterface, proxyClient proxy.ProxyClient) *StatsCollector {
+	return &StatsCollector{
+		StemRepo:    stemRepo,
+		LeafManager: leafManager,
+		ProxyClient: proxyClient,
+		now:         time.Now,
+	}
+}
+
+// Collect samples every leaf of every stem, ordered by stem, version, and leaf ID. Leafs that can't be
+// measured are still listed, with zero resource use.
+func (c *StatsCollector) Collect() ([]LeafStats, error) {
+	stems, err := c.StemRepo.GetAllStems()
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []LeafStats
+	for _, stem := range stems {
+		key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+		counts := c.requestCounts(stem)
+		for _, leaf := range stem.LeafInstances {
+			sample := LeafStats{
+				Stem:     stem.Name,
+				Version:  stem.Version,
+				LeafID:   leaf.ID,
+				PID:      leaf.PID,
+				Port:     leaf.Port,
+				Status:   leaf.Status,
+				Requests: -1,
+				Sampled:  c.now(),
+			}
+			if counts != nil {
+				sample.Requests = counts[leaf.HAProxyServer]
+			}
+			if resources, err := c.LeafManager.LeafResources(key, leaf.ID); err == nil {
+				sample.MemoryBytes = resources.MemoryBytes
+				sample.CPUTime = resources.CPUTime
+			}
+			stats = append(stats, sample)
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Stem != stats[j].Stem {
+			return stats[i].Stem < stats[j].Stem
+		}
+		if stats[i].Version != stats[j].Version {
+			return stats[i].Version < stats[j].Version
+		}
+		return stats[i].LeafID < stats[j].LeafID
+	})
+	return stats, nil
+}
+
+// requestCounts returns the requests served by each proxied leaf of a stem, by proxy server name, or nil
+// when the proxy can't tell.
+func (c *StatsCollector) requestCounts(stem *models.Stem) map[string]int64 {
+	counter, ok := c.ProxyClient.(proxy.RequestCounter)
+	if !ok || !proxied(stem.Config) || stem.HAProxyBackend == "" {
+		return nil
+	}
+	counts, err := counter.RequestCounts(stem.HAProxyBackend)
+	if err != nil {
+		log.Printf("Failed to get request counts of stem %s: %v", stem.Name, err)
+		return nil
+	}
+	return counts
+}
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsCollector_Collect(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	apiKey := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[apiKey] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api"},
+		LeafInstances: map[string]*models.Leaf{
+			"api-2": {ID: "api-2", PID: 200, Port: 8002, HAProxyServer: "api-2", Status: models.StatusRunning},
+			"api-1": {ID: "api-1", PID: 100, Port: 8001, HAProxyServer: "api-1", Status: models.StatusRunning},
+		}}
+	dnsKey := storage.StemKey{Name: "dns", Version: "v1"}
+	db.Stems[dnsKey] = &models.Stem{Name: "dns", Version: "v1",
+		Config:        &models.StemConfig{Name: "dns", Version: "v1", Transport: proxy.TransportUDP},
+		LeafInstances: map[string]*models.Leaf{"dns-1": {ID: "dns-1", PID: 300, Port: 5300, Status: models.StatusRunning}}}
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("LeafResources", apiKey, "api-1").Return(&LeafResources{MemoryBytes: 64 << 20, CPUTime: 2 * time.Second}, nil)
+	mockLeafManager.On("LeafResources", apiKey, "api-2").Return(nil, assert.AnError)
+	mockLeafManager.On("LeafResources", dnsKey, "dns-1").Return(&LeafResources{MemoryBytes: 8 << 20}, nil)
+
+	proxyClient := &countingProxyClient{MockProxyClient: new(MockProxyClient), counts: map[string]int64{"api-1": 42, "api-2": 7}}
+	collector := NewStatsCollector(repos.NewStemRepository(db), mockLeafManager, proxyClient)
+	collector.now = func() time.Time { return now }
+
+	// Leafs that can't be measured are listed without resources, UDP leafs the proxy doesn't route without requests
+	stats, err := collector.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, []LeafStats{
+		{Stem: "api", Version: "v1", LeafID: "api-1", PID: 100, Port: 8001, Status: models.StatusRunning, MemoryBytes: 64 << 20, CPUTime: 2 * time.Second, Requests: 42, Sampled: now},
+		{Stem: "api", Version: "v1", LeafID: "api-2", PID: 200, Port: 8002, Status: models.StatusRunning, Requests: 7, Sampled: now},
+		{Stem: "dns", Version: "v1", LeafID: "dns-1", PID: 300, Port: 5300, Status: models.StatusRunning, MemoryBytes: 8 << 20, Requests: -1, Sampled: now},
+	}, stats)
+}
@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// StemDefinitionFormatVersion is the format version written into exported stem definitions.
+const StemDefinitionFormatVersion = 1
+
+// ErrStemExists is returned when importing a stem whose name and version are already registered.
+var ErrStemExists = errors.New("stem already exists")
+
+// StemDefinition is the portable description of a stem, used to migrate services between herbarium instances.
+type StemDefinition struct {
+	FormatVersion int               `yaml:"formatVersion"` // Format version of the definition
+	Config        models.StemConfig `yaml:"config"`        // Service configuration, including env and version
+	Instances     int               `yaml:"instances"`     // Number of running leafs at export time
+}
+
+// ExportStem builds the portable definition of a registered stem.
+func (s *StemManager) ExportStem(key storage.StemKey) (*StemDefinition, error) {
+	stem, err := s.StemRepo.FetchStem(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stem %s version %s: %v", key.Name, key.Version, err)
+	}
+
+	leafs, err := s.LeafManager.GetRunningLeafs(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve running leafs for stem %s version %s: %v", key.Name, key.Version, err)
+	}
+
+	definition := &StemDefinition{
+		FormatVersion: StemDefinitionFormatVersion,
+		Instances:     len(leafs),
+	}
+	if stem.Config != nil {
+		definition.Config = *stem.Config
+	}
+	definition.Config.Name = stem.Name
+	definition.Config.Version = stem.Version
+	definition.Config.URL = stem.WorkingURL
+	definition.Config.Env = stem.Environment
+
+	return definition, nil
+}
+
+// ImportStem registers a stem from an exported definition and starts leafs until the exported
+// instance count is reached. Only the DeployedBy of the options applies.
+func (s *StemManager) ImportStem(definition StemDefinition, opts ...RegisterOptions) error {
+	if definition.FormatVersion != StemDefinitionFormatVersion {
+		return fmt.Errorf("unsupported stem definition format version %d", definition.FormatVersion)
+	}
+	config := definition.Config
+	if config.Name == "" || config.Version == "" {
+		return fmt.Errorf("stem definition must include a name and version")
+	}
+	if definition.Instances < 0 {
+		return fmt.Errorf("stem definition has a negative instance count")
+	}
+
+	key := storage.StemKey{Name: config.Name, Version: config.Version}
+	if _, err := s.StemRepo.FetchStem(key); err == nil {
+		return fmt.Errorf("%w: %s version %s", ErrStemExists, config.Name, config.Version)
+	}
+
+	var options RegisterOptions
+	if len(opts) > 0 {
+		options = RegisterOptions{DeployedBy: opts[0].DeployedBy}
+	}
+	if err := s.RegisterStem(config, options); err != nil {
+		return err
+	}
+
+	// RegisterStem already started minInstances leafs
+	started := 0
+	if config.MinInstances != nil {
+		started = *config.MinInstances
+	}
+	for ; started < definition.Instances; started++ {
+		if _, err := s.LeafManager.StartLeaf(config.Name, config.Version, nil); err != nil {
+			log.Printf("Imported stem %s version %s, but failed to start leaf %d of %d: %v", config.Name, config.Version, started+1, definition.Instances, err)
+			return fmt.Errorf("stem imported, but failed to start leaf %d of %d: %v", started+1, definition.Instances, err)
+		}
+	}
+
+	log.Printf("Imported stem %s version %s with %d instances", config.Name, config.Version, definition.Instances)
+	return nil
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStemManager_ExportStem(t *testing.T) {
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	stemRepo := repos.NewStemRepository(herbariumDB)
+	mockLeafManager := new(MockLeafManager)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, new(MockProxyClient))
+
+	stemKey := storage.StemKey{Name: "hello-service", Version: "v1.1"}
+	minInstances := 1
+	err := stemRepo.SaveStem(stemKey, &models.Stem{
+		Name:        "hello-service",
+		Version:     "v1.1",
+		WorkingURL:  "/hello",
+		Environment: map[string]string{"GLOBAL_VAR": "production"},
+		Config: &models.StemConfig{
+			Name:         "hello-service",
+			URL:          "/hello",
+			Command:      "java -jar hello-service.jar",
+			Env:          map[string]string{"GLOBAL_VAR": "production"},
+			Version:      "v1.1",
+			MinInstances: &minInstances,
+		},
+	})
+	assert.NoError(t, err)
+	mockLeafManager.On("GetRunningLeafs", stemKey).Return([]models.Leaf{{ID: "leaf-1"}, {ID: "leaf-2"}}, nil)
+
+	definition, err := stemManager.ExportStem(stemKey)
+	assert.NoError(t, err)
+	assert.Equal(t, StemDefinitionFormatVersion, definition.FormatVersion)
+	assert.Equal(t, 2, definition.Instances)
+	assert.Equal(t, "java -jar hello-service.jar", definition.Config.Command)
+	assert.Equal(t, "production", definition.Config.Env["GLOBAL_VAR"])
+
+	_, err = stemManager.ExportStem(storage.StemKey{Name: "missing", Version: "v1.0"})
+	assert.Error(t, err)
+}
+
+func TestStemManager_ImportStem(t *testing.T) {
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	stemRepo := repos.NewStemRepository(herbariumDB)
+	mockLeafManager := new(MockLeafManager)
+	mockHAProxyClient := new(MockProxyClient)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, mockHAProxyClient)
+
+	minInstances := 1
+	definition := StemDefinition{
+		FormatVersion: StemDefinitionFormatVersion,
+		Config: models.StemConfig{
+			Name:         "hello-service",
+			URL:          "/hello",
+			Command:      "java -jar hello-service.jar",
+			Version:      "v1.1",
+			MinInstances: &minInstances,
+		},
+		Instances: 3,
+	}
+
+	mockHAProxyClient.On("BindStem", "hello", proxy.BackendOptions{}).Return(nil)
+	mockLeafManager.On("StartLeaf", "hello-service", "v1.1", (*string)(nil)).Return("leaf", nil)
+
+	err := stemManager.ImportStem(definition)
+	assert.NoError(t, err)
+	mockLeafManager.AssertNumberOfCalls(t, "StartLeaf", 3)
+
+	// Importing the same name and version again conflicts
+	err = stemManager.ImportStem(definition)
+	assert.True(t, errors.Is(err, ErrStemExists), "expected ErrStemExists, got %v", err)
+
+	// Unknown format versions are rejected
+	definition.FormatVersion = 99
+	assert.Error(t, stemManager.ImportStem(definition))
+}
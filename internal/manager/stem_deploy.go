@@ -0,0 +1,326 @@
+package manager
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+// MaxDeploymentBytes caps the unpacked size of a deployed service version.
+const MaxDeploymentBytes = 1 << 30
+
+// ErrInvalidDeployment is returned when an uploaded archive can't be deployed as it is.
+var ErrInvalidDeployment = errors.New("invalid deployment")
+
+// DeployStem unpacks a gzip-compressed tar of a service version directory, with config.yaml at its root or in
+// its single top-level directory, into services/<name>/<version> under the root folder. The stem is then
+// registered, starting its leafs, and the service's current version is pointed at it, so restarts keep it.
+// Uploaded archives carry no signature, so they are refused when the signing policy requires one. Only the
+// DeployedBy of the options applies, deployed versions are never upserted.
+func (s *StemManager) DeployStem(archive io.Reader, opts ...RegisterOptions) (storage.StemKey, error) {
+	if s.Artifacts != nil && s.Artifacts.Signing.Required {
+		return storage.StemKey{}, fmt.Errorf("%w: artifacts must be signed, deploy a signed artifact by URL instead of uploading it", ErrArtifactVerification)
+	}
+	return s.deployArchive(archive, models.VersionMetadata{}, opts)
+}
+
+// deployArchive deploys an archive, recording the metadata of the artifact it was fetched from, if any, in
+// the version directory.
+func (s *StemManager) deployArchive(archive io.Reader, metadata models.VersionMetadata, opts []RegisterOptions) (storage.StemKey, error) {
+	rootFolder := os.Getenv("PLANTARIUM_ROOT_FOLDER")
+	if rootFolder == "" {
+		return storage.StemKey{}, fmt.Errorf("PLANTARIUM_ROOT_FOLDER environment variable is not set")
+	}
+	servicesPath := filepath.Join(rootFolder, "services")
+	if err := os.MkdirAll(servicesPath, os.ModePerm); err != nil {
+		return storage.StemKey{}, fmt.Errorf("failed to create services directory: %v", err)
+	}
+
+	// Unpack next to the final location, so moving the version into place is a rename
+	unpacked, err := os.MkdirTemp(servicesPath, ".deploy-")
+	if err != nil {
+		return storage.StemKey{}, fmt.Errorf("failed to create deployment directory: %v", err)
+	}
+	defer os.RemoveAll(unpacked)
+	if err := unpackDeployment(archive, unpacked); err != nil {
+		return storage.StemKey{}, err
+	}
+
+	versionDir, config, err := readDeployedConfig(unpacked, filepath.Join(rootFolder, SharedConfigFolder))
+	if err != nil {
+		return storage.StemKey{}, err
+	}
+	key := storage.StemKey{Name: config.Name, Version: config.Version}
+	if _, err := s.StemRepo.FetchStem(key); err == nil {
+		return key, fmt.Errorf("%w: %s version %s", ErrStemExists, config.Name, config.Version)
+	}
+
+	serviceDir := filepath.Join(servicesPath, config.Name)
+	target := filepath.Join(serviceDir, config.Version)
+	if _, err := os.Stat(target); err == nil {
+		return key, fmt.Errorf("%w: directory %s already exists", ErrStemExists, target)
+	}
+	if err := os.MkdirAll(serviceDir, os.ModePerm); err != nil {
+		return key, fmt.Errorf("failed to create service directory %s: %v", serviceDir, err)
+	}
+	if metadata.Artifact != "" {
+		if err := writeVersionMetadata(versionDir, metadata); err != nil {
+			return key, err
+		}
+	}
+	if err := os.Rename(versionDir, target); err != nil {
+		return key, fmt.Errorf("failed to move deployment to %s: %v", target, err)
+	}
+
+	var options RegisterOptions
+	if len(opts) > 0 {
+		options = RegisterOptions{DeployedBy: opts[0].DeployedBy}
+	}
+	if err := s.RegisterStem(*config, options); err != nil {
+		os.RemoveAll(target)
+		return key, err
+	}
+	if err := setCurrentVersion(serviceDir, config.Version); err != nil {
+		return key, fmt.Errorf("stem deployed, but failed to make it the current version: %v", err)
+	}
+
+	log.Printf("Deployed stem %s version %s to %s", config.Name, config.Version, target)
+	return key, nil
+}
+
+// DeployArtifact downloads the archive of a service version from an https://, s3://, or oci:// URL, verifies
+// it against its checksum and signature, and deploys it like an uploaded one.
+func (s *StemManager) DeployArtifact(reference models.ArtifactConfig, opts ...RegisterOptions) (storage.StemKey, error) {
+	artifact, metadata, err := s.fetchVerifiedArtifact(reference)
+	if err != nil {
+		return storage.StemKey{}, err
+	}
+	defer artifact.Remove()
+	archive, err := os.Open(artifact.Path)
+	if err != nil {
+		return storage.StemKey{}, fmt.Errorf("failed to open artifact: %v", err)
+	}
+	defer archive.Close()
+	return s.deployArchive(archive, metadata, opts)
+}
+
+// fetchVerifiedArtifact downloads an artifact and checks it, returning it with its metadata, which has the
+// artifact's digest once verified. The digest is empty when the artifact had neither checksum nor signature
+// to be verified by.
+func (s *StemManager) fetchVerifiedArtifact(reference models.ArtifactConfig) (*Artifact, models.VersionMetadata, error) {
+	artifact, err := s.Artifacts.Fetch(reference.URL)
+	if err != nil {
+		return nil, models.VersionMetadata{}, err
+	}
+	verified, err := s.Artifacts.Verify(artifact, ArtifactExpectation{SHA256: reference.SHA256, Signature: reference.Signature})
+	if err != nil {
+		artifact.Remove()
+		return nil, models.VersionMetadata{}, err
+	}
+	if verified {
+		log.Printf("Verified artifact %s with digest %s", artifact.URL, artifact.Digest)
+	}
+	return artifact, artifactMetadata(artifact, verified), nil
+}
+
+// fetchStemArtifact unpacks the artifact a stem config references into the stem's working directory, unless
+// it was unpacked there before, and returns the version's metadata. Files of the artifact replace those in
+// the directory, except config.yaml. Stems without an artifact get the metadata recorded when they were
+// deployed, if any.
+func (s *StemManager) fetchStemArtifact(config models.StemConfig) (models.VersionMetadata, error) {
+	rootFolder := os.Getenv("PLANTARIUM_ROOT_FOLDER")
+	if rootFolder == "" {
+		if config.Artifact == nil || config.Artifact.URL == "" {
+			return models.VersionMetadata{}, nil
+		}
+		return models.VersionMetadata{}, fmt.Errorf("PLANTARIUM_ROOT_FOLDER environment variable is not set")
+	}
+	workingDir := filepath.Join(rootFolder, "services", config.Name, config.Version)
+	if config.WorkingDir != nil && *config.WorkingDir != "" {
+		workingDir = resolveAgainstRoot(rootFolder, *config.WorkingDir)
+	}
+	recorded := readVersionMetadata(workingDir)
+	if config.Artifact == nil || config.Artifact.URL == "" || recorded.Artifact == config.Artifact.URL {
+		return recorded, nil
+	}
+	if err := os.MkdirAll(workingDir, os.ModePerm); err != nil {
+		return recorded, fmt.Errorf("failed to create working directory %s: %v", workingDir, err)
+	}
+
+	artifact, metadata, err := s.fetchVerifiedArtifact(*config.Artifact)
+	if err != nil {
+		return recorded, err
+	}
+	defer artifact.Remove()
+	archive, err := os.Open(artifact.Path)
+	if err != nil {
+		return recorded, fmt.Errorf("failed to open artifact: %v", err)
+	}
+	defer archive.Close()
+
+	// Unpack next to the working directory, so moving the files into place is a rename
+	unpacked, err := os.MkdirTemp(filepath.Dir(workingDir), ".artifact-")
+	if err != nil {
+		return recorded, fmt.Errorf("failed to create artifact directory: %v", err)
+	}
+	defer os.RemoveAll(unpacked)
+	if err := unpackDeployment(archive, unpacked); err != nil {
+		return recorded, err
+	}
+	entries, err := os.ReadDir(unpacked)
+	if err != nil {
+		return recorded, err
+	}
+	for _, entry := range entries {
+		target := filepath.Join(workingDir, entry.Name())
+		if entry.Name() == "config.yaml" || entry.Name() == VersionMetadataFile {
+			continue
+		}
+		if err := os.RemoveAll(target); err != nil {
+			return recorded, fmt.Errorf("failed to replace %s: %v", target, err)
+		}
+		if err := os.Rename(filepath.Join(unpacked, entry.Name()), target); err != nil {
+			return recorded, fmt.Errorf("failed to move %s into place: %v", entry.Name(), err)
+		}
+	}
+	if err := writeVersionMetadata(workingDir, metadata); err != nil {
+		return recorded, err
+	}
+	log.Printf("Unpacked artifact %s of stem %s version %s into %s", config.Artifact.URL, config.Name, config.Version, workingDir)
+	return metadata, nil
+}
+
+// unpackDeployment extracts a gzip-compressed tar into dir. Entries must stay inside dir, and only
+// directories and regular files are accepted.
+func unpackDeployment(archive io.Reader, dir string) error {
+	compressed, err := gzip.NewReader(archive)
+	if err != nil {
+		return fmt.Errorf("%w: not a gzip-compressed tar: %v", ErrInvalidDeployment, err)
+	}
+	defer compressed.Close()
+
+	reader := tar.NewReader(compressed)
+	var unpacked int64
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: failed to read archive: %v", ErrInvalidDeployment, err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("%w: archive entry %s points outside the service directory", ErrInvalidDeployment, header.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(header.Mode).Perm()|0700); err != nil {
+				return fmt.Errorf("failed to create directory %s: %v", target, err)
+			}
+		case tar.TypeReg:
+			unpacked += header.Size
+			if unpacked > MaxDeploymentBytes {
+				return fmt.Errorf("%w: archive unpacks to more than %d bytes", ErrInvalidDeployment, MaxDeploymentBytes)
+			}
+			if err := unpackFile(reader, target, os.FileMode(header.Mode).Perm()); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: archive entry %s is neither a directory nor a regular file", ErrInvalidDeployment, header.Name)
+		}
+	}
+}
+
+// unpackFile writes the current archive entry to target.
+func unpackFile(reader io.Reader, target string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", target, err)
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", target, err)
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return fmt.Errorf("%w: failed to unpack %s: %v", ErrInvalidDeployment, target, err)
+	}
+	return file.Close()
+}
+
+// readDeployedConfig finds the service version directory in an unpacked deployment, either the deployment
+// itself or its single top-level directory, and reads its config.yaml with the fragments in sharedDir it
+// extends.
+func readDeployedConfig(unpacked, sharedDir string) (string, *models.StemConfig, error) {
+	versionDir := unpacked
+	if _, err := os.Stat(filepath.Join(versionDir, "config.yaml")); err != nil {
+		entries, _ := os.ReadDir(unpacked)
+		if len(entries) != 1 || !entries[0].IsDir() {
+			return "", nil, fmt.Errorf("%w: archive has no config.yaml", ErrInvalidDeployment)
+		}
+		versionDir = filepath.Join(unpacked, entries[0].Name())
+	}
+
+	data, err := os.ReadFile(filepath.Join(versionDir, "config.yaml"))
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: archive has no config.yaml", ErrInvalidDeployment)
+	}
+	if data, err = mergeConfigFragments(data, sharedDir); err != nil {
+		return "", nil, fmt.Errorf("%w: failed to resolve config.yaml: %v", ErrInvalidDeployment, err)
+	}
+	data, warnings, err := migrateServiceConfig(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: failed to migrate config.yaml: %v", ErrInvalidDeployment, err)
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning: deployed config.yaml: %s", warning)
+	}
+	var config models.StemConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return "", nil, fmt.Errorf("%w: failed to decode config.yaml: %v", ErrInvalidDeployment, err)
+	}
+	for field, value := range map[string]string{"name": config.Name, "version": config.Version} {
+		if value == "" || value == "." || value == ".." || value == "current" || strings.ContainsAny(value, `/\`) {
+			return "", nil, fmt.Errorf("%w: config.yaml %s %q can't name a directory", ErrInvalidDeployment, field, value)
+		}
+	}
+	if config.URL == "" {
+		return "", nil, fmt.Errorf("%w: config.yaml has no url", ErrInvalidDeployment)
+	}
+	return versionDir, &config, nil
+}
+
+// setCurrentVersion points the current version of the service in serviceDir at version: a symlink, or on
+// Windows a file holding the version, as resolveCurrentPath expects.
+func setCurrentVersion(serviceDir, version string) error {
+	current := filepath.Join(serviceDir, "current")
+	if runtime.GOOS == "windows" {
+		return os.WriteFile(current, []byte(version), 0644)
+	}
+
+	// Replace the link atomically, so a concurrent start never misses it
+	staged := current + ".new"
+	os.Remove(staged)
+	if err := os.Symlink(version, staged); err != nil {
+		return err
+	}
+	return os.Rename(staged, current)
+}
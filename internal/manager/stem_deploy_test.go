@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/stretchr/testify/assert"
+)
+
+// deploymentArchive builds a gzip-compressed tar holding files, keyed by their slash-separated paths.
+func deploymentArchive(t *testing.T, files map[string]string) *bytes.Buffer {
+	var archive bytes.Buffer
+	compressed := gzip.NewWriter(&archive)
+	writer := tar.NewWriter(compressed)
+	for name, content := range files {
+		assert.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := writer.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, compressed.Close())
+	return &archive
+}
+
+func TestStemManager_DeployStem(t *testing.T) {
+	rootFolder := t.TempDir()
+	t.Setenv("PLANTARIUM_ROOT_FOLDER", rootFolder)
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	mockLeafManager := new(MockLeafManager)
+	mockProxyClient := new(MockProxyClient)
+	stemManager := NewStemManager(repos.NewStemRepository(herbariumDB), mockLeafManager, mockProxyClient)
+	mockProxyClient.On("BindStem", "billing", proxy.BackendOptions{}).Return(nil)
+	mockLeafManager.On("StartLeaf", "billing", "v2", (*string)(nil)).Return("leaf", nil)
+
+	// The version directory may be wrapped in a single top-level directory
+	config := "name: billing\nversion: v2\nurl: /billing\ncommand: ./billing\nminInstances: 1\n"
+	key, err := stemManager.DeployStem(deploymentArchive(t, map[string]string{
+		"billing-v2/config.yaml":  config,
+		"billing-v2/bin/app.conf": "port=8000\n",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, storage.StemKey{Name: "billing", Version: "v2"}, key)
+	assert.FileExists(t, filepath.Join(rootFolder, "services", "billing", "v2", "bin", "app.conf"))
+	mockLeafManager.AssertNumberOfCalls(t, "StartLeaf", 1)
+	if runtime.GOOS != "windows" {
+		current, err := os.Readlink(filepath.Join(rootFolder, "services", "billing", "current"))
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", current)
+	}
+
+	// Deploying the same version again conflicts
+	_, err = stemManager.DeployStem(deploymentArchive(t, map[string]string{"config.yaml": config}))
+	assert.True(t, errors.Is(err, ErrStemExists))
+
+	// Archives escaping the service directory or without a usable config are rejected
+	for _, files := range []map[string]string{
+		{"config.yaml": config, "../escape": "x"},
+		{"app.jar": "x"},
+		{"config.yaml": "name: ../billing\nversion: v3\nurl: /billing\n"},
+	} {
+		_, err = stemManager.DeployStem(deploymentArchive(t, files))
+		assert.True(t, errors.Is(err, ErrInvalidDeployment), "%v", err)
+	}
+	_, err = stemManager.DeployStem(bytes.NewBufferString("not an archive"))
+	assert.True(t, errors.Is(err, ErrInvalidDeployment))
+
+	// Only the deployed version is left behind
+	entries, err := os.ReadDir(filepath.Join(rootFolder, "services"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
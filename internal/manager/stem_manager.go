@@ -2,68 +2,130 @@ package manager
 
 import (
 	"fmt"
-	"github.com/plantarium-platform/herbarium-go/internal/haproxy"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"github.com/plantarium-platform/herbarium-go/internal/storage"
 	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
 	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"io"
 	"log"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // StemManagerInterface defines methods for managing stems.
 type StemManagerInterface interface {
-	RegisterStem(config models.StemConfig) error             // Adds a new stem to the system with explicit configuration.
-	UnregisterStem(key storage.StemKey) error                // Removes a stem from the system.
-	FetchStemInfo(key storage.StemKey) (*models.Stem, error) // Retrieves information about a specific stem.
+	RegisterStem(config models.StemConfig, opts ...RegisterOptions) error                             // Adds a new stem to the system with explicit configuration.
+	UnregisterStem(key storage.StemKey) error                                                         // Removes a stem from the system, keeping its tombstone.
+	FetchStemInfo(key storage.StemKey) (*models.Stem, error)                                          // Retrieves information about a specific stem.
+	ListStems(query repos.StemQuery) ([]*models.Stem, int, error)                                     // Lists stems matching the query along with the total match count.
+	ReadSnapshot() *storage.StateView                                                                 // Copies all stems and their leafs at a single point in time.
+	ExportStem(key storage.StemKey) (*StemDefinition, error)                                          // Builds the portable definition of a stem.
+	ImportStem(definition StemDefinition, opts ...RegisterOptions) error                              // Registers a stem from a portable definition.
+	SetMaintenance(key storage.StemKey, on bool) error                                                // Puts a stem's servers into maintenance or takes them out.
+	UpdateStemConfig(key storage.StemKey, config models.StemConfig, opts UpdateOptions) error         // Applies a changed config to a registered stem in place.
+	Scale(key storage.StemKey, replicas int) error                                                    // Starts or stops leafs until the stem runs the given number.
+	SetTrafficSplit(key storage.StemKey, split map[string]int) error                                  // Shares the requests to a stem's backend between its versions.
+	DeployStem(archive io.Reader, opts ...RegisterOptions) (storage.StemKey, error)                   // Unpacks a service version archive and registers it as a stem.
+	DeployArtifact(reference models.ArtifactConfig, opts ...RegisterOptions) (storage.StemKey, error) // Downloads and verifies a service version archive and deploys it.
+	StemVersions(name string) ([]*models.StemVersion, error)                                          // Lists every version ever registered for a stem.
+	Rollback(name string, opts ...RegisterOptions) (storage.StemKey, error)                           // Returns a stem to the version registered before its newest one.
 }
 
 // StemManager is an implementation of StemManagerInterface.
 type StemManager struct {
-	StemRepo      *repos.StemRepository
-	LeafManager   LeafManagerInterface
-	HAProxyClient haproxy.HAProxyClientInterface
+	StemRepo    *repos.StemRepository
+	LeafManager LeafManagerInterface
+	ProxyClient proxy.ProxyClient
+	Events      *EventLog        // Receives an event for every registered stem, nil to only log them
+	Hooks       *hooks.Registry  // Hooks vetoing or enriching registrations and stem backend binds, nil for none
+	Maintenance *Maintenance     // Platform maintenance mode, providing the maintenance page; nil for the default page
+	Naming      BackendNaming    // Names the backends of stems, after their URL by default
+	Artifacts   *ArtifactFetcher // Downloads deployed and referenced artifacts, nil for the defaults without credentials
+
+	Provisioners []DependencyProvisioner // Prepare declared dependencies before leafs start, nil to ignore dependencies
 }
 
 // NewStemManager creates a new instance of StemManager.
-func NewStemManager(stemRepo *repos.StemRepository, leafManager LeafManagerInterface, haProxyClient haproxy.HAProxyClientInterface) *StemManager {
+func NewStemManager(stemRepo *repos.StemRepository, leafManager LeafManagerInterface, proxyClient proxy.ProxyClient) *StemManager {
 	return &StemManager{
-		StemRepo:      stemRepo,
-		LeafManager:   leafManager,
-		HAProxyClient: haProxyClient,
+		StemRepo:    stemRepo,
+		LeafManager: leafManager,
+		ProxyClient: proxyClient,
 	}
 }
 
-// RegisterStem registers a new stem in the system.
-func (s *StemManager) RegisterStem(config models.StemConfig) error {
+// RegisterStem registers a new stem in the system, after the before_register_stem hooks accepted and
+// possibly changed its config. With RegisterOptions.Upsert a stem of the same name and version is updated
+// in place instead.
+func (s *StemManager) RegisterStem(config models.StemConfig, opts ...RegisterOptions) error {
+	op := hooks.Operation{Stem: config}
+	if err := s.Hooks.Before(hooks.BeforeRegisterStem, &op); err != nil {
+		log.Printf("Registration of stem %s version %s was vetoed: %v", config.Name, config.Version, err)
+		return fmt.Errorf("registration of stem %s version %s was vetoed: %v", config.Name, config.Version, err)
+	}
+	if op.Stem.Name != config.Name || op.Stem.Version != config.Version {
+		return fmt.Errorf("hooks must not change the name or version of stem %s version %s", config.Name, config.Version)
+	}
+	var options RegisterOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	err := s.registerStem(op.Stem, options)
+	s.Hooks.After(hooks.AfterRegisterStem, op, err)
+	return err
+}
+
+// registerStem registers a stem with its final config.
+func (s *StemManager) registerStem(config models.StemConfig, options RegisterOptions) error {
 	log.Printf("Starting registration for stem: Name=%s, Version=%s, URL=%s", config.Name, config.Version, config.URL)
 
 	// Define the stem key
 	stemKey := storage.StemKey{Name: config.Name, Version: config.Version}
 
 	// Check if the stem already exists
-	if _, err := s.StemRepo.FetchStem(stemKey); err == nil {
+	if _, err := s.StemRepo.FetchStem(stemKey); err == nil && options.Upsert {
+		return s.UpdateStemConfig(stemKey, config, UpdateOptions{RollLeafs: true})
+	} else if err == nil {
 		log.Printf("Stem %s already exists in version %s. Aborting registration.", config.Name, config.Version)
 		return fmt.Errorf("Stem %s already exists in version %s. Please provide a new version or stop the previous one.", config.Name, config.Version)
 	}
 
-	cleanURL := strings.TrimPrefix(config.URL, "/")
-	err := s.HAProxyClient.BindStem(cleanURL)
+	if reservedURL(config.URL) {
+		log.Printf("Stem %s requested reserved URL %s. Aborting registration.", config.Name, config.URL)
+		return fmt.Errorf("URL %s is reserved for the herbarium admin API", config.URL)
+	}
+
+	metadata, err := s.fetchStemArtifact(config)
 	if err != nil {
-		log.Printf("Failed to bind stem backend for URL %s: %v", config.URL, err)
-		return fmt.Errorf("failed to bind stem backend for URL %s: %v", config.URL, err)
+		log.Printf("Failed to fetch artifact of stem %s version %s: %v", config.Name, config.Version, err)
+		return err
+	}
+
+	if err := s.provisionDependencies(config); err != nil {
+		log.Printf("Stem %s version %s can't start: %v", config.Name, config.Version, err)
+		return err
+	}
+
+	backend := s.Naming.Name(config)
+	if proxied(&config) {
+		if err := s.bindStemBackend(config, backend); err != nil {
+			return err
+		}
 	}
 
 	stem := &models.Stem{
 		Name:           config.Name,
 		Type:           models.StemTypeDeployment,
 		WorkingURL:     config.URL,
-		HAProxyBackend: cleanURL, // Use URL as the HAProxy backend identifier
+		HAProxyBackend: backend,
 		Version:        config.Version,
 		Environment:    config.Env,
 		LeafInstances:  make(map[string]*models.Leaf),
 		Config:         &config,
+		Metadata:       recordDeployment(config, metadata, options),
 	}
 
 	// Save the stem to the repository
@@ -72,6 +134,9 @@ func (s *StemManager) RegisterStem(config models.StemConfig) error {
 		log.Printf("Failed to save stem %s to repository: %v", config.Name, err)
 		return fmt.Errorf("failed to save stem to repository: %v", err)
 	}
+	if _, err := s.StemRepo.RegisterVersion(stem, time.Now().UTC()); err != nil {
+		log.Printf("Failed to record stem %s version %s in its version history: %v", config.Name, config.Version, err)
+	}
 
 	if config.MinInstances != nil && *config.MinInstances > 0 {
 		log.Printf("Starting %d leaf instances for stem %s (version %s)", *config.MinInstances, config.Name, config.Version)
@@ -81,9 +146,13 @@ func (s *StemManager) RegisterStem(config models.StemConfig) error {
 				log.Printf("Failed to start leaf for stem %s version %s: %v", config.Name, config.Version, err)
 				log.Printf("Rolling back stem %s registration.", config.Name)
 				_ = s.StemRepo.DeleteStem(stemKey) // Rollback stem registration on failure
+				_ = s.StemRepo.SetVersionStatus(stemKey, models.VersionFailed, time.Now().UTC())
 				return fmt.Errorf("failed to start leaf for stem %s version %s: %v", config.Name, config.Version, err)
 			}
 		}
+	} else if isUDPStem(&config) {
+		// Graft nodes wake stems on their first HTTP request, which UDP stems never receive
+		log.Printf("No minimum instances specified for UDP stem %s, no leafs started", config.Name)
 	} else {
 		log.Printf("No minimum instances specified for stem %s, starting graft node...", config.Name)
 		_, err := s.LeafManager.StartGraftNodeLeaf(config.Name, config.Version)
@@ -91,15 +160,47 @@ func (s *StemManager) RegisterStem(config models.StemConfig) error {
 			log.Printf("Failed to start graft node for stem %s: %v", config.Name, err)
 			log.Printf("Rolling back stem %s registration.", config.Name)
 			_ = s.StemRepo.DeleteStem(stemKey) // Rollback stem registration on failure
+			_ = s.StemRepo.SetVersionStatus(stemKey, models.VersionFailed, time.Now().UTC())
 			return fmt.Errorf("failed to start graft node for stem %s: %v", config.Name, err)
 		}
 	}
 
+	// Standby leafs are best effort; a failed start leaves the pool short until the next promotion refills it
+	if warmPoolSize(&config) > 0 {
+		started, err := s.LeafManager.FillWarmPool(config.Name, config.Version)
+		if err != nil {
+			log.Printf("Started %d of %d standby leafs for stem %s: %v", started, warmPoolSize(&config), config.Name, err)
+		}
+	}
+
 	log.Printf("Successfully registered stem: Name=%s, Version=%s, URL=%s", config.Name, config.Version, config.URL)
+	s.Events.Record(models.Event{
+		Type:    models.EventDeploySucceeded,
+		Stem:    config.Name,
+		Version: config.Version,
+		Message: fmt.Sprintf("Stem %s version %s was deployed at %s", config.Name, config.Version, config.URL),
+	})
 	return nil
 }
 
-// UnregisterStem removes a stem from the system.
+// bindStemBackend creates the proxy backend serving a stem's URL, unless a before_proxy_bind hook vetoes it.
+func (s *StemManager) bindStemBackend(config models.StemConfig, backend string) error {
+	bind := hooks.Operation{Stem: config, Backend: backend}
+	if err := s.Hooks.Before(hooks.BeforeProxyBind, &bind); err != nil {
+		log.Printf("Binding stem backend for URL %s was vetoed: %v", config.URL, err)
+		return fmt.Errorf("binding stem backend for URL %s was vetoed: %v", config.URL, err)
+	}
+	err := s.ProxyClient.BindStem(backend, backendOptions(&config, backend))
+	s.Hooks.After(hooks.AfterProxyBind, bind, err)
+	if err != nil {
+		log.Printf("Failed to bind stem backend for URL %s: %v", config.URL, err)
+		return fmt.Errorf("failed to bind stem backend for URL %s: %v", config.URL, err)
+	}
+	return nil
+}
+
+// UnregisterStem removes a stem from the system. The stem is kept as a tombstone with the leafs it had, so its
+// final state stays queryable until the janitor purges it, and in the stem's version history for good.
 func (s *StemManager) UnregisterStem(key storage.StemKey) error {
 	// Step 1: Fetch the stem
 	stem, err := s.StemRepo.FetchStem(key)
@@ -107,19 +208,27 @@ func (s *StemManager) UnregisterStem(key storage.StemKey) error {
 		return fmt.Errorf("failed to fetch stem %s version %s: %v", key.Name, key.Version, err)
 	}
 
-	// Step 2: Retrieve all running leafs for the stem
-	leafs, err := s.LeafManager.GetRunningLeafs(key)
+	// Step 2: Tear down the graft node, so no request starts a leaf while the others stop
+	if proxied(stem.Config) {
+		if err := s.LeafManager.StopGraftNodeLeaf(key.Name, key.Version); err != nil {
+			return fmt.Errorf("failed to stop graft node for stem %s version %s: %v", key.Name, key.Version, err)
+		}
+	}
+
+	// Step 3: Retrieve the stem's leafs in any state, including standby and stopping leafs
+	leafs, _, err := s.LeafManager.ListLeafs(key, repos.LeafQuery{})
 	if err != nil {
-		return fmt.Errorf("failed to retrieve running leafs for stem %s version %s: %v", key.Name, key.Version, err)
+		return fmt.Errorf("failed to retrieve leafs for stem %s version %s: %v", key.Name, key.Version, err)
 	}
 
-	// Step 3: Stop all leafs in parallel
+	// Step 4: Stop all leafs in parallel
 	var wg sync.WaitGroup
 	var stopError atomic.Value // To capture the first error, if any
 	for _, leaf := range leafs {
 		wg.Add(1)
 		go func(leafID string) {
 			defer wg.Done()
+			defer recoverCrash(fmt.Sprintf("stopping leaf %s", leafID))
 			err := s.LeafManager.StopLeaf(key.Name, key.Version, leafID)
 			if err != nil {
 				stopError.Store(err) // Capture the error
@@ -133,17 +242,22 @@ func (s *StemManager) UnregisterStem(key storage.StemKey) error {
 		return fmt.Errorf("failed to stop leafs for stem %s version %s: %v", key.Name, key.Version, storedError)
 	}
 
-	// Step 4: Remove stem from HAProxy
-	err = s.HAProxyClient.UnbindStem(stem.HAProxyBackend)
-	if err != nil {
-		return fmt.Errorf("failed to unbind stem backend for %s: %v", stem.HAProxyBackend, err)
+	// Step 5: Remove stem from HAProxy
+	if proxied(stem.Config) {
+		err = s.ProxyClient.UnbindStem(stem.HAProxyBackend)
+		if err != nil {
+			return fmt.Errorf("failed to unbind stem backend for %s: %v", stem.HAProxyBackend, err)
+		}
 	}
 
-	// Step 5: Remove stem from the repository
-	err = s.StemRepo.DeleteStem(key)
+	// Step 6: Remove stem from the repository, keeping its tombstone
+	err = s.StemRepo.TombstoneStem(key, time.Now(), stem.LeafInstances)
 	if err != nil {
 		return fmt.Errorf("failed to remove stem %s version %s from repository: %v", key.Name, key.Version, err)
 	}
+	if err := s.StemRepo.SetVersionStatus(key, models.VersionUnregistered, time.Now().UTC()); err != nil {
+		log.Printf("Failed to record the unregistration of stem %s version %s in its version history: %v", key.Name, key.Version, err)
+	}
 
 	return nil
 }
@@ -152,3 +266,108 @@ func (s *StemManager) UnregisterStem(key storage.StemKey) error {
 func (s *StemManager) FetchStemInfo(key storage.StemKey) (*models.Stem, error) {
 	return s.StemRepo.FetchStem(key)
 }
+
+// SetMaintenance puts all servers of a stem into maintenance, so its requests are answered with the maintenance
+// page while its leafs keep running, or takes them out of maintenance again. Stems can't be switched while
+// the whole platform is in maintenance mode.
+func (s *StemManager) SetMaintenance(key storage.StemKey, on bool) error {
+	stem, err := s.StemRepo.FetchStem(key)
+	if err != nil {
+		return fmt.Errorf("failed to fetch stem %s version %s: %v", key.Name, key.Version, err)
+	}
+	if stem.Maintenance == on {
+		return nil
+	}
+	if !proxied(stem.Config) {
+		return fmt.Errorf("stem %s version %s is not routed through the proxy", key.Name, key.Version)
+	}
+	if s.Maintenance != nil && s.Maintenance.Status().Enabled {
+		return ErrMaintenance
+	}
+
+	if err := switchStemMaintenance(s.ProxyClient, s.Maintenance, stem, on); err != nil {
+		return fmt.Errorf("failed to switch maintenance of stem %s version %s: %v", key.Name, key.Version, err)
+	}
+	if err := s.StemRepo.SetStemMaintenance(key, on); err != nil {
+		return err
+	}
+	if on {
+		log.Printf("Stem %s version %s is in maintenance", key.Name, key.Version)
+	} else {
+		log.Printf("Stem %s version %s is out of maintenance", key.Name, key.Version)
+	}
+	return nil
+}
+
+// ListStems returns the page of stems matching the query along with the total number of matches.
+func (s *StemManager) ListStems(query repos.StemQuery) ([]*models.Stem, int, error) {
+	return s.StemRepo.QueryStems(query)
+}
+
+// ReadSnapshot returns a point-in-time copy of all stems with their leafs, for readers going over the whole
+// state, such as the metrics exporter and diagnostic dumps.
+func (s *StemManager) ReadSnapshot() *storage.StateView {
+	return s.StemRepo.ReadSnapshot()
+}
+
+// backendOptions returns the proxy backend options configured for a stem served by backend. The stem's URL is
+// only passed as the path when the backend isn't named after it.
+func backendOptions(config *models.StemConfig, backend string) proxy.BackendOptions {
+	var options proxy.BackendOptions
+	if config == nil {
+		return options
+	}
+	if strings.TrimPrefix(config.URL, "/") != backend {
+		options.Path = config.URL
+	}
+	options.Host = config.Host
+	options.Shadow = config.Shadow
+	if config.Backend != nil {
+		options.Protocol = config.Backend.Protocol
+		options.HealthCheck = config.Backend.HealthCheck
+		options.MaxConn = config.Backend.MaxConn
+		options.Rewrite = config.Backend.Rewrite
+		if config.Backend.StripPrefix {
+			options.Rewrite = "/"
+		}
+		// The timeouts were validated with the config, invalid ones keep the proxy's defaults
+		options.ConnectTimeout, _ = time.ParseDuration(config.Backend.ConnectTimeout)
+		options.ServerTimeout, _ = time.ParseDuration(config.Backend.ServerTimeout)
+		options.QueueTimeout, _ = time.ParseDuration(config.Backend.QueueTimeout)
+		options.Retries = config.Backend.Retries
+		options.Compression = config.Backend.Compression
+		options.CacheMaxAge, _ = time.ParseDuration(config.Backend.CacheMaxAge)
+		options.SecurityHeaders = config.Backend.SecurityHeaders
+		if cors := config.Backend.CORS; cors != nil {
+			options.CORS = &proxy.CORSPolicy{
+				AllowOrigins:     cors.AllowOrigins,
+				AllowMethods:     cors.AllowMethods,
+				AllowHeaders:     cors.AllowHeaders,
+				AllowCredentials: cors.AllowCredentials,
+			}
+			options.CORS.MaxAge, _ = time.ParseDuration(cors.MaxAge)
+		}
+		if mirror := config.Backend.Mirror; mirror != nil {
+			options.Mirror = &proxy.Mirror{Backend: shadowBackend(config.Name, mirror.Version), Percent: mirror.Percent}
+		}
+		if breaker := config.Backend.CircuitBreaker; breaker != nil {
+			options.CircuitBreaker = &proxy.CircuitBreaker{ErrorLimit: breaker.ErrorLimit, OnError: breaker.OnError}
+			if options.CircuitBreaker.OnError == "" {
+				options.CircuitBreaker.OnError = proxy.OnErrorMarkDown
+			}
+		}
+		if rateLimit := config.Backend.RateLimit; rateLimit != nil {
+			options.RateLimit = &proxy.RateLimit{Requests: rateLimit.Requests, Period: time.Second}
+			if period, err := time.ParseDuration(rateLimit.Period); err == nil {
+				options.RateLimit.Period = period
+			}
+		}
+	}
+	if isUDPStem(config) {
+		options.Transport = proxy.TransportUDP
+		if config.UDP != nil {
+			options.ListenPort = config.UDP.Port
+		}
+	}
+	return options
+}
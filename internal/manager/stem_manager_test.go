@@ -1,13 +1,17 @@
 package manager
 
 import (
+	"errors"
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"github.com/plantarium-platform/herbarium-go/internal/storage"
 	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
 	"github.com/plantarium-platform/herbarium-go/pkg/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestStemManager_AddStemWithMinInstances(t *testing.T) {
@@ -17,24 +21,22 @@ func TestStemManager_AddStemWithMinInstances(t *testing.T) {
 	assert.NoError(t, err, "failed to set PLANTARIUM_ROOT_FOLDER environment variable")
 
 	// Set up temporary log directory
-	tempLogDir := "../../.test-logs"
+	tempLogDir := t.TempDir()
 	err = os.Setenv("PLANTARIUM_LOG_FOLDER", tempLogDir)
 	assert.NoError(t, err, "failed to set PLANTARIUM_LOG_FOLDER environment variable")
-
-	err = os.MkdirAll(tempLogDir, os.ModePerm)
-	assert.NoError(t, err, "failed to create test log directory")
 	herbariumDB := storage.GetHerbariumDB()
 	herbariumDB.Clear()
 	leafRepo := repos.NewLeafRepository(herbariumDB)
 	stemRepo := repos.NewStemRepository(herbariumDB)
 
-	mockHAProxyClient := new(MockHAProxyClient)
+	mockHAProxyClient := new(MockProxyClient)
 	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, stemRepo)
 
-	mockHAProxyClient.On("BindStem", "test").Return(nil)
+	mockHAProxyClient.On("BindStem", "test", proxy.BackendOptions{}).Return(nil)
 	mockHAProxyClient.On("BindLeaf", mock.Anything, mock.Anything, "localhost", mock.AnythingOfType("int")).Return(nil)
 
 	stemManager := NewStemManager(stemRepo, leafManager, mockHAProxyClient)
+	stemManager.Events = NewEventLog(0)
 
 	minInstances := 2
 	startMessage := "from 127.0.0.1"
@@ -68,6 +70,10 @@ func TestStemManager_AddStemWithMinInstances(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
+	events := stemManager.Events.List(EventQuery{Type: models.EventDeploySucceeded})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "Stem ping-service-stem version v1.0 was deployed at /test", events[0].Message)
+	}
 }
 func TestStemManager_AddStemWithGraftNode(t *testing.T) {
 	// Set up environment variable for root folder
@@ -76,21 +82,18 @@ func TestStemManager_AddStemWithGraftNode(t *testing.T) {
 	assert.NoError(t, err, "failed to set PLANTARIUM_ROOT_FOLDER environment variable")
 
 	// Set up temporary log directory
-	tempLogDir := "../../.test-logs"
+	tempLogDir := t.TempDir()
 	err = os.Setenv("PLANTARIUM_LOG_FOLDER", tempLogDir)
 	assert.NoError(t, err, "failed to set PLANTARIUM_LOG_FOLDER environment variable")
-
-	err = os.MkdirAll(tempLogDir, os.ModePerm)
-	assert.NoError(t, err, "failed to create test log directory")
 	herbariumDB := storage.GetHerbariumDB()
 	herbariumDB.Clear()
 	leafRepo := repos.NewLeafRepository(herbariumDB)
 	stemRepo := repos.NewStemRepository(herbariumDB)
 
-	mockHAProxyClient := new(MockHAProxyClient)
+	mockHAProxyClient := new(MockProxyClient)
 	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, stemRepo)
 
-	mockHAProxyClient.On("BindStem", "test").Return(nil)
+	mockHAProxyClient.On("BindStem", "test", proxy.BackendOptions{}).Return(nil)
 	mockHAProxyClient.On("BindLeaf", mock.Anything, mock.Anything, "localhost", mock.AnythingOfType("int")).Return(nil)
 
 	stemManager := NewStemManager(stemRepo, leafManager, mockHAProxyClient)
@@ -131,7 +134,7 @@ func TestStemManager_AddStem_DuplicateError(t *testing.T) {
 	leafRepo := repos.NewLeafRepository(herbariumDB)
 	stemRepo := repos.NewStemRepository(herbariumDB)
 
-	mockHAProxyClient := new(MockHAProxyClient)
+	mockHAProxyClient := new(MockProxyClient)
 	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, stemRepo)
 
 	stemManager := NewStemManager(stemRepo, leafManager, mockHAProxyClient)
@@ -179,8 +182,8 @@ func TestStemManager_UnregisterStem(t *testing.T) {
 
 	stemRepo := repos.NewStemRepository(herbariumDB)
 
-	// Mock HAProxyClient and LeafManager
-	mockHAProxyClient := new(MockHAProxyClient)
+	// Mock ProxyClient and LeafManager
+	mockHAProxyClient := new(MockProxyClient)
 	mockLeafManager := new(MockLeafManager)
 
 	// Create StemManager
@@ -216,9 +219,11 @@ func TestStemManager_UnregisterStem(t *testing.T) {
 	mockLeafManager.On("StopLeaf", stemKey.Name, stemKey.Version, "leaf1").Return(nil)
 	mockLeafManager.On("StopLeaf", stemKey.Name, stemKey.Version, "leaf2").Return(nil)
 
-	// Mock setup for GetRunningLeafs
-	mockLeafManager.On("GetRunningLeafs", storage.StemKey{Name: "test-stem", Version: "1.0.0"}).
-		Return([]models.Leaf{
+	mockLeafManager.On("StopLeaf", stemKey.Name, stemKey.Version, "leaf3").Return(nil)
+
+	// Mock setup for ListLeafs, leafs in any state are stopped
+	mockLeafManager.On("ListLeafs", storage.StemKey{Name: "test-stem", Version: "1.0.0"}, repos.LeafQuery{}).
+		Return([]*models.Leaf{
 			{
 				ID:            "leaf1",
 				Status:        models.StatusRunning,
@@ -233,7 +238,17 @@ func TestStemManager_UnregisterStem(t *testing.T) {
 				PID:           12346,
 				HAProxyServer: "haproxy-server-2",
 			},
-		}, nil)
+			{
+				ID:            "leaf3",
+				Status:        models.StatusStopping,
+				Port:          8002,
+				PID:           12347,
+				HAProxyServer: "haproxy-server-3",
+			},
+		}, 3, nil)
+
+	// Mock tearing down the graft node
+	mockLeafManager.On("StopGraftNodeLeaf", stemKey.Name, stemKey.Version).Return(nil)
 
 	// Mock HAProxy unbind
 	mockHAProxyClient.On("UnbindStem", "/test").Return(nil)
@@ -245,6 +260,8 @@ func TestStemManager_UnregisterStem(t *testing.T) {
 	// Verify all leafs are stopped
 	mockLeafManager.AssertCalled(t, "StopLeaf", stemKey.Name, stemKey.Version, "leaf1")
 	mockLeafManager.AssertCalled(t, "StopLeaf", stemKey.Name, stemKey.Version, "leaf2")
+	mockLeafManager.AssertCalled(t, "StopLeaf", stemKey.Name, stemKey.Version, "leaf3")
+	mockLeafManager.AssertCalled(t, "StopGraftNodeLeaf", stemKey.Name, stemKey.Version)
 
 	// Verify HAProxy backend is unbound
 	mockHAProxyClient.AssertCalled(t, "UnbindStem", "/test")
@@ -253,6 +270,13 @@ func TestStemManager_UnregisterStem(t *testing.T) {
 	_, err = stemRepo.FetchStem(stemKey)
 	assert.Error(t, err)
 	assert.Equal(t, "stem test-stem with version 1.0.0 not found", err.Error())
+
+	// Its tombstone keeps the leafs it had
+	tombstone, err := stemRepo.FetchTombstone(stemKey)
+	assert.NoError(t, err)
+	assert.False(t, tombstone.Deleted.IsZero())
+	assert.Len(t, tombstone.LeafInstances, 2)
+	assert.Equal(t, models.StatusRunning, tombstone.LeafInstances["leaf1"].Status)
 }
 
 func TestStemManager_FetchStemInfo(t *testing.T) {
@@ -262,7 +286,7 @@ func TestStemManager_FetchStemInfo(t *testing.T) {
 
 	// Initialize the StemManager with a real repository
 	mockLeafManager := new(MockLeafManager) // Mock leaf manager (not used in this test)
-	mockHAProxyClient := new(MockHAProxyClient)
+	mockHAProxyClient := new(MockProxyClient)
 	stemManager := NewStemManager(stemRepo, mockLeafManager, mockHAProxyClient)
 
 	// Define a stem key
@@ -301,3 +325,290 @@ func TestStemManager_FetchStemInfo(t *testing.T) {
 	assert.Equal(t, map[string]string{"ENV_VAR": "test"}, retrievedStem.Environment, "stem environment should match")
 	assert.Equal(t, "echo 'test'", retrievedStem.Config.Command, "stem command should match")
 }
+
+func TestStemManager_RegisterStem_ReservedURL(t *testing.T) {
+	herbariumDB := storage.GetHerbariumDB()
+	stemRepo := repos.NewStemRepository(herbariumDB)
+
+	mockHAProxyClient := new(MockProxyClient)
+	stemManager := NewStemManager(stemRepo, new(MockLeafManager), mockHAProxyClient)
+
+	for _, url := range []string{"/herbarium", "herbarium/v1", "/herbarium/stems"} {
+		err := stemManager.RegisterStem(models.StemConfig{
+			Name:    "impostor",
+			URL:     url,
+			Command: "./run",
+			Version: "1.0.0",
+		})
+		assert.Error(t, err, url)
+		assert.Contains(t, err.Error(), "reserved")
+	}
+	mockHAProxyClient.AssertNotCalled(t, "BindStem", mock.Anything, mock.Anything)
+}
+
+func TestReservedURL(t *testing.T) {
+	assert.True(t, reservedURL("/herbarium"))
+	assert.True(t, reservedURL("herbarium"))
+	assert.True(t, reservedURL("/herbarium/v1"))
+	assert.False(t, reservedURL("/herbarium-docs"))
+	assert.False(t, reservedURL("/plants/herbarium"))
+}
+
+func TestStemManager_RegisterStem_BackendOptions(t *testing.T) {
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	stemRepo := repos.NewStemRepository(herbariumDB)
+
+	mockHAProxyClient := new(MockProxyClient)
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("StartGraftNodeLeaf", "greeter", "1.0.0").Return("graft-1", nil)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, mockHAProxyClient)
+
+	options := proxy.BackendOptions{Protocol: proxy.ProtocolH2C, HealthCheck: proxy.HealthCheckGRPC}
+	mockHAProxyClient.On("BindStem", "greeter", options).Return(nil)
+
+	err := stemManager.RegisterStem(models.StemConfig{
+		Name:    "greeter",
+		URL:     "/greeter",
+		Command: "./greeter",
+		Version: "1.0.0",
+		Backend: &models.BackendConfig{Protocol: "h2c", HealthCheck: "grpc"},
+	})
+	assert.NoError(t, err)
+	mockHAProxyClient.AssertExpectations(t)
+}
+
+func TestBackendOptions_Rewrite(t *testing.T) {
+	config := &models.StemConfig{URL: "/hello", Backend: &models.BackendConfig{StripPrefix: true}}
+	assert.Equal(t, proxy.BackendOptions{Rewrite: "/"}, backendOptions(config, "hello"))
+
+	config.Backend = &models.BackendConfig{Rewrite: "/api/v1"}
+	assert.Equal(t, proxy.BackendOptions{Rewrite: "/api/v1", Path: "/hello"}, backendOptions(config, "hb-hello-1"))
+}
+
+func TestBackendOptions_TimeoutsAndRetries(t *testing.T) {
+	retries := 0
+	config := &models.StemConfig{URL: "/batch", Backend: &models.BackendConfig{ConnectTimeout: "2s", ServerTimeout: "5m", Retries: &retries}}
+	assert.Equal(t, proxy.BackendOptions{ConnectTimeout: 2 * time.Second, ServerTimeout: 5 * time.Minute, Retries: &retries}, backendOptions(config, "batch"))
+}
+
+func TestBackendOptions_CompressionAndCache(t *testing.T) {
+	config := &models.StemConfig{URL: "/assets", Backend: &models.BackendConfig{Compression: true, CacheMaxAge: "5m"}}
+	assert.Equal(t, proxy.BackendOptions{Compression: true, CacheMaxAge: 5 * time.Minute}, backendOptions(config, "assets"))
+}
+
+func TestBackendOptions_CORSAndSecurityHeaders(t *testing.T) {
+	config := &models.StemConfig{URL: "/api", Backend: &models.BackendConfig{
+		SecurityHeaders: true,
+		CORS:            &models.CORSConfig{AllowOrigins: []string{"*"}, AllowHeaders: []string{"Authorization"}, MaxAge: "10m"},
+	}}
+	assert.Equal(t, proxy.BackendOptions{
+		SecurityHeaders: true,
+		CORS:            &proxy.CORSPolicy{AllowOrigins: []string{"*"}, AllowHeaders: []string{"Authorization"}, MaxAge: 10 * time.Minute},
+	}, backendOptions(config, "api"))
+}
+
+func TestBackendOptions_RateLimit(t *testing.T) {
+	config := &models.StemConfig{URL: "/api", Backend: &models.BackendConfig{RateLimit: &models.RateLimitConfig{Requests: 100}}}
+	assert.Equal(t, proxy.BackendOptions{RateLimit: &proxy.RateLimit{Requests: 100, Period: time.Second}}, backendOptions(config, "api"))
+
+	config.Backend.RateLimit.Period = "10s"
+	assert.Equal(t, 10*time.Second, backendOptions(config, "api").RateLimit.Period)
+}
+
+func TestBackendOptions_CircuitBreaker(t *testing.T) {
+	config := &models.StemConfig{URL: "/api", Backend: &models.BackendConfig{CircuitBreaker: &models.CircuitBreakerConfig{ErrorLimit: 10, RestartLeaf: true}}}
+	assert.Equal(t, proxy.BackendOptions{CircuitBreaker: &proxy.CircuitBreaker{ErrorLimit: 10, OnError: proxy.OnErrorMarkDown}}, backendOptions(config, "api"))
+}
+
+func TestBackendOptions_Mirror(t *testing.T) {
+	config := &models.StemConfig{Name: "api", Version: "v1", URL: "/api", Backend: &models.BackendConfig{Mirror: &models.MirrorConfig{Version: "v2", Percent: 10}}}
+	assert.Equal(t, proxy.BackendOptions{Mirror: &proxy.Mirror{Backend: "shadow_api-v2", Percent: 10}}, backendOptions(config, "api"))
+
+	shadow := &models.StemConfig{Name: "api", Version: "v2", URL: "/api", Shadow: true}
+	assert.Equal(t, proxy.BackendOptions{Path: "/api", Shadow: true}, backendOptions(shadow, "shadow_api-v2"))
+}
+
+func TestBackendOptions_Host(t *testing.T) {
+	config := &models.StemConfig{URL: "/hello", Host: "api.example.com"}
+	assert.Equal(t, proxy.BackendOptions{Path: "/hello", Host: "api.example.com"}, backendOptions(config, "api.example.com_hello"))
+}
+
+func TestStemManager_RegisterStem_StemNaming(t *testing.T) {
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	stemRepo := repos.NewStemRepository(herbariumDB)
+
+	mockHAProxyClient := new(MockProxyClient)
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("StartGraftNodeLeaf", "greeter", "1.0.0").Return("graft-1", nil)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, mockHAProxyClient)
+	stemManager.Naming = BackendNaming{Strategy: BackendNamingStem, Prefix: "hb-"}
+
+	// The backend isn't named after the URL, so the URL is passed as its path
+	mockHAProxyClient.On("BindStem", "hb-greeter-1.0.0", proxy.BackendOptions{Path: "/greeter"}).Return(nil)
+
+	err := stemManager.RegisterStem(models.StemConfig{
+		Name:    "greeter",
+		URL:     "/greeter",
+		Command: "./greeter",
+		Version: "1.0.0",
+	})
+	assert.NoError(t, err)
+	mockHAProxyClient.AssertExpectations(t)
+
+	stem, err := stemRepo.FetchStem(storage.StemKey{Name: "greeter", Version: "1.0.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hb-greeter-1.0.0", stem.HAProxyBackend)
+}
+
+func TestStemManager_RegisterStem_Hooks(t *testing.T) {
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	stemRepo := repos.NewStemRepository(herbariumDB)
+
+	mockHAProxyClient := new(MockProxyClient)
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("StartGraftNodeLeaf", "billing", "1.0.0").Return("graft-1", nil)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, mockHAProxyClient)
+	stemManager.Hooks = hooks.NewRegistry()
+
+	// A policy requiring a team label, which another hook enriches with the cost center
+	stemManager.Hooks.Register(hooks.BeforeRegisterStem, hooks.HookFunc(func(op *hooks.Operation) error {
+		if op.Stem.Labels["team"] == "" {
+			return errors.New("stems must have a team label")
+		}
+		op.Stem.Labels["costCenter"] = "cc-" + op.Stem.Labels["team"]
+		return nil
+	}))
+	var bound []hooks.Operation
+	stemManager.Hooks.Register(hooks.AfterProxyBind, hooks.HookFunc(func(op *hooks.Operation) error {
+		bound = append(bound, *op)
+		return nil
+	}))
+
+	config := models.StemConfig{Name: "billing", URL: "/billing", Command: "./billing", Version: "1.0.0", Labels: map[string]string{}}
+	err := stemManager.RegisterStem(config)
+	assert.EqualError(t, err, "registration of stem billing version 1.0.0 was vetoed: stems must have a team label")
+	mockHAProxyClient.AssertNotCalled(t, "BindStem", mock.Anything, mock.Anything)
+
+	mockHAProxyClient.On("BindStem", "billing", proxy.BackendOptions{}).Return(nil)
+	config.Labels["team"] = "payments"
+	assert.NoError(t, stemManager.RegisterStem(config))
+	stem, err := stemRepo.FetchStem(storage.StemKey{Name: "billing", Version: "1.0.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, "cc-payments", stem.Config.Labels["costCenter"])
+	if assert.Len(t, bound, 1) {
+		assert.Equal(t, "billing", bound[0].Backend)
+		assert.Empty(t, bound[0].Error)
+	}
+}
+
+func TestStemManager_RegisterStem_Upsert(t *testing.T) {
+	herbariumDB := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	stemRepo := repos.NewStemRepository(herbariumDB)
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindStem", "billing", proxy.BackendOptions{}).Return(nil).Once()
+	mockLeafManager := new(MockLeafManager)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, mockHAProxyClient)
+	stemManager.Events = NewEventLog(0)
+
+	key := storage.StemKey{Name: "billing", Version: "1.0.0"}
+	minInstances := 1
+	config := models.StemConfig{Name: "billing", Version: "1.0.0", URL: "/billing", Command: "./billing --port {{.PORT}}",
+		Env: map[string]string{"DB_URL": "postgres://old"}, MinInstances: &minInstances}
+	mockLeafManager.On("StartLeaf", "billing", "1.0.0", (*string)(nil)).Return("billing-1", nil).Once()
+	assert.NoError(t, stemManager.RegisterStem(config))
+
+	// Without upsert a registered stem is rejected, with it an unchanged config is a no-op
+	assert.ErrorContains(t, stemManager.RegisterStem(config), "already exists")
+	assert.NoError(t, stemManager.RegisterStem(config, RegisterOptions{Upsert: true}))
+	mockLeafManager.AssertNotCalled(t, "GetRunningLeafs", key)
+
+	// A changed env rolls the running leaf, a raised minInstances starts another
+	updated := config
+	updated.Env = map[string]string{"DB_URL": "postgres://new"}
+	updatedMinInstances := 2
+	updated.MinInstances = &updatedMinInstances
+	mockLeafManager.On("GetRunningLeafs", key).Return([]models.Leaf{{ID: "billing-1"}}, nil).Once()
+	mockLeafManager.On("RollLeaf", key, "billing-1").Return("billing-2", nil).Once()
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{Status: models.StatusStandby}).Return(nil, 0, nil).Once()
+	mockLeafManager.On("StartLeaf", "billing", "1.0.0", (*string)(nil)).Return("billing-3", nil).Once()
+	assert.NoError(t, stemManager.RegisterStem(updated, RegisterOptions{Upsert: true}))
+	mockLeafManager.AssertExpectations(t)
+
+	stem, err := stemRepo.FetchStem(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://new", stem.Config.Env["DB_URL"])
+	assert.Equal(t, "postgres://new", stem.Environment["DB_URL"])
+	events := stemManager.Events.List(EventQuery{Type: models.EventStemUpdated})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "Stem billing version 1.0.0 was updated, env, minInstances changed", events[0].Message)
+	}
+
+	// Lowering minInstances only updates the config
+	mockLeafManager.On("GetRunningLeafs", key).Return([]models.Leaf{{ID: "billing-2"}, {ID: "billing-3"}}, nil).Once()
+	lowered := updated
+	lowered.MinInstances = &minInstances
+	assert.NoError(t, stemManager.RegisterStem(lowered, RegisterOptions{Upsert: true}))
+	mockLeafManager.AssertNumberOfCalls(t, "RollLeaf", 1)
+	mockLeafManager.AssertNumberOfCalls(t, "StartLeaf", 2)
+
+	// The backend settings need a new version
+	h2 := lowered
+	h2.Backend = &models.BackendConfig{Protocol: "h2c"}
+	assert.ErrorContains(t, stemManager.RegisterStem(h2, RegisterOptions{Upsert: true}), "cannot change in place")
+	mockHAProxyClient.AssertExpectations(t)
+}
+
+func TestStemManager_UpdateStemConfig(t *testing.T) {
+	herbariumDB := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	stemRepo := repos.NewStemRepository(herbariumDB)
+	key := storage.StemKey{Name: "billing", Version: "1.0.0"}
+	minInstances := 1
+	config := models.StemConfig{Name: "billing", Version: "1.0.0", URL: "/billing", Command: "./billing --port {{.PORT}}", MinInstances: &minInstances}
+	herbariumDB.Stems[key] = &models.Stem{Name: "billing", Version: "1.0.0", WorkingURL: "/billing", HAProxyBackend: "billing", Config: &config,
+		LeafInstances: map[string]*models.Leaf{
+			"billing-1": {ID: "billing-1", Status: models.StatusRunning, HAProxyServer: "billing-1", Port: 8001},
+			"billing-2": {ID: "billing-2", Status: models.StatusStandby, HAProxyServer: "billing-2", Port: 8002},
+		}}
+
+	mockHAProxyClient := new(MockProxyClient)
+	mockLeafManager := new(MockLeafManager)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, mockHAProxyClient)
+
+	// A new URL binds the running leaf to the new backend before the old one is removed, a new command
+	// without rolling only applies to leafs started later
+	updated := config
+	updated.URL = "/payments"
+	updated.Command = "./billing --port {{.PORT}} --fast"
+	mockHAProxyClient.On("BindStem", "payments", proxy.BackendOptions{}).Return(nil).Once()
+	mockHAProxyClient.On("BindLeaf", "payments", "billing-1", "localhost", 8001).Return(nil).Once()
+	mockHAProxyClient.On("UnbindStem", "billing").Return(nil).Once()
+	mockLeafManager.On("GetRunningLeafs", key).Return([]models.Leaf{{ID: "billing-1"}}, nil)
+	assert.NoError(t, stemManager.UpdateStemConfig(key, updated, UpdateOptions{}))
+	mockHAProxyClient.AssertExpectations(t)
+	mockLeafManager.AssertNotCalled(t, "RollLeaf", key, "billing-1")
+
+	stem, err := stemRepo.FetchStem(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "/payments", stem.WorkingURL)
+	assert.Equal(t, "payments", stem.HAProxyBackend)
+	assert.Equal(t, updated.Command, stem.Config.Command)
+
+	// Rolling replaces the running leaf and restarts the standby leaf
+	rolled := updated
+	rolled.Env = map[string]string{"MODE": "fast"}
+	mockLeafManager.On("RollLeaf", key, "billing-1").Return("billing-3", nil).Once()
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{Status: models.StatusStandby}).Return([]*models.Leaf{{ID: "billing-2"}}, 1, nil).Once()
+	mockLeafManager.On("StopLeaf", "billing", "1.0.0", "billing-2").Return(nil).Once()
+	assert.NoError(t, stemManager.UpdateStemConfig(key, rolled, UpdateOptions{RollLeafs: true}))
+	mockLeafManager.AssertExpectations(t)
+
+	renamed := rolled
+	renamed.Name = "payments"
+	assert.ErrorContains(t, stemManager.UpdateStemConfig(key, renamed, UpdateOptions{}), "must keep its name and version")
+	reserved := rolled
+	reserved.URL = AdminAPIPath + "/stems"
+	assert.ErrorContains(t, stemManager.UpdateStemConfig(key, reserved, UpdateOptions{}), "reserved for the herbarium admin API")
+}
@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// ErrNoRollback is returned when a stem has no earlier version to roll back to.
+var ErrNoRollback = errors.New("no version to roll back to")
+
+// StemVersions lists every version ever registered for a stem, first registered first, with when it was
+// registered and unregistered and the version a rollback from it returns to.
+func (s *StemManager) StemVersions(name string) ([]*models.StemVersion, error) {
+	return s.StemRepo.ListVersions(name)
+}
+
+// Rollback returns a stem to the version that was current when its newest registered version was first
+// registered. The newest version is unregistered and marked rolled back in the version history, and the
+// earlier one registered again with the config it was last registered with, unless it still is registered.
+// The newest version goes first since versions may share a proxy backend, which unregistering empties; an
+// earlier version still registered on the same backend is registered again for that reason. Rolling back
+// again walks further back through the history. It returns the key of the version rolled back to.
+func (s *StemManager) Rollback(name string, opts ...RegisterOptions) (storage.StemKey, error) {
+	history, err := s.StemRepo.ListVersions(name)
+	if err != nil {
+		return storage.StemKey{}, fmt.Errorf("failed to read version history of stem %s: %v", name, err)
+	}
+	var current *models.StemVersion
+	for _, entry := range history {
+		if entry.Status == models.VersionActive && (current == nil || entry.RegisteredAt.After(current.RegisteredAt)) {
+			current = entry
+		}
+	}
+	if current == nil {
+		return storage.StemKey{}, fmt.Errorf("%w: stem %s has no registered version", ErrNoRollback, name)
+	}
+	if current.Previous == "" {
+		return storage.StemKey{}, fmt.Errorf("%w: version %s is the first version of stem %s", ErrNoRollback, current.Version, name)
+	}
+	var target *models.StemVersion
+	for _, entry := range history {
+		if entry.Version == current.Previous {
+			target = entry
+		}
+	}
+	if target == nil || target.Config == nil {
+		return storage.StemKey{}, fmt.Errorf("%w: the config of version %s of stem %s is not known", ErrNoRollback, current.Previous, name)
+	}
+
+	targetKey := storage.StemKey{Name: name, Version: target.Version}
+	currentKey := storage.StemKey{Name: name, Version: current.Version}
+	stem, err := s.StemRepo.FetchStem(currentKey)
+	if err != nil {
+		return storage.StemKey{}, fmt.Errorf("failed to fetch stem %s version %s: %v", name, current.Version, err)
+	}
+	if err := s.UnregisterStem(currentKey); err != nil {
+		return storage.StemKey{}, fmt.Errorf("failed to unregister stem %s version %s: %w", name, current.Version, err)
+	}
+	if err := s.StemRepo.SetVersionStatus(currentKey, models.VersionRolledBack, time.Now().UTC()); err != nil {
+		log.Printf("Failed to record the rollback of stem %s version %s: %v", name, current.Version, err)
+	}
+
+	registered, err := s.StemRepo.FetchStem(targetKey)
+	if err == nil && proxied(registered.Config) && registered.HAProxyBackend == stem.HAProxyBackend {
+		if err := s.UnregisterStem(targetKey); err != nil {
+			return storage.StemKey{}, fmt.Errorf("failed to unregister stem %s version %s to bind it again: %w", name, target.Version, err)
+		}
+		registered = nil
+	}
+	if registered == nil {
+		if err := s.RegisterStem(*target.Config, opts...); err != nil {
+			return storage.StemKey{}, fmt.Errorf("stem %s version %s was unregistered, but version %s failed to register again: %w", name, current.Version, target.Version, err)
+		}
+	}
+
+	log.Printf("Rolled back stem %s from version %s to version %s", name, current.Version, target.Version)
+	s.Events.Record(models.Event{
+		Type:    models.EventStemRolledBack,
+		Stem:    name,
+		Version: target.Version,
+		Message: fmt.Sprintf("Stem %s was rolled back from version %s to version %s", name, current.Version, target.Version),
+	})
+	return targetKey, nil
+}
@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStemManager_Rollback(t *testing.T) {
+	t.Setenv("PLANTARIUM_ROOT_FOLDER", t.TempDir())
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	mockLeafManager := new(MockLeafManager)
+	mockProxyClient := new(MockProxyClient)
+	stemManager := NewStemManager(repos.NewStemRepository(herbariumDB), mockLeafManager, mockProxyClient)
+	mockProxyClient.On("BindStem", "billing", proxy.BackendOptions{}).Return(nil)
+	mockProxyClient.On("UnbindStem", "billing").Return(nil)
+	mockLeafManager.On("StartLeaf", "billing", mock.Anything, (*string)(nil)).Return("leaf", nil)
+	mockLeafManager.On("StopGraftNodeLeaf", "billing", mock.Anything).Return(nil)
+	mockLeafManager.On("ListLeafs", mock.Anything, repos.LeafQuery{}).Return([]*models.Leaf{}, 0, nil)
+	instances := 1
+	config := func(version string) models.StemConfig {
+		return models.StemConfig{Name: "billing", Version: version, URL: "/billing", Command: "./billing", MinInstances: &instances}
+	}
+
+	_, err := stemManager.Rollback("billing")
+	assert.True(t, errors.Is(err, ErrNoRollback), "%v", err)
+
+	assert.NoError(t, stemManager.RegisterStem(config("v1")))
+	_, err = stemManager.Rollback("billing")
+	assert.True(t, errors.Is(err, ErrNoRollback), "%v", err)
+	assert.NoError(t, stemManager.RegisterStem(config("v2"), RegisterOptions{DeployedBy: "alice@laptop"}))
+
+	// The newest version is unregistered, and v1, which shared its backend, registered again
+	key, err := stemManager.Rollback("billing", RegisterOptions{DeployedBy: "bob@laptop"})
+	assert.NoError(t, err)
+	assert.Equal(t, storage.StemKey{Name: "billing", Version: "v1"}, key)
+	stem, err := stemManager.FetchStemInfo(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob@laptop", stem.Metadata.DeployedBy)
+	_, err = stemManager.FetchStemInfo(storage.StemKey{Name: "billing", Version: "v2"})
+	assert.Error(t, err)
+
+	history, err := stemManager.StemVersions("billing")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, models.VersionActive, history[0].Status)
+		assert.Equal(t, 2, history[0].Registrations)
+		assert.Equal(t, models.VersionRolledBack, history[1].Status)
+		assert.Equal(t, "v1", history[1].Previous)
+		assert.Equal(t, "alice@laptop", history[1].Metadata.DeployedBy)
+		assert.False(t, history[1].UnregisteredAt.IsZero())
+	}
+
+	// v1 is the first version, there is nothing earlier to roll back to
+	_, err = stemManager.Rollback("billing")
+	assert.True(t, errors.Is(err, ErrNoRollback), "%v", err)
+}
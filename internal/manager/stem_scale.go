@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// ErrScaleOutOfRange is returned when a stem is scaled below its minInstances or above its maxInstances.
+var ErrScaleOutOfRange = errors.New("replica count is out of range")
+
+// Scale sets the number of running leafs of a stem and converges on it: leafs are promoted from the warm
+// pool or started when there are too few, and the newest leafs are drained and stopped when there are too
+// many. A stem scaled to zero gets a graft node that starts a leaf on the next request. The count is
+// recorded on the stem, so a restore brings back the scaled stem rather than its minInstances.
+func (s *StemManager) Scale(key storage.StemKey, replicas int) error {
+	stem, err := s.StemRepo.FetchStem(key)
+	if err != nil {
+		return fmt.Errorf("failed to fetch stem %s version %s: %v", key.Name, key.Version, err)
+	}
+	if err := checkReplicas(stem.Config, replicas); err != nil {
+		return err
+	}
+	// Another scale of the stem since it was fetched wins, rather than both converging at once
+	_, err = s.StemRepo.CompareAndSwapStem(key, stem.Revision, func(stem *models.Stem) error {
+		stem.Replicas = &replicas
+		return nil
+	})
+	if errors.Is(err, repos.ErrConflict) {
+		return fmt.Errorf("stem %s version %s changed while being scaled: %w", key.Name, key.Version, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record replicas of stem %s version %s: %v", key.Name, key.Version, err)
+	}
+
+	running, err := s.LeafManager.GetRunningLeafs(key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve running leafs for stem %s version %s: %v", key.Name, key.Version, err)
+	}
+	log.Printf("Scaling stem %s version %s from %d to %d leafs", key.Name, key.Version, len(running), replicas)
+	switch {
+	case replicas > len(running):
+		if stem.GraftNodeLeaf != nil {
+			if err := s.LeafManager.StopGraftNodeLeaf(key.Name, key.Version); err != nil {
+				return fmt.Errorf("failed to stop graft node for stem %s: %v", key.Name, err)
+			}
+		}
+		for started := len(running); started < replicas; started++ {
+			if err := s.addLeaf(stem); err != nil {
+				return fmt.Errorf("started %d of %d leafs for stem %s version %s: %v",
+					started-len(running), replicas-len(running), key.Name, key.Version, err)
+			}
+		}
+	case replicas < len(running):
+		// The oldest leafs are kept, they have warmed up the longest
+		sort.Slice(running, func(i, j int) bool { return running[i].Initialized.After(running[j].Initialized) })
+		for _, leaf := range running[:len(running)-replicas] {
+			if err := s.LeafManager.StopLeaf(key.Name, key.Version, leaf.ID); err != nil {
+				return fmt.Errorf("failed to stop leaf %s of stem %s version %s: %v", leaf.ID, key.Name, key.Version, err)
+			}
+		}
+		if replicas == 0 && !isUDPStem(stem.Config) {
+			if _, err := s.LeafManager.StartGraftNodeLeaf(key.Name, key.Version); err != nil {
+				return fmt.Errorf("failed to start graft node for stem %s: %v", key.Name, err)
+			}
+		}
+	}
+
+	s.Events.Record(models.Event{
+		Type:    models.EventStemScaled,
+		Stem:    key.Name,
+		Version: key.Version,
+		Message: fmt.Sprintf("Stem %s version %s was scaled from %d to %d leafs", key.Name, key.Version, len(running), replicas),
+	})
+	return nil
+}
+
+// addLeaf brings up one more running leaf for a stem, preferring a standby leaf from the warm pool.
+func (s *StemManager) addLeaf(stem *models.Stem) error {
+	err := ErrNoStandbyLeaf
+	if warmPoolSize(stem.Config) > 0 {
+		_, err = s.LeafManager.PromoteStandbyLeaf(stem.Name, stem.Version, nil)
+	}
+	if errors.Is(err, ErrNoStandbyLeaf) {
+		_, err = s.LeafManager.StartLeaf(stem.Name, stem.Version, nil)
+	}
+	return err
+}
+
+// checkReplicas checks a replica count against the minInstances and maxInstances of a stem.
+func checkReplicas(config *models.StemConfig, replicas int) error {
+	if replicas < 0 {
+		return fmt.Errorf("%w: %d is negative", ErrScaleOutOfRange, replicas)
+	}
+	if config == nil {
+		return nil
+	}
+	if minInstances := minInstancesOf(config); replicas < minInstances {
+		return fmt.Errorf("%w: %d is below minInstances %d", ErrScaleOutOfRange, replicas, minInstances)
+	}
+	if config.MaxInstances != nil && replicas > *config.MaxInstances {
+		return fmt.Errorf("%w: %d is above maxInstances %d", ErrScaleOutOfRange, replicas, *config.MaxInstances)
+	}
+	return nil
+}
+
+// desiredInstances returns the number of leafs a stem should run: the count it was last scaled to, or its
+// minInstances.
+func desiredInstances(stem *models.Stem) int {
+	if stem.Replicas != nil {
+		return *stem.Replicas
+	}
+	if stem.Config == nil {
+		return 0
+	}
+	return minInstancesOf(stem.Config)
+}
@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStemManager_Scale(t *testing.T) {
+	herbariumDB := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	stemRepo := repos.NewStemRepository(herbariumDB)
+	key := storage.StemKey{Name: "billing", Version: "1.0.0"}
+	minInstances, maxInstances, warmPool := 0, 3, 1
+	config := models.StemConfig{Name: "billing", Version: "1.0.0", URL: "/billing", Command: "./billing",
+		MinInstances: &minInstances, MaxInstances: &maxInstances, WarmPool: &warmPool}
+	herbariumDB.Stems[key] = &models.Stem{Name: "billing", Version: "1.0.0", WorkingURL: "/billing", HAProxyBackend: "billing", Config: &config,
+		GraftNodeLeaf: &models.Leaf{ID: "billing-graftnode"}}
+
+	mockLeafManager := new(MockLeafManager)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, new(MockProxyClient))
+	stemManager.Events = NewEventLog(0)
+
+	// Scaling up replaces the graft node, taking the standby leaf before starting new ones
+	mockLeafManager.On("GetRunningLeafs", key).Return([]models.Leaf{}, nil).Once()
+	mockLeafManager.On("StopGraftNodeLeaf", "billing", "1.0.0").Return(nil).Once()
+	mockLeafManager.On("PromoteStandbyLeaf", "billing", "1.0.0", (*string)(nil)).Return("billing-1", nil).Once()
+	mockLeafManager.On("PromoteStandbyLeaf", "billing", "1.0.0", (*string)(nil)).Return("", ErrNoStandbyLeaf).Once()
+	mockLeafManager.On("StartLeaf", "billing", "1.0.0", (*string)(nil)).Return("billing-2", nil).Once()
+	assert.NoError(t, stemManager.Scale(key, 2))
+	mockLeafManager.AssertExpectations(t)
+
+	stem, err := stemRepo.FetchStem(key)
+	assert.NoError(t, err)
+	if assert.NotNil(t, stem.Replicas) {
+		assert.Equal(t, 2, *stem.Replicas)
+	}
+
+	// Scaling down stops the newest leafs, and a stem scaled to zero gets a graft node again
+	now := time.Now()
+	herbariumDB.Stems[key].GraftNodeLeaf = nil
+	mockLeafManager.On("GetRunningLeafs", key).Return([]models.Leaf{
+		{ID: "billing-1", Initialized: now.Add(-time.Hour)},
+		{ID: "billing-2", Initialized: now},
+	}, nil).Once()
+	mockLeafManager.On("StopLeaf", "billing", "1.0.0", "billing-2").Return(nil).Once()
+	mockLeafManager.On("StopLeaf", "billing", "1.0.0", "billing-1").Return(nil).Once()
+	mockLeafManager.On("StartGraftNodeLeaf", "billing", "1.0.0").Return("billing-graftnode", nil).Once()
+	assert.NoError(t, stemManager.Scale(key, 0))
+	mockLeafManager.AssertExpectations(t)
+
+	events := stemManager.Events.List(EventQuery{})
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, models.EventStemScaled, events[1].Type)
+		assert.Equal(t, "Stem billing version 1.0.0 was scaled from 2 to 0 leafs", events[1].Message)
+	}
+
+	// Counts outside minInstances and maxInstances are refused without touching the leafs
+	assert.ErrorIs(t, stemManager.Scale(key, 4), ErrScaleOutOfRange)
+	assert.ErrorIs(t, stemManager.Scale(key, -1), ErrScaleOutOfRange)
+	stem, err = stemRepo.FetchStem(key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, *stem.Replicas)
+}
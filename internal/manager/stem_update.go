@@ -0,0 +1,215 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// RegisterOptions changes how RegisterStem treats a stem whose name and version are already registered.
+type RegisterOptions struct {
+	// Upsert applies the config to the registered stem in place instead of failing, so the same configs can
+	// be applied again and again. It is UpdateStemConfig with RollLeafs.
+	Upsert bool
+	// DeployedBy is who registers the stem through the admin API, recorded with the version.
+	DeployedBy string
+}
+
+// UpdateOptions controls how UpdateStemConfig applies a changed config to the stem's leafs.
+type UpdateOptions struct {
+	// RollLeafs replaces the running leafs one at a time, and restarts the standby leafs, when anything their
+	// processes are started with changed. Otherwise only leafs started later use the new config.
+	RollLeafs bool
+}
+
+// UpdateStemConfig applies a changed config to a registered stem without destroying it. A new URL moves the
+// stem to a new proxy backend: the running leafs are bound to it before the old backend is removed, so
+// requests to the new URL are served right away. Leafs are started up to a raised minInstances, while a
+// lowered minInstances leaves the running leafs alone. The transport and backend settings can only change
+// with a new version. The config must keep the stem's name and version.
+func (s *StemManager) UpdateStemConfig(key storage.StemKey, config models.StemConfig, opts UpdateOptions) error {
+	stem, err := s.StemRepo.FetchStem(key)
+	if err != nil {
+		return fmt.Errorf("failed to fetch stem %s version %s: %v", key.Name, key.Version, err)
+	}
+	if config.Name != key.Name || config.Version != key.Version {
+		return fmt.Errorf("config of stem %s version %s must keep its name and version", key.Name, key.Version)
+	}
+	current := models.StemConfig{}
+	if stem.Config != nil {
+		current = *stem.Config
+	}
+	if reflect.DeepEqual(current, config) {
+		log.Printf("Stem %s version %s is up to date", config.Name, config.Version)
+		return nil
+	}
+	if config.Transport != current.Transport || !reflect.DeepEqual(config.UDP, current.UDP) || !reflect.DeepEqual(config.Backend, current.Backend) {
+		return fmt.Errorf("the transport and backend of stem %s version %s cannot change in place, register a new version", config.Name, config.Version)
+	}
+	backend := s.Naming.Name(config)
+	moved := config.URL != stem.WorkingURL || config.Host != current.Host
+	if moved {
+		if reservedURL(config.URL) {
+			return fmt.Errorf("URL %s is reserved for the herbarium admin API", config.URL)
+		}
+		// Platform maintenance switched the old backend and would leave the new one serving
+		if proxied(&config) && s.Maintenance != nil && s.Maintenance.Status().Enabled {
+			return ErrMaintenance
+		}
+	}
+
+	changes := configChanges(current, config)
+	log.Printf("Updating stem %s version %s: %s changed", config.Name, config.Version, strings.Join(changes, ", "))
+	if err := s.StemRepo.UpdateStem(key, config.Version, &config); err != nil {
+		return fmt.Errorf("failed to update stem %s version %s: %v", config.Name, config.Version, err)
+	}
+	if moved && proxied(&config) {
+		if err := s.moveStem(key, stem, config, backend); err != nil {
+			return err
+		}
+	} else if moved {
+		if err := s.StemRepo.SetStemRoute(key, config.URL, backend); err != nil {
+			return fmt.Errorf("failed to record URL of stem %s version %s: %v", config.Name, config.Version, err)
+		}
+	}
+
+	// A count the stem was scaled to that the new limits don't allow gives way to minInstances
+	if stem.Replicas != nil && checkReplicas(&config, *stem.Replicas) != nil {
+		if err := s.StemRepo.SetStemReplicas(key, nil); err != nil {
+			return fmt.Errorf("failed to reset replicas of stem %s version %s: %v", config.Name, config.Version, err)
+		}
+	}
+
+	running, err := s.LeafManager.GetRunningLeafs(key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve running leafs for stem %s version %s: %v", config.Name, config.Version, err)
+	}
+	if opts.RollLeafs && leafConfigChanged(current, config) {
+		for _, leaf := range running {
+			if _, err := s.LeafManager.RollLeaf(key, leaf.ID); err != nil {
+				return fmt.Errorf("failed to roll leaf %s of stem %s version %s: %v", leaf.ID, config.Name, config.Version, err)
+			}
+		}
+		standby, _, err := s.LeafManager.ListLeafs(key, repos.LeafQuery{Status: models.StatusStandby})
+		if err != nil {
+			return fmt.Errorf("failed to retrieve standby leafs for stem %s version %s: %v", config.Name, config.Version, err)
+		}
+		for _, leaf := range standby {
+			if err := s.LeafManager.StopLeaf(config.Name, config.Version, leaf.ID); err != nil {
+				return fmt.Errorf("failed to stop standby leaf %s of stem %s version %s: %v", leaf.ID, config.Name, config.Version, err)
+			}
+		}
+	}
+
+	if minInstances := minInstancesOf(&config); minInstances > len(running) {
+		if stem.GraftNodeLeaf != nil {
+			if err := s.LeafManager.StopGraftNodeLeaf(config.Name, config.Version); err != nil {
+				return fmt.Errorf("failed to stop graft node for stem %s: %v", config.Name, err)
+			}
+		}
+		for started := len(running); started < minInstances; started++ {
+			if _, err := s.LeafManager.StartLeaf(config.Name, config.Version, nil); err != nil {
+				return fmt.Errorf("failed to start leaf for stem %s version %s: %v", config.Name, config.Version, err)
+			}
+		}
+	} else if len(running) == 0 && stem.GraftNodeLeaf == nil && !isUDPStem(&config) {
+		log.Printf("No minimum instances specified for stem %s, starting graft node...", config.Name)
+		if _, err := s.LeafManager.StartGraftNodeLeaf(config.Name, config.Version); err != nil {
+			return fmt.Errorf("failed to start graft node for stem %s: %v", config.Name, err)
+		}
+	}
+
+	// Standby leafs are best effort, as on registration
+	if warmPoolSize(&config) > 0 {
+		started, err := s.LeafManager.FillWarmPool(config.Name, config.Version)
+		if err != nil {
+			log.Printf("Started %d of %d standby leafs for stem %s: %v", started, warmPoolSize(&config), config.Name, err)
+		}
+	}
+
+	s.Events.Record(models.Event{
+		Type:    models.EventStemUpdated,
+		Stem:    config.Name,
+		Version: config.Version,
+		Message: fmt.Sprintf("Stem %s version %s was updated, %s changed", config.Name, config.Version, strings.Join(changes, ", ")),
+	})
+	return nil
+}
+
+// moveStem binds a stem's running leafs to the backend for its new URL, then removes the old backend unless the
+// backend isn't named after the URL and was just rebound. The graft node serves the old URL, so it is stopped;
+// UpdateStemConfig starts a new one when no leaf runs.
+func (s *StemManager) moveStem(key storage.StemKey, stem *models.Stem, config models.StemConfig, backend string) error {
+	oldBackend := stem.HAProxyBackend
+	if stem.GraftNodeLeaf != nil {
+		if err := s.LeafManager.StopGraftNodeLeaf(key.Name, key.Version); err != nil {
+			return fmt.Errorf("failed to stop graft node for stem %s: %v", key.Name, err)
+		}
+	}
+	if err := s.bindStemBackend(config, backend); err != nil {
+		return err
+	}
+	for _, leaf := range stem.LeafInstances {
+		if leaf.Status != models.StatusRunning {
+			continue
+		}
+		if err := s.ProxyClient.BindLeaf(backend, leaf.HAProxyServer, leafHost(leaf), leaf.Port); err != nil {
+			return fmt.Errorf("failed to bind leaf %s to backend %s: %v", leaf.ID, backend, err)
+		}
+	}
+	if err := s.StemRepo.SetStemRoute(key, config.URL, backend); err != nil {
+		return fmt.Errorf("failed to record URL of stem %s version %s: %v", key.Name, key.Version, err)
+	}
+	if stem.Maintenance {
+		if err := switchStemMaintenance(s.ProxyClient, s.Maintenance, stem, true); err != nil {
+			return fmt.Errorf("failed to put backend %s into maintenance: %v", backend, err)
+		}
+	}
+	if oldBackend == backend {
+		log.Printf("Moved stem %s version %s to %s on backend %s", key.Name, key.Version, config.URL, backend)
+		return nil
+	}
+	if err := s.ProxyClient.UnbindStem(oldBackend); err != nil {
+		return fmt.Errorf("stem %s moved to %s, but failed to unbind backend %s: %v", key.Name, config.URL, oldBackend, err)
+	}
+	log.Printf("Moved stem %s version %s from backend %s to %s", key.Name, key.Version, oldBackend, backend)
+	return nil
+}
+
+// minInstancesOf returns the number of leafs a stem keeps running.
+func minInstancesOf(config *models.StemConfig) int {
+	if config.MinInstances == nil {
+		return 0
+	}
+	return *config.MinInstances
+}
+
+// configChanges names the parts of a stem's config that differ, in the order of the config.
+func configChanges(current, updated models.StemConfig) []string {
+	var changes []string
+	currentValue, updatedValue := reflect.ValueOf(current), reflect.ValueOf(updated)
+	for i := 0; i < currentValue.NumField(); i++ {
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), updatedValue.Field(i).Interface()) {
+			name, _, _ := strings.Cut(currentValue.Type().Field(i).Tag.Get("yaml"), ",")
+			changes = append(changes, name)
+		}
+	}
+	return changes
+}
+
+// leafConfigChanged reports whether anything a leaf process is started with differs between two configs.
+// Scaling, alerting and recycling settings and the stop settings, which are read when a leaf stops, don't
+// need new leafs. Neither does the URL, which only the proxy sees.
+func leafConfigChanged(current, updated models.StemConfig) bool {
+	for _, config := range []*models.StemConfig{&current, &updated} {
+		config.URL, config.Labels, config.MinInstances, config.WarmPool = "", nil, nil, nil
+		config.Recycle, config.Alerts = nil, nil
+		config.StopSignal, config.StopTimeout, config.DrainTimeout = "", "", ""
+	}
+	return !reflect.DeepEqual(current, updated)
+}
@@ -0,0 +1,179 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultSweepInterval is how often the sweeper looks for orphaned leafs, proxy servers, and ports.
+const DefaultSweepInterval = 5 * time.Minute
+
+// Sweeper reclaims what leafs leave behind when they die or are lost outside of herbarium's control: leaf
+// records whose process is gone, proxy servers no leaf owns, and port reservations no leaf holds. Servers
+// and ports are only reclaimed when two sweeps in a row find them orphaned, so leafs that are starting and
+// not yet recorded are left alone. Leafs on agents and SSH hosts are left to their runtime.
+type Sweeper struct {
+	StemRepo    repos.StemRepositoryInterface
+	LeafManager LeafManagerInterface
+	ProxyClient proxy.ProxyClient
+	Events      *EventLog // Receives an event for every sweep that reclaimed something, nil to only log it
+
+	mu       sync.Mutex      // Serializes sweeps
+	ports    *PortAllocator  // Allocator the leaf ports are reserved in
+	suspects map[string]bool // Servers and ports the previous sweep found orphaned
+}
+
+// NewSweeper creates a Sweeper for the stems in stemRepo and the ports reserved for leafs in this process.
+func NewSweeper(stemRepo repos.StemRepositoryInterface, leafManager LeafManagerInterface, proxyClient proxy.ProxyClient) *Sweeper {
+	return &Sweeper{
+		StemRepo:    stemRepo,
+		LeafManager: leafManager,
+		ProxyClient: proxyClient,
+		ports:       leafPorts,
+		suspects:    make(map[string]bool),
+	}
+}
+
+// StartSchedule sweeps every interval until stop is closed.
+func (s *Sweeper) StartSchedule(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("Sweeping for orphaned leafs, servers, and ports every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				RunRecovered("sweeper", func() { s.Sweep() })
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Sweep stops leafs whose process is gone, unbinds proxy servers without a leaf, and releases port
+// reservations without a leaf, returning what it reclaimed.
+func (s *Sweeper) Sweep() models.SweepReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := models.SweepReport{DeadLeafs: []string{}, StaleServers: []string{}, FreedPorts: []string{}, HeldPorts: []string{}}
+	stems, err := s.StemRepo.GetAllStems()
+	if err != nil {
+		log.Printf("Failed to list stems for sweeping: %v", err)
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list stems: %v", err))
+		return report
+	}
+
+	suspects := make(map[string]bool)
+	owners := make(map[string]bool)
+	for _, stem := range stems {
+		key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+		for _, leaf := range stem.LeafInstances {
+			owners[leaf.ID] = true
+		}
+		s.sweepLeafs(key, stem, &report)
+		s.sweepServers(stem, stems, suspects, &report)
+	}
+	s.sweepPorts(owners, suspects, &report)
+	s.suspects = suspects
+
+	if reclaimed := len(report.DeadLeafs) + len(report.StaleServers) + len(report.FreedPorts); reclaimed > 0 {
+		message := fmt.Sprintf("Reclaimed %d dead leafs, %d stale servers, and %d ports", len(report.DeadLeafs), len(report.StaleServers), len(report.FreedPorts))
+		if len(report.HeldPorts) > 0 {
+			message += fmt.Sprintf(", ports %s are still held by unknown processes", strings.Join(report.HeldPorts, ", "))
+		}
+		log.Print(message)
+		s.Events.Record(models.Event{Type: models.EventOrphansReclaimed, Message: message})
+	}
+	return report
+}
+
+// sweepLeafs stops the leafs of a stem that herbarium started here and whose process is gone. Starting and
+// stopping leafs are in the middle of a change and left alone.
+func (s *Sweeper) sweepLeafs(key storage.StemKey, stem *models.Stem, report *models.SweepReport) {
+	for _, leaf := range stem.LeafInstances {
+		if leaf.Agent != "" || (leaf.Status != models.StatusRunning && leaf.Status != models.StatusStandby) {
+			continue
+		}
+		if processAlive(leaf.PID) {
+			continue
+		}
+		log.Printf("Process %d of leaf %s of stem %s version %s is gone, cleaning up", leaf.PID, leaf.ID, key.Name, key.Version)
+		if err := s.LeafManager.StopLeaf(key.Name, key.Version, leaf.ID); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to clean up leaf %s: %v", leaf.ID, err))
+			continue
+		}
+		report.DeadLeafs = append(report.DeadLeafs, leaf.ID)
+		countRestart(s.StemRepo, key)
+	}
+}
+
+// sweepServers unbinds the servers of a stem's backend that belong to no leaf of the stem or of the versions in
+// its traffic split. Proxies that can't list their servers are skipped.
+func (s *Sweeper) sweepServers(stem *models.Stem, stems []*models.Stem, suspects map[string]bool, report *models.SweepReport) {
+	lister, ok := s.ProxyClient.(proxy.ServerLister)
+	if !ok || stem.HAProxyBackend == "" || !proxied(stem.Config) {
+		return
+	}
+	servers, err := lister.Servers(stem.HAProxyBackend)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list servers of backend %s: %v", stem.HAProxyBackend, err))
+		return
+	}
+	known := make(map[string]bool, len(stem.LeafInstances)+1)
+	for _, leaf := range stem.LeafInstances {
+		known[leaf.HAProxyServer] = true
+	}
+	for _, leaf := range splitLeafs(stem, stems) {
+		known[leaf.HAProxyServer] = true
+	}
+	if stem.GraftNodeLeaf != nil {
+		known[stem.GraftNodeLeaf.HAProxyServer] = true
+	}
+	for _, server := range servers {
+		if known[server] {
+			continue
+		}
+		suspect := "server:" + stem.HAProxyBackend + "/" + server
+		if !s.suspects[suspect] {
+			suspects[suspect] = true
+			continue
+		}
+		if err := s.ProxyClient.UnbindLeaf(stem.HAProxyBackend, server); err != nil {
+			suspects[suspect] = true
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to unbind stale server %s from backend %s: %v", server, stem.HAProxyBackend, err))
+			continue
+		}
+		report.StaleServers = append(report.StaleServers, stem.HAProxyBackend+"/"+server)
+	}
+}
+
+// sweepPorts releases port reservations whose owner is no known leaf, reporting those still bound on the
+// host, whose process herbarium lost track of.
+func (s *Sweeper) sweepPorts(owners map[string]bool, suspects map[string]bool, report *models.SweepReport) {
+	for _, reservation := range s.ports.reservations() {
+		if owners[reservation.owner] {
+			continue
+		}
+		port := portKey(reservation.network, reservation.port)
+		suspect := "port:" + port + ":" + reservation.owner
+		if !s.suspects[suspect] {
+			suspects[suspect] = true
+			continue
+		}
+		s.ports.Release(reservation.network, reservation.port)
+		report.FreedPorts = append(report.FreedPorts, port)
+		if !portFree(reservation.network, reservation.port) {
+			report.HeldPorts = append(report.HeldPorts, port)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// listingProxyClient is a MockProxyClient that also lists the servers of its backends.
+type listingProxyClient struct {
+	*MockProxyClient
+	servers map[string][]string
+}
+
+func (c *listingProxyClient) Servers(backendName string) ([]string, error) {
+	return c.servers[backendName], nil
+}
+
+func TestSweeper_Sweep(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[key] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api"},
+		LeafInstances: map[string]*models.Leaf{
+			"alive":    {ID: "alive", PID: os.Getpid(), HAProxyServer: "alive", Port: 8001, Status: models.StatusRunning},
+			"dead":     {ID: "dead", PID: 1 << 30, HAProxyServer: "dead", Port: 8002, Status: models.StatusRunning},
+			"starting": {ID: "starting", HAProxyServer: "starting", Status: models.StatusStarting},
+		}}
+
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("StopLeaf", "api", "v1", "dead").Return(nil).Once().Run(func(mock.Arguments) {
+		delete(db.Stems[key].LeafInstances, "dead")
+	})
+	proxyClient := &listingProxyClient{MockProxyClient: new(MockProxyClient), servers: map[string][]string{"api": {"alive", "dead", "stale"}}}
+	proxyClient.On("UnbindLeaf", "api", "stale").Return(nil).Once()
+
+	// A port reserved for a known leaf, one for a lost leaf, and one for a lost leaf whose process still holds it
+	held, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer held.Close()
+	heldPort := held.Addr().(*net.TCPAddr).Port
+	ports := NewPortAllocator()
+	ports.reserved[portKey("tcp", 8001)] = "alive"
+	ports.reserved[portKey("tcp", 8009)] = "lost"
+	ports.reserved[portKey("tcp", heldPort)] = "lost-held"
+
+	sweeper := NewSweeper(repos.NewStemRepository(db), mockLeafManager, proxyClient)
+	sweeper.ports = ports
+	sweeper.Events = NewEventLog(0)
+
+	// The dead leaf is cleaned up right away, servers and ports only when the next sweep still finds them orphaned
+	report := sweeper.Sweep()
+	assert.Equal(t, []string{"dead"}, report.DeadLeafs)
+	assert.Empty(t, report.StaleServers)
+	assert.Empty(t, report.FreedPorts)
+	proxyClient.AssertNotCalled(t, "UnbindLeaf", "api", "stale")
+
+	proxyClient.servers["api"] = []string{"alive", "stale"}
+	report = sweeper.Sweep()
+	assert.Empty(t, report.DeadLeafs)
+	assert.Equal(t, []string{"api/stale"}, report.StaleServers)
+	assert.ElementsMatch(t, []string{"8009/tcp", portKey("tcp", heldPort)}, report.FreedPorts)
+	assert.Equal(t, []string{portKey("tcp", heldPort)}, report.HeldPorts)
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, []portReservation{{network: "tcp", port: 8001, owner: "alive"}}, ports.reservations())
+	mockLeafManager.AssertExpectations(t)
+	proxyClient.AssertExpectations(t)
+
+	events := sweeper.Events.List(EventQuery{})
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, models.EventOrphansReclaimed, events[1].Type)
+		assert.Contains(t, events[1].Message, "Reclaimed 0 dead leafs, 1 stale servers, and 2 ports")
+	}
+}
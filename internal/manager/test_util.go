@@ -1,7 +1,11 @@
 package manager
 
 import (
+	"io"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
 	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
 	"github.com/plantarium-platform/herbarium-go/pkg/models"
 	"github.com/stretchr/testify/mock"
 )
@@ -12,11 +16,29 @@ type MockStemManager struct {
 	mock.Mock
 }
 
-func (m *MockStemManager) RegisterStem(config models.StemConfig) error {
+func (m *MockStemManager) RegisterStem(config models.StemConfig, opts ...RegisterOptions) error {
+	if len(opts) > 0 {
+		return m.Called(config, opts[0]).Error(0)
+	}
 	args := m.Called(config)
 	return args.Error(0)
 }
 
+func (m *MockStemManager) UpdateStemConfig(key storage.StemKey, config models.StemConfig, opts UpdateOptions) error {
+	args := m.Called(key, config, opts)
+	return args.Error(0)
+}
+
+func (m *MockStemManager) Scale(key storage.StemKey, replicas int) error {
+	args := m.Called(key, replicas)
+	return args.Error(0)
+}
+
+func (m *MockStemManager) SetTrafficSplit(key storage.StemKey, split map[string]int) error {
+	args := m.Called(key, split)
+	return args.Error(0)
+}
+
 func (m *MockStemManager) UnregisterStem(key storage.StemKey) error {
 	args := m.Called(key)
 	return args.Error(0)
@@ -30,6 +52,78 @@ func (m *MockStemManager) FetchStemInfo(key storage.StemKey) (*models.Stem, erro
 	return nil, args.Error(1)
 }
 
+func (m *MockStemManager) ListStems(query repos.StemQuery) ([]*models.Stem, int, error) {
+	args := m.Called(query)
+	if stems, ok := args.Get(0).([]*models.Stem); ok {
+		return stems, args.Int(1), args.Error(2)
+	}
+	return nil, args.Int(1), args.Error(2)
+}
+
+func (m *MockStemManager) ReadSnapshot() *storage.StateView {
+	args := m.Called()
+	if view, ok := args.Get(0).(*storage.StateView); ok {
+		return view
+	}
+	return nil
+}
+
+func (m *MockStemManager) ExportStem(key storage.StemKey) (*StemDefinition, error) {
+	args := m.Called(key)
+	if definition, ok := args.Get(0).(*StemDefinition); ok {
+		return definition, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockStemManager) ImportStem(definition StemDefinition, opts ...RegisterOptions) error {
+	if len(opts) > 0 {
+		return m.Called(definition, opts[0]).Error(0)
+	}
+	args := m.Called(definition)
+	return args.Error(0)
+}
+
+func (m *MockStemManager) DeployStem(archive io.Reader, opts ...RegisterOptions) (storage.StemKey, error) {
+	if len(opts) > 0 {
+		args := m.Called(archive, opts[0])
+		return args.Get(0).(storage.StemKey), args.Error(1)
+	}
+	args := m.Called(archive)
+	return args.Get(0).(storage.StemKey), args.Error(1)
+}
+
+func (m *MockStemManager) DeployArtifact(reference models.ArtifactConfig, opts ...RegisterOptions) (storage.StemKey, error) {
+	if len(opts) > 0 {
+		args := m.Called(reference, opts[0])
+		return args.Get(0).(storage.StemKey), args.Error(1)
+	}
+	args := m.Called(reference)
+	return args.Get(0).(storage.StemKey), args.Error(1)
+}
+
+func (m *MockStemManager) StemVersions(name string) ([]*models.StemVersion, error) {
+	args := m.Called(name)
+	if history, ok := args.Get(0).([]*models.StemVersion); ok {
+		return history, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockStemManager) Rollback(name string, opts ...RegisterOptions) (storage.StemKey, error) {
+	if len(opts) > 0 {
+		args := m.Called(name, opts[0])
+		return args.Get(0).(storage.StemKey), args.Error(1)
+	}
+	args := m.Called(name)
+	return args.Get(0).(storage.StemKey), args.Error(1)
+}
+
+func (m *MockStemManager) SetMaintenance(key storage.StemKey, on bool) error {
+	args := m.Called(key, on)
+	return args.Error(0)
+}
+
 // MockLeafManager is a mock implementation of the LeafManagerInterface.
 type MockLeafManager struct {
 	mock.Mock
@@ -58,37 +152,151 @@ func (m *MockLeafManager) StartGraftNodeLeaf(stemName, version string) (string,
 	return args.String(0), args.Error(1)
 }
 
-// MockHAProxyClient is a mock implementation of HAProxyClientInterface.
-type MockHAProxyClient struct {
+func (m *MockLeafManager) PromoteStandbyLeaf(stemName, version string, replaceServer *string) (string, error) {
+	args := m.Called(stemName, version, replaceServer)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockLeafManager) StopGraftNodeLeaf(stemName, version string) error {
+	args := m.Called(stemName, version)
+	return args.Error(0)
+}
+
+func (m *MockLeafManager) RollLeaf(key storage.StemKey, leafID string) (string, error) {
+	args := m.Called(key, leafID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockLeafManager) FillWarmPool(stemName, version string) (int, error) {
+	args := m.Called(stemName, version)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockLeafManager) LeafResources(key storage.StemKey, leafID string) (*LeafResources, error) {
+	args := m.Called(key, leafID)
+	if resources, ok := args.Get(0).(*LeafResources); ok {
+		return resources, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockLeafManager) ListLeafs(key storage.StemKey, query repos.LeafQuery) ([]*models.Leaf, int, error) {
+	args := m.Called(key, query)
+	if leafs, ok := args.Get(0).([]*models.Leaf); ok {
+		return leafs, args.Int(1), args.Error(2)
+	}
+	return nil, args.Int(1), args.Error(2)
+}
+
+func (m *MockLeafManager) ReadLeafLogs(key storage.StemKey, leafID string, opts LogReadOptions) ([]byte, error) {
+	args := m.Called(key, leafID, opts)
+	if data, ok := args.Get(0).([]byte); ok {
+		return data, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// MockProxyClient is a mock implementation of proxy.ProxyClient.
+type MockProxyClient struct {
 	mock.Mock
 }
 
-// BindStem mocks the BindStem method in HAProxyClient.
-func (m *MockHAProxyClient) BindStem(backendName string) error {
-	args := m.Called(backendName)
+// BindStem mocks the BindStem method in ProxyClient.
+func (m *MockProxyClient) BindStem(backendName string, options proxy.BackendOptions) error {
+	args := m.Called(backendName, options)
 	return args.Error(0)
 }
 
-// BindLeaf mocks the BindLeaf method in HAProxyClient.
-func (m *MockHAProxyClient) BindLeaf(backendName, haProxyServer, serviceAddress string, servicePort int) error {
+// BindLeaf mocks the BindLeaf method in ProxyClient.
+func (m *MockProxyClient) BindLeaf(backendName, haProxyServer, serviceAddress string, servicePort int) error {
 	args := m.Called(backendName, haProxyServer, serviceAddress, servicePort)
 	return args.Error(0)
 }
 
-// UnbindLeaf mocks the UnbindLeaf method in HAProxyClient.
-func (m *MockHAProxyClient) UnbindLeaf(backendName, haProxyServer string) error {
+// UnbindLeaf mocks the UnbindLeaf method in ProxyClient.
+func (m *MockProxyClient) UnbindLeaf(backendName, haProxyServer string) error {
 	args := m.Called(backendName, haProxyServer)
 	return args.Error(0)
 }
 
-// ReplaceLeaf mocks the ReplaceLeaf method in HAProxyClient.
-func (m *MockHAProxyClient) ReplaceLeaf(backendName, oldHAProxyServer, newHAProxyServer, serviceAddress string, servicePort int) error {
+// ReplaceLeaf mocks the ReplaceLeaf method in ProxyClient.
+func (m *MockProxyClient) ReplaceLeaf(backendName, oldHAProxyServer, newHAProxyServer, serviceAddress string, servicePort int) error {
 	args := m.Called(backendName, oldHAProxyServer, newHAProxyServer, serviceAddress, servicePort)
 	return args.Error(0)
 }
 
-// UnbindStem mocks the UnbindStem method in HAProxyClient.
-func (m *MockHAProxyClient) UnbindStem(backendName string) error {
+// UnbindStem mocks the UnbindStem method in ProxyClient.
+func (m *MockProxyClient) UnbindStem(backendName string) error {
 	args := m.Called(backendName)
 	return args.Error(0)
 }
+
+// MockSnapshotManager is a mock implementation of the SnapshotManagerInterface.
+type MockSnapshotManager struct {
+	mock.Mock
+}
+
+func (m *MockSnapshotManager) CreateSnapshot() (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockSnapshotManager) ListSnapshots() ([]SnapshotInfo, error) {
+	args := m.Called()
+	if snapshots, ok := args.Get(0).([]SnapshotInfo); ok {
+		return snapshots, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSnapshotManager) RestoreSnapshot(name string) (*RestoreReport, error) {
+	args := m.Called(name)
+	if report, ok := args.Get(0).(*RestoreReport); ok {
+		return report, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// MockAgentClient is a mock implementation of the LeafRuntime.
+type MockAgentClient struct {
+	mock.Mock
+}
+
+func (m *MockAgentClient) Host() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func (m *MockAgentClient) StartLeaf(request AgentStartRequest) (*AgentLeaf, error) {
+	args := m.Called(request)
+	if leaf, ok := args.Get(0).(*AgentLeaf); ok {
+		return leaf, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockAgentClient) StopLeaf(leafID string) error {
+	args := m.Called(leafID)
+	return args.Error(0)
+}
+
+func (m *MockAgentClient) GetLeaf(leafID string) (*AgentLeaf, error) {
+	args := m.Called(leafID)
+	if leaf, ok := args.Get(0).(*AgentLeaf); ok {
+		return leaf, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockAgentClient) Ping() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockAgentClient) ReadLeafLogs(leafID string, opts LogReadOptions) ([]byte, error) {
+	args := m.Called(leafID, opts)
+	if data, ok := args.Get(0).([]byte); ok {
+		return data, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
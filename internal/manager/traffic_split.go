@@ -0,0 +1,231 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// maxServerWeight is the weight of the servers getting the largest share of a split backend's requests, the
+// highest HAProxy allows.
+const maxServerWeight = 256
+
+// ErrInvalidSplit is returned when a traffic split doesn't add up to 100 percent or names a version that
+// can't take requests.
+var ErrInvalidSplit = errors.New("invalid traffic split")
+
+// SetTrafficSplit shares the requests to a stem's backend between versions of the stem, for canary releases
+// and A/B tests: split maps versions to the percent of the requests they get, adding up to 100, and the stem's
+// own version gets none when it is left out. The running leafs of the other versions are bound to the backend
+// alongside the stem's own, and the weights of all of them are set so each version gets its share spread
+// evenly across its leafs; nothing is registered again. Versions dropped from an earlier split are unbound
+// from the backend. The split applies to the leafs running when it is set, so set it again after scaling a
+// version in it.
+func (s *StemManager) SetTrafficSplit(key storage.StemKey, split map[string]int) error {
+	setter, ok := s.ProxyClient.(proxy.WeightSetter)
+	if !ok {
+		return fmt.Errorf("the proxy does not support setting server weights")
+	}
+	stem, err := s.StemRepo.FetchStem(key)
+	if err != nil {
+		return fmt.Errorf("failed to fetch stem %s version %s: %v", key.Name, key.Version, err)
+	}
+	if stem.HAProxyBackend == "" || !proxied(stem.Config) || stem.Config.Shadow {
+		return fmt.Errorf("%w: stem %s version %s has no routed backend", ErrInvalidSplit, key.Name, key.Version)
+	}
+	if err := checkSplit(split); err != nil {
+		return err
+	}
+
+	leafs := map[string][]*models.Leaf{key.Version: runningLeafs(stem)}
+	for _, version := range sortedVersions(split) {
+		if version == key.Version {
+			continue
+		}
+		other, err := s.StemRepo.FetchStem(storage.StemKey{Name: key.Name, Version: version})
+		if err != nil {
+			return fmt.Errorf("%w: version %s of stem %s is not registered", ErrInvalidSplit, version, key.Name)
+		}
+		if !proxied(other.Config) {
+			return fmt.Errorf("%w: version %s of stem %s is not proxied", ErrInvalidSplit, version, key.Name)
+		}
+		leafs[version] = runningLeafs(other)
+	}
+	for _, version := range sortedVersions(split) {
+		if split[version] > 0 && len(leafs[version]) == 0 {
+			return fmt.Errorf("%w: version %s of stem %s has no running leafs", ErrInvalidSplit, version, key.Name)
+		}
+	}
+
+	// A split giving the stem's own version every request is no split
+	var recorded map[string]int
+	if split[key.Version] != 100 {
+		recorded = make(map[string]int, len(split))
+		for version, percent := range split {
+			recorded[version] = percent
+		}
+	}
+	_, err = s.StemRepo.CompareAndSwapStem(key, stem.Revision, func(stem *models.Stem) error {
+		stem.TrafficSplit = recorded
+		return nil
+	})
+	if errors.Is(err, repos.ErrConflict) {
+		return fmt.Errorf("stem %s version %s changed while its traffic was being split: %w", key.Name, key.Version, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record traffic split of stem %s version %s: %v", key.Name, key.Version, err)
+	}
+
+	if err := s.bindSplitLeafs(stem, split, leafs); err != nil {
+		return err
+	}
+	if err := setter.SetServerWeights(stem.HAProxyBackend, splitWeights(split, leafs)); err != nil {
+		return fmt.Errorf("failed to set server weights of backend %s: %v", stem.HAProxyBackend, err)
+	}
+
+	shares := make([]string, 0, len(split))
+	for _, version := range sortedVersions(split) {
+		shares = append(shares, fmt.Sprintf("%s %d%%", version, split[version]))
+	}
+	s.Events.Record(models.Event{
+		Type:    models.EventTrafficSplit,
+		Stem:    key.Name,
+		Version: key.Version,
+		Message: fmt.Sprintf("Requests to stem %s version %s were split as %s", key.Name, key.Version, strings.Join(shares, ", ")),
+	})
+	return nil
+}
+
+// bindSplitLeafs binds the running leafs of the other versions in a split to the stem's backend, skipping those
+// already bound when the proxy lists its servers, and unbinds the leafs of versions an earlier split had.
+func (s *StemManager) bindSplitLeafs(stem *models.Stem, split map[string]int, leafs map[string][]*models.Leaf) error {
+	bound := make(map[string]bool)
+	if lister, ok := s.ProxyClient.(proxy.ServerLister); ok {
+		servers, err := lister.Servers(stem.HAProxyBackend)
+		if err != nil {
+			return fmt.Errorf("failed to list servers of backend %s: %v", stem.HAProxyBackend, err)
+		}
+		for _, server := range servers {
+			bound[server] = true
+		}
+	}
+	for _, version := range sortedVersions(split) {
+		if version == stem.Version {
+			continue
+		}
+		for _, leaf := range leafs[version] {
+			if bound[leaf.HAProxyServer] {
+				continue
+			}
+			if err := s.ProxyClient.BindLeaf(stem.HAProxyBackend, leaf.HAProxyServer, leafHost(leaf), leaf.Port); err != nil {
+				return fmt.Errorf("failed to bind leaf %s of version %s to backend %s: %v", leaf.ID, version, stem.HAProxyBackend, err)
+			}
+		}
+	}
+
+	for _, version := range sortedVersions(stem.TrafficSplit) {
+		if _, ok := split[version]; ok || version == stem.Version {
+			continue
+		}
+		dropped, err := s.StemRepo.FetchStem(storage.StemKey{Name: stem.Name, Version: version})
+		if err != nil {
+			continue // Its leafs stopped with it, the sweeper unbinds what is left
+		}
+		for _, leaf := range runningLeafs(dropped) {
+			if !bound[leaf.HAProxyServer] {
+				continue
+			}
+			if err := s.ProxyClient.UnbindLeaf(stem.HAProxyBackend, leaf.HAProxyServer); err != nil {
+				log.Printf("Failed to unbind leaf %s of version %s dropped from the traffic split of backend %s: %v",
+					leaf.ID, version, stem.HAProxyBackend, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkSplit checks that a traffic split gives every version a percent between 0 and 100, adding up to 100.
+func checkSplit(split map[string]int) error {
+	total := 0
+	for version, percent := range split {
+		if version == "" {
+			return fmt.Errorf("%w: versions must not be empty", ErrInvalidSplit)
+		}
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("%w: percent of version %s must be between 0 and 100, got %d", ErrInvalidSplit, version, percent)
+		}
+		total += percent
+	}
+	if total != 100 {
+		return fmt.Errorf("%w: percents must add up to 100, got %d", ErrInvalidSplit, total)
+	}
+	return nil
+}
+
+// splitWeights returns the weight of every leaf in a split: each version's percent is spread evenly across its
+// leafs, and the weights are scaled so the leafs getting the largest share have maxServerWeight. Leafs of
+// versions with a share keep a weight of at least 1, those of versions without one get 0 and no requests.
+func splitWeights(split map[string]int, leafs map[string][]*models.Leaf) map[string]int {
+	largest := 0.0
+	for version, percent := range split {
+		if len(leafs[version]) > 0 {
+			largest = math.Max(largest, float64(percent)/float64(len(leafs[version])))
+		}
+	}
+	weights := make(map[string]int)
+	for version, versionLeafs := range leafs {
+		weight := 0
+		if percent := split[version]; percent > 0 {
+			share := float64(percent) / float64(len(versionLeafs))
+			weight = max(1, int(math.Round(share/largest*maxServerWeight)))
+		}
+		for _, leaf := range versionLeafs {
+			weights[leaf.HAProxyServer] = weight
+		}
+	}
+	return weights
+}
+
+// splitLeafs returns the leafs of the other versions in a stem's traffic split, which are bound to its backend
+// alongside its own.
+func splitLeafs(stem *models.Stem, stems []*models.Stem) []*models.Leaf {
+	var leafs []*models.Leaf
+	for _, other := range stems {
+		if other.Name != stem.Name || other.Version == stem.Version {
+			continue
+		}
+		if _, ok := stem.TrafficSplit[other.Version]; ok {
+			leafs = append(leafs, sortedLeafs(other)...)
+		}
+	}
+	return leafs
+}
+
+// runningLeafs returns the running leafs of a stem ordered by ID.
+func runningLeafs(stem *models.Stem) []*models.Leaf {
+	var running []*models.Leaf
+	for _, leaf := range sortedLeafs(stem) {
+		if leaf.Status == models.StatusRunning {
+			running = append(running, leaf)
+		}
+	}
+	return running
+}
+
+// sortedVersions returns the versions of a traffic split in order.
+func sortedVersions(split map[string]int) []string {
+	versions := make([]string, 0, len(split))
+	for version := range split {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// weightingProxyClient is a MockProxyClient that also lists servers and records the weights set on them.
+type weightingProxyClient struct {
+	*MockProxyClient
+	servers map[string][]string
+	weights map[string]int
+}
+
+func (c *weightingProxyClient) Servers(backendName string) ([]string, error) {
+	return c.servers[backendName], nil
+}
+
+func (c *weightingProxyClient) SetServerWeights(backendName string, weights map[string]int) error {
+	c.weights = weights
+	return nil
+}
+
+func TestStemManager_SetTrafficSplit(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	v1 := storage.StemKey{Name: "api", Version: "v1"}
+	db.Stems[v1] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api-v1",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api"},
+		LeafInstances: map[string]*models.Leaf{
+			"api-v1-1": {ID: "api-v1-1", HAProxyServer: "api-v1-1", Port: 8001, Status: models.StatusRunning},
+			"api-v1-2": {ID: "api-v1-2", HAProxyServer: "api-v1-2", Port: 8002, Status: models.StatusRunning},
+		}}
+	v2 := storage.StemKey{Name: "api", Version: "v2"}
+	db.Stems[v2] = &models.Stem{Name: "api", Version: "v2", HAProxyBackend: "api-v2",
+		Config: &models.StemConfig{Name: "api", Version: "v2", URL: "/api"},
+		LeafInstances: map[string]*models.Leaf{
+			"api-v2-1": {ID: "api-v2-1", HAProxyServer: "api-v2-1", Port: 8003, Status: models.StatusRunning},
+			"api-v2-2": {ID: "api-v2-2", HAProxyServer: "api-v2-2", Port: 8004, Status: models.StatusStandby},
+		}}
+	v3 := storage.StemKey{Name: "api", Version: "v3"}
+	db.Stems[v3] = &models.Stem{Name: "api", Version: "v3", HAProxyBackend: "api-v3",
+		Config: &models.StemConfig{Name: "api", Version: "v3", URL: "/api"}}
+
+	proxyClient := &weightingProxyClient{MockProxyClient: new(MockProxyClient),
+		servers: map[string][]string{"api-v1": {"api-v1-1", "api-v1-2"}}}
+	proxyClient.On("BindLeaf", "api-v1", "api-v2-1", "localhost", 8003).Return(nil).Once()
+	stemManager := NewStemManager(repos.NewStemRepository(db), new(MockLeafManager), proxyClient)
+	stemManager.Events = NewEventLog(0)
+
+	// The canary's running leaf joins the backend, each version's share spread across its leafs
+	assert.NoError(t, stemManager.SetTrafficSplit(v1, map[string]int{"v1": 90, "v2": 10}))
+	proxyClient.AssertExpectations(t)
+	assert.Equal(t, map[string]int{"api-v1-1": 256, "api-v1-2": 256, "api-v2-1": 57}, proxyClient.weights)
+	assert.Equal(t, map[string]int{"v1": 90, "v2": 10}, db.Stems[v1].TrafficSplit)
+	events := stemManager.Events.List(EventQuery{})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, models.EventTrafficSplit, events[0].Type)
+		assert.Equal(t, "Requests to stem api version v1 were split as v1 90%, v2 10%", events[0].Message)
+	}
+
+	// Leaving out the stem's own version sends it nothing
+	proxyClient.servers["api-v1"] = []string{"api-v1-1", "api-v1-2", "api-v2-1"}
+	assert.NoError(t, stemManager.SetTrafficSplit(v1, map[string]int{"v2": 100}))
+	assert.Equal(t, map[string]int{"api-v1-1": 0, "api-v1-2": 0, "api-v2-1": 256}, proxyClient.weights)
+
+	// Going back to the stem's own version unbinds the other one and clears the split
+	proxyClient.On("UnbindLeaf", "api-v1", "api-v2-1").Return(nil).Once()
+	assert.NoError(t, stemManager.SetTrafficSplit(v1, map[string]int{"v1": 100}))
+	proxyClient.AssertExpectations(t)
+	assert.Equal(t, map[string]int{"api-v1-1": 256, "api-v1-2": 256}, proxyClient.weights)
+	assert.Nil(t, db.Stems[v1].TrafficSplit)
+
+	// Splits that don't add up, name unknown versions, or give a share to a version without leafs are refused
+	assert.ErrorIs(t, stemManager.SetTrafficSplit(v1, map[string]int{"v1": 90, "v2": 20}), ErrInvalidSplit)
+	assert.ErrorIs(t, stemManager.SetTrafficSplit(v1, map[string]int{"v1": 110, "v2": -10}), ErrInvalidSplit)
+	assert.ErrorIs(t, stemManager.SetTrafficSplit(v1, map[string]int{"v1": 50, "v9": 50}), ErrInvalidSplit)
+	assert.ErrorIs(t, stemManager.SetTrafficSplit(v1, map[string]int{"v1": 50, "v3": 50}), ErrInvalidSplit)
+	assert.NoError(t, stemManager.SetTrafficSplit(v1, map[string]int{"v1": 100, "v3": 0}))
+}
+
+func TestSweeper_KeepsTrafficSplitServers(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	db.Stems[storage.StemKey{Name: "api", Version: "v1"}] = &models.Stem{Name: "api", Version: "v1", HAProxyBackend: "api-v1",
+		Config: &models.StemConfig{Name: "api", Version: "v1", URL: "/api"}, TrafficSplit: map[string]int{"v1": 50, "v2": 50}}
+	db.Stems[storage.StemKey{Name: "api", Version: "v2"}] = &models.Stem{Name: "api", Version: "v2", HAProxyBackend: "api-v2",
+		Config:        &models.StemConfig{Name: "api", Version: "v2", URL: "/api"},
+		LeafInstances: map[string]*models.Leaf{"api-v2-1": {ID: "api-v2-1", HAProxyServer: "api-v2-1", Agent: "remote", Status: models.StatusRunning}}}
+
+	proxyClient := &weightingProxyClient{MockProxyClient: new(MockProxyClient),
+		servers: map[string][]string{"api-v1": {"api-v2-1", "gone"}, "api-v2": {"api-v2-1"}}}
+	proxyClient.On("UnbindLeaf", "api-v1", "gone").Return(nil).Once()
+	sweeper := NewSweeper(repos.NewStemRepository(db), new(MockLeafManager), proxyClient)
+	sweeper.ports = NewPortAllocator()
+
+	// Only the server of no leaf is unbound, on the second sweep finding it
+	sweeper.Sweep()
+	report := sweeper.Sweep()
+	assert.Equal(t, []string{"api-v1/gone"}, report.StaleServers)
+	proxyClient.AssertExpectations(t)
+}
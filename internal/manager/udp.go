@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"encoding/hex"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// UDP routing modes of a stem.
+const (
+	UDPRoutingDirect = "direct" // Clients reach leafs on their own ports, the proxy is not involved
+	UDPRoutingProxy  = "proxy"  // The proxy publishes the stem on udp.port and forwards to the leafs
+)
+
+// udpProbeTimeout bounds the wait for a reply to a UDP readiness probe.
+const udpProbeTimeout = 500 * time.Millisecond
+
+// maxUDPReplySize fits any reply to a readiness probe.
+const maxUDPReplySize = 65535
+
+// isUDPStem reports whether a stem's leafs serve UDP.
+func isUDPStem(config *models.StemConfig) bool {
+	return config != nil && config.Transport == proxy.TransportUDP
+}
+
+// proxied reports whether a stem's leafs are bound to the proxy. UDP stems with direct routing are not.
+func proxied(config *models.StemConfig) bool {
+	if !isUDPStem(config) {
+		return true
+	}
+	return config.UDP != nil && config.UDP.Routing == UDPRoutingProxy
+}
+
+// leafNetwork returns the network a stem's leafs listen on.
+func leafNetwork(config *models.StemConfig) string {
+	if isUDPStem(config) {
+		return "udp"
+	}
+	return "tcp"
+}
+
+// allocateLeafPort reserves the port a new leaf listens on, from the stem's port range if it has one. Leafs
+// of direct UDP stems with a fixed port always get that port, so a second leaf on the same host fails with
+// the conflicting owner named.
+func allocateLeafPort(config *models.StemConfig, leafID string) (int, error) {
+	network := leafNetwork(config)
+	if isUDPStem(config) && !proxied(config) && config.UDP != nil && config.UDP.Port > 0 {
+		if err := leafPorts.Reserve(network, config.UDP.Port, leafID); err != nil {
+			return 0, err
+		}
+		return config.UDP.Port, nil
+	}
+	first, last, err := leafPortRange(config)
+	if err != nil {
+		return 0, err
+	}
+	return leafPorts.AllocateRange(network, first, last, leafID)
+}
+
+// releaseLeafPort frees the port of a leaf that stopped or failed to start.
+func releaseLeafPort(config *models.StemConfig, port int) {
+	leafPorts.Release(leafNetwork(config), port)
+}
+
+// readinessCheck returns how a leaf listening on a port is detected as ready when no start message appears.
+// Leafs of dual-stack stems must be ready on both loopback addresses.
+func readinessCheck(config *models.StemConfig) func(port int) bool {
+	hosts := readinessHosts(config)
+	if !isUDPStem(config) {
+		prober := proberOf(config)
+		return func(port int) bool {
+			return readyAt(hosts, func(host string) bool { return prober.Probe(host, port) == nil })
+		}
+	}
+	// Datagrams don't fall back to another address the way connections do, so localhost means IPv4
+	if len(hosts) == 1 && hosts[0] == "localhost" {
+		hosts = []string{"127.0.0.1"}
+	}
+	var probe []byte
+	if config.UDP != nil && config.UDP.Probe != "" {
+		decoded, err := hex.DecodeString(config.UDP.Probe)
+		if err != nil {
+			log.Printf("Ignoring invalid udp.probe of stem %s: %v", config.Name, err)
+		} else {
+			probe = decoded
+		}
+	}
+	return func(port int) bool {
+		return readyAt(hosts, func(host string) bool { return udpReady(host, port, probe) })
+	}
+}
+
+// udpReady sends probe to a leaf and reports whether it replied. Without a probe, the leaf is ready once
+// it has bound the port.
+func udpReady(host string, port int, probe []byte) bool {
+	if len(probe) == 0 {
+		return !portFree("udp", port)
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(udpProbeTimeout)); err != nil {
+		return false
+	}
+	if _, err := conn.Write(probe); err != nil {
+		return false
+	}
+	_, err = conn.Read(make([]byte, maxUDPReplySize))
+	return err == nil
+}
@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"encoding/hex"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortAllocator(t *testing.T) {
+	allocator := NewPortAllocator()
+
+	first, err := allocator.Allocate("udp", 20000, "leaf-1")
+	assert.NoError(t, err)
+	second, err := allocator.Allocate("udp", 20000, "leaf-2")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second, "reserved ports are not handed out twice")
+
+	assert.EqualError(t, allocator.Reserve("udp", first, "leaf-3"), "port "+portKey("udp", first)+" is already reserved by leaf-1")
+	allocator.Release("udp", first)
+	assert.NoError(t, allocator.Reserve("udp", first, "leaf-3"))
+
+	// Ports bound outside the allocator are detected on the host
+	conn, err := net.ListenPacket("udp", ":0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	bound := conn.LocalAddr().(*net.UDPAddr).Port
+	assert.ErrorContains(t, allocator.Reserve("udp", bound, "leaf-4"), "already in use")
+}
+
+func TestAllocateLeafPort_PortRange(t *testing.T) {
+	config := &models.StemConfig{Name: "billing", PortRange: "21000-21001"}
+	first, err := allocateLeafPort(config, "billing-1")
+	assert.NoError(t, err)
+	defer releaseLeafPort(config, first)
+	second, err := allocateLeafPort(config, "billing-2")
+	assert.NoError(t, err)
+	defer releaseLeafPort(config, second)
+	assert.ElementsMatch(t, []int{21000, 21001}, []int{first, second})
+
+	// The range is exhausted
+	_, err = allocateLeafPort(config, "billing-3")
+	assert.EqualError(t, err, "no available tcp ports in range 21000-21001")
+
+	for value, expected := range map[string][2]int{"9000-9010": {9000, 9010}, "9000": {9000, 9000}, " 80 - 81 ": {80, 81}} {
+		first, last, err := parsePortRange(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, [2]int{first, last}, value)
+	}
+	for _, value := range []string{"", "9010-9000", "0-10", "9000-70000", "ports"} {
+		_, _, err := parsePortRange(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestUDPReady(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, client, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], client)
+		}
+	}()
+
+	probe, _ := hex.DecodeString("70696e67")
+	assert.True(t, udpReady("127.0.0.1", port, nil), "a bound port is ready without a probe")
+	assert.True(t, udpReady("127.0.0.1", port, probe), "an answered probe is ready")
+
+	conn.Close()
+	assert.False(t, udpReady("127.0.0.1", port, nil))
+	assert.False(t, udpReady("127.0.0.1", port, probe))
+}
+
+func TestReadinessCheck_IPFamily(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	assert.True(t, readinessCheck(&models.StemConfig{IPFamily: IPFamilyIPv4})(port))
+	assert.False(t, readinessCheck(&models.StemConfig{IPFamily: IPFamilyIPv6})(port), "an IPv4 listener is not reachable over IPv6")
+	assert.False(t, readinessCheck(&models.StemConfig{IPFamily: IPFamilyDual})(port), "dual-stack leafs must listen on both families")
+
+	listener6, err := net.Listen("tcp", net.JoinHostPort("::1", strconv.Itoa(port)))
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer listener6.Close()
+	assert.True(t, readinessCheck(&models.StemConfig{IPFamily: IPFamilyIPv6})(port))
+	assert.True(t, readinessCheck(&models.StemConfig{IPFamily: IPFamilyDual})(port))
+}
+
+func TestStemManager_RegisterStem_DirectUDP(t *testing.T) {
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	stemRepo := repos.NewStemRepository(herbariumDB)
+
+	// Neither the proxy nor a graft node is involved for directly routed UDP stems
+	mockHAProxyClient := new(MockProxyClient)
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("ListLeafs", storage.StemKey{Name: "dns", Version: "1.0.0"}, repos.LeafQuery{}).Return(nil, 0, nil)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, mockHAProxyClient)
+
+	config := models.StemConfig{
+		Name:      "dns",
+		URL:       "/dns",
+		Command:   "./dns --port {{.PORT}}",
+		Version:   "1.0.0",
+		Transport: "udp",
+		UDP:       &models.UDPConfig{Port: 5353},
+	}
+	assert.NoError(t, stemManager.RegisterStem(config))
+	assert.NoError(t, stemManager.UnregisterStem(storage.StemKey{Name: "dns", Version: "1.0.0"}))
+	mockHAProxyClient.AssertNotCalled(t, "BindStem")
+	mockHAProxyClient.AssertNotCalled(t, "UnbindStem")
+	mockLeafManager.AssertNotCalled(t, "StartGraftNodeLeaf")
+	mockLeafManager.AssertNotCalled(t, "StopGraftNodeLeaf")
+}
@@ -0,0 +1,218 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Headers of the Vault HTTP API.
+const (
+	VaultTokenHeader     = "X-Vault-Token"
+	VaultNamespaceHeader = "X-Vault-Namespace"
+)
+
+// vaultTimeout bounds every request to Vault.
+const vaultTimeout = 10 * time.Second
+
+// VaultConfig is how herbarium reaches and authenticates to Vault, either with a token or an AppRole.
+type VaultConfig struct {
+	Address      string // Vault URL, e.g. https://vault.internal:8200
+	Namespace    string // Vault Enterprise namespace, empty for the root namespace
+	Token        string // Token used as is
+	RoleID       string // Role ID of the AppRole logged in with when there is no token
+	SecretID     string // Secret ID of the AppRole
+	AppRoleMount string // Path the AppRole auth method is mounted at, defaults to approle
+}
+
+// VaultClient reads secrets from Vault's HTTP API. Tokens of an AppRole login are renewed while they can be,
+// and the client logs in again when they can't or are rejected.
+type VaultClient struct {
+	client *resty.Client
+	config VaultConfig
+
+	mu        sync.Mutex
+	token     string
+	expires   time.Time // When the AppRole token is due for renewal, zero for tokens that don't expire
+	renewable bool      // Whether the AppRole token can be renewed
+}
+
+// vaultResponse is the envelope of Vault's responses to reads, renewals, and logins.
+type vaultResponse struct {
+	LeaseID       string         `json:"lease_id"`
+	LeaseDuration int            `json:"lease_duration"`
+	Renewable     bool           `json:"renewable"`
+	Data          map[string]any `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// NewVaultClient creates a client for the Vault at config.Address, authenticating with config.Token or, without
+// one, the AppRole of config.RoleID and config.SecretID.
+func NewVaultClient(config VaultConfig) (*VaultClient, error) {
+	parsed, err := url.Parse(config.Address)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid Vault address %q", config.Address)
+	}
+	if config.Token == "" && (config.RoleID == "" || config.SecretID == "") {
+		return nil, fmt.Errorf("vault needs a token or the role_id and secret_id of an AppRole")
+	}
+	if config.AppRoleMount == "" {
+		config.AppRoleMount = "approle"
+	}
+
+	client := resty.New()
+	client.SetBaseURL(strings.TrimSuffix(config.Address, "/"))
+	if config.Namespace != "" {
+		client.SetHeader(VaultNamespaceHeader, config.Namespace)
+	}
+	client.SetTimeout(vaultTimeout)
+	client.SetDisableWarn(true)
+
+	return &VaultClient{client: client, config: config, token: config.Token}, nil
+}
+
+// NewVaultClientFromConfig creates the Vault client configured by secrets.vault, nil when no address is set.
+func NewVaultClientFromConfig(config *models.GlobalConfig) (*VaultClient, error) {
+	vault := config.Secrets.Vault
+	if vault.Address == "" {
+		return nil, nil
+	}
+	return NewVaultClient(VaultConfig{
+		Address:      vault.Address,
+		Namespace:    vault.Namespace,
+		Token:        vault.Token,
+		RoleID:       vault.AppRole.RoleID,
+		SecretID:     vault.AppRole.SecretID,
+		AppRoleMount: vault.AppRole.Mount,
+	})
+}
+
+// ReadSecret reads the secret at path, such as secret/data/billing of a KV version 2 engine or
+// database/creds/billing of a dynamic one. Values that aren't strings are formatted.
+func (v *VaultClient) ReadSecret(path string) (*Secret, error) {
+	var body vaultResponse
+	if err := v.do(http.MethodGet, "/v1/"+strings.Trim(path, "/"), nil, &body); err != nil {
+		return nil, err
+	}
+
+	secret := &Secret{
+		Data:          make(map[string]string),
+		LeaseID:       body.LeaseID,
+		LeaseDuration: time.Duration(body.LeaseDuration) * time.Second,
+		Renewable:     body.Renewable,
+	}
+	data := body.Data
+	// KV version 2 nests the values beneath the version's metadata
+	if nested, ok := data["data"].(map[string]any); ok {
+		if metadata, ok := data["metadata"].(map[string]any); ok {
+			data = nested
+			if version, ok := metadata["version"].(float64); ok {
+				secret.Version = int(version)
+			}
+		}
+	}
+	for key, value := range data {
+		if text, ok := value.(string); ok {
+			secret.Data[key] = text
+		} else {
+			secret.Data[key] = fmt.Sprint(value)
+		}
+	}
+	return secret, nil
+}
+
+// RenewLease extends the lease of a dynamic secret by increment and returns the duration Vault granted, which is
+// shorter once the lease nears its maximum TTL.
+func (v *VaultClient) RenewLease(leaseID string, increment time.Duration) (time.Duration, error) {
+	var body vaultResponse
+	request := map[string]any{"lease_id": leaseID, "increment": int(increment / time.Second)}
+	if err := v.do(http.MethodPut, "/v1/sys/leases/renew", request, &body); err != nil {
+		return 0, err
+	}
+	return time.Duration(body.LeaseDuration) * time.Second, nil
+}
+
+// do sends a request to Vault with a valid token, logging in again once when an AppRole token is rejected.
+func (v *VaultClient) do(method, path string, body, result any) error {
+	for attempt := 0; ; attempt++ {
+		token, err := v.currentToken()
+		if err != nil {
+			return err
+		}
+		request := v.client.R().SetHeader(VaultTokenHeader, token).SetResult(result)
+		if body != nil {
+			request.SetBody(body)
+		}
+		resp, err := request.Execute(method, path)
+		if err != nil {
+			return fmt.Errorf("failed to reach Vault: %v", err)
+		}
+		if resp.StatusCode() == http.StatusForbidden && v.config.Token == "" && attempt == 0 {
+			v.mu.Lock()
+			v.token = "" // Revoked or expired early, log in again
+			v.mu.Unlock()
+			continue
+		}
+		if !resp.IsSuccess() {
+			return fmt.Errorf("vault answered %s %s with status %d: %s", method, path, resp.StatusCode(), strings.TrimSpace(resp.String()))
+		}
+		return nil
+	}
+}
+
+// currentToken returns the token to send. AppRole tokens past two thirds of their TTL are renewed when they can
+// be, and replaced by logging in again otherwise.
+func (v *VaultClient) currentToken() (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.config.Token != "" {
+		return v.token, nil
+	}
+
+	now := time.Now()
+	if v.token != "" && (v.expires.IsZero() || now.Before(v.expires)) {
+		return v.token, nil
+	}
+	if v.token != "" && v.renewable {
+		var body vaultResponse
+		resp, err := v.client.R().SetHeader(VaultTokenHeader, v.token).SetResult(&body).Post("/v1/auth/token/renew-self")
+		if err == nil && resp.IsSuccess() && body.Auth != nil && body.Auth.LeaseDuration > 0 {
+			v.setToken(body.Auth.ClientToken, body.Auth.LeaseDuration, body.Auth.Renewable, now)
+			return v.token, nil
+		}
+	}
+
+	var body vaultResponse
+	login := map[string]string{"role_id": v.config.RoleID, "secret_id": v.config.SecretID}
+	resp, err := v.client.R().SetBody(login).SetResult(&body).Post("/v1/auth/" + strings.Trim(v.config.AppRoleMount, "/") + "/login")
+	if err != nil {
+		return "", fmt.Errorf("failed to reach Vault: %v", err)
+	}
+	if !resp.IsSuccess() || body.Auth == nil || body.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault AppRole login failed with status %d: %s", resp.StatusCode(), strings.TrimSpace(resp.String()))
+	}
+	v.setToken(body.Auth.ClientToken, body.Auth.LeaseDuration, body.Auth.Renewable, now)
+	return v.token, nil
+}
+
+// setToken keeps an AppRole token valid for ttl seconds from now, renewed once two thirds of it passed.
+func (v *VaultClient) setToken(token string, ttl int, renewable bool, now time.Time) {
+	if token != "" {
+		v.token = token
+	}
+	v.renewable = renewable
+	v.expires = time.Time{}
+	if ttl > 0 {
+		v.expires = now.Add(time.Duration(ttl) * time.Second * 2 / 3)
+	}
+}
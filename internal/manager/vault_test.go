@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultClient_Token(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		assert.Equal(t, "root-token", r.Header.Get(VaultTokenHeader))
+		assert.Equal(t, "team-a", r.Header.Get(VaultNamespaceHeader))
+		switch r.URL.Path {
+		case "/v1/secret/data/api":
+			w.Write([]byte(`{"data": {"data": {"password": "hunter2", "port": 5432}, "metadata": {"version": 3}}}`))
+		case "/v1/sys/leases/renew":
+			var body map[string]any
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "database/creds/api/1", body["lease_id"])
+			assert.Equal(t, float64(3600), body["increment"])
+			w.Write([]byte(`{"lease_id": "database/creds/api/1", "lease_duration": 1800, "renewable": true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+	defer server.Close()
+
+	vault, err := NewVaultClient(VaultConfig{Address: server.URL, Namespace: "team-a", Token: "root-token"})
+	assert.NoError(t, err)
+
+	secret, err := vault.ReadSecret("/secret/data/api")
+	assert.NoError(t, err)
+	assert.Equal(t, &Secret{Data: map[string]string{"password": "hunter2", "port": "5432"}, Version: 3}, secret)
+
+	duration, err := vault.RenewLease("database/creds/api/1", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, duration)
+
+	_, err = vault.ReadSecret("secret/data/missing")
+	assert.ErrorContains(t, err, "status 404")
+}
+
+func TestVaultClient_AppRole(t *testing.T) {
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/auth/ci/login":
+			var body map[string]string
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, map[string]string{"role_id": "role", "secret_id": "secret"}, body)
+			logins++
+			fmt.Fprintf(w, `{"auth": {"client_token": "token-%d", "lease_duration": 3600, "renewable": true}}`, logins)
+		case "/v1/database/creds/api":
+			if r.Header.Get(VaultTokenHeader) == "token-1" {
+				w.WriteHeader(http.StatusForbidden) // Revoked after the first read
+				return
+			}
+			w.Write([]byte(`{"lease_id": "database/creds/api/2", "lease_duration": 600, "renewable": true,
+				"data": {"username": "v-api", "password": "pw"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	_, err := NewVaultClient(VaultConfig{Address: server.URL, RoleID: "role"})
+	assert.ErrorContains(t, err, "needs a token or the role_id and secret_id")
+
+	vault, err := NewVaultClient(VaultConfig{Address: server.URL, RoleID: "role", SecretID: "secret", AppRoleMount: "ci"})
+	assert.NoError(t, err)
+
+	// The rejected token is replaced by logging in again
+	secret, err := vault.ReadSecret("database/creds/api")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, logins)
+	assert.Equal(t, &Secret{Data: map[string]string{"username": "v-api", "password": "pw"},
+		LeaseID: "database/creds/api/2", LeaseDuration: 10 * time.Minute, Renewable: true}, secret)
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+// VersionMetadataFile is the file in a working directory recording the build and deployment of the version
+// in it, including the artifact unpacked into it, so they survive restarts.
+const VersionMetadataFile = ".herbarium-version"
+
+// OCI annotations an artifact's build is read from, as set by docker buildx, oras, and most CI templates.
+const (
+	ociRevisionAnnotation = "org.opencontainers.image.revision"
+	ociCreatedAnnotation  = "org.opencontainers.image.created"
+)
+
+// readVersionMetadata returns the metadata recorded in dir, empty if none was.
+func readVersionMetadata(dir string) models.VersionMetadata {
+	var metadata models.VersionMetadata
+	data, err := os.ReadFile(filepath.Join(dir, VersionMetadataFile))
+	if err != nil {
+		return metadata
+	}
+	if err := yaml.Unmarshal(data, &metadata); err != nil {
+		log.Printf("Ignoring unreadable %s in %s: %v", VersionMetadataFile, dir, err)
+		return models.VersionMetadata{}
+	}
+	return metadata
+}
+
+// writeVersionMetadata records metadata in dir.
+func writeVersionMetadata(dir string, metadata models.VersionMetadata) error {
+	data, err := yaml.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, VersionMetadataFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to record version metadata: %v", err)
+	}
+	return nil
+}
+
+// artifactMetadata describes the build of a fetched artifact, with its digest once verified.
+func artifactMetadata(artifact *Artifact, verified bool) models.VersionMetadata {
+	metadata := models.VersionMetadata{Artifact: artifact.URL, GitCommit: artifact.Annotations[ociRevisionAnnotation]}
+	if verified {
+		metadata.ArtifactDigest = artifact.Digest
+	}
+	if created, err := time.Parse(time.RFC3339, artifact.Annotations[ociCreatedAnnotation]); err == nil {
+		metadata.BuildTime = created.UTC()
+	}
+	return metadata
+}
+
+// recordDeployment completes the metadata of a version being registered with the build declared in its
+// config, which takes precedence over the artifact's annotations, and who deployed it. The deployer is
+// recorded in the working directory, so it is still known after a restart.
+func recordDeployment(config models.StemConfig, metadata models.VersionMetadata, options RegisterOptions) models.VersionMetadata {
+	if config.Build != nil {
+		if config.Build.Commit != "" {
+			metadata.GitCommit = config.Build.Commit
+		}
+		if built, err := time.Parse(time.RFC3339, config.Build.Time); err == nil {
+			metadata.BuildTime = built.UTC()
+		}
+	}
+	if options.DeployedBy == "" {
+		return metadata
+	}
+	metadata.DeployedBy = options.DeployedBy
+	metadata.DeployedAt = time.Now().UTC()
+	workingDir, err := getWorkingDirectory(config.Name, config.Version, &config)
+	if err != nil {
+		return metadata
+	}
+	// The config's build is not recorded, so a changed config.yaml is not overridden on the next restart
+	recorded := readVersionMetadata(workingDir)
+	recorded.DeployedBy, recorded.DeployedAt = metadata.DeployedBy, metadata.DeployedAt
+	if err := writeVersionMetadata(workingDir, recorded); err != nil {
+		log.Printf("Failed to record the deployment of stem %s version %s: %v", config.Name, config.Version, err)
+	}
+	return metadata
+}
@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactMetadata(t *testing.T) {
+	artifact := &Artifact{URL: "oci://registry.internal/billing:v2", Digest: "sha256:abc", Annotations: map[string]string{
+		ociRevisionAnnotation: "4f2a9c1", ociCreatedAnnotation: "2026-10-01T08:30:00+02:00"}}
+	assert.Equal(t, models.VersionMetadata{Artifact: artifact.URL, ArtifactDigest: "sha256:abc", GitCommit: "4f2a9c1",
+		BuildTime: time.Date(2026, 10, 1, 6, 30, 0, 0, time.UTC)}, artifactMetadata(artifact, true))
+
+	// Unverified artifacts have no digest, and artifacts other than OCI ones no build
+	assert.Equal(t, models.VersionMetadata{Artifact: "https://releases.internal/billing.tar.gz"},
+		artifactMetadata(&Artifact{URL: "https://releases.internal/billing.tar.gz", Digest: "sha256:abc"}, false))
+}
+
+func TestStemManager_VersionMetadata(t *testing.T) {
+	rootFolder := t.TempDir()
+	t.Setenv("PLANTARIUM_ROOT_FOLDER", rootFolder)
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	mockLeafManager := new(MockLeafManager)
+	mockProxyClient := new(MockProxyClient)
+	stemManager := NewStemManager(repos.NewStemRepository(herbariumDB), mockLeafManager, mockProxyClient)
+	mockProxyClient.On("BindStem", "billing", proxy.BackendOptions{}).Return(nil)
+	mockLeafManager.On("StartLeaf", "billing", "v2", (*string)(nil)).Return("leaf", nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deploymentArchive(t, map[string]string{"config.yaml": "name: billing\nversion: v2\nurl: /billing\ncommand: ./billing\nminInstances: 1\n" +
+			"build:\n  commit: 4f2a9c1\n  time: 2026-10-01T06:30:00Z\n"}).WriteTo(w)
+	}))
+	defer server.Close()
+
+	// The build is read from the config, and the deployer recorded with the version
+	key, err := stemManager.DeployArtifact(models.ArtifactConfig{URL: server.URL + "/billing-v2.tar.gz"}, RegisterOptions{DeployedBy: "alice@laptop"})
+	assert.NoError(t, err)
+	stem, err := stemManager.FetchStemInfo(key)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/billing-v2.tar.gz", stem.Metadata.Artifact)
+	assert.Equal(t, "4f2a9c1", stem.Metadata.GitCommit)
+	assert.Equal(t, time.Date(2026, 10, 1, 6, 30, 0, 0, time.UTC), stem.Metadata.BuildTime)
+	assert.Equal(t, "alice@laptop", stem.Metadata.DeployedBy)
+	assert.WithinDuration(t, time.Now(), stem.Metadata.DeployedAt, time.Minute)
+
+	// The deployment survives a restart, which registers the stem again from its directory
+	herbariumDB.Clear()
+	stemManager = NewStemManager(repos.NewStemRepository(herbariumDB), mockLeafManager, mockProxyClient)
+	assert.NoError(t, stemManager.RegisterStem(*stem.Config))
+	registered, err := stemManager.FetchStemInfo(key)
+	assert.NoError(t, err)
+	assert.Equal(t, stem.Metadata.DeployedBy, registered.Metadata.DeployedBy)
+	assert.True(t, stem.Metadata.DeployedAt.Equal(registered.Metadata.DeployedAt))
+	assert.Equal(t, "4f2a9c1", registered.Metadata.GitCommit)
+
+	recorded := readVersionMetadata(filepath.Join(rootFolder, "services", "billing", "v2"))
+	assert.Empty(t, recorded.GitCommit, "the config's build is not recorded")
+	assert.Equal(t, "alice@laptop", recorded.DeployedBy)
+
+	// Unreadable metadata is ignored
+	assert.NoError(t, os.WriteFile(filepath.Join(rootFolder, VersionMetadataFile), []byte("deployedBy: ["), 0644))
+	assert.Equal(t, models.VersionMetadata{}, readVersionMetadata(rootFolder))
+}
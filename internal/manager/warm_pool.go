@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// ErrNoStandbyLeaf is returned by PromoteStandbyLeaf when a stem has no ready standby leaf.
+var ErrNoStandbyLeaf = errors.New("no standby leaf available")
+
+// warmPoolSize returns how many standby leafs a stem keeps.
+func warmPoolSize(config *models.StemConfig) int {
+	if config == nil || config.WarmPool == nil || *config.WarmPool < 0 {
+		return 0
+	}
+	return *config.WarmPool
+}
+
+// PromoteStandbyLeaf binds the oldest ready standby leaf of a stem to the proxy, replacing replaceServer
+// if given, so it takes traffic without a cold start. Standby leafs that are no longer ready are stopped
+// on the way. The warm pool is refilled in the background. It returns ErrNoStandbyLeaf when no standby
+// leaf is ready.
+func (l *LeafManager) PromoteStandbyLeaf(stemName, version string, replaceServer *string) (string, error) {
+	stemKey := storage.StemKey{Name: stemName, Version: version}
+	stem, err := l.StemRepo.FetchStem(stemKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to find stem configuration: %v", err)
+	}
+
+	leafID, err := l.promote(stem, replaceServer)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Promoted standby leaf %s of stem %s version %s", leafID, stemName, version)
+
+	go func() {
+		defer recoverCrash(fmt.Sprintf("warm pool of stem %s version %s", stemName, version))
+		if _, err := l.FillWarmPool(stemName, version); err != nil {
+			log.Printf("Failed to refill warm pool of stem %s version %s: %v", stemName, version, err)
+		}
+	}()
+	return leafID, nil
+}
+
+// promote binds the first ready standby leaf of a stem. Promotions are serialized, so concurrent callers
+// never promote the same leaf.
+func (l *LeafManager) promote(stem *models.Stem, replaceServer *string) (string, error) {
+	l.poolMu.Lock()
+	defer l.poolMu.Unlock()
+
+	stemKey := storage.StemKey{Name: stem.Name, Version: stem.Version}
+	standby, _, err := l.LeafRepo.QueryLeafs(stemKey, repos.LeafQuery{Status: models.StatusStandby, SortBy: repos.LeafSortByInitialized})
+	if err != nil {
+		return "", fmt.Errorf("failed to list standby leafs: %v", err)
+	}
+	for _, leaf := range standby {
+		if !l.standbyReady(stem, leaf) {
+			log.Printf("Standby leaf %s of stem %s is not ready, stopping it", leaf.ID, stem.Name)
+			if err := l.StopLeaf(stem.Name, stem.Version, leaf.ID); err != nil {
+				log.Printf("Failed to stop standby leaf %s: %v", leaf.ID, err)
+			}
+			continue
+		}
+
+		if proxied(stem.Config) {
+			op := hooks.Operation{Stem: *stem.Config, LeafID: leaf.ID, Host: leafHost(leaf), Port: leaf.Port}
+			if err := l.bindLeaf(stem, op, leaf.HAProxyServer, replaceServer); err != nil {
+				return "", fmt.Errorf("failed to promote standby leaf %s: %v", leaf.ID, err)
+			}
+		}
+		if err := l.LeafRepo.UpdateLeafStatus(stemKey, leaf.ID, models.StatusRunning); err != nil {
+			return "", fmt.Errorf("leaf %s was bound, but failed to mark it as running: %v", leaf.ID, err)
+		}
+		return leaf.ID, nil
+	}
+	return "", ErrNoStandbyLeaf
+}
+
+// standbyReady reports whether a standby leaf is still running and, for leafs on this host, passes the
+// stem's readiness check.
+func (l *LeafManager) standbyReady(stem *models.Stem, leaf *models.Leaf) bool {
+	if leaf.Agent == "" {
+		return processAlive(leaf.PID) && readinessCheck(l.withAddressDefaults(stem.Config))(leaf.Port)
+	}
+	runtime, err := remoteRuntime(l.Agents, stem.Config, leaf.Agent)
+	if err != nil {
+		return false
+	}
+	remote, err := runtime.GetLeaf(leaf.ID)
+	return err == nil && remote.Alive
+}
+
+// FillWarmPool starts standby leafs until a stem has as many as its warmPool asks for, returning how many
+// were started. A stem is filled by one caller at a time; concurrent calls return right away.
+func (l *LeafManager) FillWarmPool(stemName, version string) (int, error) {
+	stemKey := storage.StemKey{Name: stemName, Version: version}
+	stem, err := l.StemRepo.FetchStem(stemKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find stem configuration: %v", err)
+	}
+	size := warmPoolSize(stem.Config)
+	if size == 0 {
+		return 0, nil
+	}
+
+	l.poolMu.Lock()
+	if l.filling == nil {
+		l.filling = make(map[storage.StemKey]bool)
+	}
+	if l.filling[stemKey] {
+		l.poolMu.Unlock()
+		return 0, nil
+	}
+	l.filling[stemKey] = true
+	l.poolMu.Unlock()
+	defer func() {
+		l.poolMu.Lock()
+		delete(l.filling, stemKey)
+		l.poolMu.Unlock()
+	}()
+
+	_, standby, err := l.LeafRepo.QueryLeafs(stemKey, repos.LeafQuery{Status: models.StatusStandby, Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count standby leafs: %v", err)
+	}
+	started := 0
+	for ; standby < size; standby++ {
+		if _, err := l.startLeaf(stemName, version, nil, true); err != nil {
+			return started, fmt.Errorf("failed to start standby leaf: %v", err)
+		}
+		started++
+	}
+	if started > 0 {
+		log.Printf("Started %d standby leafs for stem %s version %s", started, stemName, version)
+	}
+	return started, nil
+}
@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/internal/storage/repos"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLeafManager_WarmPool(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	leafRepo := repos.NewLeafRepository(db)
+	stemRepo := repos.NewStemRepository(db)
+
+	agentName := "edge-1"
+	warmPool := 1
+	key := storage.StemKey{Name: "checkout", Version: "v1"}
+	config := models.StemConfig{Name: "checkout", Version: "v1", URL: "/checkout", Command: "checkout --port {{.PORT}}", Agent: &agentName, WarmPool: &warmPool}
+	db.Stems[key] = &models.Stem{Name: "checkout", Version: "v1", HAProxyBackend: "checkout", Config: &config, LeafInstances: map[string]*models.Leaf{}}
+
+	mockAgent := new(MockAgentClient)
+	mockAgent.On("Host").Return("10.0.0.5")
+	mockAgent.On("StartLeaf", mock.Anything).Return(&AgentLeaf{PID: 4242, Port: 8005, Alive: true}, nil)
+	mockHAProxyClient := new(MockProxyClient)
+
+	leafManager := NewLeafManager(leafRepo, mockHAProxyClient, stemRepo)
+	leafManager.Agents = map[string]LeafRuntime{agentName: mockAgent}
+
+	// Standby leafs are started but not bound
+	started, err := leafManager.FillWarmPool("checkout", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, started)
+	standby, total, err := leafRepo.QueryLeafs(key, repos.LeafQuery{Status: models.StatusStandby})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	mockHAProxyClient.AssertNotCalled(t, "BindLeaf", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	started, err = leafManager.FillWarmPool("checkout", "v1")
+	assert.NoError(t, err)
+	assert.Zero(t, started, "a full pool starts nothing")
+
+	// Promotion binds the standby leaf and refills the pool in the background
+	standbyID := standby[0].ID
+	mockAgent.On("GetLeaf", standbyID).Return(&AgentLeaf{ID: standbyID, Alive: true}, nil)
+	mockHAProxyClient.On("BindLeaf", "checkout", standbyID, "10.0.0.5", 8005).Return(nil).Once()
+	leafID, err := leafManager.PromoteStandbyLeaf("checkout", "v1", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, standbyID, leafID)
+	leaf, err := leafRepo.FindLeafByID(key, leafID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, models.StatusRunning, leaf.Status)
+	}
+	assert.Eventually(t, func() bool {
+		_, total, _ := leafRepo.QueryLeafs(key, repos.LeafQuery{Status: models.StatusStandby})
+		return total == 1
+	}, time.Second, ServiceCheckInterval)
+
+	// Standby leafs that died are stopped instead of promoted, without touching the proxy
+	standby, _, _ = leafRepo.QueryLeafs(key, repos.LeafQuery{Status: models.StatusStandby})
+	deadID := standby[0].ID
+	mockAgent.On("GetLeaf", deadID).Return(&AgentLeaf{ID: deadID, Alive: false}, nil)
+	mockAgent.On("StopLeaf", deadID).Return(nil)
+	_, err = leafManager.PromoteStandbyLeaf("checkout", "v1", nil)
+	assert.ErrorIs(t, err, ErrNoStandbyLeaf)
+	_, err = leafRepo.FindLeafByID(key, deadID)
+	assert.Error(t, err)
+	mockHAProxyClient.AssertNotCalled(t, "UnbindLeaf", "checkout", deadID)
+}
+
+func TestStemManager_RegisterStem_WarmPool(t *testing.T) {
+	herbariumDB := storage.GetHerbariumDB()
+	herbariumDB.Clear()
+	stemRepo := repos.NewStemRepository(herbariumDB)
+
+	minInstances, warmPool := 1, 2
+	mockHAProxyClient := new(MockProxyClient)
+	mockHAProxyClient.On("BindStem", "checkout", mock.Anything).Return(nil)
+	mockLeafManager := new(MockLeafManager)
+	mockLeafManager.On("StartLeaf", "checkout", "1.0.0", (*string)(nil)).Return("checkout-1", nil)
+	mockLeafManager.On("FillWarmPool", "checkout", "1.0.0").Return(2, nil)
+	stemManager := NewStemManager(stemRepo, mockLeafManager, mockHAProxyClient)
+
+	config := models.StemConfig{
+		Name:         "checkout",
+		URL:          "/checkout",
+		Command:      "./checkout --port {{.PORT}}",
+		Version:      "1.0.0",
+		MinInstances: &minInstances,
+		WarmPool:     &warmPool,
+	}
+	assert.NoError(t, stemManager.RegisterStem(config))
+	mockLeafManager.AssertExpectations(t)
+
+	// Unregistering stops standby leafs along with running ones
+	key := storage.StemKey{Name: "checkout", Version: "1.0.0"}
+	mockLeafManager.On("StopGraftNodeLeaf", "checkout", "1.0.0").Return(nil)
+	mockLeafManager.On("ListLeafs", key, repos.LeafQuery{}).Return([]*models.Leaf{{ID: "checkout-1"}, {ID: "checkout-2", Status: models.StatusStandby}}, 2, nil)
+	mockLeafManager.On("StopLeaf", "checkout", "1.0.0", "checkout-1").Return(nil)
+	mockLeafManager.On("StopLeaf", "checkout", "1.0.0", "checkout-2").Return(nil)
+	mockHAProxyClient.On("UnbindStem", "checkout").Return(nil)
+	assert.NoError(t, stemManager.UnregisterStem(key))
+	mockLeafManager.AssertCalled(t, "StopLeaf", "checkout", "1.0.0", "checkout-2")
+}
@@ -0,0 +1,318 @@
+// Package nginx implements proxy.ProxyClient by rendering Nginx upstream blocks and reloading Nginx.
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// DefaultReloadCommand and DefaultTestCommand are used when the config leaves the commands empty.
+const (
+	DefaultReloadCommand = "nginx -s reload"
+	DefaultTestCommand   = "nginx -t"
+)
+
+// defaultTemplate renders one upstream per backend. Backends without servers get a placeholder marked
+// down, since Nginx rejects empty upstreams.
+const defaultTemplate = `# Generated by herbarium, do not edit.
+{{- range .Upstreams}}
+upstream {{.Name}} {
+{{- range .Servers}}
+    server {{.Address}}; # {{.Name}}
+{{- else}}
+    server 127.0.0.1:1 down;
+{{- end}}
+}
+{{- end}}
+`
+
+// invalidUpstreamChars matches characters not allowed in generated upstream names.
+var invalidUpstreamChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// NginxConfig configures the Nginx adapter.
+type NginxConfig struct {
+	ConfigFile    string // File the upstreams are rendered to, included from the Nginx http block
+	Template      string // Optional text/template file replacing the default rendering
+	ReloadCommand string // Command reloading Nginx after the file changed, defaults to DefaultReloadCommand
+	TestCommand   string // Command validating the configuration before reloading, defaults to DefaultTestCommand
+}
+
+// Upstream is a backend as passed to the template.
+type Upstream struct {
+	Name            string            // Upstream name, the backend name with unsupported characters replaced by '_'
+	Backend         string            // Backend name as used by herbarium
+	Path            string            // URL path the backend serves, for location blocks
+	Host            string            // Hostname the backend serves, for server_name; empty for any host
+	Rewrite         string            // Path replacing Path in front of forwarded request paths, "/" to strip it; empty to forward them unchanged
+	Compression     bool              // Whether to gzip text responses
+	CacheMaxAge     int64             // Seconds responses may be cached for, 0 for no caching
+	CORS            *proxy.CORSPolicy // Cross-origin requests allowed, nil for none
+	SecurityHeaders []proxy.Header    // Headers to add to every response, for add_header
+	RateLimit       *proxy.RateLimit  // Requests a client may send per period, for limit_req; nil for no limit
+	Shadow          bool              // Whether the upstream only gets mirrored requests, so it needs no location block
+	Mirror          string            // Upstream name of the shadow backend requests are mirrored to, empty for none
+	MirrorPercent   int               // Share of requests mirrored, for split_clients
+	Protocol        string            // proxy.ProtocolHTTP, proxy.ProtocolH2C, or proxy.ProtocolH2, for choosing proxy_pass or grpc_pass
+	HealthCheck     string            // proxy.HealthCheckHTTP or proxy.HealthCheckGRPC
+	Servers         []Server          // Servers ordered by name
+}
+
+// Server is a leaf's server as passed to the template.
+type Server struct {
+	Name    string // Server name, the leaf ID
+	Address string // host:port of the leaf
+}
+
+// backend is an upstream's options and servers (server name -> host:port).
+type backend struct {
+	options proxy.BackendOptions
+	servers map[string]string
+}
+
+// NginxClient keeps the backends in memory and rewrites the configuration file on every change.
+type NginxClient struct {
+	config   NginxConfig
+	template *template.Template
+
+	mu       sync.Mutex
+	backends map[string]*backend
+
+	// run executes a command line, replaced in tests
+	run func(command string) error
+}
+
+// NewNginxClient creates an Nginx adapter, parsing the custom template if one is configured.
+func NewNginxClient(config NginxConfig) (*NginxClient, error) {
+	if config.ConfigFile == "" {
+		return nil, fmt.Errorf("nginx config file is required")
+	}
+	if config.ReloadCommand == "" {
+		config.ReloadCommand = DefaultReloadCommand
+	}
+	if config.TestCommand == "" {
+		config.TestCommand = DefaultTestCommand
+	}
+
+	text := defaultTemplate
+	if config.Template != "" {
+		content, err := os.ReadFile(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read nginx template: %v", err)
+		}
+		text = string(content)
+	}
+	tmpl, err := template.New("nginx").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nginx template: %v", err)
+	}
+
+	return &NginxClient{
+		config:   config,
+		template: tmpl,
+		backends: make(map[string]*backend),
+		run:      runCommand,
+	}, nil
+}
+
+// BindStem creates an empty upstream for a stem, replacing any existing one.
+func (c *NginxClient) BindStem(backendName string, options proxy.BackendOptions) error {
+	if options.IsUDP() {
+		return fmt.Errorf("UDP backends are not supported by the nginx adapter")
+	}
+	return c.update(func(backends map[string]*backend) error {
+		backends[backendName] = &backend{options: options, servers: make(map[string]string)}
+		return nil
+	})
+}
+
+// BindLeaf adds a leaf's server to an upstream.
+func (c *NginxClient) BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error {
+	return c.update(func(backends map[string]*backend) error {
+		b, ok := backends[backendName]
+		if !ok {
+			return fmt.Errorf("backend %s not found", backendName)
+		}
+		b.servers[leafID] = net.JoinHostPort(serviceAddress, strconv.Itoa(servicePort))
+		return nil
+	})
+}
+
+// UnbindLeaf removes a leaf's server from an upstream.
+func (c *NginxClient) UnbindLeaf(backendName, serverName string) error {
+	return c.update(func(backends map[string]*backend) error {
+		b, ok := backends[backendName]
+		if !ok {
+			return fmt.Errorf("backend %s not found", backendName)
+		}
+		if _, ok := b.servers[serverName]; !ok {
+			return fmt.Errorf("server %s not found in backend %s", serverName, backendName)
+		}
+		delete(b.servers, serverName)
+		return nil
+	})
+}
+
+// ReplaceLeaf swaps one server for another with a single reload.
+func (c *NginxClient) ReplaceLeaf(backendName, oldServerName, newServerName, serviceAddress string, servicePort int) error {
+	return c.update(func(backends map[string]*backend) error {
+		b, ok := backends[backendName]
+		if !ok {
+			return fmt.Errorf("backend %s not found", backendName)
+		}
+		if _, ok := b.servers[oldServerName]; !ok {
+			return fmt.Errorf("server %s not found in backend %s", oldServerName, backendName)
+		}
+		delete(b.servers, oldServerName)
+		b.servers[newServerName] = net.JoinHostPort(serviceAddress, strconv.Itoa(servicePort))
+		return nil
+	})
+}
+
+// UnbindStem removes a stem's upstream.
+func (c *NginxClient) UnbindStem(backendName string) error {
+	return c.update(func(backends map[string]*backend) error {
+		delete(backends, backendName)
+		return nil
+	})
+}
+
+// update applies change to a copy of the backends, then writes, tests, and reloads the configuration.
+// When any step fails, the previous file is restored and the in-memory backends are left unchanged.
+func (c *NginxClient) update(change func(backends map[string]*backend) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	backends := make(map[string]*backend, len(c.backends))
+	for name, b := range c.backends {
+		copied := &backend{options: b.options, servers: make(map[string]string, len(b.servers))}
+		for server, address := range b.servers {
+			copied.servers[server] = address
+		}
+		backends[name] = copied
+	}
+	if err := change(backends); err != nil {
+		return err
+	}
+
+	var rendered bytes.Buffer
+	if err := c.template.Execute(&rendered, struct{ Upstreams []Upstream }{upstreams(backends)}); err != nil {
+		return fmt.Errorf("failed to render nginx config: %v", err)
+	}
+
+	previous, err := os.ReadFile(c.config.ConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read nginx config: %v", err)
+	}
+	if err := writeFile(c.config.ConfigFile, rendered.Bytes()); err != nil {
+		return err
+	}
+
+	restore := func(cause error) error {
+		if previous == nil {
+			_ = os.Remove(c.config.ConfigFile)
+		} else if err := writeFile(c.config.ConfigFile, previous); err != nil {
+			log.Printf("Failed to restore nginx config %s: %v", c.config.ConfigFile, err)
+		}
+		return cause
+	}
+	if err := c.run(c.config.TestCommand); err != nil {
+		return restore(fmt.Errorf("nginx rejected the generated config: %v", err))
+	}
+	if err := c.run(c.config.ReloadCommand); err != nil {
+		return restore(fmt.Errorf("failed to reload nginx: %v", err))
+	}
+
+	c.backends = backends
+	return nil
+}
+
+// upstreams converts the backends to template data ordered by name.
+func upstreams(backends map[string]*backend) []Upstream {
+	result := make([]Upstream, 0, len(backends))
+	for backendName, b := range backends {
+		upstream := Upstream{
+			Name:        UpstreamName(backendName),
+			Backend:     backendName,
+			Path:        b.options.RoutePath(backendName),
+			Host:        b.options.Host,
+			Rewrite:     b.options.Rewrite,
+			Compression: b.options.Compression,
+			CacheMaxAge: int64(b.options.CacheMaxAge / time.Second),
+			CORS:        b.options.CORS,
+			RateLimit:   b.options.RateLimit,
+			Shadow:      b.options.Shadow,
+			Protocol:    b.options.Protocol,
+			HealthCheck: b.options.HealthCheck,
+		}
+		if mirror := b.options.Mirror; mirror != nil {
+			upstream.Mirror, upstream.MirrorPercent = UpstreamName(mirror.Backend), mirror.Percent
+		}
+		if b.options.SecurityHeaders {
+			upstream.SecurityHeaders = proxy.SecurityHeaders
+		}
+		if upstream.Protocol == "" {
+			upstream.Protocol = proxy.ProtocolHTTP
+		}
+		if upstream.HealthCheck == "" {
+			upstream.HealthCheck = proxy.HealthCheckHTTP
+		}
+		for name, address := range b.servers {
+			upstream.Servers = append(upstream.Servers, Server{Name: name, Address: address})
+		}
+		sort.Slice(upstream.Servers, func(i, j int) bool {
+			return upstream.Servers[i].Name < upstream.Servers[j].Name
+		})
+		result = append(result, upstream)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// UpstreamName returns the upstream name generated for a backend, for use in proxy_pass directives.
+func UpstreamName(backendName string) string {
+	return invalidUpstreamChars.ReplaceAllString(backendName, "_")
+}
+
+// writeFile replaces path atomically so Nginx never reads a partially written file.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create nginx config folder: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write nginx config: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace nginx config: %v", err)
+	}
+	return nil
+}
+
+// runCommand executes a command line split on whitespace, including its output in the error.
+func runCommand(command string) error {
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		return nil
+	}
+	output, err := exec.Command(parts[0], parts[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", command, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
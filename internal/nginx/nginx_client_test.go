@@ -0,0 +1,87 @@
+package nginx
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClient creates a client writing to a temporary file and recording the commands it runs.
+func newTestClient(t *testing.T, config NginxConfig) (*NginxClient, *[]string) {
+	config.ConfigFile = filepath.Join(t.TempDir(), "conf.d", "herbarium.conf")
+	client, err := NewNginxClient(config)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	var commands []string
+	client.run = func(command string) error {
+		commands = append(commands, command)
+		return nil
+	}
+	return client, &commands
+}
+
+func TestNginxClient_RendersUpstreams(t *testing.T) {
+	client, commands := newTestClient(t, NginxConfig{})
+
+	assert.NoError(t, client.BindStem("hello-service", proxy.BackendOptions{}))
+	assert.NoError(t, client.BindStem("api/v2", proxy.BackendOptions{}))
+	assert.NoError(t, client.BindLeaf("hello-service", "leaf-2", "10.0.0.5", 8001))
+	assert.NoError(t, client.BindLeaf("hello-service", "leaf-1", "localhost", 8000))
+	assert.NoError(t, client.ReplaceLeaf("hello-service", "leaf-2", "leaf-3", "10.0.0.6", 8002))
+	assert.NoError(t, client.BindLeaf("hello-service", "leaf-4", "::1", 8003))
+
+	content, err := os.ReadFile(client.config.ConfigFile)
+	assert.NoError(t, err)
+	assert.Equal(t, `# Generated by herbarium, do not edit.
+upstream api_v2 {
+    server 127.0.0.1:1 down;
+}
+upstream hello-service {
+    server localhost:8000; # leaf-1
+    server 10.0.0.6:8002; # leaf-3
+    server [::1]:8003; # leaf-4
+}
+`, string(content))
+	assert.Equal(t, []string{DefaultTestCommand, DefaultReloadCommand}, (*commands)[:2])
+	assert.Len(t, *commands, 12)
+
+	assert.ErrorContains(t, client.UnbindLeaf("hello-service", "leaf-2"), "server leaf-2 not found")
+	assert.ErrorContains(t, client.BindLeaf("missing", "leaf-5", "localhost", 8004), "backend missing not found")
+}
+
+func TestNginxClient_RestoresConfigWhenRejected(t *testing.T) {
+	client, _ := newTestClient(t, NginxConfig{TestCommand: "check"})
+	assert.NoError(t, client.BindStem("hello-service", proxy.BackendOptions{}))
+	before, _ := os.ReadFile(client.config.ConfigFile)
+
+	client.run = func(command string) error {
+		if command == "check" {
+			return errors.New("emerg: invalid parameter")
+		}
+		return nil
+	}
+	err := client.BindLeaf("hello-service", "leaf-1", "localhost", 8000)
+	assert.ErrorContains(t, err, "nginx rejected the generated config")
+
+	// Neither the file nor the in-memory state keep the rejected change
+	after, _ := os.ReadFile(client.config.ConfigFile)
+	assert.Equal(t, string(before), string(after))
+	assert.Empty(t, client.backends["hello-service"].servers)
+}
+
+func TestNginxClient_CustomTemplate(t *testing.T) {
+	templateFile := filepath.Join(t.TempDir(), "herbarium.tmpl")
+	assert.NoError(t, os.WriteFile(templateFile, []byte(`{{range .Upstreams}}location /{{.Backend}}/ { proxy_pass http://{{.Name}}; }
+{{end}}`), 0644))
+	client, _ := newTestClient(t, NginxConfig{Template: templateFile})
+
+	assert.NoError(t, client.BindStem("hello-service", proxy.BackendOptions{}))
+	content, err := os.ReadFile(client.config.ConfigFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "location /hello-service/ { proxy_pass http://hello-service; }\n", string(content))
+}
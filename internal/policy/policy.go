@@ -0,0 +1,235 @@
+// Package policy evaluates stem configs against the organization's admission policies, so non-compliant
+// deployments are rejected at registration with a clear reason. Besides the built-in rules, policies can hold
+// CEL expressions over the stem config.
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+// Violation is a stem config breaking a rule of a policy.
+type Violation struct {
+	Policy string // Name of the policy
+	Reason string // Rule that was broken
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("denied by policy %s: %s", v.Policy, v.Reason)
+}
+
+// Engine evaluates stem configs against a set of policies.
+type Engine struct {
+	policies []policy
+}
+
+// policy is a PolicyConfig with its patterns and rules compiled.
+type policy struct {
+	name           string
+	stems          []*regexp.Regexp
+	commands       []*regexp.Regexp
+	requiredLabels []string
+	minPort        int
+	maxPort        int
+	rules          []rule
+}
+
+// rule is a compiled CEL expression of a policy.
+type rule struct {
+	program cel.Program
+	message string
+}
+
+// NewEngine compiles the policies, failing on one without a name, with an invalid port range, or with a rule
+// that isn't a valid CEL expression evaluating to a bool.
+func NewEngine(configs []models.PolicyConfig) (*Engine, error) {
+	env, err := cel.NewEnv(cel.Variable("stem", cel.MapType(cel.StringType, cel.DynType)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the CEL environment: %v", err)
+	}
+	engine := &Engine{}
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("policy %d has no name", i)
+		}
+		p := policy{name: config.Name, requiredLabels: config.RequiredLabels}
+		for _, pattern := range config.Stems {
+			p.stems = append(p.stems, compileGlob(pattern))
+		}
+		for _, pattern := range config.AllowedCommands {
+			p.commands = append(p.commands, compileGlob(pattern))
+		}
+		if config.PortRange != "" {
+			var err error
+			p.minPort, p.maxPort, err = ParsePortRange(config.PortRange)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %v", config.Name, err)
+			}
+		}
+		for _, ruleConfig := range config.Rules {
+			compiled, err := compileRule(env, ruleConfig)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %v", config.Name, err)
+			}
+			p.rules = append(p.rules, compiled)
+		}
+		engine.policies = append(engine.policies, p)
+	}
+	return engine, nil
+}
+
+// compileRule compiles the CEL expression of a rule, which must evaluate to a bool.
+func compileRule(env *cel.Env, config models.PolicyRule) (rule, error) {
+	ast, issues := env.Compile(config.Expression)
+	if issues != nil && issues.Err() != nil {
+		return rule{}, fmt.Errorf("invalid rule %q: %v", config.Expression, issues.Err())
+	}
+	// Values of the config are dynamically typed, so e.g. stem.shadow is only known to be a bool when evaluated
+	if output := ast.OutputType(); output != cel.BoolType && output != cel.DynType {
+		return rule{}, fmt.Errorf("rule %q evaluates to %s instead of bool", config.Expression, ast.OutputType())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return rule{}, fmt.Errorf("invalid rule %q: %v", config.Expression, err)
+	}
+	message := config.Message
+	if message == "" {
+		message = fmt.Sprintf("rule %s does not hold", config.Expression)
+	}
+	return rule{program: program, message: message}, nil
+}
+
+// Evaluate returns the violations of a stem config, in policy order, or none if it complies.
+func (e *Engine) Evaluate(config models.StemConfig) []Violation {
+	var violations []Violation
+	var document map[string]interface{}
+	for _, p := range e.policies {
+		if len(p.stems) > 0 && !matchesAny(p.stems, config.Name) {
+			continue
+		}
+		if len(p.rules) > 0 && document == nil {
+			document = stemDocument(config)
+		}
+		for _, reason := range p.check(config, document) {
+			violations = append(violations, Violation{Policy: p.name, Reason: reason})
+		}
+	}
+	return violations
+}
+
+// Run vetoes a registration that violates a policy, so an Engine can be registered at
+// hooks.BeforeRegisterStem.
+func (e *Engine) Run(op *hooks.Operation) error {
+	violations := e.Evaluate(op.Stem)
+	if len(violations) == 0 {
+		return nil
+	}
+	reasons := make([]string, len(violations))
+	for i, violation := range violations {
+		reasons[i] = violation.String()
+	}
+	return fmt.Errorf("%s", strings.Join(reasons, "; "))
+}
+
+// check returns the rules of the policy a stem config breaks. document is the config as the CEL rules see it.
+func (p policy) check(config models.StemConfig, document map[string]interface{}) []string {
+	var reasons []string
+	// Static stems are served by herbarium and have no command
+	if len(p.commands) > 0 && config.Static == nil && !matchesAny(p.commands, config.Command) {
+		reasons = append(reasons, fmt.Sprintf("command %q is not allowed", config.Command))
+	}
+	for _, label := range p.requiredLabels {
+		if config.Labels[label] == "" {
+			reasons = append(reasons, fmt.Sprintf("required label %s is missing", label))
+		}
+	}
+	if p.maxPort > 0 && config.UDP != nil && config.UDP.Port > 0 {
+		if port := config.UDP.Port; port < p.minPort || port > p.maxPort {
+			reasons = append(reasons, fmt.Sprintf("port %d is outside the allowed range %d-%d", port, p.minPort, p.maxPort))
+		}
+	}
+	// A rule that fails to evaluate, e.g. on a key the config leaves out, is broken too
+	for _, r := range p.rules {
+		result, _, err := r.program.Eval(map[string]interface{}{"stem": document})
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s (%v)", r.message, err))
+		} else if holds, ok := result.Value().(bool); !ok || !holds {
+			reasons = append(reasons, r.message)
+		}
+	}
+	return reasons
+}
+
+// stemDocument returns a stem config as a map with the keys of its config.yaml, which CEL rules evaluate.
+func stemDocument(config models.StemConfig) map[string]interface{} {
+	document := map[string]interface{}{}
+	data, err := yaml.Marshal(config)
+	if err == nil {
+		var decoded map[string]interface{}
+		if yaml.Unmarshal(data, &decoded) == nil {
+			document = stringKeys(decoded).(map[string]interface{})
+		}
+	}
+	return document
+}
+
+// stringKeys converts the maps YAML decodes with interface keys, recursively, to maps with string keys.
+func stringKeys(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			converted[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return converted
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = stringKeys(item)
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = stringKeys(item)
+		}
+		return typed
+	default:
+		return value
+	}
+}
+
+// ParsePortRange parses a "min-max" port range.
+func ParsePortRange(value string) (int, int, error) {
+	low, high, found := strings.Cut(value, "-")
+	minPort, errLow := strconv.Atoi(strings.TrimSpace(low))
+	maxPort, errHigh := strconv.Atoi(strings.TrimSpace(high))
+	if !found || errLow != nil || errHigh != nil || minPort < 1 || maxPort > 65535 || minPort > maxPort {
+		return 0, 0, fmt.Errorf("port range %q is not of the form min-max within 1-65535", value)
+	}
+	return minPort, maxPort, nil
+}
+
+// compileGlob turns a glob pattern into a regular expression matching the whole value, where * matches any
+// run of characters, including spaces and slashes, and ? any single character.
+func compileGlob(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("^" + quoted + "$")
+}
+
+// matchesAny reports whether value matches one of the patterns.
+func matchesAny(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/hooks"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngine_Evaluate(t *testing.T) {
+	engine, err := NewEngine([]models.PolicyConfig{
+		{Name: "approved-commands", AllowedCommands: []string{"./bin/*", "java -jar *.jar *"}},
+		{Name: "ownership", RequiredLabels: []string{"team", "costCenter"}},
+		{Name: "public-ports", Stems: []string{"edge-*"}, PortRange: "20000-29999"},
+	})
+	assert.NoError(t, err)
+
+	compliant := models.StemConfig{
+		Name:    "billing",
+		Command: "java -jar billing.jar --server.port={{.PORT}}",
+		Labels:  map[string]string{"team": "payments", "costCenter": "cc-7"},
+		UDP:     &models.UDPConfig{Port: 53},
+	}
+	assert.Empty(t, engine.Evaluate(compliant))
+
+	// Port ranges only apply to the stems a policy selects
+	edge := compliant
+	edge.Name = "edge-dns"
+	assert.Equal(t, []Violation{{Policy: "public-ports", Reason: "port 53 is outside the allowed range 20000-29999"}}, engine.Evaluate(edge))
+
+	violating := models.StemConfig{Name: "cron", Command: "rm -rf /tmp/cache && ./bin/cron", Labels: map[string]string{"team": ""}}
+	assert.Equal(t, []Violation{
+		{Policy: "approved-commands", Reason: `command "rm -rf /tmp/cache && ./bin/cron" is not allowed`},
+		{Policy: "ownership", Reason: "required label team is missing"},
+		{Policy: "ownership", Reason: "required label costCenter is missing"},
+	}, engine.Evaluate(violating))
+
+	// Static stems run no command
+	docs := models.StemConfig{Name: "docs", Static: &models.StaticConfig{Root: "site"}, Labels: compliant.Labels}
+	assert.Empty(t, engine.Evaluate(docs))
+
+	// As a hook the engine vetoes with every reason
+	err = engine.Run(&hooks.Operation{Stem: violating})
+	assert.EqualError(t, err, `denied by policy approved-commands: command "rm -rf /tmp/cache && ./bin/cron" is not allowed; `+
+		"denied by policy ownership: required label team is missing; denied by policy ownership: required label costCenter is missing")
+}
+
+func TestEngine_EvaluateRules(t *testing.T) {
+	engine, err := NewEngine([]models.PolicyConfig{
+		{Name: "binaries", Rules: []models.PolicyRule{
+			{Expression: "stem.command.startsWith('./bin/')", Message: "commands must run a binary from ./bin"},
+		}},
+		{Name: "ownership", Rules: []models.PolicyRule{
+			{Expression: "'team' in stem.labels && stem.labels.team != ''", Message: "stems must name their team"},
+			{Expression: "!has(stem.udp) || stem.udp.port >= 20000"},
+		}},
+		{Name: "routed", Rules: []models.PolicyRule{{Expression: "has(stem.shadow) ? !stem.shadow : true"}, {Expression: "stem.url"}}},
+	})
+	assert.NoError(t, err)
+
+	compliant := models.StemConfig{Name: "billing", Command: "./bin/billing", Labels: map[string]string{"team": "payments"}}
+	violations := engine.Evaluate(compliant)
+	assert.Equal(t, []Violation{{Policy: "routed", Reason: "rule stem.url does not hold"}}, violations, "a rule evaluating to a string doesn't hold")
+
+	violating := models.StemConfig{Name: "dns", Command: "dnsmasq", Labels: map[string]string{"team": ""}, UDP: &models.UDPConfig{Port: 53}, Shadow: true}
+	assert.Equal(t, []Violation{
+		{Policy: "binaries", Reason: "commands must run a binary from ./bin"},
+		{Policy: "ownership", Reason: "stems must name their team"},
+		{Policy: "ownership", Reason: "rule !has(stem.udp) || stem.udp.port >= 20000 does not hold"},
+		{Policy: "routed", Reason: "rule has(stem.shadow) ? !stem.shadow : true does not hold"},
+		{Policy: "routed", Reason: "rule stem.url does not hold"},
+	}, engine.Evaluate(violating))
+
+	// A rule that can't be evaluated against the config is broken, rather than skipped
+	unlabeled := models.StemConfig{Name: "cron", Command: "./bin/cron"}
+	engine, err = NewEngine([]models.PolicyConfig{{Name: "ownership", Rules: []models.PolicyRule{{Expression: "stem.labels.team != ''"}}}})
+	assert.NoError(t, err)
+	violations = engine.Evaluate(unlabeled)
+	if assert.Len(t, violations, 1) {
+		assert.Contains(t, violations[0].Reason, "rule stem.labels.team != '' does not hold (no such key: labels)")
+	}
+}
+
+func TestNewEngine_Invalid(t *testing.T) {
+	_, err := NewEngine([]models.PolicyConfig{{RequiredLabels: []string{"team"}}})
+	assert.EqualError(t, err, "policy 0 has no name")
+
+	for _, portRange := range []string{"9000", "0-100", "3000-2000", "1-70000", "low-high"} {
+		_, err := NewEngine([]models.PolicyConfig{{Name: "ports", PortRange: portRange}})
+		assert.Error(t, err, portRange)
+	}
+
+	// Rules must compile and evaluate to a bool
+	_, err = NewEngine([]models.PolicyConfig{{Name: "syntax", Rules: []models.PolicyRule{{Expression: "stem.command.startsWith("}}}})
+	assert.ErrorContains(t, err, "policy syntax: invalid rule")
+	_, err = NewEngine([]models.PolicyConfig{{Name: "type", Rules: []models.PolicyRule{{Expression: "size(stem.name)"}}}})
+	assert.ErrorContains(t, err, "evaluates to")
+}
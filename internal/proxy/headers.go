@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Header is a response header the proxy adds.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// SecurityHeaders are the headers added to every response of backends with BackendOptions.SecurityHeaders.
+var SecurityHeaders = []Header{
+	{Name: "Strict-Transport-Security", Value: "max-age=31536000; includeSubDomains"},
+	{Name: "X-Frame-Options", Value: "DENY"},
+	{Name: "X-Content-Type-Options", Value: "nosniff"},
+	{Name: "Referrer-Policy", Value: "strict-origin-when-cross-origin"},
+}
+
+// DefaultCORSMethods are the methods cross-origin requests may use when a CORSPolicy names none.
+var DefaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// CORSPolicy is the cross-origin requests a backend allows. The proxy answers preflight requests from allowed
+// origins itself and adds the CORS headers to the responses to them.
+type CORSPolicy struct {
+	AllowOrigins     []string      // Origins allowed to send requests, e.g. https://app.example.com; "*" for any
+	AllowMethods     []string      // Methods allowed in cross-origin requests, DefaultCORSMethods when empty
+	AllowHeaders     []string      // Request headers allowed beyond the simple ones
+	AllowCredentials bool          // Whether cookies and authorization headers may be sent, not with "*"
+	MaxAge           time.Duration // How long browsers may cache preflight responses, 0 for their default
+}
+
+// AnyOrigin reports whether requests from every origin are allowed.
+func (p *CORSPolicy) AnyOrigin() bool {
+	for _, origin := range p.AllowOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOrigin reports whether requests from origin, as sent in the Origin header, are allowed.
+func (p *CORSPolicy) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range p.AllowOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers returns the headers added to responses to requests from an allowed origin. allowOrigin is the value
+// of Access-Control-Allow-Origin: the request's origin, or an expression evaluating to it.
+func (p *CORSPolicy) Headers(allowOrigin string) []Header {
+	if p.AnyOrigin() && !p.AllowCredentials {
+		allowOrigin = "*"
+	}
+	headers := []Header{{Name: "Access-Control-Allow-Origin", Value: allowOrigin}, {Name: "Vary", Value: "Origin"}}
+	if p.AllowCredentials {
+		headers = append(headers, Header{Name: "Access-Control-Allow-Credentials", Value: "true"})
+	}
+	return headers
+}
+
+// PreflightHeaders returns the headers of the answer to a preflight request from an allowed origin.
+func (p *CORSPolicy) PreflightHeaders(allowOrigin string) []Header {
+	methods := p.AllowMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	headers := append(p.Headers(allowOrigin), Header{Name: "Access-Control-Allow-Methods", Value: strings.Join(methods, ", ")})
+	if len(p.AllowHeaders) > 0 {
+		headers = append(headers, Header{Name: "Access-Control-Allow-Headers", Value: strings.Join(p.AllowHeaders, ", ")})
+	}
+	if p.MaxAge > 0 {
+		headers = append(headers, Header{Name: "Access-Control-Max-Age", Value: fmt.Sprint(int64(p.MaxAge / time.Second))})
+	}
+	return headers
+}
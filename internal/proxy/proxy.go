@@ -0,0 +1,228 @@
+// Package proxy defines the reverse proxy operations herbarium uses to route requests to leafs.
+package proxy
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ProxyClient manages the backends (one per stem) and servers (one per leaf) of a reverse proxy.
+type ProxyClient interface {
+	BindStem(backendName string, options BackendOptions) error                                           // Creates an empty backend, replacing any existing one.
+	BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error                          // Adds a leaf's server to a backend.
+	UnbindLeaf(backendName, serverName string) error                                                     // Removes a leaf's server from a backend.
+	ReplaceLeaf(backendName, oldServerName, newServerName, serviceAddress string, servicePort int) error // Swaps one server for another in a single change.
+	UnbindStem(backendName string) error                                                                 // Removes a backend's servers.
+}
+
+// RequestCounter is implemented by proxy clients that can tell how many requests each server of a backend
+// has handled, which stems recycling leafs by request count rely on.
+type RequestCounter interface {
+	RequestCounts(backendName string) (map[string]int64, error) // Requests handled so far, by server name.
+}
+
+// LatencyReporter is implemented by proxy clients that measure how long each server of a backend takes to
+// respond, which stems alerting on latency rely on.
+type LatencyReporter interface {
+	ResponseTimes(backendName string) (map[string]time.Duration, error) // Recent average response time, by server name.
+}
+
+// QueueReporter is implemented by proxy clients that can tell how many requests of a backend are waiting for
+// a server, which autoscaling on saturation relies on.
+type QueueReporter interface {
+	QueuedRequests(backendName string) (int64, error) // Requests waiting for a server of the backend.
+}
+
+// Drainer is implemented by proxy clients that can stop sending new requests to a server while the requests
+// it is handling finish, which stopping leafs gracefully relies on.
+type Drainer interface {
+	DrainServer(backendName, serverName string) error            // Sends the server no new requests.
+	ActiveSessions(backendName string) (map[string]int64, error) // Requests in flight, by server name.
+}
+
+// ServerLister is implemented by proxy clients that can list the servers of a backend, which reclaiming
+// servers left behind by leafs that are gone relies on.
+type ServerLister interface {
+	Servers(backendName string) ([]string, error) // Names of the servers in the backend.
+}
+
+// BackendLister is implemented by proxy clients that can list their backends, which detecting backends
+// missing from the proxy or not owned by herbarium relies on.
+type BackendLister interface {
+	Backends() ([]string, error) // Names of the backends in the proxy.
+}
+
+// OwnershipReporter is implemented by proxy clients that tag the backends herbarium creates, which telling
+// herbarium's backends apart from ones configured by hand relies on.
+type OwnershipReporter interface {
+	OwnedBackends() ([]string, error) // Names of the backends tagged as herbarium's.
+}
+
+// EjectionReporter is implemented by proxy clients that can tell which servers of a backend they took out of
+// rotation, which acting on circuit breakers relies on.
+type EjectionReporter interface {
+	EjectedServers(backendName string) ([]string, error) // Names of the servers taken out of rotation by failed checks or responses.
+}
+
+// WeightSetter is implemented by proxy clients that can change the share of a backend's requests each of its
+// servers gets at runtime, which splitting traffic across the versions of a stem relies on.
+type WeightSetter interface {
+	SetServerWeights(backendName string, weights map[string]int) error // Sets the weights of the named servers in one change.
+}
+
+// ConfigExporter is implemented by proxy clients that can render the configuration of the objects herbarium
+// manages in them, read live from the proxy, for debugging and reviewing changes.
+type ConfigExporter interface {
+	ExportConfig() (string, error) // The managed part of the proxy's configuration, in its own format.
+}
+
+// MaintenanceSwitcher is implemented by proxy clients that can answer every request to a set of backends
+// with a maintenance page in a single change, leaving their servers in place, and restore them in another.
+type MaintenanceSwitcher interface {
+	EnterMaintenance(backendNames []string, page string) error // Answers requests to the backends with 503 and the HTML page.
+	ExitMaintenance(backendNames []string) error               // Routes requests to the backends' servers again.
+}
+
+// BackendMaintenanceSwitcher is implemented by proxy clients that can put all servers of a single backend
+// into maintenance, so they get no requests while their processes keep running, and answer the backend's
+// requests with a maintenance page instead.
+type BackendMaintenanceSwitcher interface {
+	SetBackendMaintenance(backendName string, enabled bool, page string) error // page is only used when enabling.
+}
+
+// Proxy types selectable in the global config.
+const (
+	TypeHAProxy  = "haproxy"  // HAProxy Dataplane API (default)
+	TypeNginx    = "nginx"    // Nginx configuration file and reload
+	TypeTraefik  = "traefik"  // Traefik HTTP provider
+	TypeEmbedded = "embedded" // Reverse proxy built into herbarium
+)
+
+// BackendOptions configures how a backend talks to and checks its servers. The zero value is HTTP/1.1
+// with HTTP health checks.
+type BackendOptions struct {
+	Protocol    string // ProtocolHTTP (default), ProtocolH2C, or ProtocolH2
+	HealthCheck string // HealthCheckHTTP (default) or HealthCheckGRPC
+	Transport   string // TransportTCP (default) or TransportUDP
+	ListenPort  int    // Port a UDP backend is published on, UDP only
+	MaxConn     int    // Requests a server handles at once before further ones queue, 0 for no limit
+	Path        string // URL path the backend serves, e.g. /hello; empty for / and the backend name
+	Host        string // Hostname requests must be for, e.g. api.example.com; empty for any host
+	Rewrite     string // Replaces the route path in front of request paths before forwarding, "/" strips it; empty forwards paths unchanged
+
+	ConnectTimeout time.Duration // Time to connect to a server, 0 for the proxy's default
+	ServerTimeout  time.Duration // Time a server may take to respond, 0 for the proxy's default
+	QueueTimeout   time.Duration // Time a request waits in the queue for a free server, 0 for the proxy's default
+	Retries        *int          // Times a failed connection is retried, nil for the proxy's default
+
+	Compression bool          // Compresses text responses for clients accepting gzip
+	CacheMaxAge time.Duration // Caches responses in the proxy for up to this long, 0 for no caching
+
+	CORS            *CORSPolicy // Cross-origin requests allowed, answering their preflight requests in the proxy; nil for none
+	SecurityHeaders bool        // Adds the SecurityHeaders to every response
+	RateLimit       *RateLimit  // Requests a client may send, further ones are answered with 429; nil for no limit
+
+	CircuitBreaker *CircuitBreaker // Takes servers answering with bursts of errors out of rotation, nil to not watch their responses
+
+	Shadow bool    // Routes no requests to the backend, it only gets the copies other backends mirror to it
+	Mirror *Mirror // Copies requests to a shadow backend, nil to not mirror them
+}
+
+// Mirror copies Percent of a backend's requests, as forwarded to its servers, to a server of the shadow Backend
+// and discards the responses.
+type Mirror struct {
+	Backend string
+	Percent int
+}
+
+// Circuit breaker actions taken on a server whose responses failed ErrorLimit times in a row.
+const (
+	OnErrorMarkDown    = "mark-down"    // Takes the server out of rotation at once
+	OnErrorSuddenDeath = "sudden-death" // Takes the server out of rotation when one more health check fails
+)
+
+// CircuitBreaker has the proxy take a server out of rotation when ErrorLimit of its responses in a row are
+// server errors or fail to arrive, until it passes its health checks again.
+type CircuitBreaker struct {
+	ErrorLimit int
+	OnError    string // OnErrorMarkDown or OnErrorSuddenDeath
+}
+
+// RateLimit is the number of requests a client, identified by its address, may send to a backend per Period.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// OwnerTag is the description of the backends herbarium creates in proxies that keep one, so they can be
+// told apart from backends configured by hand.
+const OwnerTag = "managed-by=herbarium"
+
+// Backend transports selectable per stem.
+const (
+	TransportTCP = "tcp" // HTTP over TCP, routed by path
+	TransportUDP = "udp" // Datagrams, routed by the port they arrive on
+)
+
+// Backend protocols selectable per stem.
+const (
+	ProtocolHTTP = "http" // HTTP/1.1
+	ProtocolH2C  = "h2c"  // HTTP/2 without TLS, as spoken by most gRPC services
+	ProtocolH2   = "h2"   // HTTP/2 over TLS
+)
+
+// Health checks selectable per stem.
+const (
+	HealthCheckHTTP = "http" // HEAD /
+	HealthCheckGRPC = "grpc" // grpc.health.v1.Health/Check, requires an HTTP/2 protocol
+)
+
+// GRPCHealthCheckPath is the method of the standard gRPC health checking protocol.
+const GRPCHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// IsHTTP2 reports whether the backend talks HTTP/2 to its servers.
+func (o BackendOptions) IsHTTP2() bool {
+	return o.Protocol == ProtocolH2C || o.Protocol == ProtocolH2
+}
+
+// RoutePath returns the URL path the backend serves requests under.
+func (o BackendOptions) RoutePath(backendName string) string {
+	if o.Path != "" {
+		return "/" + strings.TrimPrefix(o.Path, "/")
+	}
+	return "/" + backendName
+}
+
+// MatchesHost reports whether a request for host, as sent in the Host header, is routed to the backend.
+func (o BackendOptions) MatchesHost(host string) bool {
+	if o.Host == "" {
+		return true
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.EqualFold(host, o.Host)
+}
+
+// RewritePattern returns the regular expression matching the request paths under the route path, capturing
+// what follows the route path, and the prefix the capture is forwarded behind. For the route path /hello
+// rewritten to /v1, /hello/greet is forwarded as /v1/greet.
+func (o BackendOptions) RewritePattern(backendName string) (pattern, prefix string) {
+	return "^" + regexp.QuoteMeta(o.RoutePath(backendName)) + "/?(.*)$", strings.TrimSuffix(o.Rewrite, "/") + "/"
+}
+
+// RewritePath returns the path a request for path is forwarded with.
+func (o BackendOptions) RewritePath(backendName, path string) string {
+	if o.Rewrite == "" {
+		return path
+	}
+	pattern, prefix := o.RewritePattern(backendName)
+	return regexp.MustCompile(pattern).ReplaceAllString(path, prefix+"${1}")
+}
+
+// IsUDP reports whether the backend forwards datagrams instead of HTTP requests.
+func (o BackendOptions) IsUDP() bool {
+	return o.Transport == TransportUDP
+}
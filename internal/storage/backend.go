@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// DefaultBackendPrefix is the key prefix used by shared backends when none is configured.
+const DefaultBackendPrefix = "herbarium/"
+
+// Backend is a shared store mirroring HerbariumDB, so other herbarium replicas and external tools
+// can observe the same state. Each stem, including its leafs and graft node, is stored as one JSON document.
+type Backend interface {
+	PutStem(key StemKey, data []byte) error // Stores the JSON document of a stem.
+	DeleteStem(key StemKey) error           // Removes a stem.
+	LoadStems() ([][]byte, error)           // Returns the JSON documents of all stored stems.
+	Close() error                           // Releases the connection to the store.
+}
+
+// stemPath returns the backend key of a stem below prefix.
+func stemPath(prefix string, key StemKey) string {
+	return prefix + "stems/" + key.Name + "/" + key.Version
+}
+
+// SetBackend attaches a shared backend, or detaches it if backend is nil. Subsequent mutations are published to
+// it in the background; the state already stored in the backend is left untouched until PublishState,
+// Restore, or Replay.
+func (s *HerbariumDB) SetBackend(backend Backend) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.publisher != nil {
+		s.publisher.stop()
+		s.publisher = nil
+	}
+	if backend != nil {
+		s.publisher = newPublisher(backend)
+	}
+}
+
+// PublishState makes the shared backend match the whole current state, removing stems that no longer exist,
+// and waits until it does.
+func (s *HerbariumDB) PublishState() error {
+	_ = s.WithLock(func() error {
+		s.publishAll()
+		return nil
+	})
+	return s.FlushBackend()
+}
+
+// FlushBackend waits until the mutations made so far were written to the shared backend, e.g. before
+// closing it. It returns the error of the last full sync of the backend.
+func (s *HerbariumDB) FlushBackend() error {
+	s.mu.RLock()
+	publisher := s.publisher
+	s.mu.RUnlock()
+	if publisher == nil {
+		return nil
+	}
+	return publisher.flush()
+}
+
+// publish queues the current state of one stem for the backend, or its removal if the stem is gone. It must
+// be called while holding the write lock or the stem's lock, so the document is consistent; the backend is
+// written after the lock is released.
+func (s *HerbariumDB) publish(key StemKey) {
+	if s.publisher == nil {
+		return
+	}
+
+	stem, exists := s.Stems[key]
+	if !exists {
+		s.publisher.enqueue(key, nil)
+		return
+	}
+	data, err := json.Marshal(stem)
+	if err != nil {
+		log.Printf("Failed to encode stem %s version %s for the shared backend: %v", key.Name, key.Version, err)
+		return
+	}
+	s.publisher.enqueue(key, data)
+}
+
+// publishAll queues the whole in-memory state for the backend, and the removal of the stems it holds that no
+// longer exist. It must be called while holding the write lock.
+func (s *HerbariumDB) publishAll() {
+	if s.publisher == nil {
+		return
+	}
+
+	documents := make(map[StemKey][]byte, len(s.Stems))
+	for key, stem := range s.Stems {
+		data, err := json.Marshal(stem)
+		if err != nil {
+			log.Printf("Failed to encode stem %s version %s for the shared backend: %v", key.Name, key.Version, err)
+			continue
+		}
+		documents[key] = data
+	}
+	s.publisher.sync(documents)
+}
+
+// LoadBackendSnapshot reads the state stored in a backend as a snapshot, so it can be restored
+// like a snapshot file, e.g. when a standby replica takes over.
+func LoadBackendSnapshot(backend Backend) (*Snapshot, error) {
+	stored, err := backend.LoadStems()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stems from the shared backend: %v", err)
+	}
+
+	snapshot := &Snapshot{FormatVersion: SnapshotFormatVersion, Stems: make([]*models.Stem, 0, len(stored))}
+	for _, data := range stored {
+		var stem models.Stem
+		if err := json.Unmarshal(data, &stem); err != nil {
+			return nil, fmt.Errorf("failed to decode stem from the shared backend: %v", err)
+		}
+		snapshot.Stems = append(snapshot.Stems, &stem)
+	}
+	return snapshot, nil
+}
+
+// NewBackend creates the shared backend of the given kind. An empty kind or "memory" means no
+// shared backend and returns nil. The file backend stores the state in the directory path.
+func NewBackend(kind, address, username, password string, db int, prefix, path string) (Backend, error) {
+	if prefix == "" {
+		prefix = DefaultBackendPrefix
+	}
+	switch strings.ToLower(kind) {
+	case "", "memory":
+		return nil, nil
+	case "file":
+		return NewFileBackend(path)
+	case "redis":
+		return NewRedisBackend(address, password, db, prefix)
+	case "etcd":
+		return NewEtcdBackend(address, username, password, prefix)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", kind)
+	}
+}
+
+// Lease is implemented by shared backends that can arbitrate leadership between herbarium replicas.
+// A lease expires unless its holder renews it within its TTL.
+type Lease interface {
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error) // Acquires or renews the lease, reporting whether holder owns it.
+	ReleaseLease(name, holder string) error                            // Gives up the lease if holder owns it.
+}
+
+// leasePath returns the backend key of a lease below prefix.
+func leasePath(prefix, name string) string {
+	return prefix + "leases/" + name
+}
@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis serves the subset of Redis commands used by RedisBackend from an in-memory map.
+type fakeRedis struct {
+	mu        sync.Mutex
+	data      map[string]string
+	published []string
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeRedis{data: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, password)
+		}
+	}()
+	return server, listener.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn, password string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := password == ""
+	for {
+		request, err := readRESP(reader)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range request.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		f.mu.Lock()
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[1] == password
+			reply = "+OK\r\n"
+			if !authenticated {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SET":
+			f.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			value, ok := f.data[args[1]]
+			reply = "$-1\r\n"
+			if ok {
+				reply = bulk(value)
+			}
+		case args[0] == "DEL":
+			delete(f.data, args[1])
+			reply = ":1\r\n"
+		case args[0] == "PUBLISH":
+			f.published = append(f.published, args[2])
+			reply = ":0\r\n"
+		case args[0] == "EVAL" && args[1] == redisAcquireLease:
+			holder, held := f.data[args[3]]
+			reply = ":0\r\n"
+			if !held || holder == args[4] {
+				f.data[args[3]] = args[4]
+				reply = ":1\r\n"
+			}
+		case args[0] == "EVAL" && args[1] == redisReleaseLease:
+			reply = ":0\r\n"
+			if f.data[args[3]] == args[4] {
+				delete(f.data, args[3])
+				reply = ":1\r\n"
+			}
+		case args[0] == "SCAN":
+			var keys []string
+			for key := range f.data {
+				// Patterns used by RedisBackend are an escaped prefix followed by *
+				if strings.HasPrefix(key, strings.ReplaceAll(strings.TrimSuffix(args[3], "*"), `\`, "")) {
+					keys = append(keys, bulk(key))
+				}
+			}
+			reply = fmt.Sprintf("*2\r\n%s*%d\r\n%s", bulk("0"), len(keys), strings.Join(keys, ""))
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func bulk(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+func TestRedisBackend(t *testing.T) {
+	server, address := startFakeRedis(t, "secret")
+
+	_, err := NewRedisBackend(address, "wrong", 0, DefaultBackendPrefix)
+	assert.Error(t, err)
+
+	backend, err := NewRedisBackend(address, "secret", 0, DefaultBackendPrefix)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer backend.Close()
+
+	api := StemKey{Name: "api", Version: "v1"}
+	assert.NoError(t, backend.PutStem(api, []byte(`{"Name":"api"}`)))
+	assert.NoError(t, backend.PutStem(StemKey{Name: "worker", Version: "v1"}, []byte(`{"Name":"worker"}`)))
+	assert.NoError(t, backend.DeleteStem(StemKey{Name: "worker", Version: "v1"}))
+	assert.Equal(t, `{"Name":"api"}`, server.data["herbarium/stems/api/v1"])
+	assert.Equal(t, []string{"herbarium/stems/api/v1", "herbarium/stems/worker/v1", "herbarium/stems/worker/v1"}, server.published)
+
+	// A dropped connection is re-established transparently
+	backend.conn.Close()
+	stems, err := backend.LoadStems()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"Name":"api"}`)}, stems)
+}
+
+func TestFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	api := StemKey{Name: "api", Version: "v1"}
+	assert.NoError(t, backend.PutStem(api, []byte(`{"Name":"api","Version":"v0"}`)))
+	assert.NoError(t, backend.PutStem(api, []byte(`{"Name":"api","Version":"v1"}`)))
+	assert.NoError(t, backend.PutStem(StemKey{Name: "worker", Version: "v1"}, []byte(`{"Name":"worker"}`)))
+	assert.NoError(t, backend.DeleteStem(StemKey{Name: "worker", Version: "v1"}))
+	assert.NoError(t, backend.DeleteStem(StemKey{Name: "missing", Version: "v1"}))
+	assert.NoError(t, backend.Close())
+
+	// Names and versions can't escape the directory
+	assert.NoError(t, backend.PutStem(StemKey{Name: "../etc", Version: "1/2"}, []byte(`{"Name":"../etc"}`)))
+	assert.FileExists(t, filepath.Join(dir, "stems", "..%2Fetc", "1%2F2.json"))
+	assert.NoError(t, backend.PutStem(StemKey{Name: "..", Version: "."}, []byte(`{"Name":".."}`)))
+	assert.FileExists(t, filepath.Join(dir, "stems", "%2E%2E", "%2E.json"))
+
+	// The state outlives the backend that wrote it
+	reopened, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	stems, err := reopened.LoadStems()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]byte{[]byte(`{"Name":"../etc"}`), []byte(`{"Name":".."}`), []byte(`{"Name":"api","Version":"v1"}`)}, stems)
+	assert.NoDirExists(t, filepath.Join(dir, "stems", "worker"))
+
+	_, err = NewBackend("file", "", "", "", 0, "", "")
+	assert.Error(t, err, "the file backend needs a path")
+}
+
+func TestEtcdBackend(t *testing.T) {
+	data := map[string][]byte{}
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var request struct {
+			Key      []byte `json:"key"`
+			Value    []byte `json:"value"`
+			RangeEnd []byte `json:"range_end"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		switch r.URL.Path {
+		case "/v3/kv/put":
+			data[string(request.Key)] = request.Value
+			w.Write([]byte(`{}`))
+		case "/v3/kv/deleterange":
+			delete(data, string(request.Key))
+			w.Write([]byte(`{}`))
+		case "/v3/kv/range":
+			kvs := []etcdKeyValue{}
+			for key, value := range data {
+				if key >= string(request.Key) && key < string(request.RangeEnd) {
+					kvs = append(kvs, etcdKeyValue{Key: []byte(key), Value: value})
+				}
+			}
+			sort.Slice(kvs, func(i, j int) bool { return string(kvs[i].Key) < string(kvs[j].Key) })
+			json.NewEncoder(w).Encode(map[string]interface{}{"kvs": kvs})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	backend, err := NewEtcdBackend(server.URL, "", "", "plantarium/")
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+
+	assert.NoError(t, backend.PutStem(StemKey{Name: "api", Version: "v1"}, []byte(`{"Name":"api"}`)))
+	assert.NoError(t, backend.PutStem(StemKey{Name: "api", Version: "v2"}, []byte(`{"Name":"api","Version":"v2"}`)))
+	assert.NoError(t, backend.DeleteStem(StemKey{Name: "api", Version: "v1"}))
+	data["plantarium/unrelated"] = []byte("x")
+
+	stems, err := backend.LoadStems()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"Name":"api","Version":"v2"}`)}, stems)
+}
+
+func TestHerbariumDB_PublishesToBackend(t *testing.T) {
+	_, address := startFakeRedis(t, "")
+	backend, err := NewRedisBackend(address, "", 0, DefaultBackendPrefix)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer backend.Close()
+
+	// A stem left behind by a previous run
+	assert.NoError(t, backend.PutStem(StemKey{Name: "stale", Version: "v1"}, []byte(`{"Name":"stale","Version":"v1"}`)))
+
+	db := &HerbariumDB{Stems: map[StemKey]*models.Stem{}}
+	db.SetBackend(backend)
+	key := StemKey{Name: "api", Version: "v1"}
+	_ = db.WithLock(func() error {
+		db.Stems[key] = &models.Stem{Name: "api", Version: "v1", LeafInstances: map[string]*models.Leaf{"leaf-1": {ID: "leaf-1", Port: 8001}}}
+		db.Record(JournalEntry{Op: OpStemSaved, StemKey: key})
+		return nil
+	})
+	assert.NoError(t, db.FlushBackend())
+
+	// The backend can be restored like a snapshot
+	snapshot, err := LoadBackendSnapshot(backend)
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.Stems, 2)
+
+	assert.NoError(t, db.PublishState())
+	snapshot, err = LoadBackendSnapshot(backend)
+	assert.NoError(t, err)
+	if assert.Len(t, snapshot.Stems, 1) {
+		assert.Equal(t, 8001, snapshot.Stems[0].LeafInstances["leaf-1"].Port)
+	}
+}
+
+// slowBackend holds every write until it is released, recording the documents written.
+type slowBackend struct {
+	mu      sync.Mutex
+	release chan struct{}
+	writes  []string
+}
+
+func (b *slowBackend) PutStem(key StemKey, data []byte) error {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writes = append(b.writes, string(data))
+	return nil
+}
+
+func (b *slowBackend) DeleteStem(key StemKey) error {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writes = append(b.writes, "deleted "+key.Name)
+	return nil
+}
+
+func (b *slowBackend) LoadStems() ([][]byte, error) { return nil, nil }
+func (b *slowBackend) Close() error                 { return nil }
+
+func TestHerbariumDB_PublishesInBackground(t *testing.T) {
+	backend := &slowBackend{release: make(chan struct{})}
+	db := &HerbariumDB{Stems: map[StemKey]*models.Stem{}}
+	db.SetBackend(backend)
+	defer db.SetBackend(nil)
+	key := StemKey{Name: "api", Version: "v1"}
+
+	// Mutations don't wait for the backend, while the first write is held
+	mutate := func(restarts int) {
+		done := make(chan struct{})
+		go func() {
+			_ = db.WithLock(func() error {
+				db.Stems[key] = &models.Stem{Name: "api", Version: "v1", Restarts: restarts}
+				db.Record(JournalEntry{Op: OpStemSaved, StemKey: key})
+				return nil
+			})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("mutation waited for the backend")
+		}
+	}
+	mutate(1)
+	assert.Eventually(t, func() bool {
+		db.publisher.mu.Lock()
+		defer db.publisher.mu.Unlock()
+		return db.publisher.busy && len(db.publisher.queue) == 0
+	}, 5*time.Second, time.Millisecond)
+	for restarts := 2; restarts <= 5; restarts++ {
+		mutate(restarts)
+	}
+
+	// The writes queued while the first one was held are coalesced into one of the latest document
+	close(backend.release)
+	assert.NoError(t, db.FlushBackend())
+	if assert.Len(t, backend.writes, 2) {
+		assert.Contains(t, backend.writes[0], `"Restarts":1`)
+		assert.Contains(t, backend.writes[1], `"Restarts":5`)
+	}
+}
+
+func TestRedisBackend_Lease(t *testing.T) {
+	server, address := startFakeRedis(t, "")
+	backend, err := NewRedisBackend(address, "", 0, DefaultBackendPrefix)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer backend.Close()
+
+	acquired, err := backend.AcquireLease("leader", "a", 15*time.Second)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Equal(t, "a", server.data["herbarium/leases/leader"])
+
+	acquired, err = backend.AcquireLease("leader", "b", 15*time.Second)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	// Only the holder can release the lease
+	assert.NoError(t, backend.ReleaseLease("leader", "b"))
+	assert.Equal(t, "a", server.data["herbarium/leases/leader"])
+	assert.NoError(t, backend.ReleaseLease("leader", "a"))
+
+	acquired, err = backend.AcquireLease("leader", "b", 15*time.Second)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+}
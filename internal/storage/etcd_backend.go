@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// EtcdBackend stores stems as etcd keys under <prefix>stems/<name>/<version>, using the etcd v3
+// JSON gateway. Observers can follow changes with a watch on the prefix.
+type EtcdBackend struct {
+	client   *resty.Client
+	username string
+	password string
+	prefix   string
+	mu       sync.Mutex
+	leaseIDs map[string]string // etcd lease IDs of the leases held by this backend, by lease name
+}
+
+// etcdKeyValue is a key-value pair as encoded by the etcd JSON gateway; byte slices are base64 in JSON.
+type etcdKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+// NewEtcdBackend creates a backend for the etcd endpoint (e.g. http://localhost:2379), authenticating
+// with username and password when a username is set.
+func NewEtcdBackend(endpoint, username, password, prefix string) (*EtcdBackend, error) {
+	if endpoint == "" {
+		endpoint = "http://localhost:2379"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	client := resty.New()
+	client.SetBaseURL(strings.TrimSuffix(endpoint, "/"))
+	client.SetTimeout(5 * time.Second)
+	client.SetDisableWarn(true)
+
+	backend := &EtcdBackend{client: client, username: username, password: password, prefix: prefix, leaseIDs: map[string]string{}}
+	if username != "" {
+		if err := backend.authenticate(); err != nil {
+			return nil, err
+		}
+	}
+	return backend, nil
+}
+
+// authenticate obtains a new auth token and attaches it to every request.
+func (e *EtcdBackend) authenticate() error {
+	var result struct {
+		Token string `json:"token"`
+	}
+	resp, err := e.client.R().
+		SetBody(map[string]string{"name": e.username, "password": e.password}).
+		Post("/v3/auth/authenticate")
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with etcd: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("failed to authenticate with etcd, status code: %d, response: %s", resp.StatusCode(), resp.String())
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return fmt.Errorf("failed to decode etcd authentication response: %v", err)
+	}
+	e.client.SetHeader("Authorization", result.Token)
+	return nil
+}
+
+// call posts body to an etcd gateway endpoint, re-authenticating once if the token has expired.
+func (e *EtcdBackend) call(path string, body, result interface{}) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := e.client.R().SetBody(body).Post(path)
+		if err != nil {
+			return fmt.Errorf("etcd request %s failed: %v", path, err)
+		}
+		if resp.StatusCode() == http.StatusOK {
+			if result == nil {
+				return nil
+			}
+			if err := json.Unmarshal(resp.Body(), result); err != nil {
+				return fmt.Errorf("failed to decode etcd response from %s: %v", path, err)
+			}
+			return nil
+		}
+		if e.username == "" || attempt > 0 || !strings.Contains(resp.String(), "token") {
+			return fmt.Errorf("etcd request %s failed, status code: %d, response: %s", path, resp.StatusCode(), resp.String())
+		}
+		if err := e.authenticate(); err != nil {
+			return err
+		}
+	}
+}
+
+// PutStem stores the JSON document of a stem.
+func (e *EtcdBackend) PutStem(key StemKey, data []byte) error {
+	return e.call("/v3/kv/put", etcdKeyValue{Key: []byte(stemPath(e.prefix, key)), Value: data}, nil)
+}
+
+// DeleteStem removes a stem.
+func (e *EtcdBackend) DeleteStem(key StemKey) error {
+	return e.call("/v3/kv/deleterange", etcdKeyValue{Key: []byte(stemPath(e.prefix, key))}, nil)
+}
+
+// LoadStems returns the JSON documents of all stems stored under the prefix.
+func (e *EtcdBackend) LoadStems() ([][]byte, error) {
+	prefix := []byte(e.prefix + "stems/")
+	var result struct {
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	request := struct {
+		Key      []byte `json:"key"`
+		RangeEnd []byte `json:"range_end"`
+	}{Key: prefix, RangeEnd: prefixRangeEnd(prefix)}
+	if err := e.call("/v3/kv/range", request, &result); err != nil {
+		return nil, err
+	}
+
+	stems := make([][]byte, 0, len(result.Kvs))
+	for _, kv := range result.Kvs {
+		stems = append(stems, kv.Value)
+	}
+	return stems, nil
+}
+
+// AcquireLease renews the etcd lease backing <prefix>leases/<name> if this backend holds it, or creates
+// the key with a new lease if nobody holds it. The key disappears when the lease expires.
+func (e *EtcdBackend) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if id, held := e.leaseIDs[name]; held {
+		var keepAlive struct {
+			Result struct {
+				TTL string `json:"TTL"`
+			} `json:"result"`
+		}
+		if err := e.call("/v3/lease/keepalive", map[string]string{"ID": id}, &keepAlive); err != nil {
+			return false, err
+		}
+		if remaining, _ := strconv.ParseInt(keepAlive.Result.TTL, 10, 64); remaining > 0 {
+			return true, nil
+		}
+		// The lease expired before it was renewed
+		delete(e.leaseIDs, name)
+	}
+
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	if err := e.call("/v3/lease/grant", map[string]string{"TTL": strconv.FormatInt(seconds, 10)}, &grant); err != nil {
+		return false, err
+	}
+
+	key := []byte(leasePath(e.prefix, name))
+	txn := map[string]interface{}{
+		"compare": []map[string]interface{}{{"key": key, "target": "CREATE", "result": "EQUAL", "create_revision": "0"}},
+		"success": []map[string]interface{}{{"request_put": map[string]interface{}{"key": key, "value": []byte(holder), "lease": grant.ID}}},
+	}
+	var result struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := e.call("/v3/kv/txn", txn, &result); err != nil {
+		return false, err
+	}
+	if !result.Succeeded {
+		if err := e.call("/v3/lease/revoke", map[string]string{"ID": grant.ID}, nil); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	e.leaseIDs[name] = grant.ID
+	return true, nil
+}
+
+// ReleaseLease revokes the lease if this backend holds it, which deletes its key.
+func (e *EtcdBackend) ReleaseLease(name, holder string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id, held := e.leaseIDs[name]
+	if !held {
+		return nil
+	}
+	delete(e.leaseIDs, name)
+	return e.call("/v3/lease/revoke", map[string]string{"ID": id}, nil)
+}
+
+// Close is a no-op; the gateway is stateless HTTP.
+func (e *EtcdBackend) Close() error {
+	return nil
+}
+
+// prefixRangeEnd returns the smallest key greater than every key starting with prefix, as etcd expects for prefix ranges.
+func prefixRangeEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
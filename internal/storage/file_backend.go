@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileBackend stores stems as JSON files under <dir>/stems/<name>/<version>.json, so the state outlives
+// herbarium on a single host without running a database. Names and versions are path-escaped, with the dots of
+// "." and ".." escaped as well, and every file is replaced atomically, so a crash never leaves a half-written stem behind.
+type FileBackend struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileBackend stores stems below dir, creating it if needed.
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if dir == "" {
+		return nil, errors.New("the file storage backend needs a path")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "stems"), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %v", dir, err)
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+// stemFile returns the file a stem is stored in.
+func (f *FileBackend) stemFile(key StemKey) string {
+	return filepath.Join(f.dir, "stems", escapePathSegment(key.Name), escapePathSegment(key.Version)+".json")
+}
+
+// escapePathSegment path-escapes s, including the dots of "." and "..", which url.PathEscape leaves as they are.
+func escapePathSegment(s string) string {
+	escaped := url.PathEscape(s)
+	if escaped == "." || escaped == ".." {
+		escaped = strings.ReplaceAll(escaped, ".", "%2E")
+	}
+	return escaped
+}
+
+// PutStem writes the JSON document of a stem to a temporary file and renames it over the previous one.
+func (f *FileBackend) PutStem(key StemKey, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := f.stemFile(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".stem-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// DeleteStem removes the file of a stem, and its name's directory once it holds no other version.
+func (f *FileBackend) DeleteStem(key StemKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := f.stemFile(key)
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	_ = os.Remove(filepath.Dir(path)) // Fails while other versions remain
+	return nil
+}
+
+// LoadStems returns the JSON documents of all stored stems.
+func (f *FileBackend) LoadStems() ([][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var stems [][]byte
+	err := filepath.WalkDir(filepath.Join(f.dir, "stems"), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		stems = append(stems, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stems, nil
+}
+
+// Close has nothing to release, as every write is complete when PutStem or DeleteStem returns.
+func (f *FileBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// JournalOp identifies the kind of state mutation recorded in a journal entry.
+type JournalOp string
+
+const (
+	OpStemSaved         JournalOp = "stem.saved"    // A stem was registered
+	OpStemDeleted       JournalOp = "stem.deleted"  // A stem was removed, and kept as a tombstone if the entry carries it
+	OpStemPurged        JournalOp = "stem.purged"   // The tombstone of a removed stem was purged
+	OpStemUpdated       JournalOp = "stem.updated"  // A stem's version and config were replaced
+	OpLeafAdded         JournalOp = "leaf.added"    // A leaf was added to a stem
+	OpLeafRemoved       JournalOp = "leaf.removed"  // A leaf was removed from a stem
+	OpLeafStatusChanged JournalOp = "leaf.status"   // A leaf changed status
+	OpLeafStage         JournalOp = "leaf.stage"    // A stage was added to a leaf's status history
+	OpGraftNodeSet      JournalOp = "graft.set"     // A stem's graft node was set
+	OpGraftNodeCleared  JournalOp = "graft.cleared" // A stem's graft node was cleared
+	OpStemMaintenance   JournalOp = "stem.maint"    // A stem's servers were put into or taken out of maintenance
+	OpStemRouted        JournalOp = "stem.routed"   // A stem was moved to another URL and backend
+	OpStemScaled        JournalOp = "stem.scaled"   // A stem's desired number of running leafs was set
+	OpStemRestarted     JournalOp = "stem.restart"  // A leaf of a stem was replaced or found dead
+	OpStemColdStart     JournalOp = "stem.cold"     // A graft node started a leaf for the requests it held
+	OpStemReplaced      JournalOp = "stem.replaced" // A stem was replaced by a compare-and-swap update
+	OpStemLeafStarted   JournalOp = "stem.started"  // A leaf of a stem was started
+	OpLeafReplaced      JournalOp = "leaf.replaced" // A leaf was replaced by a compare-and-swap update
+	OpVersionKept       JournalOp = "version.kept"  // An entry of a stem's version history was stored
+)
+
+// JournalEntry is a single state mutation. Only the fields relevant to Op are set.
+type JournalEntry struct {
+	Seq     uint64              `json:"seq"`
+	Time    time.Time           `json:"time"`
+	Op      JournalOp           `json:"op"`
+	StemKey StemKey             `json:"stemKey"`
+	LeafID  string              `json:"leafId,omitempty"`
+	Stem    *models.Stem        `json:"stem,omitempty"`    // OpStemSaved, OpStemReplaced, OpStemDeleted for tombstones
+	Leaf    *models.Leaf        `json:"leaf,omitempty"`    // OpLeafAdded, OpGraftNodeSet, OpLeafReplaced
+	Status  models.LeafStatus   `json:"status,omitempty"`  // OpLeafStatusChanged
+	Stage   *models.LeafStage   `json:"stage,omitempty"`   // OpLeafStage
+	Version string              `json:"version,omitempty"` // OpStemUpdated
+	Config  *models.StemConfig  `json:"config,omitempty"`  // OpStemUpdated
+	Enabled bool                `json:"enabled,omitempty"` // OpStemMaintenance
+	URL     string              `json:"url,omitempty"`     // OpStemRouted
+	Backend string              `json:"backend,omitempty"` // OpStemRouted
+	Desired *int                `json:"desired,omitempty"` // OpStemScaled, nil to follow minInstances
+	Cold    *models.ColdStart   `json:"cold,omitempty"`    // OpStemColdStart
+	History *models.StemVersion `json:"history,omitempty"` // OpVersionKept
+}
+
+// Journal records state mutations in order. Append is called while holding the HerbariumDB write lock or
+// the lock of the mutated stem, so the entries of a stem are recorded in the order its mutations were
+// applied. Mutations of different stems may be appended concurrently.
+type Journal interface {
+	Append(entry *JournalEntry) error // Assigns Seq and Time, then persists the entry.
+	LastSeq() uint64                  // Sequence number of the last appended entry.
+}
+
+// SetJournal attaches a journal that records every subsequent mutation made through the repositories.
+func (s *HerbariumDB) SetJournal(journal Journal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.journal = journal
+}
+
+// Record appends a mutation to the attached journal, if any, queues the affected stem for the shared
+// backend, if any, and passes the mutation to the watchers. It must be called while holding the write lock
+// or the lock of the mutated stem, after the mutation was applied, and bumps the revision of the changed stem or leaf before journaling it.
+// A failure to journal does not undo the mutation; it is logged instead.
+func (s *HerbariumDB) Record(entry JournalEntry) {
+	s.revise(entry)
+	if s.journal != nil {
+		if err := s.journal.Append(&entry); err != nil {
+			log.Printf("Failed to journal %s for stem %s version %s: %v", entry.Op, entry.StemKey.Name, entry.StemKey.Version, err)
+		}
+	}
+	s.publish(entry.StemKey)
+	s.notify(entry)
+	if entry.Op == OpStemDeleted {
+		s.forgetStemLock(entry.StemKey)
+	}
+}
+
+// Replay applies journal entries to the current state without journaling them again.
+func (s *HerbariumDB) Replay(entries []JournalEntry) error {
+	return s.WithLock(func() error {
+		for _, entry := range entries {
+			if err := s.apply(entry); err != nil {
+				return fmt.Errorf("failed to replay journal entry %d (%s): %v", entry.Seq, entry.Op, err)
+			}
+		}
+		s.publishAll()
+		s.notify(JournalEntry{Op: OpStateReset})
+		return nil
+	})
+}
+
+// revise bumps the revision of the stem or leaf changed by entry. Removals bump nothing, since the record
+// is gone.
+func (s *HerbariumDB) revise(entry JournalEntry) {
+	stem, exists := s.Stems[entry.StemKey]
+	if !exists {
+		return
+	}
+	switch entry.Op {
+	case OpLeafAdded, OpLeafStatusChanged, OpLeafStage, OpLeafReplaced:
+		if leaf, ok := stem.LeafInstances[entry.LeafID]; ok {
+			leaf.Revision++
+		}
+	case OpStemDeleted, OpLeafRemoved, OpStemPurged, OpVersionKept:
+	default:
+		stem.Revision++
+	}
+}
+
+// apply performs the mutation described by entry. Mutations of stems or leafs that no longer
+// exist are skipped, since later entries may refer to state removed by a restore.
+func (s *HerbariumDB) apply(entry JournalEntry) error {
+	if entry.Op == OpStemSaved {
+		if entry.Stem == nil {
+			return fmt.Errorf("missing stem state")
+		}
+		if entry.Stem.LeafInstances == nil {
+			entry.Stem.LeafInstances = make(map[string]*models.Leaf)
+		}
+		s.Stems[entry.StemKey] = entry.Stem
+		return nil
+	}
+	if entry.Op == OpStemPurged {
+		delete(s.Tombstones, entry.StemKey)
+		return nil
+	}
+	if entry.Op == OpVersionKept {
+		if entry.History == nil {
+			return fmt.Errorf("missing version history entry")
+		}
+		s.keepVersion(entry.History)
+		return nil
+	}
+
+	stem, exists := s.Stems[entry.StemKey]
+	if !exists {
+		return nil
+	}
+
+	// Entries carrying the whole record were journaled with its revision already bumped
+	switch entry.Op {
+	case OpStemReplaced:
+		if entry.Stem == nil {
+			return fmt.Errorf("missing stem state")
+		}
+		entry.Stem.LeafInstances = stem.LeafInstances
+		s.Stems[entry.StemKey] = entry.Stem
+		return nil
+	case OpLeafAdded, OpLeafReplaced:
+		if entry.Leaf == nil {
+			return fmt.Errorf("missing leaf state")
+		}
+		if _, ok := stem.LeafInstances[entry.LeafID]; ok || entry.Op == OpLeafAdded {
+			stem.LeafInstances[entry.LeafID] = entry.Leaf
+		}
+		return nil
+	}
+	s.revise(entry)
+
+	switch entry.Op {
+	case OpStemDeleted:
+		delete(s.Stems, entry.StemKey)
+		s.forgetStemLock(entry.StemKey)
+		if entry.Stem != nil {
+			s.bury(entry.StemKey, entry.Stem)
+		}
+	case OpStemUpdated:
+		stem.Version = entry.Version
+		stem.Config = entry.Config
+		if entry.Config != nil {
+			stem.Environment = entry.Config.Env
+		}
+	case OpLeafRemoved:
+		delete(stem.LeafInstances, entry.LeafID)
+	case OpLeafStatusChanged:
+		if leaf, ok := stem.LeafInstances[entry.LeafID]; ok {
+			leaf.Status = entry.Status
+		}
+	case OpLeafStage:
+		if entry.Stage == nil {
+			return fmt.Errorf("missing leaf stage")
+		}
+		if leaf, ok := stem.LeafInstances[entry.LeafID]; ok {
+			leaf.History = append(leaf.History, *entry.Stage)
+		}
+	case OpGraftNodeSet:
+		stem.GraftNodeLeaf = entry.Leaf
+	case OpGraftNodeCleared:
+		stem.GraftNodeLeaf = nil
+	case OpStemMaintenance:
+		stem.Maintenance = entry.Enabled
+	case OpStemRouted:
+		stem.WorkingURL, stem.HAProxyBackend = entry.URL, entry.Backend
+	case OpStemScaled:
+		stem.Replicas = entry.Desired
+	case OpStemRestarted:
+		stem.Restarts++
+	case OpStemLeafStarted:
+		stem.LeafStarts++
+	case OpStemColdStart:
+		if entry.Cold == nil {
+			return fmt.Errorf("missing cold start")
+		}
+		stem.ColdStarts.Add(*entry.Cold)
+	default:
+		return fmt.Errorf("unknown operation %q", entry.Op)
+	}
+	return nil
+}
+
+// JournalQuery selects journal entries. Zero values disable the corresponding filter.
+type JournalQuery struct {
+	AfterSeq uint64    // Only entries with a greater sequence number
+	Since    time.Time // Only entries at or after this time
+	Until    time.Time // Only entries before this time
+	StemName string    // Only entries for this stem
+	Limit    int       // Maximum number of entries to return, 0 means no limit
+}
+
+func (q JournalQuery) matches(entry JournalEntry) bool {
+	if entry.Seq <= q.AfterSeq {
+		return false
+	}
+	if !q.Since.IsZero() && entry.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !entry.Time.Before(q.Until) {
+		return false
+	}
+	if q.StemName != "" && entry.StemKey.Name != q.StemName {
+		return false
+	}
+	return true
+}
+
+// FileJournal is a Journal stored as an append-only file of JSON lines.
+type FileJournal struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	seq   uint64
+	fsync bool
+}
+
+// OpenFileJournal opens or creates the journal at path, continuing the sequence of existing entries.
+// With fsync set, every entry is flushed to disk before Append returns.
+func OpenFileJournal(path string, fsync bool) (*FileJournal, error) {
+	entries, err := ReadJournalFile(path, JournalQuery{})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %v", path, err)
+	}
+
+	// Terminate a line truncated by a crash, so the next entry starts on its own line
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if reader, err := os.Open(path); err == nil {
+			_, readErr := reader.ReadAt(last, info.Size()-1)
+			reader.Close()
+			if readErr == nil && last[0] != '\n' {
+				if _, err := file.Write([]byte{'\n'}); err != nil {
+					file.Close()
+					return nil, fmt.Errorf("failed to repair journal %s: %v", path, err)
+				}
+			}
+		}
+	}
+
+	journal := &FileJournal{path: path, file: file, fsync: fsync}
+	if len(entries) > 0 {
+		journal.seq = entries[len(entries)-1].Seq
+	}
+	return journal, nil
+}
+
+// Append assigns the next sequence number and the current time to entry and writes it.
+func (j *FileJournal) Append(entry *JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry.Seq = j.seq + 1
+	entry.Time = time.Now().UTC()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %v", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %v", err)
+	}
+	if j.fsync {
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync journal: %v", err)
+		}
+	}
+	j.seq = entry.Seq
+	return nil
+}
+
+// LastSeq returns the sequence number of the last appended entry.
+func (j *FileJournal) LastSeq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// Size returns the size of the journal file in bytes, 0 if it can't be read.
+func (j *FileJournal) Size() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info, err := j.file.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Query returns the journal entries matching query, oldest first.
+func (j *FileJournal) Query(query JournalQuery) ([]JournalEntry, error) {
+	return ReadJournalFile(j.path, query)
+}
+
+// Close closes the journal file.
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// ReadJournalFile reads the entries of a journal file matching query, oldest first. A truncated
+// last line, left behind by a crash mid-write, is ignored.
+func ReadJournalFile(path string, query JournalQuery) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Ignoring unreadable journal entry at %s:%d: %v", path, line, err)
+			continue
+		}
+		if !query.matches(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+		if query.Limit > 0 && len(entries) >= query.Limit {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal %s: %v", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileJournal_AppendAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := OpenFileJournal(path, true)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+
+	key := StemKey{Name: "api", Version: "v1"}
+	assert.NoError(t, journal.Append(&JournalEntry{Op: OpStemSaved, StemKey: key, Stem: &models.Stem{Name: "api", Version: "v1"}}))
+	assert.NoError(t, journal.Append(&JournalEntry{Op: OpLeafAdded, StemKey: key, LeafID: "leaf-1", Leaf: &models.Leaf{ID: "leaf-1"}}))
+	assert.Equal(t, uint64(2), journal.LastSeq())
+	assert.NoError(t, journal.Close())
+
+	// Simulate a crash in the middle of writing an entry
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"seq":3,"op":"leaf.rem`)
+	assert.NoError(t, err)
+	file.Close()
+
+	// Reopening continues the sequence after the last complete entry
+	journal, err = OpenFileJournal(path, false)
+	if err != nil {
+		t.Fatalf("failed to reopen journal: %v", err)
+	}
+	defer journal.Close()
+	assert.Equal(t, uint64(2), journal.LastSeq())
+	assert.NoError(t, journal.Append(&JournalEntry{Op: OpLeafStatusChanged, StemKey: key, LeafID: "leaf-1", Status: models.StatusStopping}))
+
+	entries, err := journal.Query(JournalQuery{})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, uint64(3), entries[2].Seq)
+	}
+
+	entries, err = journal.Query(JournalQuery{AfterSeq: 1, Limit: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, OpLeafAdded, entries[0].Op)
+	}
+
+	// Replaying the journal rebuilds the state
+	db := &HerbariumDB{Stems: map[StemKey]*models.Stem{}}
+	entries, _ = journal.Query(JournalQuery{})
+	assert.NoError(t, db.Replay(entries))
+	assert.Equal(t, models.StatusStopping, db.Stems[key].LeafInstances["leaf-1"].Status)
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// publisher mirrors stems to a shared backend in the background, so mutations never wait on the network and
+// a slow backend doesn't hold up the state locks. A stem queued again before its write started is written
+// once, with its latest document. A single worker writes, so the writes of a stem happen in the order they
+// were queued. Failures are logged; the in-memory state stays authoritative.
+type publisher struct {
+	backend Backend
+	mu      sync.Mutex
+	cond    *sync.Cond         // Signaled when work is queued, the worker goes idle, or the publisher stops
+	pending map[StemKey][]byte // Latest document of each queued stem, nil to remove the stem
+	queue   []StemKey          // Queued stems, in the order they were first queued
+	live    map[StemKey]bool   // Stems to keep when a full sync prunes the backend, nil when none is queued
+	busy    bool               // Whether the worker is talking to the backend
+	syncErr error              // Error of the last full sync
+	stopped bool
+}
+
+// newPublisher starts a publisher writing to backend.
+func newPublisher(backend Backend) *publisher {
+	p := &publisher{backend: backend, pending: make(map[StemKey][]byte)}
+	p.cond = sync.NewCond(&p.mu)
+	go p.run()
+	return p
+}
+
+// enqueue queues the document of a stem, nil to remove it, replacing a document of the stem still queued.
+func (p *publisher) enqueue(key StemKey, data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enqueueLocked(key, data)
+	p.cond.Broadcast()
+}
+
+func (p *publisher) enqueueLocked(key StemKey, data []byte) {
+	if _, queued := p.pending[key]; !queued {
+		p.queue = append(p.queue, key)
+	}
+	p.pending[key] = data
+}
+
+// sync queues the documents of all stems, and the removal of every other stem stored in the backend.
+func (p *publisher) sync(documents map[StemKey][]byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.live = make(map[StemKey]bool, len(documents))
+	for key, data := range documents {
+		p.live[key] = true
+		p.enqueueLocked(key, data)
+	}
+	p.syncErr = nil
+	p.cond.Broadcast()
+}
+
+// flush waits until everything queued so far was written, and returns the error of the last full sync.
+func (p *publisher) flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.stopped && (p.busy || p.live != nil || len(p.queue) > 0) {
+		p.cond.Wait()
+	}
+	return p.syncErr
+}
+
+// stop ends the worker once its current write is done. Queued writes are dropped.
+func (p *publisher) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	p.cond.Broadcast()
+}
+
+func (p *publisher) run() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		for !p.stopped && p.live == nil && len(p.queue) == 0 {
+			p.busy = false
+			p.cond.Broadcast()
+			p.cond.Wait()
+		}
+		if p.stopped {
+			p.busy = false
+			p.cond.Broadcast()
+			return
+		}
+		p.busy = true
+
+		// A full sync first removes the stems the backend holds that no longer exist
+		if live := p.live; live != nil {
+			p.live = nil
+			p.mu.Unlock()
+			stale, err := p.staleStems(live)
+			p.mu.Lock()
+			p.syncErr = err
+			for _, key := range stale {
+				if _, queued := p.pending[key]; !queued {
+					p.enqueueLocked(key, nil)
+				}
+			}
+			continue
+		}
+
+		key := p.queue[0]
+		p.queue = p.queue[1:]
+		data := p.pending[key]
+		delete(p.pending, key)
+		p.mu.Unlock()
+		p.write(key, data)
+		p.mu.Lock()
+	}
+}
+
+// staleStems returns the stems stored in the backend that are not live.
+func (p *publisher) staleStems(live map[StemKey]bool) ([]StemKey, error) {
+	stored, err := p.backend.LoadStems()
+	if err != nil {
+		log.Printf("Failed to load stems from the shared backend: %v", err)
+		return nil, fmt.Errorf("failed to load stems from the shared backend: %v", err)
+	}
+	var stale []StemKey
+	for _, data := range stored {
+		var stem models.Stem
+		if err := json.Unmarshal(data, &stem); err != nil {
+			continue
+		}
+		if key := (StemKey{Name: stem.Name, Version: stem.Version}); !live[key] {
+			stale = append(stale, key)
+		}
+	}
+	return stale, nil
+}
+
+// write stores the document of a stem in the backend, or removes the stem if data is nil.
+func (p *publisher) write(key StemKey, data []byte) {
+	if data == nil {
+		if err := p.backend.DeleteStem(key); err != nil {
+			log.Printf("Failed to remove stem %s version %s from the shared backend: %v", key.Name, key.Version, err)
+		}
+		return
+	}
+	if err := p.backend.PutStem(key, data); err != nil {
+		log.Printf("Failed to publish stem %s version %s to the shared backend: %v", key.Name, key.Version, err)
+	}
+}
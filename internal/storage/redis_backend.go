@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redisTimeout = 5 * time.Second
+
+// RedisBackend stores stems as Redis strings under <prefix>stems/<name>/<version>. Every change is also
+// published on the <prefix>events channel with the changed key, so observers can subscribe instead of polling.
+type RedisBackend struct {
+	mu       sync.Mutex
+	address  string
+	password string
+	db       int
+	prefix   string
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+// redisError is an error reply returned by the Redis server.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// NewRedisBackend connects to the Redis server at address ("host:port"), authenticating with password if set
+// and selecting database db.
+func NewRedisBackend(address, password string, db int, prefix string) (*RedisBackend, error) {
+	if address == "" {
+		address = "localhost:6379"
+	}
+	backend := &RedisBackend{address: address, password: password, db: db, prefix: prefix}
+	if err := backend.connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis at %s: %v", address, err)
+	}
+	return backend, nil
+}
+
+// connect opens a new connection and prepares it for use. It must be called while holding mu.
+func (r *RedisBackend) connect() error {
+	conn, err := net.DialTimeout("tcp", r.address, redisTimeout)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.reader = bufio.NewReader(conn)
+
+	if r.password != "" {
+		if _, err := r.roundTrip("AUTH", r.password); err != nil {
+			r.reset()
+			return fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+	if r.db != 0 {
+		if _, err := r.roundTrip("SELECT", strconv.Itoa(r.db)); err != nil {
+			r.reset()
+			return fmt.Errorf("failed to select database %d: %v", r.db, err)
+		}
+	}
+	return nil
+}
+
+// reset drops the current connection after a network error; the next command reconnects.
+func (r *RedisBackend) reset() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.conn = nil
+	r.reader = nil
+}
+
+// do sends a command and returns its reply, reconnecting once if the connection was lost.
+func (r *RedisBackend) do(args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if r.conn == nil {
+			if err := r.connect(); err != nil {
+				return nil, err
+			}
+		}
+		reply, err := r.roundTrip(args...)
+		if _, isReply := err.(redisError); err == nil || isReply || attempt > 0 {
+			return reply, err
+		}
+		r.reset()
+	}
+}
+
+// roundTrip writes one command in RESP format and reads its reply.
+func (r *RedisBackend) roundTrip(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	r.conn.SetDeadline(time.Now().Add(redisTimeout))
+	if _, err := io.WriteString(r.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readRESP(r.reader)
+}
+
+// readRESP reads a single RESP reply: a status string, error, integer, bulk string (nil if absent), or array.
+func readRESP(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readRESP(reader); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply %q", line)
+	}
+}
+
+// PutStem stores the JSON document of a stem and announces the change.
+func (r *RedisBackend) PutStem(key StemKey, data []byte) error {
+	path := stemPath(r.prefix, key)
+	if _, err := r.do("SET", path, string(data)); err != nil {
+		return err
+	}
+	_, err := r.do("PUBLISH", r.prefix+"events", path)
+	return err
+}
+
+// DeleteStem removes a stem and announces the change.
+func (r *RedisBackend) DeleteStem(key StemKey) error {
+	path := stemPath(r.prefix, key)
+	if _, err := r.do("DEL", path); err != nil {
+		return err
+	}
+	_, err := r.do("PUBLISH", r.prefix+"events", path)
+	return err
+}
+
+// LoadStems returns the JSON documents of all stems stored under the prefix.
+func (r *RedisBackend) LoadStems() ([][]byte, error) {
+	pattern := redisGlobEscaper.Replace(r.prefix+"stems/") + "*"
+
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := r.do("SCAN", cursor, "MATCH", pattern, "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return nil, fmt.Errorf("unexpected SCAN reply")
+		}
+		next, _ := page[0].([]byte)
+		batch, _ := page[1].([]interface{})
+		for _, key := range batch {
+			if key, ok := key.([]byte); ok {
+				keys = append(keys, string(key))
+			}
+		}
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+
+	stems := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		reply, err := r.do("GET", key)
+		if err != nil {
+			return nil, err
+		}
+		// The key may have been removed since the scan
+		if data, ok := reply.([]byte); ok {
+			stems = append(stems, data)
+		}
+	}
+	return stems, nil
+}
+
+// Close closes the connection.
+func (r *RedisBackend) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// redisAcquireLease renews the lease if ARGV[1] holds it, or takes it if nobody does.
+const redisAcquireLease = `
+local holder = redis.call('GET', KEYS[1])
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if not holder then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0`
+
+// redisReleaseLease deletes the lease only if ARGV[1] still holds it.
+const redisReleaseLease = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+// AcquireLease atomically renews or takes the lease stored under <prefix>leases/<name>.
+func (r *RedisBackend) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	reply, err := r.do("EVAL", redisAcquireLease, "1", leasePath(r.prefix, name), holder, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	acquired, _ := reply.(int64)
+	return acquired == 1, nil
+}
+
+// ReleaseLease deletes the lease if holder owns it.
+func (r *RedisBackend) ReleaseLease(name, holder string) error {
+	_, err := r.do("EVAL", redisReleaseLease, "1", leasePath(r.prefix, name), holder)
+	return err
+}
+
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
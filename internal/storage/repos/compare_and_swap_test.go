@@ -0,0 +1,93 @@
+package repos
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositories_CompareAndSwap(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	journal, err := storage.OpenFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	defer journal.Close()
+	db.SetJournal(journal)
+
+	stemRepo := NewStemRepository(db)
+	leafRepo := NewLeafRepository(db)
+	key := storage.StemKey{Name: "api", Version: "v1"}
+
+	assert.NoError(t, stemRepo.SaveStem(key, &models.Stem{Name: "api", Version: "v1", LeafInstances: map[string]*models.Leaf{}}))
+	assert.NoError(t, leafRepo.AddLeaf(key, "leaf-1", "leaf-1", 100, 8001, time.Now()))
+	stem, _ := stemRepo.FetchStem(key)
+	leaf, _ := leafRepo.FindLeafByID(key, "leaf-1")
+	assert.Equal(t, uint64(1), stem.Revision)
+	assert.Equal(t, uint64(1), leaf.Revision)
+
+	// The first writer at a revision wins, the second one is told about the conflict
+	stopping := func(leaf *models.Leaf) error { leaf.Status = models.StatusStopping; return nil }
+	swapped, err := leafRepo.CompareAndSwapLeaf(key, "leaf-1", 1, stopping)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), swapped.Revision)
+	assert.Equal(t, uint64(1), leaf.Revision, "copies read earlier are left alone")
+	_, err = leafRepo.CompareAndSwapLeaf(key, "leaf-1", 1, func(leaf *models.Leaf) error {
+		leaf.Status = models.StatusStandby
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrConflict)
+	leaf, _ = leafRepo.FindLeafByID(key, "leaf-1")
+	assert.Equal(t, models.StatusStopping, leaf.Status)
+
+	// Plain updates bump the revision too
+	assert.NoError(t, leafRepo.UpdateLeafStatus(key, "leaf-1", models.StatusRunning))
+	leaf, _ = leafRepo.FindLeafByID(key, "leaf-1")
+	assert.Equal(t, uint64(3), leaf.Revision)
+	_, err = leafRepo.CompareAndSwapLeaf(key, "leaf-1", 2, stopping)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	// A failed update changes nothing
+	failed := errors.New("refused")
+	_, err = stemRepo.CompareAndSwapStem(key, 1, func(stem *models.Stem) error {
+		stem.Maintenance = true
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	stem, _ = stemRepo.FetchStem(key)
+	assert.False(t, stem.Maintenance)
+	assert.Equal(t, uint64(1), stem.Revision)
+
+	replicas := 2
+	stem, err = stemRepo.CompareAndSwapStem(key, 1, func(stem *models.Stem) error {
+		stem.Replicas = &replicas
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &replicas, stem.Replicas)
+	assert.Equal(t, uint64(2), stem.Revision)
+	assert.Len(t, stem.LeafInstances, 1, "leafs are kept")
+	_, err = stemRepo.CompareAndSwapStem(key, 1, func(stem *models.Stem) error { return nil })
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = leafRepo.CompareAndSwapLeaf(key, "missing", 1, stopping)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrConflict)
+
+	// Replaying the journal reproduces the revisions, so swaps keep working after a restart
+	entries, err := journal.Query(storage.JournalQuery{})
+	assert.NoError(t, err)
+	replayed := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	assert.NoError(t, replayed.Replay(entries))
+	if assert.NotNil(t, replayed.Stems[key]) {
+		assert.Equal(t, uint64(2), replayed.Stems[key].Revision)
+		assert.Equal(t, &replicas, replayed.Stems[key].Replicas)
+		assert.Equal(t, uint64(3), replayed.Stems[key].LeafInstances["leaf-1"].Revision)
+		assert.Equal(t, models.StatusRunning, replayed.Stems[key].LeafInstances["leaf-1"].Status)
+	}
+}
@@ -0,0 +1,72 @@
+package repos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositories_ReadsReturnCopies(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	stemRepo := NewStemRepository(db)
+	leafRepo := NewLeafRepository(db)
+	key := storage.StemKey{Name: "api", Version: "v1"}
+	replicas := 2
+
+	assert.NoError(t, stemRepo.SaveStem(key, &models.Stem{Name: "api", Version: "v1", Replicas: &replicas,
+		Environment: map[string]string{"MODE": "live"}, LeafInstances: map[string]*models.Leaf{}}))
+	assert.NoError(t, leafRepo.AddLeaf(key, "leaf-1", "leaf-1", 100, 8001, time.Now()))
+	assert.NoError(t, leafRepo.AddLeafStage(key, "leaf-1", models.LeafStage{Stage: "start", Status: models.StatusRunning}))
+	assert.NoError(t, leafRepo.SetGraftNode(key, &models.Leaf{ID: "api-v1-graftnode"}))
+
+	// Changing what was read doesn't change the stored state
+	stem, err := stemRepo.FetchStem(key)
+	assert.NoError(t, err)
+	stem.Maintenance = true
+	*stem.Replicas = 5
+	stem.Environment["MODE"] = "test"
+	stem.LeafInstances["leaf-1"].Status = models.StatusStopping
+	stem.LeafInstances["leaf-1"].History[0].Stage = "changed"
+	delete(stem.LeafInstances, "leaf-1")
+	stem.GraftNodeLeaf.Port = 9000
+
+	stems, err := stemRepo.GetAllStems()
+	assert.NoError(t, err)
+	stems[0].Restarts = 7
+	queried, _, err := stemRepo.QueryStems(StemQuery{})
+	assert.NoError(t, err)
+	queried[0].Type = models.StemTypeSystem
+
+	leaf, err := leafRepo.FindLeafByID(key, "leaf-1")
+	assert.NoError(t, err)
+	leaf.PID = 1
+	leafs, err := leafRepo.ListLeafs(key)
+	assert.NoError(t, err)
+	leafs[0].Port = 1
+	queriedLeafs, _, err := leafRepo.QueryLeafs(key, LeafQuery{})
+	assert.NoError(t, err)
+	queriedLeafs[0].HAProxyServer = "other"
+	graftNode, err := leafRepo.GetGraftNode(key)
+	assert.NoError(t, err)
+	graftNode.ID = "other"
+
+	stored := db.Stems[key]
+	assert.False(t, stored.Maintenance)
+	assert.Equal(t, 2, *stored.Replicas)
+	assert.Equal(t, "live", stored.Environment["MODE"])
+	assert.Equal(t, 0, stored.Restarts)
+	assert.Equal(t, models.StemType(""), stored.Type)
+	if assert.Contains(t, stored.LeafInstances, "leaf-1") {
+		storedLeaf := stored.LeafInstances["leaf-1"]
+		assert.Equal(t, models.StatusRunning, storedLeaf.Status)
+		assert.Equal(t, "start", storedLeaf.History[0].Stage)
+		assert.Equal(t, 100, storedLeaf.PID)
+		assert.Equal(t, 8001, storedLeaf.Port)
+		assert.Equal(t, "leaf-1", storedLeaf.HAProxyServer)
+	}
+	assert.Equal(t, "api-v1-graftnode", stored.GraftNodeLeaf.ID)
+	assert.Equal(t, 0, stored.GraftNodeLeaf.Port)
+}
@@ -0,0 +1,115 @@
+package repos
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositories_JournalMutations(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	journal, err := storage.OpenFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	defer journal.Close()
+	db.SetJournal(journal)
+
+	stemRepo := NewStemRepository(db)
+	leafRepo := NewLeafRepository(db)
+	key := storage.StemKey{Name: "api", Version: "v1"}
+
+	assert.NoError(t, stemRepo.SaveStem(key, &models.Stem{Name: "api", Version: "v1", LeafInstances: map[string]*models.Leaf{}}))
+	assert.NoError(t, leafRepo.AddLeaf(key, "leaf-1", "leaf-1", 100, 8001, time.Now()))
+	assert.NoError(t, leafRepo.AddLeaf(key, "leaf-2", "leaf-2", 101, 8002, time.Now()))
+	assert.NoError(t, leafRepo.UpdateLeafStatus(key, "leaf-2", models.StatusStopping))
+	assert.NoError(t, leafRepo.AddLeafStage(key, "leaf-2", models.LeafStage{Stage: "drain", Status: models.StatusStopping, Duration: time.Second}))
+	assert.NoError(t, leafRepo.RemoveLeaf(key, "leaf-1"))
+	assert.NoError(t, leafRepo.SetGraftNode(key, &models.Leaf{ID: "api-v1-graftnode"}))
+	assert.NoError(t, leafRepo.ClearGraftNode(key))
+	assert.NoError(t, stemRepo.SetStemMaintenance(key, true))
+	assert.NoError(t, stemRepo.SetStemRoute(key, "/api/v2", "api/v2"))
+	replicas := 3
+	assert.NoError(t, stemRepo.SetStemReplicas(key, &replicas))
+	assert.NoError(t, stemRepo.CountStemRestart(key))
+	coldStart := models.ColdStart{Started: time.Now(), Requests: 3, TotalWait: 4 * time.Second, MaxWait: 2 * time.Second}
+	assert.NoError(t, stemRepo.RecordColdStart(key, coldStart))
+	tx := leafRepo.Begin()
+	leafRepo.StageLeaf(tx, key, &models.Leaf{ID: "leaf-3", Status: models.StatusStandby})
+	stemRepo.StageLeafStart(tx, key)
+	assert.NoError(t, tx.Commit())
+
+	// Failed mutations are not journaled
+	assert.Error(t, leafRepo.RemoveLeaf(key, "missing"))
+
+	entries, err := journal.Query(storage.JournalQuery{})
+	assert.NoError(t, err)
+	ops := make([]storage.JournalOp, 0, len(entries))
+	for _, entry := range entries {
+		ops = append(ops, entry.Op)
+	}
+	assert.Equal(t, []storage.JournalOp{
+		storage.OpStemSaved, storage.OpLeafAdded, storage.OpLeafAdded, storage.OpLeafStatusChanged, storage.OpLeafStage,
+		storage.OpLeafRemoved, storage.OpGraftNodeSet, storage.OpGraftNodeCleared, storage.OpStemMaintenance,
+		storage.OpStemRouted, storage.OpStemScaled, storage.OpStemRestarted, storage.OpStemColdStart,
+		storage.OpLeafAdded, storage.OpStemLeafStarted,
+	}, ops)
+
+	// Replaying into an empty database reproduces the final state
+	replayed := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	assert.NoError(t, replayed.Replay(entries))
+	stem := replayed.Stems[key]
+	if assert.NotNil(t, stem) {
+		assert.Len(t, stem.LeafInstances, 2)
+		assert.Equal(t, models.StatusStandby, stem.LeafInstances["leaf-3"].Status)
+		assert.Equal(t, 1, stem.LeafStarts)
+		assert.Equal(t, models.StatusStopping, stem.LeafInstances["leaf-2"].Status)
+		assert.Equal(t, []models.LeafStage{{Stage: "drain", Status: models.StatusStopping, Duration: time.Second}}, stem.LeafInstances["leaf-2"].History)
+		assert.Nil(t, stem.GraftNodeLeaf)
+		assert.True(t, stem.Maintenance)
+		assert.Equal(t, "/api/v2", stem.WorkingURL)
+		assert.Equal(t, "api/v2", stem.HAProxyBackend)
+		assert.Equal(t, &replicas, stem.Replicas)
+		assert.Equal(t, 1, stem.Restarts)
+		assert.Equal(t, 1, stem.ColdStarts.Count)
+		assert.Equal(t, 3, stem.ColdStarts.MaxRequests)
+		assert.Equal(t, 4*time.Second, stem.ColdStarts.TotalWait)
+	}
+}
+
+func TestRepositories_JournalTombstones(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	journal, err := storage.OpenFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	defer journal.Close()
+	db.SetJournal(journal)
+
+	stemRepo := NewStemRepository(db)
+	api, web := storage.StemKey{Name: "api", Version: "v1"}, storage.StemKey{Name: "web", Version: "v1"}
+	deleted := time.Now().UTC()
+	assert.NoError(t, stemRepo.SaveStem(api, &models.Stem{Name: "api", Version: "v1", LeafInstances: map[string]*models.Leaf{}}))
+	assert.NoError(t, stemRepo.SaveStem(web, &models.Stem{Name: "web", Version: "v1", LeafInstances: map[string]*models.Leaf{}}))
+	assert.NoError(t, stemRepo.TombstoneStem(api, deleted, map[string]*models.Leaf{"api-1": {ID: "api-1", Status: models.StatusRunning}}))
+	assert.NoError(t, stemRepo.TombstoneStem(web, deleted, nil))
+	_, err = stemRepo.PurgeTombstones(deleted.Add(time.Second))
+	assert.NoError(t, err)
+	assert.NoError(t, stemRepo.SaveStem(web, &models.Stem{Name: "web", Version: "v1", LeafInstances: map[string]*models.Leaf{}}))
+	assert.NoError(t, stemRepo.TombstoneStem(web, deleted.Add(time.Minute), nil))
+
+	// Replaying keeps the tombstones that were not purged, and nothing else
+	entries, err := journal.Query(storage.JournalQuery{})
+	assert.NoError(t, err)
+	replayed := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	assert.NoError(t, replayed.Replay(entries))
+	assert.Empty(t, replayed.Stems)
+	assert.Len(t, replayed.Tombstones, 1)
+	if tombstone := replayed.Tombstones[web]; assert.NotNil(t, tombstone) {
+		assert.True(t, tombstone.Deleted.Equal(deleted.Add(time.Minute)))
+	}
+}
@@ -4,19 +4,56 @@ import (
 	"fmt"
 	"github.com/plantarium-platform/herbarium-go/internal/storage"
 	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"sort"
 	"time"
 )
 
 // LeafRepositoryInterface defines methods for managing leaves.
 type LeafRepositoryInterface interface {
 	AddLeaf(stemKey storage.StemKey, leafID, haproxyServer string, pid, port int, initialized time.Time) error
+	AddRemoteLeaf(stemKey storage.StemKey, leafID, haproxyServer, node, agent, host string, pid, port int, initialized time.Time) error
 	RemoveLeaf(stemKey storage.StemKey, leafID string) error
 	FindLeafByID(stemKey storage.StemKey, leafID string) (*models.Leaf, error)
 	ListLeafs(stemKey storage.StemKey) ([]*models.Leaf, error)
 	UpdateLeafStatus(stemKey storage.StemKey, leafID string, status models.LeafStatus) error
+	AddLeafStage(stemKey storage.StemKey, leafID string, stage models.LeafStage) error
 	SetGraftNode(stemKey storage.StemKey, graftNode *models.Leaf) error
 	GetGraftNode(stemKey storage.StemKey) (*models.Leaf, error)
 	ClearGraftNode(stemKey storage.StemKey) error
+	QueryLeafs(stemKey storage.StemKey, query LeafQuery) ([]*models.Leaf, int, error)
+	QueryAllLeafs(query LeafQuery) ([]StemLeaf, int, error)
+	CompareAndSwapLeaf(stemKey storage.StemKey, leafID string, revision uint64, update func(leaf *models.Leaf) error) (*models.Leaf, error)
+	Begin() *storage.Tx
+	StageLeaf(tx *storage.Tx, stemKey storage.StemKey, leaf *models.Leaf)
+}
+
+// LeafSortField names the field leafs are ordered by in QueryLeafs.
+type LeafSortField string
+
+const (
+	LeafSortByID          LeafSortField = "id"          // Sort by leaf ID
+	LeafSortByInitialized LeafSortField = "initialized" // Sort by initialization time, then ID
+	LeafSortByPort        LeafSortField = "port"        // Sort by port, then ID
+)
+
+// LeafQuery describes filtering, sorting, and pagination options for QueryLeafs and QueryAllLeafs.
+// Zero values disable the corresponding filter.
+type LeafQuery struct {
+	Status            models.LeafStatus // Only leafs in this status
+	Port              int               // Only leafs listening on this port
+	PID               int               // Only leafs with this process ID
+	Labels            map[string]string // Only leafs of stems whose config carries all of these labels
+	InitializedBefore time.Time         // Only leafs initialized before this time, such as leafs stuck starting
+	SortBy            LeafSortField     // Sort field, defaults to ID
+	Descending        bool              // Reverse the sort order
+	Offset            int               // Number of matching leafs to skip
+	Limit             int               // Maximum number of leafs to return, 0 means no limit
+}
+
+// StemLeaf is a leaf found by QueryAllLeafs, with the stem it belongs to.
+type StemLeaf struct {
+	StemKey storage.StemKey
+	Leaf    *models.Leaf
 }
 
 // LeafRepository is an implementation of LeafRepositoryInterface.
@@ -42,7 +79,13 @@ func (r *LeafRepository) getStem(stemKey storage.StemKey) (*models.Stem, error)
 
 // AddLeaf adds a new leaf to a specified stem.
 func (r *LeafRepository) AddLeaf(stemKey storage.StemKey, leafID, haproxyServer string, pid, port int, initialized time.Time) error {
-	return r.storage.WithLock(func() error {
+	return r.AddRemoteLeaf(stemKey, leafID, haproxyServer, "", "", "", pid, port, initialized)
+}
+
+// AddRemoteLeaf adds a new leaf placed on node and run by agent, reachable at host, to a specified stem.
+// Empty agent and host denote a leaf run by herbarium itself, and an empty node a leaf that was not placed.
+func (r *LeafRepository) AddRemoteLeaf(stemKey storage.StemKey, leafID, haproxyServer, node, agent, host string, pid, port int, initialized time.Time) error {
+	return r.storage.WithStemLock(stemKey, func() error {
 		stem, err := r.getStem(stemKey)
 		if err != nil {
 			return err
@@ -52,22 +95,51 @@ func (r *LeafRepository) AddLeaf(stemKey storage.StemKey, leafID, haproxyServer
 			return fmt.Errorf("leaf %s already exists in stem %s version %s", leafID, stemKey.Name, stemKey.Version)
 		}
 
-		stem.LeafInstances[leafID] = &models.Leaf{
+		leaf := &models.Leaf{
 			ID:            leafID,
 			PID:           pid,
 			HAProxyServer: haproxyServer,
 			Port:          port,
 			Status:        models.StatusRunning,
 			Initialized:   initialized,
+			Agent:         agent,
+			Host:          host,
+			Node:          node,
 		}
+		stem.LeafInstances[leafID] = leaf
 
+		r.storage.Record(storage.JournalEntry{Op: storage.OpLeafAdded, StemKey: stemKey, LeafID: leafID, Leaf: leaf})
 		return nil
 	})
 }
 
+// Begin starts a transaction on the storage behind the repository, for mutations that must be applied
+// together with others, such as saving a started leaf and counting its start.
+func (r *LeafRepository) Begin() *storage.Tx {
+	return r.storage.Begin()
+}
+
+// StageLeaf stages adding a leaf to a stem in tx. The leaf is added as given, with its status, when the
+// transaction is committed; the commit fails if the stem is gone or already has a leaf with its ID.
+func (r *LeafRepository) StageLeaf(tx *storage.Tx, stemKey storage.StemKey, leaf *models.Leaf) {
+	tx.Stage(func(stems map[storage.StemKey]*models.Stem) (storage.JournalEntry, func(), error) {
+		stem, exists := stems[stemKey]
+		if !exists {
+			return storage.JournalEntry{}, nil, fmt.Errorf("stem %s version %s not found", stemKey.Name, stemKey.Version)
+		}
+		if _, exists := stem.LeafInstances[leaf.ID]; exists {
+			return storage.JournalEntry{}, nil, fmt.Errorf("leaf %s already exists in stem %s version %s", leaf.ID, stemKey.Name, stemKey.Version)
+		}
+
+		stem.LeafInstances[leaf.ID] = leaf
+		undo := func() { delete(stem.LeafInstances, leaf.ID) }
+		return storage.JournalEntry{Op: storage.OpLeafAdded, StemKey: stemKey, LeafID: leaf.ID, Leaf: leaf}, undo, nil
+	})
+}
+
 // RemoveLeaf removes a leaf from a specified stem.
 func (r *LeafRepository) RemoveLeaf(stemKey storage.StemKey, leafID string) error {
-	return r.storage.WithLock(func() error {
+	return r.storage.WithStemLock(stemKey, func() error {
 		stem, err := r.getStem(stemKey)
 		if err != nil {
 			return err
@@ -78,14 +150,15 @@ func (r *LeafRepository) RemoveLeaf(stemKey storage.StemKey, leafID string) erro
 		}
 
 		delete(stem.LeafInstances, leafID)
+		r.storage.Record(storage.JournalEntry{Op: storage.OpLeafRemoved, StemKey: stemKey, LeafID: leafID})
 		return nil
 	})
 }
 
-// FindLeafByID finds a leaf by its ID within a specified stem.
+// FindLeafByID finds a leaf by its ID within a specified stem and returns a copy of it.
 func (r *LeafRepository) FindLeafByID(stemKey storage.StemKey, leafID string) (*models.Leaf, error) {
 	var leaf *models.Leaf // Declare leaf outside the closure
-	err := r.storage.WithRLock(func() error {
+	err := r.storage.WithStemRLock(stemKey, func() error {
 		stem, err := r.getStem(stemKey)
 		if err != nil {
 			return err
@@ -96,15 +169,15 @@ func (r *LeafRepository) FindLeafByID(stemKey storage.StemKey, leafID string) (*
 			return fmt.Errorf("leaf %s not found in stem %s version %s", leafID, stemKey.Name, stemKey.Version)
 		}
 
-		leaf = foundLeaf // Assign to the outer variable
+		leaf = foundLeaf.Clone() // Assign to the outer variable
 		return nil
 	})
 	return leaf, err
 }
 
-// ListLeafs lists all leafs for a specified stem.
+// ListLeafs lists copies of all leafs for a specified stem.
 func (r *LeafRepository) ListLeafs(stemKey storage.StemKey) (leafs []*models.Leaf, err error) {
-	err = r.storage.WithRLock(func() error {
+	err = r.storage.WithStemRLock(stemKey, func() error {
 		stem, err := r.getStem(stemKey)
 		if err != nil {
 			return err
@@ -112,7 +185,7 @@ func (r *LeafRepository) ListLeafs(stemKey storage.StemKey) (leafs []*models.Lea
 
 		leafs = make([]*models.Leaf, 0, len(stem.LeafInstances))
 		for _, leaf := range stem.LeafInstances {
-			leafs = append(leafs, leaf)
+			leafs = append(leafs, leaf.Clone())
 		}
 
 		return nil
@@ -122,7 +195,7 @@ func (r *LeafRepository) ListLeafs(stemKey storage.StemKey) (leafs []*models.Lea
 
 // UpdateLeafStatus updates the status of a specified leaf.
 func (r *LeafRepository) UpdateLeafStatus(stemKey storage.StemKey, leafID string, status models.LeafStatus) error {
-	return r.storage.WithLock(func() error {
+	return r.storage.WithStemLock(stemKey, func() error {
 		stem, err := r.getStem(stemKey)
 		if err != nil {
 			return err
@@ -134,32 +207,86 @@ func (r *LeafRepository) UpdateLeafStatus(stemKey storage.StemKey, leafID string
 		}
 
 		leaf.Status = status
+		r.storage.Record(storage.JournalEntry{Op: storage.OpLeafStatusChanged, StemKey: stemKey, LeafID: leafID, Status: status})
+		return nil
+	})
+}
+
+// CompareAndSwapLeaf applies update to a copy of a leaf and stores the result, but only if the leaf is still
+// at the given revision; otherwise ErrConflict is returned and nothing changes. A copy of the leaf at its
+// new revision is returned.
+func (r *LeafRepository) CompareAndSwapLeaf(stemKey storage.StemKey, leafID string, revision uint64, update func(leaf *models.Leaf) error) (*models.Leaf, error) {
+	var swapped *models.Leaf
+	err := r.storage.WithStemLock(stemKey, func() error {
+		stem, err := r.getStem(stemKey)
+		if err != nil {
+			return err
+		}
+
+		leaf, exists := stem.LeafInstances[leafID]
+		if !exists {
+			return fmt.Errorf("leaf %s not found in stem %s version %s", leafID, stemKey.Name, stemKey.Version)
+		}
+		if leaf.Revision != revision {
+			return fmt.Errorf("leaf %s of stem %s version %s is at revision %d, not %d: %w",
+				leafID, stemKey.Name, stemKey.Version, leaf.Revision, revision, ErrConflict)
+		}
+
+		updated := *leaf
+		if err := update(&updated); err != nil {
+			return err
+		}
+		updated.ID, updated.Revision = leaf.ID, leaf.Revision
+		*leaf = updated
+		r.storage.Record(storage.JournalEntry{Op: storage.OpLeafReplaced, StemKey: stemKey, LeafID: leafID, Leaf: leaf})
+		swapped = leaf.Clone()
+		return nil
+	})
+	return swapped, err
+}
+
+// AddLeafStage appends a stage to the status history of a specified leaf.
+func (r *LeafRepository) AddLeafStage(stemKey storage.StemKey, leafID string, stage models.LeafStage) error {
+	return r.storage.WithStemLock(stemKey, func() error {
+		stem, err := r.getStem(stemKey)
+		if err != nil {
+			return err
+		}
+
+		leaf, exists := stem.LeafInstances[leafID]
+		if !exists {
+			return fmt.Errorf("leaf %s not found in stem %s version %s", leafID, stemKey.Name, stemKey.Version)
+		}
+
+		leaf.History = append(leaf.History, stage)
+		r.storage.Record(storage.JournalEntry{Op: storage.OpLeafStage, StemKey: stemKey, LeafID: leafID, Stage: &stage})
 		return nil
 	})
 }
 
 // SetGraftNode sets a graft node for a specified stem.
 func (r *LeafRepository) SetGraftNode(stemKey storage.StemKey, graftNode *models.Leaf) error {
-	return r.storage.WithLock(func() error {
+	return r.storage.WithStemLock(stemKey, func() error {
 		stem, err := r.getStem(stemKey)
 		if err != nil {
 			return err
 		}
 
 		stem.GraftNodeLeaf = graftNode
+		r.storage.Record(storage.JournalEntry{Op: storage.OpGraftNodeSet, StemKey: stemKey, Leaf: graftNode})
 		return nil
 	})
 }
 
-// GetGraftNode retrieves the graft node for a specified stem.
+// GetGraftNode retrieves a copy of the graft node for a specified stem, nil if it has none.
 func (r *LeafRepository) GetGraftNode(stemKey storage.StemKey) (graftNode *models.Leaf, err error) {
-	err = r.storage.WithRLock(func() error {
+	err = r.storage.WithStemRLock(stemKey, func() error {
 		stem, err := r.getStem(stemKey)
 		if err != nil {
 			return err
 		}
 
-		graftNode = stem.GraftNodeLeaf
+		graftNode = stem.GraftNodeLeaf.Clone()
 		return nil
 	})
 	return graftNode, err
@@ -167,13 +294,105 @@ func (r *LeafRepository) GetGraftNode(stemKey storage.StemKey) (graftNode *model
 
 // ClearGraftNode clears the graft node for a specified stem.
 func (r *LeafRepository) ClearGraftNode(stemKey storage.StemKey) error {
-	return r.storage.WithLock(func() error {
+	return r.storage.WithStemLock(stemKey, func() error {
 		stem, err := r.getStem(stemKey)
 		if err != nil {
 			return err
 		}
 
 		stem.GraftNodeLeaf = nil
+		r.storage.Record(storage.JournalEntry{Op: storage.OpGraftNodeCleared, StemKey: stemKey})
+		return nil
+	})
+}
+
+// QueryLeafs returns copies of the page of a stem's leafs matching the query together with the total number of matches.
+func (r *LeafRepository) QueryLeafs(stemKey storage.StemKey, query LeafQuery) ([]*models.Leaf, int, error) {
+	var matched []*models.Leaf
+	err := r.storage.WithStemRLock(stemKey, func() error {
+		stem, err := r.getStem(stemKey)
+		if err != nil {
+			return err
+		}
+
+		for _, leaf := range stem.LeafInstances {
+			if query.matches(stem, leaf) {
+				matched = append(matched, leaf.Clone())
+			}
+		}
 		return nil
 	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if query.Descending {
+			return query.less(matched[j], matched[i])
+		}
+		return query.less(matched[i], matched[j])
+	})
+
+	return paginate(matched, query.Offset, query.Limit), len(matched), nil
+}
+
+// QueryAllLeafs returns the page of leafs matching the query across all stems together with the total number
+// of matches. The stems are read at a single point in time, so callers don't have to go over them one by one.
+func (r *LeafRepository) QueryAllLeafs(query LeafQuery) ([]StemLeaf, int, error) {
+	state := r.storage.ReadSnapshot()
+	var matched []StemLeaf
+	for _, stem := range state.Stems() {
+		key := storage.StemKey{Name: stem.Name, Version: stem.Version}
+		for _, leaf := range stem.LeafInstances {
+			if query.matches(stem, leaf) {
+				matched = append(matched, StemLeaf{StemKey: key, Leaf: leaf})
+			}
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if query.Descending {
+			return query.less(matched[j].Leaf, matched[i].Leaf)
+		}
+		return query.less(matched[i].Leaf, matched[j].Leaf)
+	})
+
+	return paginate(matched, query.Offset, query.Limit), len(matched), nil
+}
+
+// matches reports whether a leaf of the stem satisfies every filter set on the query.
+func (q LeafQuery) matches(stem *models.Stem, leaf *models.Leaf) bool {
+	if q.Status != "" && leaf.Status != q.Status {
+		return false
+	}
+	if q.Port != 0 && leaf.Port != q.Port {
+		return false
+	}
+	if q.PID != 0 && leaf.PID != q.PID {
+		return false
+	}
+	if !q.InitializedBefore.IsZero() && !leaf.Initialized.Before(q.InitializedBefore) {
+		return false
+	}
+	for key, value := range q.Labels {
+		if stem.Config == nil || stem.Config.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// less orders two leafs by the query's sort field, using the leaf ID as tie-breaker.
+func (q LeafQuery) less(a, b *models.Leaf) bool {
+	switch q.SortBy {
+	case LeafSortByInitialized:
+		if !a.Initialized.Equal(b.Initialized) {
+			return a.Initialized.Before(b.Initialized)
+		}
+	case LeafSortByPort:
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+	}
+	return a.ID < b.ID
 }
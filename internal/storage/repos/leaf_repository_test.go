@@ -4,6 +4,7 @@ import (
 	"github.com/plantarium-platform/herbarium-go/internal/storage"
 	"github.com/plantarium-platform/herbarium-go/pkg/models"
 	"testing"
+	"time"
 )
 
 func TestStemRepository_AddStem(t *testing.T) {
@@ -140,3 +141,94 @@ func TestStemRepository_ReplaceStem(t *testing.T) {
 		t.Errorf("expected stem version to be 1.1.0, got %s", stem.Version)
 	}
 }
+
+func TestLeafRepository_QueryLeafs(t *testing.T) {
+	testStorage := storage.GetTestStorage()
+	repo := NewLeafRepository(testStorage)
+
+	stemKey := storage.StemKey{Name: "system-service", Version: "1.0.0"}
+	if err := repo.AddLeaf(stemKey, "leaf-2", "haproxy-system", 2345, 8079, time.Now()); err != nil {
+		t.Fatalf("failed to add leaf: %v", err)
+	}
+
+	// Sort by port
+	leafs, total, err := repo.QueryLeafs(stemKey, LeafQuery{SortBy: LeafSortByPort})
+	if err != nil {
+		t.Fatalf("failed to query leafs: %v", err)
+	}
+	if total != 2 || len(leafs) != 2 {
+		t.Fatalf("expected 2 leafs, got total=%d leafs=%d", total, len(leafs))
+	}
+	if leafs[0].ID != "leaf-2" {
+		t.Errorf("expected leaf-2 (lowest port) first, got %s", leafs[0].ID)
+	}
+
+	// Filter by status with pagination
+	leafs, total, err = repo.QueryLeafs(stemKey, LeafQuery{Status: models.StatusRunning, Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to query leafs: %v", err)
+	}
+	if total != 1 || leafs[0].ID != "leaf-2" {
+		t.Errorf("expected only leaf-2 to be running, got total=%d", total)
+	}
+
+	// Unknown stem
+	_, _, err = repo.QueryLeafs(storage.StemKey{Name: "non-existent-stem", Version: "1.0.0"}, LeafQuery{})
+	if err == nil {
+		t.Errorf("expected an error when querying leafs of non-existent stem")
+	}
+}
+
+func TestLeafRepository_QueryAllLeafs(t *testing.T) {
+	testStorage := storage.GetTestStorage()
+	repo := NewLeafRepository(testStorage)
+
+	systemKey := storage.StemKey{Name: "system-service", Version: "1.0.0"}
+	userKey := storage.StemKey{Name: "user-deployment", Version: "1.0.0"}
+	testStorage.Stems[userKey].Config.Labels = map[string]string{"tier": "gold"}
+	if err := repo.AddLeaf(systemKey, "leaf-2", "haproxy-system", 2345, 8079, time.Now()); err != nil {
+		t.Fatalf("failed to add leaf: %v", err)
+	}
+
+	// All leafs across stems, sorted by port
+	leafs, total, err := repo.QueryAllLeafs(LeafQuery{SortBy: LeafSortByPort})
+	if err != nil {
+		t.Fatalf("failed to query leafs: %v", err)
+	}
+	if total != 3 || len(leafs) != 3 {
+		t.Fatalf("expected 3 leafs, got total=%d leafs=%d", total, len(leafs))
+	}
+	if leafs[0].Leaf.ID != "leaf-2" || leafs[2].StemKey != userKey {
+		t.Errorf("expected leafs ordered by port across stems, got %s first and %v last", leafs[0].Leaf.ID, leafs[2].StemKey)
+	}
+
+	// Leafs stuck in a status since before a point in time
+	leafs, total, err = repo.QueryAllLeafs(LeafQuery{Status: models.StatusUnknown, InitializedBefore: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("failed to query leafs: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("expected 2 old leafs in unknown status, got %d", total)
+	}
+
+	// By PID, port, and label
+	for name, query := range map[string]LeafQuery{
+		"pid":   {PID: 5678},
+		"port":  {Port: 9091},
+		"label": {Labels: map[string]string{"tier": "gold"}},
+	} {
+		leafs, total, err = repo.QueryAllLeafs(query)
+		if err != nil {
+			t.Fatalf("%s: failed to query leafs: %v", name, err)
+		}
+		if total != 1 || leafs[0].StemKey != userKey || leafs[0].Leaf.ID != "leaf-1" {
+			t.Errorf("%s: expected only leaf-1 of user-deployment, got total=%d", name, total)
+		}
+	}
+
+	// Results are copies
+	leafs[0].Leaf.Status = models.StatusStopping
+	if testStorage.Stems[userKey].LeafInstances["leaf-1"].Status != models.StatusUnknown {
+		t.Errorf("expected changes to a queried leaf not to reach storage")
+	}
+}
@@ -0,0 +1,83 @@
+package repos
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// NodeRepositoryInterface defines methods for managing the nodes leafs can be placed on.
+type NodeRepositoryInterface interface {
+	SaveNode(node *models.Node) error
+	DeleteNode(name string) error
+	FetchNode(name string) (*models.Node, error)
+	GetAllNodes() ([]*models.Node, error)
+}
+
+// NodeRepository is an implementation of NodeRepositoryInterface.
+// Nodes are registered from the global config at startup, so their changes are not journaled.
+type NodeRepository struct {
+	storage *storage.HerbariumDB
+}
+
+// NewNodeRepository initializes a new NodeRepository with the provided storage.
+func NewNodeRepository(storage *storage.HerbariumDB) *NodeRepository {
+	return &NodeRepository{
+		storage: storage,
+	}
+}
+
+// SaveNode registers a node, replacing any node with the same name.
+func (r *NodeRepository) SaveNode(node *models.Node) error {
+	if node.Name == "" {
+		return fmt.Errorf("node name is required")
+	}
+	return r.storage.WithLock(func() error {
+		if r.storage.Nodes == nil {
+			r.storage.Nodes = make(map[string]*models.Node)
+		}
+		r.storage.Nodes[node.Name] = node
+		return nil
+	})
+}
+
+// DeleteNode removes a node. Leafs placed on it keep running.
+func (r *NodeRepository) DeleteNode(name string) error {
+	return r.storage.WithLock(func() error {
+		if _, exists := r.storage.Nodes[name]; !exists {
+			return fmt.Errorf("node %s not found", name)
+		}
+		delete(r.storage.Nodes, name)
+		return nil
+	})
+}
+
+// FetchNode retrieves a node by name.
+func (r *NodeRepository) FetchNode(name string) (node *models.Node, err error) {
+	err = r.storage.WithRLock(func() error {
+		var exists bool
+		node, exists = r.storage.Nodes[name]
+		if !exists {
+			return fmt.Errorf("node %s not found", name)
+		}
+		return nil
+	})
+	return node, err
+}
+
+// GetAllNodes returns all registered nodes ordered by name.
+func (r *NodeRepository) GetAllNodes() (nodes []*models.Node, err error) {
+	err = r.storage.WithRLock(func() error {
+		nodes = make([]*models.Node, 0, len(r.storage.Nodes))
+		for _, node := range r.storage.Nodes {
+			nodes = append(nodes, node)
+		}
+		return nil
+	})
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes, err
+}
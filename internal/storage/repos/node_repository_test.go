@@ -0,0 +1,35 @@
+package repos
+
+import (
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeRepository(t *testing.T) {
+	repo := NewNodeRepository(&storage.HerbariumDB{})
+
+	assert.NoError(t, repo.SaveNode(&models.Node{Name: "b", MemoryMB: 512}))
+	assert.NoError(t, repo.SaveNode(&models.Node{Name: "a"}))
+	assert.Error(t, repo.SaveNode(&models.Node{}))
+
+	// Saving an existing name replaces the node
+	assert.NoError(t, repo.SaveNode(&models.Node{Name: "b", MemoryMB: 1024}))
+	node, err := repo.FetchNode("b")
+	assert.NoError(t, err)
+	assert.Equal(t, 1024, node.MemoryMB)
+
+	nodes, err := repo.GetAllNodes()
+	assert.NoError(t, err)
+	if assert.Len(t, nodes, 2) {
+		assert.Equal(t, "a", nodes[0].Name)
+		assert.Equal(t, "b", nodes[1].Name)
+	}
+
+	assert.NoError(t, repo.DeleteNode("a"))
+	assert.Error(t, repo.DeleteNode("a"))
+	_, err = repo.FetchNode("a")
+	assert.Error(t, err)
+}
@@ -1,9 +1,12 @@
 package repos
 
 import (
+	"errors"
 	"fmt"
 	"github.com/plantarium-platform/herbarium-go/internal/storage"
 	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"sort"
+	"time"
 )
 
 // StemRepositoryInterface defines methods for managing stems.
@@ -13,6 +16,48 @@ type StemRepositoryInterface interface {
 	FetchStem(key storage.StemKey) (*models.Stem, error)
 	GetAllStems() ([]*models.Stem, error)
 	UpdateStem(key storage.StemKey, newVersion string, newConfig *models.StemConfig) error
+	SetStemMaintenance(key storage.StemKey, enabled bool) error
+	SetStemRoute(key storage.StemKey, url, backend string) error
+	SetStemReplicas(key storage.StemKey, replicas *int) error
+	CountStemRestart(key storage.StemKey) error
+	RecordColdStart(key storage.StemKey, coldStart models.ColdStart) error
+	QueryStems(query StemQuery) ([]*models.Stem, int, error)
+	CompareAndSwapStem(key storage.StemKey, revision uint64, update func(stem *models.Stem) error) (*models.Stem, error)
+	StageLeafStart(tx *storage.Tx, key storage.StemKey)
+	ReadSnapshot() *storage.StateView
+	TombstoneStem(key storage.StemKey, deleted time.Time, leafs map[string]*models.Leaf) error
+	FetchTombstone(key storage.StemKey) (*models.Stem, error)
+	ListTombstones() ([]*models.Stem, error)
+	PurgeTombstones(deletedBefore time.Time) ([]*models.Stem, error)
+	RegisterVersion(stem *models.Stem, registered time.Time) (*models.StemVersion, error)
+	SetVersionStatus(key storage.StemKey, status models.VersionStatus, changed time.Time) error
+	FetchVersion(key storage.StemKey) (*models.StemVersion, error)
+	ListVersions(name string) ([]*models.StemVersion, error)
+}
+
+// ErrConflict is returned by compare-and-swap updates when the record was changed since its revision was read.
+var ErrConflict = errors.New("the record was changed concurrently")
+
+// StemSortField names the field stems are ordered by in QueryStems.
+type StemSortField string
+
+const (
+	StemSortByName    StemSortField = "name"    // Sort by stem name, then version
+	StemSortByVersion StemSortField = "version" // Sort by version, then stem name
+	StemSortByType    StemSortField = "type"    // Sort by stem type, then stem name
+)
+
+// StemQuery describes filtering, sorting, and pagination options for QueryStems.
+// Zero values disable the corresponding filter.
+type StemQuery struct {
+	Type       models.StemType   // Only stems of this type
+	Version    string            // Only stems with this version
+	LeafStatus models.LeafStatus // Only stems with at least one leaf in this status
+	Labels     map[string]string // Only stems whose config carries all of these labels
+	SortBy     StemSortField     // Sort field, defaults to name
+	Descending bool              // Reverse the sort order
+	Offset     int               // Number of matching stems to skip
+	Limit      int               // Maximum number of stems to return, 0 means no limit
 }
 
 // StemRepository is an implementation of StemRepositoryInterface.
@@ -35,6 +80,7 @@ func (r *StemRepository) SaveStem(key storage.StemKey, stem *models.Stem) error
 		}
 
 		r.storage.Stems[key] = stem
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemSaved, StemKey: key, Stem: stem})
 		return nil
 	})
 }
@@ -47,49 +93,426 @@ func (r *StemRepository) DeleteStem(key storage.StemKey) error {
 		}
 
 		delete(r.storage.Stems, key)
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemDeleted, StemKey: key})
 		return nil
 	})
 }
 
-// FindStem retrieves a stem by its composite key.
-func (r *StemRepository) FetchStem(key storage.StemKey) (*models.Stem, error) {
-	var stem *models.Stem
-	err := r.storage.WithRLock(func() error {
-		var exists bool
-		stem, exists = r.storage.Stems[key]
+// TombstoneStem removes a stem from the storage like DeleteStem, but keeps it as a tombstone marked deleted at
+// the given time, so its counters, leafs, and their history stay queryable until the tombstone is purged. The
+// given leafs, usually those the stem had before they were stopped, are kept in the tombstone unless the stem
+// still has them.
+func (r *StemRepository) TombstoneStem(key storage.StemKey, deleted time.Time, leafs map[string]*models.Leaf) error {
+	return r.storage.WithLock(func() error {
+		stem, exists := r.storage.Stems[key]
 		if !exists {
 			return fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
 		}
+
+		tombstone := stem.Clone()
+		if tombstone.LeafInstances == nil {
+			tombstone.LeafInstances = make(map[string]*models.Leaf, len(leafs))
+		}
+		for id, leaf := range leafs {
+			if _, exists := tombstone.LeafInstances[id]; !exists {
+				tombstone.LeafInstances[id] = leaf.Clone()
+			}
+		}
+		tombstone.Deleted = deleted
+
+		delete(r.storage.Stems, key)
+		if r.storage.Tombstones == nil {
+			r.storage.Tombstones = make(map[storage.StemKey]*models.Stem)
+		}
+		r.storage.Tombstones[key] = tombstone
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemDeleted, StemKey: key, Stem: tombstone})
 		return nil
 	})
-	return stem, err
 }
 
-// ListStems lists all stems in the storage.
-func (r *StemRepository) GetAllStems() ([]*models.Stem, error) {
-	var stems []*models.Stem
+// FetchTombstone retrieves a copy of the tombstone of an unregistered stem.
+func (r *StemRepository) FetchTombstone(key storage.StemKey) (*models.Stem, error) {
+	var tombstone *models.Stem
+	err := r.storage.WithRLock(func() error {
+		stored, exists := r.storage.Tombstones[key]
+		if !exists {
+			return fmt.Errorf("no tombstone of stem %s with version %s", key.Name, key.Version)
+		}
+		tombstone = stored.Clone()
+		return nil
+	})
+	return tombstone, err
+}
+
+// ListTombstones lists copies of the tombstones of all unregistered stems, oldest deletion first.
+func (r *StemRepository) ListTombstones() ([]*models.Stem, error) {
+	var tombstones []*models.Stem
 	err := r.storage.WithRLock(func() error {
-		stems = make([]*models.Stem, 0, len(r.storage.Stems))
-		for _, stem := range r.storage.Stems {
-			stems = append(stems, stem)
+		tombstones = make([]*models.Stem, 0, len(r.storage.Tombstones))
+		for _, tombstone := range r.storage.Tombstones {
+			tombstones = append(tombstones, tombstone.Clone())
 		}
 		return nil
 	})
-	return stems, err
+	sortTombstones(tombstones)
+	return tombstones, err
+}
+
+// PurgeTombstones drops the tombstones of stems deleted before the given time and returns them, oldest
+// deletion first.
+func (r *StemRepository) PurgeTombstones(deletedBefore time.Time) ([]*models.Stem, error) {
+	var purged []*models.Stem
+	err := r.storage.WithLock(func() error {
+		for key, tombstone := range r.storage.Tombstones {
+			if !tombstone.Deleted.Before(deletedBefore) {
+				continue
+			}
+			delete(r.storage.Tombstones, key)
+			r.storage.Record(storage.JournalEntry{Op: storage.OpStemPurged, StemKey: key})
+			purged = append(purged, tombstone)
+		}
+		return nil
+	})
+	sortTombstones(purged)
+	return purged, err
+}
+
+// sortTombstones orders tombstones by deletion time, then name and version.
+func sortTombstones(tombstones []*models.Stem) {
+	sort.Slice(tombstones, func(i, j int) bool {
+		a, b := tombstones[i], tombstones[j]
+		if !a.Deleted.Equal(b.Deleted) {
+			return a.Deleted.Before(b.Deleted)
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+}
+
+// RegisterVersion records in the version history that a stem was registered at the given time, and returns a
+// copy of its history entry. A version registered for the first time points back to the version that was
+// current then, the newest registered one of those still registered, or else of those unregistered without
+// a rollback. A version registered again, such as by a rollback to it, keeps the version it points back to.
+func (r *StemRepository) RegisterVersion(stem *models.Stem, registered time.Time) (*models.StemVersion, error) {
+	var entry *models.StemVersion
+	err := r.storage.WithLock(func() error {
+		var current *models.StemVersion
+		for _, kept := range r.storage.Versions[stem.Name] {
+			if kept.Version == stem.Version {
+				entry = kept.Clone()
+				continue
+			}
+			if kept.Status != models.VersionActive && kept.Status != models.VersionUnregistered {
+				continue
+			}
+			// Registered versions are preferred over unregistered ones, and newer ones over older ones
+			if current == nil || kept.Status == models.VersionActive && current.Status != models.VersionActive ||
+				kept.Status == current.Status && kept.RegisteredAt.After(current.RegisteredAt) {
+				current = kept
+			}
+		}
+		if entry == nil {
+			entry = &models.StemVersion{Name: stem.Name, Version: stem.Version}
+			if current != nil {
+				entry.Previous = current.Version
+			}
+		}
+		entry.Status = models.VersionActive
+		entry.RegisteredAt = registered
+		entry.UnregisteredAt = time.Time{}
+		entry.Registrations++
+		entry.Config = stem.Config
+		entry.Metadata = stem.Metadata
+
+		r.storage.KeepVersion(entry)
+		entry = entry.Clone()
+		return nil
+	})
+	return entry, err
+}
+
+// SetVersionStatus records in the version history that a registered version was unregistered, rolled back,
+// or failed to start at the given time.
+func (r *StemRepository) SetVersionStatus(key storage.StemKey, status models.VersionStatus, changed time.Time) error {
+	return r.storage.WithLock(func() error {
+		for _, kept := range r.storage.Versions[key.Name] {
+			if kept.Version != key.Version {
+				continue
+			}
+			entry := kept.Clone()
+			entry.Status = status
+			entry.UnregisteredAt = changed
+			r.storage.KeepVersion(entry)
+			return nil
+		}
+		return fmt.Errorf("no version %s in the history of stem %s", key.Version, key.Name)
+	})
+}
+
+// FetchVersion retrieves a copy of the history entry of a stem version.
+func (r *StemRepository) FetchVersion(key storage.StemKey) (*models.StemVersion, error) {
+	var entry *models.StemVersion
+	err := r.storage.WithRLock(func() error {
+		for _, kept := range r.storage.Versions[key.Name] {
+			if kept.Version == key.Version {
+				entry = kept.Clone()
+				return nil
+			}
+		}
+		return fmt.Errorf("no version %s in the history of stem %s", key.Version, key.Name)
+	})
+	return entry, err
+}
+
+// ListVersions lists copies of the history entries of every version ever registered for a stem, first
+// registered first, or none if the stem was never registered.
+func (r *StemRepository) ListVersions(name string) ([]*models.StemVersion, error) {
+	var history []*models.StemVersion
+	err := r.storage.WithRLock(func() error {
+		history = make([]*models.StemVersion, 0, len(r.storage.Versions[name]))
+		for _, kept := range r.storage.Versions[name] {
+			history = append(history, kept.Clone())
+		}
+		return nil
+	})
+	return history, err
+}
+
+// FindStem retrieves a copy of a stem by its composite key. Changes to the copy are not stored; use the
+// repository's update methods instead.
+func (r *StemRepository) FetchStem(key storage.StemKey) (*models.Stem, error) {
+	var stem *models.Stem
+	err := r.storage.WithStemRLock(key, func() error {
+		stored, exists := r.storage.Stems[key]
+		if !exists {
+			return fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
+		}
+		stem = stored.Clone()
+		return nil
+	})
+	return stem, err
+}
+
+// ListStems lists copies of all stems in the storage, as they were at a single point in time.
+func (r *StemRepository) GetAllStems() ([]*models.Stem, error) {
+	return r.storage.ReadSnapshot().Stems(), nil
+}
+
+// ReadSnapshot returns a point-in-time copy of all stems, for readers going over the whole state.
+func (r *StemRepository) ReadSnapshot() *storage.StateView {
+	return r.storage.ReadSnapshot()
 }
 
 // ReplaceStem replaces an existing stem with a new version.
 func (r *StemRepository) UpdateStem(key storage.StemKey, newVersion string, newConfig *models.StemConfig) error {
-	return r.storage.WithLock(func() error {
+	return r.storage.WithStemLock(key, func() error {
 		stem, exists := r.storage.Stems[key]
 		if !exists {
 			return fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
 		}
 
-		// Preserve existing leaf instances and environment while updating version and config
+		// Preserve existing leaf instances while updating version and config, the environment follows the config
 		stem.Version = newVersion
 		stem.Config = newConfig
+		if newConfig != nil {
+			stem.Environment = newConfig.Env
+		}
+
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemUpdated, StemKey: key, Version: newVersion, Config: newConfig})
+		return nil
+	})
+}
+
+// SetStemMaintenance records whether a stem's servers are in maintenance.
+func (r *StemRepository) SetStemMaintenance(key storage.StemKey, enabled bool) error {
+	return r.storage.WithStemLock(key, func() error {
+		stem, exists := r.storage.Stems[key]
+		if !exists {
+			return fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
+		}
+
+		stem.Maintenance = enabled
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemMaintenance, StemKey: key, Enabled: enabled})
+		return nil
+	})
+}
+
+// SetStemRoute records the URL a stem is served at and the proxy backend serving it.
+func (r *StemRepository) SetStemRoute(key storage.StemKey, url, backend string) error {
+	return r.storage.WithStemLock(key, func() error {
+		stem, exists := r.storage.Stems[key]
+		if !exists {
+			return fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
+		}
+
+		stem.WorkingURL, stem.HAProxyBackend = url, backend
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemRouted, StemKey: key, URL: url, Backend: backend})
+		return nil
+	})
+}
+
+// SetStemReplicas records the number of running leafs a stem was scaled to, nil to follow its minInstances again.
+func (r *StemRepository) SetStemReplicas(key storage.StemKey, replicas *int) error {
+	return r.storage.WithStemLock(key, func() error {
+		stem, exists := r.storage.Stems[key]
+		if !exists {
+			return fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
+		}
+
+		stem.Replicas = replicas
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemScaled, StemKey: key, Desired: replicas})
+		return nil
+	})
+}
 
+// CompareAndSwapStem applies update to a copy of a stem and stores the result, but only if the stem is still
+// at the given revision; otherwise ErrConflict is returned and nothing changes. Callers read the revision
+// along with the state they decide on, so a concurrent change is never overwritten. Leafs are changed
+// through the LeafRepository, not through update. A copy of the stem at its new revision is returned.
+func (r *StemRepository) CompareAndSwapStem(key storage.StemKey, revision uint64, update func(stem *models.Stem) error) (*models.Stem, error) {
+	var swapped *models.Stem
+	err := r.storage.WithStemLock(key, func() error {
+		stem, exists := r.storage.Stems[key]
+		if !exists {
+			return fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
+		}
+		if stem.Revision != revision {
+			return fmt.Errorf("stem %s with version %s is at revision %d, not %d: %w", key.Name, key.Version, stem.Revision, revision, ErrConflict)
+		}
+
+		updated := *stem
+		if err := update(&updated); err != nil {
+			return err
+		}
+		updated.Revision, updated.LeafInstances = stem.Revision, stem.LeafInstances
+		*stem = updated
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemReplaced, StemKey: key, Stem: stem})
+		swapped = stem.Clone()
 		return nil
 	})
+	return swapped, err
+}
+
+// CountStemRestart adds one to the number of leafs of a stem that were replaced or found dead.
+func (r *StemRepository) CountStemRestart(key storage.StemKey) error {
+	return r.storage.WithStemLock(key, func() error {
+		stem, exists := r.storage.Stems[key]
+		if !exists {
+			return fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
+		}
+
+		stem.Restarts++
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemRestarted, StemKey: key})
+		return nil
+	})
+}
+
+// StageLeafStart stages counting a started leaf of a stem in tx.
+func (r *StemRepository) StageLeafStart(tx *storage.Tx, key storage.StemKey) {
+	tx.Stage(func(stems map[storage.StemKey]*models.Stem) (storage.JournalEntry, func(), error) {
+		stem, exists := stems[key]
+		if !exists {
+			return storage.JournalEntry{}, nil, fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
+		}
+
+		stem.LeafStarts++
+		return storage.JournalEntry{Op: storage.OpStemLeafStarted, StemKey: key}, func() { stem.LeafStarts-- }, nil
+	})
+}
+
+// RecordColdStart adds a cold start of a stem to its cold start stats.
+func (r *StemRepository) RecordColdStart(key storage.StemKey, coldStart models.ColdStart) error {
+	return r.storage.WithStemLock(key, func() error {
+		stem, exists := r.storage.Stems[key]
+		if !exists {
+			return fmt.Errorf("stem %s with version %s not found", key.Name, key.Version)
+		}
+
+		stem.ColdStarts.Add(coldStart)
+		r.storage.Record(storage.JournalEntry{Op: storage.OpStemColdStart, StemKey: key, Cold: &coldStart})
+		return nil
+	})
+}
+
+// QueryStems returns copies of the page of stems matching the query together with the total number of matches.
+// The stems are read at a single point in time, so a page is never torn by a concurrent change.
+func (r *StemRepository) QueryStems(query StemQuery) ([]*models.Stem, int, error) {
+	var matched []*models.Stem
+	for _, stem := range r.storage.ReadSnapshot().Stems() {
+		if query.matches(stem) {
+			matched = append(matched, stem)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if query.Descending {
+			return query.less(matched[j], matched[i])
+		}
+		return query.less(matched[i], matched[j])
+	})
+
+	return paginate(matched, query.Offset, query.Limit), len(matched), nil
+}
+
+// matches reports whether the stem satisfies every filter set on the query.
+func (q StemQuery) matches(stem *models.Stem) bool {
+	if q.Type != "" && stem.Type != q.Type {
+		return false
+	}
+	if q.Version != "" && stem.Version != q.Version {
+		return false
+	}
+	if q.LeafStatus != "" {
+		found := false
+		for _, leaf := range stem.LeafInstances {
+			if leaf.Status == q.LeafStatus {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for key, value := range q.Labels {
+		if stem.Config == nil || stem.Config.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// less orders two stems by the query's sort field, using name and version as tie-breakers.
+func (q StemQuery) less(a, b *models.Stem) bool {
+	switch q.SortBy {
+	case StemSortByVersion:
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+	case StemSortByType:
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.Version < b.Version
+}
+
+// paginate returns the window of items described by offset and limit.
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
 }
@@ -209,3 +209,108 @@ func TestLeafRepository_ClearGraftNode(t *testing.T) {
 		t.Errorf("expected graft node to be nil after clearing, got %+v", graftNode)
 	}
 }
+
+func TestStemRepository_QueryStems(t *testing.T) {
+	testStorage := storage.GetTestStorage()
+	repo := NewStemRepository(testStorage)
+
+	// Filter by type
+	stems, total, err := repo.QueryStems(StemQuery{Type: models.StemTypeSystem})
+	if err != nil {
+		t.Fatalf("failed to query stems: %v", err)
+	}
+	if total != 1 || len(stems) != 1 || stems[0].Name != "system-service" {
+		t.Errorf("expected only system-service for type filter, got total=%d stems=%d", total, len(stems))
+	}
+
+	// Sort descending by name with pagination
+	stems, total, err = repo.QueryStems(StemQuery{SortBy: StemSortByName, Descending: true, Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to query stems: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("expected total of 2 stems, got %d", total)
+	}
+	if len(stems) != 1 || stems[0].Name != "user-deployment" {
+		t.Errorf("expected first page to contain user-deployment")
+	}
+
+	stems, _, err = repo.QueryStems(StemQuery{SortBy: StemSortByName, Descending: true, Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to query stems: %v", err)
+	}
+	if len(stems) != 1 || stems[0].Name != "system-service" {
+		t.Errorf("expected second page to contain system-service")
+	}
+
+	// Filter by label and leaf status
+	testStorage.Stems[storage.StemKey{Name: "user-deployment", Version: "1.0.0"}].Config.Labels = map[string]string{"team": "core"}
+	stems, total, err = repo.QueryStems(StemQuery{Labels: map[string]string{"team": "core"}, LeafStatus: models.StatusUnknown})
+	if err != nil {
+		t.Fatalf("failed to query stems: %v", err)
+	}
+	if total != 1 || stems[0].Name != "user-deployment" {
+		t.Errorf("expected only user-deployment for label filter, got total=%d", total)
+	}
+
+	// Offset past the end returns an empty page
+	stems, total, err = repo.QueryStems(StemQuery{Offset: 10})
+	if err != nil {
+		t.Fatalf("failed to query stems: %v", err)
+	}
+	if total != 2 || len(stems) != 0 {
+		t.Errorf("expected empty page with total 2, got total=%d stems=%d", total, len(stems))
+	}
+}
+
+func TestStemRepository_Tombstones(t *testing.T) {
+	testStorage := storage.GetTestStorage()
+	repo := NewStemRepository(testStorage)
+
+	systemKey := storage.StemKey{Name: "system-service", Version: "1.0.0"}
+	userKey := storage.StemKey{Name: "user-deployment", Version: "1.0.0"}
+	deleted := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	// The stem is removed, its tombstone keeps the leafs it still has and those it had before
+	stopped := map[string]*models.Leaf{"leaf-0": {ID: "leaf-0", Status: models.StatusRunning}, "leaf-1": {ID: "leaf-1", Status: models.StatusRunning}}
+	if err := repo.TombstoneStem(systemKey, deleted, stopped); err != nil {
+		t.Fatalf("failed to tombstone stem: %v", err)
+	}
+	if err := repo.TombstoneStem(userKey, deleted.Add(time.Hour), nil); err != nil {
+		t.Fatalf("failed to tombstone stem: %v", err)
+	}
+	if _, err := repo.FetchStem(systemKey); err == nil {
+		t.Errorf("expected the tombstoned stem to be removed")
+	}
+	if err := repo.TombstoneStem(systemKey, deleted, nil); err == nil {
+		t.Errorf("expected an error when tombstoning a removed stem")
+	}
+
+	tombstone, err := repo.FetchTombstone(systemKey)
+	if err != nil {
+		t.Fatalf("failed to fetch tombstone: %v", err)
+	}
+	if !tombstone.Deleted.Equal(deleted) || len(tombstone.LeafInstances) != 2 {
+		t.Errorf("expected a tombstone deleted at %s with 2 leafs, got %s with %d", deleted, tombstone.Deleted, len(tombstone.LeafInstances))
+	}
+	if tombstone.LeafInstances["leaf-1"].Status != models.StatusUnknown {
+		t.Errorf("expected the stem's own leaf to win over the given one")
+	}
+
+	tombstones, err := repo.ListTombstones()
+	if err != nil || len(tombstones) != 2 || tombstones[0].Name != "system-service" {
+		t.Fatalf("expected 2 tombstones, oldest first, got %d: %v", len(tombstones), err)
+	}
+
+	// Only tombstones deleted before the cutoff are purged
+	purged, err := repo.PurgeTombstones(deleted.Add(time.Minute))
+	if err != nil || len(purged) != 1 || purged[0].Name != "system-service" {
+		t.Fatalf("expected only system-service to be purged, got %d: %v", len(purged), err)
+	}
+	if _, err := repo.FetchTombstone(systemKey); err == nil {
+		t.Errorf("expected the purged tombstone to be gone")
+	}
+	if _, err := repo.FetchTombstone(userKey); err != nil {
+		t.Errorf("expected the newer tombstone to be kept: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package repos
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStemRepository_Versions(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	repo := NewStemRepository(db)
+	registered := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	stem := func(version string) *models.Stem {
+		return &models.Stem{Name: "billing", Version: version, Config: &models.StemConfig{Name: "billing", Version: version}}
+	}
+
+	// The first version points back to none, later ones to the newest registered version
+	v1, err := repo.RegisterVersion(stem("v1"), registered)
+	assert.NoError(t, err)
+	assert.Equal(t, "", v1.Previous)
+	v2, err := repo.RegisterVersion(stem("v2"), registered.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", v2.Previous)
+
+	// Registered versions are preferred over newer unregistered ones, and rolled back ones are skipped
+	assert.NoError(t, repo.SetVersionStatus(storage.StemKey{Name: "billing", Version: "v2"}, models.VersionRolledBack, registered.Add(2*time.Hour)))
+	v3, err := repo.RegisterVersion(stem("v3"), registered.Add(3*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", v3.Previous)
+	assert.NoError(t, repo.SetVersionStatus(storage.StemKey{Name: "billing", Version: "v1"}, models.VersionUnregistered, registered.Add(4*time.Hour)))
+	v4, err := repo.RegisterVersion(stem("v4"), registered.Add(5*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, "v3", v4.Previous)
+
+	// A version registered again keeps its pointer and counts the registration
+	v1, err = repo.RegisterVersion(stem("v1"), registered.Add(6*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, "", v1.Previous)
+	assert.Equal(t, 2, v1.Registrations)
+	assert.Equal(t, models.VersionActive, v1.Status)
+	assert.True(t, v1.UnregisteredAt.IsZero())
+
+	history, err := repo.ListVersions("billing")
+	assert.NoError(t, err)
+	versions := make([]string, 0, len(history))
+	for _, entry := range history {
+		versions = append(versions, entry.Version+":"+string(entry.Status))
+	}
+	assert.Equal(t, []string{"v1:active", "v2:rolled_back", "v3:active", "v4:active"}, versions)
+
+	// Copies are returned
+	history[1].Status = models.VersionActive
+	v2, err = repo.FetchVersion(storage.StemKey{Name: "billing", Version: "v2"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.VersionRolledBack, v2.Status)
+	assert.Equal(t, registered.Add(2*time.Hour), v2.UnregisteredAt)
+
+	_, err = repo.FetchVersion(storage.StemKey{Name: "billing", Version: "v9"})
+	assert.Error(t, err)
+	assert.Error(t, repo.SetVersionStatus(storage.StemKey{Name: "reports", Version: "v1"}, models.VersionFailed, registered))
+	history, err = repo.ListVersions("reports")
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestStemRepository_VersionsJournal(t *testing.T) {
+	db := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	journal, err := storage.OpenFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	defer journal.Close()
+	db.SetJournal(journal)
+	repo := NewStemRepository(db)
+	key := storage.StemKey{Name: "billing", Version: "v1"}
+
+	assert.NoError(t, repo.SaveStem(key, &models.Stem{Name: "billing", Version: "v1"}))
+	_, err = repo.RegisterVersion(&models.Stem{Name: "billing", Version: "v1"}, time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, repo.TombstoneStem(key, time.Now(), nil))
+	assert.NoError(t, repo.SetVersionStatus(key, models.VersionUnregistered, time.Now()))
+	_, err = repo.PurgeTombstones(time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+
+	// The history outlives the tombstone, also when replayed
+	entries, err := journal.Query(storage.JournalQuery{})
+	assert.NoError(t, err)
+	replayed := &storage.HerbariumDB{Stems: map[storage.StemKey]*models.Stem{}}
+	assert.NoError(t, replayed.Replay(entries))
+	history, err := NewStemRepository(replayed).ListVersions("billing")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, models.VersionUnregistered, history[0].Status)
+		assert.Equal(t, 1, history[0].Registrations)
+	}
+	assert.Empty(t, replayed.Tombstones)
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// SnapshotFormatVersion is the format version written into snapshot files.
+const SnapshotFormatVersion = 1
+
+// Snapshot is a point-in-time copy of HerbariumDB: stems, their leafs, and graft nodes, and the version
+// history of the stems.
+type Snapshot struct {
+	FormatVersion int                              `json:"formatVersion"`
+	CreatedAt     time.Time                        `json:"createdAt"`
+	JournalSeq    uint64                           `json:"journalSeq,omitempty"` // Last journal entry included in the snapshot
+	Stems         []*models.Stem                   `json:"stems"`
+	Versions      map[string][]*models.StemVersion `json:"versions,omitempty"` // Absent from snapshots taken before histories were kept
+}
+
+// Snapshot returns a deep copy of the current state, with stems sorted by name and version.
+func (s *HerbariumDB) Snapshot() (*Snapshot, error) {
+	var data, versions []byte
+	var journalSeq uint64
+	// The write lock keeps stems from changing while they are copied, and the copy consistent with the journal
+	err := s.WithLock(func() error {
+		if s.journal != nil {
+			journalSeq = s.journal.LastSeq()
+		}
+
+		stems := make([]*models.Stem, 0, len(s.Stems))
+		for _, stem := range s.Stems {
+			stems = append(stems, stem)
+		}
+		sort.Slice(stems, func(i, j int) bool {
+			if stems[i].Name != stems[j].Name {
+				return stems[i].Name < stems[j].Name
+			}
+			return stems[i].Version < stems[j].Version
+		})
+
+		// Encode while holding the lock; decoding below yields an independent copy
+		var err error
+		if data, err = json.Marshal(stems); err != nil {
+			return err
+		}
+		versions, err = json.Marshal(s.Versions)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %v", err)
+	}
+
+	snapshot := &Snapshot{FormatVersion: SnapshotFormatVersion, CreatedAt: time.Now().UTC(), JournalSeq: journalSeq}
+	if err := json.Unmarshal(data, &snapshot.Stems); err != nil {
+		return nil, fmt.Errorf("failed to copy state: %v", err)
+	}
+	if err := json.Unmarshal(versions, &snapshot.Versions); err != nil {
+		return nil, fmt.Errorf("failed to copy version history: %v", err)
+	}
+	return snapshot, nil
+}
+
+// Restore replaces the current state with the stems of a snapshot, and the version history with the snapshot's
+// if it has one.
+func (s *HerbariumDB) Restore(snapshot *Snapshot) error {
+	if snapshot.FormatVersion != SnapshotFormatVersion {
+		return fmt.Errorf("unsupported snapshot format version %d", snapshot.FormatVersion)
+	}
+
+	stems := make(map[StemKey]*models.Stem, len(snapshot.Stems))
+	for _, stem := range snapshot.Stems {
+		if stem.LeafInstances == nil {
+			stem.LeafInstances = make(map[string]*models.Leaf)
+		}
+		stems[StemKey{Name: stem.Name, Version: stem.Version}] = stem
+	}
+
+	return s.WithLock(func() error {
+		s.Stems = stems
+		if snapshot.Versions != nil {
+			s.Versions = snapshot.Versions
+		}
+		s.stemLocks.Clear()
+		s.publishAll()
+		s.notify(JournalEntry{Op: OpStateReset})
+		return nil
+	})
+}
+
+// WriteSnapshotFile writes a snapshot to path atomically, so a crash never leaves a truncated file behind.
+func WriteSnapshotFile(path string, snapshot *Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot file: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move snapshot file into place: %v", err)
+	}
+	return nil
+}
+
+// ReadSnapshotFile reads a snapshot written by WriteSnapshotFile.
+func ReadSnapshotFile(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file: %v", err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot file %s: %v", path, err)
+	}
+	if snapshot.FormatVersion != SnapshotFormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot format version %d in %s", snapshot.FormatVersion, path)
+	}
+	return &snapshot, nil
+}
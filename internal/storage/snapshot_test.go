@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHerbariumDB_SnapshotRestore(t *testing.T) {
+	db := GetTestStorage()
+	db.Versions = map[string][]*models.StemVersion{"system-service": {{Name: "system-service", Version: "1.0.0", Status: models.VersionActive}}}
+
+	snapshot, err := db.Snapshot()
+	assert.NoError(t, err)
+	assert.Equal(t, SnapshotFormatVersion, snapshot.FormatVersion)
+	assert.Len(t, snapshot.Stems, 2)
+	assert.Equal(t, "system-service", snapshot.Stems[0].Name)
+
+	// The snapshot is a deep copy
+	snapshot.Stems[0].LeafInstances["leaf-1"].Port = 1
+	assert.Equal(t, 8081, db.Stems[StemKey{Name: "system-service", Version: "1.0.0"}].LeafInstances["leaf-1"].Port)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	assert.NoError(t, WriteSnapshotFile(path, snapshot))
+
+	restored, err := ReadSnapshotFile(path)
+	assert.NoError(t, err)
+
+	target := &HerbariumDB{Stems: map[StemKey]*models.Stem{}}
+	assert.NoError(t, target.Restore(restored))
+	stem := target.Stems[StemKey{Name: "system-service", Version: "1.0.0"}]
+	if assert.NotNil(t, stem) {
+		assert.Equal(t, 1, stem.LeafInstances["leaf-1"].Port)
+		assert.Equal(t, "postgres", stem.Config.Dependencies[0].Name)
+	}
+	assert.Equal(t, db.Versions, target.Versions)
+
+	// Snapshots without a version history keep the current one
+	restored.Versions = nil
+	assert.NoError(t, target.Restore(restored))
+	assert.Len(t, target.Versions["system-service"], 1)
+
+	restored.FormatVersion = 99
+	assert.Error(t, target.Restore(restored))
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// StateView is a point-in-time copy of all stems with their leafs and graft nodes, taken by ReadSnapshot. It
+// is read without any lock, so long-running readers such as the metrics exporter or a diagnostic dump neither
+// hold up writers nor see a stem changed halfway through. The stems may be shared by several readers and
+// must not be changed.
+type StateView struct {
+	Taken      time.Time // When the view was taken
+	JournalSeq uint64    // Last journal entry reflected in the view, 0 without a journal
+	stems      []*models.Stem
+	byKey      map[StemKey]*models.Stem
+}
+
+// NewStateView creates a view of the given stems, which it takes ownership of.
+func NewStateView(taken time.Time, journalSeq uint64, stems map[StemKey]*models.Stem) *StateView {
+	keys := make([]StemKey, 0, len(stems))
+	for key := range stems {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].Version < keys[j].Version
+	})
+
+	view := &StateView{Taken: taken, JournalSeq: journalSeq, stems: make([]*models.Stem, 0, len(keys)), byKey: stems}
+	for _, key := range keys {
+		view.stems = append(view.stems, stems[key])
+	}
+	return view
+}
+
+// ReadSnapshot copies all stems at a single point in time. Every stem is read-locked at once while copying,
+// so no mutation is reflected in one stem of the view but not in another.
+func (s *HerbariumDB) ReadSnapshot() *StateView {
+	s.acquire(s.mu.TryRLock, s.mu.RLock)
+	defer s.mu.RUnlock()
+	for key := range s.Stems {
+		lock := s.stemLock(key)
+		s.acquire(lock.TryRLock, lock.RLock)
+		defer lock.RUnlock()
+	}
+
+	var journalSeq uint64
+	if s.journal != nil {
+		journalSeq = s.journal.LastSeq()
+	}
+	stems := make(map[StemKey]*models.Stem, len(s.Stems))
+	for key, stem := range s.Stems {
+		stems[key] = stem.Clone()
+	}
+	return NewStateView(time.Now(), journalSeq, stems)
+}
+
+// Stems returns the stems of the view, sorted by name and version.
+func (v *StateView) Stems() []*models.Stem {
+	return v.stems
+}
+
+// Stem returns a stem of the view, nil if it didn't exist when the view was taken.
+func (v *StateView) Stem(key StemKey) *models.Stem {
+	return v.byKey[key]
+}
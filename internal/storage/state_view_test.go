@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHerbariumDB_ReadSnapshot(t *testing.T) {
+	api, web := StemKey{Name: "api", Version: "v1"}, StemKey{Name: "web", Version: "v1"}
+	db := &HerbariumDB{Stems: map[StemKey]*models.Stem{
+		web: {Name: "web", Version: "v1", LeafInstances: map[string]*models.Leaf{}},
+		api: {Name: "api", Version: "v1", LeafInstances: map[string]*models.Leaf{"api-1": {ID: "api-1", Status: models.StatusRunning}}},
+	}}
+	journal, err := OpenFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	defer journal.Close()
+	db.SetJournal(journal)
+	assert.NoError(t, db.WithStemLock(api, func() error {
+		db.Stems[api].Restarts++
+		db.Record(JournalEntry{Op: OpStemRestarted, StemKey: api})
+		return nil
+	}))
+
+	view := db.ReadSnapshot()
+	assert.Equal(t, uint64(1), view.JournalSeq)
+	if assert.Len(t, view.Stems(), 2) {
+		assert.Equal(t, "api", view.Stems()[0].Name, "stems are sorted")
+		assert.Equal(t, "web", view.Stems()[1].Name)
+	}
+	assert.Nil(t, view.Stem(StemKey{Name: "missing", Version: "v1"}))
+
+	// Later changes don't show up in the view
+	assert.NoError(t, db.WithStemLock(api, func() error {
+		db.Stems[api].LeafInstances["api-1"].Status = models.StatusStopping
+		db.Stems[api].Restarts++
+		return nil
+	}))
+	if stem := view.Stem(api); assert.NotNil(t, stem) {
+		assert.Equal(t, 1, stem.Restarts)
+		assert.Equal(t, models.StatusRunning, stem.LeafInstances["api-1"].Status)
+	}
+
+	// A view waits for a stem being changed, so the change is in it entirely or not at all
+	locked, release := make(chan struct{}), make(chan struct{})
+	go db.WithStemLock(web, func() error {
+		close(locked)
+		<-release
+		db.Stems[web].Maintenance = true
+		return nil
+	})
+	<-locked
+	views := make(chan *StateView)
+	go func() { views <- db.ReadSnapshot() }()
+	select {
+	case <-views:
+		t.Fatal("the view was taken while a stem was being changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case view := <-views:
+		assert.True(t, view.Stem(web).Maintenance)
+	case <-time.After(time.Second):
+		t.Fatal("the view was not taken after the change")
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats describes how large the state has grown and how much its locks are contended, so operators can
+// spot runaway growth or writers holding each other up.
+type Stats struct {
+	Stems          int           // Registered stems
+	Leafs          int           // Leafs of all stems
+	GraftNodes     int           // Stems with a graft node set
+	Nodes          int           // Hosts leafs can be placed on
+	JournalEntries uint64        // Sequence number of the last journal entry, 0 without a journal
+	JournalBytes   int64         // Size of the journal, 0 without a journal or when it can't be sized
+	LockWaits      uint64        // Lock acquisitions that had to wait for another holder
+	LockWaitTime   time.Duration // Time spent waiting for locks, summed
+}
+
+// lockStats counts how often and how long locks of the state were waited for.
+type lockStats struct {
+	waits    atomic.Uint64
+	waitTime atomic.Int64 // Nanoseconds
+}
+
+// sizedJournal is implemented by journals that can tell how many bytes they take up.
+type sizedJournal interface {
+	Size() int64
+}
+
+// acquire takes a lock with lock, trying tryLock first so that only acquisitions that have to wait are
+// timed and counted.
+func (s *HerbariumDB) acquire(tryLock func() bool, lock func()) {
+	if tryLock() {
+		return
+	}
+	start := time.Now()
+	lock()
+	s.locks.waits.Add(1)
+	s.locks.waitTime.Add(int64(time.Since(start)))
+}
+
+// Stats counts the stems, leafs, graft nodes, and nodes of the state, and reports the size of the journal
+// and the lock contention seen since startup.
+func (s *HerbariumDB) Stats() Stats {
+	view := s.ReadSnapshot()
+
+	s.mu.RLock()
+	stats := Stats{Nodes: len(s.Nodes), JournalEntries: view.JournalSeq}
+	if sized, ok := s.journal.(sizedJournal); ok {
+		stats.JournalBytes = sized.Size()
+	}
+	s.mu.RUnlock()
+
+	stats.Stems = len(view.Stems())
+	for _, stem := range view.Stems() {
+		stats.Leafs += len(stem.LeafInstances)
+		if stem.GraftNodeLeaf != nil {
+			stats.GraftNodes++
+		}
+	}
+	stats.LockWaits = s.locks.waits.Load()
+	stats.LockWaitTime = time.Duration(s.locks.waitTime.Load())
+	return stats
+}
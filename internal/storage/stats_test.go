@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHerbariumDB_Stats(t *testing.T) {
+	db := GetTestStorage()
+	db.Nodes = map[string]*models.Node{"edge-1": {Name: "edge-1"}}
+	journal, err := OpenFileJournal(filepath.Join(t.TempDir(), "journal.log"), false)
+	assert.NoError(t, err)
+	defer journal.Close()
+	db.SetJournal(journal)
+
+	key := StemKey{Name: "system-service", Version: "1.0.0"}
+	assert.NoError(t, db.WithStemLock(key, func() error {
+		db.Record(JournalEntry{Op: OpLeafStatusChanged, StemKey: key, LeafID: "leaf-1", Status: models.StatusRunning})
+		return nil
+	}))
+
+	stats := db.Stats()
+	assert.Equal(t, 2, stats.Stems)
+	assert.Equal(t, 2, stats.Leafs)
+	assert.Equal(t, 1, stats.GraftNodes)
+	assert.Equal(t, 1, stats.Nodes)
+	assert.Equal(t, uint64(1), stats.JournalEntries)
+	assert.Greater(t, stats.JournalBytes, int64(0))
+	assert.Zero(t, stats.LockWaits)
+
+	// Waiting for a held stem lock is counted as contention
+	locked, release := make(chan struct{}), make(chan struct{})
+	go db.WithStemLock(key, func() error {
+		close(locked)
+		<-release
+		return nil
+	})
+	<-locked
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+	assert.NoError(t, db.WithStemRLock(key, func() error { return nil }))
+
+	stats = db.Stats()
+	assert.Equal(t, uint64(1), stats.LockWaits)
+	assert.GreaterOrEqual(t, stats.LockWaitTime, 10*time.Millisecond)
+}
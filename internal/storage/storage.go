@@ -7,14 +7,29 @@ import (
 
 // StemKey represents a composite key for identifying stems by name and version.
 type StemKey struct {
-	Name    string
-	Version string
+	Name    string `json:"name"`
+	Version string `json:"version"`
 }
 
 // HerbariumDB is a singleton in-memory storage for managing Stems and their associated leaf instances.
+//
+// Locking is two-level: mu guards the Stems and Nodes maps and the whole state, and every stem has a lock of
+// its own guarding its fields and leafs. Operations on one stem hold mu for reading and the stem's lock, so
+// unrelated stems don't wait for each other; operations on the whole state hold mu for writing, which
+// excludes all of them.
 type HerbariumDB struct {
-	Stems map[StemKey]*models.Stem // Map of Stems, keyed by composite key
-	mu    sync.RWMutex             // Mutex to handle concurrent access safely
+	Stems      map[StemKey]*models.Stem         // Map of Stems, keyed by composite key
+	Tombstones map[StemKey]*models.Stem         // Unregistered stems kept until they are purged, keyed by composite key
+	Versions   map[string][]*models.StemVersion // Every version ever registered for a stem, first registered first, keyed by stem name
+	Nodes      map[string]*models.Node          // Hosts leafs can be placed on, keyed by name
+	mu         sync.RWMutex                     // Mutex to handle concurrent access safely
+	stemLocks  sync.Map                         // Lock of each stem, StemKey to *sync.RWMutex, created on first use
+	journal    Journal                          // Optional journal recording every mutation
+	publisher  *publisher                       // Optional writer mirroring the state to a shared backend
+	locks      lockStats                        // Contention of mu and the stem locks
+
+	watchMu sync.Mutex // Guards watches, which are notified while mu or a stem lock is held
+	watches []*watch
 }
 
 // instance is the singleton instance of HerbariumDB.
@@ -25,7 +40,10 @@ var once sync.Once
 func GetHerbariumDB() *HerbariumDB {
 	once.Do(func() {
 		instance = &HerbariumDB{
-			Stems: make(map[StemKey]*models.Stem),
+			Stems:      make(map[StemKey]*models.Stem),
+			Tombstones: make(map[StemKey]*models.Stem),
+			Versions:   make(map[string][]*models.StemVersion),
+			Nodes:      make(map[string]*models.Node),
 		}
 	})
 	return instance
@@ -33,20 +51,91 @@ func GetHerbariumDB() *HerbariumDB {
 
 // WithLock executes fn while holding the write lock.
 func (s *HerbariumDB) WithLock(fn func() error) error {
-	s.mu.Lock()
+	s.acquire(s.mu.TryLock, s.mu.Lock)
 	defer s.mu.Unlock()
 	return fn()
 }
 
-// WithRLock executes fn while holding the read lock.
+// WithRLock executes fn while holding the read lock. It keeps the Stems map from changing, but not the stems
+// in it; use WithStemRLock or ReadSnapshot to read their fields and leafs.
 func (s *HerbariumDB) WithRLock(fn func() error) error {
-	s.mu.RLock()
+	s.acquire(s.mu.TryRLock, s.mu.RLock)
+	defer s.mu.RUnlock()
+	return fn()
+}
+
+// WithStemLock executes fn while holding the write lock of a single stem. It may change the stem and its
+// leafs, but not add stems to or remove them from the Stems map.
+func (s *HerbariumDB) WithStemLock(key StemKey, fn func() error) error {
+	s.acquire(s.mu.TryRLock, s.mu.RLock)
 	defer s.mu.RUnlock()
+	lock := s.stemLock(key)
+	s.acquire(lock.TryLock, lock.Lock)
+	defer lock.Unlock()
 	return fn()
 }
 
+// WithStemRLock executes fn while holding the read lock of a single stem.
+func (s *HerbariumDB) WithStemRLock(key StemKey, fn func() error) error {
+	s.acquire(s.mu.TryRLock, s.mu.RLock)
+	defer s.mu.RUnlock()
+	lock := s.stemLock(key)
+	s.acquire(lock.TryRLock, lock.RLock)
+	defer lock.RUnlock()
+	return fn()
+}
+
+// stemLock returns the lock of a stem, creating it on first use. It must be called while holding mu, so a
+// lock is never dropped while someone holds it.
+func (s *HerbariumDB) stemLock(key StemKey) *sync.RWMutex {
+	lock, _ := s.stemLocks.LoadOrStore(key, &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+// forgetStemLock drops the lock of a removed stem. It must be called while holding the write lock.
+func (s *HerbariumDB) forgetStemLock(key StemKey) {
+	s.stemLocks.Delete(key)
+}
+
+// bury keeps a removed stem as a tombstone, replacing an older tombstone of the same key. It must be called
+// while holding the write lock.
+func (s *HerbariumDB) bury(key StemKey, tombstone *models.Stem) {
+	if s.Tombstones == nil {
+		s.Tombstones = make(map[StemKey]*models.Stem)
+	}
+	s.Tombstones[key] = tombstone
+}
+
+// keepVersion stores an entry of a stem's version history, replacing the entry of the same version. It must be
+// called while holding the write lock.
+func (s *HerbariumDB) keepVersion(version *models.StemVersion) {
+	if s.Versions == nil {
+		s.Versions = make(map[string][]*models.StemVersion)
+	}
+	history := s.Versions[version.Name]
+	for i, kept := range history {
+		if kept.Version == version.Version {
+			history[i] = version
+			return
+		}
+	}
+	s.Versions[version.Name] = append(history, version)
+}
+
+// KeepVersion stores an entry of a stem's version history and journals it, replacing the entry of the same
+// version. It must be called while holding the write lock.
+func (s *HerbariumDB) KeepVersion(version *models.StemVersion) {
+	s.keepVersion(version)
+	s.Record(JournalEntry{Op: OpVersionKept, StemKey: StemKey{Name: version.Name, Version: version.Version}, History: version})
+}
+
 func (s *HerbariumDB) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.Stems = make(map[StemKey]*models.Stem)
+	s.Tombstones = make(map[StemKey]*models.Stem)
+	s.Versions = make(map[string][]*models.StemVersion)
+	s.Nodes = make(map[string]*models.Node)
+	s.stemLocks.Clear()
+	s.notify(JournalEntry{Op: OpStateReset})
 }
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHerbariumDB_StemLocks(t *testing.T) {
+	api, web := StemKey{Name: "api", Version: "v1"}, StemKey{Name: "web", Version: "v1"}
+	db := &HerbariumDB{Stems: map[StemKey]*models.Stem{
+		api: {Name: "api", Version: "v1", LeafInstances: map[string]*models.Leaf{}},
+		web: {Name: "web", Version: "v1", LeafInstances: map[string]*models.Leaf{}},
+	}}
+
+	// A slow operation on one stem holds its lock
+	locked, release := make(chan struct{}), make(chan struct{})
+	go db.WithStemLock(api, func() error {
+		close(locked)
+		<-release
+		return nil
+	})
+	<-locked
+
+	// Other stems and the stem map stay available
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, db.WithStemLock(web, func() error { db.Stems[web].Restarts++; return nil }))
+		assert.NoError(t, db.WithRLock(func() error { return nil }))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("an operation on another stem waited for the locked stem")
+	}
+
+	// The same stem and the whole state wait for it
+	waiting := make(chan string, 2)
+	go func() { db.WithStemRLock(api, func() error { waiting <- "stem"; return nil }) }()
+	go func() { db.WithLock(func() error { waiting <- "state"; return nil }) }()
+	select {
+	case got := <-waiting:
+		t.Fatalf("%s lock was granted while the stem was locked", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-waiting:
+		case <-time.After(time.Second):
+			t.Fatal("lock was not granted after the stem was released")
+		}
+	}
+}
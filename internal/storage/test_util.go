@@ -35,10 +35,7 @@ func initTestStorage() *HerbariumDB {
 					Command: "./start.sh",
 					Env:     map[string]string{"ENV": "production"},
 					Version: "1.0.0",
-					Dependencies: []struct {
-						Name   string `yaml:"name"`
-						Schema string `yaml:"schema"`
-					}{
+					Dependencies: []models.Dependency{
 						{
 							Name:   "postgres",
 							Schema: "prod",
@@ -77,10 +74,7 @@ func initTestStorage() *HerbariumDB {
 					Command: "./run.sh",
 					Env:     map[string]string{"DEBUG": "true"},
 					Version: "1.0.0",
-					Dependencies: []struct {
-						Name   string `yaml:"name"`
-						Schema string `yaml:"schema"`
-					}{
+					Dependencies: []models.Dependency{
 						{
 							Name:   "postgres",
 							Schema: "test",
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// TxOp is a mutation staged in a transaction. It is applied to the stems while holding the write lock and
+// returns the journal entry describing it and a function reverting it, or an error if it can't be applied.
+type TxOp func(stems map[StemKey]*models.Stem) (entry JournalEntry, undo func(), err error)
+
+// Tx groups mutations of a HerbariumDB so they are applied together by Commit, or not at all. Staged
+// mutations are invisible until the commit, so the state is never half-written while the work they describe,
+// such as starting a leaf process, is still in progress. Side effects outside the state, like a reserved port
+// or a started process, are registered with OnRollback and undone if the transaction is rolled back.
+type Tx struct {
+	db        *HerbariumDB
+	mu        sync.Mutex
+	ops       []TxOp
+	rollbacks []func()
+	closed    bool
+}
+
+// Begin starts a transaction on the state.
+func (s *HerbariumDB) Begin() *Tx {
+	return &Tx{db: s}
+}
+
+// Stage adds a mutation to be applied on commit.
+func (tx *Tx) Stage(op TxOp) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.ops = append(tx.ops, op)
+}
+
+// OnRollback registers a function undoing a side effect of the work the transaction describes. Rollback
+// calls them in reverse order.
+func (tx *Tx) OnRollback(fn func()) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.rollbacks = append(tx.rollbacks, fn)
+}
+
+// Commit applies the staged mutations in order and records them. If one fails, those applied before it are
+// reverted, nothing is recorded, and the error is returned; the transaction stays open, so the caller's
+// Rollback still undoes the side effects.
+func (tx *Tx) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return fmt.Errorf("transaction already closed")
+	}
+
+	err := tx.db.WithLock(func() error {
+		entries := make([]JournalEntry, 0, len(tx.ops))
+		undos := make([]func(), 0, len(tx.ops))
+		for _, op := range tx.ops {
+			entry, undo, err := op(tx.db.Stems)
+			if err != nil {
+				for i := len(undos) - 1; i >= 0; i-- {
+					undos[i]()
+				}
+				return err
+			}
+			entries = append(entries, entry)
+			undos = append(undos, undo)
+		}
+		for _, entry := range entries {
+			tx.db.Record(entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	tx.closed = true
+	return nil
+}
+
+// Rollback discards the staged mutations and undoes the registered side effects. It does nothing after a
+// successful Commit, so it can be deferred right after Begin.
+func (tx *Tx) Rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return
+	}
+	tx.closed = true
+	for i := len(tx.rollbacks) - 1; i >= 0; i-- {
+		tx.rollbacks[i]()
+	}
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTx(t *testing.T) {
+	key := StemKey{Name: "api", Version: "v1"}
+	db := &HerbariumDB{Stems: map[StemKey]*models.Stem{
+		key: {Name: "api", Version: "v1", LeafInstances: map[string]*models.Leaf{}},
+	}}
+	addLeaf := func(id string) TxOp {
+		return func(stems map[StemKey]*models.Stem) (JournalEntry, func(), error) {
+			stem := stems[key]
+			if _, exists := stem.LeafInstances[id]; exists {
+				return JournalEntry{}, nil, errors.New("leaf exists")
+			}
+			leaf := &models.Leaf{ID: id}
+			stem.LeafInstances[id] = leaf
+			return JournalEntry{Op: OpLeafAdded, StemKey: key, LeafID: id, Leaf: leaf}, func() { delete(stem.LeafInstances, id) }, nil
+		}
+	}
+
+	// Nothing is visible before the commit, everything after it
+	tx := db.Begin()
+	rolledBack := false
+	tx.OnRollback(func() { rolledBack = true })
+	tx.Stage(addLeaf("leaf-1"))
+	tx.Stage(addLeaf("leaf-2"))
+	assert.Empty(t, db.Stems[key].LeafInstances)
+	assert.NoError(t, tx.Commit())
+	tx.Rollback()
+	assert.False(t, rolledBack, "committed transactions aren't rolled back")
+	assert.Len(t, db.Stems[key].LeafInstances, 2)
+	assert.Equal(t, uint64(1), db.Stems[key].LeafInstances["leaf-2"].Revision)
+	assert.Error(t, tx.Commit())
+
+	// A failing mutation reverts those before it and leaves the side effects to Rollback
+	tx = db.Begin()
+	var undone []string
+	tx.OnRollback(func() { undone = append(undone, "port") })
+	tx.OnRollback(func() { undone = append(undone, "process") })
+	tx.Stage(addLeaf("leaf-3"))
+	tx.Stage(addLeaf("leaf-1"))
+	assert.Error(t, tx.Commit())
+	assert.Len(t, db.Stems[key].LeafInstances, 2)
+	assert.NotContains(t, db.Stems[key].LeafInstances, "leaf-3")
+	assert.Empty(t, undone)
+	tx.Rollback()
+	tx.Rollback()
+	assert.Equal(t, []string{"process", "port"}, undone)
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// OpStateReset is passed to watchers when the whole state was replaced by a restore, a journal replay, or
+// Clear, instead of an entry per stem. It is never journaled.
+const OpStateReset JournalOp = "state.reset"
+
+// Watcher receives the mutations of a HerbariumDB, in order. A watcher runs on a goroutine of its own, so it
+// may read the state through the repositories; the pointers in an entry refer to live state and must not be
+// read without the lock.
+type Watcher func(entry JournalEntry)
+
+// watch is a registered Watcher with the mutations not yet passed to it.
+type watch struct {
+	fn      Watcher
+	mu      sync.Mutex
+	pending []JournalEntry
+	wake    chan struct{} // Signalled when pending grows
+	done    chan struct{} // Closed by the cancel function
+}
+
+// Watch registers fn to be called with every mutation from now on, including OpStateReset. Mutations are
+// queued, so slow watchers never hold up writers. The returned function stops the watcher; mutations still
+// queued are dropped.
+func (s *HerbariumDB) Watch(fn Watcher) (cancel func()) {
+	w := &watch{fn: fn, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	s.watchMu.Lock()
+	s.watches = append(s.watches, w)
+	s.watchMu.Unlock()
+	go w.run()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.watchMu.Lock()
+			for i, registered := range s.watches {
+				if registered == w {
+					s.watches = append(s.watches[:i:i], s.watches[i+1:]...)
+					break
+				}
+			}
+			s.watchMu.Unlock()
+			close(w.done)
+		})
+	}
+}
+
+// notify queues a mutation for every watcher. It is called while holding the write lock or the lock of the
+// mutated stem, so the mutations of a stem are queued in the order they were applied.
+func (s *HerbariumDB) notify(entry JournalEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	for _, w := range s.watches {
+		w.mu.Lock()
+		w.pending = append(w.pending, entry)
+		w.mu.Unlock()
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run passes queued mutations to the watcher until it is cancelled.
+func (w *watch) run() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.wake:
+		}
+		w.mu.Lock()
+		pending := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+		for _, entry := range pending {
+			select {
+			case <-w.done:
+				return
+			default:
+				w.fn(entry)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHerbariumDB_Watch(t *testing.T) {
+	db := &HerbariumDB{Stems: map[StemKey]*models.Stem{}}
+	key := StemKey{Name: "api", Version: "v1"}
+
+	changes := make(chan JournalEntry, 10)
+	cancel := db.Watch(func(entry JournalEntry) {
+		// Watchers may read the state while they are notified
+		assert.NoError(t, db.WithRLock(func() error { return nil }))
+		changes <- entry
+	})
+
+	assert.NoError(t, db.WithLock(func() error {
+		db.Stems[key] = &models.Stem{Name: "api", Version: "v1", LeafInstances: map[string]*models.Leaf{}}
+		db.Record(JournalEntry{Op: OpStemSaved, StemKey: key})
+		db.Record(JournalEntry{Op: OpLeafAdded, StemKey: key, LeafID: "api-1"})
+		return nil
+	}))
+	assert.NoError(t, db.Restore(&Snapshot{FormatVersion: SnapshotFormatVersion}))
+
+	for _, want := range []JournalOp{OpStemSaved, OpLeafAdded, OpStateReset} {
+		select {
+		case entry := <-changes:
+			assert.Equal(t, want, entry.Op)
+			assert.False(t, entry.Time.IsZero())
+		case <-time.After(time.Second):
+			t.Fatalf("no %s change received", want)
+		}
+	}
+
+	// Cancelled watchers are no longer called
+	cancel()
+	cancel()
+	db.Clear()
+	select {
+	case entry := <-changes:
+		t.Fatalf("unexpected %s change after cancel", entry.Op)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,427 @@
+// Package traefik implements proxy.ProxyClient by serving dynamic configuration to Traefik's HTTP provider.
+// Traefik's own API is read-only, so Traefik polls herbarium for routers and services instead.
+package traefik
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+)
+
+// DefaultListenAddress is used when the config leaves the listen address empty.
+const DefaultListenAddress = ":8091"
+
+// ConfigPath is the path Traefik's HTTP provider endpoint points at.
+const ConfigPath = "/traefik/config"
+
+// APIKeyHeader carries the API key Traefik sends through the HTTP provider's headers option.
+const APIKeyHeader = "X-API-Key"
+
+// invalidNameChars matches characters not allowed in generated router and service names.
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// TraefikConfig configures the Traefik adapter.
+type TraefikConfig struct {
+	ListenAddress string   // Address the HTTP provider endpoint listens on, defaults to DefaultListenAddress
+	APIKey        string   // API key Traefik must present, empty allows unauthenticated polling
+	EntryPoints   []string // Entry points of the generated routers, empty means all entry points
+}
+
+// TraefikClient keeps the backends in memory and serves them as Traefik dynamic configuration.
+type TraefikClient struct {
+	config     TraefikConfig
+	httpServer *http.Server
+
+	mu       sync.RWMutex
+	backends map[string]*backend
+}
+
+// backend is a service's options and servers (server name -> host:port).
+type backend struct {
+	options proxy.BackendOptions
+	servers map[string]string
+}
+
+// NewTraefikClient creates a Traefik adapter. Call Start to serve the configuration.
+func NewTraefikClient(config TraefikConfig) *TraefikClient {
+	if config.ListenAddress == "" {
+		config.ListenAddress = DefaultListenAddress
+	}
+	c := &TraefikClient{
+		config:   config,
+		backends: make(map[string]*backend),
+	}
+	c.httpServer = &http.Server{Addr: config.ListenAddress, Handler: c.Handler()}
+	return c
+}
+
+// Handler builds the HTTP handler serving the dynamic configuration at ConfigPath.
+func (c *TraefikClient) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+ConfigPath, func(w http.ResponseWriter, r *http.Request) {
+		if c.config.APIKey != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(APIKeyHeader)), []byte(c.config.APIKey)) != 1 {
+			http.Error(w, "missing or invalid API key", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.DynamicConfig()); err != nil {
+			log.Printf("Failed to encode Traefik configuration: %v", err)
+		}
+	})
+	return mux
+}
+
+// Start binds the listen address and serves the configuration in the background.
+func (c *TraefikClient) Start() error {
+	listener, err := net.Listen("tcp", c.config.ListenAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", c.config.ListenAddress, err)
+	}
+	go func() {
+		log.Printf("Serving Traefik configuration on %s%s", listener.Addr(), ConfigPath)
+		if err := c.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Traefik configuration server stopped with error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Close stops serving the configuration.
+func (c *TraefikClient) Close() error {
+	return c.httpServer.Close()
+}
+
+// BindStem creates an empty service for a stem, replacing any existing one.
+func (c *TraefikClient) BindStem(backendName string, options proxy.BackendOptions) error {
+	if options.IsUDP() && options.ListenPort <= 0 {
+		return fmt.Errorf("UDP backend %s needs a listen port", backendName)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backends[backendName] = &backend{options: options, servers: make(map[string]string)}
+	return nil
+}
+
+// BindLeaf adds a leaf's server to a service.
+func (c *TraefikClient) BindLeaf(backendName, leafID, serviceAddress string, servicePort int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.backends[backendName]
+	if !ok {
+		return fmt.Errorf("backend %s not found", backendName)
+	}
+	b.servers[leafID] = net.JoinHostPort(serviceAddress, fmt.Sprint(servicePort))
+	return nil
+}
+
+// UnbindLeaf removes a leaf's server from a service.
+func (c *TraefikClient) UnbindLeaf(backendName, serverName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.backends[backendName]
+	if !ok {
+		return fmt.Errorf("backend %s not found", backendName)
+	}
+	if _, ok := b.servers[serverName]; !ok {
+		return fmt.Errorf("server %s not found in backend %s", serverName, backendName)
+	}
+	delete(b.servers, serverName)
+	return nil
+}
+
+// ReplaceLeaf swaps one server for another, so Traefik never sees the service without either.
+func (c *TraefikClient) ReplaceLeaf(backendName, oldServerName, newServerName, serviceAddress string, servicePort int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.backends[backendName]
+	if !ok {
+		return fmt.Errorf("backend %s not found", backendName)
+	}
+	if _, ok := b.servers[oldServerName]; !ok {
+		return fmt.Errorf("server %s not found in backend %s", oldServerName, backendName)
+	}
+	delete(b.servers, oldServerName)
+	b.servers[newServerName] = net.JoinHostPort(serviceAddress, fmt.Sprint(servicePort))
+	return nil
+}
+
+// UnbindStem removes a stem's router and service.
+func (c *TraefikClient) UnbindStem(backendName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.backends, backendName)
+	return nil
+}
+
+// DynamicConfig is the subset of Traefik's dynamic configuration herbarium generates.
+type DynamicConfig struct {
+	HTTP HTTPConfig `json:"http"`
+	UDP  *UDPConfig `json:"udp,omitempty"`
+}
+
+// HTTPConfig holds the generated HTTP routers, services, and middlewares, keyed by name.
+type HTTPConfig struct {
+	Routers     map[string]Router     `json:"routers"`
+	Services    map[string]Service    `json:"services"`
+	Middlewares map[string]Middleware `json:"middlewares,omitempty"`
+}
+
+// Router routes requests under the backend's path, and for its host if it has one, to the backend's service.
+type Router struct {
+	Rule        string   `json:"rule"`
+	Service     string   `json:"service"`
+	EntryPoints []string `json:"entryPoints,omitempty"`
+	Middlewares []string `json:"middlewares,omitempty"`
+}
+
+// Middleware changes requests before a router passes them to its service, or their responses.
+type Middleware struct {
+	ReplacePathRegex *ReplacePathRegex `json:"replacePathRegex,omitempty"`
+	Compress         *Compress         `json:"compress,omitempty"`
+	Headers          *Headers          `json:"headers,omitempty"`
+	RateLimit        *RateLimit        `json:"rateLimit,omitempty"`
+}
+
+// RateLimit allows each client address Average requests per Period, answering further ones with 429.
+type RateLimit struct {
+	Average int    `json:"average"`
+	Period  string `json:"period"`
+	Burst   int    `json:"burst"`
+}
+
+// Headers answers CORS preflight requests and adds CORS and security headers to responses.
+type Headers struct {
+	AccessControlAllowOriginList  []string `json:"accessControlAllowOriginList,omitempty"`
+	AccessControlAllowMethods     []string `json:"accessControlAllowMethods,omitempty"`
+	AccessControlAllowHeaders     []string `json:"accessControlAllowHeaders,omitempty"`
+	AccessControlAllowCredentials bool     `json:"accessControlAllowCredentials,omitempty"`
+	AccessControlMaxAge           int64    `json:"accessControlMaxAge,omitempty"`
+	AddVaryHeader                 bool     `json:"addVaryHeader,omitempty"`
+	STSSeconds                    int64    `json:"stsSeconds,omitempty"`
+	STSIncludeSubdomains          bool     `json:"stsIncludeSubdomains,omitempty"`
+	FrameDeny                     bool     `json:"frameDeny,omitempty"`
+	ContentTypeNosniff            bool     `json:"contentTypeNosniff,omitempty"`
+	ReferrerPolicy                string   `json:"referrerPolicy,omitempty"`
+}
+
+// Compress compresses responses for clients accepting it.
+type Compress struct{}
+
+// ReplacePathRegex rewrites request paths matching Regex to Replacement.
+type ReplacePathRegex struct {
+	Regex       string `json:"regex"`
+	Replacement string `json:"replacement"`
+}
+
+// Service balances requests across a backend's servers, or passes them to another service while mirroring
+// them to more.
+type Service struct {
+	LoadBalancer *LoadBalancer `json:"loadBalancer,omitempty"`
+	Mirroring    *Mirroring    `json:"mirroring,omitempty"`
+}
+
+// Mirroring passes requests to Service and copies a share of them to each of Mirrors, discarding their responses.
+type Mirroring struct {
+	Service string          `json:"service"`
+	Mirrors []MirrorService `json:"mirrors"`
+}
+
+// MirrorService is a service receiving Percent of a mirroring service's requests.
+type MirrorService struct {
+	Name    string `json:"name"`
+	Percent int    `json:"percent"`
+}
+
+// LoadBalancer lists the servers of a service.
+type LoadBalancer struct {
+	Servers     []LoadBalancerServer `json:"servers"`
+	HealthCheck *HealthCheck         `json:"healthCheck,omitempty"`
+}
+
+// HealthCheck configures Traefik's active health check of a service's servers.
+type HealthCheck struct {
+	Mode string `json:"mode,omitempty"` // "grpc" for the gRPC health checking protocol
+	Path string `json:"path"`
+}
+
+// LoadBalancerServer is a leaf's server.
+type LoadBalancerServer struct {
+	URL string `json:"url"`
+}
+
+// UDPConfig holds the generated UDP routers and services, keyed by name.
+type UDPConfig struct {
+	Routers  map[string]UDPRouter  `json:"routers"`
+	Services map[string]UDPService `json:"services"`
+}
+
+// UDPRouter forwards datagrams arriving on an entry point to a backend's service.
+type UDPRouter struct {
+	EntryPoints []string `json:"entryPoints"`
+	Service     string   `json:"service"`
+}
+
+// UDPService balances datagrams across a backend's servers.
+type UDPService struct {
+	LoadBalancer UDPLoadBalancer `json:"loadBalancer"`
+}
+
+// UDPLoadBalancer lists the servers of a UDP service.
+type UDPLoadBalancer struct {
+	Servers []UDPServer `json:"servers"`
+}
+
+// UDPServer is a leaf's server.
+type UDPServer struct {
+	Address string `json:"address"`
+}
+
+// UDPEntryPoint returns the entry point UDP routers of backends published on port listen on. It must be
+// defined in Traefik's static configuration.
+func UDPEntryPoint(port int) string {
+	return fmt.Sprintf("udp-%d", port)
+}
+
+// DynamicConfig renders the current backends as Traefik dynamic configuration.
+func (c *TraefikClient) DynamicConfig() DynamicConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	config := DynamicConfig{HTTP: HTTPConfig{
+		Routers:  make(map[string]Router, len(c.backends)),
+		Services: make(map[string]Service, len(c.backends)),
+	}}
+	for backendName, b := range c.backends {
+		name := ServiceName(backendName)
+
+		names := make([]string, 0, len(b.servers))
+		for server := range b.servers {
+			names = append(names, server)
+		}
+		sort.Strings(names)
+
+		if b.options.IsUDP() {
+			if config.UDP == nil {
+				config.UDP = &UDPConfig{Routers: make(map[string]UDPRouter), Services: make(map[string]UDPService)}
+			}
+			lb := UDPLoadBalancer{Servers: make([]UDPServer, 0, len(names))}
+			for _, server := range names {
+				lb.Servers = append(lb.Servers, UDPServer{Address: b.servers[server]})
+			}
+			config.UDP.Services[name] = UDPService{LoadBalancer: lb}
+			config.UDP.Routers[name] = UDPRouter{EntryPoints: []string{UDPEntryPoint(b.options.ListenPort)}, Service: name}
+			continue
+		}
+
+		lb := LoadBalancer{Servers: make([]LoadBalancerServer, 0, len(names))}
+		for _, server := range names {
+			lb.Servers = append(lb.Servers, LoadBalancerServer{URL: serverScheme(b.options) + "://" + b.servers[server]})
+		}
+		if b.options.HealthCheck == proxy.HealthCheckGRPC {
+			lb.HealthCheck = &HealthCheck{Mode: "grpc", Path: proxy.GRPCHealthCheckPath}
+		}
+
+		config.HTTP.Services[name] = Service{LoadBalancer: &lb}
+		if b.options.Shadow {
+			continue // Only gets the requests other services mirror to it
+		}
+		rule := fmt.Sprintf("PathPrefix(`%s`)", b.options.RoutePath(backendName))
+		if b.options.Host != "" {
+			rule = fmt.Sprintf("Host(`%s`) && %s", b.options.Host, rule)
+		}
+		router := Router{
+			Rule:        rule,
+			Service:     name,
+			EntryPoints: c.config.EntryPoints,
+		}
+		if mirror := b.options.Mirror; mirror != nil {
+			config.HTTP.Services[name+"-mirroring"] = Service{Mirroring: &Mirroring{
+				Service: name,
+				Mirrors: []MirrorService{{Name: ServiceName(mirror.Backend), Percent: mirror.Percent}},
+			}}
+			router.Service = name + "-mirroring"
+		}
+		middlewares := make(map[string]Middleware)
+		if b.options.Rewrite != "" {
+			pattern, prefix := b.options.RewritePattern(backendName)
+			middlewares[name] = Middleware{ReplacePathRegex: &ReplacePathRegex{Regex: pattern, Replacement: prefix + "${1}"}}
+			router.Middlewares = append(router.Middlewares, name)
+		}
+		if b.options.Compression {
+			middlewares[name+"-compress"] = Middleware{Compress: &Compress{}}
+			router.Middlewares = append(router.Middlewares, name+"-compress")
+		}
+		if limit := b.options.RateLimit; limit != nil {
+			middlewares[name+"-ratelimit"] = Middleware{RateLimit: &RateLimit{Average: limit.Requests, Period: limit.Period.String(), Burst: limit.Requests}}
+			router.Middlewares = append(router.Middlewares, name+"-ratelimit")
+		}
+		if headers := headersMiddleware(b.options); headers != nil {
+			middlewares[name+"-headers"] = Middleware{Headers: headers}
+			router.Middlewares = append(router.Middlewares, name+"-headers")
+		}
+		for middlewareName, middleware := range middlewares {
+			if config.HTTP.Middlewares == nil {
+				config.HTTP.Middlewares = make(map[string]Middleware)
+			}
+			config.HTTP.Middlewares[middlewareName] = middleware
+		}
+		config.HTTP.Routers[name] = router
+	}
+	return config
+}
+
+// serverScheme returns the server URL scheme Traefik uses to select the protocol spoken to a backend's servers.
+func serverScheme(options proxy.BackendOptions) string {
+	switch options.Protocol {
+	case proxy.ProtocolH2C:
+		return "h2c"
+	case proxy.ProtocolH2:
+		return "https"
+	default:
+		return "http"
+	}
+}
+
+// ServiceName returns the router and service name generated for a backend.
+func ServiceName(backendName string) string {
+	return invalidNameChars.ReplaceAllString(backendName, "_")
+}
+
+// headersMiddleware returns the headers middleware of a backend's CORS policy and security headers, nil when it
+// has neither.
+func headersMiddleware(options proxy.BackendOptions) *Headers {
+	if options.CORS == nil && !options.SecurityHeaders {
+		return nil
+	}
+	headers := &Headers{}
+	if cors := options.CORS; cors != nil {
+		headers.AccessControlAllowOriginList = cors.AllowOrigins
+		headers.AccessControlAllowMethods = cors.AllowMethods
+		if len(headers.AccessControlAllowMethods) == 0 {
+			headers.AccessControlAllowMethods = proxy.DefaultCORSMethods
+		}
+		headers.AccessControlAllowHeaders = cors.AllowHeaders
+		headers.AccessControlAllowCredentials = cors.AllowCredentials
+		headers.AccessControlMaxAge = int64(cors.MaxAge / time.Second)
+		headers.AddVaryHeader = true
+	}
+	if options.SecurityHeaders {
+		// The values of proxy.SecurityHeaders
+		headers.STSSeconds = 31536000
+		headers.STSIncludeSubdomains = true
+		headers.FrameDeny = true
+		headers.ContentTypeNosniff = true
+		headers.ReferrerPolicy = "strict-origin-when-cross-origin"
+	}
+	return headers
+}
@@ -0,0 +1,154 @@
+package traefik
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/internal/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraefikClient_ServesDynamicConfig(t *testing.T) {
+	client := NewTraefikClient(TraefikConfig{APIKey: "traefik-key", EntryPoints: []string{"web"}})
+	server := httptest.NewServer(client.Handler())
+	defer server.Close()
+
+	assert.NoError(t, client.BindStem("hello-service", proxy.BackendOptions{}))
+	assert.NoError(t, client.BindLeaf("hello-service", "leaf-1", "10.0.0.5", 8001))
+	assert.NoError(t, client.BindLeaf("hello-service", "leaf-2", "localhost", 8002))
+	assert.NoError(t, client.ReplaceLeaf("hello-service", "leaf-1", "leaf-3", "10.0.0.6", 8003))
+	assert.NoError(t, client.BindStem("old-service", proxy.BackendOptions{}))
+	assert.NoError(t, client.UnbindStem("old-service"))
+	assert.ErrorContains(t, client.UnbindLeaf("hello-service", "leaf-1"), "server leaf-1 not found")
+
+	resp, err := http.Get(server.URL + ConfigPath)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+ConfigPath, nil)
+	request.Header.Set(APIKeyHeader, "traefik-key")
+	resp, err = http.DefaultClient.Do(request)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	var config DynamicConfig
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&config))
+	assert.Equal(t, DynamicConfig{HTTP: HTTPConfig{
+		Routers: map[string]Router{
+			"hello-service": {Rule: "PathPrefix(`/hello-service`)", Service: "hello-service", EntryPoints: []string{"web"}},
+		},
+		Services: map[string]Service{
+			"hello-service": {LoadBalancer: &LoadBalancer{Servers: []LoadBalancerServer{
+				{URL: "http://localhost:8002"},
+				{URL: "http://10.0.0.6:8003"},
+			}}},
+		},
+	}}, config)
+}
+
+func TestTraefikClient_GRPCBackend(t *testing.T) {
+	client := NewTraefikClient(TraefikConfig{})
+	assert.NoError(t, client.BindStem("greeter", proxy.BackendOptions{Protocol: proxy.ProtocolH2C, HealthCheck: proxy.HealthCheckGRPC}))
+	assert.NoError(t, client.BindLeaf("greeter", "leaf-1", "localhost", 9000))
+
+	service := client.DynamicConfig().HTTP.Services["greeter"]
+	assert.Equal(t, []LoadBalancerServer{{URL: "h2c://localhost:9000"}}, service.LoadBalancer.Servers)
+	assert.Equal(t, &HealthCheck{Mode: "grpc", Path: proxy.GRPCHealthCheckPath}, service.LoadBalancer.HealthCheck)
+}
+
+func TestTraefikClient_RoutesByHost(t *testing.T) {
+	client := NewTraefikClient(TraefikConfig{})
+	assert.NoError(t, client.BindStem("api_hello", proxy.BackendOptions{Path: "/hello", Host: "api.example.com"}))
+
+	router := client.DynamicConfig().HTTP.Routers[ServiceName("api_hello")]
+	assert.Equal(t, "Host(`api.example.com`) && PathPrefix(`/hello`)", router.Rule)
+}
+
+func TestTraefikClient_RewritesPaths(t *testing.T) {
+	client := NewTraefikClient(TraefikConfig{})
+	assert.NoError(t, client.BindStem("hello", proxy.BackendOptions{Rewrite: "/"}))
+	assert.NoError(t, client.BindStem("plain", proxy.BackendOptions{}))
+
+	config := client.DynamicConfig()
+	name := ServiceName("hello")
+	assert.Equal(t, []string{name}, config.HTTP.Routers[name].Middlewares)
+	assert.Equal(t, &ReplacePathRegex{Regex: "^/hello/?(.*)$", Replacement: "/${1}"}, config.HTTP.Middlewares[name].ReplacePathRegex)
+	assert.Empty(t, config.HTTP.Routers[ServiceName("plain")].Middlewares)
+	assert.Len(t, config.HTTP.Middlewares, 1)
+}
+
+func TestTraefikClient_Compression(t *testing.T) {
+	client := NewTraefikClient(TraefikConfig{})
+	assert.NoError(t, client.BindStem("hello", proxy.BackendOptions{Rewrite: "/", Compression: true}))
+
+	config := client.DynamicConfig()
+	name := ServiceName("hello")
+	assert.Equal(t, []string{name, name + "-compress"}, config.HTTP.Routers[name].Middlewares)
+	assert.Equal(t, &Compress{}, config.HTTP.Middlewares[name+"-compress"].Compress)
+}
+
+func TestTraefikClient_Headers(t *testing.T) {
+	client := NewTraefikClient(TraefikConfig{})
+	cors := &proxy.CORSPolicy{AllowOrigins: []string{"https://app.example.com"}, AllowCredentials: true, MaxAge: time.Minute}
+	assert.NoError(t, client.BindStem("hello", proxy.BackendOptions{CORS: cors, SecurityHeaders: true}))
+	assert.NoError(t, client.BindStem("plain", proxy.BackendOptions{}))
+
+	config := client.DynamicConfig()
+	name := ServiceName("hello")
+	assert.Equal(t, []string{name + "-headers"}, config.HTTP.Routers[name].Middlewares)
+	assert.Equal(t, &Headers{
+		AccessControlAllowOriginList:  []string{"https://app.example.com"},
+		AccessControlAllowMethods:     proxy.DefaultCORSMethods,
+		AccessControlAllowCredentials: true,
+		AccessControlMaxAge:           60,
+		AddVaryHeader:                 true,
+		STSSeconds:                    31536000,
+		STSIncludeSubdomains:          true,
+		FrameDeny:                     true,
+		ContentTypeNosniff:            true,
+		ReferrerPolicy:                "strict-origin-when-cross-origin",
+	}, config.HTTP.Middlewares[name+"-headers"].Headers)
+	assert.Empty(t, config.HTTP.Routers[ServiceName("plain")].Middlewares)
+}
+
+func TestTraefikClient_RateLimit(t *testing.T) {
+	client := NewTraefikClient(TraefikConfig{})
+	assert.NoError(t, client.BindStem("hello", proxy.BackendOptions{RateLimit: &proxy.RateLimit{Requests: 100, Period: time.Minute}}))
+
+	config := client.DynamicConfig()
+	name := ServiceName("hello")
+	assert.Equal(t, []string{name + "-ratelimit"}, config.HTTP.Routers[name].Middlewares)
+	assert.Equal(t, &RateLimit{Average: 100, Period: "1m0s", Burst: 100}, config.HTTP.Middlewares[name+"-ratelimit"].RateLimit)
+}
+
+func TestTraefikClient_Mirror(t *testing.T) {
+	client := NewTraefikClient(TraefikConfig{})
+	assert.NoError(t, client.BindStem("hello", proxy.BackendOptions{Mirror: &proxy.Mirror{Backend: "shadow_hello-v2", Percent: 10}}))
+	assert.NoError(t, client.BindStem("shadow_hello-v2", proxy.BackendOptions{Path: "/hello", Shadow: true}))
+
+	config := client.DynamicConfig()
+	name, shadow := ServiceName("hello"), ServiceName("shadow_hello-v2")
+	assert.Equal(t, name+"-mirroring", config.HTTP.Routers[name].Service)
+	assert.Equal(t, &Mirroring{Service: name, Mirrors: []MirrorService{{Name: shadow, Percent: 10}}}, config.HTTP.Services[name+"-mirroring"].Mirroring)
+	assert.NotNil(t, config.HTTP.Services[shadow].LoadBalancer)
+	assert.NotContains(t, config.HTTP.Routers, shadow)
+}
+
+func TestTraefikClient_UDPBackend(t *testing.T) {
+	client := NewTraefikClient(TraefikConfig{})
+	assert.NoError(t, client.BindStem("dns", proxy.BackendOptions{Transport: proxy.TransportUDP, ListenPort: 53}))
+	assert.NoError(t, client.BindLeaf("dns", "leaf-1", "localhost", 8000))
+
+	config := client.DynamicConfig()
+	assert.Empty(t, config.HTTP.Routers)
+	assert.Equal(t, &UDPConfig{
+		Routers:  map[string]UDPRouter{"dns": {EntryPoints: []string{"udp-53"}, Service: "dns"}},
+		Services: map[string]UDPService{"dns": {LoadBalancer: UDPLoadBalancer{Servers: []UDPServer{{Address: "localhost:8000"}}}}},
+	}, config.UDP)
+}
@@ -0,0 +1,140 @@
+// Package client is the Go client of the herbarium admin API, for the CLI and other Plantarium components
+// that manage stems and leafs of a running herbarium.
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// APIKeyHeader is the request header carrying the API key.
+	APIKeyHeader = "X-API-Key"
+
+	// ActorHeader is the request header naming who acts through the API key, recorded with deployments.
+	ActorHeader = "X-Herbarium-Actor"
+
+	// APIVersion is the admin API version the client speaks, whose contract only changes additively.
+	APIVersion = "v1"
+
+	// DefaultRetries is how often idempotent requests are retried when herbarium can't be reached or is
+	// briefly unavailable.
+	DefaultRetries = 3
+
+	// maxPageLimit is the largest page the admin API returns.
+	maxPageLimit = 500
+
+	retryWait    = 200 * time.Millisecond
+	retryMaxWait = 2 * time.Second
+)
+
+// Client talks to the admin API of one herbarium. It is safe for concurrent use.
+type Client struct {
+	client *resty.Client
+}
+
+// APIError is returned when the admin API answers a request with an unexpected status, e.g. 404 for an
+// unknown stem or 409 for a stem that already exists.
+type APIError struct {
+	Operation  string // What failed, e.g. "scale stem"
+	StatusCode int    // HTTP status of the response
+	Message    string // Error reported by the admin API, or the raw response
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("failed to %s, status code: %d, response: %s", e.Operation, e.StatusCode, e.Message)
+}
+
+// NewClient creates a client for the admin API at baseURL (e.g. http://localhost:50051 or
+// http://<haproxy-host>/herbarium), using its APIVersion routes and authenticating with apiKey when it is
+// non-empty. Idempotent requests are retried DefaultRetries times on connection errors and 502, 503, and 504
+// responses.
+func NewClient(baseURL, apiKey string) *Client {
+	client := resty.New()
+	client.SetBaseURL(strings.TrimSuffix(baseURL, "/") + "/" + APIVersion)
+	if apiKey != "" {
+		client.SetHeader(APIKeyHeader, apiKey)
+	}
+	client.SetDisableWarn(true)
+	client.SetRetryCount(DefaultRetries)
+	client.SetRetryWaitTime(retryWait)
+	client.SetRetryMaxWaitTime(retryMaxWait)
+	client.AddRetryCondition(shouldRetry)
+
+	return &Client{client: client}
+}
+
+// SetActor names who sends the client's requests, e.g. the user running the CLI, so the changes they make
+// are attributed to them rather than to the API key.
+func (c *Client) SetActor(actor string) *Client {
+	c.client.SetHeader(ActorHeader, actor)
+	return c
+}
+
+// SetRetries sets how often idempotent requests are retried, 0 to never retry.
+func (c *Client) SetRetries(retries int) *Client {
+	c.client.SetRetryCount(retries)
+	return c
+}
+
+// SetTimeout limits how long a request may take. Requests don't time out by default, as following logs
+// lasts until the leaf is gone.
+func (c *Client) SetTimeout(timeout time.Duration) *Client {
+	c.client.SetTimeout(timeout)
+	return c
+}
+
+// shouldRetry retries GET, PUT, and DELETE requests that failed to connect or hit a proxy or herbarium that
+// is briefly unavailable. POST requests are never retried, as they may have taken effect.
+func shouldRetry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+	switch resp.Request.Method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode() {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// newAPIError builds the APIError for a response with an unexpected status, unwrapping the JSON error body
+// of the admin API.
+func newAPIError(operation string, statusCode int, body []byte) *APIError {
+	message := string(body)
+	var response struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &response) == nil && response.Error != "" {
+		message = response.Error
+	}
+	return &APIError{Operation: operation, StatusCode: statusCode, Message: message}
+}
+
+// do sends request to path and decodes the JSON response into result when it has the expected status.
+// operation describes the request in errors.
+func (c *Client) do(request *resty.Request, method, path, operation string, expected int, result interface{}) error {
+	if result != nil {
+		request.SetResult(result)
+	}
+	resp, err := request.Execute(method, path)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %v", operation, err)
+	}
+	if resp.StatusCode() != expected {
+		return newAPIError(operation, resp.StatusCode(), resp.Body())
+	}
+	return nil
+}
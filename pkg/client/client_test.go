@@ -0,0 +1,128 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/plantarium-platform/herbarium-go/internal/api/admin"
+	"github.com/plantarium-platform/herbarium-go/internal/manager"
+	"github.com/plantarium-platform/herbarium-go/internal/storage"
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Retries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get(APIKeyHeader))
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"snap-1"}]`))
+	}))
+	defer server.Close()
+
+	// Idempotent requests ride out a briefly unavailable server
+	snapshots, err := NewClient(server.URL, "secret").ListSnapshots()
+	assert.NoError(t, err)
+	assert.Equal(t, []Snapshot{{Name: "snap-1"}}, snapshots)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// POST requests may have taken effect, so they are not retried
+	calls.Store(0)
+	_, err = NewClient(server.URL, "secret").CreateSnapshot()
+	var apiErr *APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(0)
+	_, err = NewClient(server.URL, "secret").SetRetries(0).ListSnapshots()
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestClient_StemOperations(t *testing.T) {
+	mockStemManager := new(manager.MockStemManager)
+	server := admin.NewServer("", "secret", mockStemManager, new(manager.MockLeafManager), new(manager.MockSnapshotManager), nil)
+	server.Events = manager.NewEventLog(10)
+	deployments, err := manager.OpenDeploymentHistory(filepath.Join(t.TempDir(), "deployments.jsonl"))
+	assert.NoError(t, err)
+	defer deployments.Close()
+	server.Deployments = deployments
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+	api := NewClient(httpServer.URL+manager.AdminAPIPath, "secret").SetActor("alice@laptop")
+
+	key := storage.StemKey{Name: "billing", Version: "v2"}
+	config := models.StemConfig{Name: "billing", Version: "v2", URL: "/billing", Command: "./billing"}
+	mockStemManager.On("ImportStem", manager.StemDefinition{FormatVersion: manager.StemDefinitionFormatVersion, Config: config, Instances: 2},
+		manager.RegisterOptions{DeployedBy: "alice@laptop"}).Return(nil)
+	mockStemManager.On("FetchStemInfo", key).Return(&models.Stem{Name: "billing", Version: "v2", WorkingURL: "/billing"}, nil)
+	mockStemManager.On("UpdateStemConfig", key, config, manager.UpdateOptions{RollLeafs: true}).Return(nil)
+	mockStemManager.On("SetTrafficSplit", key, map[string]int{"v1": 80, "v2": 20}).Return(nil)
+	mockStemManager.On("FetchStemInfo", storage.StemKey{Name: "missing", Version: "v1"}).Return(nil, errors.New("stem not found"))
+	mockStemManager.On("StemVersions", "billing").Return([]*models.StemVersion{
+		{Name: "billing", Version: "v1", Status: models.VersionRolledBack, Registrations: 1},
+		{Name: "billing", Version: "v2", Status: models.VersionActive, Registrations: 2}}, nil)
+	mockStemManager.On("Rollback", "billing", manager.RegisterOptions{DeployedBy: "alice@laptop"}).Return(key, nil)
+	mockStemManager.On("FetchStemInfo", storage.StemKey{Name: "billing", Version: "v1"}).Return(&models.Stem{Name: "billing", Version: "v1"}, nil)
+	mockStemManager.On("UnregisterStem", storage.StemKey{Name: "billing", Version: "v1"}).Return(nil)
+
+	assert.NoError(t, api.RegisterStem(config, 2))
+	stem, err := api.UpdateStemConfig("billing", "v2", config, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "/billing", stem.URL)
+	_, err = api.SetTrafficSplit("billing", "v2", map[string]int{"v1": 80, "v2": 20})
+	assert.NoError(t, err)
+	history, err := api.ListStemVersions("billing")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, models.VersionRolledBack, history[0].Status)
+		assert.Equal(t, 2, history[1].Registrations)
+	}
+	stem, err = api.RollbackStem("billing")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", stem.Version)
+	entry, err := api.UnregisterStem("billing", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeploymentUnregister, entry.Action)
+
+	// Each change is attributed to the actor in the deployment history
+	entries, err := api.Deployments(DeploymentQuery{Stem: "billing", Actor: "alice@laptop", Outcome: models.DeploymentSucceeded})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, models.DeploymentDeploy, entries[0].Action)
+		assert.Equal(t, models.DeploymentRollback, entries[1].Action)
+		assert.Equal(t, "v2", entries[1].Version)
+		assert.Equal(t, entry.Seq, entries[2].Seq)
+	}
+	entries, err = api.Deployments(DeploymentQuery{Action: models.DeploymentScale})
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Failures carry the status and the error reported by the admin API
+	err = api.ScaleStem("missing", "v1", 3)
+	var apiErr *APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.Equal(t, "stem not found", apiErr.Message)
+	}
+	assert.EqualError(t, err, "failed to scale stem, status code: 404, response: stem not found")
+	mockStemManager.AssertExpectations(t)
+
+	server.Events.Record(models.Event{Type: models.EventStemScaled, Stem: "billing", Message: "scaled"})
+	server.Events.Record(models.Event{Type: models.EventStemUpdated, Stem: "billing", Message: "updated"})
+	events, err := api.Events(EventQuery{Stem: "billing", Type: models.EventStemUpdated})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "updated", events[0].Message)
+	}
+}
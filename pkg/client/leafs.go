@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// LogOptions selects the output ReadLeafLogs returns.
+type LogOptions struct {
+	Tail   int    // Only the last Tail lines, 0 for the whole history
+	Since  string // Only lines written since an RFC 3339 time or a duration ago, empty for all
+	Follow bool   // Keep streaming new output until the leaf is gone
+}
+
+// leafResponse names the leaf a promote or roll handed requests to.
+type leafResponse struct {
+	LeafID string `json:"leafId"`
+}
+
+// ReadLeafLogs opens the log of a leaf. The caller must close the returned reader, which ends when the
+// requested output was sent or, when following, once the leaf is gone.
+func (c *Client) ReadLeafLogs(name, version, leafID string, opts LogOptions) (io.ReadCloser, error) {
+	request := c.client.R().SetDoNotParseResponse(true)
+	if opts.Tail > 0 {
+		request.SetQueryParam("tail", strconv.Itoa(opts.Tail))
+	}
+	if opts.Since != "" {
+		request.SetQueryParam("since", opts.Since)
+	}
+	if opts.Follow {
+		request.SetQueryParam("follow", "true")
+	}
+	resp, err := request.Get(stemPath(name, version, "/leafs/"+url.PathEscape(leafID)+"/logs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logs of leaf %s: %v", leafID, err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		defer resp.RawBody().Close()
+		body, _ := io.ReadAll(resp.RawBody())
+		return nil, newAPIError("read logs of leaf "+leafID, resp.StatusCode(), body)
+	}
+	return resp.RawBody(), nil
+}
+
+// PromoteLeaf binds a standby leaf of the stem's warm pool to the proxy and returns its ID. It fails with
+// a 409 APIError when no standby leaf is ready.
+func (c *Client) PromoteLeaf(name, version string) (string, error) {
+	var promoted leafResponse
+	if err := c.do(c.client.R(), http.MethodPost, stemPath(name, version, "/leafs/promote"), "promote leaf", http.StatusOK, &promoted); err != nil {
+		return "", err
+	}
+	return promoted.LeafID, nil
+}
+
+// RollLeaf replaces a running leaf with a fresh one and returns the ID of the leaf that took over.
+func (c *Client) RollLeaf(name, version, leafID string) (string, error) {
+	var rolled leafResponse
+	path := stemPath(name, version, "/leafs/"+url.PathEscape(leafID)+"/roll")
+	if err := c.do(c.client.R(), http.MethodPost, path, "roll leaf "+leafID, http.StatusOK, &rolled); err != nil {
+		return "", err
+	}
+	return rolled.LeafID, nil
+}
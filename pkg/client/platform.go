@@ -0,0 +1,237 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// LeafStats is a sample of a leaf's resource use and requests as reported by the admin API. CPUSeconds and
+// Requests are cumulative; Requests is -1 when the proxy can't count them.
+type LeafStats struct {
+	Stem        string            `json:"stem"`
+	Version     string            `json:"version"`
+	LeafID      string            `json:"leafId"`
+	PID         int               `json:"pid"`
+	Port        int               `json:"port"`
+	Status      models.LeafStatus `json:"status"`
+	MemoryBytes int64             `json:"memoryBytes"`
+	CPUSeconds  float64           `json:"cpuSeconds"`
+	Requests    int64             `json:"requests"`
+	Sampled     time.Time         `json:"sampled"`
+}
+
+// StorageStats is the size and lock contention of the state storage as reported by the admin API.
+// LockWaits and LockWaitSeconds are cumulative since startup.
+type StorageStats struct {
+	Stems           int     `json:"stems"`
+	Leafs           int     `json:"leafs"`
+	GraftNodes      int     `json:"graftNodes"`
+	Nodes           int     `json:"nodes"`
+	JournalEntries  uint64  `json:"journalEntries"`
+	JournalBytes    int64   `json:"journalBytes"`
+	LockWaits       uint64  `json:"lockWaits"`
+	LockWaitSeconds float64 `json:"lockWaitSeconds"`
+}
+
+// EventQuery selects the events Events returns. Zero fields don't filter.
+type EventQuery struct {
+	Stem  string           // Only events of this stem
+	Type  models.EventType // Only events of this type
+	After uint64           // Only events with a greater sequence number, to poll for new ones
+	Limit int              // At most this many events, 0 for the server default
+}
+
+// DeploymentQuery selects the entries Deployments returns. Zero fields don't filter.
+type DeploymentQuery struct {
+	Stem    string                   // Only changes of this stem
+	Actor   string                   // Only changes initiated by this actor
+	Action  models.DeploymentAction  // Only changes of this kind
+	Outcome models.DeploymentOutcome // Only changes with this outcome
+	Since   time.Time                // Only changes initiated at or after this time
+	After   uint64                   // Only entries with a greater sequence number
+	Limit   int                      // At most this many entries, 0 for the server default
+}
+
+// Snapshot describes a stored state snapshot.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+}
+
+// Stats samples the resource use and requests of every leaf.
+func (c *Client) Stats() ([]LeafStats, error) {
+	var stats []LeafStats
+	if err := c.do(c.client.R(), http.MethodGet, "/stats", "get stats", http.StatusOK, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Storage reports the size and lock contention of the state storage.
+func (c *Client) Storage() (*StorageStats, error) {
+	var stats StorageStats
+	if err := c.do(c.client.R(), http.MethodGet, "/storage", "get storage stats", http.StatusOK, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Events fetches recent platform events, oldest first.
+func (c *Client) Events(query EventQuery) ([]models.Event, error) {
+	request := c.client.R()
+	if query.Stem != "" {
+		request.SetQueryParam("stem", query.Stem)
+	}
+	if query.Type != "" {
+		request.SetQueryParam("type", string(query.Type))
+	}
+	if query.After > 0 {
+		request.SetQueryParam("after", strconv.FormatUint(query.After, 10))
+	}
+	if query.Limit > 0 {
+		request.SetQueryParam("limit", strconv.Itoa(query.Limit))
+	}
+	var events []models.Event
+	if err := c.do(request, http.MethodGet, "/events", "list events", http.StatusOK, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Deployments fetches the deployment history, oldest first: who deployed, scaled, unregistered, and rolled
+// back stems, with the parameters and outcome of each change.
+func (c *Client) Deployments(query DeploymentQuery) ([]models.Deployment, error) {
+	request := c.client.R()
+	if query.Stem != "" {
+		request.SetQueryParam("stem", query.Stem)
+	}
+	if query.Actor != "" {
+		request.SetQueryParam("actor", query.Actor)
+	}
+	if query.Action != "" {
+		request.SetQueryParam("action", string(query.Action))
+	}
+	if query.Outcome != "" {
+		request.SetQueryParam("outcome", string(query.Outcome))
+	}
+	if !query.Since.IsZero() {
+		request.SetQueryParam("since", query.Since.Format(time.RFC3339))
+	}
+	if query.After > 0 {
+		request.SetQueryParam("after", strconv.FormatUint(query.After, 10))
+	}
+	if query.Limit > 0 {
+		request.SetQueryParam("limit", strconv.Itoa(query.Limit))
+	}
+	var entries []models.Deployment
+	if err := c.do(request, http.MethodGet, "/deployments", "list deployments", http.StatusOK, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Alerts fetches the alerts currently firing.
+func (c *Client) Alerts() ([]models.Alert, error) {
+	var alerts []models.Alert
+	if err := c.do(c.client.R(), http.MethodGet, "/alerts", "list alerts", http.StatusOK, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// ListSnapshots fetches the stored state snapshots, newest first.
+func (c *Client) ListSnapshots() ([]Snapshot, error) {
+	var snapshots []Snapshot
+	if err := c.do(c.client.R(), http.MethodGet, "/snapshots", "list snapshots", http.StatusOK, &snapshots); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// CreateSnapshot writes a snapshot of the current state and returns its name.
+func (c *Client) CreateSnapshot() (string, error) {
+	var created Snapshot
+	if err := c.do(c.client.R(), http.MethodPost, "/snapshots", "create snapshot", http.StatusCreated, &created); err != nil {
+		return "", err
+	}
+	return created.Name, nil
+}
+
+// Maintenance reports whether the platform is in maintenance mode.
+func (c *Client) Maintenance() (*models.MaintenanceStatus, error) {
+	var status models.MaintenanceStatus
+	if err := c.do(c.client.R(), http.MethodGet, "/maintenance", "get maintenance status", http.StatusOK, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// EnterMaintenance answers every request with page, or the configured maintenance page when page is empty.
+func (c *Client) EnterMaintenance(page string) (*models.MaintenanceStatus, error) {
+	var status models.MaintenanceStatus
+	request := c.client.R().SetBody(map[string]string{"page": page})
+	if err := c.do(request, http.MethodPost, "/maintenance", "enter maintenance", http.StatusOK, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ExitMaintenance routes requests to the leafs again.
+func (c *Client) ExitMaintenance() (*models.MaintenanceStatus, error) {
+	var status models.MaintenanceStatus
+	if err := c.do(c.client.R(), http.MethodDelete, "/maintenance", "exit maintenance", http.StatusOK, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Drain reports the progress of draining the host.
+func (c *Client) Drain() (*models.DrainStatus, error) {
+	var status models.DrainStatus
+	if err := c.do(c.client.R(), http.MethodGet, "/drain", "get drain status", http.StatusOK, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// StartDrain refuses deployments and new leafs on the host and stops its leafs in the background, starting
+// their replacements on other nodes first when handoff is set. Poll Drain until SafeToReboot is set.
+func (c *Client) StartDrain(handoff bool) (*models.DrainStatus, error) {
+	var status models.DrainStatus
+	request := c.client.R().SetBody(map[string]bool{"handoff": handoff})
+	if err := c.do(request, http.MethodPost, "/drain", "start drain", http.StatusAccepted, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// CancelDrain accepts deployments and starts leafs on the host again.
+func (c *Client) CancelDrain() (*models.DrainStatus, error) {
+	var status models.DrainStatus
+	if err := c.do(c.client.R(), http.MethodDelete, "/drain", "cancel drain", http.StatusOK, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ReconcileDrift repairs where the proxy's configuration drifted from the state right away.
+func (c *Client) ReconcileDrift() (*models.DriftReport, error) {
+	var report models.DriftReport
+	if err := c.do(c.client.R(), http.MethodPost, "/drift", "reconcile drift", http.StatusOK, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Sweep reclaims orphaned leafs, proxy servers, and ports right away.
+func (c *Client) Sweep() (*models.SweepReport, error) {
+	var report models.SweepReport
+	if err := c.do(c.client.R(), http.MethodPost, "/sweep", "sweep", http.StatusOK, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,298 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+// definitionFormatVersion is the stem definition format RegisterStem writes and the admin API imports.
+const definitionFormatVersion = 1
+
+// StemSummary describes a registered stem as listed by the admin API.
+type StemSummary struct {
+	Name         string                `json:"name"`
+	Type         models.StemType       `json:"type"`
+	Version      string                `json:"version"`
+	URL          string                `json:"url"`
+	Backend      string                `json:"backend,omitempty"`
+	Labels       map[string]string     `json:"labels,omitempty"`
+	LeafCount    int                   `json:"leafCount"`
+	HasGraftNode bool                  `json:"hasGraftNode,omitempty"`
+	Maintenance  bool                  `json:"maintenance,omitempty"`
+	Replicas     *int                  `json:"replicas,omitempty"`     // Leafs the stem was last scaled to, nil if never scaled
+	TrafficSplit map[string]int        `json:"trafficSplit,omitempty"` // Percent of the stem's requests each version gets, nil if not split
+	Restarts     int                   `json:"restarts"`
+	LeafStarts   int                   `json:"leafStarts"`               // Leafs started for the stem, including replacements
+	ColdStarts   models.ColdStartStats `json:"coldStarts"`               // Requests the stem's graft node held while starting a leaf
+	Artifact     string                `json:"artifactDigest,omitempty"` // Verified digest of the artifact the stem was deployed from
+	GitCommit    string                `json:"gitCommit,omitempty"`      // Commit the version was built from
+	BuildTime    time.Time             `json:"buildTime,omitempty"`      // When the version was built, zero if unknown
+	DeployedBy   string                `json:"deployedBy,omitempty"`     // Who deployed the version through the admin API
+	DeployedAt   time.Time             `json:"deployedAt,omitempty"`     // When the version was deployed, zero if it was registered otherwise
+	Leafs        []LeafSummary         `json:"leafs"`                    // Filled in by ListStems, not part of the stem listing
+}
+
+// LeafSummary describes a leaf as listed by the admin API.
+type LeafSummary struct {
+	ID            string             `json:"id"`
+	PID           int                `json:"pid"`
+	HAProxyServer string             `json:"haproxyServer,omitempty"`
+	Port          int                `json:"port"`
+	Status        models.LeafStatus  `json:"status"`
+	Initialized   time.Time          `json:"initialized"`
+	History       []models.LeafStage `json:"history,omitempty"`
+}
+
+// Tombstone describes an unregistered stem as it was when it was removed, with the last status and history of
+// its leafs in Leafs. Tombstones are kept until the janitor purges them.
+type Tombstone struct {
+	StemSummary
+	Deleted time.Time `json:"deleted"`
+}
+
+// StemVersion describes an entry of a stem's version history, kept for every version ever registered for it.
+type StemVersion struct {
+	Name           string               `json:"name"`
+	Version        string               `json:"version"`
+	Status         models.VersionStatus `json:"status"`
+	RegisteredAt   time.Time            `json:"registeredAt"`             // When the version was last registered
+	UnregisteredAt time.Time            `json:"unregisteredAt,omitempty"` // When the version was last unregistered, zero while it is registered
+	Registrations  int                  `json:"registrations"`            // How often the version was registered, counting rollbacks to it
+	Previous       string               `json:"previous,omitempty"`       // Version a rollback from this one returns to
+	URL            string               `json:"url,omitempty"`
+	Artifact       string               `json:"artifactDigest,omitempty"`
+	GitCommit      string               `json:"gitCommit,omitempty"`
+	BuildTime      time.Time            `json:"buildTime,omitempty"`
+	DeployedBy     string               `json:"deployedBy,omitempty"`
+	DeployedAt     time.Time            `json:"deployedAt,omitempty"`
+}
+
+// stemDefinition is the portable stem description the admin API exports and imports.
+type stemDefinition struct {
+	FormatVersion int               `yaml:"formatVersion"`
+	Config        models.StemConfig `yaml:"config"`
+	Instances     int               `yaml:"instances"`
+}
+
+// stemPath returns the admin API path of a stem, followed by suffix.
+func stemPath(name, version, suffix string) string {
+	return fmt.Sprintf("/stems/%s/%s%s", url.PathEscape(name), url.PathEscape(version), suffix)
+}
+
+// RegisterStem registers a stem from its config and starts instances leafs of it. The service must already
+// be installed on the herbarium host; use DeployStem to upload it.
+func (c *Client) RegisterStem(config models.StemConfig, instances int) error {
+	definition, err := yaml.Marshal(stemDefinition{FormatVersion: definitionFormatVersion, Config: config, Instances: instances})
+	if err != nil {
+		return fmt.Errorf("failed to encode stem definition: %v", err)
+	}
+	return c.ImportStem(definition)
+}
+
+// ExportStem fetches the YAML definition of a stem.
+func (c *Client) ExportStem(name, version string) ([]byte, error) {
+	resp, err := c.client.R().Get(stemPath(name, version, "/export"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to export stem: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, newAPIError("export stem", resp.StatusCode(), resp.Body())
+	}
+	return resp.Body(), nil
+}
+
+// ImportStem registers a stem from a YAML definition produced by ExportStem.
+func (c *Client) ImportStem(definition []byte) error {
+	request := c.client.R().SetHeader("Content-Type", "application/yaml").SetBody(definition)
+	return c.do(request, http.MethodPost, "/stems/import", "import stem", http.StatusCreated, nil)
+}
+
+// DeployStem uploads the gzip-compressed tar of a service version directory and returns the stem it was
+// registered as.
+func (c *Client) DeployStem(archive io.Reader) (*StemSummary, error) {
+	var stem StemSummary
+	request := c.client.R().SetHeader("Content-Type", "application/gzip").SetBody(archive)
+	if err := c.do(request, http.MethodPost, "/stems/deploy", "deploy stem", http.StatusCreated, &stem); err != nil {
+		return nil, err
+	}
+	return &stem, nil
+}
+
+// DeployArtifact asks herbarium to download the archive of a service version from an https://, s3://, or
+// oci:// URL, verify it against its checksum and signature, and deploy it, returning the stem it was
+// registered as.
+func (c *Client) DeployArtifact(artifact models.ArtifactConfig) (*StemSummary, error) {
+	var stem StemSummary
+	request := c.client.R().SetBody(map[string]string{"artifact": artifact.URL, "sha256": artifact.SHA256, "signature": artifact.Signature})
+	if err := c.do(request, http.MethodPost, "/stems/deploy", "deploy stem", http.StatusCreated, &stem); err != nil {
+		return nil, err
+	}
+	return &stem, nil
+}
+
+// UpdateStemConfig applies config to a registered stem in place. With roll set, the running leafs are
+// replaced so they pick up a changed env or command.
+func (c *Client) UpdateStemConfig(name, version string, config models.StemConfig, roll bool) (*StemSummary, error) {
+	body, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode stem config: %v", err)
+	}
+	var stem StemSummary
+	request := c.client.R().
+		SetHeader("Content-Type", "application/yaml").
+		SetQueryParam("roll", strconv.FormatBool(roll)).
+		SetBody(body)
+	if err := c.do(request, http.MethodPut, stemPath(name, version, "/config"), "update stem config", http.StatusOK, &stem); err != nil {
+		return nil, err
+	}
+	return &stem, nil
+}
+
+// ScaleStem sets the number of running leafs of a stem.
+func (c *Client) ScaleStem(name, version string, replicas int) error {
+	request := c.client.R().SetBody(map[string]int{"replicas": replicas})
+	return c.do(request, http.MethodPut, stemPath(name, version, "/scale"), "scale stem", http.StatusOK, nil)
+}
+
+// UnregisterStem stops the leafs of a stem and unregisters it, returning the deployment history entry of the
+// change.
+func (c *Client) UnregisterStem(name, version string) (*models.Deployment, error) {
+	var entry models.Deployment
+	if err := c.do(c.client.R(), http.MethodDelete, stemPath(name, version, ""), "unregister stem", http.StatusOK, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// SetTrafficSplit shares the requests to a stem's backend between versions of the stem, by percent.
+func (c *Client) SetTrafficSplit(name, version string, split map[string]int) (*StemSummary, error) {
+	var stem StemSummary
+	request := c.client.R().SetBody(map[string]map[string]int{"split": split})
+	if err := c.do(request, http.MethodPut, stemPath(name, version, "/traffic-split"), "set traffic split", http.StatusOK, &stem); err != nil {
+		return nil, err
+	}
+	return &stem, nil
+}
+
+// SetStemMaintenance puts the proxy servers of a stem into maintenance, or takes them out of it.
+func (c *Client) SetStemMaintenance(name, version string, on bool) (*StemSummary, error) {
+	method := http.MethodPut
+	if !on {
+		method = http.MethodDelete
+	}
+	var stem StemSummary
+	if err := c.do(c.client.R(), method, stemPath(name, version, "/maintenance"), "set stem maintenance", http.StatusOK, &stem); err != nil {
+		return nil, err
+	}
+	return &stem, nil
+}
+
+// ListStems fetches every registered stem together with its leafs.
+func (c *Client) ListStems() ([]StemSummary, error) {
+	var stems []StemSummary
+	for {
+		var page []StemSummary
+		total, err := c.getPage("/stems", "stems", len(stems), &page)
+		if err != nil {
+			return nil, err
+		}
+		stems = append(stems, page...)
+		if len(page) == 0 || len(stems) >= total {
+			break
+		}
+	}
+
+	for i := range stems {
+		leafs, err := c.ListLeafs(stems[i].Name, stems[i].Version)
+		if err != nil {
+			return nil, err
+		}
+		stems[i].Leafs = leafs
+	}
+	return stems, nil
+}
+
+// ListStemVersions fetches every version ever registered for a stem, first registered first.
+func (c *Client) ListStemVersions(name string) ([]StemVersion, error) {
+	var history []StemVersion
+	path := fmt.Sprintf("/stems/%s/versions", url.PathEscape(name))
+	if err := c.do(c.client.R(), http.MethodGet, path, "list stem versions", http.StatusOK, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// RollbackStem returns a stem to the version registered before its newest one and returns the stem of that
+// version.
+func (c *Client) RollbackStem(name string) (*StemSummary, error) {
+	var stem StemSummary
+	path := fmt.Sprintf("/stems/%s/rollback", url.PathEscape(name))
+	if err := c.do(c.client.R(), http.MethodPost, path, "roll back stem", http.StatusOK, &stem); err != nil {
+		return nil, err
+	}
+	return &stem, nil
+}
+
+// ListTombstones fetches the tombstones of unregistered stems, oldest deletion first.
+func (c *Client) ListTombstones() ([]Tombstone, error) {
+	var tombstones []Tombstone
+	if err := c.do(c.client.R(), http.MethodGet, "/tombstones", "list tombstones", http.StatusOK, &tombstones); err != nil {
+		return nil, err
+	}
+	return tombstones, nil
+}
+
+// GetTombstone fetches the tombstone of an unregistered stem.
+func (c *Client) GetTombstone(name, version string) (*Tombstone, error) {
+	var tombstone Tombstone
+	path := fmt.Sprintf("/tombstones/%s/%s", url.PathEscape(name), url.PathEscape(version))
+	if err := c.do(c.client.R(), http.MethodGet, path, "get tombstone", http.StatusOK, &tombstone); err != nil {
+		return nil, err
+	}
+	return &tombstone, nil
+}
+
+// ListLeafs fetches every leaf of a stem.
+func (c *Client) ListLeafs(name, version string) ([]LeafSummary, error) {
+	path := stemPath(name, version, "/leafs")
+	leafs := []LeafSummary{}
+	for {
+		var page []LeafSummary
+		total, err := c.getPage(path, "leafs", len(leafs), &page)
+		if err != nil {
+			return nil, err
+		}
+		leafs = append(leafs, page...)
+		if len(page) == 0 || len(leafs) >= total {
+			break
+		}
+	}
+	return leafs, nil
+}
+
+// getPage fetches the largest page of a listing endpoint starting at offset into items, returning the total
+// number of items. what names the listed items in errors.
+func (c *Client) getPage(path, what string, offset int, items interface{}) (int, error) {
+	var page struct {
+		Items json.RawMessage `json:"items"`
+		Total int             `json:"total"`
+	}
+	request := c.client.R().
+		SetQueryParam("offset", strconv.Itoa(offset)).
+		SetQueryParam("limit", strconv.Itoa(maxPageLimit))
+	if err := c.do(request, http.MethodGet, path, "list "+what, http.StatusOK, &page); err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(page.Items, items); err != nil {
+		return 0, fmt.Errorf("failed to decode %s: %v", what, err)
+	}
+	return page.Total, nil
+}
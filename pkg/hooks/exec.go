@@ -0,0 +1,72 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultExecTimeout bounds a hook executable that doesn't configure a timeout.
+const DefaultExecTimeout = 10 * time.Second
+
+// execWaitDelay bounds how long a killed hook's children may keep its output open.
+const execWaitDelay = time.Second
+
+// ExecHook runs an external executable as a hook. The executable gets the extension point as its argument and
+// the operation as JSON on stdin. Exiting with a non-zero status vetoes the operation, with stderr as the
+// reason. JSON printed to stdout is merged into the operation, so printing {"stem":{"Env":{"REGION":"eu"}}}
+// adds an environment variable.
+type ExecHook struct {
+	Path    string
+	Timeout time.Duration
+}
+
+// NewExecHook creates a hook running the executable at path, killed after timeout or DefaultExecTimeout.
+func NewExecHook(path string, timeout time.Duration) *ExecHook {
+	if timeout <= 0 {
+		timeout = DefaultExecTimeout
+	}
+	return &ExecHook{Path: path, Timeout: timeout}
+}
+
+// Run runs the executable for an operation and merges its output into it.
+func (h *ExecHook) Run(op *Operation) error {
+	input, err := json.Marshal(op)
+	if err != nil {
+		return fmt.Errorf("failed to encode operation for %s: %v", h.Path, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.Path, string(op.Point))
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = execWaitDelay
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s did not finish within %s", h.Path, h.Timeout)
+		}
+		if reason := strings.TrimSpace(stderr.String()); reason != "" {
+			return fmt.Errorf("%s: %s", h.Path, reason)
+		}
+		return fmt.Errorf("%s: %v", h.Path, err)
+	}
+
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) == 0 {
+		return nil
+	}
+	enriched := *op
+	if err := json.Unmarshal(output, &enriched); err != nil {
+		return fmt.Errorf("%s printed an invalid operation: %v", h.Path, err)
+	}
+	enriched.Point = op.Point
+	*op = enriched
+	return nil
+}
@@ -0,0 +1,150 @@
+// Package hooks defines the extension points through which site-specific policies veto or enrich herbarium's
+// operations, and loads the Go plugins and executables implementing them.
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+)
+
+// Point identifies an extension point. Hooks at a before point run ahead of the operation and can veto it by
+// returning an error or enrich it by changing the operation; hooks at an after point only observe the outcome.
+type Point string
+
+const (
+	BeforeRegisterStem Point = "before_register_stem" // A stem is about to be registered; Stem changes are registered
+	AfterRegisterStem  Point = "after_register_stem"  // A stem was registered, or failed to be
+	BeforeStartLeaf    Point = "before_start_leaf"    // A leaf is about to start; Stem changes apply to this leaf only
+	AfterStartLeaf     Point = "after_start_leaf"     // A leaf started, or failed to
+	BeforeProxyBind    Point = "before_proxy_bind"    // A stem backend or a leaf is about to be bound to the proxy
+	AfterProxyBind     Point = "after_proxy_bind"     // A stem backend or a leaf was bound to the proxy, or failed to be
+
+	// A dependency with a schema is reachable and its schema must be created, e.g. with CREATE SCHEMA; failing
+	// keeps the depending stem from starting. Host and Port reach the dependency.
+	ProvisionDependency Point = "provision_dependency"
+)
+
+// Points lists every extension point.
+var Points = []Point{BeforeRegisterStem, AfterRegisterStem, BeforeStartLeaf, AfterStartLeaf, BeforeProxyBind, AfterProxyBind,
+	ProvisionDependency}
+
+// Operation describes the operation a hook runs for.
+type Operation struct {
+	Point   Point             `json:"point"`             // Extension point the hook runs at
+	Stem    models.StemConfig `json:"stem"`              // Config of the stem the operation concerns
+	LeafID  string            `json:"leafId,omitempty"`  // Leaf being started or bound, empty when binding a stem backend
+	Backend string            `json:"backend,omitempty"` // Proxy backend being bound
+	Host    string            `json:"host,omitempty"`    // Host the leaf is reached at, once known
+	Port    int               `json:"port,omitempty"`    // Port the leaf is reached at, once known
+	Error   string            `json:"error,omitempty"`   // Why the operation failed, at after points
+
+	Dependency *models.Dependency `json:"dependency,omitempty"` // Dependency being provisioned, at provision_dependency
+}
+
+// Hook runs at an extension point.
+type Hook interface {
+	Run(op *Operation) error
+}
+
+// HookFunc adapts a function to a Hook.
+type HookFunc func(op *Operation) error
+
+// Run calls f.
+func (f HookFunc) Run(op *Operation) error {
+	return f(op)
+}
+
+// Registry holds the hooks registered at each extension point, which run in registration order.
+// A nil Registry runs no hooks.
+type Registry struct {
+	mu    sync.RWMutex
+	hooks map[Point][]Hook
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{hooks: make(map[Point][]Hook)}
+}
+
+// Register adds a hook at an extension point.
+func (r *Registry) Register(point Point, hook Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks[point] = append(r.hooks[point], hook)
+}
+
+// Before runs the hooks at a before point, each seeing the changes of the previous ones. The first error
+// vetoes the operation and is returned. The hooks change a copy of the stem config, never the maps and
+// pointers op.Stem shared with the caller.
+func (r *Registry) Before(point Point, op *Operation) error {
+	op.Point = point
+	registered := r.at(point)
+	if len(registered) == 0 {
+		return nil
+	}
+	stem, err := cloneStem(op.Stem)
+	if err != nil {
+		return err
+	}
+	op.Stem = stem
+	for _, hook := range registered {
+		if err := hook.Run(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// After runs the hooks at an after point with the outcome of the operation. Their errors are only logged.
+func (r *Registry) After(point Point, op Operation, opErr error) {
+	op.Point = point
+	if opErr != nil {
+		op.Error = opErr.Error()
+	}
+	for _, hook := range r.at(point) {
+		hookOp := op
+		if stem, err := cloneStem(op.Stem); err == nil {
+			hookOp.Stem = stem
+		}
+		if err := hook.Run(&hookOp); err != nil {
+			log.Printf("Hook at %s failed: %v", point, err)
+		}
+	}
+}
+
+// at returns the hooks registered at an extension point.
+func (r *Registry) at(point Point) []Hook {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hooks[point]
+}
+
+// cloneStem deep-copies a stem config.
+func cloneStem(config models.StemConfig) (models.StemConfig, error) {
+	var clone models.StemConfig
+	data, err := json.Marshal(config)
+	if err == nil {
+		err = json.Unmarshal(data, &clone)
+	}
+	if err != nil {
+		return clone, fmt.Errorf("failed to copy config of stem %s: %v", config.Name, err)
+	}
+	return clone, nil
+}
+
+// ParsePoint returns the extension point with the given name.
+func ParsePoint(name string) (Point, error) {
+	for _, point := range Points {
+		if string(point) == name {
+			return point, nil
+		}
+	}
+	return "", fmt.Errorf("unknown extension point %q", name)
+}
@@ -0,0 +1,114 @@
+package hooks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/plantarium-platform/herbarium-go/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	var calls []string
+	registry.Register(BeforeStartLeaf, HookFunc(func(op *Operation) error {
+		calls = append(calls, "enrich")
+		op.Stem.Env = map[string]string{"REGION": "eu-west"}
+		return nil
+	}))
+	registry.Register(BeforeStartLeaf, HookFunc(func(op *Operation) error {
+		calls = append(calls, "check")
+		if op.Stem.Env["REGION"] == "" {
+			return errors.New("no region")
+		}
+		return nil
+	}))
+
+	registry.Register(BeforeStartLeaf, HookFunc(func(op *Operation) error {
+		op.Stem.Labels["tier"] = "gold"
+		return nil
+	}))
+
+	// Hooks change a copy of the config, the stem's own maps stay as they were
+	labels := map[string]string{"team": "payments"}
+	op := Operation{Stem: models.StemConfig{Name: "api", Labels: labels}}
+	assert.NoError(t, registry.Before(BeforeStartLeaf, &op))
+	assert.Equal(t, []string{"enrich", "check"}, calls)
+	assert.Equal(t, BeforeStartLeaf, op.Point)
+	assert.Equal(t, "eu-west", op.Stem.Env["REGION"])
+	assert.Equal(t, "gold", op.Stem.Labels["tier"])
+	assert.Equal(t, map[string]string{"team": "payments"}, labels)
+
+	// The first error vetoes the operation and skips the remaining hooks
+	registry.Register(BeforeRegisterStem, HookFunc(func(op *Operation) error { return errors.New("frozen") }))
+	registry.Register(BeforeRegisterStem, HookFunc(func(op *Operation) error {
+		t.Fatal("hook after a veto ran")
+		return nil
+	}))
+	assert.EqualError(t, registry.Before(BeforeRegisterStem, &op), "frozen")
+
+	// After hooks see the failure, and their own errors don't stop the others
+	var seen []string
+	registry.Register(AfterProxyBind, HookFunc(func(op *Operation) error { return errors.New("unreachable audit log") }))
+	registry.Register(AfterProxyBind, HookFunc(func(op *Operation) error {
+		seen = append(seen, op.Error)
+		return nil
+	}))
+	registry.After(AfterProxyBind, op, errors.New("backend missing"))
+	assert.Equal(t, []string{"backend missing"}, seen)
+
+	// A nil registry runs nothing
+	var none *Registry
+	assert.NoError(t, none.Before(BeforeRegisterStem, &op))
+	none.After(AfterRegisterStem, op, nil)
+
+	_, err := ParsePoint("before_deploy")
+	assert.Error(t, err)
+}
+
+func TestExecHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook scripts need a POSIX shell")
+	}
+	dir := t.TempDir()
+	script := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755))
+		return path
+	}
+
+	// Output is merged into the operation, keeping what the hook didn't print
+	enrich := NewExecHook(script("enrich", `[ "$1" = before_start_leaf ] || exit 1
+grep -q '"Name":"api"' || exit 1
+echo '{"stem":{"Env":{"REGION":"eu-west"}}}'
+`), 0)
+	op := Operation{Point: BeforeStartLeaf, LeafID: "api-1", Stem: models.StemConfig{Name: "api", Env: map[string]string{"PORT": "8080"}}}
+	assert.NoError(t, enrich.Run(&op))
+	assert.Equal(t, map[string]string{"PORT": "8080", "REGION": "eu-west"}, op.Stem.Env)
+	assert.Equal(t, "api-1", op.LeafID)
+
+	// A non-zero exit vetoes with stderr as the reason
+	veto := NewExecHook(script("veto", "echo 'outside the change window' >&2\nexit 3\n"), 0)
+	err := veto.Run(&op)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "outside the change window")
+	}
+
+	slow := NewExecHook(script("slow", "exec sleep 5\n"), 50*time.Millisecond)
+	err = slow.Run(&op)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "did not finish within 50ms")
+	}
+
+	invalid := NewExecHook(script("invalid", "echo not-json\n"), 0)
+	assert.Error(t, invalid.Run(&op))
+}
+
+func TestLoadPlugin_Missing(t *testing.T) {
+	err := LoadPlugin(filepath.Join(t.TempDir(), "missing.so"), NewRegistry())
+	assert.Error(t, err)
+}
@@ -0,0 +1,32 @@
+package hooks
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// RegisterSymbol is the function a Go plugin exports to register its hooks:
+//
+//	func Register(registry *hooks.Registry) error
+const RegisterSymbol = "Register"
+
+// LoadPlugin opens the Go plugin at path and calls its Register function. Go plugins only load on Linux,
+// macOS and FreeBSD, into a herbarium built with cgo and the same Go version and module versions.
+func LoadPlugin(path string, registry *Registry) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open plugin %s: %v", path, err)
+	}
+	symbol, err := p.Lookup(RegisterSymbol)
+	if err != nil {
+		return fmt.Errorf("plugin %s does not export %s: %v", path, RegisterSymbol, err)
+	}
+	register, ok := symbol.(func(*Registry) error)
+	if !ok {
+		return fmt.Errorf("plugin %s exports %s as %T, not func(*hooks.Registry) error", path, RegisterSymbol, symbol)
+	}
+	if err := register(registry); err != nil {
+		return fmt.Errorf("plugin %s failed to register: %v", path, err)
+	}
+	return nil
+}
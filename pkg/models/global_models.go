@@ -4,17 +4,238 @@ import "time"
 
 // StemConfig represents the configuration for a service, parsed from a YAML file.
 type StemConfig struct {
-	Name         string            `yaml:"name"`    // Service name
-	URL          string            `yaml:"url"`     // Service URL
-	Command      string            `yaml:"command"` // Command to start the service
-	Env          map[string]string `yaml:"env"`     // Environment variables
-	Dependencies []struct {        // Service dependencies
-		Name   string `yaml:"name"`   // Dependency name
-		Schema string `yaml:"schema"` // Dependency schema
-	} `yaml:"dependencies"`
-	Version      string  `yaml:"version"`      // Service version
-	MinInstances *int    `yaml:"minInstances"` // Minimum number of instances to keep running (optional)
-	StartMessage *string `yaml:"startMessage"` // Message indicating the service has started (optional)
+	APIVersion       string             `yaml:"apiVersion,omitempty"`       // Config schema version, older versions are migrated on load (optional)
+	Name             string             `yaml:"name"`                       // Service name
+	URL              string             `yaml:"url"`                        // Service URL
+	Host             string             `yaml:"host,omitempty"`             // Hostname requests must be for besides the URL, e.g. api.example.com (optional)
+	Shadow           bool               `yaml:"shadow,omitempty"`           // Routes no requests to the stem, only copies mirrored by another version of it (optional)
+	Command          string             `yaml:"command"`                    // Command to start the service
+	Env              map[string]string  `yaml:"env,omitempty"`              // Environment variables
+	Dependencies     []Dependency       `yaml:"dependencies,omitempty"`     // Services provisioned before the stem's leafs start (optional)
+	Version          string             `yaml:"version"`                    // Service version
+	Labels           map[string]string  `yaml:"labels,omitempty"`           // Arbitrary key-value labels used for selection (optional)
+	MinInstances     *int               `yaml:"minInstances,omitempty"`     // Minimum number of instances to keep running (optional)
+	MaxInstances     *int               `yaml:"maxInstances,omitempty"`     // Maximum number of instances the stem can be scaled to (optional)
+	WarmPool         *int               `yaml:"warmPool,omitempty"`         // Number of started leafs kept out of the proxy until promoted (optional)
+	Schedules        []ScheduleConfig   `yaml:"schedules,omitempty"`        // Time windows the stem runs a number of leafs in, minInstances outside them (optional)
+	Autoscale        *AutoscaleConfig   `yaml:"autoscale,omitempty"`        // Proxy queue and latency targets the stem is scaled to keep (optional)
+	Disruption       *DisruptionConfig  `yaml:"disruption,omitempty"`       // Limits on the leafs the autoscaler and recycler take out of service (optional)
+	StartMessage     *string            `yaml:"startMessage,omitempty"`     // Message indicating the service has started (optional)
+	WorkingDir       *string            `yaml:"workingDir,omitempty"`       // Overrides the default services/<name>/<version> working directory (optional)
+	DataDir          *string            `yaml:"dataDir,omitempty"`          // Persistent data directory created for the stem and exposed to leafs (optional)
+	Artifact         *ArtifactConfig    `yaml:"artifact,omitempty"`         // Archive fetched into the working directory when the stem is registered (optional)
+	Build            *BuildConfig       `yaml:"build,omitempty"`            // Build the version was made from, recorded by CI (optional)
+	Agent            *string            `yaml:"agent,omitempty"`            // Name of the remote agent running the stem's leafs (optional)
+	SSH              *SSHConfig         `yaml:"ssh,omitempty"`              // Remote host running the stem's leafs over SSH (optional)
+	Kubernetes       *KubernetesConfig  `yaml:"kubernetes,omitempty"`       // Pod the stem's leafs run as in the configured Kubernetes cluster (optional)
+	Firecracker      *FirecrackerConfig `yaml:"firecracker,omitempty"`      // MicroVM the stem's leafs are isolated in, experimental (optional)
+	Nix              *NixConfig         `yaml:"nix,omitempty"`              // Nix environment materialized for local leafs, so the host needs no runtime installed (optional)
+	Placement        *PlacementConfig   `yaml:"placement,omitempty"`        // Constraints on the nodes the stem's leafs are placed on (optional)
+	PortRange        string             `yaml:"portRange,omitempty"`        // Ports leafs listen on, e.g. 9000-9010; defaults to the first free port from 8000 (optional)
+	IPFamily         string             `yaml:"ipFamily,omitempty"`         // "ipv4", "ipv6", or "dual" for the loopback address local leafs are reached at; defaults to localhost (optional)
+	BindAddress      string             `yaml:"bindAddress,omitempty"`      // Interface local leafs listen on, {{.HOST}} in the command; defaults to leafs.bind_address (optional)
+	AdvertiseAddress string             `yaml:"advertiseAddress,omitempty"` // Address the proxy reaches local leafs at; defaults to leafs.advertise_address (optional)
+	Backend          *BackendConfig     `yaml:"backend,omitempty"`          // Protocol and health check of the stem's proxy backend (optional)
+	Transport        string             `yaml:"transport,omitempty"`        // "tcp" (default) or "udp" for datagram services (optional)
+	UDP              *UDPConfig         `yaml:"udp,omitempty"`              // Port, routing, and readiness probe of a UDP stem (optional)
+	Static           *StaticConfig      `yaml:"static,omitempty"`           // Directory served by herbarium instead of running a command (optional)
+	Runtime          string             `yaml:"runtime,omitempty"`          // Language runtime adapter: java, node, python, or go (optional)
+	HealthPath       string             `yaml:"healthPath,omitempty"`       // HTTP endpoint polled for readiness, overrides the runtime default (optional)
+	Probe            *ProbeConfig       `yaml:"probe,omitempty"`            // How leafs are checked for readiness and liveness, replaces healthPath (optional)
+	StopSignal       string             `yaml:"stopSignal,omitempty"`       // Signal asking leafs to shut down, overrides the runtime default (optional)
+	StopTimeout      string             `yaml:"stopTimeout,omitempty"`      // Time leafs get to shut down before they are killed, e.g. 30s (optional)
+	DrainTimeout     string             `yaml:"drainTimeout,omitempty"`     // Time requests in flight get to finish before a leaf is stopped, 0s skips draining (optional)
+	Recycle          *RecycleConfig     `yaml:"recycle,omitempty"`          // Replaces leafs after a number of requests or a running time (optional)
+	Alerts           *AlertConfig       `yaml:"alerts,omitempty"`           // Thresholds that fire alerts when breached (optional)
+}
+
+// Dependency is a service a stem needs, provisioned before the stem's leafs start: the dependency's stem is
+// started and checked for reachability, and a schema, if given, is created through provision_dependency hooks.
+type Dependency struct {
+	Name   string `yaml:"name"`             // Name of the stem providing the dependency
+	Schema string `yaml:"schema,omitempty"` // Schema, database, or namespace to create for the stem (optional)
+}
+
+// ScheduleConfig is a recurring time window during which a stem runs at least a number of leafs. Outside all
+// of its windows, a stem falls back to its minInstances.
+type ScheduleConfig struct {
+	Days      []string `yaml:"days,omitempty"`     // "mon" to "sun", "weekdays", or "weekends"; every day when empty
+	From      string   `yaml:"from"`               // Start of the window, HH:MM
+	To        string   `yaml:"to"`                 // End of the window, HH:MM; before from for windows past midnight
+	Instances int      `yaml:"instances"`          // Leafs the stem runs at least during the window
+	Timezone  string   `yaml:"timezone,omitempty"` // IANA time zone of from and to, defaults to the host's (optional)
+}
+
+// AutoscaleConfig sets the saturation targets a stem is scaled to keep, measured by the proxy. Unset targets
+// are not used as signals.
+type AutoscaleConfig struct {
+	TargetQueue    int64  `yaml:"targetQueue,omitempty"`    // Requests waiting in the proxy's queues per running leaf; needs backend.maxConn
+	TargetLatency  string `yaml:"targetLatency,omitempty"`  // Average response time of the leafs, e.g. 300ms
+	ScaleDownDelay string `yaml:"scaleDownDelay,omitempty"` // Time the signals must stay below half their target before a leaf is removed, defaults to 5m
+}
+
+// DisruptionConfig limits how many leafs of a stem the autoscaler and recycler take out of service, and how
+// often. Leafs stopped by hand or by scaling through the API are not limited.
+type DisruptionConfig struct {
+	MaxUnavailable    int    `yaml:"maxUnavailable,omitempty"`    // Leafs that may be stopping at once, defaults to 1
+	MinHealthy        int    `yaml:"minHealthy,omitempty"`        // Running leafs the autoscaler never scales below
+	ScaleDownCooldown string `yaml:"scaleDownCooldown,omitempty"` // Time after the stem was autoscaled or had a leaf recycled before another leaf is removed, e.g. 2m
+}
+
+// AlertConfig declares the thresholds a stem is expected to stay within. Zero values are not checked.
+type AlertConfig struct {
+	MaxRestartsPerHour int      `yaml:"maxRestartsPerHour,omitempty"` // Leaf starts within the last hour beyond which the stem counts as unstable
+	MaxLatency         string   `yaml:"maxLatency,omitempty"`         // Average response time any leaf may reach, e.g. 500ms; needs a proxy that measures it
+	MinHealthyLeafs    int      `yaml:"minHealthyLeafs,omitempty"`    // Running leafs the stem must have
+	Channels           []string `yaml:"channels,omitempty"`           // Names of the alerting channels notified, defaults to all of them
+}
+
+// RecycleConfig configures when the leafs of a stem are replaced by fresh ones.
+type RecycleConfig struct {
+	MaxRequests int64  `yaml:"maxRequests,omitempty"` // Requests a leaf serves before it is replaced; needs a proxy that counts requests
+	MaxAge      string `yaml:"maxAge,omitempty"`      // Time a leaf runs before it is replaced, e.g. 24h
+	MaxMemoryMB int    `yaml:"maxMemoryMB,omitempty"` // Resident memory a leaf may use before it is replaced
+}
+
+// ProbeConfig configures how the leafs of a stem are checked for health.
+type ProbeConfig struct {
+	Type             string `yaml:"type"`                       // "tcp", "http", "exec", or "grpc"
+	Path             string `yaml:"path,omitempty"`             // HTTP path requested, defaults to /
+	ExpectedStatus   int    `yaml:"expectedStatus,omitempty"`   // HTTP status a healthy leaf answers with, defaults to any below 500
+	Command          string `yaml:"command,omitempty"`          // Command run in the working directory, healthy when it exits with 0; {{.HOST}} and {{.PORT}} are replaced
+	Service          string `yaml:"service,omitempty"`          // Service asked for in the gRPC health check, empty for the whole server
+	Timeout          string `yaml:"timeout,omitempty"`          // Time a single probe may take, defaults to 1s
+	FailureThreshold int    `yaml:"failureThreshold,omitempty"` // Failed probes in a row after which a running leaf is replaced, 0 disables liveness checks
+}
+
+// ArtifactConfig references a gzip-compressed tar of a service version's files stored outside herbarium.
+type ArtifactConfig struct {
+	URL       string `yaml:"url"`                 // https://, s3://<bucket>/<key>, or oci://<registry>/<repository>:<tag> or @<digest>
+	SHA256    string `yaml:"sha256,omitempty"`    // Hex SHA-256 checksum the archive must match (optional)
+	Signature string `yaml:"signature,omitempty"` // URL of the archive's detached signature, defaults to <url>.minisig or <url>.sig (optional)
+}
+
+// BuildConfig describes the build a service version was made from.
+type BuildConfig struct {
+	Commit string `yaml:"commit,omitempty"` // Git commit the version was built from
+	Time   string `yaml:"time,omitempty"`   // RFC 3339 time the version was built at
+}
+
+// VersionMetadata is what is known about the build a stem version runs and its deployment, so "what exactly
+// is running" has an authoritative answer. It is kept in the version's working directory across restarts.
+type VersionMetadata struct {
+	Artifact       string    `yaml:"artifact,omitempty"`       // URL of the artifact the version was unpacked from
+	ArtifactDigest string    `yaml:"artifactDigest,omitempty"` // Digest of the artifact, once verified by checksum or signature
+	GitCommit      string    `yaml:"gitCommit,omitempty"`      // Commit the version was built from
+	BuildTime      time.Time `yaml:"buildTime,omitempty"`      // When the version was built
+	DeployedBy     string    `yaml:"deployedBy,omitempty"`     // Who deployed the version through the admin API
+	DeployedAt     time.Time `yaml:"deployedAt,omitempty"`     // When the version was deployed through the admin API
+}
+
+// NixConfig declares the environment a stem's leafs run in, built with nix from a flake or a list of packages.
+type NixConfig struct {
+	Flake    string   `yaml:"flake,omitempty"`    // Flake whose dev shell the leafs run in, e.g. .#billing or github:acme/envs#jdk21
+	Packages []string `yaml:"packages,omitempty"` // Packages put on the PATH, from nixpkgs unless given as a flake installable, e.g. [jdk21, ffmpeg]
+}
+
+// StaticConfig configures a stem whose leafs serve a directory of static files from inside herbarium.
+type StaticConfig struct {
+	Root  string `yaml:"root,omitempty"`  // Directory to serve, relative to the stem's working directory; defaults to the working directory
+	Index string `yaml:"index,omitempty"` // File served for directory requests, defaults to index.html
+	SPA   bool   `yaml:"spa,omitempty"`   // Serve the index file for unknown paths without an extension, for client-side routing
+}
+
+// UDPConfig configures a stem whose leafs serve UDP.
+type UDPConfig struct {
+	Routing string `yaml:"routing,omitempty"` // "direct" (default) exposes leaf ports as they are, "proxy" publishes Port through the proxy
+	Port    int    `yaml:"port,omitempty"`    // Fixed leaf port for direct routing, or the published port for proxy routing
+	Probe   string `yaml:"probe,omitempty"`   // Hex-encoded datagram sent to check readiness, any reply counts as ready (optional)
+}
+
+// BackendConfig configures how the proxy talks to and checks a stem's leafs.
+type BackendConfig struct {
+	Protocol        string                `yaml:"protocol,omitempty"`        // "http" (default), "h2c" for cleartext HTTP/2 such as gRPC, or "h2" for HTTP/2 over TLS
+	HealthCheck     string                `yaml:"healthCheck,omitempty"`     // "http" (default) or "grpc" for the standard gRPC health service
+	MaxConn         int                   `yaml:"maxConn,omitempty"`         // Requests a leaf handles at once, further requests wait in the proxy's queue; 0 for no limit
+	StripPrefix     bool                  `yaml:"stripPrefix,omitempty"`     // Removes the stem's URL from request paths, so leafs are served at /
+	ConnectTimeout  string                `yaml:"connectTimeout,omitempty"`  // Time to connect to a leaf, e.g. 2s; the proxy's default when empty
+	ServerTimeout   string                `yaml:"serverTimeout,omitempty"`   // Time a leaf may take to respond, e.g. 5m for slow batch endpoints; the proxy's default when empty
+	QueueTimeout    string                `yaml:"queueTimeout,omitempty"`    // Time a request waits for a free leaf before it is answered with 503; the proxy's default when empty
+	Retries         *int                  `yaml:"retries,omitempty"`         // Times a failed connection to a leaf is retried, 0 to not retry; the proxy's default when unset
+	Compression     bool                  `yaml:"compression,omitempty"`     // Compresses text responses with gzip for clients accepting it
+	CacheMaxAge     string                `yaml:"cacheMaxAge,omitempty"`     // Caches responses in the proxy for up to this long, e.g. 5m, and sends them with this Cache-Control max-age unless the leaf set one
+	Rewrite         string                `yaml:"rewrite,omitempty"`         // Replaces the stem's URL in request paths with this path, e.g. /api/v1
+	CORS            *CORSConfig           `yaml:"cors,omitempty"`            // Cross-origin requests the proxy allows, answering their preflight requests itself
+	SecurityHeaders bool                  `yaml:"securityHeaders,omitempty"` // Adds HSTS, X-Frame-Options, X-Content-Type-Options, and Referrer-Policy headers to responses
+	RateLimit       *RateLimitConfig      `yaml:"rateLimit,omitempty"`       // Requests a client may send, further ones are answered with 429 Too Many Requests
+	CircuitBreaker  *CircuitBreakerConfig `yaml:"circuitBreaker,omitempty"`  // Takes leafs answering with bursts of errors out of rotation
+	Mirror          *MirrorConfig         `yaml:"mirror,omitempty"`          // Copies requests to a shadow version of the stem, discarding its responses
+}
+
+// MirrorConfig copies a share of a stem's requests to a version of it registered with shadow: true.
+type MirrorConfig struct {
+	Version string `yaml:"version"` // Version of the shadow stem receiving the copies
+	Percent int    `yaml:"percent"` // Share of requests copied, 1 to 100
+}
+
+// CircuitBreakerConfig has the proxy take a leaf out of rotation when its responses fail errorLimit times in a
+// row, until it passes its health checks again.
+type CircuitBreakerConfig struct {
+	ErrorLimit  int    `yaml:"errorLimit"`            // Failed responses in a row, 5xx or connection errors, after which the leaf is taken out
+	OnError     string `yaml:"onError,omitempty"`     // "mark-down" (default) takes it out at once, "sudden-death" after one more failed health check
+	RestartLeaf bool   `yaml:"restartLeaf,omitempty"` // Replaces a leaf taken out of rotation instead of waiting for it to recover
+}
+
+// RateLimitConfig limits the requests each client address may send to a stem.
+type RateLimitConfig struct {
+	Requests int    `yaml:"requests"`         // Requests allowed per period
+	Period   string `yaml:"period,omitempty"` // Period the requests are counted over, defaults to 1s
+}
+
+// CORSConfig lists the cross-origin requests the proxy allows for a stem.
+type CORSConfig struct {
+	AllowOrigins     []string `yaml:"allowOrigins"`               // Origins allowed to send requests, e.g. https://app.example.com; "*" for any
+	AllowMethods     []string `yaml:"allowMethods,omitempty"`     // Methods allowed, defaults to GET, HEAD, POST, PUT, PATCH, and DELETE
+	AllowHeaders     []string `yaml:"allowHeaders,omitempty"`     // Request headers allowed beyond the simple ones, e.g. Authorization
+	AllowCredentials bool     `yaml:"allowCredentials,omitempty"` // Whether cookies and authorization headers may be sent, not with "*"
+	MaxAge           string   `yaml:"maxAge,omitempty"`           // How long browsers may cache preflight responses, e.g. 10m
+}
+
+// PlacementConfig constrains which node a stem's leafs are placed on.
+type PlacementConfig struct {
+	Labels   map[string]string `yaml:"labels,omitempty"`   // Labels a node must carry
+	MemoryMB int               `yaml:"memoryMB,omitempty"` // Memory reserved on the node for each leaf
+}
+
+// SSHConfig describes the remote host and key-based login used to run a stem's leafs over SSH.
+type SSHConfig struct {
+	Host           string `yaml:"host"`                     // Remote host name or address, also registered in HAProxy
+	Port           int    `yaml:"port,omitempty"`           // SSH port, defaults to 22
+	User           string `yaml:"user,omitempty"`           // Login user, defaults to the local SSH configuration
+	IdentityFile   string `yaml:"identityFile"`             // Private key used to authenticate
+	KnownHostsFile string `yaml:"knownHostsFile,omitempty"` // Known hosts file used to verify the remote host (optional)
+	WorkingDir     string `yaml:"workingDir"`               // Remote directory the command runs in
+	LogDir         string `yaml:"logDir,omitempty"`         // Remote directory for leaf logs and PID files, defaults to /tmp/herbarium
+}
+
+// KubernetesConfig describes the pods a stem's leafs run as in the Kubernetes cluster of the global config.
+type KubernetesConfig struct {
+	Image            string            `yaml:"image"`                      // Container image of the leaf pods
+	Port             int               `yaml:"port,omitempty"`             // Container port the service listens on, {{.PORT}} in the command; defaults to 8080
+	CPU              string            `yaml:"cpu,omitempty"`              // CPU requested and limited to, e.g. 500m (optional)
+	Memory           string            `yaml:"memory,omitempty"`           // Memory requested and limited to, e.g. 256Mi (optional)
+	ServiceAccount   string            `yaml:"serviceAccount,omitempty"`   // Service account the pods run as (optional)
+	NodeSelector     map[string]string `yaml:"nodeSelector,omitempty"`     // Labels of the cluster nodes the pods may run on (optional)
+	ImagePullSecrets []string          `yaml:"imagePullSecrets,omitempty"` // Secrets used to pull the image (optional)
+}
+
+// FirecrackerConfig describes the Firecracker microVMs a stem's leafs run in, one per leaf.
+type FirecrackerConfig struct {
+	Kernel   string `yaml:"kernel"`             // Uncompressed Linux kernel image the microVMs boot
+	RootFS   string `yaml:"rootfs"`             // ext4 root filesystem, attached read-only; its init starts the leaf from the MMDS
+	VCPUs    int    `yaml:"vcpus,omitempty"`    // Virtual CPUs of each microVM, defaults to 1
+	MemoryMB int    `yaml:"memoryMB,omitempty"` // Memory of each microVM, defaults to 256
+	Port     int    `yaml:"port,omitempty"`     // Port the service listens on in the microVM, {{.PORT}} in the command; defaults to 8080
 }
 
 // Stem represents a deployment with associated leaf instances and configuration.
@@ -28,16 +249,146 @@ type Stem struct {
 	LeafInstances  map[string]*Leaf  // Active leaf instances (keyed by LeafID)
 	GraftNodeLeaf  *Leaf             // Placeholder leaf if no real instances exist
 	Config         *StemConfig       // Parsed service configuration
+	Maintenance    bool              // Whether the stem's servers are in maintenance, answering with the maintenance page
+	Replicas       *int              // Desired number of running leafs set by scaling, nil to follow minInstances
+	TrafficSplit   map[string]int    // Percent of the backend's requests each version of the stem gets, nil for all to this one
+	Restarts       int               // Leafs that were replaced or found dead, shown by herbarium ps
+	LeafStarts     int               // Leafs started for the stem, including replacements and standby leafs
+	ColdStarts     ColdStartStats    // Requests graft nodes held while starting the stem's first leaf
+	Revision       uint64            // Incremented on every change to the stem itself, not to its leafs
+	Deleted        time.Time         // When the stem was unregistered and became a tombstone, zero while registered
+	Metadata       VersionMetadata   // Build and deployment of the version
+}
+
+// Clone returns a deep copy of the stem with its leafs and graft node, so it can be read and changed
+// without affecting the stored stem. The config is shared: it is replaced as a whole, never changed.
+func (s *Stem) Clone() *Stem {
+	if s == nil {
+		return nil
+	}
+	clone := *s
+	if s.Environment != nil {
+		clone.Environment = make(map[string]string, len(s.Environment))
+		for key, value := range s.Environment {
+			clone.Environment[key] = value
+		}
+	}
+	if s.LeafInstances != nil {
+		clone.LeafInstances = make(map[string]*Leaf, len(s.LeafInstances))
+		for id, leaf := range s.LeafInstances {
+			clone.LeafInstances[id] = leaf.Clone()
+		}
+	}
+	clone.GraftNodeLeaf = s.GraftNodeLeaf.Clone()
+	if s.Replicas != nil {
+		replicas := *s.Replicas
+		clone.Replicas = &replicas
+	}
+	if s.TrafficSplit != nil {
+		clone.TrafficSplit = make(map[string]int, len(s.TrafficSplit))
+		for version, percent := range s.TrafficSplit {
+			clone.TrafficSplit[version] = percent
+		}
+	}
+	return &clone
+}
+
+// VersionStatus is the state of a version in the version history of a stem.
+type VersionStatus string
+
+const (
+	VersionActive       VersionStatus = "active"       // The version is registered
+	VersionUnregistered VersionStatus = "unregistered" // The version was unregistered
+	VersionRolledBack   VersionStatus = "rolled_back"  // The version was unregistered by a rollback to an earlier one
+	VersionFailed       VersionStatus = "failed"       // The registration of the version failed to start its leafs
+)
+
+// StemVersion is an entry of the version history of a stem, kept for every version ever registered for it,
+// so earlier versions can be rolled back to and deployments laid out on a timeline.
+type StemVersion struct {
+	Name           string          // Name of the stem
+	Version        string          // Version of the stem
+	Status         VersionStatus   // Current state of the version
+	RegisteredAt   time.Time       // When the version was last registered
+	UnregisteredAt time.Time       // When the version was last unregistered, zero while it is registered
+	Registrations  int             // How often the version was registered, counting rollbacks to it
+	Previous       string          // Version a rollback returns to, current when this one was first registered; empty for the first
+	Config         *StemConfig     // Config the version was last registered with, to register it again on a rollback
+	Metadata       VersionMetadata // Build and deployment of the version
+}
+
+// Clone returns a copy of the history entry. The config is shared, like the config of a stem.
+func (v *StemVersion) Clone() *StemVersion {
+	if v == nil {
+		return nil
+	}
+	clone := *v
+	return &clone
+}
+
+// ColdStart is a graft node starting a leaf for the requests that arrived while the stem had none.
+type ColdStart struct {
+	Started   time.Time     `json:"started"`   // When the first request arrived
+	Requests  int           `json:"requests"`  // Requests that arrived before the leaf was ready
+	TotalWait time.Duration `json:"totalWait"` // Time those requests waited for the leaf, summed
+	MaxWait   time.Duration `json:"maxWait"`   // Time the first request waited
+}
+
+// ColdStartStats sums up the cold starts of a stem, to tune its minInstances and warm pool.
+type ColdStartStats struct {
+	Count       int           `json:"count"`       // Cold starts
+	Requests    int           `json:"requests"`    // Requests that arrived during cold starts
+	MaxRequests int           `json:"maxRequests"` // Most requests that arrived during a single cold start
+	TotalWait   time.Duration `json:"totalWait"`   // Time all those requests waited for a leaf, summed
+	MaxWait     time.Duration `json:"maxWait"`     // Longest any request waited
+	Last        time.Time     `json:"last"`        // When the last cold start began
+}
+
+// Add counts a cold start into the stats.
+func (s *ColdStartStats) Add(coldStart ColdStart) {
+	s.Count++
+	s.Requests += coldStart.Requests
+	s.MaxRequests = max(s.MaxRequests, coldStart.Requests)
+	s.TotalWait += coldStart.TotalWait
+	s.MaxWait = max(s.MaxWait, coldStart.MaxWait)
+	s.Last = coldStart.Started
 }
 
 // Leaf represents a single running instance of a service.
 type Leaf struct {
-	ID            string     // Unique identifier for the leaf instance
-	PID           int        // Process ID of the running leaf
-	HAProxyServer string     // HAProxy server name for this leaf
-	Port          int        // Port on which the leaf is running
-	Status        LeafStatus // Current status of the leaf
-	Initialized   time.Time  // Timestamp of when the leaf was initialized
+	ID            string      // Unique identifier for the leaf instance
+	PID           int         // Process ID of the running leaf
+	HAProxyServer string      // HAProxy server name for this leaf
+	Port          int         // Port on which the leaf is running
+	Status        LeafStatus  // Current status of the leaf
+	Initialized   time.Time   // Timestamp of when the leaf was initialized
+	Agent         string      // Remote agent running the leaf ("ssh" for SSH leafs, "static" for static stems, "kubernetes" for pods, "firecracker" for microVMs), empty for leafs run by herbarium itself
+	Host          string      // Address the leaf is reached at, empty for localhost
+	Node          string      // Node the leaf was placed on, empty when no nodes are registered
+	History       []LeafStage // Stages the leaf went through, oldest first
+	Revision      uint64      // Incremented on every change to the leaf
+}
+
+// Clone returns a copy of the leaf with its own status history.
+func (l *Leaf) Clone() *Leaf {
+	if l == nil {
+		return nil
+	}
+	clone := *l
+	if l.History != nil {
+		clone.History = append([]LeafStage(nil), l.History...)
+	}
+	return &clone
+}
+
+// Node is a host leafs can be placed on, either the herbarium host itself or a host run by an agent.
+type Node struct {
+	Name     string            // Unique node name
+	Address  string            // Address HAProxy uses to reach leafs on the node
+	Agent    string            // Agent running leafs on the node, empty for the herbarium host
+	Labels   map[string]string // Labels matched against stem placement constraints
+	MemoryMB int               // Memory available to leafs, 0 means unlimited
+	Down     bool              // Whether the node's agent stopped answering; no leafs are placed on it until it answers again
 }
 
 // StemType defines the type of a stem, either a system stem or a deployment stem.
@@ -55,20 +406,395 @@ const (
 	StatusStarting LeafStatus = "STARTING" // The leaf is starting
 	StatusRunning  LeafStatus = "RUNNING"  // The leaf is running
 	StatusStopping LeafStatus = "STOPPING" // The leaf is stopping
+	StatusStandby  LeafStatus = "STANDBY"  // The leaf is started and ready but kept out of the proxy until promoted
 	StatusUnknown  LeafStatus = "UNKNOWN"  // The status of the leaf is unknown
 )
 
+// LeafStage is an entry of a leaf's status history: a stage the leaf went through, such as draining it
+// before it is stopped, with how long the stage took.
+type LeafStage struct {
+	Stage    string        `json:"stage"`           // Stage name, e.g. drain or terminate
+	Status   LeafStatus    `json:"status"`          // Status of the leaf during the stage
+	Started  time.Time     `json:"started"`         // When the stage started
+	Duration time.Duration `json:"duration"`        // How long the stage took
+	Error    string        `json:"error,omitempty"` // Why the stage failed, empty if it succeeded
+}
+
+// Event is a notable change in the platform that stem owners may want to hear about.
+type Event struct {
+	Seq     uint64    `json:"seq"`               // Position in the event log, increasing by one per event
+	Time    time.Time `json:"time"`              // When the event happened
+	Type    EventType `json:"type"`              // What happened
+	Stem    string    `json:"stem,omitempty"`    // Stem the event concerns, if any
+	Version string    `json:"version,omitempty"` // Version of the stem
+	Leaf    string    `json:"leaf,omitempty"`    // Leaf the event concerns, if any
+	Message string    `json:"message"`           // Human-readable description
+}
+
+// EventType defines the kind of an event.
+type EventType string
+
+// DeploymentAction is the kind of change recorded in the deployment history.
+type DeploymentAction string
+
+const (
+	DeploymentDeploy     DeploymentAction = "deploy"     // A version was deployed from an archive or artifact, or imported
+	DeploymentScale      DeploymentAction = "scale"      // A stem was scaled to a number of running leafs
+	DeploymentUnregister DeploymentAction = "unregister" // A stem was unregistered
+	DeploymentRollback   DeploymentAction = "rollback"   // A stem was rolled back to an earlier version
+)
+
+// DeploymentOutcome is how a change recorded in the deployment history ended.
+type DeploymentOutcome string
+
+const (
+	DeploymentSucceeded DeploymentOutcome = "succeeded"
+	DeploymentFailed    DeploymentOutcome = "failed"
+)
+
+// Deployment is an entry of the deployment history: a change to the stems someone initiated, with its
+// parameters and outcome, kept for release management apart from the state journal.
+type Deployment struct {
+	Seq        uint64            `json:"seq"`                  // Position in the history, increasing by one per entry
+	Time       time.Time         `json:"time"`                 // When the change was initiated
+	Duration   time.Duration     `json:"duration"`             // How long the change took, in nanoseconds
+	Actor      string            `json:"actor"`                // Who initiated the change: a user, the API key, or reload
+	Action     DeploymentAction  `json:"action"`               // What was changed
+	Stem       string            `json:"stem"`                 // Stem that was changed
+	Version    string            `json:"version,omitempty"`    // Version that was changed, or the version rolled back to
+	Parameters map[string]string `json:"parameters,omitempty"` // Parameters of the change, e.g. the artifact or replica count
+	Outcome    DeploymentOutcome `json:"outcome"`              // Whether the change succeeded
+	Error      string            `json:"error,omitempty"`      // Why the change failed
+}
+
+const (
+	EventLeafRecycled       EventType = "LEAF_RECYCLED"        // A leaf was replaced after reaching its request count or age limit
+	EventLeafMemoryExceeded EventType = "LEAF_MEMORY_EXCEEDED" // A leaf was replaced because it used more memory than allowed
+	EventAlertFiring        EventType = "ALERT_FIRING"         // A stem breached one of its alert thresholds
+	EventAlertResolved      EventType = "ALERT_RESOLVED"       // A stem is back within an alert threshold it breached
+	EventDeploySucceeded    EventType = "DEPLOY_SUCCEEDED"     // A stem was registered and its leafs started
+	EventLeafCrashLooping   EventType = "LEAF_CRASH_LOOPING"   // A stem started more leafs within an hour than maxRestartsPerHour allows
+	EventStemScaledToZero   EventType = "STEM_SCALED_TO_ZERO"  // The last running leaf of a stem stopped
+	EventMaintenanceEntered EventType = "MAINTENANCE_ENTERED"  // The platform switched its backends to the maintenance page
+	EventMaintenanceExited  EventType = "MAINTENANCE_EXITED"   // The platform routes requests to the leafs again
+	EventStemUpdated        EventType = "STEM_UPDATED"         // A registered stem's config was changed in place
+	EventStemScaled         EventType = "STEM_SCALED"          // A stem was scaled to a number of running leafs
+	EventTrafficSplit       EventType = "TRAFFIC_SPLIT"        // The requests to a stem's backend were split across its versions
+	EventOrphansReclaimed   EventType = "ORPHANS_RECLAIMED"    // The sweeper cleaned up after leafs that died or were lost
+	EventLeafUnhealthy      EventType = "LEAF_UNHEALTHY"       // A leaf was replaced after failing its liveness probe
+	EventDrainStarted       EventType = "DRAIN_STARTED"        // The host started draining its leafs for maintenance
+	EventHostDrained        EventType = "HOST_DRAINED"         // No leafs are left on the draining host, it is safe to reboot
+	EventWorkerCrashed      EventType = "WORKER_CRASHED"       // A background worker panicked and was recovered
+	EventDriftReconciled    EventType = "DRIFT_RECONCILED"     // The proxy's configuration was repaired to match the state
+	EventLeafEjected        EventType = "LEAF_EJECTED"         // The proxy took a leaf out of rotation after a burst of errors
+	EventSecretRotated      EventType = "SECRET_ROTATED"       // The leafs of a stem were rolled onto secrets that changed
+	EventStemRolledBack     EventType = "STEM_ROLLED_BACK"     // A stem was returned to the version registered before its newest one
+	EventNodeLost           EventType = "NODE_LOST"            // A node stopped answering and its leafs were rescheduled on other nodes
+	EventNodeRecovered      EventType = "NODE_RECOVERED"       // A lost node answers again and takes new leafs
+)
+
+// EventTypes lists every event type, in the order they were introduced.
+var EventTypes = []EventType{
+	EventLeafRecycled, EventLeafMemoryExceeded, EventAlertFiring, EventAlertResolved,
+	EventDeploySucceeded, EventLeafCrashLooping, EventStemScaledToZero, EventMaintenanceEntered, EventMaintenanceExited,
+	EventStemUpdated, EventStemScaled, EventOrphansReclaimed, EventLeafUnhealthy, EventDrainStarted, EventHostDrained,
+	EventWorkerCrashed, EventDriftReconciled, EventLeafEjected, EventTrafficSplit,
+	EventSecretRotated, EventStemRolledBack, EventNodeLost, EventNodeRecovered,
+}
+
+// Alert reports a stem breaching, or no longer breaching, one of its alert thresholds.
+type Alert struct {
+	Stem      string     `json:"stem"`      // Stem the alert concerns
+	Version   string     `json:"version"`   // Version of the stem
+	Rule      AlertRule  `json:"rule"`      // Threshold that was breached
+	State     AlertState `json:"state"`     // Whether the threshold is still breached
+	Value     string     `json:"value"`     // Measured value, e.g. "7" restarts or "850ms"
+	Threshold string     `json:"threshold"` // Configured threshold
+	Message   string     `json:"message"`   // Human-readable description
+	Since     time.Time  `json:"since"`     // When the alert started firing
+	Time      time.Time  `json:"time"`      // When the alert entered its current state
+}
+
+// MaintenanceStatus reports whether the platform is in maintenance mode.
+type MaintenanceStatus struct {
+	Enabled  bool       `json:"enabled"`            // Whether the backends answer with the maintenance page
+	Since    *time.Time `json:"since,omitempty"`    // When maintenance mode was entered
+	Backends []string   `json:"backends,omitempty"` // Backends switched to the maintenance page
+}
+
+// DrainStatus reports the progress of draining the host for maintenance.
+type DrainStatus struct {
+	Draining     bool       `json:"draining"`            // Whether the host refuses deployments and new leafs
+	Since        *time.Time `json:"since,omitempty"`     // When draining started
+	Handoff      bool       `json:"handoff,omitempty"`   // Whether leafs are handed to other nodes before they stop
+	HandedOff    []string   `json:"handedOff,omitempty"` // Leafs stopped after a replacement started on another node, as leaf=replacement
+	Stopped      []string   `json:"stopped,omitempty"`   // Leafs stopped without a replacement
+	Failed       []string   `json:"failed,omitempty"`    // Leafs that could not be stopped, with the error
+	Remaining    []string   `json:"remaining,omitempty"` // Leafs still on the host
+	Finished     bool       `json:"finished,omitempty"`  // Whether every leaf on the host was handled
+	SafeToReboot bool       `json:"safeToReboot"`        // Whether every leaf was handled and none is left on the host
+}
+
+// SweepReport lists what a sweep for orphaned leafs, proxy servers, and ports reclaimed.
+type SweepReport struct {
+	DeadLeafs    []string `json:"deadLeafs"`        // Leafs whose process was gone, cleaned up and removed
+	StaleServers []string `json:"staleServers"`     // Proxy servers without a leaf, as backend/server, unbound
+	FreedPorts   []string `json:"freedPorts"`       // Port reservations without a leaf, e.g. 8003/tcp, released
+	HeldPorts    []string `json:"heldPorts"`        // Freed ports still bound by a process herbarium doesn't know
+	Errors       []string `json:"errors,omitempty"` // What could not be reclaimed, retried by the next sweep
+}
+
+// DriftReport lists where the proxy's configuration drifted from the state and what a reconciliation repaired.
+type DriftReport struct {
+	MissingBackends []string `json:"missingBackends"`  // Backends of stems missing from the proxy, recreated with their leafs' servers
+	MissingServers  []string `json:"missingServers"`   // Servers of running leafs missing from their backend, as backend/server, rebound
+	StaleServers    []string `json:"staleServers"`     // Servers pointing at no live leaf, as backend/server, unbound
+	StaleBackends   []string `json:"staleBackends"`    // Backends herbarium created for no current stem, emptied of their servers
+	ForeignBackends []string `json:"foreignBackends"`  // Backends herbarium didn't create, left alone
+	Errors          []string `json:"errors,omitempty"` // What could not be repaired, retried by the next reconciliation
+}
+
+// AlertRule names a kind of alert threshold.
+type AlertRule string
+
+const (
+	AlertRestartRate  AlertRule = "RESTART_RATE"  // Too many leaf starts within the last hour
+	AlertLatency      AlertRule = "LATENCY"       // A leaf responds slower than allowed
+	AlertHealthyLeafs AlertRule = "HEALTHY_LEAFS" // Too few running leafs
+)
+
+// AlertState defines whether an alert is active.
+type AlertState string
+
+const (
+	AlertFiring   AlertState = "FIRING"   // The threshold is breached
+	AlertResolved AlertState = "RESOLVED" // The threshold is no longer breached
+)
+
+// PolicyConfig defines an admission policy stems must comply with to be registered.
+type PolicyConfig struct {
+	Name            string       `yaml:"name"`            // Name given in the rejection reason
+	Stems           []string     `yaml:"stems"`           // Glob patterns of the stem names it applies to, all stems when empty
+	AllowedCommands []string     `yaml:"allowedCommands"` // Glob patterns the command must match one of, any command when empty
+	RequiredLabels  []string     `yaml:"requiredLabels"`  // Labels that must be set to a non-empty value
+	PortRange       string       `yaml:"portRange"`       // "min-max" range fixed ports must be in, e.g. "20000-29999"
+	Rules           []PolicyRule `yaml:"rules"`           // CEL expressions the stem config must satisfy
+}
+
+// PolicyRule is a CEL expression over the stem config, available as stem with the keys of config.yaml, that
+// must evaluate to true, e.g. stem.command.startsWith('./bin/').
+type PolicyRule struct {
+	Expression string `yaml:"expression"` // CEL expression evaluating to a bool
+	Message    string `yaml:"message"`    // Reason given when it doesn't hold, defaults to the expression
+}
+
+// NotificationConfig defines a hook posting selected events to a webhook or a Slack channel.
+type NotificationConfig struct {
+	Name     string            `yaml:"name"`     // Name used in logs
+	Type     string            `yaml:"type"`     // "webhook" or "slack"
+	URL      string            `yaml:"url"`      // Endpoint the payload is posted to, an incoming webhook URL for Slack
+	Headers  map[string]string `yaml:"headers"`  // Extra headers sent with the payload, e.g. Authorization
+	Events   []EventType       `yaml:"events"`   // Event types posted, all of them when empty
+	Template string            `yaml:"template"` // text/template rendering the JSON payload from the event, defaults per type
+	Retries  *int              `yaml:"retries"`  // Times a failed delivery is retried, defaults to 3
+}
+
 type GlobalConfig struct {
+	APIVersion string `yaml:"apiVersion"` // Config schema version, older versions are migrated on load
 	Plantarium struct {
 		RootFolder string `yaml:"root_folder"`
 		LogFolder  string `yaml:"log_folder"`
 	} `yaml:"plantarium"`
 	HAProxy struct {
-		URL      string `yaml:"url"`
-		Login    string `yaml:"login"`
-		Password string `yaml:"password"`
+		URL       string `yaml:"url"`
+		Login     string `yaml:"login"`
+		Password  string `yaml:"password"`
+		Instances []struct {
+			Name     string `yaml:"name"`     // Instance name used in logs and errors
+			URL      string `yaml:"url"`      // Dataplane API URL of the instance
+			Login    string `yaml:"login"`    // Defaults to haproxy.login
+			Password string `yaml:"password"` // Defaults to haproxy.password
+		} `yaml:"instances"` // HAProxy instances every change is applied to, replacing url when set
+		Frontend  string `yaml:"frontend"` // Frontend herbarium adds a use_backend rule to per backend, required by the stem naming strategy
+		Mode      string `yaml:"mode"`     // "dataplane" (default) manages HAProxy, "none" only logs the changes for local development
+		Preflight struct {
+			Disabled bool   `yaml:"disabled"` // Build the client without checking the Dataplane API at startup
+			Attempts int    `yaml:"attempts"` // Checks before giving up, defaults to 5
+			Backoff  string `yaml:"backoff"`  // Wait after the first failed check, doubled after each further one, defaults to 1s
+			Degraded bool   `yaml:"degraded"` // Start with bindings deferred until HAProxy is reachable instead of failing
+		} `yaml:"preflight"`
 	} `yaml:"haproxy"`
+	Proxy struct {
+		Type  string `yaml:"type"` // Reverse proxy herbarium manages: "haproxy" (default), "nginx", "traefik", or "embedded"
+		Nginx struct {
+			ConfigFile    string `yaml:"config_file"`    // File the upstreams are rendered to, included from the http block
+			Template      string `yaml:"template"`       // Custom text/template replacing the default upstream rendering
+			ReloadCommand string `yaml:"reload_command"` // Defaults to "nginx -s reload"
+			TestCommand   string `yaml:"test_command"`   // Defaults to "nginx -t"
+		} `yaml:"nginx"`
+		Traefik struct {
+			ListenAddress string   `yaml:"listen_address"` // Address of the HTTP provider endpoint, defaults to :8091
+			APIKey        string   `yaml:"api_key"`        // API key Traefik must send in the X-API-Key header
+			EntryPoints   []string `yaml:"entry_points"`   // Entry points of the generated routers
+		} `yaml:"traefik"`
+		Embedded struct {
+			ListenAddress       string `yaml:"listen_address"`        // Address the proxy listens on, defaults to :8080
+			HealthCheckInterval string `yaml:"health_check_interval"` // Interval between health checks, defaults to 5s
+		} `yaml:"embedded"`
+		BackendNaming struct {
+			Strategy string `yaml:"strategy"` // "url" (default) names backends after the stem's URL, "stem" after its name and version
+			Prefix   string `yaml:"prefix"`   // Prepended to backend names of the stem strategy
+		} `yaml:"backend_naming"`
+	} `yaml:"proxy"`
 	Security struct {
 		APIKey string `yaml:"api_key"`
 	} `yaml:"security"`
+	API struct {
+		ListenAddress string `yaml:"listen_address"`
+		SwaggerUI     bool   `yaml:"swagger_ui"` // Serve Swagger UI for the OpenAPI document at /docs
+	} `yaml:"api"`
+	Leafs struct {
+		BindAddress      string            `yaml:"bind_address"`      // Interface leafs on this host listen on, defaults to the stem's loopback address
+		AdvertiseAddress string            `yaml:"advertise_address"` // Address the proxy reaches them at, defaults to a specific bind address or loopback
+		Env              map[string]string `yaml:"env"`               // Environment variables of every leaf, beneath the stem's own env
+		SystemEnv        map[string]string `yaml:"system_env"`        // Environment variables of system stems' leafs, over env
+		DeploymentEnv    map[string]string `yaml:"deployment_env"`    // Environment variables of deployment stems' leafs, over env
+	} `yaml:"leafs"`
+	Snapshot struct {
+		Folder   string `yaml:"folder"`   // Defaults to system/herbarium/snapshots under the root folder
+		Interval string `yaml:"interval"` // Go duration between scheduled snapshots (e.g. "15m"); empty disables scheduling
+		Retain   int    `yaml:"retain"`   // Number of snapshots to keep
+	} `yaml:"snapshot"`
+	Recycler struct {
+		Interval string `yaml:"interval"` // Go duration between checks for leafs due for recycling, defaults to 1m
+	} `yaml:"recycler"`
+	Sweeper struct {
+		Interval string `yaml:"interval"` // Go duration between sweeps for orphaned leafs, servers, and ports, defaults to 5m
+	} `yaml:"sweeper"`
+	Drift struct {
+		Interval string `yaml:"interval"` // Go duration between checks of the proxy's configuration against the state, defaults to 10m
+	} `yaml:"drift"`
+	NodeMonitor struct {
+		Interval string `yaml:"interval"` // Go duration between checks of the nodes' agents, defaults to 10s
+	} `yaml:"node_monitor"`
+	Janitor struct {
+		Interval  string `yaml:"interval"`  // Go duration between purges of expired tombstones, defaults to 10m
+		Retention string `yaml:"retention"` // Go duration the tombstones of unregistered stems are kept, defaults to 24h
+	} `yaml:"janitor"`
+	Scheduler struct {
+		Interval string `yaml:"interval"` // Go duration between checks of the stems' scaling schedules, defaults to 1m
+	} `yaml:"scheduler"`
+	Autoscaler struct {
+		Interval string `yaml:"interval"` // Go duration between checks of the stems' autoscale targets, defaults to 30s
+	} `yaml:"autoscaler"`
+	Alerting struct {
+		Interval string `yaml:"interval"` // Go duration between evaluations of the stems' alert thresholds, defaults to 30s
+		Channels []struct {
+			Name    string            `yaml:"name"`    // Name stems refer to in alerts.channels
+			Type    string            `yaml:"type"`    // "log" or "webhook"
+			URL     string            `yaml:"url"`     // Endpoint webhook alerts are posted to as JSON
+			Headers map[string]string `yaml:"headers"` // Extra headers sent with webhook alerts, e.g. Authorization
+		} `yaml:"channels"` // Where alerts are sent; without channels they are only logged and recorded as events
+	} `yaml:"alerting"`
+	Journal struct {
+		File     string `yaml:"file"`     // Defaults to system/herbarium/journal.jsonl under the root folder
+		Fsync    bool   `yaml:"fsync"`    // Flush every entry to disk before the mutation completes
+		Disabled bool   `yaml:"disabled"` // Turns off journaling
+	} `yaml:"journal"`
+	Deployments struct {
+		File     string `yaml:"file"`     // Defaults to system/herbarium/deployments.jsonl under the root folder
+		Disabled bool   `yaml:"disabled"` // Turns off the deployment history
+	} `yaml:"deployments"`
+	Storage struct {
+		Backend  string `yaml:"backend"`  // Backend mirroring the state: "memory" (default, none), "file", "redis", or "etcd"
+		Address  string `yaml:"address"`  // Redis "host:port" or etcd endpoint URL
+		Username string `yaml:"username"` // etcd user (optional)
+		Password string `yaml:"password"` // Redis or etcd password (optional)
+		DB       int    `yaml:"db"`       // Redis database number
+		Prefix   string `yaml:"prefix"`   // Key prefix, defaults to "herbarium/"
+		Path     string `yaml:"path"`     // Directory of the file backend, defaults to system/herbarium/state under the root folder
+	} `yaml:"storage"`
+	HA struct {
+		Enabled  bool   `yaml:"enabled"`   // Run as one of several replicas; only the elected leader manages services
+		NodeID   string `yaml:"node_id"`   // Identity in the election, defaults to <hostname>-<pid>
+		LeaseTTL string `yaml:"lease_ttl"` // Go duration of the leader lease (default 15s); bounds the failover time
+	} `yaml:"ha"`
+	Agents []struct {
+		Name   string `yaml:"name"`    // Name referenced by the agent field of stem configs
+		URL    string `yaml:"url"`     // Agent API URL, e.g. http://10.0.0.5:50052
+		APIKey string `yaml:"api_key"` // API key configured on the agent
+		Host   string `yaml:"host"`    // Address HAProxy uses to reach the agent's leafs, defaults to the URL host
+	} `yaml:"agents"`
+	Nodes []struct {
+		Name     string            `yaml:"name"`      // Unique node name
+		Address  string            `yaml:"address"`   // Address HAProxy uses to reach the node's leafs, defaults to localhost or the agent host
+		Agent    string            `yaml:"agent"`     // Agent running leafs on the node, empty for the herbarium host
+		Labels   map[string]string `yaml:"labels"`    // Labels matched against stem placement constraints
+		MemoryMB int               `yaml:"memory_mb"` // Memory available to leafs, 0 means unlimited
+	} `yaml:"nodes"`
+	Notifications []NotificationConfig `yaml:"notifications"` // Hooks posting selected events to webhooks or Slack
+	Hooks         struct {
+		Plugins     []string `yaml:"plugins"` // Go plugins whose Register function adds hooks
+		Executables []struct {
+			Path    string   `yaml:"path"`    // Executable run with the extension point as its argument
+			Points  []string `yaml:"points"`  // Extension points it runs at, e.g. before_register_stem
+			Timeout string   `yaml:"timeout"` // Go duration after which it is killed, defaults to 10s
+		} `yaml:"executables"`
+	} `yaml:"hooks"` // Extension points vetoing or enriching stem registration, leaf starts and proxy binds
+	Admission struct {
+		Policies []PolicyConfig `yaml:"policies"` // Policies every stem is checked against at registration
+	} `yaml:"admission"`
+	Kubernetes struct {
+		Kubeconfig string `yaml:"kubeconfig"` // Kubeconfig of the cluster stems with kubernetes run their leafs in
+		Context    string `yaml:"context"`    // Context of the kubeconfig, defaults to its current context
+		InCluster  bool   `yaml:"in_cluster"` // Use the service account of the pod herbarium runs in instead of a kubeconfig
+		Namespace  string `yaml:"namespace"`  // Namespace of the leaf pods, defaults to the context's namespace or default
+	} `yaml:"kubernetes"`
+	Firecracker struct {
+		Enabled  bool   `yaml:"enabled"`   // Run the leafs of stems with firecracker in microVMs, experimental
+		Binary   string `yaml:"binary"`    // Firecracker executable, defaults to firecracker on the PATH
+		StateDir string `yaml:"state_dir"` // Directory of the microVMs' API sockets, defaults to system/herbarium/firecracker under the root folder
+		Subnet   string `yaml:"subnet"`    // IPv4 network the microVMs get a /30 of each, defaults to 172.30.0.0/16
+	} `yaml:"firecracker"`
+	Artifacts struct {
+		Timeout string `yaml:"timeout"` // Go duration an artifact download may take, defaults to 10m
+		S3      struct {
+			Endpoint        string `yaml:"endpoint"`          // S3 API URL, defaults to AWS in the region; set for MinIO and other compatible stores
+			Region          string `yaml:"region"`            // Defaults to AWS_REGION or us-east-1
+			AccessKeyID     string `yaml:"access_key_id"`     // Defaults to AWS_ACCESS_KEY_ID, anonymous when neither is set
+			SecretAccessKey string `yaml:"secret_access_key"` // Defaults to AWS_SECRET_ACCESS_KEY
+			SessionToken    string `yaml:"session_token"`     // Defaults to AWS_SESSION_TOKEN (optional)
+		} `yaml:"s3"`
+		Registries []struct {
+			Host     string `yaml:"host"`     // Registry host, e.g. ghcr.io or registry.internal:5000
+			Username string `yaml:"username"` // Credentials for the registry's token or basic authentication
+			Password string `yaml:"password"`
+			Insecure bool   `yaml:"insecure"` // Reach the registry over plain HTTP
+		} `yaml:"registries"`
+		Signing struct {
+			Type      string `yaml:"type"`       // minisign or cosign
+			PublicKey string `yaml:"public_key"` // Key artifacts are signed with, inline or the path of a key file
+			Required  bool   `yaml:"required"`   // Refuse unsigned artifacts and uploaded archives
+		} `yaml:"signing"`
+	} `yaml:"artifacts"` // Where deployed artifacts are fetched from
+	Nix struct {
+		Binary  string `yaml:"binary"`  // Nix executable, defaults to nix on the PATH
+		Timeout string `yaml:"timeout"` // Go duration a stem's environment may take to build, defaults to 10m
+	} `yaml:"nix"` // How the nix environments of stems are materialized
+	Secrets struct {
+		Interval string `yaml:"interval"` // Go duration between lease renewals and checks for rotated secrets, defaults to 1m
+		Vault    struct {
+			Address   string `yaml:"address"`   // Vault URL, e.g. https://vault.internal:8200; secrets can't be resolved without it
+			Namespace string `yaml:"namespace"` // Vault Enterprise namespace (optional)
+			Token     string `yaml:"token"`     // Token authenticating to Vault, instead of an AppRole
+			AppRole   struct {
+				RoleID   string `yaml:"role_id"`   // Role ID of the AppRole herbarium logs in with
+				SecretID string `yaml:"secret_id"` // Secret ID of the AppRole
+				Mount    string `yaml:"mount"`     // Path the AppRole auth method is mounted at, defaults to approle
+			} `yaml:"approle"`
+		} `yaml:"vault"`
+	} `yaml:"secrets"` // Provider resolving secret://<path>#<key> references in leaf env
+	Maintenance struct {
+		PageFile string `yaml:"page_file"` // HTML page served with 503 in maintenance mode, defaults to a built-in page
+	} `yaml:"maintenance"`
 }